@@ -1,6 +1,7 @@
 package ann
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -64,6 +65,32 @@ func (a *Ann) sortKey() string {
 
 type Anns []*Ann
 
-func (vs Anns) Len() int           { return len(vs) }
-func (vs Anns) Swap(i, j int)      { vs[i], vs[j] = vs[j], vs[i] }
-func (vs Anns) Less(i, j int) bool { return vs[i].sortKey() < vs[j].sortKey() }
+func (vs Anns) Len() int      { return len(vs) }
+func (vs Anns) Swap(i, j int) { vs[i], vs[j] = vs[j], vs[i] }
+func (vs Anns) Less(i, j int) bool {
+	if ki, kj := vs[i].sortKey(), vs[j].sortKey(); ki != kj {
+		return ki < kj
+	}
+	return annTieLess(vs[i], vs[j])
+}
+
+// annTieLess orders distinct anns whose sort keys are equal (which
+// can occur because the sort key omits Data, and its fields may
+// contain the delimiter), so that sorting anns doesn't depend on their
+// original order.
+func annTieLess(a, b *Ann) bool {
+	as := [...]string{a.Repo, a.CommitID, a.UnitType, a.Unit, a.Type, a.File}
+	bs := [...]string{b.Repo, b.CommitID, b.UnitType, b.Unit, b.Type, b.File}
+	for i := range as {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	if a.Start != b.Start {
+		return a.Start < b.Start
+	}
+	if a.End != b.End {
+		return a.End < b.End
+	}
+	return bytes.Compare(a.Data, b.Data) < 0
+}
@@ -1,6 +1,10 @@
 package ann
 
-import "testing"
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
 
 func TestAnn_LinkURL(t *testing.T) {
 	want := "http://example.com"
@@ -30,3 +34,24 @@ func TestAnn_LinkURL_badURL(t *testing.T) {
 		t.Fatal("LinkURL returned nil error")
 	}
 }
+
+func TestAnns_Sort_ties(t *testing.T) {
+	anns := []*Ann{
+		{File: "f", Type: "t", Start: 1, End: 2, Data: []byte(`"b"`)},
+		{File: "f", Type: "t", Start: 1, End: 2, Data: []byte(`"a"`)},
+		{File: "f", Type: "t", Start: 1, End: 2},
+		{File: "b:f", Type: "t", Start: 1, End: 2},
+		{File: "f", Type: "t:b", Start: 1, End: 2},
+	}
+	var want []*Ann
+	for i := 0; i < len(anns); i++ {
+		// Rotate the input so that each ann is first once.
+		got := append(append([]*Ann{}, anns[i:]...), anns[:i]...)
+		sort.Sort(Anns(got))
+		if want == nil {
+			want = got
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("rotation %d: got order %v, want %v", i, got, want)
+		}
+	}
+}
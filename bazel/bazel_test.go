@@ -0,0 +1,143 @@
+package bazel
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	data := []byte(`load("//tools:defs.bzl", "gen")
+
+# A comment.
+VERSION = "1.0"
+
+cc_library(
+    name = 'lib',
+    srcs = glob(["*.c"]) + ["extra.c"],
+    copts = ["-O2"],
+    doc = """multi
+line""",
+)
+
+if True:
+    pass
+`)
+	f, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls []string
+	for _, c := range f.Calls {
+		s := c.Func.Text + "("
+		for _, a := range c.Args {
+			if a.Name != nil {
+				s += a.Name.Text + "="
+			}
+			for _, str := range a.Strings {
+				if got := string(data[str.Start:str.End]); got != str.Text {
+					s += "[" + str.Text + "@" + got + "]"
+				} else {
+					s += "[" + str.Text + "]"
+				}
+			}
+			s += ";"
+		}
+		calls = append(calls, s+")")
+	}
+	want := []string{
+		"load([//tools:defs.bzl];[gen];)",
+		"cc_library(name=[lib];srcs=[*.c][extra.c];copts=[-O2];doc=[multi\nline];)",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got calls %q, want %q", calls, want)
+	}
+
+	if _, err := Parse([]byte("x = 'unterminated\n")); err == nil {
+		t.Error("got no error for unterminated string")
+	}
+}
+
+type fileInfo struct{ os.FileInfo }
+
+func (fileInfo) IsDir() bool        { return false }
+func (fileInfo) ModTime() time.Time { return time.Time{} }
+
+func TestGraph(t *testing.T) {
+	files := map[string]bool{
+		"app/main.c":     true,
+		"app/util.h":     true,
+		"lib/BUILD":      true,
+		"lib/lib.h":      true,
+		"tools/defs.bzl": true,
+	}
+	stat := func(p string) (os.FileInfo, error) {
+		if files[p] {
+			return fileInfo{}, nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	data := []byte(`load("//tools:defs.bzl", "gen")
+load("@rules_cc//cc:defs.bzl", "cc_binary")
+
+genrule(
+    name = "version",
+    outs = ["version.h"],
+    cmd = "echo > util.h",
+)
+
+cc_binary(
+    name = "app",
+    srcs = ["main.c", "util.h", ":version.h", "missing.c"],
+    deps = [":version", "//lib", "//lib:lib.h", "@zlib//:zlib"],
+    copts = ["util.h"],
+)
+`)
+	o, err := Graph("app/BUILD", data, stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var defs []string
+	for _, d := range o.Defs {
+		defs = append(defs, d.Kind+" "+d.Path)
+	}
+	sort.Strings(defs)
+	wantDefs := []string{
+		"cc_binary target/app",
+		"file file/app/main.c", "file file/app/util.h", "file file/lib/lib.h", "file file/tools/defs.bzl",
+		"genrule target/version",
+		"output target/version.h",
+		"package .",
+	}
+	if !reflect.DeepEqual(defs, wantDefs) {
+		t.Errorf("got defs %q, want %q", defs, wantDefs)
+	}
+
+	refs := map[string][]string{}
+	for _, r := range o.Refs {
+		if r.Def {
+			continue
+		}
+		key := r.DefPath
+		if r.DefUnitType != "" {
+			key = r.DefUnit + " " + r.DefPath
+		}
+		refs[key] = append(refs[key], string(data[r.Start:r.End]))
+	}
+	want := map[string][]string{
+		"file/tools/defs.bzl": {"//tools:defs.bzl"},
+		"file/app/main.c":     {"main.c"},
+		"file/app/util.h":     {"util.h"},
+		"target/version.h":    {":version.h"},
+		"target/version":      {":version"},
+		"lib target/lib":      {"//lib"},
+		"file/lib/lib.h":      {"//lib:lib.h"},
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("got refs %v, want %v", refs, want)
+	}
+}
@@ -0,0 +1,198 @@
+package bazel
+
+import (
+	"os"
+	"path"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// UnitType is the source unit type of Bazel packages. Each package (a
+// directory with a BUILD file) is its own source unit, named by its
+// directory ("." for the root package).
+const UnitType = "BazelPackage"
+
+// IsBuildFile returns whether file is a BUILD file (named "BUILD" or
+// "BUILD.bazel").
+func IsBuildFile(file string) bool {
+	switch path.Base(file) {
+	case "BUILD", "BUILD.bazel":
+		return true
+	}
+	return false
+}
+
+// nonLabelArgs are the names of common rule attributes whose values
+// aren't labels.
+var nonLabelArgs = map[string]bool{
+	"name": true, "tags": true, "licenses": true, "features": true,
+	"copts": true, "linkopts": true, "defines": true, "local_defines": true,
+	"cmd": true, "cmd_bash": true, "args": true, "env": true,
+	"includes": true, "include_prefix": true, "strip_include_prefix": true,
+	"importpath": true, "main_class": true, "size": true, "timeout": true,
+}
+
+// Graph returns the defs and refs in the BUILD file with the given path
+// and contents.
+//
+// The package's targets (and the output files of rules, which can be
+// referred to as targets) are defs. Labels in rule attributes are refs,
+// to targets in this package or in other packages of the repository, or
+// to the source files that they name. A load statement's label is a ref
+// to the .bzl file. Labels in external repositories ("@repo//...") are
+// not resolved.
+//
+// The stat func is called to determine whether files and packages
+// exist. If it is nil, only refs to this package's targets are emitted.
+func Graph(file string, data []byte, stat func(string) (os.FileInfo, error)) (*graph.Output, error) {
+	f, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	g := &grapher{file: file, pkg: path.Dir(file), stat: stat, o: &graph.Output{}, defs: map[string]bool{}}
+	g.o.Defs = append(g.o.Defs, &graph.Def{
+		DefKey:   graph.DefKey{Path: "."},
+		Name:     g.pkg,
+		Kind:     "package",
+		Exported: true,
+	})
+
+	for _, c := range f.Calls {
+		if name := c.Arg("name"); name != nil && len(name.Strings) == 1 {
+			g.def(c.Func.Text, name.Strings[0])
+		}
+		for _, outs := range []string{"out", "outs"} {
+			if a := c.Arg(outs); a != nil {
+				for _, s := range a.Strings {
+					g.def("output", s)
+				}
+			}
+		}
+	}
+
+	for _, c := range f.Calls {
+		if c.Func.Text == "load" {
+			if len(c.Args) > 0 && c.Args[0].Name == nil && len(c.Args[0].Strings) > 0 {
+				g.labelRef(c.Args[0].Strings[0])
+			}
+			continue
+		}
+		for _, a := range c.Args {
+			if a.Name != nil && (nonLabelArgs[a.Name.Text] || a.Name.Text == "out" || a.Name.Text == "outs") {
+				continue
+			}
+			for _, s := range a.Strings {
+				g.labelRef(s)
+			}
+		}
+	}
+	return g.o, nil
+}
+
+type grapher struct {
+	file, pkg string
+	stat      func(string) (os.FileInfo, error)
+	o         *graph.Output
+	defs      map[string]bool // paths of emitted defs
+}
+
+// def emits a def of the given kind for the target named by t, unless
+// one with the same path was already emitted.
+func (g *grapher) def(kind string, t *Token) {
+	if t.Text == "" || strings.ContainsAny(t.Text, ":$") {
+		return
+	}
+	defPath := "target/" + t.Text
+	if g.defs[defPath] {
+		return
+	}
+	g.defs[defPath] = true
+	g.o.Defs = append(g.o.Defs, &graph.Def{
+		DefKey:   graph.DefKey{Path: defPath},
+		Name:     t.Text,
+		Kind:     kind,
+		File:     g.file,
+		DefStart: uint32(t.Start),
+		DefEnd:   uint32(t.End),
+		Exported: true,
+	})
+	g.o.Refs = append(g.o.Refs, &graph.Ref{DefPath: defPath, Def: true, File: g.file, Start: uint32(t.Start), End: uint32(t.End)})
+}
+
+// labelRef emits a ref for the label t, if it refers to a target or
+// file in the repository.
+func (g *grapher) labelRef(t *Token) {
+	label := t.Text
+	if strings.HasPrefix(label, "@//") {
+		label = label[1:] // the main repository
+	}
+	if label == "" || strings.HasPrefix(label, "@") || strings.ContainsAny(label, "*$ ") {
+		return
+	}
+
+	pkg, name := g.pkg, label
+	if strings.HasPrefix(label, "//") {
+		label = label[2:]
+		if i := strings.Index(label, ":"); i != -1 {
+			pkg, name = label[:i], label[i+1:]
+		} else {
+			pkg, name = label, path.Base(label)
+		}
+		if pkg == "" {
+			pkg = "."
+		}
+	} else {
+		name = strings.TrimPrefix(label, ":")
+	}
+	if name == "" || strings.Contains(name, ":") || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return
+	}
+
+	defPath := "target/" + name
+	if pkg == g.pkg {
+		if g.defs[defPath] {
+			g.o.Refs = append(g.o.Refs, &graph.Ref{DefPath: defPath, File: g.file, Start: uint32(t.Start), End: uint32(t.End)})
+			return
+		}
+	}
+	if g.stat == nil {
+		return
+	}
+	if p := path.Join(pkg, name); g.isFile(p) {
+		g.fileRef(p, t)
+		return
+	}
+	if pkg != g.pkg && (g.isFile(path.Join(pkg, "BUILD")) || g.isFile(path.Join(pkg, "BUILD.bazel"))) {
+		g.o.Refs = append(g.o.Refs, &graph.Ref{
+			DefUnitType: UnitType,
+			DefUnit:     pkg,
+			DefPath:     defPath,
+			File:        g.file,
+			Start:       uint32(t.Start),
+			End:         uint32(t.End),
+		})
+	}
+}
+
+func (g *grapher) isFile(p string) bool {
+	fi, err := g.stat(p)
+	return err == nil && !fi.IsDir()
+}
+
+// fileRef emits a ref (at t) to the file in the repository with the
+// given path, and a def (of kind "file") for it.
+func (g *grapher) fileRef(p string, t *Token) {
+	defPath := "file/" + p
+	if !g.defs[defPath] {
+		g.defs[defPath] = true
+		g.o.Defs = append(g.o.Defs, &graph.Def{
+			DefKey:   graph.DefKey{Path: defPath},
+			Name:     p,
+			Kind:     "file",
+			File:     p,
+			Exported: true,
+		})
+	}
+	g.o.Refs = append(g.o.Refs, &graph.Ref{DefPath: defPath, File: g.file, Start: uint32(t.Start), End: uint32(t.End)})
+}
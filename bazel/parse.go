@@ -0,0 +1,227 @@
+// Package bazel graphs Bazel BUILD files.
+package bazel
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A Token is an identifier or the value of a string literal (with
+// escapes processed), at the given byte offsets. For strings, the
+// offsets exclude the quotes.
+type Token struct {
+	Text       string
+	Start, End int
+}
+
+// A Call is a top-level function call (usually of a rule or macro)
+// in a BUILD file.
+type Call struct {
+	Func *Token
+	Args []*Arg
+}
+
+// Arg returns the keyword argument with the given name, or nil.
+func (c *Call) Arg(name string) *Arg {
+	for _, a := range c.Args {
+		if a.Name != nil && a.Name.Text == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// An Arg is an argument of a call.
+type Arg struct {
+	// Name is the argument's keyword, or nil for positional arguments.
+	Name *Token
+
+	// Strings are the string literals in the argument's value.
+	Strings []*Token
+}
+
+// File is the result of parsing a BUILD file.
+type File struct {
+	Calls []*Call
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNewline
+	tokIdent
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind tokKind
+	Token
+}
+
+// Parse parses the BUILD file in data. Only top-level function calls
+// are recorded; other statements are skipped.
+func Parse(data []byte) (*File, error) {
+	toks, err := lex(data)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{}
+	for i := 0; i < len(toks); {
+		t := toks[i]
+		if t.kind == tokIdent && toks[i+1].kind == tokPunct && toks[i+1].Text == "(" {
+			call := &Call{Func: &toks[i].Token}
+			i = parseArgs(toks, i+2, call)
+			f.Calls = append(f.Calls, call)
+			continue
+		}
+		// Skip the statement.
+		for depth := 0; toks[i].kind != tokEOF; i++ {
+			if isOpen(toks[i]) {
+				depth++
+			} else if isClose(toks[i]) {
+				depth--
+			} else if toks[i].kind == tokNewline && depth <= 0 {
+				break
+			}
+		}
+		if toks[i].kind == tokEOF {
+			break
+		}
+		i++
+	}
+	return f, nil
+}
+
+func isOpen(t token) bool {
+	return t.kind == tokPunct && (t.Text == "(" || t.Text == "[" || t.Text == "{")
+}
+
+func isClose(t token) bool {
+	return t.kind == tokPunct && (t.Text == ")" || t.Text == "]" || t.Text == "}")
+}
+
+// parseArgs parses the arguments of a call, starting after the "(",
+// and returns the index of the token after the closing ")".
+func parseArgs(toks []token, i int, call *Call) int {
+	arg := &Arg{}
+	depth := 0
+	for ; toks[i].kind != tokEOF; i++ {
+		t := toks[i]
+		switch {
+		case depth == 0 && t.kind == tokPunct && (t.Text == "," || t.Text == ")"):
+			if arg.Name != nil || len(arg.Strings) > 0 {
+				call.Args = append(call.Args, arg)
+			}
+			arg = &Arg{}
+			if t.Text == ")" {
+				return i + 1
+			}
+		case isOpen(t):
+			depth++
+		case isClose(t):
+			depth--
+		case depth == 0 && t.kind == tokIdent && arg.Name == nil && len(arg.Strings) == 0 && toks[i+1].kind == tokPunct && toks[i+1].Text == "=":
+			arg.Name = &toks[i].Token
+			i++
+		case t.kind == tokString:
+			arg.Strings = append(arg.Strings, &toks[i].Token)
+		}
+	}
+	return i
+}
+
+// lex splits data into tokens. Newlines inside brackets are omitted.
+func lex(data []byte) ([]token, error) {
+	var toks []token
+	depth := 0
+	for pos := 0; pos < len(data); {
+		c := data[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			pos++
+		case c == '\\' && pos+1 < len(data) && data[pos+1] == '\n':
+			pos += 2
+		case c == '#':
+			for pos < len(data) && data[pos] != '\n' {
+				pos++
+			}
+		case c == '\n':
+			if depth == 0 {
+				toks = append(toks, token{kind: tokNewline, Token: Token{Text: "\n", Start: pos, End: pos + 1}})
+			}
+			pos++
+		case c == '"' || c == '\'' || (c == 'r' || c == 'b') && pos+1 < len(data) && (data[pos+1] == '"' || data[pos+1] == '\''):
+			raw := c == 'r'
+			if c == 'r' || c == 'b' {
+				pos++
+			}
+			t, end, err := lexString(data, pos, raw)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, t)
+			pos = end
+		case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			start := pos
+			for pos < len(data) && (data[pos] == '_' || 'a' <= data[pos] && data[pos] <= 'z' || 'A' <= data[pos] && data[pos] <= 'Z' || '0' <= data[pos] && data[pos] <= '9') {
+				pos++
+			}
+			toks = append(toks, token{kind: tokIdent, Token: Token{Text: string(data[start:pos]), Start: start, End: pos}})
+		default:
+			t := token{kind: tokPunct, Token: Token{Text: string(c), Start: pos, End: pos + 1}}
+			switch {
+			case isOpen(t):
+				depth++
+			case isClose(t):
+				depth--
+			}
+			if c == '=' && pos+1 < len(data) && data[pos+1] == '=' {
+				t.Text, t.End = "==", pos+2
+			}
+			toks = append(toks, t)
+			pos = t.End
+		}
+	}
+	return append(toks, token{kind: tokEOF, Token: Token{Start: len(data), End: len(data)}}), nil
+}
+
+// lexString lexes the string literal whose opening quote is at pos. It
+// returns the token and the offset after the closing quote.
+func lexString(data []byte, pos int, raw bool) (token, int, error) {
+	quote := string(data[pos])
+	if bytes.HasPrefix(data[pos:], []byte(quote+quote+quote)) {
+		quote += quote + quote
+	}
+	start := pos + len(quote)
+	var text []byte
+	for i := start; i < len(data); i++ {
+		if bytes.HasPrefix(data[i:], []byte(quote)) {
+			return token{kind: tokString, Token: Token{Text: string(text), Start: start, End: i}}, i + len(quote), nil
+		}
+		c := data[i]
+		if c == '\n' && len(quote) == 1 {
+			break
+		}
+		if c == '\\' && i+1 < len(data) {
+			if raw {
+				text = append(text, c)
+			}
+			i++
+			c = data[i]
+			if !raw {
+				switch c {
+				case 'n':
+					c = '\n'
+				case 't':
+					c = '\t'
+				}
+			}
+		}
+		text = append(text, c)
+	}
+	line := 1 + strings.Count(string(data[:pos]), "\n")
+	return token{}, 0, fmt.Errorf("line %d: unterminated string", line)
+}
@@ -0,0 +1,298 @@
+package benchmarks
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+// An Env is the environment that benchmarks run in: a fixture, a dir
+// with its source files, and (created when a benchmark first needs it)
+// a store that its graph output is imported into.
+type Env struct {
+	Fixture *Fixture
+
+	dir string // temporary dir holding the fixture's files and stores
+
+	storeOnce sync.Once
+	store     store.RepoStore
+	storeErr  error
+}
+
+// NewEnv creates an environment with a fixture of the given size. The
+// caller must call Close to remove its temporary files.
+func NewEnv(size Size) (*Env, error) {
+	f, err := NewFixture(size)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir("", "srclib-bench")
+	if err != nil {
+		return nil, err
+	}
+	e := &Env{Fixture: f, dir: dir}
+	if err := f.WriteFiles(e.srcDir()); err != nil {
+		e.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Close removes the environment's temporary files.
+func (e *Env) Close() error { return os.RemoveAll(e.dir) }
+
+func (e *Env) srcDir() string { return filepath.Join(e.dir, "src") }
+
+// newStore creates an empty store in a new dir.
+func (e *Env) newStore() (store.RepoStoreImporter, error) {
+	dir, err := ioutil.TempDir(e.dir, "store")
+	if err != nil {
+		return nil, err
+	}
+	osFS := rwvfs.OS(dir)
+	if osFS, ok := osFS.(interface {
+		CreateParentDirs(bool)
+	}); ok {
+		osFS.CreateParentDirs(true)
+	}
+	return store.NewFSRepoStore(rwvfs.Walkable(osFS)), nil
+}
+
+// importFixture imports the fixture's (normalized) graph output into s
+// and builds its indexes.
+func (e *Env) importFixture(s store.RepoStoreImporter, o *graph.Output) error {
+	if err := s.Import(FixtureCommitID, e.Fixture.Unit, *o); err != nil {
+		return err
+	}
+	if s, ok := s.(store.RepoIndexer); ok {
+		return s.Index(FixtureCommitID)
+	}
+	return nil
+}
+
+// normalizedOutput returns a new copy of the fixture's graph output,
+// normalized as `src make` does before it is imported.
+func (e *Env) normalizedOutput() (*graph.Output, error) {
+	o := e.Fixture.Output()
+	if err := grapher.NormalizeData(FixtureRepo, FixtureUnitType, e.srcDir(), o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Store returns a store that the fixture has been imported into.
+func (e *Env) Store() (store.RepoStore, error) {
+	e.storeOnce.Do(func() {
+		var s store.RepoStoreImporter
+		s, e.storeErr = e.newStore()
+		if e.storeErr != nil {
+			return
+		}
+		var o *graph.Output
+		if o, e.storeErr = e.normalizedOutput(); e.storeErr != nil {
+			return
+		}
+		if e.storeErr = e.importFixture(s, o); e.storeErr != nil {
+			return
+		}
+		e.store = s
+	})
+	return e.store, e.storeErr
+}
+
+// A Benchmark benchmarks an operation on an Env's fixture. Run
+// performs the operation b.N times. It returns an error (instead of
+// calling b.Fatal) so that the error can be reported by Run, since
+// testing.Benchmark discards the messages of failed benchmarks.
+type Benchmark struct {
+	Name string
+	Run  func(b *testing.B, e *Env) error
+}
+
+// Benchmarks are all of the benchmarks, in the order they are run.
+var Benchmarks = []Benchmark{
+	{"DecodeOutput", benchDecodeOutput},
+	{"NormalizeData", benchNormalizeData},
+	{"Import", benchImport},
+	{"Def_ByDefKey", benchQuery(func(s store.RepoStore, f *Fixture, i int) (int, error) {
+		defs, err := s.Defs(store.ByDefKey(graph.DefKey{CommitID: FixtureCommitID, UnitType: FixtureUnitType, Unit: FixtureUnit, Path: fixtureDefPath(i%f.Size.Files, i%f.Size.DefsPerFile)}))
+		return len(defs), err
+	})},
+	{"Defs_ByFiles", benchQuery(func(s store.RepoStore, f *Fixture, i int) (int, error) {
+		defs, err := s.Defs(store.ByCommitIDs(FixtureCommitID), store.ByFiles(fixtureFile(i%f.Size.Files)))
+		return len(defs), err
+	})},
+	{"Defs_ByDefQuery", benchQuery(func(s store.RepoStore, f *Fixture, i int) (int, error) {
+		defs, err := s.Defs(store.ByCommitIDs(FixtureCommitID), store.ByDefQuery(fixtureDefName(i%f.Size.Files, 0)))
+		return len(defs), err
+	})},
+	{"Refs_ByFiles", benchQuery(func(s store.RepoStore, f *Fixture, i int) (int, error) {
+		refs, err := s.Refs(store.ByCommitIDs(FixtureCommitID), store.ByFiles(fixtureFile(i%f.Size.Files)))
+		return len(refs), err
+	})},
+	{"Refs_ByRefDef", benchQuery(func(s store.RepoStore, f *Fixture, i int) (int, error) {
+		refs, err := s.Refs(store.ByCommitIDs(FixtureCommitID), store.ByRefDef(graph.RefDefKey{DefUnitType: FixtureUnitType, DefUnit: FixtureUnit, DefPath: fixtureDefPath(i%f.Size.Files, i%f.Size.DefsPerFile)}))
+		return len(refs), err
+	})},
+}
+
+func benchDecodeOutput(b *testing.B, e *Env) error {
+	data := e.Fixture.OutputJSON()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := graph.DecodeOutput(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func benchNormalizeData(b *testing.B, e *Env) error {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		o := e.Fixture.Output()
+		b.StartTimer()
+		if err := grapher.NormalizeData(FixtureRepo, FixtureUnitType, e.srcDir(), o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func benchImport(b *testing.B, e *Env) error {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		o, err := e.normalizedOutput()
+		if err != nil {
+			return err
+		}
+		s, err := e.newStore()
+		if err != nil {
+			return err
+		}
+		b.StartTimer()
+		if err := e.importFixture(s, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchQuery returns a benchmark of a store query. The query is given
+// the iteration number, so that it can vary what it queries for. It
+// returns the number of results, which must be nonzero.
+func benchQuery(query func(s store.RepoStore, f *Fixture, i int) (int, error)) func(*testing.B, *Env) error {
+	return func(b *testing.B, e *Env) error {
+		b.StopTimer()
+		s, err := e.Store()
+		if err != nil {
+			return err
+		}
+		b.StartTimer()
+		for i := 0; i < b.N; i++ {
+			n, err := query(s, e.Fixture, i)
+			if err != nil {
+				return err
+			}
+			if n == 0 {
+				return fmt.Errorf("query %d returned no results", i)
+			}
+		}
+		return nil
+	}
+}
+
+// A Result is the result of a benchmark.
+type Result struct {
+	Name        string
+	N           int     // number of iterations
+	NsPerOp     int64   // time per iteration, in nanoseconds
+	BytesPerOp  int64   // bytes allocated per iteration
+	AllocsPerOp int64   // allocations per iteration
+	MBPerSec    float64 `json:",omitempty"` // throughput (for benchmarks that process a known amount of data)
+}
+
+// A Report is the results of running benchmarks, with a description
+// of the environment they ran in.
+type Report struct {
+	SrcVersion string `json:",omitempty"`
+	GoVersion  string
+	OS         string
+	Arch       string
+	NumCPU     int
+	Size       string // name of the fixture size
+	Time       time.Time
+	Results    []*Result
+}
+
+// RunOptions configure Run.
+type RunOptions struct {
+	Size Size
+
+	// Filter, if set, selects the benchmarks (by name) to run.
+	Filter *regexp.Regexp
+
+	// Progress, if set, is called with each benchmark's result as soon
+	// as it finishes.
+	Progress func(*Result)
+}
+
+// Run runs the benchmarks and returns a report of their results.
+func Run(opt RunOptions) (*Report, error) {
+	e, err := NewEnv(opt.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer e.Close()
+
+	rep := &Report{
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		NumCPU:    runtime.NumCPU(),
+		Size:      opt.Size.Name,
+		Time:      time.Now().UTC(),
+	}
+	for _, bm := range Benchmarks {
+		if opt.Filter != nil && !opt.Filter.MatchString(bm.Name) {
+			continue
+		}
+		var err error
+		r := testing.Benchmark(func(b *testing.B) {
+			// The function is called repeatedly (with increasing
+			// b.N); stop after the first error.
+			if err == nil {
+				err = bm.Run(b, e)
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("benchmark %s failed: %s", bm.Name, err)
+		}
+		res := &Result{
+			Name:        bm.Name,
+			N:           r.N,
+			NsPerOp:     r.NsPerOp(),
+			BytesPerOp:  r.AllocedBytesPerOp(),
+			AllocsPerOp: r.AllocsPerOp(),
+		}
+		if r.Bytes > 0 && r.T > 0 {
+			res.MBPerSec = (float64(r.Bytes) * float64(r.N) / 1e6) / r.T.Seconds()
+		}
+		rep.Results = append(rep.Results, res)
+		if opt.Progress != nil {
+			opt.Progress(res)
+		}
+	}
+	return rep, nil
+}
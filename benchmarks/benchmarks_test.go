@@ -0,0 +1,93 @@
+package benchmarks
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+)
+
+var benchSize = flag.String("bench.size", "small", "size of the benchmark fixture (small, medium, or large)")
+
+func BenchmarkAll(b *testing.B) {
+	size, ok := LookupSize(*benchSize)
+	if !ok {
+		b.Fatalf("unknown fixture size %q", *benchSize)
+	}
+	e, err := NewEnv(size)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer e.Close()
+	for _, bm := range Benchmarks {
+		bm := bm
+		b.Run(bm.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			if err := bm.Run(b, e); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestNewFixture(t *testing.T) {
+	size, _ := LookupSize("small")
+	f, err := NewFixture(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := NewFixture(size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.OutputJSON(), f2.OutputJSON()) {
+		t.Error("fixtures of the same size differ")
+	}
+
+	o := f.Output()
+	if want := size.Files * size.DefsPerFile; len(o.Defs) != want {
+		t.Errorf("got %d defs, want %d", len(o.Defs), want)
+	}
+	if want := size.Files * size.DefsPerFile * (size.RefsPerDef + 1); len(o.Refs) != want {
+		t.Errorf("got %d refs, want %d", len(o.Refs), want)
+	}
+	for _, def := range o.Defs {
+		if src := f.Files[def.File][def.DefStart:def.DefEnd]; !strings.HasPrefix(src, "func "+def.Name+"(") {
+			t.Errorf("def %s doesn't span its source: %q", def.Path, src)
+		}
+	}
+	for _, ref := range o.Refs {
+		name := ref.DefPath[strings.LastIndex(ref.DefPath, "/")+1:]
+		if src := f.Files[ref.File][ref.Start:ref.End]; !strings.HasSuffix(src, name) {
+			t.Errorf("ref to %s doesn't span its source: %q", ref.DefPath, src)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	old := &Report{Size: "small", Results: []*Result{
+		{Name: "A", NsPerOp: 100, BytesPerOp: 1000, AllocsPerOp: 10},
+		{Name: "B", NsPerOp: 100, BytesPerOp: 1000, AllocsPerOp: 10},
+		{Name: "OnlyOld", NsPerOp: 100},
+	}}
+	cur := &Report{Size: "small", Results: []*Result{
+		{Name: "A", NsPerOp: 105, BytesPerOp: 900, AllocsPerOp: 20},
+		{Name: "B", NsPerOp: 200, BytesPerOp: 1000, AllocsPerOp: 10},
+		{Name: "OnlyNew", NsPerOp: 100},
+	}}
+	regs, err := Compare(old, cur, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range regs {
+		got = append(got, r.Name+" "+r.Metric)
+	}
+	if want := []string{"A allocs/op", "B ns/op"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got regressions %v, want %v", got, want)
+	}
+
+	if _, err := Compare(old, &Report{Size: "large"}, 0.1); err == nil {
+		t.Error("got no error comparing reports of different sizes")
+	}
+}
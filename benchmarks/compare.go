@@ -0,0 +1,63 @@
+package benchmarks
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A Regression is a benchmark measurement that is worse in a new
+// report than in an old one.
+type Regression struct {
+	Name   string  // benchmark name
+	Metric string  // "ns/op", "B/op", or "allocs/op"
+	Old    float64 // value in the old report
+	New    float64 // value in the new report
+}
+
+// Change is the relative change from Old to New (e.g., 0.25 for 25%
+// worse).
+func (r *Regression) Change() float64 { return r.New/r.Old - 1 }
+
+func (r *Regression) String() string {
+	return fmt.Sprintf("%s: %s regressed %.1f%% (%.0f -> %.0f)", r.Name, r.Metric, 100*r.Change(), r.Old, r.New)
+}
+
+// Compare compares the results of the benchmarks in both reports and
+// returns the measurements that are worse in cur than in old by more
+// than threshold (e.g., 0.1 for 10%). Benchmarks that are only in one
+// of the reports are ignored. The reports must be for the same fixture
+// size.
+//
+// Timings vary between machines, so reports should only be compared
+// if they were run on the same (or identical) machines.
+func Compare(old, cur *Report, threshold float64) ([]*Regression, error) {
+	if old.Size != cur.Size {
+		return nil, fmt.Errorf("can't compare benchmark reports for different fixture sizes (%q and %q)", old.Size, cur.Size)
+	}
+	oldResults := make(map[string]*Result, len(old.Results))
+	for _, r := range old.Results {
+		oldResults[r.Name] = r
+	}
+
+	var regs []*Regression
+	for _, r := range cur.Results {
+		o, present := oldResults[r.Name]
+		if !present {
+			continue
+		}
+		for _, m := range []struct {
+			metric   string
+			old, cur int64
+		}{
+			{"ns/op", o.NsPerOp, r.NsPerOp},
+			{"B/op", o.BytesPerOp, r.BytesPerOp},
+			{"allocs/op", o.AllocsPerOp, r.AllocsPerOp},
+		} {
+			if m.old > 0 && float64(m.cur) > float64(m.old)*(1+threshold) {
+				regs = append(regs, &Regression{Name: r.Name, Metric: m.metric, Old: float64(m.old), New: float64(m.cur)})
+			}
+		}
+	}
+	sort.SliceStable(regs, func(i, j int) bool { return regs[i].Change() > regs[j].Change() })
+	return regs, nil
+}
@@ -0,0 +1,10 @@
+// Package benchmarks measures the performance of srclib's most
+// expensive operations (normalizing and decoding graph output,
+// importing it into a store, and querying the store) on synthetic
+// fixtures of realistic shape and size.
+//
+// The benchmarks can be run with `go test -bench .` in this package
+// or, to produce a JSON report that can be compared with the report of
+// an earlier release (so that CI can flag performance regressions),
+// with `src bench`.
+package benchmarks
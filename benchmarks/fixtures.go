@@ -0,0 +1,175 @@
+package benchmarks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// A Size describes the size of a fixture.
+type Size struct {
+	Name        string
+	Files       int // number of source files
+	DefsPerFile int // number of defs in each file
+	RefsPerDef  int // number of refs in each def's body (besides the def's own ref)
+}
+
+// Sizes are the sizes of fixtures that benchmarks can be run on. A
+// medium fixture is about the size of a large Go package; a large
+// fixture is about the size of the largest source units seen in
+// practice.
+var Sizes = []Size{
+	{Name: "small", Files: 20, DefsPerFile: 20, RefsPerDef: 5},
+	{Name: "medium", Files: 200, DefsPerFile: 25, RefsPerDef: 8},
+	{Name: "large", Files: 1000, DefsPerFile: 40, RefsPerDef: 10},
+}
+
+// LookupSize returns the size in Sizes named name.
+func LookupSize(name string) (Size, bool) {
+	for _, s := range Sizes {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Size{}, false
+}
+
+const (
+	// FixtureRepo, FixtureCommitID, FixtureUnitType, and FixtureUnit
+	// identify a fixture's source unit. Like most graphers' unit
+	// types, FixtureUnitType isn't registered as emitting byte
+	// offsets, so NormalizeData reads the fixture's files to convert
+	// its offsets (which are unchanged, since the files are ASCII).
+	FixtureRepo     = "example.com/bench/repo"
+	FixtureCommitID = "0123456789abcdef0123456789abcdef01234567"
+	FixtureUnitType = "BenchPackage"
+	FixtureUnit     = "example.com/bench/repo/pkg"
+
+	// fixtureDepRepo is the repo of the external defs that a
+	// fixture's refs point to.
+	fixtureDepRepo = "example.com/bench/dep"
+)
+
+// A Fixture is synthetic source code and the graph output for it. The
+// same size always yields the same fixture, so benchmark results are
+// comparable across runs.
+type Fixture struct {
+	Size  Size
+	Unit  *unit.SourceUnit
+	Files map[string]string // source file name -> contents
+
+	output []byte // JSON-encoded graph output
+}
+
+// NewFixture creates a fixture of the given size.
+func NewFixture(size Size) (*Fixture, error) {
+	r := rand.New(rand.NewSource(1))
+	f := &Fixture{
+		Size:  size,
+		Unit:  &unit.SourceUnit{Name: FixtureUnit, Type: FixtureUnitType, Repo: FixtureRepo, CommitID: FixtureCommitID},
+		Files: make(map[string]string, size.Files),
+	}
+	var o graph.Output
+	for i := 0; i < size.Files; i++ {
+		file := fixtureFile(i)
+		f.Unit.Files = append(f.Unit.Files, file)
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "package pkg%d\n\n", i/20)
+		for j := 0; j < size.DefsPerFile; j++ {
+			key := graph.DefKey{UnitType: FixtureUnitType, Unit: FixtureUnit, Path: fixtureDefPath(i, j)}
+			name := fixtureDefName(i, j)
+
+			docStart := b.Len()
+			fmt.Fprintf(&b, "// %s computes a value from x.\n", name)
+			o.Docs = append(o.Docs, &graph.Doc{DefKey: key, Format: "text/plain", Data: name + " computes a value from x.", File: file, Start: uint32(docStart), End: uint32(b.Len() - 1)})
+
+			defStart := b.Len()
+			b.WriteString("func ")
+			nameStart := b.Len()
+			b.WriteString(name)
+			o.Refs = append(o.Refs, &graph.Ref{DefUnitType: FixtureUnitType, DefUnit: FixtureUnit, DefPath: key.Path, Def: true, File: file, Start: uint32(nameStart), End: uint32(b.Len())})
+			b.WriteString("(x int) int {\n\treturn x")
+
+			for k := 0; k < size.RefsPerDef; k++ {
+				ref := &graph.Ref{File: file}
+				var target string
+				if r.Intn(10) == 0 {
+					n := r.Intn(100)
+					ref.DefRepo, ref.DefUnitType, ref.DefUnit, ref.DefPath = fixtureDepRepo, FixtureUnitType, fixtureDepRepo, fmt.Sprintf("Func%d", n)
+					target = fmt.Sprintf("dep.Func%d", n)
+				} else {
+					ti, tj := r.Intn(size.Files), r.Intn(size.DefsPerFile)
+					ref.DefUnitType, ref.DefUnit, ref.DefPath = FixtureUnitType, FixtureUnit, fixtureDefPath(ti, tj)
+					target = fixtureDefName(ti, tj)
+				}
+				b.WriteString(" + ")
+				ref.Start = uint32(b.Len())
+				b.WriteString(target)
+				ref.End = uint32(b.Len())
+				b.WriteString("(x)")
+				o.Refs = append(o.Refs, ref)
+			}
+			b.WriteString("\n}\n\n")
+
+			o.Defs = append(o.Defs, &graph.Def{
+				DefKey:   key,
+				Name:     name,
+				Kind:     "func",
+				File:     file,
+				DefStart: uint32(defStart),
+				DefEnd:   uint32(b.Len() - 2),
+				Exported: true,
+				Data:     json.RawMessage(`{"Kind":"func","Signature":"func(x int) int"}`),
+			})
+		}
+		f.Files[file] = b.String()
+	}
+
+	var err error
+	f.output, err = json.Marshal(&o)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func fixtureFile(i int) string       { return fmt.Sprintf("pkg%d/file%d.go", i/20, i) }
+func fixtureDefName(i, j int) string { return fmt.Sprintf("F%d_%d", i, j) }
+func fixtureDefPath(i, j int) string { return fmt.Sprintf("pkg%d/%s", i/20, fixtureDefName(i, j)) }
+
+// OutputJSON returns the JSON encoding of the fixture's graph output,
+// as a grapher would emit it.
+func (f *Fixture) OutputJSON() []byte { return f.output }
+
+// Output returns a new copy of the fixture's graph output. (Each
+// caller gets its own copy because normalizing and importing graph
+// output modify it.)
+func (f *Fixture) Output() *graph.Output {
+	var o graph.Output
+	if err := json.Unmarshal(f.output, &o); err != nil {
+		panic(err) // f.output was created by json.Marshal
+	}
+	return &o
+}
+
+// WriteFiles writes the fixture's source files to dir.
+func (f *Fixture) WriteFiles(dir string) error {
+	for name, data := range f.Files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Package build imports srclib build data (the output of "src make")
+// into a store from Go programs, without running the src binary.
+//
+// Build data is produced by running a repository's toolchains, which
+// happens in "src config" and "src make" (and whose build recipes run
+// the src binary themselves), so those steps still require the src
+// binary and the toolchains to be installed. This package reads their
+// output from the repository's build data dir (.srclib-cache) and
+// imports it into a query.Index, as "src store import" does.
+package build
+
+import (
+	"context"
+	"errors"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/importer"
+	"sourcegraph.com/sourcegraph/srclib/query"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// ImportOptions configures an import. The fields correspond to the
+// flags of "src store import".
+type ImportOptions struct {
+	// Repo is the repository's URI (e.g., "github.com/org/a"). It is
+	// required for a MultiRepoStore.
+	Repo string
+
+	// CommitID is the commit whose build data is imported. It is
+	// required.
+	CommitID string
+
+	// Unit and UnitType, if set, select the source units to import.
+	Unit     string
+	UnitType string
+
+	// NoIndex skips building the store's indexes (indexes inside a
+	// single source unit are always built).
+	NoIndex bool
+
+	// FoldCase lowercases all file paths in the imported data (for
+	// build data produced on case-insensitive filesystems).
+	FoldCase bool
+
+	// IndexContent also builds a trigram index of the contents of the
+	// source units' files, which are read from the repository dir.
+	IndexContent bool
+
+	// Jobs is the number of source units to import in parallel
+	// (default: 10).
+	Jobs int
+
+	// MaxMemory, if set, makes fewer source units be imported at once
+	// when their estimated memory use would exceed it (e.g., "512MB"
+	// or "2GiB").
+	MaxMemory string
+
+	// DefRepos maps the DefRepos of refs to the repositories that the
+	// refs are imported as referring to (see config.Workspace).
+	DefRepos map[string]string
+
+	// Verbose logs the import's progress.
+	Verbose bool
+}
+
+// Import imports the build data of the repository in dir at
+// opt.CommitID (which "src make" wrote to the repository's build data
+// dir) into x. If ctx is done, source units that have not yet been
+// imported are skipped and ctx.Err() is returned.
+//
+// Imports into the same Index must not run concurrently.
+func Import(ctx context.Context, x *query.Index, dir string, opt ImportOptions) error {
+	if opt.CommitID == "" {
+		return errors.New("CommitID is required")
+	}
+	bs, err := buildstore.LocalRepo(dir)
+	if err != nil {
+		return err
+	}
+	return importer.Import(ctx, bs.Commit(opt.CommitID), x.Store(), importer.Options{
+		Repo:         opt.Repo,
+		CommitID:     opt.CommitID,
+		Unit:         opt.Unit,
+		UnitType:     opt.UnitType,
+		NoIndex:      opt.NoIndex,
+		FoldCase:     opt.FoldCase,
+		IndexContent: opt.IndexContent,
+		ContentDir:   dir,
+		Jobs:         opt.Jobs,
+		MaxMemory:    opt.MaxMemory,
+		DefRepos:     opt.DefRepos,
+		Verbose:      opt.Verbose,
+	})
+}
+
+// Units returns the source units of the build data of the repository
+// in dir at commitID (as configured by "src config").
+func Units(dir, commitID string) ([]*unit.SourceUnit, error) {
+	bs, err := buildstore.LocalRepo(dir)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := config.ReadCached(bs.Commit(commitID))
+	if err != nil {
+		return nil, err
+	}
+	return tree.SourceUnits, nil
+}
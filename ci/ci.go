@@ -0,0 +1,375 @@
+// Package ci graphs CI configuration files: GitHub Actions workflows
+// and actions, and GitLab CI configs.
+package ci
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/docker"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/yaml"
+)
+
+// Source unit types. Each CI configuration file is its own source
+// unit, named by its path.
+const (
+	GitHubWorkflowUnitType = "GitHubWorkflow"
+	GitHubActionUnitType   = "GitHubAction"
+	GitLabCIUnitType       = "GitLabCI"
+)
+
+// UnitType returns the source unit type of the CI configuration file,
+// or "" if file isn't one. Files are recognized by their paths:
+// GitHub Actions workflows are in .github/workflows, actions are
+// defined in action.yml files, and GitLab CI configs are named
+// .gitlab-ci.yml.
+func UnitType(file string) string {
+	base, ext := path.Base(file), path.Ext(file)
+	if ext != ".yml" && ext != ".yaml" {
+		return ""
+	}
+	switch {
+	case path.Dir(file) == ".github/workflows" || strings.HasSuffix(path.Dir(file), "/.github/workflows"):
+		return GitHubWorkflowUnitType
+	case base == "action.yml" || base == "action.yaml":
+		return GitHubActionUnitType
+	case base == ".gitlab-ci.yml" || base == ".gitlab-ci.yaml":
+		return GitLabCIUnitType
+	}
+	return ""
+}
+
+// Graph returns the defs and refs in the CI configuration file (see
+// UnitType) with the given path and contents.
+//
+// Jobs and steps (and stages; and the inputs and outputs of actions)
+// are defs. Refs are emitted for dependencies between jobs, for the
+// actions, reusable workflows, included configs, and images that the
+// file uses, and for the scripts in the repository that its commands
+// run. If stat is non-nil, it is called to determine whether scripts
+// exist (relative to the current directory, which must be the
+// repository root); refs to scripts are only emitted for scripts that
+// exist, along with defs (of kind "file") for them.
+func Graph(file string, data []byte, stat func(string) (os.FileInfo, error)) (*graph.Output, error) {
+	root, err := yaml.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	g := &grapher{file: file, data: data, stat: stat, o: &graph.Output{}, defs: map[string]bool{}}
+	switch UnitType(file) {
+	case GitHubWorkflowUnitType:
+		g.graphWorkflow(root)
+	case GitHubActionUnitType:
+		g.graphAction(root)
+	case GitLabCIUnitType:
+		g.graphGitLab(root)
+	default:
+		return nil, fmt.Errorf("%s is not a CI configuration file", file)
+	}
+
+	// Nodes that are merged or aliased (e.g., "<<: *defaults") are
+	// visited once per use, so the same ref may have been emitted more
+	// than once.
+	seen := map[graph.Ref]bool{}
+	refs := g.o.Refs[:0]
+	for _, ref := range g.o.Refs {
+		if !seen[*ref] {
+			seen[*ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	g.o.Refs = refs
+	return g.o, nil
+}
+
+// Dependencies returns the remote actions and reusable workflows (in
+// "owner/repo/path@ref" form) that the GitHub Actions workflow or
+// action uses.
+func Dependencies(file string, data []byte) ([]string, error) {
+	o, err := Graph(file, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]struct{}{}
+	var deps []string
+	for _, ref := range o.Refs {
+		if ref.DefRepo == "" || (ref.DefUnitType != GitHubActionUnitType && ref.DefUnitType != GitHubWorkflowUnitType) {
+			continue
+		}
+		uses := string(data[ref.Start:ref.End])
+		if _, present := seen[uses]; !present {
+			seen[uses] = struct{}{}
+			deps = append(deps, uses)
+		}
+	}
+	sort.Strings(deps)
+	return deps, nil
+}
+
+// A Uses is a parsed reference to a GitHub action or reusable
+// workflow (the value of a "uses" key).
+type Uses struct {
+	// Repo is the repository ("owner/name") that contains the action
+	// or workflow, or "" if it is in the same repository.
+	Repo string
+
+	// Path is the path of the action's directory or the workflow file
+	// in the repository.
+	Path string
+
+	// Ref is the Git ref of the repository to use (e.g., "v3").
+	Ref string
+}
+
+// ParseUses parses the value of a "uses" key (such as
+// "actions/checkout@v4" or "./.github/actions/setup"). Uses of Docker
+// images ("docker://...") can't be parsed.
+func ParseUses(uses string) (*Uses, error) {
+	if strings.HasPrefix(uses, "./") {
+		return &Uses{Path: path.Clean(uses)}, nil
+	}
+	i := strings.LastIndex(uses, "@")
+	if i == -1 || strings.Contains(uses, "://") {
+		return nil, fmt.Errorf("invalid uses %q (want owner/repo[/path]@ref or ./path)", uses)
+	}
+	parts := strings.SplitN(uses[:i], "/", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid uses %q (want owner/repo[/path]@ref or ./path)", uses)
+	}
+	u := &Uses{Repo: parts[0] + "/" + parts[1], Ref: uses[i+1:]}
+	if len(parts) == 3 {
+		u.Path = path.Clean(parts[2])
+	}
+	return u, nil
+}
+
+// RepoURI returns the URI of the repository that u refers to, or "" if
+// it is in the same repository.
+func (u *Uses) RepoURI() string {
+	if u.Repo == "" {
+		return ""
+	}
+	return "github.com/" + u.Repo
+}
+
+// Unit returns the source unit type and name of the action or reusable
+// workflow that u refers to.
+func (u *Uses) Unit() (unitType, name string) {
+	if ext := path.Ext(u.Path); ext == ".yml" || ext == ".yaml" {
+		return GitHubWorkflowUnitType, u.Path
+	}
+	return GitHubActionUnitType, path.Join(u.Path, "action.yml")
+}
+
+type grapher struct {
+	file string
+	data []byte
+	stat func(string) (os.FileInfo, error)
+	o    *graph.Output
+	defs map[string]bool // paths of emitted defs
+}
+
+// def emits a def (and its definition ref) for the YAML node n, unless
+// a def with the same path was already emitted.
+func (g *grapher) def(defPath, name, kind string, n *yaml.Node) {
+	if g.defs[defPath] {
+		return
+	}
+	g.defs[defPath] = true
+	g.o.Defs = append(g.o.Defs, &graph.Def{
+		DefKey:   graph.DefKey{Path: defPath},
+		Name:     name,
+		Kind:     kind,
+		File:     g.file,
+		DefStart: uint32(n.Start),
+		DefEnd:   uint32(n.End),
+		Exported: true,
+	})
+	g.o.Refs = append(g.o.Refs, &graph.Ref{DefPath: defPath, Def: true, File: g.file, Start: uint32(n.Start), End: uint32(n.End)})
+}
+
+// fileDef emits the def of the CI configuration file itself.
+func (g *grapher) fileDef(name, kind string) {
+	g.defs["."] = true
+	g.o.Defs = append(g.o.Defs, &graph.Def{
+		DefKey:   graph.DefKey{Path: "."},
+		Name:     name,
+		Kind:     kind,
+		File:     g.file,
+		Exported: true,
+	})
+}
+
+// ref emits a ref to the def in the same source unit with the given
+// path, if it exists.
+func (g *grapher) ref(defPath string, start, end int) {
+	if g.defs[defPath] {
+		g.o.Refs = append(g.o.Refs, &graph.Ref{DefPath: defPath, File: g.file, Start: uint32(start), End: uint32(end)})
+	}
+}
+
+// unitRef emits a ref to the source unit with the given type and name
+// (in the given repository, or in the same repository if repo is
+// empty).
+func (g *grapher) unitRef(repo, unitType, unit string, n *yaml.Node) {
+	g.o.Refs = append(g.o.Refs, &graph.Ref{
+		DefRepo:     repo,
+		DefUnitType: unitType,
+		DefUnit:     unit,
+		DefPath:     ".",
+		File:        g.file,
+		Start:       uint32(n.Start),
+		End:         uint32(n.End),
+	})
+}
+
+// usesRef emits a ref to the action, reusable workflow, or Docker
+// image that the value of a "uses" key refers to.
+func (g *grapher) usesRef(n *yaml.Node) {
+	if n == nil || n.Kind != yaml.Scalar {
+		return
+	}
+	if strings.HasPrefix(n.Value, "docker://") {
+		g.imageRef(strings.TrimPrefix(n.Value, "docker://"), n.Start+len("docker://"), n.End)
+		return
+	}
+	u, err := ParseUses(n.Value)
+	if err != nil {
+		return
+	}
+	unitType, unit := u.Unit()
+	if u.Repo == "" && unitType == GitHubActionUnitType && g.stat != nil {
+		if _, err := g.stat(unit); err != nil {
+			if _, err := g.stat(path.Join(u.Path, "action.yaml")); err == nil {
+				unit = path.Join(u.Path, "action.yaml")
+			}
+		}
+	}
+	g.unitRef(u.RepoURI(), unitType, unit, n)
+}
+
+// imageRef emits a ref to the Docker image (if it can be parsed) at
+// the given span.
+func (g *grapher) imageRef(ref string, start, end int) {
+	img, err := docker.ParseImage(ref)
+	if err != nil {
+		return
+	}
+	g.o.Refs = append(g.o.Refs, &graph.Ref{
+		DefRepo:     img.RepoURI(),
+		DefUnitType: docker.ImageUnitType,
+		DefUnit:     img.Repository,
+		DefPath:     ".",
+		File:        g.file,
+		Start:       uint32(start),
+		End:         uint32(end),
+	})
+}
+
+// imageNodeRef emits a ref to the Docker image that an "image" (or
+// "container") value refers to: either the image name, or a mapping
+// with a "name" (GitLab CI) or "image" (GitHub Actions) key.
+func (g *grapher) imageNodeRef(n *yaml.Node) {
+	if n != nil && n.Kind == yaml.Mapping {
+		if name := n.Get("name"); name != nil {
+			n = name
+		} else {
+			n = n.Get("image")
+		}
+	}
+	if n != nil && n.Kind == yaml.Scalar {
+		g.imageRef(n.Value, n.Start, n.End)
+	}
+}
+
+// scriptPattern matches the paths of scripts in commands, such as
+// "./build.sh", "scripts/test.py", or "./bin/deploy".
+var scriptPattern = regexp.MustCompile(`(?:^|[\s;&|'"(=])((?:\./|\.\./)?(?:[\w.-]+/)*[\w-][\w.-]*\.(?:sh|bash|py|rb|pl|ps1|js|mjs|ts)|\./(?:[\w.-]+/)*[\w.-]+)\b`)
+
+// scriptRefs emits refs to the scripts in the repository that the
+// commands in n (a scalar or a sequence of scalars) run in the given
+// working directory.
+func (g *grapher) scriptRefs(n *yaml.Node, workdir string) {
+	if g.stat == nil || n == nil {
+		return
+	}
+	var cmds []*yaml.Node
+	switch n.Kind {
+	case yaml.Scalar:
+		cmds = []*yaml.Node{n}
+	case yaml.Sequence:
+		cmds = n.Items()
+	}
+	for _, cmd := range cmds {
+		text := string(g.data[cmd.Start:cmd.End])
+		for _, m := range scriptPattern.FindAllStringSubmatchIndex(text, -1) {
+			p := path.Join(workdir, text[m[2]:m[3]])
+			if p == ".." || strings.HasPrefix(p, "../") || strings.HasPrefix(p, "/") {
+				continue
+			}
+			g.fileRef(p, cmd.Start+m[2], cmd.Start+m[3])
+		}
+	}
+}
+
+// fileRef emits a ref to the file in the repository with the given
+// path (and a def, of kind "file", for it), if the file exists.
+func (g *grapher) fileRef(p string, start, end int) {
+	if g.stat == nil {
+		return
+	}
+	if fi, err := g.stat(p); err != nil || fi.IsDir() {
+		return
+	}
+	defPath := "file/" + p
+	if !g.defs[defPath] {
+		g.defs[defPath] = true
+		g.o.Defs = append(g.o.Defs, &graph.Def{
+			DefKey:   graph.DefKey{Path: defPath},
+			Name:     p,
+			Kind:     "file",
+			File:     p,
+			Exported: true,
+		})
+	}
+	g.ref(defPath, start, end)
+}
+
+// exprPattern matches the contexts in GitHub Actions expressions that
+// refer to jobs, steps, and inputs (such as "needs.build.outputs.x").
+var exprPattern = regexp.MustCompile(`\b(needs|jobs|steps|inputs)\.([\w-]+)`)
+
+// exprRefs emits refs for the references to jobs (in "needs" and
+// "jobs" contexts), steps (in "steps" contexts; the defs of the steps
+// in scope have the def path prefix steps), and inputs in the
+// expressions in the values under n.
+func (g *grapher) exprRefs(n *yaml.Node, steps string) {
+	if n == nil {
+		return
+	}
+	if n.Kind == yaml.Scalar {
+		text := string(g.data[n.Start:n.End])
+		for _, m := range exprPattern.FindAllStringSubmatchIndex(text, -1) {
+			name := text[m[4]:m[5]]
+			var defPath string
+			switch text[m[2]:m[3]] {
+			case "needs", "jobs":
+				defPath = "job/" + name
+			case "steps":
+				defPath = steps + "step/" + name
+			case "inputs":
+				defPath = "input/" + name
+			}
+			g.ref(defPath, n.Start+m[4], n.Start+m[5])
+		}
+		return
+	}
+	for _, v := range n.Values {
+		g.exprRefs(v, steps)
+	}
+}
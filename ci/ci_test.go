@@ -0,0 +1,273 @@
+package ci
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+type fileInfo struct{ os.FileInfo }
+
+func (fileInfo) IsDir() bool        { return false }
+func (fileInfo) ModTime() time.Time { return time.Time{} }
+
+func statFiles(files ...string) func(string) (os.FileInfo, error) {
+	return func(p string) (os.FileInfo, error) {
+		for _, f := range files {
+			if p == f {
+				return fileInfo{}, nil
+			}
+		}
+		return nil, os.ErrNotExist
+	}
+}
+
+func defPaths(o *graph.Output) []string {
+	var defs []string
+	for _, d := range o.Defs {
+		defs = append(defs, d.Kind+" "+d.Path)
+	}
+	sort.Strings(defs)
+	return defs
+}
+
+func refTexts(data []byte, o *graph.Output) map[string][]string {
+	refs := map[string][]string{}
+	for _, r := range o.Refs {
+		if r.Def {
+			continue
+		}
+		key := r.DefPath
+		if r.DefUnitType != "" {
+			key = r.DefRepo + " " + r.DefUnitType + " " + r.DefUnit + " " + r.DefPath
+		}
+		refs[key] = append(refs[key], string(data[r.Start:r.End]))
+	}
+	return refs
+}
+
+func TestUnitType(t *testing.T) {
+	tests := map[string]string{
+		".github/workflows/ci.yml":         GitHubWorkflowUnitType,
+		"sub/.github/workflows/ci.yaml":    GitHubWorkflowUnitType,
+		".github/actions/setup/action.yml": GitHubActionUnitType,
+		"action.yaml":                      GitHubActionUnitType,
+		".gitlab-ci.yml":                   GitLabCIUnitType,
+		".github/workflows/README.md":      "",
+		".github/dependabot.yml":           "",
+		"ci.yml":                           "",
+	}
+	for file, want := range tests {
+		if got := UnitType(file); got != want {
+			t.Errorf("%s: got %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestParseUses(t *testing.T) {
+	tests := map[string]Uses{
+		"actions/checkout@v4":                       {Repo: "actions/checkout", Ref: "v4"},
+		"github/codeql-action/init@v3":              {Repo: "github/codeql-action", Path: "init", Ref: "v3"},
+		"org/repo/.github/workflows/build.yml@main": {Repo: "org/repo", Path: ".github/workflows/build.yml", Ref: "main"},
+		"./.github/actions/setup":                   {Path: ".github/actions/setup"},
+		"./.github/workflows/reusable.yml":          {Path: ".github/workflows/reusable.yml"},
+	}
+	for uses, want := range tests {
+		u, err := ParseUses(uses)
+		if err != nil {
+			t.Errorf("%s: %s", uses, err)
+			continue
+		}
+		if *u != want {
+			t.Errorf("%s: got %+v, want %+v", uses, *u, want)
+		}
+	}
+	for _, uses := range []string{"", "actions/checkout", "docker://alpine:3", "checkout@v4"} {
+		if _, err := ParseUses(uses); err == nil {
+			t.Errorf("%q: got no error", uses)
+		}
+	}
+}
+
+func TestGraph_workflow(t *testing.T) {
+	data := []byte(`name: CI
+on:
+  workflow_call:
+    inputs:
+      go-version:
+        type: string
+    outputs:
+      version:
+        value: ${{ jobs.build.outputs.version }}
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    defaults:
+      run:
+        working-directory: tools
+    outputs:
+      version: ${{ steps.ver.outputs.version }}
+    steps:
+      - uses: actions/checkout@v4
+      - uses: ./.github/actions/setup
+        with:
+          go: ${{ inputs.go-version }}
+      - id: ver
+        run: ./version.sh && bash ../scripts/missing.sh
+  test:
+    needs: [build]
+    container: golang:1.22
+    steps:
+      - run: |
+          echo ${{ needs.build.outputs.version }}
+          scripts/test.sh -v
+  release:
+    needs: test
+    uses: ./.github/workflows/release.yml
+  lint:
+    steps:
+      - uses: docker://alpine:3
+`)
+	stat := statFiles("tools/version.sh", "scripts/test.sh")
+	o, err := Graph(".github/workflows/ci.yml", data, stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantDefs := []string{
+		"file file/scripts/test.sh", "file file/tools/version.sh",
+		"input input/go-version",
+		"job job/build", "job job/lint", "job job/release", "job job/test",
+		"output output/version",
+		"step job/build/step/ver",
+		"workflow .",
+	}
+	if defs := defPaths(o); !reflect.DeepEqual(defs, wantDefs) {
+		t.Errorf("got defs %q, want %q", defs, wantDefs)
+	}
+
+	want := map[string][]string{
+		"github.com/actions/checkout GitHubAction action.yml .": {"actions/checkout@v4"},
+		" GitHubAction .github/actions/setup/action.yml .":      {"./.github/actions/setup"},
+		" GitHubWorkflow .github/workflows/release.yml .":       {"./.github/workflows/release.yml"},
+		"docker.io/library/golang DockerImage library/golang .": {"golang:1.22"},
+		"docker.io/library/alpine DockerImage library/alpine .": {"alpine:3"},
+		"job/build":             {"build", "build", "build"},
+		"job/test":              {"test"},
+		"job/build/step/ver":    {"ver"},
+		"input/go-version":      {"go-version"},
+		"file/tools/version.sh": {"./version.sh"},
+		"file/scripts/test.sh":  {"scripts/test.sh"},
+	}
+	if got := refTexts(data, o); !reflect.DeepEqual(got, want) {
+		t.Errorf("got refs %v, want %v", got, want)
+	}
+
+	deps, err := Dependencies(".github/workflows/ci.yml", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"actions/checkout@v4"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("got deps %q, want %q", deps, want)
+	}
+}
+
+func TestGraph_action(t *testing.T) {
+	data := []byte(`name: Setup
+inputs:
+  go:
+    default: stable
+outputs:
+  cache-hit:
+    value: ${{ steps.cache.outputs.cache-hit }}
+runs:
+  using: composite
+  steps:
+    - id: cache
+      uses: actions/cache@v4
+    - run: ${{ github.action_path }}/install.sh ${{ inputs.go }}
+      shell: bash
+`)
+	o, err := Graph(".github/actions/setup/action.yml", data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDefs := []string{"action .", "input input/go", "output output/cache-hit", "step step/cache"}
+	if defs := defPaths(o); !reflect.DeepEqual(defs, wantDefs) {
+		t.Errorf("got defs %q, want %q", defs, wantDefs)
+	}
+	want := map[string][]string{
+		"github.com/actions/cache GitHubAction action.yml .": {"actions/cache@v4"},
+		"step/cache": {"cache"},
+		"input/go":   {"go"},
+	}
+	if got := refTexts(data, o); !reflect.DeepEqual(got, want) {
+		t.Errorf("got refs %v, want %v", got, want)
+	}
+}
+
+func TestGraph_gitlab(t *testing.T) {
+	data := []byte(`include:
+  - local: /ci/common.yml
+  - remote: https://example.com/ci.yml
+stages: [build, test]
+image: golang:1.22
+.defaults: &defaults
+  before_script:
+    - ./scripts/setup.sh
+build:
+  <<: *defaults
+  stage: build
+  script:
+    - make
+test:
+  <<: *defaults
+  extends: .defaults
+  stage: test
+  needs:
+    - build
+    - job: lint
+      optional: true
+  script:
+    - !reference [.defaults, before_script]
+    - go test ./...
+lint:
+  stage: test
+  services:
+    - name: postgres:16
+  script: make lint
+`)
+	stat := statFiles("ci/common.yml", "scripts/setup.sh")
+	o, err := Graph(".gitlab-ci.yml", data, stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDefs := []string{
+		"config .",
+		"file file/ci/common.yml", "file file/scripts/setup.sh",
+		"job job/build", "job job/lint", "job job/test",
+		"stage stage/build", "stage stage/test",
+		"template job/.defaults",
+	}
+	if defs := defPaths(o); !reflect.DeepEqual(defs, wantDefs) {
+		t.Errorf("got defs %q, want %q", defs, wantDefs)
+	}
+	want := map[string][]string{
+		"docker.io/library/golang DockerImage library/golang .":     {"golang:1.22"},
+		"docker.io/library/postgres DockerImage library/postgres .": {"postgres:16"},
+		"file/ci/common.yml":    {"/ci/common.yml"},
+		"file/scripts/setup.sh": {"./scripts/setup.sh"},
+		"stage/build":           {"build"},
+		"stage/test":            {"test", "test"},
+		"job/.defaults":         {".defaults", ".defaults"},
+		"job/build":             {"build"},
+		"job/lint":              {"lint"},
+	}
+	if got := refTexts(data, o); !reflect.DeepEqual(got, want) {
+		t.Errorf("got refs %v, want %v", got, want)
+	}
+}
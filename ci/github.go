@@ -0,0 +1,144 @@
+package ci
+
+import (
+	"path"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/yaml"
+)
+
+// graphWorkflow graphs a GitHub Actions workflow. Its defs are the
+// workflow itself (path "."), its inputs and outputs ("input/NAME" and
+// "output/NAME"), its jobs ("job/ID"), and the steps of its jobs that
+// have IDs ("job/ID/step/ID").
+func (g *grapher) graphWorkflow(root *yaml.Node) {
+	name := path.Base(g.file)
+	if n := root.Get("name"); n != nil && n.Kind == yaml.Scalar && n.Value != "" {
+		name = n.Value
+	}
+	g.fileDef(name, "workflow")
+
+	on := root.Get("on")
+	for _, trigger := range []string{"workflow_call", "workflow_dispatch"} {
+		for _, k := range on.Get(trigger).Get("inputs").Items() {
+			g.def("input/"+k.Value, k.Value, "input", k)
+		}
+	}
+	outputs := on.Get("workflow_call").Get("outputs")
+	for _, k := range outputs.Items() {
+		g.def("output/"+k.Value, k.Value, "output", k)
+	}
+
+	jobs := root.Get("jobs")
+	for i, k := range jobs.Items() {
+		jobPath := "job/" + k.Value
+		name := k.Value
+		if n := jobs.Values[i].Get("name"); n != nil && n.Kind == yaml.Scalar && n.Value != "" {
+			name = n.Value
+		}
+		g.def(jobPath, name, "job", k)
+		g.stepDefs(jobs.Values[i].Get("steps"), jobPath+"/")
+	}
+
+	workdir := root.Get("defaults").Get("run").Get("working-directory")
+	g.exprRefs(outputs, "")
+	for i, k := range jobs.Items() {
+		job := jobs.Values[i]
+		for _, need := range job.Get("needs").Items() {
+			g.ref("job/"+need.Value, need.Start, need.End)
+		}
+		g.usesRef(job.Get("uses"))
+		g.imageNodeRef(job.Get("container"))
+		if services := job.Get("services"); services != nil && services.Kind == yaml.Mapping {
+			for _, svc := range services.Values {
+				g.imageNodeRef(svc)
+			}
+		}
+		jobWorkdir := workdir
+		if n := job.Get("defaults").Get("run").Get("working-directory"); n != nil {
+			jobWorkdir = n
+		}
+		g.stepRefs(job.Get("steps"), jobWorkdir)
+		g.exprRefs(job, "job/"+k.Value+"/")
+	}
+}
+
+// graphAction graphs a GitHub action's metadata file (action.yml). Its
+// defs are the action itself (path "."), its inputs and outputs
+// ("input/NAME" and "output/NAME"), and, for composite actions, the
+// steps that have IDs ("step/ID").
+func (g *grapher) graphAction(root *yaml.Node) {
+	dir := path.Dir(g.file)
+	name := path.Base(dir)
+	if n := root.Get("name"); n != nil && n.Kind == yaml.Scalar && n.Value != "" {
+		name = n.Value
+	}
+	g.fileDef(name, "action")
+	for _, k := range root.Get("inputs").Items() {
+		g.def("input/"+k.Value, k.Value, "input", k)
+	}
+	for _, k := range root.Get("outputs").Items() {
+		g.def("output/"+k.Value, k.Value, "output", k)
+	}
+
+	runs := root.Get("runs")
+	steps := runs.Get("steps")
+	g.stepDefs(steps, "")
+	g.stepRefs(steps, nil)
+	g.exprRefs(runs, "")
+	g.exprRefs(root.Get("outputs"), "")
+
+	// Docker actions are built from a Dockerfile (relative to the
+	// action's directory) or use an image, and JavaScript actions run
+	// scripts in the action's directory.
+	if image := runs.Get("image"); image != nil && image.Kind == yaml.Scalar && image.Value != "" {
+		if strings.HasPrefix(image.Value, "docker://") {
+			g.usesRef(image)
+		} else {
+			g.unitRef("", "Dockerfile", path.Join(dir, image.Value), image)
+		}
+	}
+	for _, key := range []string{"main", "pre", "post"} {
+		if n := runs.Get(key); n != nil && n.Kind == yaml.Scalar && n.Value != "" {
+			g.fileRef(path.Join(dir, n.Value), n.Start, n.End)
+		}
+	}
+}
+
+// stepDefs emits defs for the steps (in the sequence steps) that have
+// IDs, with the given def path prefix.
+func (g *grapher) stepDefs(steps *yaml.Node, prefix string) {
+	if steps == nil || steps.Kind != yaml.Sequence {
+		return
+	}
+	for _, step := range steps.Values {
+		if id := step.Get("id"); id != nil && id.Kind == yaml.Scalar && id.Value != "" {
+			name := id.Value
+			if n := step.Get("name"); n != nil && n.Kind == yaml.Scalar && n.Value != "" {
+				name = n.Value
+			}
+			g.def(prefix+"step/"+id.Value, name, "step", id)
+		}
+	}
+}
+
+// stepRefs emits refs for the actions that the steps use and the
+// scripts that they run (in the default working directory workdir, or
+// the repository root if workdir is nil).
+func (g *grapher) stepRefs(steps *yaml.Node, workdir *yaml.Node) {
+	if steps == nil || steps.Kind != yaml.Sequence {
+		return
+	}
+	for _, step := range steps.Values {
+		g.usesRef(step.Get("uses"))
+		dir := workdir
+		if n := step.Get("working-directory"); n != nil {
+			dir = n
+		}
+		wd := "."
+		if dir != nil && dir.Kind == yaml.Scalar && dir.Value != "" {
+			wd = dir.Value
+		}
+		g.scriptRefs(step.Get("run"), wd)
+	}
+}
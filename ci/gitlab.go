@@ -0,0 +1,133 @@
+package ci
+
+import (
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/yaml"
+)
+
+// gitlabGlobalKeys are the top-level keys in GitLab CI configs that
+// aren't job names.
+var gitlabGlobalKeys = map[string]bool{
+	"after_script":  true,
+	"before_script": true,
+	"cache":         true,
+	"default":       true,
+	"image":         true,
+	"include":       true,
+	"services":      true,
+	"stages":        true,
+	"variables":     true,
+	"workflow":      true,
+}
+
+// graphGitLab graphs a GitLab CI config. Its defs are the config
+// itself (path "."), its stages ("stage/NAME"), and its jobs
+// ("job/NAME"; hidden jobs, whose names begin with ".", are of kind
+// "template").
+func (g *grapher) graphGitLab(root *yaml.Node) {
+	g.fileDef(g.file, "config")
+	for _, stage := range root.Get("stages").Items() {
+		g.def("stage/"+stage.Value, stage.Value, "stage", stage)
+	}
+	var jobs []*yaml.Node
+	if root.Kind == yaml.Mapping {
+		for i, k := range root.Keys {
+			if gitlabGlobalKeys[k.Value] || root.Values[i].Kind != yaml.Mapping {
+				continue
+			}
+			kind := "job"
+			if strings.HasPrefix(k.Value, ".") {
+				kind = "template"
+			}
+			g.def("job/"+k.Value, k.Value, kind, k)
+			jobs = append(jobs, root.Values[i])
+		}
+	}
+
+	g.gitlabIncludeRefs(root.Get("include"))
+	g.gitlabJobRefs(root)
+	g.gitlabJobRefs(root.Get("default"))
+	for _, job := range jobs {
+		if stage := job.Get("stage"); stage != nil && stage.Kind == yaml.Scalar {
+			g.ref("stage/"+stage.Value, stage.Start, stage.End)
+		}
+		for _, key := range []string{"extends", "dependencies"} {
+			for _, n := range job.Get(key).Items() {
+				g.ref("job/"+n.Value, n.Start, n.End)
+			}
+		}
+		if needs := job.Get("needs"); needs != nil {
+			for _, need := range needs.Items() {
+				g.ref("job/"+need.Value, need.Start, need.End)
+			}
+			if needs.Kind == yaml.Sequence {
+				for _, need := range needs.Values {
+					if n := need.Get("job"); n != nil && n.Kind == yaml.Scalar && need.Get("project") == nil && need.Get("pipeline") == nil {
+						g.ref("job/"+n.Value, n.Start, n.End)
+					}
+				}
+			}
+		}
+		if include := job.Get("trigger").Get("include"); include != nil {
+			g.gitlabIncludeRefs(include)
+		}
+		g.gitlabJobRefs(job)
+	}
+}
+
+// gitlabJobRefs emits refs for the images and scripts that the job (or
+// the top-level or default job settings) n uses.
+func (g *grapher) gitlabJobRefs(n *yaml.Node) {
+	if n == nil || n.Kind != yaml.Mapping {
+		return
+	}
+	g.imageNodeRef(n.Get("image"))
+	if services := n.Get("services"); services != nil && services.Kind == yaml.Sequence {
+		for _, svc := range services.Values {
+			g.imageNodeRef(svc)
+		}
+	}
+	for _, key := range []string{"before_script", "script", "after_script"} {
+		script := n.Get(key)
+		g.scriptRefs(script, ".")
+
+		// Commands may be reused from other jobs with
+		// "!reference [.job, script]", which is parsed as a
+		// sequence (the tag is ignored).
+		if script != nil && script.Kind == yaml.Sequence {
+			for _, cmd := range script.Values {
+				if cmd.Kind == yaml.Sequence && len(cmd.Values) > 0 && cmd.Values[0].Kind == yaml.Scalar {
+					job := cmd.Values[0]
+					g.ref("job/"+job.Value, job.Start, job.End)
+				}
+			}
+		}
+	}
+}
+
+// gitlabIncludeRefs emits refs to the local files (in the same
+// repository) that an "include" value includes. Includes of files in
+// other projects and of remote files and templates can't be resolved.
+func (g *grapher) gitlabIncludeRefs(include *yaml.Node) {
+	if include == nil {
+		return
+	}
+	var files []*yaml.Node
+	switch include.Kind {
+	case yaml.Scalar, yaml.Mapping:
+		files = []*yaml.Node{include}
+	case yaml.Sequence:
+		files = include.Values
+	}
+	for _, f := range files {
+		if f.Kind == yaml.Mapping {
+			f = f.Get("local")
+		} else if strings.Contains(f.Value, "://") {
+			continue // remote
+		}
+		if f != nil && f.Kind == yaml.Scalar && f.Value != "" {
+			g.fileRef(strings.TrimPrefix(f.Value, "/"), f.Start, f.End)
+		}
+	}
+}
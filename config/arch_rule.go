@@ -0,0 +1,132 @@
+package config
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// An ArchRule restricts which source units the source units matching
+// Units may depend on (i.e., refer to defs in). For example, the rule
+// {"Units": "web/**", "Deny": ["internal/db/**"]} forbids refs from
+// source units in the web dir tree to defs in source units in the
+// internal/db dir tree.
+//
+// Patterns match the Dir of source units (relative to the repository
+// root). They use path.Match syntax, except that a "**" path
+// component matches zero or more path components (so "web/**" matches
+// "web" and all dirs beneath it). Refs to defs in the same source unit
+// or in other repositories are never restricted.
+type ArchRule struct {
+	// Units is a pattern that matches the source units that the rule
+	// applies to.
+	Units string
+
+	// Allow, if set, lists patterns of the source units that the
+	// matching source units may depend on. Dependencies on all other
+	// source units are forbidden.
+	Allow []string `json:",omitempty"`
+
+	// Deny lists patterns of the source units that the matching source
+	// units must not depend on. It takes precedence over Allow.
+	Deny []string `json:",omitempty"`
+
+	// Message, if set, explains the rule. It is shown along with
+	// violations of the rule.
+	Message string `json:",omitempty"`
+}
+
+// ErrInvalidArchRule indicates that an ArchRule in the config has no
+// Units pattern, neither Allow nor Deny patterns, or a malformed
+// pattern.
+var ErrInvalidArchRule = errors.New("invalid ArchRules entry specified in config (Units and either Allow or Deny are required, and patterns must be well-formed)")
+
+func (r *ArchRule) validate() error {
+	if r.Units == "" || (r.Allow == nil && r.Deny == nil) {
+		return ErrInvalidArchRule
+	}
+	pats := append([]string{r.Units}, r.Allow...)
+	for _, pat := range append(pats, r.Deny...) {
+		if _, err := matchDirPattern(pat, ""); err != nil {
+			return ErrInvalidArchRule
+		}
+	}
+	return nil
+}
+
+// Applies returns whether r restricts the dependencies of u.
+func (r *ArchRule) Applies(u *unit.SourceUnit) bool {
+	ok, _ := matchDirPattern(r.Units, unitDir(u))
+	return ok
+}
+
+// Allows returns whether r allows source units that it applies to to
+// depend on u.
+func (r *ArchRule) Allows(u *unit.SourceUnit) bool {
+	dir := unitDir(u)
+	for _, pat := range r.Deny {
+		if ok, _ := matchDirPattern(pat, dir); ok {
+			return false
+		}
+	}
+	if r.Allow == nil {
+		return true
+	}
+	for _, pat := range r.Allow {
+		if ok, _ := matchDirPattern(pat, dir); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func unitDir(u *unit.SourceUnit) string {
+	if u.Dir == "" {
+		return "."
+	}
+	return path.Clean(u.Dir)
+}
+
+// matchDirPattern reports whether dir matches the pattern pat (see
+// ArchRule for the syntax). The only possible error is
+// path.ErrBadPattern, which is returned (even when dir is empty) if
+// pat is malformed.
+func matchDirPattern(pat, dir string) (bool, error) {
+	patParts := strings.Split(path.Clean(pat), "/")
+	for _, p := range patParts {
+		if _, err := path.Match(p, ""); err != nil {
+			return false, err
+		}
+	}
+	var dirParts []string
+	if dir != "." && dir != "" {
+		dirParts = strings.Split(dir, "/")
+	}
+	if len(patParts) == 1 && patParts[0] == "." {
+		patParts = nil
+	}
+	return matchParts(patParts, dirParts), nil
+}
+
+func matchParts(pat, dir []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for i := 0; i <= len(dir); i++ {
+				if matchParts(pat[1:], dir[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(dir) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], dir[0]); !ok {
+			return false
+		}
+		pat, dir = pat[1:], dir[1:]
+	}
+	return len(dir) == 0
+}
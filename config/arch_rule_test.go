@@ -0,0 +1,79 @@
+package config
+
+import (
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestMatchDirPattern(t *testing.T) {
+	tests := []struct {
+		pat, dir string
+		want     bool
+	}{
+		{"web", "web", true},
+		{"web", "web/x", false},
+		{"web/*", "web/x", true},
+		{"web/*", "web/x/y", false},
+		{"web/**", "web", true},
+		{"web/**", "web/x/y", true},
+		{"web/**", "webx", false},
+		{"**/db", "db", true},
+		{"**/db", "internal/db", true},
+		{"**/db", "internal/db/x", false},
+		{"internal/**/db/**", "internal/a/b/db/c", true},
+		{"**", ".", true},
+		{".", ".", true},
+		{".", "x", false},
+	}
+	for _, test := range tests {
+		got, err := matchDirPattern(test.pat, test.dir)
+		if err != nil {
+			t.Errorf("%q %q: %s", test.pat, test.dir, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q %q: got %v, want %v", test.pat, test.dir, got, test.want)
+		}
+	}
+}
+
+func TestArchRule(t *testing.T) {
+	r := &ArchRule{Units: "web/**", Allow: []string{"web/**", "lib/**"}, Deny: []string{"lib/internal/**"}}
+	if err := r.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Applies(&unit.SourceUnit{Dir: "web/handlers/"}) {
+		t.Error("rule should apply to web/handlers")
+	}
+	if r.Applies(&unit.SourceUnit{Dir: "lib"}) {
+		t.Error("rule should not apply to lib")
+	}
+
+	tests := map[string]bool{
+		"web/x":          true,
+		"lib/a":          true,
+		"lib/internal/b": false,
+		"internal/db":    false,
+	}
+	for dir, want := range tests {
+		if got := r.Allows(&unit.SourceUnit{Dir: dir}); got != want {
+			t.Errorf("%s: got Allows %v, want %v", dir, got, want)
+		}
+	}
+}
+
+func TestTree_validate_archRules(t *testing.T) {
+	tests := map[string]*ArchRule{
+		"no units":         {Deny: []string{"a"}},
+		"no allow or deny": {Units: "a"},
+		"bad pattern":      {Units: "a", Deny: []string{"["}},
+	}
+	for label, r := range tests {
+		tree := &Tree{ArchRules: []*ArchRule{r}}
+		if err := tree.validate(); err != ErrInvalidArchRule {
+			t.Errorf("%s: got err %v, want ErrInvalidArchRule", label, err)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/graph"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
@@ -27,11 +28,27 @@ type Repository struct {
 type Tree struct {
 	// SourceUnits is a list of source units in the repository, either specified
 	// manually in the Srcfile or discovered automatically by the scanner.
+	//
+	// Source units specified manually must have a Name and Type, and their
+	// Files (which may contain globs) are relative to the tree root. They
+	// are treated exactly like scanned source units, except that they take
+	// precedence over scanned source units with the same ID or that claim
+	// the same files. To use only manually specified source units, set
+	// Scanners to an empty list.
 	SourceUnits []*unit.SourceUnit `json:",omitempty"`
 
 	// Scanners to use to scan for source units in this tree.
 	Scanners []*srclib.ToolRef `json:",omitempty"`
 
+	// ScannerPriority lists scanners in decreasing order of priority.
+	// When source units from different scanners claim the same files,
+	// the files are assigned to the source unit whose scanner is listed
+	// first (scanners not listed have the lowest priority). Conflicts
+	// between scanners of equal priority are resolved in favor of the
+	// most specific source unit (the one in the most deeply nested
+	// directory, or else the one with the fewest files).
+	ScannerPriority []*srclib.ToolRef `json:",omitempty"`
+
 	// PreConfigCommands is a list of commands (passed to `sh -c`) that should
 	// be run on the tree before configuration occurs (after the initial config
 	// is read from the Srcfile but before scanners are run). The commands are
@@ -62,6 +79,32 @@ type Tree struct {
 	// name and type pair in SkipUnits is skipped.
 	SkipUnits []struct{ Name, Type string } `json:",omitempty"`
 
+	// SkipPatterns are patterns of files and directories (such as
+	// "gen/" or "*_generated.go") that are skipped when scanning, in
+	// addition to the DefaultSkipPatterns for vendored and generated
+	// files (see MatchSkipPatterns for the syntax). Scanned source
+	// units whose dir is skipped, or all of whose files are skipped,
+	// are skipped, and skipped files are removed from the other
+	// scanned source units. Patterns prefixed with "!" (such as
+	// "!vendor/") override earlier patterns, including the defaults.
+	SkipPatterns []string `json:",omitempty"`
+
+	// NoDefaultSkipPatterns disables the DefaultSkipPatterns.
+	NoDefaultSkipPatterns bool `json:",omitempty"`
+
+	// SymlinkPolicy determines how symlinked files and directories in
+	// the tree are treated when scanning for source unit files and
+	// when post-processing grapher output: "follow" (the default)
+	// follows symlinks only if they point inside the tree, "ignore"
+	// skips all symlinks, and "error" fails on any symlink.
+	SymlinkPolicy SymlinkPolicy `json:",omitempty"`
+
+	// PostProcessors is a list of post-processors to run on each source
+	// unit's graph output after it is normalized (see
+	// grapher.OpenPostProcessor for the syntax). The output is
+	// validated again afterwards.
+	PostProcessors []string `json:",omitempty"`
+
 	// TODO(sqs): Add some type of field that lets the Srcfile and the scanners
 	// have input into which tools get used during the execution phase. Right
 	// now, we're going to try just using the system defaults (srclib-*) and
@@ -70,6 +113,44 @@ type Tree struct {
 	// Config is an arbitrary key-value property map. Properties are copied
 	// verbatim to each source unit that is scanned in this tree.
 	Config map[string]interface{} `json:",omitempty"`
+
+	// UnitConfigs sets Config properties on specific source units (or
+	// groups of them), such as a language version or target platform.
+	// They take precedence over the tree Config and over the Config
+	// set by scanners. The resulting source unit Config is validated
+	// against the UnitConfigSchema of each toolchain that operates on
+	// the source unit.
+	UnitConfigs []*UnitConfig `json:",omitempty"`
+
+	// EmbeddedLanguages maps embedded languages (such as "javascript"
+	// in HTML script tags, or "sql" in string literals) to the source
+	// unit types that graph them. For each source unit with files that
+	// contain code in one of these languages, a virtual sub-unit of
+	// the language's type is created whose files are the virtual files
+	// written by `src extract-regions` (see package region). Run that
+	// command in a PreConfigCommand so that the virtual files exist.
+	EmbeddedLanguages map[string]string `json:",omitempty"`
+
+	// ArchRules restrict the dependencies between source units in the
+	// tree (see ArchRule). They are checked by `src check-arch`.
+	ArchRules []*ArchRule `json:",omitempty"`
+
+	// Gates configures the quality gates that `src check` enforces
+	// (see Gates). They are read only from the top-level Srcfile.
+	Gates *Gates `json:",omitempty"`
+
+	// URIRules rewrite the repository URIs in the build data, such as
+	// to map mirrors to their canonical repositories (see
+	// graph.URIRule). They are read only from the top-level Srcfile,
+	// and they take precedence over the URIRules in the srclib
+	// configuration (see External).
+	URIRules []graph.URIRule `json:",omitempty"`
+
+	// ResolveVanityURIs makes the refs' DefRepo URIs on vanity domains
+	// (such as gopkg.in) be resolved to the repositories that host
+	// them, when graph output is normalized (see
+	// grapher.VanityResolver). It requires network access.
+	ResolveVanityURIs bool `json:",omitempty"`
 }
 
 // ReadRepository parses and validates the configuration for a repository. If no
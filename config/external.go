@@ -3,12 +3,14 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/graph"
 	"sourcegraph.com/sourcegraph/srclib/toolchain"
 )
 
@@ -18,6 +20,11 @@ type External struct {
 	// Scanners is the default set of scanners to use. If not specified, all
 	// scanners in the SRCLIBPATH will be used.
 	Scanners []*srclib.ToolRef
+
+	// URIRules rewrite repository URIs in all repositories' build
+	// data (see graph.URIRule). A repository's Srcfile may specify
+	// additional URIRules, which take precedence over these.
+	URIRules []graph.URIRule `json:",omitempty"`
 }
 
 const srclibconfigFile = ".srclibconfig"
@@ -27,9 +34,26 @@ const srclibconfigFile = ".srclibconfig"
 // if that file exists, and otherwise it walks SRCLIBPATH for
 // available scanners.
 func SrclibPathConfig() (*External, error) {
+	x := readSrclibconfig()
+
+	// Default to using all available scanners.
+	if len(x.Scanners) == 0 {
+		var err error
+		x.Scanners, err = toolchain.ListTools("scan")
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to find scanners in SRCLIBPATH: %s", err)
+		}
+	}
+
+	return x, nil
+}
+
+// readSrclibconfig reads SRCLIBPATH/.srclibconfig. If the file doesn't
+// exist or can't be read, it returns an empty configuration (and logs
+// a warning in the latter case).
+func readSrclibconfig() *External {
 	var x External
 
-	// Try reading from .srclibconfig.
 	dir := strings.SplitN(srclib.Path, ":", 2)[0]
 	configFile := filepath.Join(dir, srclibconfigFile)
 	f, err := os.Open(configFile)
@@ -41,17 +65,25 @@ func SrclibPathConfig() (*External, error) {
 		defer f.Close()
 		if err := json.NewDecoder(f).Decode(&x); err != nil {
 			log.Printf("Warning: unable to decode config file at %s: %s. Continuing without this config.", configFile, err)
+			x = External{}
 		}
 	}
+	return &x
+}
 
-	// Default to using all available scanners.
-	if len(x.Scanners) == 0 {
-		var err error
-		x.Scanners, err = toolchain.ListTools("scan")
-		if err != nil && !os.IsNotExist(err) {
-			return nil, fmt.Errorf("failed to find scanners in SRCLIBPATH: %s", err)
+// URIRules returns the URI rules that apply to the repository whose
+// top-level directory is dir: those in its Srcfile (if any), followed
+// by those in the srclib configuration (see External). Pass them to
+// graph.SetURIRules.
+func URIRules(dir string) ([]graph.URIRule, error) {
+	var c Repository
+	data, err := ioutil.ReadFile(filepath.Join(dir, Filename))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	} else if err == nil {
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("%s: %s", Filename, err)
 		}
 	}
-
-	return &x, nil
+	return append(c.URIRules, readSrclibconfig().URIRules...), nil
 }
@@ -0,0 +1,39 @@
+package config
+
+import "errors"
+
+// Gates configures the quality gates that `src check` enforces on the
+// source units that a change affects. All gates are enabled by
+// default.
+type Gates struct {
+	// NoDanglingRefs disables the gate that fails if the changed
+	// source units have refs to nonexistent defs in the repository
+	// that they didn't have before the change.
+	NoDanglingRefs bool `json:",omitempty"`
+
+	// NoCoverage disables the gate that fails if the ref coverage of
+	// the changed source units (the fraction of their refs to defs in
+	// the repository that resolve) decreased by more than
+	// MaxCoverageDecrease.
+	NoCoverage bool `json:",omitempty"`
+
+	// MaxCoverageDecrease is the amount (between 0 and 1) by which the
+	// coverage may decrease, such as 0.01 to tolerate a decrease of one
+	// percentage point.
+	MaxCoverageDecrease float64 `json:",omitempty"`
+
+	// NoArch disables the gate that fails if refs in the changed
+	// source units violate the ArchRules.
+	NoArch bool `json:",omitempty"`
+}
+
+// ErrInvalidGates indicates that the Gates in the config have a
+// MaxCoverageDecrease outside of [0, 1].
+var ErrInvalidGates = errors.New("invalid Gates specified in config (MaxCoverageDecrease must be between 0 and 1)")
+
+func (g *Gates) validate() error {
+	if g.MaxCoverageDecrease < 0 || g.MaxCoverageDecrease > 1 {
+		return ErrInvalidGates
+	}
+	return nil
+}
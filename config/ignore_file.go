@@ -0,0 +1,48 @@
+package config
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+)
+
+// IgnoreFilePragma is the magic comment that excludes a file from
+// analysis (for files that crash a grapher or that contain generated
+// noise). Files with this comment on a line of its own, near the top
+// of the file, are removed from scanned source units (see
+// HasIgnoreFilePragma), and the graph output in them is dropped.
+const IgnoreFilePragma = "srclib:ignore-file"
+
+// ignoreFilePragmaScanLen is the number of leading bytes of a file
+// that HasIgnoreFilePragma checks.
+const ignoreFilePragmaScanLen = 4096
+
+// ignoreFilePragmaLine matches a line that consists of IgnoreFilePragma
+// in a comment of one of the common comment syntaxes.
+var ignoreFilePragmaLine = regexp.MustCompile(`^\s*(//+|#+|--|;+|%+|/\*+|\*|<!--|\{-|\(\*|')\s*` + regexp.QuoteMeta(IgnoreFilePragma) + `\s*(\*/|-->|-\}|\*\))?\s*$`)
+
+// HasIgnoreFilePragma reports whether the file contains the
+// IgnoreFilePragma in a comment on a line of its own, in its first
+// 4096 bytes. It returns false if the file can't be read (so the file
+// is treated as usual).
+func HasIgnoreFilePragma(filename string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return ReadIgnoreFilePragma(f)
+}
+
+// ReadIgnoreFilePragma is like HasIgnoreFilePragma, but it reads the
+// file's contents from r.
+func ReadIgnoreFilePragma(r io.Reader) bool {
+	s := bufio.NewScanner(io.LimitReader(r, ignoreFilePragmaScanLen))
+	for s.Scan() {
+		if ignoreFilePragmaLine.Match(s.Bytes()) {
+			return true
+		}
+	}
+	return false
+}
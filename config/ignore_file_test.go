@@ -0,0 +1,27 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadIgnoreFilePragma(t *testing.T) {
+	tests := map[string]bool{
+		"// srclib:ignore-file\npackage a\n":      true,
+		"package a\n\n//srclib:ignore-file\n":     true,
+		"# srclib:ignore-file\nimport os\n":       true,
+		"/* srclib:ignore-file */\nvar a;\n":      true,
+		"<!-- srclib:ignore-file -->\n<html>\n":   true,
+		"-- srclib:ignore-file\nmodule A where\n": true,
+		"package a\n": false,
+		"// Use srclib:ignore-file to skip files.\n":           false,
+		"const p = \"srclib:ignore-file\"\n":                   false,
+		"srclib:ignore-file\n":                                 false,
+		strings.Repeat("\n", 5000) + "// srclib:ignore-file\n": false,
+	}
+	for data, want := range tests {
+		if got := ReadIgnoreFilePragma(strings.NewReader(data)); got != want {
+			t.Errorf("%.40q: got %v, want %v", data, got, want)
+		}
+	}
+}
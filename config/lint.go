@@ -0,0 +1,423 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// A LintError is a problem in a config file that Lint found.
+type LintError struct {
+	File string `json:",omitempty"`
+
+	// Line and Col are the 1-based position (Col is in bytes) of the
+	// value that has the problem, or 0 if the problem isn't with a
+	// specific value.
+	Line, Col int `json:",omitempty"`
+
+	// Key is the path of the value in the config, such as
+	// "SourceUnits[0].Files[1]".
+	Key string `json:",omitempty"`
+
+	Message string
+}
+
+func (e *LintError) Error() string {
+	var pos string
+	if e.File != "" {
+		pos = e.File + ":"
+	}
+	if e.Line != 0 {
+		pos += fmt.Sprintf("%d:%d:", e.Line, e.Col)
+	}
+	if e.Key != "" {
+		return fmt.Sprintf("%s %s: %s", pos, e.Key, e.Message)
+	}
+	return fmt.Sprintf("%s %s", pos, e.Message)
+}
+
+// LintRepository checks the contents of a repository's top-level
+// Srcfile against the schema of the Repository type (see Schema): it
+// reports unknown keys, values of the wrong type, malformed globs and
+// paths, and (if checkTool is non-nil) tool references (in Scanners,
+// ScannerPriority, and source unit Ops) for which checkTool returns an
+// error. If there are no such problems, the config's validation errors
+// (such as duplicate source units), if any, are reported.
+//
+// Unlike ReadRepository, LintRepository reports all problems that it
+// finds, along with their positions.
+func LintRepository(data []byte, checkTool func(*srclib.ToolRef) error) []*LintError {
+	return lint(data, reflect.TypeOf(Repository{}), checkTool, func() error {
+		var c Repository
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		return c.validate()
+	})
+}
+
+// LintTree is like LintRepository, but it checks a Srcfile in a
+// subdirectory of a repository against the schema of the Tree type.
+func LintTree(data []byte, checkTool func(*srclib.ToolRef) error) []*LintError {
+	return lint(data, reflect.TypeOf(Tree{}), checkTool, func() error {
+		var c Tree
+		if err := json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		return c.validate()
+	})
+}
+
+func lint(data []byte, t reflect.Type, checkTool func(*srclib.ToolRef) error, validate func() error) []*LintError {
+	l := &linter{data: data, dec: json.NewDecoder(bytes.NewReader(data)), checkTool: checkTool}
+	l.dec.UseNumber()
+	if len(bytes.TrimSpace(data)) == 0 {
+		l.errorf(0, "", "empty file (a config must be a JSON object)")
+		return l.errs
+	}
+	if _, err := l.value(t, "", nil); err != nil {
+		l.syntaxError(err)
+		return l.errs
+	}
+	off := l.dec.InputOffset()
+	if _, err := l.dec.Token(); err != io.EOF {
+		l.errorf(l.tokenStart(off), "", "unexpected data after the top-level JSON object")
+		return l.errs
+	}
+	if len(l.errs) == 0 {
+		if err := validate(); err != nil {
+			l.errs = append(l.errs, &LintError{Message: err.Error()})
+		}
+	}
+	return l.errs
+}
+
+// A linter checks a JSON document's values against Go types as it
+// reads them.
+type linter struct {
+	data       []byte
+	dec        *json.Decoder
+	lineStarts []int
+	checkTool  func(*srclib.ToolRef) error
+
+	errs []*LintError
+}
+
+// lintChecks are the checks of the string values of the fields of
+// config types (or, for fields with array values, of the elements),
+// by the types' Go field names.
+var lintChecks = map[reflect.Type]map[string]func(string) error{
+	reflect.TypeOf(Tree{}): {
+		"SkipDirs":     lintPath,
+		"SkipPatterns": validateSkipPattern,
+		"SymlinkPolicy": func(s string) error {
+			if !SymlinkPolicy(s).Valid() {
+				return fmt.Errorf("invalid symlink policy %q (must be %q, %q, or %q)", s, SymlinkFollow, SymlinkIgnore, SymlinkError)
+			}
+			return nil
+		},
+	},
+	reflect.TypeOf(unit.SourceUnit{}): {
+		"Files": lintFileGlob,
+		"Globs": lintFileGlob,
+		"Dir":   lintPath,
+	},
+	reflect.TypeOf(UnitConfig{}): {
+		"Name": lintGlob,
+		"Dir":  lintGlob,
+	},
+	reflect.TypeOf(ArchRule{}): {
+		"Units": lintDirPattern,
+		"Allow": lintDirPattern,
+		"Deny":  lintDirPattern,
+	},
+}
+
+func lintPath(p string) error {
+	if !validPath(p) {
+		return fmt.Errorf("path %q is absolute or above the config root dir", p)
+	}
+	return nil
+}
+
+func lintGlob(pat string) error {
+	if _, err := path.Match(pat, ""); err != nil {
+		return fmt.Errorf("bad glob %q: %s", pat, err)
+	}
+	return nil
+}
+
+func lintFileGlob(pat string) error {
+	if err := lintPath(pat); err != nil {
+		return err
+	}
+	return lintGlob(pat)
+}
+
+func lintDirPattern(pat string) error {
+	if _, err := matchDirPattern(pat, ""); err != nil {
+		return fmt.Errorf("bad pattern %q: %s", pat, err)
+	}
+	return nil
+}
+
+var toolRefType = reflect.TypeOf(srclib.ToolRef{})
+
+// value reads the next JSON value and checks it against t (reporting
+// problems at key), and returns it (decoded as by json.Unmarshal into
+// an interface{}, except that numbers are json.Numbers). The only
+// errors it returns are JSON syntax errors. If check is non-nil, it
+// is called on the value if it is a string, or on each string element
+// if it is an array.
+func (l *linter) value(t reflect.Type, key string, check func(string) error) (interface{}, error) {
+	off := l.dec.InputOffset()
+	tok, err := l.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	off = l.tokenStart(off)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if isJSONUnmarshaler(t) {
+		t = reflect.TypeOf((*interface{})(nil)).Elem()
+	}
+
+	var v interface{}
+	switch tok {
+	case json.Delim('{'):
+		if v, err = l.object(t, key); err != nil {
+			return nil, err
+		}
+	case json.Delim('['):
+		if v, err = l.array(t, key, check); err != nil {
+			return nil, err
+		}
+	default:
+		v = tok
+		if s, ok := v.(string); ok && check != nil && t.Kind() == reflect.String {
+			if err := check(s); err != nil {
+				l.errorf(off, key, "%s", err)
+			}
+		}
+	}
+
+	if !jsonTypeMatches(v, t) {
+		l.errorf(off, key, "expected %s, got %s", jsonTypeName(t), jsonValueTypeName(v))
+		return v, nil
+	}
+	if t == toolRefType && v != nil && l.checkTool != nil {
+		var ref srclib.ToolRef
+		data, _ := json.Marshal(v)
+		if err := json.Unmarshal(data, &ref); err == nil {
+			if err := l.checkTool(&ref); err != nil {
+				l.errorf(off, key, "%s", err)
+			}
+		}
+	}
+	return v, nil
+}
+
+// object reads the rest of a JSON object (after its "{").
+func (l *linter) object(t reflect.Type, key string) (map[string]interface{}, error) {
+	var fields map[string]jsonField // by lowercased JSON key
+	if t.Kind() == reflect.Struct {
+		fields = map[string]jsonField{}
+		for _, f := range jsonFields(t) {
+			fields[strings.ToLower(f.name)] = f
+		}
+	}
+
+	m := map[string]interface{}{}
+	for l.dec.More() {
+		off := l.dec.InputOffset()
+		tok, err := l.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		off = l.tokenStart(off)
+		name := tok.(string) // object keys are always strings
+
+		elemType := reflect.TypeOf((*interface{})(nil)).Elem()
+		elemKey := joinKey(key, name)
+		var check func(string) error
+		switch t.Kind() {
+		case reflect.Struct:
+			if f, ok := fields[strings.ToLower(name)]; !ok {
+				l.errorf(off, key, "unknown key %q", name)
+			} else {
+				elemType, elemKey, check = f.Type, joinKey(key, f.name), lintChecks[f.owner][f.Name]
+				if name != f.name {
+					l.errorf(off, key, "key %q should be %q", name, f.name)
+				}
+			}
+		case reflect.Map:
+			elemType = t.Elem()
+		}
+		if m[name], err = l.value(elemType, elemKey, check); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := l.dec.Token(); err != nil { // "}"
+		return nil, err
+	}
+	return m, nil
+}
+
+// array reads the rest of a JSON array (after its "[").
+func (l *linter) array(t reflect.Type, key string, check func(string) error) ([]interface{}, error) {
+	elemType := reflect.TypeOf((*interface{})(nil)).Elem()
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		elemType = t.Elem()
+	}
+	a := []interface{}{}
+	for i := 0; l.dec.More(); i++ {
+		v, err := l.value(elemType, key+"["+strconv.Itoa(i)+"]", check)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	if _, err := l.dec.Token(); err != nil { // "]"
+		return nil, err
+	}
+	return a, nil
+}
+
+func joinKey(key, name string) string {
+	if key == "" {
+		return name
+	}
+	return key + "." + name
+}
+
+// jsonTypeMatches returns whether the JSON value v can be decoded into
+// a value of type t. A null can be decoded into any type.
+func jsonTypeMatches(v interface{}, t reflect.Type) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return t.Kind() == reflect.Bool || t.Kind() == reflect.Interface
+	case string:
+		return t.Kind() == reflect.String || t.Kind() == reflect.Interface || (t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8)
+	case json.Number:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			_, err := strconv.ParseInt(string(v), 10, t.Bits())
+			return err == nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			_, err := strconv.ParseUint(string(v), 10, t.Bits())
+			return err == nil
+		case reflect.Float32, reflect.Float64, reflect.Interface:
+			return true
+		}
+		return false
+	case []interface{}:
+		return (t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8) || t.Kind() == reflect.Array || t.Kind() == reflect.Interface
+	case map[string]interface{}:
+		return t.Kind() == reflect.Struct || t.Kind() == reflect.Map || t.Kind() == reflect.Interface
+	}
+	return false
+}
+
+// jsonTypeName describes the JSON values that can be decoded into
+// values of type t, such as "array of strings".
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		if elem := jsonTypeName(t.Elem()); elem != "any value" {
+			return "array of " + elem + "s"
+		}
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "any value"
+}
+
+func jsonValueTypeName(v interface{}) string {
+	switch v.(type) {
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "null"
+}
+
+// syntaxError records a JSON syntax error (returned by l.dec).
+func (l *linter) syntaxError(err error) {
+	switch err := err.(type) {
+	case *json.SyntaxError:
+		off := err.Offset - 1 // Offset is after the offending byte
+		if off < 0 {
+			off = 0
+		}
+		l.errorf(off, "", "invalid JSON: %s", err)
+	default:
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			l.errorf(int64(len(l.data)), "", "invalid JSON: unexpected end of file")
+			return
+		}
+		l.errorf(0, "", "invalid JSON: %s", err)
+	}
+}
+
+// tokenStart returns the offset of the start of the token after off
+// (which is the decoder's InputOffset before reading the token),
+// skipping whitespace and separators.
+func (l *linter) tokenStart(off int64) int64 {
+	for off < int64(len(l.data)) && strings.IndexByte(" \t\r\n,:", l.data[off]) != -1 {
+		off++
+	}
+	return off
+}
+
+func (l *linter) errorf(off int64, key, format string, args ...interface{}) {
+	if l.lineStarts == nil {
+		l.lineStarts = []int{0}
+		for i, b := range l.data {
+			if b == '\n' {
+				l.lineStarts = append(l.lineStarts, i+1)
+			}
+		}
+	}
+	line := sort.Search(len(l.lineStarts), func(i int) bool { return l.lineStarts[i] > int(off) })
+	l.errs = append(l.errs, &LintError{
+		Line:    line,
+		Col:     int(off) - l.lineStarts[line-1] + 1,
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
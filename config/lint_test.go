@@ -0,0 +1,126 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+)
+
+func TestLintRepository(t *testing.T) {
+	checkTool := func(ref *srclib.ToolRef) error {
+		if ref.Toolchain != "sourcegraph.com/sourcegraph/srclib-go" {
+			return errors.New("toolchain not found")
+		}
+		return nil
+	}
+
+	tests := map[string]struct {
+		data string
+		want []*LintError
+	}{
+		"valid": {
+			data: `{
+  "Scanners": [{"Toolchain": "sourcegraph.com/sourcegraph/srclib-go", "Subcmd": "scan"}],
+  "SourceUnits": [{"Name": "a", "Type": "t", "Files": ["a/*.go"]}],
+  "SkipPatterns": ["gen/"],
+  "Config": {"x": [1, {"y": null}]}
+}`,
+		},
+		"unknown key": {
+			data: `{
+  "Scaners": [],
+  "SourceUnits": [{"Name": "a", "Type": "t", "Fils": []}]
+}`,
+			want: []*LintError{
+				{Line: 2, Col: 3, Message: `unknown key "Scaners"`},
+				{Line: 3, Col: 46, Key: "SourceUnits[0]", Message: `unknown key "Fils"`},
+			},
+		},
+		"key case": {
+			data: `{"skipDirs": ["a"]}`,
+			want: []*LintError{{Line: 1, Col: 2, Message: `key "skipDirs" should be "SkipDirs"`}},
+		},
+		"type errors": {
+			data: `{
+  "SkipDirs": "a",
+  "NoDefaultSkipPatterns": 1,
+  "Gates": {"MaxCoverageDecrease": "0.1"},
+  "SourceUnits": [{"Name": 2, "Type": "t", "Files": [true]}]
+}`,
+			want: []*LintError{
+				{Line: 2, Col: 15, Key: "SkipDirs", Message: "expected array of strings, got string"},
+				{Line: 3, Col: 28, Key: "NoDefaultSkipPatterns", Message: "expected boolean, got number"},
+				{Line: 4, Col: 36, Key: "Gates.MaxCoverageDecrease", Message: "expected number, got string"},
+				{Line: 5, Col: 28, Key: "SourceUnits[0].Name", Message: "expected string, got number"},
+				{Line: 5, Col: 54, Key: "SourceUnits[0].Files[0]", Message: "expected string, got boolean"},
+			},
+		},
+		"bad globs": {
+			data: `{
+  "SourceUnits": [{"Name": "a", "Type": "t", "Files": ["a.go", "[b"]}],
+  "SkipPatterns": ["ok/", "x["],
+  "ArchRules": [{"Units": "web/**", "Deny": ["db/["]}]
+}`,
+			want: []*LintError{
+				{Line: 2, Col: 64, Key: "SourceUnits[0].Files[1]", Message: `bad glob "[b": syntax error in pattern`},
+				{Line: 3, Col: 27, Key: "SkipPatterns[1]", Message: `invalid skip pattern "x[": syntax error in pattern`},
+				{Line: 4, Col: 46, Key: "ArchRules[0].Deny[0]", Message: `bad pattern "db/[": syntax error in pattern`},
+			},
+		},
+		"unresolvable tool": {
+			data: `{"ScannerPriority": [{"Toolchain": "example.com/nope", "Subcmd": "scan"}]}`,
+			want: []*LintError{{Line: 1, Col: 22, Key: "ScannerPriority[0]", Message: "toolchain not found"}},
+		},
+		"syntax error": {
+			data: "{\n  \"SkipDirs\": [\"a\",]\n}",
+			want: []*LintError{{Line: 2, Col: 19, Message: "invalid JSON: invalid character ',' looking for beginning of value"}},
+		},
+		"unexpected end": {
+			data: `{"SkipDirs": [`,
+			want: []*LintError{{Line: 1, Col: 14, Message: "invalid JSON: unexpected end of JSON input"}},
+		},
+		"not an object": {
+			data: `[]`,
+			want: []*LintError{{Line: 1, Col: 1, Message: "expected object, got array"}},
+		},
+		"invalid config": {
+			data: `{"SourceUnits": [{"Name": "a", "Type": "t"}, {"Name": "a", "Type": "t"}]}`,
+			want: []*LintError{{Message: ErrInvalidSourceUnit.Error()}},
+		},
+	}
+	for label, test := range tests {
+		errs := LintRepository([]byte(test.data), checkTool)
+		if !reflect.DeepEqual(errs, test.want) {
+			t.Errorf("%s: got errors:", label)
+			for _, e := range errs {
+				t.Logf("  %+v", e)
+			}
+			t.Logf("want:")
+			for _, e := range test.want {
+				t.Logf("  %+v", e)
+			}
+		}
+	}
+}
+
+func TestLintTree(t *testing.T) {
+	errs := LintTree([]byte(`{"URI": "example.com/r"}`), nil)
+	want := []*LintError{{Line: 1, Col: 2, Message: `unknown key "URI"`}}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("got errors %v, want %v", errs, want)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	s := Schema()
+	props := s["properties"].(map[string]interface{})
+	if _, ok := props["URI"]; !ok {
+		t.Error("no URI property")
+	}
+	want := map[string]interface{}{"type": []interface{}{"array", "null"}, "items": map[string]interface{}{"type": "string"}}
+	if got := props["SkipDirs"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got SkipDirs schema %v, want %v", got, want)
+	}
+}
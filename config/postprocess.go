@@ -0,0 +1,41 @@
+package config
+
+import "sourcegraph.com/sourcegraph/srclib/unit"
+
+// PostProcessorsConfigKey is the source unit Config key that holds the
+// post-processors to run on the source unit's graph output: the tree's
+// PostProcessors, preceded (for the virtual sub-units of embedded
+// languages) by "regions". The graph step reads them from the source
+// unit because a unit can need post-processors that its tree doesn't.
+const PostProcessorsConfigKey = "PostProcessors"
+
+// ResolveVanityURIsConfigKey is the source unit Config key that is set
+// (to true) when the tree's ResolveVanityURIs is, so that the graph
+// step resolves the vanity URIs in the unit's graph output without
+// reading the Srcfile.
+const ResolveVanityURIsConfigKey = "ResolveVanityURIs"
+
+// UnitPostProcessors returns the post-processors stored in u's Config
+// (see PostProcessorsConfigKey). The Config may have been decoded from
+// JSON, so a list of any type whose elements are strings is accepted.
+func UnitPostProcessors(u *unit.SourceUnit) []string {
+	var ps []string
+	switch v := u.Config[PostProcessorsConfigKey].(type) {
+	case []string:
+		ps = v
+	case []interface{}:
+		for _, p := range v {
+			if s, ok := p.(string); ok {
+				ps = append(ps, s)
+			}
+		}
+	}
+	return ps
+}
+
+// UnitResolveVanityURIs returns whether u's Config enables resolving
+// vanity URIs (see ResolveVanityURIsConfigKey).
+func UnitResolveVanityURIs(u *unit.SourceUnit) bool {
+	v, _ := u.Config[ResolveVanityURIsConfigKey].(bool)
+	return v
+}
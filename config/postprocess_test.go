@@ -0,0 +1,53 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestUnitPostProcessors(t *testing.T) {
+	tests := map[string]struct {
+		config string // JSON
+		want   []string
+	}{
+		"none":       {`{}`, nil},
+		"list":       {`{"PostProcessors": ["regions", "exec:x"]}`, []string{"regions", "exec:x"}},
+		"non-string": {`{"PostProcessors": ["a", 1]}`, []string{"a"}},
+		"not a list": {`{"PostProcessors": "a"}`, nil},
+	}
+	for label, test := range tests {
+		u := &unit.SourceUnit{}
+		if err := json.Unmarshal([]byte(test.config), &u.Config); err != nil {
+			t.Fatal(err)
+		}
+		if got := UnitPostProcessors(u); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", label, got, test.want)
+		}
+	}
+
+	// Config set in Go (not decoded from JSON) holds a []string.
+	u := &unit.SourceUnit{Config: map[string]interface{}{PostProcessorsConfigKey: []string{"a"}}}
+	if got := UnitPostProcessors(u); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("[]string: got %q", got)
+	}
+}
+
+func TestUnitResolveVanityURIs(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		want   bool
+	}{
+		"unset":    {nil, false},
+		"true":     {map[string]interface{}{ResolveVanityURIsConfigKey: true}, true},
+		"false":    {map[string]interface{}{ResolveVanityURIsConfigKey: false}, false},
+		"non-bool": {map[string]interface{}{ResolveVanityURIsConfigKey: "true"}, false},
+	}
+	for label, test := range tests {
+		if got := UnitResolveVanityURIs(&unit.SourceUnit{Config: test.config}); got != test.want {
+			t.Errorf("%s: got %v, want %v", label, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Schema returns a JSON Schema (draft 7) for Srcfiles. It is derived
+// from the Repository type, so it describes the keys and value types
+// of a Srcfile but not the constraints that are only checked by
+// validation (such as well-formed glob patterns); see Lint for those.
+func Schema() map[string]interface{} {
+	s := typeSchema(reflect.TypeOf(Repository{}))
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	s["title"] = Filename
+	return s
+}
+
+// typeSchema returns the JSON Schema for the JSON encoding of values
+// of type t.
+func typeSchema(t reflect.Type) map[string]interface{} {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t, nullable = t.Elem(), true
+	}
+	if isJSONUnmarshaler(t) {
+		return map[string]interface{}{} // any value
+	}
+
+	var s map[string]interface{}
+	switch t.Kind() {
+	case reflect.Bool:
+		s = map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		s = map[string]interface{}{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s = map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		s = map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			s = map[string]interface{}{"type": "string"} // base64
+			break
+		}
+		s = map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+		nullable = nullable || t.Kind() == reflect.Slice
+	case reflect.Map:
+		s = map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+		nullable = true
+	case reflect.Struct:
+		props := map[string]interface{}{}
+		for _, f := range jsonFields(t) {
+			props[f.name] = typeSchema(f.Type)
+		}
+		s = map[string]interface{}{"type": "object", "properties": props, "additionalProperties": false}
+	default:
+		return map[string]interface{}{} // interface{} (any value)
+	}
+	if nullable {
+		s["type"] = []interface{}{s["type"], "null"}
+	}
+	return s
+}
+
+// A jsonField is a struct field that is encoded as a JSON object key.
+type jsonField struct {
+	reflect.StructField
+	name  string       // JSON object key
+	owner reflect.Type // struct type that declares the field
+}
+
+// jsonFields returns the fields of struct type t that are encoded in
+// its JSON representation, including the fields of embedded structs
+// (like encoding/json).
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := tag
+		if i := strings.IndexByte(tag, ','); i != -1 {
+			name = tag[:i]
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(f.Type)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, jsonField{StructField: f, name: name, owner: t})
+	}
+	return fields
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// isJSONUnmarshaler returns whether values of type t decode
+// themselves from JSON (so their JSON representation can't be derived
+// from t).
+func isJSONUnmarshaler(t reflect.Type) bool {
+	return t.Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(jsonUnmarshalerType)
+}
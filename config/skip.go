@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSkipPatterns are the skip patterns (see Tree.SkipPatterns)
+// for vendored dependencies and generated files, which are skipped
+// unless the tree sets NoDefaultSkipPatterns or overrides them. They
+// are usually the bulk of a repository's code, and graphing them is
+// slow and produces defs that belong to other repositories.
+var DefaultSkipPatterns = []string{
+	"vendor/",
+	"node_modules/",
+	"bower_components/",
+	"Godeps/_workspace/",
+	"*.pb.go",
+	"*_pb2.py",
+	"*.min.js",
+	"*-min.js",
+	"*.bundle.js",
+}
+
+// EffectiveSkipPatterns returns the skip patterns that apply to the
+// tree: the DefaultSkipPatterns (unless NoDefaultSkipPatterns is set)
+// followed by the tree's SkipPatterns.
+func (c *Tree) EffectiveSkipPatterns() []string {
+	var patterns []string
+	if !c.NoDefaultSkipPatterns {
+		patterns = append(patterns, DefaultSkipPatterns...)
+	}
+	return append(patterns, c.SkipPatterns...)
+}
+
+// MatchSkipPatterns reports whether the file at path p (relative to
+// the tree root) is skipped by patterns, and if so, which pattern
+// skipped it. If isDir is true, p is a directory, and it is skipped
+// if it or any of its parent dirs is.
+//
+// Patterns are matched in order, and the last matching pattern
+// determines whether p is skipped. A pattern is one of:
+//
+//   - "DIR/", which matches a directory named DIR (at any depth),
+//     or if DIR contains a slash, the directory DIR relative to the
+//     tree root, and everything inside it;
+//   - a glob (see path.Match) without a slash, such as "*.min.js",
+//     which matches file names (at any depth);
+//   - a glob with a slash, such as "gen/*.go", which matches file
+//     paths relative to the tree root.
+//
+// A pattern prefixed with "!" (such as "!vendor/") un-skips the paths
+// it matches.
+func MatchSkipPatterns(patterns []string, p string, isDir bool) (pattern string, skip bool) {
+	p = path.Clean(filepath.ToSlash(p))
+	if p == "." {
+		return "", false
+	}
+	for _, pat := range patterns {
+		negate := strings.HasPrefix(pat, "!")
+		if matchSkipPattern(strings.TrimPrefix(pat, "!"), p, isDir) {
+			pattern, skip = pat, !negate
+		}
+	}
+	if !skip {
+		pattern = ""
+	}
+	return pattern, skip
+}
+
+func matchSkipPattern(pat, p string, isDir bool) bool {
+	dirs := strings.Split(p, "/")
+	if !isDir {
+		dirs = dirs[:len(dirs)-1]
+	}
+
+	if strings.HasSuffix(pat, "/") {
+		pat = strings.TrimSuffix(pat, "/")
+		if strings.Contains(pat, "/") {
+			for i := range dirs {
+				if ok, _ := path.Match(pat, strings.Join(dirs[:i+1], "/")); ok {
+					return true
+				}
+			}
+			return false
+		}
+		for _, dir := range dirs {
+			if ok, _ := path.Match(pat, dir); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	if isDir {
+		return false
+	}
+	if strings.Contains(pat, "/") {
+		ok, _ := path.Match(pat, p)
+		return ok
+	}
+	ok, _ := path.Match(pat, path.Base(p))
+	return ok
+}
+
+// validateSkipPattern returns an error if pat is not a valid skip
+// pattern.
+func validateSkipPattern(pat string) error {
+	glob := strings.TrimSuffix(strings.TrimPrefix(pat, "!"), "/")
+	if glob == "" || path.IsAbs(glob) {
+		return fmt.Errorf("invalid skip pattern %q", pat)
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return fmt.Errorf("invalid skip pattern %q: %s", pat, err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import "testing"
+
+func TestMatchSkipPatterns(t *testing.T) {
+	tests := []struct {
+		patterns    []string
+		path        string
+		isDir       bool
+		wantPattern string
+	}{
+		{DefaultSkipPatterns, "vendor", true, "vendor/"},
+		{DefaultSkipPatterns, "vendor/github.com/a/b", true, "vendor/"},
+		{DefaultSkipPatterns, "a/vendor/b/c.go", false, "vendor/"},
+		{DefaultSkipPatterns, "vendors/c.go", false, ""},
+		{DefaultSkipPatterns, "web/node_modules/x/index.js", false, "node_modules/"},
+		{DefaultSkipPatterns, "Godeps/_workspace/src/a", true, "Godeps/_workspace/"},
+		{DefaultSkipPatterns, "a/Godeps/_workspace/src", true, ""},
+		{DefaultSkipPatterns, "foo/foo.pb.go", false, "*.pb.go"},
+		{DefaultSkipPatterns, "foo/foo.pb.go", true, ""},
+		{DefaultSkipPatterns, "static/jquery.min.js", false, "*.min.js"},
+		{DefaultSkipPatterns, "static/app.js", false, ""},
+		{DefaultSkipPatterns, ".", true, ""},
+		{[]string{"gen/*.go"}, "gen/a.go", false, "gen/*.go"},
+		{[]string{"gen/*.go"}, "x/gen/a.go", false, ""},
+		{[]string{"a/b/"}, "a/b/c/d.go", false, "a/b/"},
+		{[]string{"vendor/", "!vendor/"}, "vendor/a.go", false, ""},
+		{[]string{"vendor/", "!vendor/", "*.go"}, "vendor/a.go", false, "*.go"},
+		{[]string{"*.go", "!keep.go"}, "x/keep.go", false, ""},
+	}
+	for _, test := range tests {
+		pat, skip := MatchSkipPatterns(test.patterns, test.path, test.isDir)
+		if pat != test.wantPattern || skip != (test.wantPattern != "") {
+			t.Errorf("%v %q (dir %v): got %q, %v, want %q", test.patterns, test.path, test.isDir, pat, skip, test.wantPattern)
+		}
+	}
+}
+
+func TestTree_EffectiveSkipPatterns(t *testing.T) {
+	c := &Tree{SkipPatterns: []string{"gen/"}}
+	if got := c.EffectiveSkipPatterns(); len(got) != len(DefaultSkipPatterns)+1 || got[len(got)-1] != "gen/" {
+		t.Errorf("got %q, want the defaults followed by gen/", got)
+	}
+	c.NoDefaultSkipPatterns = true
+	if got := c.EffectiveSkipPatterns(); len(got) != 1 || got[0] != "gen/" {
+		t.Errorf("with NoDefaultSkipPatterns: got %q, want [gen/]", got)
+	}
+}
+
+func TestValidateSkipPattern(t *testing.T) {
+	for _, pat := range []string{"", "!", "/", "/abs/", "[", "a/[/"} {
+		if err := validateSkipPattern(pat); err == nil {
+			t.Errorf("%q: got no error", pat)
+		}
+	}
+	for _, pat := range append([]string{"!vendor/", "gen/*.go"}, DefaultSkipPatterns...) {
+		if err := validateSkipPattern(pat); err != nil {
+			t.Errorf("%q: %s", pat, err)
+		}
+	}
+}
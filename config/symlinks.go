@@ -0,0 +1,132 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// A SymlinkPolicy determines how symlinked files and directories in a
+// tree are treated when scanning for source unit files and when
+// reading files to post-process grapher output.
+type SymlinkPolicy string
+
+const (
+	// SymlinkFollow follows symlinks whose targets are inside the tree
+	// root directory and skips (with a warning) symlinks whose targets
+	// are outside of it. It is the default policy.
+	SymlinkFollow SymlinkPolicy = "follow"
+
+	// SymlinkIgnore skips all symlinks.
+	SymlinkIgnore SymlinkPolicy = "ignore"
+
+	// SymlinkError causes processing to fail if a symlink is
+	// encountered.
+	SymlinkError SymlinkPolicy = "error"
+)
+
+// SymlinkPolicyConfigKey is the source unit Config key that the tree's
+// SymlinkPolicy is copied to, so that it is available to build steps
+// that only have the source unit (not the Srcfile).
+const SymlinkPolicyConfigKey = "SymlinkPolicy"
+
+// ErrInvalidSymlinkPolicy indicates that an unrecognized SymlinkPolicy
+// was specified in the config.
+var ErrInvalidSymlinkPolicy = fmt.Errorf("invalid SymlinkPolicy specified in config (must be one of %q, %q, or %q)", SymlinkFollow, SymlinkIgnore, SymlinkError)
+
+// Valid returns whether p is a known policy or empty (which means
+// SymlinkFollow).
+func (p SymlinkPolicy) Valid() bool {
+	switch p {
+	case "", SymlinkFollow, SymlinkIgnore, SymlinkError:
+		return true
+	}
+	return false
+}
+
+// UnitSymlinkPolicy returns the SymlinkPolicy stored in u's Config
+// (see SymlinkPolicyConfigKey), or the empty policy if none is set.
+func UnitSymlinkPolicy(u *unit.SourceUnit) SymlinkPolicy {
+	if s, ok := u.Config[SymlinkPolicyConfigKey].(string); ok {
+		return SymlinkPolicy(s)
+	}
+	return ""
+}
+
+// CheckSymlink checks whether the file at path (which is relative to the
+// tree root dir) may be read under policy p. It returns false if the
+// file should be skipped, and an error if the file is a symlink and p
+// is SymlinkError. Nonexistent files are not skipped; callers should
+// handle them as usual.
+func (p SymlinkPolicy) CheckSymlink(root, path string) (ok bool, err error) {
+	abs := filepath.Join(root, path)
+
+	// Check each path component, since any symlinked parent dir
+	// could also point outside of the tree.
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return false, err
+	}
+	isSymlink := false
+	cur := root
+	for _, c := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, c)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return true, nil
+		} else if err != nil {
+			return false, err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			isSymlink = true
+			break
+		}
+	}
+	if !isSymlink {
+		return true, nil
+	}
+
+	switch p {
+	case SymlinkIgnore:
+		return false, nil
+	case SymlinkError:
+		return false, fmt.Errorf("path %s is (or is in) a symlink (SymlinkPolicy is %q)", path, p)
+	}
+
+	// Follow symlinks, but only within the tree.
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return false, err
+	}
+	target, err := filepath.EvalSymlinks(abs)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	if rel, err := filepath.Rel(realRoot, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		logutil.Default.Warn("Skipping symlink whose target is outside of the tree.", "file", path, "target", target)
+		return false, nil
+	}
+	return true, nil
+}
+
+// FilterSymlinks returns the files (relative to the tree root dir) that
+// may be read under policy p (see CheckSymlink).
+func (p SymlinkPolicy) FilterSymlinks(root string, files []string) ([]string, error) {
+	var keep []string
+	for _, f := range files {
+		ok, err := p.CheckSymlink(root, f)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			keep = append(keep, f)
+		}
+	}
+	return keep, nil
+}
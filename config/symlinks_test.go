@@ -0,0 +1,70 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSymlinkPolicy_FilterSymlinks(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "srclib-symlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	root := filepath.Join(tmp, "root")
+	outside := filepath.Join(tmp, "outside")
+	for _, dir := range []string{root, outside, filepath.Join(root, "d")} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(root, "d", "a"), filepath.Join(outside, "b")} {
+		if err := ioutil.WriteFile(file, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlinks := map[string]string{
+		"in":     filepath.Join(root, "d", "a"),
+		"out":    filepath.Join(outside, "b"),
+		"outdir": outside,
+	}
+	for name, target := range symlinks {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip("symlinks not supported:", err)
+		}
+	}
+
+	files := []string{"d/a", "in", "out", "outdir/b", "nonexistent"}
+	tests := map[SymlinkPolicy][]string{
+		"":            {"d/a", "in", "nonexistent"},
+		SymlinkFollow: {"d/a", "in", "nonexistent"},
+		SymlinkIgnore: {"d/a", "nonexistent"},
+	}
+	for policy, want := range tests {
+		got, err := policy.FilterSymlinks(root, files)
+		if err != nil {
+			t.Errorf("policy %q: %s", policy, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("policy %q: got files %v, want %v", policy, got, want)
+		}
+	}
+
+	if _, err := SymlinkError.FilterSymlinks(root, files); err == nil {
+		t.Errorf("policy %q: got nil error, want error", SymlinkError)
+	}
+	if _, err := SymlinkError.FilterSymlinks(root, []string{"d/a"}); err != nil {
+		t.Errorf("policy %q: no symlinks: %s", SymlinkError, err)
+	}
+}
+
+func TestTree_validate_symlinkPolicy(t *testing.T) {
+	if err := (&Tree{SymlinkPolicy: "bad"}).validate(); err != ErrInvalidSymlinkPolicy {
+		t.Errorf("got err %v, want ErrInvalidSymlinkPolicy", err)
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"path"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// A UnitConfig sets Config properties (such as a language version or
+// target platform) on the source units that it matches. The properties
+// are passed to tools in the source unit's Config.
+type UnitConfig struct {
+	// Type is the type of source units to match. If empty, source units
+	// of all types are matched.
+	Type string `json:",omitempty"`
+
+	// Name is a pattern (in path.Match syntax) that matches the names of
+	// source units to match. If empty, source units with any name are
+	// matched.
+	Name string `json:",omitempty"`
+
+	// Dir is a pattern (in path.Match syntax) that matches the Dir of
+	// source units to match. If empty, source units in any dir are
+	// matched.
+	Dir string `json:",omitempty"`
+
+	// Config is the properties to set on matching source units' Config.
+	Config map[string]interface{} `json:",omitempty"`
+
+	// Variants are additional build configurations under which to graph
+	// matching source units (see unit.Variant).
+	Variants []*unit.Variant `json:",omitempty"`
+}
+
+// ErrInvalidUnitConfig indicates that a UnitConfig in the config has a
+// malformed Name or Dir pattern, or a variant with an invalid or
+// duplicate name.
+var ErrInvalidUnitConfig = errors.New("invalid UnitConfigs entry specified in config (malformed Name or Dir pattern, or invalid or duplicate variant name)")
+
+func (c *UnitConfig) validate() error {
+	for _, pat := range []string{c.Name, c.Dir} {
+		if _, err := path.Match(pat, ""); err != nil {
+			return ErrInvalidUnitConfig
+		}
+	}
+	seen := make(map[string]bool, len(c.Variants))
+	for _, v := range c.Variants {
+		if v.Name == "" || strings.ContainsAny(v.Name, unit.VariantSep+"/ ") || seen[v.Name] {
+			return ErrInvalidUnitConfig
+		}
+		seen[v.Name] = true
+	}
+	return nil
+}
+
+// Matches returns whether c applies to u.
+func (c *UnitConfig) Matches(u *unit.SourceUnit) bool {
+	if c.Type != "" && c.Type != u.Type {
+		return false
+	}
+	if c.Name != "" {
+		if ok, _ := path.Match(c.Name, u.Name); !ok {
+			return false
+		}
+	}
+	if c.Dir != "" {
+		if ok, _ := path.Match(c.Dir, path.Clean(u.Dir)); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplyUnitConfigs sets the Config properties and adds the Variants of
+// each UnitConfig in cs that matches u on u, overwriting existing
+// properties and variants with the same name. If multiple UnitConfigs
+// set the same property or variant, the last one wins.
+func ApplyUnitConfigs(cs []*UnitConfig, u *unit.SourceUnit) {
+	for _, c := range cs {
+		if !c.Matches(u) {
+			continue
+		}
+		for k, v := range c.Config {
+			if u.Config == nil {
+				u.Config = map[string]interface{}{}
+			}
+			u.Config[k] = v
+		}
+	variants:
+		for _, v := range c.Variants {
+			for i, uv := range u.Variants {
+				if uv.Name == v.Name {
+					u.Variants[i] = v
+					continue variants
+				}
+			}
+			u.Variants = append(u.Variants, v)
+		}
+	}
+}
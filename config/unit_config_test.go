@@ -0,0 +1,63 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestApplyUnitConfigs(t *testing.T) {
+	cs := []*UnitConfig{
+		{Config: map[string]interface{}{"a": "all"}},
+		{Type: "GoPackage", Config: map[string]interface{}{"GOOS": "linux"}},
+		{Type: "GoPackage", Name: "cmd/*", Config: map[string]interface{}{"GOOS": "windows"}},
+		{Dir: "py/*", Config: map[string]interface{}{"PythonVersion": "3"}},
+		{Type: "GoPackage", Variants: []*unit.Variant{{Name: "windows", Config: map[string]interface{}{"GOOS": "windows"}}}},
+	}
+
+	tests := []struct {
+		u            *unit.SourceUnit
+		wantConfig   map[string]interface{}
+		wantVariants int
+	}{
+		{
+			u:            &unit.SourceUnit{Type: "GoPackage", Name: "lib"},
+			wantConfig:   map[string]interface{}{"a": "all", "GOOS": "linux"},
+			wantVariants: 1,
+		},
+		{
+			u:            &unit.SourceUnit{Type: "GoPackage", Name: "cmd/x", Config: map[string]interface{}{"GOOS": "darwin", "b": "c"}},
+			wantConfig:   map[string]interface{}{"a": "all", "GOOS": "windows", "b": "c"},
+			wantVariants: 1,
+		},
+		{
+			u:          &unit.SourceUnit{Type: "PipPackage", Name: "p", Dir: "py/p/"},
+			wantConfig: map[string]interface{}{"a": "all", "PythonVersion": "3"},
+		},
+	}
+	for _, test := range tests {
+		ApplyUnitConfigs(cs, test.u)
+		if !reflect.DeepEqual(test.u.Config, test.wantConfig) {
+			t.Errorf("%s: got Config %v, want %v", test.u.ID2(), test.u.Config, test.wantConfig)
+		}
+		if len(test.u.Variants) != test.wantVariants {
+			t.Errorf("%s: got %d Variants, want %d", test.u.ID2(), len(test.u.Variants), test.wantVariants)
+		}
+	}
+}
+
+func TestTree_validate_unitConfigs(t *testing.T) {
+	tests := map[string]*UnitConfig{
+		"bad pattern":       {Name: "[", Config: map[string]interface{}{"a": "b"}},
+		"no variant name":   {Variants: []*unit.Variant{{}}},
+		"bad variant name":  {Variants: []*unit.Variant{{Name: "a~b"}}},
+		"duplicate variant": {Variants: []*unit.Variant{{Name: "a"}, {Name: "a"}}},
+	}
+	for label, uc := range tests {
+		tree := &Tree{UnitConfigs: []*UnitConfig{uc}}
+		if err := tree.validate(); err != ErrInvalidUnitConfig {
+			t.Errorf("%s: got err %v, want ErrInvalidUnitConfig", label, err)
+		}
+	}
+}
@@ -4,25 +4,77 @@ import (
 	"errors"
 	"path/filepath"
 	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
 var (
 	// ErrInvalidFilePath indicates that a file path outside of the tree or
 	// repository root directory was specified in the config.
 	ErrInvalidFilePath = errors.New("invalid file path specified in config (above config root dir or source unit dir)")
+
+	// ErrInvalidSourceUnit indicates that a source unit specified in the
+	// config has no Name or Type, or has the same Name and Type as
+	// another source unit specified in the config.
+	ErrInvalidSourceUnit = errors.New("invalid source unit specified in config (Name and Type are required and must be unique)")
+
+	// ErrInvalidURIRule indicates that a URI rule specified in the
+	// config has no From or To.
+	ErrInvalidURIRule = errors.New("invalid URI rule specified in config (From and To are required)")
 )
 
 func (c *Tree) validate() error {
+	if !c.SymlinkPolicy.Valid() {
+		return ErrInvalidSymlinkPolicy
+	}
 	for _, u := range c.SourceUnits {
 		for _, p := range u.Files {
-			p = filepath.Clean(p)
-			if filepath.IsAbs(p) {
-				return ErrInvalidFilePath
-			}
-			if p == ".." || strings.HasPrefix(p, "../") {
+			if !validPath(p) {
 				return ErrInvalidFilePath
 			}
 		}
+		if u.Dir != "" && !validPath(u.Dir) {
+			return ErrInvalidFilePath
+		}
+	}
+	for _, uc := range c.UnitConfigs {
+		if err := uc.validate(); err != nil {
+			return err
+		}
+	}
+	for _, r := range c.ArchRules {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Gates != nil {
+		if err := c.Gates.validate(); err != nil {
+			return err
+		}
+	}
+	for _, pat := range c.SkipPatterns {
+		if err := validateSkipPattern(pat); err != nil {
+			return err
+		}
+	}
+	for _, r := range c.URIRules {
+		if r.From == "" || r.To == "" {
+			return ErrInvalidURIRule
+		}
+	}
+	seen := make(map[unit.ID2]bool, len(c.SourceUnits))
+	for _, u := range c.SourceUnits {
+		if u.Name == "" || u.Type == "" || seen[u.ID2()] {
+			return ErrInvalidSourceUnit
+		}
+		seen[u.ID2()] = true
 	}
 	return nil
 }
+
+// validPath returns whether p is a relative path that is not above the
+// config root dir.
+func validPath(p string) bool {
+	p = filepath.Clean(p)
+	return !filepath.IsAbs(p) && p != ".." && !strings.HasPrefix(p, "../")
+}
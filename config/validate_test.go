@@ -3,6 +3,7 @@ package config
 import (
 	"testing"
 
+	"sourcegraph.com/sourcegraph/srclib/graph"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
@@ -11,6 +12,7 @@ func TestTree_validate(t *testing.T) {
 		"absolute path":                &Tree{SourceUnits: []*unit.SourceUnit{{Files: []string{"/foo"}}}},
 		"relative path above root":     &Tree{SourceUnits: []*unit.SourceUnit{{Files: []string{"../foo"}}}},
 		"bad path after being cleaned": &Tree{SourceUnits: []*unit.SourceUnit{{Files: []string{"foo/bar/../../../../baz"}}}},
+		"dir above root":               &Tree{SourceUnits: []*unit.SourceUnit{{Name: "n", Type: "t", Dir: "../foo"}}},
 	}
 
 	for label, tree := range tests {
@@ -19,3 +21,53 @@ func TestTree_validate(t *testing.T) {
 		}
 	}
 }
+
+func TestTree_validate_sourceUnits(t *testing.T) {
+	tests := map[string]*Tree{
+		"no name":      &Tree{SourceUnits: []*unit.SourceUnit{{Type: "t"}}},
+		"no type":      &Tree{SourceUnits: []*unit.SourceUnit{{Name: "n"}}},
+		"duplicate ID": &Tree{SourceUnits: []*unit.SourceUnit{{Name: "n", Type: "t"}, {Name: "n", Type: "t", Files: []string{"f"}}}},
+	}
+
+	for label, tree := range tests {
+		if err := tree.validate(); err != ErrInvalidSourceUnit {
+			t.Errorf("%s: got err %v, want ErrInvalidSourceUnit", label, err)
+		}
+	}
+
+	valid := &Tree{SourceUnits: []*unit.SourceUnit{{Name: "n", Type: "t", Dir: "d", Files: []string{"d/f"}}, {Name: "n", Type: "t2"}}}
+	if err := valid.validate(); err != nil {
+		t.Errorf("valid source units: got err %v, want nil", err)
+	}
+}
+
+func TestTree_validate_uriRules(t *testing.T) {
+	tests := map[string]*Tree{
+		"no From": &Tree{URIRules: []graph.URIRule{{To: "github.com/a/b"}}},
+		"no To":   &Tree{URIRules: []graph.URIRule{{From: "github.com/a/b"}}},
+	}
+
+	for label, tree := range tests {
+		if err := tree.validate(); err != ErrInvalidURIRule {
+			t.Errorf("%s: got err %v, want ErrInvalidURIRule", label, err)
+		}
+	}
+}
+
+func TestTree_validate_gates(t *testing.T) {
+	tests := map[string]*Tree{
+		"negative MaxCoverageDecrease": &Tree{Gates: &Gates{MaxCoverageDecrease: -0.1}},
+		"MaxCoverageDecrease above 1":  &Tree{Gates: &Gates{MaxCoverageDecrease: 2}},
+	}
+
+	for label, tree := range tests {
+		if err := tree.validate(); err != ErrInvalidGates {
+			t.Errorf("%s: got err %v, want ErrInvalidGates", label, err)
+		}
+	}
+
+	valid := &Tree{Gates: &Gates{NoArch: true, MaxCoverageDecrease: 0.01}}
+	if err := valid.validate(); err != nil {
+		t.Errorf("valid gates: got err %v, want nil", err)
+	}
+}
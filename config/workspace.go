@@ -0,0 +1,96 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WorkspaceFilename is the conventional name of a workspace
+// configuration file (see Workspace).
+var WorkspaceFilename = "Srcworkspace"
+
+// A Workspace configuration file, represented by this struct, lists
+// local checkouts of related repositories that `src make --workspace`
+// builds together into one multi-repository store, so that refs from
+// one of the repositories to defs in another are resolved among them.
+type Workspace struct {
+	// Repos are the repositories in the workspace.
+	Repos []*WorkspaceRepo
+
+	// Store is the root dir of the multi-repository store that the
+	// repositories' build data is imported into (default:
+	// ".srclib-store" in the workspace file's dir).
+	Store string `json:",omitempty"`
+}
+
+// A WorkspaceRepo is a local checkout of a repository in a Workspace.
+type WorkspaceRepo struct {
+	// Dir is the dir of the checkout.
+	Dir string
+
+	// URI is the repository's URI (default: the URI of the checkout's
+	// clone URL).
+	URI string `json:",omitempty"`
+
+	// Aliases are other URIs that refs to defs in the repository may
+	// have as their DefRepo (e.g., the URI of the upstream repository
+	// that the checkout is a fork of, when other repositories depend
+	// on the upstream repository). Refs to them are resolved to the
+	// workspace's checkout.
+	Aliases []string `json:",omitempty"`
+}
+
+// ReadWorkspace reads and validates the workspace configuration file.
+// The dirs in the returned Workspace are absolute; relative dirs in
+// the file are relative to the file's dir.
+func ReadWorkspace(file string) (*Workspace, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var w Workspace
+	if err := json.NewDecoder(f).Decode(&w); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	base, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return nil, err
+	}
+	if err := w.finish(base); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return &w, nil
+}
+
+// finish validates w and makes its dirs absolute (relative to base).
+func (w *Workspace) finish(base string) error {
+	if len(w.Repos) == 0 {
+		return fmt.Errorf("workspace has no Repos")
+	}
+	abs := func(dir string) string {
+		if filepath.IsAbs(dir) {
+			return filepath.Clean(dir)
+		}
+		return filepath.Join(base, filepath.FromSlash(dir))
+	}
+	if w.Store == "" {
+		w.Store = ".srclib-store"
+	}
+	w.Store = abs(w.Store)
+
+	dirs := make(map[string]bool, len(w.Repos))
+	for i, r := range w.Repos {
+		if r.Dir == "" {
+			return fmt.Errorf("Repos[%d] has no Dir", i)
+		}
+		r.Dir = abs(r.Dir)
+		if dirs[r.Dir] {
+			return fmt.Errorf("Repos[%d]: dir %s is listed more than once", i, r.Dir)
+		}
+		dirs[r.Dir] = true
+	}
+	return nil
+}
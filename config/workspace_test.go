@@ -0,0 +1,62 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadWorkspace(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "srclib-workspace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	tests := map[string]struct {
+		data    string
+		want    *Workspace
+		wantErr bool
+	}{
+		"relative dirs": {
+			data: `{"Repos": [{"Dir": "a"}, {"Dir": "../b", "URI": "example.com/b", "Aliases": ["github.com/x/b"]}]}`,
+			want: &Workspace{
+				Repos: []*WorkspaceRepo{
+					{Dir: filepath.Join(tmp, "a")},
+					{Dir: filepath.Join(filepath.Dir(tmp), "b"), URI: "example.com/b", Aliases: []string{"github.com/x/b"}},
+				},
+				Store: filepath.Join(tmp, ".srclib-store"),
+			},
+		},
+		"store": {
+			data: `{"Repos": [{"Dir": "/a"}], "Store": "s"}`,
+			want: &Workspace{Repos: []*WorkspaceRepo{{Dir: "/a"}}, Store: filepath.Join(tmp, "s")},
+		},
+		"no repos":      {data: `{}`, wantErr: true},
+		"no dir":        {data: `{"Repos": [{"URI": "example.com/a"}]}`, wantErr: true},
+		"duplicate dir": {data: `{"Repos": [{"Dir": "a"}, {"Dir": "./a/"}]}`, wantErr: true},
+		"invalid JSON":  {data: `{"Repos": [`, wantErr: true},
+	}
+	for label, test := range tests {
+		file := filepath.Join(tmp, WorkspaceFilename)
+		if err := ioutil.WriteFile(file, []byte(test.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		w, err := ReadWorkspace(file)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: got no error, want error", label)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if !reflect.DeepEqual(w, test.want) {
+			t.Errorf("%s: got %+v, want %+v", label, w, test.want)
+		}
+	}
+}
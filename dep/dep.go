@@ -34,4 +34,8 @@ type ResolvedDep struct {
 	// ToRevSpec specifies the desired VCS revision of the dependent repository
 	// (if known).
 	ToRevSpec string 
+
+	// ToLicense is the license of the source unit that is depended on (if
+	// known), as an SPDX license expression.
+	ToLicense string `json:",omitempty"`
 }
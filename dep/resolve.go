@@ -33,6 +33,11 @@ type ResolvedTarget struct {
 	// ToRevSpec specifies the desired VCS revision of the dependent repository
 	// (if known).
 	ToRevSpec string
+
+	// ToLicense is the license of the source unit that is depended on (if
+	// known), as an SPDX license expression. Resolvers typically read it
+	// from the dependency's manifest or package registry metadata.
+	ToLicense string `json:",omitempty"`
 }
 
 // END ResolvedTarget OMIT
@@ -106,6 +111,7 @@ func ResolutionsToResolvedDeps(ress []*Resolution, unit *unit.SourceUnit, fromRe
 				ToUnitType:      or(rt.ToUnitType, unit.Type),
 				ToVersionString: rt.ToVersionString,
 				ToRevSpec:       rt.ToRevSpec,
+				ToLicense:       rt.ToLicense,
 			}
 			resolved = append(resolved, rd)
 		}
@@ -55,8 +55,10 @@ func (r *ResolveDepsRule) Prereqs() []string {
 
 func (r *ResolveDepsRule) Recipes() []string {
 	return []string{
-		fmt.Sprintf("src tool %s %q %q < $^ 1> $@", r.opt.ToolchainExecOpt, r.Tool.Toolchain, r.Tool.Subcmd),
+		fmt.Sprintf("src tool %s %q %q < $^ | src internal canonicalize-json 1> $@", r.opt.ToolchainExecOpt, r.Tool.Toolchain, r.Tool.Subcmd),
 	}
 }
 
 func (r *ResolveDepsRule) SourceUnit() *unit.SourceUnit { return r.Unit }
+
+func (r *ResolveDepsRule) Op() string { return depresolveOp }
@@ -0,0 +1,238 @@
+package doc
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A Heading is a section heading in a documentation file.
+type Heading struct {
+	Text  string
+	Level int // 1 for top-level headings
+
+	// Anchor is the heading's URL fragment (as generated by GitHub),
+	// which is unique within the file.
+	Anchor string
+
+	// Start and End are the byte offsets of the heading text.
+	Start, End int
+}
+
+// A Mention is a code span (or, in reStructuredText, an inline
+// literal or interpreted text) in a documentation file whose text is
+// a possibly qualified identifier, such as Open, os.Open(), or
+// Foo::bar. Mentions are likely references to defs in code.
+type Mention struct {
+	// Qualifiers are the components of the identifier that precede
+	// Name (e.g., ["os"] for `os.Open`).
+	Qualifiers []string
+
+	Name string
+
+	// Start and End are the byte offsets of Name.
+	Start, End int
+}
+
+var (
+	mdATXHeadingPattern = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)[ \t]*#*[ \t]*$`)
+	mdCodeSpanPattern   = regexp.MustCompile("`([^`\n]+)`")
+	rstCodeSpanPattern  = regexp.MustCompile("``([^`\n]+)``|:[\\w:]+:`([^`\n]+)`")
+
+	mentionPattern   = regexp.MustCompile(`^[A-Za-z_$][\w$]*(?:(?:\.|::|#|->)[A-Za-z_$][\w$]*)*(?:\(\))?$`)
+	mentionSeparator = regexp.MustCompile(`\.|::|#|->`)
+)
+
+// Index returns the headings and mentions in the Markdown or
+// reStructuredText (depending on Format(filename)) documentation file
+// data. Other files have no headings or mentions. Fenced and literal
+// code blocks are skipped.
+func Index(filename string, data []byte) ([]*Heading, []*Mention) {
+	var headings []*Heading
+	var mentions []*Mention
+	switch Format(filename) {
+	case Markdown:
+		headings, mentions = indexMarkdown(data)
+	case ReStructuredText:
+		headings, mentions = indexRST(data)
+	default:
+		return nil, nil
+	}
+
+	anchors := map[string]int{}
+	for _, h := range headings {
+		a := anchor(h.Text)
+		if n := anchors[a]; n > 0 {
+			h.Anchor = a + "-" + strconv.Itoa(n)
+		} else {
+			h.Anchor = a
+		}
+		anchors[a]++
+	}
+	return headings, mentions
+}
+
+// A line is a line of a file (without its trailing newline) and its
+// offset.
+type line struct {
+	text  []byte
+	start int
+}
+
+func splitLines(data []byte) []line {
+	var lines []line
+	for start := 0; start < len(data); {
+		end := bytes.IndexByte(data[start:], '\n')
+		if end == -1 {
+			end = len(data)
+		} else {
+			end += start
+		}
+		lines = append(lines, line{bytes.TrimSuffix(data[start:end], []byte("\r")), start})
+		start = end + 1
+	}
+	return lines
+}
+
+// trimmedSpan returns the span of l's text without leading and
+// trailing whitespace.
+func (l line) trimmedSpan() (int, int) {
+	text := l.text
+	start := len(text) - len(bytes.TrimLeftFunc(text, unicode.IsSpace))
+	end := len(bytes.TrimRightFunc(text, unicode.IsSpace))
+	if end < start {
+		end = start
+	}
+	return l.start + start, l.start + end
+}
+
+func isUnderline(text []byte, chars string) bool {
+	text = bytes.TrimSpace(text)
+	if len(text) == 0 || !strings.ContainsRune(chars, rune(text[0])) {
+		return false
+	}
+	for _, c := range text {
+		if c != text[0] {
+			return false
+		}
+	}
+	return true
+}
+
+func indexMarkdown(data []byte) (headings []*Heading, mentions []*Mention) {
+	lines := splitLines(data)
+	var fence []byte // the open code fence, if any
+	for i, l := range lines {
+		trimmed := bytes.TrimSpace(l.text)
+		if fence != nil {
+			if bytes.HasPrefix(trimmed, fence) {
+				fence = nil
+			}
+			continue
+		}
+		if bytes.HasPrefix(trimmed, []byte("```")) || bytes.HasPrefix(trimmed, []byte("~~~")) {
+			fence = trimmed[:3]
+			continue
+		}
+
+		if m := mdATXHeadingPattern.FindSubmatchIndex(l.text); m != nil {
+			if m[4] < m[5] {
+				headings = append(headings, &Heading{
+					Text:  string(l.text[m[4]:m[5]]),
+					Level: m[3] - m[2],
+					Start: l.start + m[4],
+					End:   l.start + m[5],
+				})
+			}
+		} else if len(trimmed) > 0 && i+1 < len(lines) && isUnderline(lines[i+1].text, "=-") && !isUnderline(l.text, "=-*_") {
+			level := 1
+			if bytes.TrimSpace(lines[i+1].text)[0] == '-' {
+				level = 2
+			}
+			start, end := l.trimmedSpan()
+			headings = append(headings, &Heading{Text: string(trimmed), Level: level, Start: start, End: end})
+		}
+
+		for _, m := range mdCodeSpanPattern.FindAllSubmatchIndex(l.text, -1) {
+			if mn := newMention(l.text[m[2]:m[3]], l.start+m[2]); mn != nil {
+				mentions = append(mentions, mn)
+			}
+		}
+	}
+	return headings, mentions
+}
+
+// rstUnderlineChars are the characters that reStructuredText section
+// titles may be underlined with.
+const rstUnderlineChars = "=-`:'\"~^_*+#<>"
+
+func indexRST(data []byte) (headings []*Heading, mentions []*Mention) {
+	lines := splitLines(data)
+	levels := map[byte]int{} // underline char -> heading level (in order of appearance)
+	literal := false         // in a literal block (after "::")
+	for i, l := range lines {
+		trimmed := bytes.TrimSpace(l.text)
+		if literal {
+			if len(trimmed) == 0 || l.text[0] == ' ' || l.text[0] == '\t' {
+				continue
+			}
+			literal = false
+		}
+		if bytes.HasSuffix(trimmed, []byte("::")) {
+			literal = true
+		}
+
+		if len(trimmed) > 0 && !isUnderline(l.text, rstUnderlineChars) && i+1 < len(lines) {
+			if u := bytes.TrimSpace(lines[i+1].text); isUnderline(u, rstUnderlineChars) && len(u) >= len(trimmed) {
+				level, present := levels[u[0]]
+				if !present {
+					level = len(levels) + 1
+					levels[u[0]] = level
+				}
+				start, end := l.trimmedSpan()
+				headings = append(headings, &Heading{Text: string(trimmed), Level: level, Start: start, End: end})
+			}
+		}
+
+		for _, m := range rstCodeSpanPattern.FindAllSubmatchIndex(l.text, -1) {
+			start, end := m[2], m[3]
+			if start == -1 {
+				start, end = m[4], m[5]
+			}
+			if mn := newMention(l.text[start:end], l.start+start); mn != nil {
+				mentions = append(mentions, mn)
+			}
+		}
+	}
+	return headings, mentions
+}
+
+// newMention returns the mention for the code span text at offset
+// off, or nil if the text isn't an identifier.
+func newMention(text []byte, off int) *Mention {
+	text = bytes.TrimSuffix(text, []byte("()"))
+	if !mentionPattern.Match(text) {
+		return nil
+	}
+	parts := mentionSeparator.Split(string(text), -1)
+	name := parts[len(parts)-1]
+	end := off + len(text)
+	return &Mention{Qualifiers: parts[:len(parts)-1], Name: name, Start: end - len(name), End: end}
+}
+
+// anchor returns the URL fragment that GitHub generates for a heading
+// with the given text.
+func anchor(text string) string {
+	var b bytes.Buffer
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
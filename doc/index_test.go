@@ -0,0 +1,67 @@
+package doc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndex_markdown(t *testing.T) {
+	data := []byte("# Getting started\n\nCall `srclib.Open()` or `Open`, not `a b`.\n\n```go\n# not a heading `Skip`\n```\n\nUsage\n-----\n\n## Usage ##\n")
+	headings, mentions := Index("docs/README.md", data)
+
+	var got []Heading
+	for _, h := range headings {
+		if string(data[h.Start:h.End]) != h.Text {
+			t.Errorf("heading %q has span text %q", h.Text, data[h.Start:h.End])
+		}
+		got = append(got, Heading{Text: h.Text, Level: h.Level, Anchor: h.Anchor})
+	}
+	want := []Heading{
+		{Text: "Getting started", Level: 1, Anchor: "getting-started"},
+		{Text: "Usage", Level: 2, Anchor: "usage"},
+		{Text: "Usage", Level: 2, Anchor: "usage-1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got headings %+v, want %+v", got, want)
+	}
+
+	if len(mentions) != 2 {
+		t.Fatalf("got %d mentions, want 2", len(mentions))
+	}
+	if m := mentions[0]; m.Name != "Open" || !reflect.DeepEqual(m.Qualifiers, []string{"srclib"}) || string(data[m.Start:m.End]) != "Open" {
+		t.Errorf("got mention %+v", m)
+	}
+	if m := mentions[1]; m.Name != "Open" || len(m.Qualifiers) != 0 {
+		t.Errorf("got mention %+v", m)
+	}
+}
+
+func TestIndex_rst(t *testing.T) {
+	data := []byte("=====\nTitle\n=====\n\nSection\n-------\n\nSee ``Foo::bar`` and :func:`os.path.join`.\n\nExample::\n\n    ``Skip``\n\nOther\n=====\n")
+	headings, mentions := Index("docs/index.rst", data)
+
+	var got []string
+	for _, h := range headings {
+		got = append(got, h.Text)
+	}
+	if want := []string{"Title", "Section", "Other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got headings %q, want %q", got, want)
+	}
+	if headings[0].Level != 1 || headings[1].Level != 2 || headings[2].Level != 1 {
+		t.Errorf("got heading levels %d, %d, %d, want 1, 2, 1", headings[0].Level, headings[1].Level, headings[2].Level)
+	}
+
+	var names []string
+	for _, m := range mentions {
+		names = append(names, m.Name)
+	}
+	if want := []string{"bar", "join"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got mentions %q, want %q", names, want)
+	}
+}
+
+func TestIndex_otherFormat(t *testing.T) {
+	if h, m := Index("a.txt", []byte("# x `y`")); h != nil || m != nil {
+		t.Errorf("got %v, %v for text file, want none", h, m)
+	}
+}
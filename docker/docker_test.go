@@ -0,0 +1,191 @@
+package docker
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestParseImage(t *testing.T) {
+	tests := map[string]Image{
+		"golang":                      {Registry: "docker.io", Repository: "library/golang"},
+		"golang:1.20-alpine":          {Registry: "docker.io", Repository: "library/golang", Tag: "1.20-alpine"},
+		"user/app@sha256:abc":         {Registry: "docker.io", Repository: "user/app", Digest: "sha256:abc"},
+		"ghcr.io/org/app:v1":          {Registry: "ghcr.io", Repository: "org/app", Tag: "v1"},
+		"localhost:5000/app":          {Registry: "localhost:5000", Repository: "app"},
+		"registry.example.com/a/b/c":  {Registry: "registry.example.com", Repository: "a/b/c"},
+		"registry.example.com:443/ab": {Registry: "registry.example.com:443", Repository: "ab"},
+	}
+	for ref, want := range tests {
+		img, err := ParseImage(ref)
+		if err != nil {
+			t.Errorf("%s: %s", ref, err)
+			continue
+		}
+		if *img != want {
+			t.Errorf("%s: got %+v, want %+v", ref, *img, want)
+		}
+	}
+	for _, ref := range []string{"", "golang:${VERSION}", "a/"} {
+		if _, err := ParseImage(ref); err == nil {
+			t.Errorf("%q: got no error", ref)
+		}
+	}
+}
+
+type fileInfo struct {
+	os.FileInfo
+	dir bool
+}
+
+func (fi fileInfo) IsDir() bool        { return fi.dir }
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+
+func refTexts(data []byte, o *graph.Output) map[string][]string {
+	refs := map[string][]string{}
+	for _, r := range o.Refs {
+		if r.Def {
+			continue
+		}
+		key := r.DefPath
+		if r.DefUnitType != "" {
+			key = r.DefUnitType + " " + r.DefUnit + " " + r.DefPath
+		}
+		refs[key] = append(refs[key], string(data[r.Start:r.End]))
+	}
+	return refs
+}
+
+func TestGraph_dockerfile(t *testing.T) {
+	data := []byte(`# syntax=docker/dockerfile:1
+ARG GO_VERSION=1.20
+FROM golang:${GO_VERSION} AS build
+ARG GO_VERSION
+COPY --chown=app go.mod \
+     cmd /src/
+COPY missing *.go /src/
+RUN <<EOF
+FROM not-an-instruction
+EOF
+FROM Build AS test
+FROM gcr.io/distroless/static
+COPY --from=build /out/app /app
+`)
+	stat := func(p string) (os.FileInfo, error) {
+		switch p {
+		case "app/go.mod":
+			return fileInfo{}, nil
+		case "app/cmd":
+			return fileInfo{dir: true}, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	o, err := Graph("app/Dockerfile", data, stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var defs []string
+	for _, d := range o.Defs {
+		defs = append(defs, d.Kind+" "+d.Path)
+	}
+	sort.Strings(defs)
+	wantDefs := []string{"arg arg/GO_VERSION", "dir file/app/cmd", "dockerfile .", "file file/app/go.mod", "stage stage/build", "stage stage/test"}
+	if !reflect.DeepEqual(defs, wantDefs) {
+		t.Errorf("got defs %q, want %q", defs, wantDefs)
+	}
+
+	// The golang image can't be resolved because of the variable.
+	want := map[string][]string{
+		"DockerImage distroless/static .": {"gcr.io/distroless/static"},
+		"arg/GO_VERSION":                  {"GO_VERSION", "GO_VERSION"},
+		"stage/build":                     {"Build", "build"},
+		"file/app/go.mod":                 {"go.mod"},
+		"file/app/cmd":                    {"cmd"},
+	}
+	if got := refTexts(data, o); !reflect.DeepEqual(got, want) {
+		t.Errorf("got refs %v, want %v", got, want)
+	}
+
+	images, err := Images("app/Dockerfile", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"gcr.io/distroless/static"}; !reflect.DeepEqual(images, want) {
+		t.Errorf("got images %q, want %q", images, want)
+	}
+}
+
+func TestGraph_compose(t *testing.T) {
+	data := []byte(`services:
+  web:
+    build:
+      context: ./web
+    image: acme/web
+    depends_on:
+      - db
+    links: ["cache:redis"]
+    networks: [front]
+    volumes:
+      - data:/var/data
+      - ./local:/local
+  worker:
+    image: acme/web
+    network_mode: "service:web"
+  db:
+    image: postgres:16
+  cache:
+    image: redis
+volumes:
+  data:
+networks:
+  front:
+`)
+	o, err := Graph("deploy/docker-compose.yml", data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"Dockerfile deploy/web/Dockerfile .": {"./web"},
+		"service/db":                         {"db"},
+		"service/cache":                      {"cache"},
+		"service/web":                        {"web", "acme/web"},
+		"network/front":                      {"front"},
+		"volume/data":                        {"data"},
+		"DockerImage library/postgres .":     {"postgres:16"},
+		"DockerImage library/redis .":        {"redis"},
+	}
+	if got := refTexts(data, o); !reflect.DeepEqual(got, want) {
+		t.Errorf("got refs %v, want %v", got, want)
+	}
+
+	images, err := Images("deploy/docker-compose.yml", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"postgres:16", "redis"}; !reflect.DeepEqual(images, want) {
+		t.Errorf("got images %q, want %q", images, want)
+	}
+}
+
+func TestIsFile(t *testing.T) {
+	for _, f := range []string{"Dockerfile", "a/Dockerfile.dev", "a/app.dockerfile"} {
+		if !IsDockerfile(f) {
+			t.Errorf("%s: want Dockerfile", f)
+		}
+	}
+	for _, f := range []string{"docker-compose.yml", "a/compose.yaml", "docker-compose.prod.yml"} {
+		if !IsComposeFile(f) {
+			t.Errorf("%s: want docker-compose file", f)
+		}
+	}
+	for _, f := range []string{"Dockerfiles/x", "compose.json", "my-compose.yml"} {
+		if IsDockerfile(f) || IsComposeFile(f) {
+			t.Errorf("%s: want neither", f)
+		}
+	}
+}
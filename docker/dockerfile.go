@@ -0,0 +1,210 @@
+// Package docker graphs Dockerfiles and docker-compose files.
+package docker
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+)
+
+// An Instruction is an instruction in a Dockerfile, such as
+// "FROM golang:1.20 AS build".
+type Instruction struct {
+	// Cmd is the instruction's name in upper case (e.g., "FROM").
+	Cmd string
+
+	// Args are the instruction's arguments, split on whitespace (or,
+	// for instructions in exec form, such as `COPY ["a", "b"]`, the
+	// strings in the JSON array). Flags (such as "--from=build") are
+	// included.
+	Args []*Token
+
+	// Start and End are the byte offsets of the instruction, including
+	// any continuation lines.
+	Start, End int
+}
+
+// A Token is a word in a Dockerfile.
+type Token struct {
+	// Text is the token's text, without surrounding quotes.
+	Text string
+
+	// Start and End are the byte offsets of Text.
+	Start, End int
+}
+
+// Flag returns the value of the flag with the given name (e.g.,
+// "from" for "--from=build") in the instruction's args, as a token, or
+// nil if the instruction has no such flag.
+func (in *Instruction) Flag(name string) *Token {
+	prefix := "--" + name + "="
+	for _, a := range in.Args {
+		if strings.HasPrefix(a.Text, prefix) {
+			n := len(prefix)
+			return &Token{Text: a.Text[n:], Start: a.Start + n, End: a.End}
+		}
+	}
+	return nil
+}
+
+// Params returns the instruction's args that aren't flags.
+func (in *Instruction) Params() []*Token {
+	var params []*Token
+	for i, a := range in.Args {
+		if strings.HasPrefix(a.Text, "--") {
+			continue
+		}
+		params = append(params, in.Args[i:]...)
+		break
+	}
+	return params
+}
+
+// ParseDockerfile parses the instructions in a Dockerfile. Comments
+// and the bodies of heredocs are skipped.
+func ParseDockerfile(data []byte) []*Instruction {
+	var (
+		instructions []*Instruction
+		text         []byte // the logical line being read
+		offs         []int  // offsets of the bytes in text
+		heredocs     []string
+	)
+
+	flush := func() {
+		if in := parseInstruction(text, offs); in != nil {
+			instructions = append(instructions, in)
+			heredocs = in.heredocs()
+		}
+		text, offs = text[:0], offs[:0]
+	}
+
+	for start := 0; start < len(data); {
+		end := bytes.IndexByte(data[start:], '\n')
+		next := len(data)
+		if end == -1 {
+			end = len(data)
+		} else {
+			end += start
+			next = end + 1
+		}
+		line := bytes.TrimRight(data[start:end], "\r")
+		lineStart := start
+		start = next
+
+		if len(heredocs) > 0 {
+			if strings.TrimLeft(string(line), "\t") == heredocs[0] {
+				heredocs = heredocs[1:]
+			}
+			continue
+		}
+
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 || trimmed[0] == '#' {
+			continue // a comment (which may be between continuation lines)
+		}
+		cont := bytes.HasSuffix(bytes.TrimRightFunc(line, unicode.IsSpace), []byte(`\`))
+		if cont {
+			line = bytes.TrimRightFunc(line, unicode.IsSpace)
+			line = line[:len(line)-1]
+		}
+		for i, c := range line {
+			text = append(text, c)
+			offs = append(offs, lineStart+i)
+		}
+		if cont {
+			text = append(text, ' ')
+			offs = append(offs, lineStart+len(line))
+			continue
+		}
+		flush()
+	}
+	flush()
+	return instructions
+}
+
+// heredocs returns the delimiters of the heredocs (such as "EOF" for
+// "<<EOF") in the instruction's args.
+func (in *Instruction) heredocs() []string {
+	var delims []string
+	for _, a := range in.Args {
+		if !strings.HasPrefix(a.Text, "<<") {
+			continue
+		}
+		d := strings.TrimPrefix(strings.TrimPrefix(a.Text, "<<"), "-")
+		d = strings.Trim(d, `"'`)
+		if d != "" {
+			delims = append(delims, d)
+		}
+	}
+	return delims
+}
+
+func parseInstruction(text []byte, offs []int) *Instruction {
+	i := 0
+	for i < len(text) && isSpace(text[i]) {
+		i++
+	}
+	cmdStart := i
+	for i < len(text) && !isSpace(text[i]) {
+		i++
+	}
+	if cmdStart == i {
+		return nil
+	}
+	in := &Instruction{
+		Cmd:   strings.ToUpper(string(text[cmdStart:i])),
+		Start: offs[cmdStart],
+		End:   offs[len(offs)-1] + 1,
+	}
+
+	rest := bytes.TrimSpace(text[i:])
+	if len(rest) > 1 && rest[0] == '[' && rest[len(rest)-1] == ']' {
+		// Exec form.
+		for j := i; j < len(text); j++ {
+			if text[j] != '"' {
+				continue
+			}
+			k := j + 1
+			for k < len(text) && text[k] != '"' {
+				if text[k] == '\\' {
+					k++
+				}
+				k++
+			}
+			if k >= len(text) {
+				break
+			}
+			in.Args = append(in.Args, newToken(text, offs, j+1, k))
+			j = k
+		}
+		return in
+	}
+
+	for i < len(text) {
+		for i < len(text) && isSpace(text[i]) {
+			i++
+		}
+		start := i
+		for i < len(text) && !isSpace(text[i]) {
+			i++
+		}
+		if start < i {
+			if (text[start] == '"' || text[start] == '\'') && i-start >= 2 && text[i-1] == text[start] {
+				in.Args = append(in.Args, newToken(text, offs, start+1, i-1))
+			} else {
+				in.Args = append(in.Args, newToken(text, offs, start, i))
+			}
+		}
+	}
+	return in
+}
+
+func newToken(text []byte, offs []int, start, end int) *Token {
+	t := &Token{Text: string(text[start:end]), Start: offs[start], End: offs[start]}
+	if end > start {
+		t.End = offs[end-1] + 1
+	}
+	return t
+}
+
+func isSpace(c byte) bool { return c == ' ' || c == '\t' }
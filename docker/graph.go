@@ -0,0 +1,396 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/yaml"
+)
+
+// Source unit types.
+const (
+	// DockerfileUnitType is the source unit type of a Dockerfile. Each
+	// Dockerfile is its own source unit, named by its path.
+	DockerfileUnitType = "Dockerfile"
+
+	// ComposeUnitType is the source unit type of a docker-compose
+	// file. Each docker-compose file is its own source unit, named by
+	// its path.
+	ComposeUnitType = "DockerCompose"
+)
+
+// IsDockerfile returns whether file is a Dockerfile (such as
+// "Dockerfile", "Dockerfile.dev", or "app.dockerfile").
+func IsDockerfile(file string) bool {
+	base := path.Base(file)
+	lower := strings.ToLower(base)
+	return base == "Dockerfile" || strings.HasPrefix(base, "Dockerfile.") || strings.HasSuffix(lower, ".dockerfile")
+}
+
+// IsComposeFile returns whether file is a docker-compose file (such
+// as "docker-compose.yml", "compose.yaml", or
+// "docker-compose.prod.yml").
+func IsComposeFile(file string) bool {
+	base := path.Base(file)
+	ext := path.Ext(base)
+	if ext != ".yml" && ext != ".yaml" {
+		return false
+	}
+	name := strings.SplitN(strings.TrimSuffix(base, ext), ".", 2)[0]
+	return name == "docker-compose" || name == "compose"
+}
+
+// Images returns the images that the Dockerfile or docker-compose file
+// uses, which are the file's dependencies. Images that are built by
+// the file itself (i.e., Dockerfile stages and the images of
+// docker-compose services that have a build context) are omitted.
+func Images(file string, data []byte) ([]string, error) {
+	o, err := Graph(file, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]struct{}{}
+	var images []string
+	for _, ref := range o.Refs {
+		if ref.DefUnitType != ImageUnitType {
+			continue
+		}
+		image := string(data[ref.Start:ref.End])
+		if _, present := seen[image]; !present {
+			seen[image] = struct{}{}
+			images = append(images, image)
+		}
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// Graph returns the defs and refs in the Dockerfile or docker-compose
+// file (see IsDockerfile and IsComposeFile) with the given path and
+// contents.
+//
+// If stat is non-nil, it is called to determine whether the paths that
+// Dockerfile COPY and ADD instructions copy from exist (relative to the
+// current directory, which must be the repository root). Refs to the
+// paths that exist are emitted, along with defs (of kind "file" or
+// "dir") for them.
+func Graph(file string, data []byte, stat func(string) (os.FileInfo, error)) (*graph.Output, error) {
+	g := &grapher{file: file, data: data, stat: stat, o: &graph.Output{}, defs: map[string]bool{}}
+	switch {
+	case IsDockerfile(file):
+		g.graphDockerfile()
+	case IsComposeFile(file):
+		if err := g.graphCompose(); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s is not a Dockerfile or docker-compose file", file)
+	}
+	return g.o, nil
+}
+
+type grapher struct {
+	file string
+	data []byte
+	stat func(string) (os.FileInfo, error)
+	o    *graph.Output
+	defs map[string]bool // paths of emitted defs
+}
+
+// def emits a def (and its definition ref) at the given span, unless
+// a def with the same path was already emitted.
+func (g *grapher) def(defPath, name, kind string, start, end int) {
+	if g.defs[defPath] {
+		return
+	}
+	g.defs[defPath] = true
+	g.o.Defs = append(g.o.Defs, &graph.Def{
+		DefKey:   graph.DefKey{Path: defPath},
+		Name:     name,
+		Kind:     kind,
+		File:     g.file,
+		DefStart: uint32(start),
+		DefEnd:   uint32(end),
+		Exported: true,
+	})
+	g.o.Refs = append(g.o.Refs, &graph.Ref{DefPath: defPath, Def: true, File: g.file, Start: uint32(start), End: uint32(end)})
+}
+
+// ref emits a ref to a def in the same source unit.
+func (g *grapher) ref(defPath string, start, end int) {
+	g.o.Refs = append(g.o.Refs, &graph.Ref{DefPath: defPath, File: g.file, Start: uint32(start), End: uint32(end)})
+}
+
+// imageRef emits a ref to the image (if it can be parsed) at the given
+// span.
+func (g *grapher) imageRef(ref string, start, end int) {
+	if ref == "scratch" {
+		return
+	}
+	img, err := ParseImage(ref)
+	if err != nil {
+		return
+	}
+	g.o.Refs = append(g.o.Refs, &graph.Ref{
+		DefRepo:     img.RepoURI(),
+		DefUnitType: ImageUnitType,
+		DefUnit:     img.Repository,
+		DefPath:     ".",
+		File:        g.file,
+		Start:       uint32(start),
+		End:         uint32(end),
+	})
+}
+
+var varPattern = regexp.MustCompile(`\$(?:\{([A-Za-z_]\w*)|([A-Za-z_]\w*))`)
+
+func (g *grapher) graphDockerfile() {
+	g.defs["."] = true
+	g.o.Defs = append(g.o.Defs, &graph.Def{
+		DefKey:   graph.DefKey{Path: "."},
+		Name:     path.Base(g.file),
+		Kind:     "dockerfile",
+		File:     g.file,
+		Exported: true,
+	})
+
+	var (
+		stages = map[string]string{} // stage name (lowercase) -> def path
+		args   = map[string]string{} // ARG name -> def path
+	)
+	stage := func(name string) (string, bool) {
+		p, ok := stages[strings.ToLower(name)]
+		return p, ok
+	}
+
+	for _, in := range ParseDockerfile(g.data) {
+		params := in.Params()
+		varTokens := in.Args
+
+		switch in.Cmd {
+		case "FROM":
+			if len(params) > 0 {
+				if p, ok := stage(params[0].Text); ok {
+					g.ref(p, params[0].Start, params[0].End)
+				} else {
+					g.imageRef(params[0].Text, params[0].Start, params[0].End)
+				}
+			}
+			if len(params) >= 3 && strings.EqualFold(params[1].Text, "AS") {
+				name := params[2]
+				p := "stage/" + name.Text
+				stages[strings.ToLower(name.Text)] = p
+				g.def(p, name.Text, "stage", name.Start, name.End)
+			}
+
+		case "COPY", "ADD":
+			if from := in.Flag("from"); from != nil {
+				if p, ok := stage(from.Text); ok {
+					g.ref(p, from.Start, from.End)
+				} else {
+					g.imageRef(from.Text, from.Start, from.End)
+				}
+				break // the sources are in another image
+			}
+			if len(params) >= 2 {
+				for _, src := range params[:len(params)-1] {
+					g.pathRef(src)
+				}
+			}
+
+		case "ARG":
+			varTokens = nil
+			for _, a := range params {
+				name, value := a.Text, ""
+				if i := strings.Index(a.Text, "="); i != -1 {
+					name, value = a.Text[:i], a.Text[i+1:]
+					varTokens = append(varTokens, &Token{Text: value, Start: a.Start + i + 1, End: a.End})
+				}
+				if p, declared := args[name]; declared {
+					// Redeclaring an ARG (e.g., to use a global ARG in a
+					// build stage) refers to the original declaration.
+					g.ref(p, a.Start, a.Start+len(name))
+				} else {
+					p := "arg/" + name
+					args[name] = p
+					g.def(p, name, "arg", a.Start, a.Start+len(name))
+				}
+			}
+		}
+
+		for _, t := range varTokens {
+			for _, m := range varPattern.FindAllStringSubmatchIndex(t.Text, -1) {
+				start, end := m[2], m[3]
+				if start == -1 {
+					start, end = m[4], m[5]
+				}
+				if p, declared := args[t.Text[start:end]]; declared {
+					g.ref(p, t.Start+start, t.Start+end)
+				}
+			}
+		}
+	}
+}
+
+// pathRef emits a ref (and def) for the path in the build context
+// that a COPY or ADD instruction copies from, if it exists. The build
+// context is assumed to be the Dockerfile's directory.
+func (g *grapher) pathRef(src *Token) {
+	if g.stat == nil || strings.Contains(src.Text, "://") || strings.ContainsAny(src.Text, "*?[$") || strings.HasPrefix(src.Text, "<<") {
+		return
+	}
+	p := path.Join(path.Dir(g.file), src.Text)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return // outside of the repository
+	}
+	fi, err := g.stat(p)
+	if err != nil {
+		return
+	}
+	kind := "file"
+	if fi.IsDir() {
+		kind = "dir"
+	}
+	defPath := "file/" + p
+	if !g.defs[defPath] {
+		g.defs[defPath] = true
+		g.o.Defs = append(g.o.Defs, &graph.Def{
+			DefKey:   graph.DefKey{Path: defPath},
+			Name:     p,
+			Kind:     kind,
+			File:     p,
+			Exported: true,
+		})
+	}
+	g.ref(defPath, src.Start, src.End)
+}
+
+func (g *grapher) graphCompose() error {
+	root, err := yaml.Parse(g.data)
+	if err != nil {
+		return err
+	}
+	services := root.Get("services")
+	if services == nil && root.Get("version") == nil {
+		services = root // version 1 format
+	}
+	if services == nil || services.Kind != yaml.Mapping {
+		return nil
+	}
+	volumes, networks := root.Get("volumes"), root.Get("networks")
+
+	// Refs to services, volumes, and networks resolve to the ones
+	// defined in the file.
+	kinds := map[string]*yaml.Node{"service": services, "volume": volumes, "network": networks}
+	for _, kind := range []string{"service", "volume", "network"} {
+		if n := kinds[kind]; n != nil && n.Kind == yaml.Mapping {
+			for _, k := range n.Keys {
+				g.def(kind+"/"+k.Value, k.Value, kind, k.Start, k.End)
+			}
+		}
+	}
+	refTo := func(kind, name string, start int) {
+		if p := kind + "/" + name; g.defs[p] {
+			g.ref(p, start, start+len(name))
+		}
+	}
+
+	// Images that are built by services.
+	built := map[string]string{}
+	for i, k := range services.Keys {
+		s := services.Values[i]
+		if image := s.Get("image"); image != nil && s.Get("build") != nil {
+			built[image.Value] = k.Value
+		}
+	}
+
+	for i, k := range services.Keys {
+		s := services.Values[i]
+		if s.Kind != yaml.Mapping {
+			continue
+		}
+		for _, n := range s.Get("depends_on").Items() {
+			refTo("service", n.Value, n.Start)
+		}
+		for _, n := range append(s.Get("links").Items(), s.Get("volumes_from").Items()...) {
+			if !strings.HasPrefix(n.Value, "container:") {
+				refTo("service", strings.SplitN(n.Value, ":", 2)[0], n.Start)
+			}
+		}
+		if ext := s.Get("extends"); ext != nil {
+			if ext.Kind == yaml.Scalar {
+				refTo("service", ext.Value, ext.Start)
+			} else if svc := ext.Get("service"); svc != nil && ext.Get("file") == nil {
+				refTo("service", svc.Value, svc.Start)
+			}
+		}
+		if mode := s.Get("network_mode"); mode != nil && strings.HasPrefix(mode.Value, "service:") {
+			refTo("service", strings.TrimPrefix(mode.Value, "service:"), mode.Start+len("service:"))
+		}
+		for _, n := range s.Get("networks").Items() {
+			refTo("network", n.Value, n.Start)
+		}
+		if vs := s.Get("volumes"); vs != nil && vs.Kind == yaml.Sequence {
+			for _, v := range vs.Values {
+				if v.Kind == yaml.Scalar {
+					refTo("volume", strings.SplitN(v.Value, ":", 2)[0], v.Start)
+				} else if src := v.Get("source"); src != nil {
+					refTo("volume", src.Value, src.Start)
+				}
+			}
+		}
+
+		if b := s.Get("build"); b != nil {
+			g.buildRef(b)
+		}
+		if image := s.Get("image"); image != nil {
+			if svc, isBuilt := built[image.Value]; isBuilt && svc != k.Value {
+				g.ref("service/"+svc, image.Start, image.End)
+			} else if s.Get("build") == nil {
+				g.imageRef(image.Value, image.Start, image.End)
+			}
+		}
+	}
+	return nil
+}
+
+// buildRef emits a ref to the Dockerfile source unit that a service's
+// build config (either a context string or a mapping with "context"
+// and "dockerfile") builds.
+func (g *grapher) buildRef(b *yaml.Node) {
+	ctx, dockerfile := b, (*yaml.Node)(nil)
+	if b.Kind == yaml.Mapping {
+		ctx, dockerfile = b.Get("context"), b.Get("dockerfile")
+	}
+	var ctxDir, name string
+	span := ctx
+	if ctx != nil && ctx.Kind == yaml.Scalar {
+		ctxDir = ctx.Value
+	}
+	if dockerfile != nil && dockerfile.Kind == yaml.Scalar {
+		name, span = dockerfile.Value, dockerfile
+	}
+	if span == nil || strings.Contains(ctxDir, "://") || strings.Contains(ctxDir+name, "$") {
+		return
+	}
+	if name == "" {
+		name = "Dockerfile"
+	}
+	unit := path.Join(path.Dir(g.file), ctxDir, name)
+	if unit == ".." || strings.HasPrefix(unit, "../") {
+		return
+	}
+	g.o.Refs = append(g.o.Refs, &graph.Ref{
+		DefUnitType: DockerfileUnitType,
+		DefUnit:     unit,
+		DefPath:     ".",
+		File:        g.file,
+		Start:       uint32(span.Start),
+		End:         uint32(span.End),
+	})
+}
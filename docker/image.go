@@ -0,0 +1,82 @@
+package docker
+
+import (
+	"errors"
+	"strings"
+)
+
+// DefaultRegistry is the registry of images whose names don't specify
+// one (e.g., "golang" or "user/app").
+const DefaultRegistry = "docker.io"
+
+// ImageUnitType is the source unit type of Docker images, which are
+// the targets of refs to the images that Dockerfiles and
+// docker-compose files use.
+const ImageUnitType = "DockerImage"
+
+// An Image is a parsed Docker image reference, such as
+// "ghcr.io/user/app:1.0" or "golang@sha256:...".
+type Image struct {
+	// Registry is the image's registry host (e.g., "ghcr.io"), or
+	// DefaultRegistry.
+	Registry string
+
+	// Repository is the image's repository in its registry (e.g.,
+	// "user/app", or "library/golang" for official images on the
+	// default registry).
+	Repository string
+
+	// Tag and Digest are the image's tag and digest, if specified.
+	Tag, Digest string
+}
+
+var errInvalidImage = errors.New("invalid image reference")
+
+// ParseImage parses an image reference. References that contain
+// variables (such as "golang:${GO_VERSION}") can't be parsed.
+func ParseImage(ref string) (*Image, error) {
+	if ref == "" || strings.ContainsAny(ref, "$ \t") {
+		return nil, errInvalidImage
+	}
+	img := &Image{Registry: DefaultRegistry}
+	if i := strings.Index(ref, "@"); i != -1 {
+		img.Digest = ref[i+1:]
+		ref = ref[:i]
+	}
+	if i := strings.LastIndex(ref, ":"); i != -1 && !strings.Contains(ref[i:], "/") {
+		img.Tag = ref[i+1:]
+		ref = ref[:i]
+	}
+	if i := strings.Index(ref, "/"); i != -1 {
+		if host := ref[:i]; strings.ContainsAny(host, ".:") || host == "localhost" {
+			img.Registry = host
+			ref = ref[i+1:]
+		}
+	}
+	if ref == "" || strings.HasSuffix(ref, "/") {
+		return nil, errInvalidImage
+	}
+	if img.Registry == DefaultRegistry && !strings.Contains(ref, "/") {
+		ref = "library/" + ref
+	}
+	img.Repository = strings.ToLower(ref)
+	return img, nil
+}
+
+// RepoURI returns the URI of the repository that the image's defs are
+// in (e.g., "docker.io/library/golang").
+func (img *Image) RepoURI() string {
+	return img.Registry + "/" + img.Repository
+}
+
+// Version returns the image's digest, or its tag if it has no digest
+// (or "latest" if it has neither).
+func (img *Image) Version() string {
+	switch {
+	case img.Digest != "":
+		return img.Digest
+	case img.Tag != "":
+		return img.Tag
+	}
+	return "latest"
+}
@@ -0,0 +1,62 @@
+// Package export exports the data of a query.Index in other formats
+// from Go programs, without running the src binary.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"sourcegraph.com/sourcegraph/srclib/lsif"
+	"sourcegraph.com/sourcegraph/srclib/query"
+	"sourcegraph.com/sourcegraph/srclib/store/storepb"
+)
+
+// LSIFOptions configures an LSIF export.
+type LSIFOptions struct {
+	// Repo and CommitID are the repository (empty for a RepoStore)
+	// and commit whose defs and refs are exported. CommitID is
+	// required.
+	Repo     string
+	CommitID string
+
+	// ProjectRoot is the URI of the repository root (such as
+	// "file:///home/alice/src/repo").
+	ProjectRoot string
+
+	// ToolVersion is the version of the exporting program, recorded
+	// in the dump's metadata.
+	ToolVersion string
+
+	// ReadFile reads a file (with a path relative to the repository
+	// root) at CommitID, for the dump's documents.
+	ReadFile func(file string) ([]byte, error)
+}
+
+// LSIF writes an LSIF dump of the defs and refs of opt.Repo at
+// opt.CommitID in x to w, as "src push --lsif" does (see
+// lsif.Exporter). If some files couldn't be read, it writes the dump
+// without them and returns a *lsif.SkippedFilesError.
+func LSIF(w io.Writer, x *query.Index, opt LSIFOptions) error {
+	if opt.CommitID == "" {
+		return errors.New("CommitID is required")
+	}
+	defs, err := x.Defs(&storepb.DefsOptions{Repo: opt.Repo, CommitID: opt.CommitID})
+	if err != nil {
+		return err
+	}
+	refs, err := x.Refs(&storepb.RefsOptions{Repo: opt.Repo, CommitID: opt.CommitID})
+	if err != nil {
+		return err
+	}
+	if len(defs) == 0 && len(refs) == 0 {
+		return fmt.Errorf("no defs or refs in the store for %s at commit %s", opt.Repo, opt.CommitID)
+	}
+	e := &lsif.Exporter{
+		ProjectRoot: opt.ProjectRoot,
+		Repo:        opt.Repo,
+		ToolVersion: opt.ToolVersion,
+		ReadFile:    opt.ReadFile,
+	}
+	return e.Export(w, defs, refs)
+}
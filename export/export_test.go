@@ -0,0 +1,59 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/query"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestLSIF(t *testing.T) {
+	s := store.NewFSMultiRepoStore(rwvfs.Walkable(rwvfs.Map(map[string]string{})), nil)
+	u := &unit.SourceUnit{Type: "GoPackage", Name: "a", Files: []string{"a.go"}}
+	data := graph.Output{
+		Defs: []*graph.Def{{DefKey: graph.DefKey{Path: "F"}, Name: "F", Kind: "func", File: "a.go", DefStart: 11, DefEnd: 27}},
+		Refs: []*graph.Ref{{DefPath: "F", Def: true, File: "a.go", Start: 16, End: 17}},
+	}
+	if err := s.Import("example.com/r", "c", u, data); err != nil {
+		t.Fatal(err)
+	}
+	x := query.New(s)
+
+	var buf bytes.Buffer
+	err := LSIF(&buf, x, LSIFOptions{
+		Repo:        "example.com/r",
+		CommitID:    "c",
+		ProjectRoot: "file:///src/r",
+		ReadFile: func(file string) ([]byte, error) {
+			if file == "a.go" {
+				return []byte("package a\n\nfunc F() {}\n"), nil
+			}
+			return nil, os.ErrNotExist
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := map[string]int{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var el struct{ Label string }
+		if err := dec.Decode(&el); err != nil {
+			t.Fatal(err)
+		}
+		labels[el.Label]++
+	}
+	if labels["metaData"] != 1 || labels["document"] != 1 || labels["moniker"] != 1 {
+		t.Errorf("got element labels %v, want 1 metaData, document, and moniker", labels)
+	}
+
+	if err := LSIF(&buf, x, LSIFOptions{Repo: "example.com/r", CommitID: "d"}); err == nil {
+		t.Error("got no error for a commit with no data")
+	}
+}
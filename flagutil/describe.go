@@ -0,0 +1,97 @@
+package flagutil
+
+import (
+	"reflect"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+)
+
+// A CommandInfo describes a command and its options and subcommands,
+// for programs (such as wrappers and editor plugins) that discover a
+// CLI's capabilities programmatically.
+type CommandInfo struct {
+	Name        string
+	Description string `json:",omitempty"` // one-line description
+	Help        string `json:",omitempty"` // long description
+
+	Options     []*OptionInfo  `json:",omitempty"`
+	Subcommands []*CommandInfo `json:",omitempty"`
+}
+
+// An OptionInfo describes a command-line option.
+type OptionInfo struct {
+	Short string `json:",omitempty"` // short name (without "-")
+	Long  string `json:",omitempty"` // long name, including any group namespace (without "--")
+
+	Description string `json:",omitempty"`
+
+	// Type is the kind of value that the option takes: "bool" for
+	// options that take no value, "string", "int", "float64", etc.,
+	// or "[]" and the element kind for options that may be repeated.
+	Type      string
+	ValueName string   `json:",omitempty"`
+	Default   []string `json:",omitempty"`
+	Required  bool     `json:",omitempty"`
+
+	// Group is the description of the option group that the option
+	// is in (such as "execution"), if any.
+	Group string `json:",omitempty"`
+}
+
+// DescribeCommand describes c and (recursively) its subcommands.
+func DescribeCommand(c *flags.Command) *CommandInfo {
+	info := &CommandInfo{
+		Name:        c.Name,
+		Description: c.ShortDescription,
+		Help:        c.LongDescription,
+		Options:     describeOptions(c.Group, "", ""),
+	}
+	for _, sc := range c.Commands() {
+		info.Subcommands = append(info.Subcommands, DescribeCommand(sc))
+	}
+	return info
+}
+
+func describeOptions(g *flags.Group, groupName, prefix string) []*OptionInfo {
+	var opts []*OptionInfo
+	for _, opt := range g.Options() {
+		info := &OptionInfo{
+			Description: opt.Description,
+			Type:        valueKind(opt.Value()),
+			ValueName:   opt.ValueName,
+			Default:     opt.Default,
+			Required:    opt.Required,
+			Group:       groupName,
+		}
+		if opt.ShortName != 0 {
+			info.Short = string(opt.ShortName)
+		}
+		if opt.LongName != "" {
+			info.Long = prefix + opt.LongName
+		}
+		opts = append(opts, info)
+	}
+	for _, sg := range g.Groups() {
+		// TODO(sqs): assumes that the NamespaceDelimiter is "."
+		const namespaceDelimiter = "."
+		subPrefix := prefix
+		if sg.Namespace != "" {
+			subPrefix += sg.Namespace + namespaceDelimiter
+		}
+		opts = append(opts, describeOptions(sg, sg.ShortDescription, subPrefix)...)
+	}
+	return opts
+}
+
+// valueKind returns the kind of an option's value (see
+// OptionInfo.Type).
+func valueKind(v interface{}) string {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return ""
+	}
+	if t.Kind() == reflect.Slice {
+		return "[]" + t.Elem().Kind().String()
+	}
+	return t.Kind().String()
+}
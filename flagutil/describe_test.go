@@ -0,0 +1,49 @@
+package flagutil
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+)
+
+func TestDescribeCommand(t *testing.T) {
+	var global struct {
+		Verbose bool `short:"v" description:"verbose"`
+	}
+	var cmd struct {
+		Out   string   `short:"o" long:"out" description:"output" default:"text" value-name:"FMT"`
+		Files []string `long:"file"`
+		Exec  struct {
+			N int `long:"n"`
+		} `group:"execution" namespace:"exec"`
+	}
+	p := flags.NewNamedParser("prog", flags.None)
+	if _, err := p.AddGroup("Global options", "", &global); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AddCommand("run", "run things", "The run command runs things.", &cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	info := DescribeCommand(p.Command)
+	want := &CommandInfo{
+		Name: "prog",
+		Options: []*OptionInfo{
+			{Short: "v", Description: "verbose", Type: "bool", Group: "Global options"},
+		},
+		Subcommands: []*CommandInfo{{
+			Name:        "run",
+			Description: "run things",
+			Help:        "The run command runs things.",
+			Options: []*OptionInfo{
+				{Short: "o", Long: "out", Description: "output", Type: "string", ValueName: "FMT", Default: []string{"text"}},
+				{Long: "file", Type: "[]string"},
+				{Long: "exec.n", Type: "int", Group: "execution"},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+}
@@ -0,0 +1,30 @@
+package flagutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseByteSize parses a size in bytes, with an optional (decimal or
+// binary) unit suffix, such as "512MB", "2G", or "1GiB".
+func ParseByteSize(s string) (uint64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	i := strings.IndexFunc(t, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	num, unit := t, ""
+	if i != -1 {
+		num, unit = t[:i], strings.TrimSpace(t[i:])
+	}
+	mult := map[string]float64{
+		"": 1, "B": 1,
+		"K": 1e3, "KB": 1e3, "KIB": 1 << 10,
+		"M": 1e6, "MB": 1e6, "MIB": 1 << 20,
+		"G": 1e9, "GB": 1e9, "GIB": 1 << 30,
+		"T": 1e12, "TB": 1e12, "TIB": 1 << 40,
+	}[unit]
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || mult == 0 || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (expected a number of bytes, optionally followed by a unit, such as 512MB or 2GiB)", s)
+	}
+	return uint64(n * mult), nil
+}
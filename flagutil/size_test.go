@@ -0,0 +1,33 @@
+package flagutil
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]uint64{
+		"0":       0,
+		"512":     512,
+		"512B":    512,
+		"2k":      2000,
+		"2KiB":    2048,
+		"512MB":   512e6,
+		" 1.5 G ": 1.5e9,
+		"1GiB":    1 << 30,
+		"3T":      3e12,
+	}
+	for s, want := range tests {
+		n, err := ParseByteSize(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		if n != want {
+			t.Errorf("%q: got %d, want %d", s, n, want)
+		}
+	}
+
+	for _, s := range []string{"", "MB", "-1MB", "1XB", "1.2.3G", "1 G B"} {
+		if _, err := ParseByteSize(s); err == nil {
+			t.Errorf("%q: got no error", s)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package graph
+
+// AliasOf returns the key of the def that d is an alias of (see
+// d.AliasPath), or false if d isn't an alias. The key's empty fields
+// are d's: its repository and source unit, and (if the original def is
+// in d's repository) its commit ID.
+func (d *Def) AliasOf() (DefKey, bool) {
+	if d.AliasPath == "" {
+		return DefKey{}, false
+	}
+	key := DefKey{
+		Repo:     d.AliasRepo,
+		UnitType: d.AliasUnitType,
+		Unit:     d.AliasUnit,
+		Path:     d.AliasPath,
+	}
+	if key.Repo == "" || key.Repo == d.Repo {
+		key.Repo, key.CommitID = d.Repo, d.CommitID
+	}
+	if key.UnitType == "" && key.Unit == "" {
+		key.UnitType, key.Unit = d.UnitType, d.Unit
+	}
+	return key, true
+}
@@ -0,0 +1,23 @@
+package graph
+
+import "testing"
+
+func TestDef_AliasOf(t *testing.T) {
+	key := DefKey{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", Path: "p"}
+	tests := []struct {
+		def  Def
+		want DefKey
+		ok   bool
+	}{
+		{Def{DefKey: key}, DefKey{}, false},
+		{Def{DefKey: key, AliasPath: "q"}, DefKey{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", Path: "q"}, true},
+		{Def{DefKey: key, AliasUnitType: "t", AliasUnit: "v", AliasPath: "q"}, DefKey{Repo: "r", CommitID: "c", UnitType: "t", Unit: "v", Path: "q"}, true},
+		{Def{DefKey: key, AliasRepo: "r2", AliasUnitType: "t", AliasUnit: "v", AliasPath: "q"}, DefKey{Repo: "r2", UnitType: "t", Unit: "v", Path: "q"}, true},
+	}
+	for _, test := range tests {
+		got, ok := test.def.AliasOf()
+		if got != test.want || ok != test.ok {
+			t.Errorf("%+v: got %+v, %v, want %+v, %v", test.def, got, ok, test.want, test.ok)
+		}
+	}
+}
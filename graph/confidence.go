@@ -0,0 +1,26 @@
+package graph
+
+// EffectiveConfidence returns r.Confidence, or 1 if r.Confidence is 0
+// (because the grapher didn't set it, which means it is certain).
+func (r *Ref) EffectiveConfidence() float32 {
+	if r.Confidence == 0 {
+		return 1
+	}
+	return r.Confidence
+}
+
+// ValidConfidence reports whether c is a valid Ref.Confidence (from 0
+// to 1).
+func ValidConfidence(c float32) bool { return c >= 0 && c <= 1 }
+
+// RefsByConfidence sorts refs by descending effective confidence (see
+// EffectiveConfidence), so that certain refs come before probable
+// ones. Use sort.Stable to keep the original order of refs with equal
+// confidence.
+type RefsByConfidence []*Ref
+
+func (vs RefsByConfidence) Len() int      { return len(vs) }
+func (vs RefsByConfidence) Swap(i, j int) { vs[i], vs[j] = vs[j], vs[i] }
+func (vs RefsByConfidence) Less(i, j int) bool {
+	return vs[i].EffectiveConfidence() > vs[j].EffectiveConfidence()
+}
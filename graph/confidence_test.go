@@ -0,0 +1,35 @@
+package graph
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRef_EffectiveConfidence(t *testing.T) {
+	tests := map[float32]float32{0: 1, 0.25: 0.25, 1: 1}
+	for c, want := range tests {
+		ref := &Ref{Confidence: c}
+		if got := ref.EffectiveConfidence(); got != want {
+			t.Errorf("Confidence %v: got effective confidence %v, want %v", c, got, want)
+		}
+	}
+}
+
+func TestRefsByConfidence(t *testing.T) {
+	refs := []*Ref{
+		{DefPath: "a", Confidence: 0.5},
+		{DefPath: "b"},
+		{DefPath: "c", Confidence: 0.9},
+		{DefPath: "d", Confidence: 1},
+		{DefPath: "e", Confidence: 0.5},
+	}
+	sort.Stable(RefsByConfidence(refs))
+	var got []string
+	for _, ref := range refs {
+		got = append(got, ref.DefPath)
+	}
+	if want := []string{"b", "d", "c", "a", "e"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got order %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,517 @@
+package graph
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// DecodeOutput decodes graph output from its JSON encoding. It is
+// equivalent to json.Unmarshal into a new Output, but faster: defs and
+// refs, which make up most of the graph output of a large source unit,
+// are decoded by a hand-written parser instead of by reflection.
+// Inputs that the parser doesn't handle (such as keys that differ from
+// the field names in case, or invalid JSON) are decoded using
+// json.Unmarshal instead, so the result (and error) is always the
+// same.
+//
+// To avoid copying, the defs' Data fields refer to data, which must
+// not be modified afterwards.
+func DecodeOutput(data []byte) (*Output, error) {
+	var o Output
+	d := outputDecoder{data: data}
+	if d.output(&o) && d.end() {
+		return &o, nil
+	}
+
+	var o2 Output
+	if err := json.Unmarshal(data, &o2); err != nil {
+		return nil, err
+	}
+	return &o2, nil
+}
+
+// DecodeOutputWarnings decodes only the Warnings of graph output from
+// its JSON encoding. It is much faster than DecodeOutput for large
+// outputs, because it skips the other fields' values without decoding
+// them (or fully validating them).
+func DecodeOutputWarnings(data []byte) ([]*Warning, error) {
+	var ws []*Warning
+	d := outputDecoder{data: data}
+	if d.warningsOnly(&ws) && d.end() {
+		return ws, nil
+	}
+
+	o, err := DecodeOutput(data)
+	if err != nil {
+		return nil, err
+	}
+	return o.Warnings, nil
+}
+
+// An outputDecoder decodes graph output (see DecodeOutput). Its
+// methods return false if they can't decode the input (because it is
+// invalid or because they don't handle it), in which case the input
+// is decoded by json.Unmarshal instead.
+type outputDecoder struct {
+	data []byte
+	i    int // offset of the next byte to read
+
+	// strs holds the strings decoded by internedStr, so that strings
+	// that are repeated in many defs and refs (such as file names and
+	// the paths of referenced defs) are only allocated once.
+	strs map[string]string
+}
+
+func (d *outputDecoder) output(o *Output) bool {
+	if d.literal("null") {
+		return true
+	}
+	var seen struct{ defs, refs, docs, anns, warnings, files bool }
+	once := func(seen *bool) bool {
+		// When a key is repeated, json.Unmarshal decodes the
+		// second value into the slice that holds the first.
+		if *seen {
+			return false
+		}
+		*seen = true
+		return true
+	}
+	return d.object(func(key []byte) bool {
+		switch string(key) {
+		case "Defs":
+			return once(&seen.defs) && d.defs(&o.Defs)
+		case "Refs":
+			return once(&seen.refs) && d.refs(&o.Refs)
+		case "Docs":
+			return once(&seen.docs) && d.unmarshal(&o.Docs)
+		case "Anns":
+			return once(&seen.anns) && d.unmarshal(&o.Anns)
+		case "Warnings":
+			return once(&seen.warnings) && d.unmarshal(&o.Warnings)
+		case "Files":
+			return once(&seen.files) && d.unmarshal(&o.Files)
+		}
+		return false
+	})
+}
+
+// warningsOnly decodes the Warnings of graph output, skipping the
+// other fields (see DecodeOutputWarnings).
+func (d *outputDecoder) warningsOnly(ws *[]*Warning) bool {
+	if d.literal("null") {
+		return true
+	}
+	var seen bool
+	return d.object(func(key []byte) bool {
+		switch {
+		case string(key) == "Warnings":
+			if seen {
+				return false
+			}
+			seen = true
+			return d.unmarshal(ws)
+		case strings.EqualFold(string(key), "Warnings"):
+			return false // let json.Unmarshal match keys case-insensitively
+		}
+		return d.skip()
+	})
+}
+
+func (d *outputDecoder) defs(defs *[]*Def) bool {
+	if d.literal("null") {
+		*defs = nil
+		return true
+	}
+	vs := []*Def{}
+	ok := d.array(func() bool {
+		var def *Def
+		if !d.literal("null") {
+			def = new(Def)
+			if !d.def(def) {
+				return false
+			}
+		}
+		vs = append(vs, def)
+		return true
+	})
+	*defs = vs
+	return ok
+}
+
+func (d *outputDecoder) def(def *Def) bool {
+	return d.object(func(key []byte) bool {
+		switch string(key) {
+		case "Repo":
+			return d.internedStr(&def.Repo)
+		case "CommitID":
+			return d.internedStr(&def.CommitID)
+		case "UnitType":
+			return d.internedStr(&def.UnitType)
+		case "Unit":
+			return d.internedStr(&def.Unit)
+		case "Path":
+			return d.str(&def.Path)
+		case "Name":
+			return d.internedStr(&def.Name)
+		case "Kind":
+			return d.internedStr(&def.Kind)
+		case "File":
+			return d.internedStr(&def.File)
+		case "DefStart":
+			return d.uint32(&def.DefStart)
+		case "DefEnd":
+			return d.uint32(&def.DefEnd)
+		case "Exported":
+			return d.bool(&def.Exported)
+		case "Local":
+			return d.bool(&def.Local)
+		case "Test":
+			return d.bool(&def.Test)
+		case "Data":
+			return d.rawMessage(&def.Data)
+		case "Docs":
+			return d.unmarshal(&def.Docs)
+		case "TreePath":
+			return d.str(&def.TreePath)
+		case "Rank":
+			return d.uint32(&def.Rank)
+		case "Monikers":
+			return d.unmarshal(&def.Monikers)
+		case "Snippet":
+			return d.unmarshal(&def.Snippet)
+		case "ParentPath":
+			return d.str(&def.ParentPath)
+		case "AliasRepo":
+			return d.str(&def.AliasRepo)
+		case "AliasUnitType":
+			return d.str(&def.AliasUnitType)
+		case "AliasUnit":
+			return d.str(&def.AliasUnit)
+		case "AliasPath":
+			return d.str(&def.AliasPath)
+		}
+		return false
+	})
+}
+
+func (d *outputDecoder) refs(refs *[]*Ref) bool {
+	if d.literal("null") {
+		*refs = nil
+		return true
+	}
+	vs := []*Ref{}
+	ok := d.array(func() bool {
+		var ref *Ref
+		if !d.literal("null") {
+			ref = new(Ref)
+			if !d.ref(ref) {
+				return false
+			}
+		}
+		vs = append(vs, ref)
+		return true
+	})
+	*refs = vs
+	return ok
+}
+
+func (d *outputDecoder) ref(ref *Ref) bool {
+	return d.object(func(key []byte) bool {
+		switch string(key) {
+		case "DefRepo":
+			return d.internedStr(&ref.DefRepo)
+		case "DefUnitType":
+			return d.internedStr(&ref.DefUnitType)
+		case "DefUnit":
+			return d.internedStr(&ref.DefUnit)
+		case "DefPath":
+			return d.internedStr(&ref.DefPath)
+		case "Repo":
+			return d.internedStr(&ref.Repo)
+		case "CommitID":
+			return d.internedStr(&ref.CommitID)
+		case "UnitType":
+			return d.internedStr(&ref.UnitType)
+		case "Unit":
+			return d.internedStr(&ref.Unit)
+		case "Def":
+			return d.bool(&ref.Def)
+		case "File":
+			return d.internedStr(&ref.File)
+		case "Start":
+			return d.uint32(&ref.Start)
+		case "End":
+			return d.uint32(&ref.End)
+		case "EnclosingDef":
+			return d.internedStr(&ref.EnclosingDef)
+		case "Snippet":
+			return d.unmarshal(&ref.Snippet)
+		case "Confidence":
+			return d.unmarshal(&ref.Confidence)
+		}
+		return false
+	})
+}
+
+// ws skips whitespace.
+func (d *outputDecoder) ws() {
+	for d.i < len(d.data) {
+		switch d.data[d.i] {
+		case ' ', '\t', '\n', '\r':
+			d.i++
+		default:
+			return
+		}
+	}
+}
+
+// end reports whether only whitespace remains.
+func (d *outputDecoder) end() bool {
+	d.ws()
+	return d.i == len(d.data)
+}
+
+// consume consumes c (after any whitespace) if it is next.
+func (d *outputDecoder) consume(c byte) bool {
+	d.ws()
+	if d.i < len(d.data) && d.data[d.i] == c {
+		d.i++
+		return true
+	}
+	return false
+}
+
+// literal consumes lit (after any whitespace) if it is next.
+func (d *outputDecoder) literal(lit string) bool {
+	d.ws()
+	if len(d.data)-d.i >= len(lit) && string(d.data[d.i:d.i+len(lit)]) == lit {
+		d.i += len(lit)
+		return true
+	}
+	return false
+}
+
+// object decodes an object, calling value for each key to decode its
+// value.
+func (d *outputDecoder) object(value func(key []byte) bool) bool {
+	if !d.consume('{') {
+		return false
+	}
+	if d.consume('}') {
+		return true
+	}
+	for {
+		key, ok := d.key()
+		if !ok || !d.consume(':') || !value(key) {
+			return false
+		}
+		if !d.consume(',') {
+			return d.consume('}')
+		}
+	}
+}
+
+// key decodes an object key. Only keys without escapes or non-ASCII
+// characters are handled (which includes all field names).
+func (d *outputDecoder) key() ([]byte, bool) {
+	if !d.consume('"') {
+		return nil, false
+	}
+	start := d.i
+	for d.i < len(d.data) {
+		c := d.data[d.i]
+		if c == '"' {
+			d.i++
+			return d.data[start : d.i-1], true
+		}
+		if c == '\\' || c < 0x20 || c >= utf8.RuneSelf {
+			return nil, false
+		}
+		d.i++
+	}
+	return nil, false
+}
+
+// array decodes an array, calling elem to decode each element.
+func (d *outputDecoder) array(elem func() bool) bool {
+	if !d.consume('[') {
+		return false
+	}
+	if d.consume(']') {
+		return true
+	}
+	for {
+		if !elem() {
+			return false
+		}
+		if !d.consume(',') {
+			return d.consume(']')
+		}
+	}
+}
+
+func (d *outputDecoder) str(s *string) bool { return d.decodeStr(s, false) }
+
+func (d *outputDecoder) internedStr(s *string) bool { return d.decodeStr(s, true) }
+
+func (d *outputDecoder) decodeStr(s *string, intern bool) bool {
+	if d.literal("null") {
+		return true
+	}
+	if !d.consume('"') {
+		return false
+	}
+	start := d.i
+	var escaped, nonASCII bool
+	for d.i < len(d.data) {
+		c := d.data[d.i]
+		switch {
+		case c == '"':
+			d.i++
+			b := d.data[start : d.i-1]
+			if !escaped && (!nonASCII || utf8.Valid(b)) {
+				if !intern {
+					*s = string(b)
+				} else if v, present := d.strs[string(b)]; present {
+					*s = v
+				} else {
+					if d.strs == nil {
+						d.strs = map[string]string{}
+					}
+					*s = string(b)
+					d.strs[*s] = *s
+				}
+				return true
+			}
+			// Let encoding/json handle escapes and replace invalid
+			// UTF-8.
+			return json.Unmarshal(d.data[start-1:d.i], s) == nil
+		case c == '\\':
+			escaped = true
+			d.i++ // skip the escaped char (which may be '"')
+		case c < 0x20:
+			return false
+		case c >= utf8.RuneSelf:
+			nonASCII = true
+		}
+		d.i++
+	}
+	return false
+}
+
+// uint32 decodes a number. Only integers without fractions or
+// exponents are handled.
+func (d *outputDecoder) uint32(v *uint32) bool {
+	if d.literal("null") {
+		return true
+	}
+	start := d.i
+	var n uint64
+	for d.i < len(d.data) && '0' <= d.data[d.i] && d.data[d.i] <= '9' {
+		n = n*10 + uint64(d.data[d.i]-'0')
+		if n > math.MaxUint32 {
+			return false
+		}
+		d.i++
+	}
+	if digits := d.i - start; digits == 0 || (digits > 1 && d.data[start] == '0') {
+		return false
+	}
+	// A fraction or exponent after the digits makes the caller fail
+	// to consume the delimiter that must follow a value.
+	*v = uint32(n)
+	return true
+}
+
+func (d *outputDecoder) bool(v *bool) bool {
+	switch {
+	case d.literal("true"):
+		*v = true
+	case d.literal("false"):
+		*v = false
+	case d.literal("null"):
+	default:
+		return false
+	}
+	return true
+}
+
+// rawMessage decodes a value as a json.RawMessage that refers to (and
+// doesn't copy) the input.
+func (d *outputDecoder) rawMessage(m *json.RawMessage) bool {
+	d.ws()
+	start := d.i
+	if !d.skip() || !json.Valid(d.data[start:d.i]) {
+		return false
+	}
+	// Limit the capacity so that appending to the message doesn't
+	// overwrite the rest of the input.
+	*m = d.data[start:d.i:d.i]
+	return true
+}
+
+// unmarshal decodes a value using json.Unmarshal, for the fields that
+// the decoder doesn't handle itself (which are rarely large).
+func (d *outputDecoder) unmarshal(v interface{}) bool {
+	d.ws()
+	start := d.i
+	return d.skip() && json.Unmarshal(d.data[start:d.i], v) == nil
+}
+
+// skip skips a value. It finds the end of valid values but doesn't
+// fully validate them; the caller must do that (e.g., using
+// json.Valid).
+func (d *outputDecoder) skip() bool {
+	d.ws()
+	if d.i == len(d.data) {
+		return false
+	}
+	switch d.data[d.i] {
+	case '{', '[':
+		depth := 0
+		for d.i < len(d.data) {
+			switch d.data[d.i] {
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					d.i++
+					return true
+				}
+			case '"':
+				if !d.skipString() {
+					return false
+				}
+				continue
+			}
+			d.i++
+		}
+		return false
+	case '"':
+		return d.skipString()
+	}
+	start := d.i
+	for d.i < len(d.data) && strings.IndexByte("+-.0123456789Eaeflnrstu", d.data[d.i]) != -1 {
+		d.i++
+	}
+	return d.i > start
+}
+
+// skipString skips a string.
+func (d *outputDecoder) skipString() bool {
+	d.i++ // opening quote
+	for d.i < len(d.data) {
+		switch d.data[d.i] {
+		case '"':
+			d.i++
+			return true
+		case '\\':
+			d.i++
+		}
+		d.i++
+	}
+	return false
+}
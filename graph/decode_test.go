@@ -0,0 +1,208 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// corpusFiles are the graph output fuzz corpora of other packages.
+func corpusFiles(t testing.TB) []string {
+	var files []string
+	for _, pat := range []string{"../grapher/testdata/fuzz/corpus/*", "../store/testdata/fuzz/corpus/*"} {
+		matches, err := filepath.Glob(pat)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		t.Fatal("no corpus files")
+	}
+	return files
+}
+
+// checkDecodeOutput checks that DecodeOutput decodes data the same
+// way as json.Unmarshal.
+func checkDecodeOutput(t *testing.T, label string, data []byte) {
+	var want Output
+	wantErr := json.Unmarshal(data, &want)
+	got, err := DecodeOutput(data)
+	if wantErr != nil {
+		if err == nil || err.Error() != wantErr.Error() {
+			t.Errorf("%s: got error %v, want %v", label, err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("%s: %s", label, err)
+		return
+	}
+	if !reflect.DeepEqual(*got, want) {
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("%s: got %s, want %s", label, gotJSON, wantJSON)
+	}
+}
+
+func TestDecodeOutput(t *testing.T) {
+	tests := map[string]string{
+		"empty object":     `{}`,
+		"null":             `null`,
+		"empty":            ``,
+		"nulls":            `{"Defs": null, "Refs": null, "Docs": null, "Anns": null}`,
+		"null elems":       `{"Defs": [null], "Refs": [null]}`,
+		"empty arrays":     `{"Defs": [], "Refs": []}`,
+		"def":              `{"Defs": [{"Repo": "r", "CommitID": "c", "UnitType": "t", "Unit": "u", "Path": "p", "Name": "n", "Kind": "k", "File": "f", "DefStart": 1, "DefEnd": 4294967295, "Exported": true, "Local": false, "Test": true, "TreePath": "./p", "Rank": 3}]}`,
+		"def data":         `{"Defs": [{"Path": "a", "Data": {"x": [1, "}"]}}, {"Path": "b", "Data": null}, {"Path": "c", "Data": "s"}]}`,
+		"def docs":         `{"Defs": [{"Path": "a", "Docs": [{"Format": "text/plain", "Data": "d"}], "Monikers": ["m"], "Snippet": {"StartLine": 1, "Start": 2, "Text": "t"}}]}`,
+		"def parent":       `{"Defs": [{"Path": "a"}, {"Path": "a/b", "ParentPath": "a"}]}`,
+		"def alias":        `{"Defs": [{"Path": "a", "AliasPath": "b"}, {"Path": "c", "AliasRepo": "r", "AliasUnitType": "t", "AliasUnit": "u", "AliasPath": "d"}]}`,
+		"ref":              `{"Refs": [{"DefRepo": "r", "DefUnitType": "t", "DefUnit": "u", "DefPath": "p", "Repo": "r2", "CommitID": "c", "UnitType": "t2", "Unit": "u2", "Def": true, "File": "f", "Start": 0, "End": 10, "EnclosingDef": "e", "Snippet": null, "Confidence": 0.25}]}`,
+		"docs and anns":    `{"Docs": [{"Path": "p", "Format": "text/plain", "Data": "d"}], "Anns": [{"File": "f", "Start": 1, "End": 2, "Type": "t"}]}`,
+		"warnings":         `{"Warnings": [{"File": "f", "Message": "m"}, {"Message": "m2"}]}`,
+		"files":            `{"Files": [{"File": "f", "Language": "go", "SLOC": 3, "DefCount": 2, "TopLevelDefs": ["a", "b"]}]}`,
+		"whitespace":       " \n{ \"Refs\" :\t[ { \"DefPath\" : \"p\" , \"Start\" : 1 } ] }\r\n",
+		"escapes":          `{"Refs": [{"DefPath": "a\"b\\c\né😀", "File": "\/f"}]}`,
+		"non-ASCII":        `{"Refs": [{"DefPath": "héllo 世界"}]}`,
+		"invalid UTF-8":    "{\"Refs\": [{\"DefPath\": \"a\xffb\"}]}",
+		"key case":         `{"refs": [{"defpath": "p", "START": 1}]}`,
+		"unknown key":      `{"Refs": [{"DefPath": "p", "Extra": [1, {"a": "b"}]}], "Other": 1}`,
+		"duplicate keys":   `{"Defs": [{"Path": "a", "Path": "b", "Snippet": {"Start": 1}, "Snippet": {"Text": "t"}}], "Refs": [{"DefPath": "a"}], "Refs": [{"File": "f"}]}`,
+		"numbers":          `{"Refs": [{"Start": 1.0, "End": 1e2}]}`,
+		"negative":         `{"Refs": [{"Start": -1}]}`,
+		"overflow":         `{"Refs": [{"Start": 4294967296}]}`,
+		"leading zero":     `{"Refs": [{"Start": 01}]}`,
+		"wrong types":      `{"Refs": [{"DefPath": 1, "Start": "1", "Def": "true"}]}`,
+		"null fields":      `{"Refs": [{"DefPath": null, "Start": null, "Def": null}]}`,
+		"not an object":    `[]`,
+		"trailing data":    `{} {}`,
+		"trailing comma":   `{"Refs": [{"DefPath": "p",}]}`,
+		"unterminated":     `{"Refs": [{"DefPath": "p`,
+		"invalid data":     `{"Defs": [{"Data": {"x": }}]}`,
+		"control char":     "{\"Refs\": [{\"DefPath\": \"a\tb\"}]}",
+		"bad literal":      `{"Refs": [{"Def": tru}]}`,
+		"bad docs":         `{"Docs": [1]}`,
+		"literal prefixes": `{"Refs": [{"Def": nullx}]}`,
+	}
+	for label, data := range tests {
+		checkDecodeOutput(t, label, []byte(data))
+	}
+}
+
+func TestDecodeOutputWarnings(t *testing.T) {
+	tests := []string{
+		`{}`,
+		`null`,
+		`{"Warnings": null}`,
+		`{"Defs": [{"Path": "a", "Data": {"x": ["]"]}}], "Refs": [{"DefPath": "p"}], "Warnings": [{"File": "f", "Message": "m", "Phase": "offsets", "Severity": "warning"}]}`,
+		`{"Warnings": [{"Message": "m"}], "Anns": []}`,
+		`{"warnings": [{"Message": "m"}]}`,
+		`{"Warnings": [{"Message": "a"}], "Warnings": [{"Phase": "p"}]}`,
+	}
+	for _, data := range tests {
+		want, err := DecodeOutput([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := DecodeOutputWarnings([]byte(data))
+		if err != nil {
+			t.Errorf("%s: %s", data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want.Warnings) {
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(want.Warnings)
+			t.Errorf("%s: got %s, want %s", data, gotJSON, wantJSON)
+		}
+	}
+
+	if _, err := DecodeOutputWarnings([]byte(`{"Warnings": 1}`)); err == nil {
+		t.Error("got no error for invalid warnings")
+	}
+}
+
+func TestDecodeOutput_corpus(t *testing.T) {
+	for _, file := range corpusFiles(t) {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkDecodeOutput(t, file, data)
+	}
+}
+
+// benchOutput returns the JSON encoding of graph output with n defs
+// and 10*n refs.
+func benchOutput(n int) []byte {
+	var o Output
+	for i := 0; i < n; i++ {
+		o.Defs = append(o.Defs, &Def{
+			DefKey:   DefKey{Path: fmt.Sprintf("pkg/Type%d/Method", i)},
+			Name:     "Method",
+			Kind:     "method",
+			File:     fmt.Sprintf("dir/file%d.go", i/10),
+			DefStart: uint32(i * 100),
+			DefEnd:   uint32(i*100 + 50),
+			Exported: true,
+			Data:     json.RawMessage(`{"Receiver":"*Type","Signature":"func (t *Type) Method() error"}`),
+		})
+		for j := 0; j < 10; j++ {
+			o.Refs = append(o.Refs, &Ref{
+				DefRepo: "example.com/repo",
+				DefPath: fmt.Sprintf("pkg/Type%d/Method", j),
+				File:    fmt.Sprintf("dir/file%d.go", i/10),
+				Start:   uint32(i*100 + j),
+				End:     uint32(i*100 + j + 6),
+			})
+		}
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func BenchmarkDecodeOutput(b *testing.B) {
+	data := benchOutput(1000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeOutput(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeOutput_jsonUnmarshal(b *testing.B) {
+	data := benchOutput(1000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var o Output
+		if err := json.Unmarshal(data, &o); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeOutput_corpus(b *testing.B) {
+	var datas [][]byte
+	for _, file := range corpusFiles(b) {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		datas = append(datas, data)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, data := range datas {
+			DecodeOutput(data)
+		}
+	}
+}
@@ -15,6 +15,7 @@
 		DefKey
 		Def
 		DefDoc
+		Snippet
 */
 package graph;import "encoding/json"
 
@@ -132,6 +133,38 @@ type Def struct {
 	// tree-path for some def.
 	// The following regex captures the children of a tree-path X: X(/-[^/]*)*(/[^/-][^/]*)
 	TreePath string `protobuf:"bytes,17,opt,name=tree_path" json:"TreePath,omitempty"`
+	// Rank is a ranking signal used to order search results (higher
+	// is better). It is computed when the def is imported into a
+	// store (see ComputeDefRanks); graphers should not set it.
+	Rank uint32 `protobuf:"varint,18,opt,name=rank" json:"Rank,omitempty"`
+	// Monikers are language-independent names of the IDL definitions
+	// (such as Protocol Buffers messages or Thrift structs) that this
+	// def is or was generated from (see ProtoMoniker and
+	// ThriftMoniker). Defs in different languages with a moniker in
+	// common are linked.
+	Monikers []string `protobuf:"bytes,19,rep,name=monikers" json:"Monikers,omitempty"`
+	// Snippet is the source code around the def's first line. It is
+	// not stored; it is set only in the results of queries that
+	// request context lines (such as "src store defs
+	// --context-lines").
+	Snippet *Snippet `protobuf:"bytes,20,opt,name=snippet" json:"Snippet,omitempty"`
+	// ParentPath is the path of the def (in the same source unit) that
+	// this def is nested in, such as the class of a method or the
+	// function of a nested function. It is empty for top-level defs.
+	// It lets clients reconstruct the hierarchy of defs in a file
+	// (see Outline) without parsing def paths.
+	ParentPath string `protobuf:"bytes,21,opt,name=parent_path" json:"ParentPath,omitempty"`
+	// AliasPath, if set, is the path of the def that this def is an
+	// alias of, such as a name imported and re-exported by a Python
+	// "from x import y" or an ES module "export { y } from 'x'", or a
+	// Go type alias. Refs to an alias may be resolved through to the
+	// original def (see AliasOf). AliasRepo, AliasUnitType, and
+	// AliasUnit are the original def's repository and source unit; if
+	// empty, they are the same as this def's.
+	AliasRepo     string `protobuf:"bytes,22,opt,name=alias_repo" json:"AliasRepo,omitempty"`
+	AliasUnitType string `protobuf:"bytes,23,opt,name=alias_unit_type" json:"AliasUnitType,omitempty"`
+	AliasUnit     string `protobuf:"bytes,24,opt,name=alias_unit" json:"AliasUnit,omitempty"`
+	AliasPath     string `protobuf:"bytes,25,opt,name=alias_path" json:"AliasPath,omitempty"`
 }
 // END Def OMIT
 
@@ -153,6 +186,24 @@ func (m *DefDoc) Reset()         { *m = DefDoc{} }
 func (m *DefDoc) String() string { return proto.CompactTextString(m) }
 func (*DefDoc) ProtoMessage()    {}
 
+// Snippet is an excerpt of the source code around a def or ref, so
+// that clients can display query results without fetching the files
+// that they're in.
+type Snippet struct {
+	// StartLine is the (1-based) line number of Text's first line.
+	StartLine uint32 `protobuf:"varint,1,opt,name=start_line" json:"StartLine"`
+	// Start is the byte offset in the file of Text's first byte.
+	Start uint32 `protobuf:"varint,2,opt,name=start" json:"Start"`
+	// Text is the lines of the file that contain the def or ref, with
+	// the requested number of context lines before and after them.
+	// It doesn't end with a newline.
+	Text string `protobuf:"bytes,3,opt,name=text" json:"Text"`
+}
+
+func (m *Snippet) Reset()         { *m = Snippet{} }
+func (m *Snippet) String() string { return proto.CompactTextString(m) }
+func (*Snippet) ProtoMessage()    {}
+
 func init() {
 }
 func (m *DefKey) Unmarshal(data []byte) error {
@@ -563,6 +614,180 @@ func (m *Def) Unmarshal(data []byte) error {
 			}
 			m.TreePath = string(data[index:postIndex])
 			index = postIndex
+		case 18:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Rank", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.Rank |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 19:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Monikers", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Monikers = append(m.Monikers, string(data[index:postIndex]))
+			index = postIndex
+		case 20:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Snippet", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Snippet == nil {
+				m.Snippet = &Snippet{}
+			}
+			if err := m.Snippet.Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
+		case 21:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field ParentPath", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.ParentPath = string(data[index:postIndex])
+			index = postIndex
+		case 22:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AliasRepo", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.AliasRepo = string(data[index:postIndex])
+			index = postIndex
+		case 23:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AliasUnitType", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.AliasUnitType = string(data[index:postIndex])
+			index = postIndex
+		case 24:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AliasUnit", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.AliasUnit = string(data[index:postIndex])
+			index = postIndex
+		case 25:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field AliasPath", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.AliasPath = string(data[index:postIndex])
+			index = postIndex
 		default:
 			var sizeOfWire int
 			for {
@@ -670,6 +895,99 @@ func (m *DefDoc) Unmarshal(data []byte) error {
 	}
 	return nil
 }
+func (m *Snippet) Unmarshal(data []byte) error {
+	l := len(data)
+	index := 0
+	for index < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if index >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[index]
+			index++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field StartLine", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.StartLine |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Start", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.Start |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Text", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Text = string(data[index:postIndex])
+			index = postIndex
+		default:
+			var sizeOfWire int
+			for {
+				sizeOfWire++
+				wire >>= 7
+				if wire == 0 {
+					break
+				}
+			}
+			index -= sizeOfWire
+			skippy, err := github_com_gogo_protobuf_proto.Skip(data[index:])
+			if err != nil {
+				return err
+			}
+			if (index + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			index += skippy
+		}
+	}
+	return nil
+}
 func (m *DefKey) Size() (n int) {
 	var l int
 	_ = l
@@ -714,6 +1032,27 @@ func (m *Def) Size() (n int) {
 	}
 	l = len(m.TreePath)
 	n += 2 + l + sovDef(uint64(l))
+	n += 2 + sovDef(uint64(m.Rank))
+	if len(m.Monikers) > 0 {
+		for _, s := range m.Monikers {
+			l = len(s)
+			n += 2 + l + sovDef(uint64(l))
+		}
+	}
+	if m.Snippet != nil {
+		l = m.Snippet.Size()
+		n += 2 + l + sovDef(uint64(l))
+	}
+	l = len(m.ParentPath)
+	n += 2 + l + sovDef(uint64(l))
+	l = len(m.AliasRepo)
+	n += 2 + l + sovDef(uint64(l))
+	l = len(m.AliasUnitType)
+	n += 2 + l + sovDef(uint64(l))
+	l = len(m.AliasUnit)
+	n += 2 + l + sovDef(uint64(l))
+	l = len(m.AliasPath)
+	n += 2 + l + sovDef(uint64(l))
 	return n
 }
 
@@ -727,6 +1066,16 @@ func (m *DefDoc) Size() (n int) {
 	return n
 }
 
+func (m *Snippet) Size() (n int) {
+	var l int
+	_ = l
+	n += 1 + sovDef(uint64(m.StartLine))
+	n += 1 + sovDef(uint64(m.Start))
+	l = len(m.Text)
+	n += 1 + l + sovDef(uint64(l))
+	return n
+}
+
 func sovDef(x uint64) (n int) {
 	for {
 		n++
@@ -867,6 +1216,70 @@ func (m *Def) MarshalTo(data []byte) (n int, err error) {
 	i++
 	i = encodeVarintDef(data, i, uint64(len(m.TreePath)))
 	i += copy(data[i:], m.TreePath)
+	data[i] = 0x90
+	i++
+	data[i] = 0x1
+	i++
+	i = encodeVarintDef(data, i, uint64(m.Rank))
+	if len(m.Monikers) > 0 {
+		for _, s := range m.Monikers {
+			data[i] = 0x9a
+			i++
+			data[i] = 0x1
+			i++
+			l = len(s)
+			for l >= 1<<7 {
+				data[i] = uint8(uint64(l)&0x7f | 0x80)
+				l >>= 7
+				i++
+			}
+			data[i] = uint8(l)
+			i++
+			i += copy(data[i:], s)
+		}
+	}
+	if m.Snippet != nil {
+		data[i] = 0xa2
+		i++
+		data[i] = 0x1
+		i++
+		i = encodeVarintDef(data, i, uint64(m.Snippet.Size()))
+		n2, err := m.Snippet.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n2
+	}
+	data[i] = 0xaa
+	i++
+	data[i] = 0x1
+	i++
+	i = encodeVarintDef(data, i, uint64(len(m.ParentPath)))
+	i += copy(data[i:], m.ParentPath)
+	data[i] = 0xb2
+	i++
+	data[i] = 0x1
+	i++
+	i = encodeVarintDef(data, i, uint64(len(m.AliasRepo)))
+	i += copy(data[i:], m.AliasRepo)
+	data[i] = 0xba
+	i++
+	data[i] = 0x1
+	i++
+	i = encodeVarintDef(data, i, uint64(len(m.AliasUnitType)))
+	i += copy(data[i:], m.AliasUnitType)
+	data[i] = 0xc2
+	i++
+	data[i] = 0x1
+	i++
+	i = encodeVarintDef(data, i, uint64(len(m.AliasUnit)))
+	i += copy(data[i:], m.AliasUnit)
+	data[i] = 0xca
+	i++
+	data[i] = 0x1
+	i++
+	i = encodeVarintDef(data, i, uint64(len(m.AliasPath)))
+	i += copy(data[i:], m.AliasPath)
 	return i, nil
 }
 
@@ -896,6 +1309,34 @@ func (m *DefDoc) MarshalTo(data []byte) (n int, err error) {
 	return i, nil
 }
 
+func (m *Snippet) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *Snippet) MarshalTo(data []byte) (n int, err error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	data[i] = 0x8
+	i++
+	i = encodeVarintDef(data, i, uint64(m.StartLine))
+	data[i] = 0x10
+	i++
+	i = encodeVarintDef(data, i, uint64(m.Start))
+	data[i] = 0x1a
+	i++
+	i = encodeVarintDef(data, i, uint64(len(m.Text)))
+	i += copy(data[i:], m.Text)
+	return i, nil
+}
+
 func encodeFixed64Def(data []byte, offset int, v uint64) int {
 	data[offset] = uint8(v)
 	data[offset+1] = uint8(v >> 8)
@@ -951,7 +1392,15 @@ func (this *Def) GoString() string {
 		`Test:` + fmt.Sprintf("%#v", this.Test),
 		`Data:` + fmt.Sprintf("%#v", this.Data),
 		`Docs:` + strings.Replace(fmt.Sprintf("%#v", this.Docs), `&`, ``, 1),
-		`TreePath:` + fmt.Sprintf("%#v", this.TreePath) + `}`}, ", ")
+		`TreePath:` + fmt.Sprintf("%#v", this.TreePath),
+		`Rank:` + fmt.Sprintf("%#v", this.Rank),
+		`Monikers:` + fmt.Sprintf("%#v", this.Monikers),
+		`Snippet:` + fmt.Sprintf("%#v", this.Snippet),
+		`ParentPath:` + fmt.Sprintf("%#v", this.ParentPath),
+		`AliasRepo:` + fmt.Sprintf("%#v", this.AliasRepo),
+		`AliasUnitType:` + fmt.Sprintf("%#v", this.AliasUnitType),
+		`AliasUnit:` + fmt.Sprintf("%#v", this.AliasUnit),
+		`AliasPath:` + fmt.Sprintf("%#v", this.AliasPath) + `}`}, ", ")
 	return s
 }
 func (this *DefDoc) GoString() string {
@@ -963,6 +1412,16 @@ func (this *DefDoc) GoString() string {
 		`Data:` + fmt.Sprintf("%#v", this.Data) + `}`}, ", ")
 	return s
 }
+func (this *Snippet) GoString() string {
+	if this == nil {
+		return "nil"
+	}
+	s := strings.Join([]string{`&graph.Snippet{` +
+		`StartLine:` + fmt.Sprintf("%#v", this.StartLine),
+		`Start:` + fmt.Sprintf("%#v", this.Start),
+		`Text:` + fmt.Sprintf("%#v", this.Text) + `}`}, ", ")
+	return s
+}
 func valueToGoStringDef(v interface{}, typ string) string {
 	rv := reflect.ValueOf(v)
 	if rv.IsNil() {
@@ -0,0 +1,61 @@
+package graph
+
+import "sort"
+
+// SetEnclosingDefs sets the EnclosingDef of each ref to the path of
+// the innermost def (of defs, which must be in the same source unit as
+// the refs) whose definition (DefStart to DefEnd in the same file)
+// contains the ref. The def that a ref names (for refs with Def set)
+// doesn't enclose the ref; the next def out does.
+//
+// It is used to group refs by the function or class that they occur
+// in (e.g., "used in Foo.Bar").
+func SetEnclosingDefs(defs []*Def, refs []*Ref) {
+	defsByFile := map[string][]*Def{}
+	for _, def := range defs {
+		if def.File != "" && def.DefStart < def.DefEnd {
+			defsByFile[def.File] = append(defsByFile[def.File], def)
+		}
+	}
+	refsByFile := map[string][]*Ref{}
+	for _, ref := range refs {
+		ref.EnclosingDef = ""
+		if _, present := defsByFile[ref.File]; present {
+			refsByFile[ref.File] = append(refsByFile[ref.File], ref)
+		}
+	}
+
+	for file, refs := range refsByFile {
+		defs := defsByFile[file]
+		// Outer defs come before the defs nested in them.
+		sort.SliceStable(defs, func(i, j int) bool {
+			if defs[i].DefStart != defs[j].DefStart {
+				return defs[i].DefStart < defs[j].DefStart
+			}
+			return defs[i].DefEnd > defs[j].DefEnd
+		})
+		sort.SliceStable(refs, func(i, j int) bool { return refs[i].Start < refs[j].Start })
+
+		// Sweep through the refs in order, keeping a stack of the
+		// defs that started before the current ref and haven't ended.
+		var open []*Def
+		next := 0
+		for _, ref := range refs {
+			for next < len(defs) && defs[next].DefStart <= ref.Start {
+				open = append(open, defs[next])
+				next++
+			}
+			for len(open) > 0 && open[len(open)-1].DefEnd <= ref.Start {
+				open = open[:len(open)-1]
+			}
+			for i := len(open) - 1; i >= 0; i-- {
+				def := open[i]
+				if ref.Start >= def.DefEnd || ref.End > def.DefEnd || (ref.Def && ref.DefPath == def.Path) {
+					continue
+				}
+				ref.EnclosingDef = def.Path
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package graph
+
+import "testing"
+
+func TestSetEnclosingDefs(t *testing.T) {
+	def := func(path, file string, start, end uint32) *Def {
+		return &Def{DefKey: DefKey{Path: path}, File: file, DefStart: start, DefEnd: end}
+	}
+	defs := []*Def{
+		def("T/m", "a.go", 20, 40),
+		def("T", "a.go", 10, 50),
+		def("F", "a.go", 60, 80),
+		def("G", "b.go", 0, 100),
+		def("V", "a.go", 90, 90), // empty span
+	}
+	refs := []*Ref{
+		{File: "a.go", Start: 0, End: 5},
+		{File: "a.go", Start: 25, End: 28},
+		{File: "a.go", Start: 15, End: 18},
+		{File: "a.go", Start: 45, End: 48},
+		{File: "a.go", Start: 20, End: 21, Def: true, DefPath: "T/m"},
+		{File: "a.go", Start: 10, End: 11, Def: true, DefPath: "T"},
+		{File: "a.go", Start: 39, End: 45},
+		{File: "a.go", Start: 50, End: 52},
+		{File: "a.go", Start: 70, End: 71, EnclosingDef: "stale"},
+		{File: "a.go", Start: 85, End: 95, EnclosingDef: "stale"},
+		{File: "b.go", Start: 5, End: 6},
+		{File: "c.go", Start: 5, End: 6, EnclosingDef: "stale"},
+	}
+	want := []string{"", "T/m", "T", "T", "T", "", "T", "", "F", "", "G", ""}
+
+	SetEnclosingDefs(defs, refs)
+	for i, ref := range refs {
+		if ref.EnclosingDef != want[i] {
+			t.Errorf("ref %d (%s:%d-%d): got EnclosingDef %q, want %q", i, ref.File, ref.Start, ref.End, ref.EnclosingDef, want[i])
+		}
+	}
+}
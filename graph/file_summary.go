@@ -0,0 +1,16 @@
+package graph
+
+type FileSummaries []*FileSummary
+
+func (vs FileSummaries) Len() int      { return len(vs) }
+func (vs FileSummaries) Swap(i, j int) { vs[i], vs[j] = vs[j], vs[i] }
+func (vs FileSummaries) Less(i, j int) bool {
+	a, b := vs[i], vs[j]
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	return a.Unit < b.Unit
+}
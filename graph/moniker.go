@@ -0,0 +1,65 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Moniker schemes, which identify the IDL that a moniker's definition
+// is written in.
+const (
+	ProtoMonikerScheme  = "proto"
+	ThriftMonikerScheme = "thrift"
+)
+
+// ProtoMoniker returns the moniker of the Protocol Buffers definition
+// (message, enum, service, etc.) with the given fully qualified name
+// (such as "google.protobuf.Timestamp", or "Outer.Inner" for a nested
+// message in a file with no package). Graphers for .proto files should
+// set it on the defs of definitions, and graphers for other languages
+// should set it on the defs of code generated from them.
+func ProtoMoniker(fullName string) string {
+	return ProtoMonikerScheme + ":" + strings.TrimPrefix(fullName, ".")
+}
+
+// ThriftMoniker returns the moniker of the Thrift definition with the
+// given name in the given namespace (which is usually the name of the
+// .thrift file without its extension).
+func ThriftMoniker(namespace, name string) string {
+	return ThriftMonikerScheme + ":" + namespace + "." + name
+}
+
+// ParseMoniker splits a moniker into its scheme and name.
+func ParseMoniker(moniker string) (scheme, name string, err error) {
+	i := strings.Index(moniker, ":")
+	if i <= 0 || i == len(moniker)-1 {
+		return "", "", fmt.Errorf("invalid moniker %q (want scheme:name)", moniker)
+	}
+	return moniker[:i], moniker[i+1:], nil
+}
+
+// HasMoniker returns whether moniker is one of def's monikers.
+func (def *Def) HasMoniker(moniker string) bool {
+	for _, m := range def.Monikers {
+		if m == moniker {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeMonikers sorts and removes duplicates from def's monikers.
+func (def *Def) NormalizeMonikers() {
+	if len(def.Monikers) == 0 {
+		return
+	}
+	sort.Strings(def.Monikers)
+	ms := def.Monikers[:1]
+	for _, m := range def.Monikers[1:] {
+		if m != ms[len(ms)-1] {
+			ms = append(ms, m)
+		}
+	}
+	def.Monikers = ms
+}
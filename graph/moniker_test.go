@@ -0,0 +1,34 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMonikers(t *testing.T) {
+	if m := ProtoMoniker(".acme.Widget"); m != "proto:acme.Widget" {
+		t.Errorf("got proto moniker %q", m)
+	}
+	if m := ThriftMoniker("acme", "Widget"); m != "thrift:acme.Widget" {
+		t.Errorf("got thrift moniker %q", m)
+	}
+
+	scheme, name, err := ParseMoniker("proto:acme.Widget")
+	if err != nil || scheme != "proto" || name != "acme.Widget" {
+		t.Errorf("got %q, %q, %v", scheme, name, err)
+	}
+	for _, m := range []string{"", "acme.Widget", ":x", "proto:"} {
+		if _, _, err := ParseMoniker(m); err == nil {
+			t.Errorf("%q: got no error", m)
+		}
+	}
+
+	def := &Def{Monikers: []string{"proto:b", "proto:a", "proto:b"}}
+	def.NormalizeMonikers()
+	if want := []string{"proto:a", "proto:b"}; !reflect.DeepEqual(def.Monikers, want) {
+		t.Errorf("got monikers %q, want %q", def.Monikers, want)
+	}
+	if !def.HasMoniker("proto:a") || def.HasMoniker("proto:c") {
+		t.Error("HasMoniker returned wrong result")
+	}
+}
@@ -0,0 +1,133 @@
+package graph
+
+import "sort"
+
+// A DefNode is a def in an outline (see Outline), with the defs that
+// are nested in it.
+type DefNode struct {
+	Def      *Def
+	Children []*DefNode `json:",omitempty"`
+}
+
+// Outline returns the hierarchy of defs (typically the defs in a
+// file), like an editor's document symbol tree: each def is a child
+// of the def named by its ParentPath (in the same source unit), and
+// defs whose parent isn't in defs are roots. Each level is sorted by
+// position.
+//
+// If none of the defs has a ParentPath (because their grapher doesn't
+// emit it), the hierarchy is inferred from the defs' spans instead:
+// each def is a child of the innermost def whose definition contains
+// it.
+func Outline(defs []*Def) []*DefNode {
+	nodes := make(map[DefKey]*DefNode, len(defs))
+	hasParents := false
+	for _, def := range defs {
+		nodes[def.DefKey] = &DefNode{Def: def}
+		if def.ParentPath != "" {
+			hasParents = true
+		}
+	}
+
+	var roots []*DefNode
+	if hasParents {
+		for _, def := range defs {
+			node := nodes[def.DefKey]
+			if parent := parentNode(nodes, def); parent != nil {
+				parent.Children = append(parent.Children, node)
+			} else {
+				roots = append(roots, node)
+			}
+		}
+	} else {
+		roots = outlineBySpans(defs, nodes)
+	}
+	sortDefNodes(roots)
+	return roots
+}
+
+// parentNode returns the node of def's parent, or nil if def has no
+// parent in nodes or is in a ParentPath cycle.
+func parentNode(nodes map[DefKey]*DefNode, def *Def) *DefNode {
+	if def.ParentPath == "" {
+		return nil
+	}
+	key := def.DefKey
+	key.Path = def.ParentPath
+	parent := nodes[key]
+	if parent == nil {
+		return nil
+	}
+	for p, n := parent.Def, 0; p.ParentPath != "" && n < len(nodes); n++ {
+		if p.ParentPath == def.Path {
+			return nil
+		}
+		key.Path = p.ParentPath
+		pn := nodes[key]
+		if pn == nil {
+			break
+		}
+		p = pn.Def
+	}
+	return parent
+}
+
+// outlineBySpans nests the nodes of defs by their definitions' spans,
+// and returns the roots.
+func outlineBySpans(defs []*Def, nodes map[DefKey]*DefNode) []*DefNode {
+	sorted := make([]*Def, len(defs))
+	copy(sorted, defs)
+	// Outer defs come before the defs nested in them.
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.DefStart != b.DefStart {
+			return a.DefStart < b.DefStart
+		}
+		return a.DefEnd > b.DefEnd
+	})
+
+	var roots []*DefNode
+	var open []*Def // defs that contain the current def
+	for _, def := range sorted {
+		node := nodes[def.DefKey]
+		if def.DefStart >= def.DefEnd {
+			roots = append(roots, node)
+			continue
+		}
+		for len(open) > 0 && (open[len(open)-1].File != def.File || open[len(open)-1].DefEnd <= def.DefStart) {
+			open = open[:len(open)-1]
+		}
+		if len(open) > 0 && def.DefEnd <= open[len(open)-1].DefEnd {
+			parent := nodes[open[len(open)-1].DefKey]
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+		open = append(open, def)
+	}
+	return roots
+}
+
+// sortDefNodes sorts nodes (and their descendants) by file and
+// position.
+func sortDefNodes(nodes []*DefNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i].Def, nodes[j].Def
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.DefStart != b.DefStart {
+			return a.DefStart < b.DefStart
+		}
+		if a.DefEnd != b.DefEnd {
+			return a.DefEnd > b.DefEnd
+		}
+		return a.Path < b.Path
+	})
+	for _, n := range nodes {
+		sortDefNodes(n.Children)
+	}
+}
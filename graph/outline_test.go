@@ -0,0 +1,80 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// outlineString returns a compact representation of an outline, such
+// as "A(A/m1 A/m2) B".
+func outlineString(nodes []*DefNode) string {
+	var s []string
+	for _, n := range nodes {
+		if len(n.Children) > 0 {
+			s = append(s, fmt.Sprintf("%s(%s)", n.Def.Path, outlineString(n.Children)))
+		} else {
+			s = append(s, n.Def.Path)
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+func TestOutline(t *testing.T) {
+	tests := map[string]struct {
+		defs []*Def
+		want string
+	}{
+		"none": {nil, ""},
+		"parents": {
+			[]*Def{
+				{DefKey: DefKey{Path: "A/m2"}, ParentPath: "A", DefStart: 30, DefEnd: 40},
+				{DefKey: DefKey{Path: "A"}, DefStart: 0, DefEnd: 50},
+				{DefKey: DefKey{Path: "A/m1"}, ParentPath: "A", DefStart: 10, DefEnd: 20},
+				{DefKey: DefKey{Path: "A/m1/f"}, ParentPath: "A/m1", DefStart: 12, DefEnd: 18},
+				{DefKey: DefKey{Path: "B"}, DefStart: 60, DefEnd: 70},
+			},
+			"A(A/m1(A/m1/f) A/m2) B",
+		},
+		"parent not in defs": {
+			[]*Def{
+				{DefKey: DefKey{Path: "T.M"}, ParentPath: "T", DefStart: 10, DefEnd: 20}, // T is in another file
+				{DefKey: DefKey{Path: "F"}, DefStart: 0, DefEnd: 5},
+			},
+			"F T.M",
+		},
+		"parent in another unit": {
+			[]*Def{
+				{DefKey: DefKey{Unit: "u1", Path: "A"}, DefStart: 0, DefEnd: 50},
+				{DefKey: DefKey{Unit: "u2", Path: "A/m"}, ParentPath: "A", DefStart: 10, DefEnd: 20},
+			},
+			"A A/m",
+		},
+		"cycle": {
+			[]*Def{
+				{DefKey: DefKey{Path: "a"}, ParentPath: "b", DefStart: 0, DefEnd: 1},
+				{DefKey: DefKey{Path: "b"}, ParentPath: "a", DefStart: 2, DefEnd: 3},
+				{DefKey: DefKey{Path: "c"}, ParentPath: "c", DefStart: 4, DefEnd: 5},
+				{DefKey: DefKey{Path: "d"}, ParentPath: "a", DefStart: 6, DefEnd: 7},
+			},
+			"a(d) b c", // d is nested in a, which is a root since it is in a cycle
+		},
+		"spans": {
+			[]*Def{
+				{DefKey: DefKey{Path: "A.m"}, DefStart: 10, DefEnd: 20},
+				{DefKey: DefKey{Path: "A"}, DefStart: 0, DefEnd: 50},
+				{DefKey: DefKey{Path: "A.m.x"}, DefStart: 12, DefEnd: 13},
+				{DefKey: DefKey{Path: "A.n"}, DefStart: 30, DefEnd: 50},
+				{DefKey: DefKey{Path: "B"}, DefStart: 50, DefEnd: 60},
+				{DefKey: DefKey{Path: "C"}, DefStart: 55, DefEnd: 65}, // overlaps B
+				{DefKey: DefKey{Path: "D"}},                           // no span
+			},
+			"A(A.m(A.m.x) A.n) D B C",
+		},
+	}
+	for label, test := range tests {
+		if got := outlineString(Outline(test.defs)); got != test.want {
+			t.Errorf("%s: got %q, want %q", label, got, test.want)
+		}
+	}
+}
@@ -26,6 +26,8 @@ type Output struct {
 	Refs []*Ref                                        `protobuf:"bytes,2,rep,name=refs" json:"Refs,omitempty"`
 	Docs []*Doc                                        `protobuf:"bytes,3,rep,name=docs" json:"Docs,omitempty"`
 	Anns []*ann.Ann `protobuf:"bytes,4,rep,name=anns,customtype=sourcegraph.com/sourcegraph/srclib/ann.Ann" json:"Anns,omitempty"`
+	Warnings []*Warning                                `protobuf:"bytes,5,rep,name=warnings" json:"Warnings,omitempty"`
+	Files    []*FileSummary                            `protobuf:"bytes,6,rep,name=files" json:"Files,omitempty"`
 }
 // END Output OMIT
 
@@ -33,6 +35,58 @@ func (m *Output) Reset()         { *m = Output{} }
 func (m *Output) String() string { return proto.CompactTextString(m) }
 func (*Output) ProtoMessage()    {}
 
+// A Warning describes a non-fatal problem with the output that a
+// toolchain or NormalizeData found (and tolerated), such as a file
+// that couldn't be parsed or that was deleted after the grapher ran.
+type Warning struct {
+	// File is the file that the warning pertains to, if any.
+	File string `protobuf:"bytes,1,opt,name=file" json:"File,omitempty"`
+	// Message describes the problem.
+	Message string `protobuf:"bytes,2,opt,name=message" json:"Message"`
+	// Phase is the step that found the problem: "graph" (the
+	// toolchain's grapher, the default) or a NormalizeData step (such
+	// as "offsets").
+	Phase string `protobuf:"bytes,3,opt,name=phase" json:"Phase"`
+	// Severity is SeverityInfo, SeverityWarning (the default), or
+	// SeverityError.
+	Severity string `protobuf:"bytes,4,opt,name=severity" json:"Severity"`
+	// UnitType and Unit are the source unit whose output the warning
+	// is about. They are set when the output is imported.
+	UnitType string `protobuf:"bytes,5,opt,name=unit_type" json:"UnitType,omitempty"`
+	Unit     string `protobuf:"bytes,6,opt,name=unit" json:"Unit,omitempty"`
+}
+
+func (m *Warning) Reset()         { *m = Warning{} }
+func (m *Warning) String() string { return proto.CompactTextString(m) }
+func (*Warning) ProtoMessage()    {}
+
+// A FileSummary summarizes a file in a source unit's output, so that
+// files and directories can be browsed without scanning their defs.
+// FileSummaries are computed by NormalizeData (for each file that the
+// output refers to); graphers should not emit them.
+type FileSummary struct {
+	File string `protobuf:"bytes,1,opt,name=file" json:"File"`
+	// Language is the programming language of the file (based on its
+	// extension; see grapher.FileLanguage), or empty if it is unknown.
+	Language string `protobuf:"bytes,2,opt,name=language" json:"Language,omitempty"`
+	// SLOC is the number of source lines (lines that aren't blank) in
+	// the file. It is 0 if the file couldn't be read.
+	SLOC uint32 `protobuf:"varint,3,opt,name=sloc" json:"SLOC"`
+	// DefCount is the number of defs in the file.
+	DefCount uint32 `protobuf:"varint,4,opt,name=def_count" json:"DefCount"`
+	// TopLevelDefs are the paths of the non-local defs in the file that
+	// aren't nested in other defs (see Outline), in order of position.
+	TopLevelDefs []string `protobuf:"bytes,5,rep,name=top_level_defs" json:"TopLevelDefs,omitempty"`
+	// UnitType and Unit are the source unit whose output the summary
+	// is from. They are set when the output is imported.
+	UnitType string `protobuf:"bytes,6,opt,name=unit_type" json:"UnitType,omitempty"`
+	Unit     string `protobuf:"bytes,7,opt,name=unit" json:"Unit,omitempty"`
+}
+
+func (m *FileSummary) Reset()         { *m = FileSummary{} }
+func (m *FileSummary) String() string { return proto.CompactTextString(m) }
+func (*FileSummary) ProtoMessage()    {}
+
 func init() {
 }
 func (m *Output) Unmarshal(data []byte) error {
@@ -146,6 +200,406 @@ func (m *Output) Unmarshal(data []byte) error {
 			m.Anns = append(m.Anns, &ann.Ann{})
 			m.Anns[len(m.Anns)-1].Unmarshal(data[index:postIndex])
 			index = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Warnings", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Warnings = append(m.Warnings, &Warning{})
+			m.Warnings[len(m.Warnings)-1].Unmarshal(data[index:postIndex])
+			index = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Files", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Files = append(m.Files, &FileSummary{})
+			m.Files[len(m.Files)-1].Unmarshal(data[index:postIndex])
+			index = postIndex
+		default:
+			var sizeOfWire int
+			for {
+				sizeOfWire++
+				wire >>= 7
+				if wire == 0 {
+					break
+				}
+			}
+			index -= sizeOfWire
+			skippy, err := github_com_gogo_protobuf_proto.Skip(data[index:])
+			if err != nil {
+				return err
+			}
+			if (index + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			index += skippy
+		}
+	}
+	return nil
+}
+func (m *Warning) Unmarshal(data []byte) error {
+	l := len(data)
+	index := 0
+	for index < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if index >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[index]
+			index++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field File", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.File = string(data[index:postIndex])
+			index = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Message", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Message = string(data[index:postIndex])
+			index = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Phase", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Phase = string(data[index:postIndex])
+			index = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Severity", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Severity = string(data[index:postIndex])
+			index = postIndex
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field UnitType", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.UnitType = string(data[index:postIndex])
+			index = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Unit", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Unit = string(data[index:postIndex])
+			index = postIndex
+		default:
+			var sizeOfWire int
+			for {
+				sizeOfWire++
+				wire >>= 7
+				if wire == 0 {
+					break
+				}
+			}
+			index -= sizeOfWire
+			skippy, err := github_com_gogo_protobuf_proto.Skip(data[index:])
+			if err != nil {
+				return err
+			}
+			if (index + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			index += skippy
+		}
+	}
+	return nil
+}
+func (m *FileSummary) Unmarshal(data []byte) error {
+	l := len(data)
+	index := 0
+	for index < l {
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if index >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := data[index]
+			index++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field File", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.File = string(data[index:postIndex])
+			index = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Language", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Language = string(data[index:postIndex])
+			index = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field SLOC", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.SLOC |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DefCount", wireType)
+			}
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				m.DefCount |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TopLevelDefs", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.TopLevelDefs = append(m.TopLevelDefs, string(data[index:postIndex]))
+			index = postIndex
+		case 6:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field UnitType", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.UnitType = string(data[index:postIndex])
+			index = postIndex
+		case 7:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Unit", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Unit = string(data[index:postIndex])
+			index = postIndex
 		default:
 			var sizeOfWire int
 			for {
@@ -195,6 +649,56 @@ func (m *Output) Size() (n int) {
 			n += 1 + l + sovOutput(uint64(l))
 		}
 	}
+	if len(m.Warnings) > 0 {
+		for _, e := range m.Warnings {
+			l = e.Size()
+			n += 1 + l + sovOutput(uint64(l))
+		}
+	}
+	if len(m.Files) > 0 {
+		for _, e := range m.Files {
+			l = e.Size()
+			n += 1 + l + sovOutput(uint64(l))
+		}
+	}
+	return n
+}
+func (m *Warning) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.File)
+	n += 1 + l + sovOutput(uint64(l))
+	l = len(m.Message)
+	n += 1 + l + sovOutput(uint64(l))
+	l = len(m.Phase)
+	n += 1 + l + sovOutput(uint64(l))
+	l = len(m.Severity)
+	n += 1 + l + sovOutput(uint64(l))
+	l = len(m.UnitType)
+	n += 1 + l + sovOutput(uint64(l))
+	l = len(m.Unit)
+	n += 1 + l + sovOutput(uint64(l))
+	return n
+}
+func (m *FileSummary) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.File)
+	n += 1 + l + sovOutput(uint64(l))
+	l = len(m.Language)
+	n += 1 + l + sovOutput(uint64(l))
+	n += 1 + sovOutput(uint64(m.SLOC))
+	n += 1 + sovOutput(uint64(m.DefCount))
+	if len(m.TopLevelDefs) > 0 {
+		for _, s := range m.TopLevelDefs {
+			l = len(s)
+			n += 1 + l + sovOutput(uint64(l))
+		}
+	}
+	l = len(m.UnitType)
+	n += 1 + l + sovOutput(uint64(l))
+	l = len(m.Unit)
+	n += 1 + l + sovOutput(uint64(l))
 	return n
 }
 
@@ -274,6 +778,127 @@ func (m *Output) MarshalTo(data []byte) (n int, err error) {
 			i += n
 		}
 	}
+	if len(m.Warnings) > 0 {
+		for _, msg := range m.Warnings {
+			data[i] = 0x2a
+			i++
+			i = encodeVarintOutput(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	if len(m.Files) > 0 {
+		for _, msg := range m.Files {
+			data[i] = 0x32
+			i++
+			i = encodeVarintOutput(data, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(data[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
+	return i, nil
+}
+
+func (m *Warning) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *Warning) MarshalTo(data []byte) (n int, err error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	data[i] = 0xa
+	i++
+	i = encodeVarintOutput(data, i, uint64(len(m.File)))
+	i += copy(data[i:], m.File)
+	data[i] = 0x12
+	i++
+	i = encodeVarintOutput(data, i, uint64(len(m.Message)))
+	i += copy(data[i:], m.Message)
+	data[i] = 0x1a
+	i++
+	i = encodeVarintOutput(data, i, uint64(len(m.Phase)))
+	i += copy(data[i:], m.Phase)
+	data[i] = 0x22
+	i++
+	i = encodeVarintOutput(data, i, uint64(len(m.Severity)))
+	i += copy(data[i:], m.Severity)
+	data[i] = 0x2a
+	i++
+	i = encodeVarintOutput(data, i, uint64(len(m.UnitType)))
+	i += copy(data[i:], m.UnitType)
+	data[i] = 0x32
+	i++
+	i = encodeVarintOutput(data, i, uint64(len(m.Unit)))
+	i += copy(data[i:], m.Unit)
+	return i, nil
+}
+
+func (m *FileSummary) Marshal() (data []byte, err error) {
+	size := m.Size()
+	data = make([]byte, size)
+	n, err := m.MarshalTo(data)
+	if err != nil {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (m *FileSummary) MarshalTo(data []byte) (n int, err error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	data[i] = 0xa
+	i++
+	i = encodeVarintOutput(data, i, uint64(len(m.File)))
+	i += copy(data[i:], m.File)
+	data[i] = 0x12
+	i++
+	i = encodeVarintOutput(data, i, uint64(len(m.Language)))
+	i += copy(data[i:], m.Language)
+	data[i] = 0x18
+	i++
+	i = encodeVarintOutput(data, i, uint64(m.SLOC))
+	data[i] = 0x20
+	i++
+	i = encodeVarintOutput(data, i, uint64(m.DefCount))
+	if len(m.TopLevelDefs) > 0 {
+		for _, s := range m.TopLevelDefs {
+			data[i] = 0x2a
+			i++
+			l = len(s)
+			for l >= 1<<7 {
+				data[i] = uint8(uint64(l)&0x7f | 0x80)
+				l >>= 7
+				i++
+			}
+			data[i] = uint8(l)
+			i++
+			i += copy(data[i:], s)
+		}
+	}
+	data[i] = 0x32
+	i++
+	i = encodeVarintOutput(data, i, uint64(len(m.UnitType)))
+	i += copy(data[i:], m.UnitType)
+	data[i] = 0x3a
+	i++
+	i = encodeVarintOutput(data, i, uint64(len(m.Unit)))
+	i += copy(data[i:], m.Unit)
 	return i, nil
 }
 
@@ -0,0 +1,83 @@
+package graph
+
+import (
+	"math"
+	"sort"
+)
+
+// Weights of the signals that make up a def's Rank (see
+// ComputeDefRanks).
+const (
+	// RankRefsWeight is multiplied by log2(1 + the number of refs to
+	// the def), so that heavily referenced defs don't drown out the
+	// other signals.
+	RankRefsWeight = 100
+
+	// RankExportedWeight is added for exported defs.
+	RankExportedWeight = 300
+
+	// RankDocWeight is added for defs that have docs.
+	RankDocWeight = 100
+)
+
+// ComputeDefRanks sets the Rank field of each def in o. The rank
+// combines the number of refs in o to the def (not counting the def's
+// own definition ref), whether the def is exported, and whether it has
+// docs (either in its Docs field or in o.Docs).
+//
+// Refs are counted only within o, so Rank is a per-source-unit signal;
+// it is comparable across source units but doesn't account for refs
+// from other units or repositories.
+func ComputeDefRanks(o *Output) {
+	type key struct{ unitType, unit, path string }
+	refs := make(map[key]int, len(o.Defs))
+	for _, ref := range o.Refs {
+		if ref.Def || ref.DefRepo != ref.Repo {
+			continue
+		}
+		refs[key{ref.DefUnitType, ref.DefUnit, ref.DefPath}]++
+	}
+
+	documented := make(map[string]struct{}, len(o.Docs))
+	for _, doc := range o.Docs {
+		if doc.Data != "" {
+			documented[doc.Path] = struct{}{}
+		}
+	}
+
+	for _, def := range o.Defs {
+		n := refs[key{def.UnitType, def.Unit, def.Path}]
+		if def.UnitType != "" || def.Unit != "" {
+			// Refs in raw grapher output refer to defs in the same
+			// source unit with an empty unit type and name.
+			n += refs[key{"", "", def.Path}]
+		}
+		_, hasDoc := documented[def.Path]
+		def.Rank = DefRank(n, def.Exported, hasDoc || len(def.Docs) > 0)
+	}
+}
+
+// DefRank returns the rank (see Def.Rank) of a def with the given
+// number of refs, exported status, and doc presence.
+func DefRank(refs int, exported, hasDoc bool) uint32 {
+	rank := uint32(math.Round(RankRefsWeight * math.Log2(1+float64(refs))))
+	if exported {
+		rank += RankExportedWeight
+	}
+	if hasDoc {
+		rank += RankDocWeight
+	}
+	return rank
+}
+
+// SortDefsByRank sorts defs by descending Rank. Defs with equal rank
+// keep their original order.
+func SortDefsByRank(defs []*Def) {
+	sort.Stable(defsByRank(defs))
+}
+
+type defsByRank []*Def
+
+func (v defsByRank) Len() int           { return len(v) }
+func (v defsByRank) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v defsByRank) Less(i, j int) bool { return v[i].Rank > v[j].Rank }
@@ -0,0 +1,74 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComputeDefRanks(t *testing.T) {
+	o := &Output{
+		Defs: []*Def{
+			{DefKey: DefKey{Path: "a"}},
+			{DefKey: DefKey{Path: "b"}, Exported: true},
+			{DefKey: DefKey{Path: "c"}},
+			{DefKey: DefKey{Path: "d"}, Docs: []DefDoc{{Format: "text/plain", Data: "d"}}},
+		},
+		Refs: []*Ref{
+			{DefPath: "a", Def: true},
+			{DefPath: "a"},
+			{DefPath: "a"},
+			{DefPath: "a"},
+			{DefPath: "b", DefRepo: "other"},
+		},
+		Docs: []*Doc{{DefKey: DefKey{Path: "c"}, Data: "c"}},
+	}
+	ComputeDefRanks(o)
+
+	want := []uint32{
+		DefRank(3, false, false),
+		DefRank(0, true, false),
+		DefRank(0, false, true),
+		DefRank(0, false, true),
+	}
+	var got []uint32
+	for _, def := range o.Defs {
+		got = append(got, def.Rank)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got ranks %v, want %v", got, want)
+	}
+}
+
+func TestSortDefsByRank(t *testing.T) {
+	defs := []*Def{
+		{DefKey: DefKey{Path: "a"}, Rank: 1},
+		{DefKey: DefKey{Path: "b"}, Rank: 3},
+		{DefKey: DefKey{Path: "c"}, Rank: 1},
+	}
+	SortDefsByRank(defs)
+	var got []string
+	for _, def := range defs {
+		got = append(got, def.Path)
+	}
+	if want := []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDef_Marshal_rank(t *testing.T) {
+	def := &Def{DefKey: DefKey{Path: "p"}, Name: "n", TreePath: "p", Rank: 1234}
+	data, err := def.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != def.Size() {
+		t.Errorf("got %d bytes, want Size() %d", len(data), def.Size())
+	}
+	var def2 Def
+	if err := def2.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&def2, def) {
+		t.Errorf("got %#v, want %#v", &def2, def)
+	}
+}
@@ -74,9 +74,35 @@ type Refs []*Ref
 func (r *Ref) sortKey() string {
 	return r.DefPath + r.DefRepo + r.DefUnitType + r.DefUnit + r.Repo + r.UnitType + r.Unit + r.File + strconv.Itoa(int(r.Start)) + strconv.Itoa(int(r.End))
 }
-func (vs Refs) Len() int           { return len(vs) }
-func (vs Refs) Swap(i, j int)      { vs[i], vs[j] = vs[j], vs[i] }
-func (vs Refs) Less(i, j int) bool { return vs[i].sortKey() < vs[j].sortKey() }
+func (vs Refs) Len() int      { return len(vs) }
+func (vs Refs) Swap(i, j int) { vs[i], vs[j] = vs[j], vs[i] }
+func (vs Refs) Less(i, j int) bool {
+	if ki, kj := vs[i].sortKey(), vs[j].sortKey(); ki != kj {
+		return ki < kj
+	}
+	return refTieLess(vs[i], vs[j])
+}
+
+// refTieLess orders distinct refs whose sort keys are equal (which
+// can occur because the sort key's fields aren't delimited, and it
+// omits Def and CommitID), so that sorting refs doesn't depend on
+// their original order.
+func refTieLess(a, b *Ref) bool {
+	as := [...]string{a.DefPath, a.DefRepo, a.DefUnitType, a.DefUnit, a.Repo, a.UnitType, a.Unit, a.File, a.CommitID}
+	bs := [...]string{b.DefPath, b.DefRepo, b.DefUnitType, b.DefUnit, b.Repo, b.UnitType, b.Unit, b.File, b.CommitID}
+	for i := range as {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	if a.Start != b.Start {
+		return a.Start < b.Start
+	}
+	if a.End != b.End {
+		return a.End < b.End
+	}
+	return !a.Def && b.Def
+}
 
 // RefSet is a set of Refs. It can used to determine whether a grapher emits
 // duplicate refs.
@@ -53,6 +53,22 @@ type Ref struct {
 	Start uint32 `protobuf:"varint,11,opt,name=start" json:"Start"`
 	// End is the byte offset of this ref's last byte in File.
 	End uint32 `protobuf:"varint,12,opt,name=end" json:"End"`
+	// EnclosingDef is the path of the innermost def (in the same
+	// source unit as this ref) whose definition contains this ref,
+	// such as the function or class that the ref occurs in. It is
+	// computed when the ref is imported into a store (see
+	// SetEnclosingDefs), and it is empty if no def contains the ref.
+	EnclosingDef string `protobuf:"bytes,18,opt,name=enclosing_def" json:"EnclosingDef,omitempty"`
+	// Snippet is the source code around the ref. It is not stored; it
+	// is set only in the results of queries that request context
+	// lines (such as "src store refs --context-lines").
+	Snippet *Snippet `protobuf:"bytes,19,opt,name=snippet" json:"Snippet,omitempty"`
+	// Confidence is how likely it is (from 0 to 1) that this ref
+	// refers to the Def it points to. Graphers for dynamic languages
+	// set it when they resolve a ref heuristically (e.g., by matching
+	// a method name to the only def with that name). 0 means that the
+	// grapher is certain (see EffectiveConfidence).
+	Confidence float32 `protobuf:"fixed32,20,opt,name=confidence" json:"Confidence,omitempty"`
 }
 // END Ref OMIT
 
@@ -337,6 +353,69 @@ func (m *Ref) Unmarshal(data []byte) error {
 					break
 				}
 			}
+		case 18:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field EnclosingDef", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + int(stringLen)
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.EnclosingDef = string(data[index:postIndex])
+			index = postIndex
+		case 19:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Snippet", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if index >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := data[index]
+				index++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			postIndex := index + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if m.Snippet == nil {
+				m.Snippet = &Snippet{}
+			}
+			if err := m.Snippet.Unmarshal(data[index:postIndex]); err != nil {
+				return err
+			}
+			index = postIndex
+		case 20:
+			if wireType != 5 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Confidence", wireType)
+			}
+			var v uint32
+			if index+4 > l {
+				return io.ErrUnexpectedEOF
+			}
+			index += 4
+			v = uint32(data[index-4])
+			v |= uint32(data[index-3]) << 8
+			v |= uint32(data[index-2]) << 16
+			v |= uint32(data[index-1]) << 24
+			m.Confidence = math.Float32frombits(v)
 		default:
 			var sizeOfWire int
 			for {
@@ -512,6 +591,13 @@ func (m *Ref) Size() (n int) {
 	n += 1 + l + sovRef(uint64(l))
 	n += 1 + sovRef(uint64(m.Start))
 	n += 1 + sovRef(uint64(m.End))
+	l = len(m.EnclosingDef)
+	n += 2 + l + sovRef(uint64(l))
+	if m.Snippet != nil {
+		l = m.Snippet.Size()
+		n += 2 + l + sovRef(uint64(l))
+	}
+	n += 6
 	return n
 }
 
@@ -609,6 +695,29 @@ func (m *Ref) MarshalTo(data []byte) (n int, err error) {
 	data[i] = 0x60
 	i++
 	i = encodeVarintRef(data, i, uint64(m.End))
+	data[i] = 0x92
+	i++
+	data[i] = 0x1
+	i++
+	i = encodeVarintRef(data, i, uint64(len(m.EnclosingDef)))
+	i += copy(data[i:], m.EnclosingDef)
+	if m.Snippet != nil {
+		data[i] = 0x9a
+		i++
+		data[i] = 0x1
+		i++
+		i = encodeVarintRef(data, i, uint64(m.Snippet.Size()))
+		n1, err := m.Snippet.MarshalTo(data[i:])
+		if err != nil {
+			return 0, err
+		}
+		i += n1
+	}
+	data[i] = 0xa5
+	i++
+	data[i] = 0x1
+	i++
+	i = encodeFixed32Ref(data, i, uint32(math.Float32bits(m.Confidence)))
 	return i, nil
 }
 
@@ -689,7 +798,10 @@ func (this *Ref) GoString() string {
 		`Def:` + fmt.Sprintf("%#v", this.Def),
 		`File:` + fmt.Sprintf("%#v", this.File),
 		`Start:` + fmt.Sprintf("%#v", this.Start),
-		`End:` + fmt.Sprintf("%#v", this.End) + `}`}, ", ")
+		`End:` + fmt.Sprintf("%#v", this.End),
+		`EnclosingDef:` + fmt.Sprintf("%#v", this.EnclosingDef),
+		`Snippet:` + fmt.Sprintf("%#v", this.Snippet),
+		`Confidence:` + fmt.Sprintf("%#v", this.Confidence) + `}`}, ", ")
 	return s
 }
 func (this *RefDefKey) GoString() string {
@@ -0,0 +1,29 @@
+package graph
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRefs_Sort_ties(t *testing.T) {
+	// These refs have equal sort keys.
+	refs := []*Ref{
+		{DefPath: "a", File: "f", Start: 12, End: 3},
+		{DefPath: "a", File: "f", Start: 1, End: 23},
+		{DefPath: "a", File: "f", Start: 1, End: 23, Def: true},
+		{DefPath: "ab", File: "f", Start: 1, End: 23},
+		{DefPath: "a", DefRepo: "b", File: "f", Start: 1, End: 23},
+	}
+	var want []*Ref
+	for i := 0; i < len(refs); i++ {
+		// Rotate the input so that each ref is first once.
+		got := append(append([]*Ref{}, refs[i:]...), refs[:i]...)
+		sort.Sort(Refs(got))
+		if want == nil {
+			want = got
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("rotation %d: got order %v, want %v", i, got, want)
+		}
+	}
+}
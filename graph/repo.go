@@ -4,7 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
-	"path/filepath"
+	"path"
 	"strings"
 )
 
@@ -23,22 +23,84 @@ func MakeURI(cloneURL string) string {
 
 // TryMakeURI converts a repository clone URL, such as
 // "git://github.com/user/repo.git", to a normalized URI string, such
-// as "github.com/user/repo" lexically. TryMakeURI returns an error if
-// cloneURL is empty or malformed.
+// as "github.com/user/repo". TryMakeURI returns an error if cloneURL
+// is empty or malformed.
+//
+// The clone URL is first normalized lexically: the scheme, user info,
+// default port, and ".git" suffix are removed and the host is
+// lowercased, so that the https, git, ssh, and scp-like
+// ("git@github.com:user/repo.git") forms of a clone URL all yield the
+// same URI. Then the first URI rule (see SetURIRules) that matches
+// the resulting URI is applied.
 func TryMakeURI(cloneURL string) (string, error) {
+	uri, err := lexicalURI(cloneURL)
+	if err != nil {
+		return "", err
+	}
+	return applyURIRules(uri), nil
+}
+
+// defaultPorts are the ports that lexicalURI removes from clone URLs
+// with each scheme.
+var defaultPorts = map[string]string{
+	"git":     "9418",
+	"http":    "80",
+	"https":   "443",
+	"ssh":     "22",
+	"git+ssh": "22",
+}
+
+// lexicalURI performs the lexical normalization of cloneURL described
+// in TryMakeURI.
+func lexicalURI(cloneURL string) (string, error) {
 	if cloneURL == "" {
 		return "", errors.New("MakeURI: empty clone URL")
 	}
 
+	if host, path, ok := splitSCPLikeURL(cloneURL); ok {
+		return normalizeURI(host, "/"+path), nil
+	}
+
 	url, err := url.Parse(cloneURL)
 	if err != nil {
 		return "", fmt.Errorf("MakeURI(%q): %s", cloneURL, err)
 	}
 
-	path := strings.TrimSuffix(url.Path, ".git")
-	path = filepath.Clean(path)
-	path = strings.TrimSuffix(path, "/")
-	return strings.ToLower(url.Host) + path, nil
+	host := url.Host
+	if port := url.Port(); port != "" && port == defaultPorts[url.Scheme] {
+		host = url.Hostname()
+	}
+	return normalizeURI(host, url.Path), nil
+}
+
+func normalizeURI(host, p string) string {
+	p = strings.TrimSuffix(p, "/")
+	p = strings.TrimSuffix(p, ".git")
+	p = path.Clean(p)
+	p = strings.TrimSuffix(p, "/")
+	return strings.ToLower(host) + p
+}
+
+// splitSCPLikeURL splits a clone URL in the scp-like syntax accepted
+// by git ("[user@]host:path", such as "git@github.com:user/repo.git")
+// into its host and path. It returns ok == false for URLs with a
+// scheme and for paths (which have no colon before the first slash).
+func splitSCPLikeURL(cloneURL string) (host, path string, ok bool) {
+	if strings.Contains(cloneURL, "://") {
+		return "", "", false
+	}
+	i := strings.Index(cloneURL, ":")
+	if i <= 0 || strings.Contains(cloneURL[:i], "/") {
+		return "", "", false
+	}
+	host = cloneURL[:i]
+	if at := strings.LastIndex(host, "@"); at != -1 {
+		host = host[at+1:]
+	}
+	if host == "" {
+		return "", "", false
+	}
+	return host, strings.TrimPrefix(cloneURL[i+1:], "/"), true
 }
 
 // URIEqual returns true if a and b are equal, based on a case insensitive
@@ -1,6 +1,9 @@
 package graph
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestMakeURI(t *testing.T) {
 	tests := []struct {
@@ -12,6 +15,14 @@ func TestMakeURI(t *testing.T) {
 		{"http://bitbucket.org/user/repo", "bitbucket.org/user/repo"},
 		{"https://bitbucket.org/user/repo", "bitbucket.org/user/repo"},
 		{"bitbucket.org/user/repo", "bitbucket.org/user/repo"},
+		{"https://GitHub.com/user/repo.git", "github.com/user/repo"},
+		{"https://github.com/user/repo/", "github.com/user/repo"},
+		{"https://github.com:443/user/repo", "github.com/user/repo"},
+		{"https://example.com:8443/user/repo", "example.com:8443/user/repo"},
+		{"ssh://git@github.com/user/repo.git", "github.com/user/repo"},
+		{"ssh://git@github.com:22/user/repo", "github.com/user/repo"},
+		{"git@github.com:user/repo.git", "github.com/user/repo"},
+		{"github.com:/user/repo", "github.com/user/repo"},
 	}
 
 	for _, test := range tests {
@@ -21,3 +32,48 @@ func TestMakeURI(t *testing.T) {
 		}
 	}
 }
+
+func TestSetURIRules(t *testing.T) {
+	defer SetURIRules(nil)
+	err := SetURIRules([]URIRule{
+		{From: "https://mirror.example.com/github/", To: "github.com"},
+		{From: "github.com/old/repo", To: "github.com/new/repo"},
+		{From: "github.com/new/repo", To: "github.com/newer/repo"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRules := []URIRule{
+		{From: "mirror.example.com/github", To: "github.com"},
+		{From: "github.com/old/repo", To: "github.com/new/repo"},
+		{From: "github.com/new/repo", To: "github.com/newer/repo"},
+	}
+	if rules := URIRules(); !reflect.DeepEqual(rules, wantRules) {
+		t.Errorf("got rules %+v, want %+v", rules, wantRules)
+	}
+
+	tests := []struct {
+		cloneURL string
+		want     string
+	}{
+		{"git@mirror.example.com:github/user/repo.git", "github.com/user/repo"},
+		{"https://Mirror.example.com/GitHub/user/repo", "github.com/user/repo"},
+		{"https://mirror.example.com/githubx/user/repo", "mirror.example.com/githubx/user/repo"},
+		{"github.com/old/repo", "github.com/new/repo"},
+		{"github.com/old/repository", "github.com/old/repository"},
+		{"github.com/new/repo", "github.com/newer/repo"},
+		{"github.com/other/repo", "github.com/other/repo"},
+	}
+	for _, test := range tests {
+		if got := MakeURI(test.cloneURL); got != test.want {
+			t.Errorf("%s: want URI %s, got %s", test.cloneURL, test.want, got)
+		}
+	}
+
+	if err := SetURIRules([]URIRule{{From: "github.com/a"}}); err == nil {
+		t.Error("got no error for rule without To")
+	}
+	if rules := URIRules(); !reflect.DeepEqual(rules, wantRules) {
+		t.Errorf("invalid rules replaced the rules: got %+v", rules)
+	}
+}
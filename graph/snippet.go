@@ -0,0 +1,56 @@
+package graph
+
+import "bytes"
+
+// MakeSnippet returns the snippet of the lines of src (a file's
+// contents) that contain the byte range [start, end), with
+// contextLines lines before and after them. It returns nil if start
+// is beyond the end of src.
+func MakeSnippet(src []byte, start, end uint32, contextLines int) *Snippet {
+	if int(start) > len(src) {
+		return nil
+	}
+	if end < start {
+		end = start
+	}
+	if int(end) > len(src) {
+		end = uint32(len(src))
+	}
+
+	// The snippet begins at the start of the line containing start,
+	// moved back by contextLines lines.
+	begin := bytes.LastIndexByte(src[:start], '\n') + 1
+	for i := 0; i < contextLines && begin > 0; i++ {
+		begin = bytes.LastIndexByte(src[:begin-1], '\n') + 1
+	}
+
+	// It finishes at the end of the line containing the last byte of
+	// the range (before its newline), moved forward by contextLines
+	// lines.
+	last := end
+	if end > start {
+		last = end - 1
+	}
+	finish := lineEnd(src, int(last))
+	for i := 0; i < contextLines && finish < len(src); i++ {
+		finish = lineEnd(src, finish+1)
+	}
+
+	return &Snippet{
+		StartLine: uint32(bytes.Count(src[:begin], []byte("\n")) + 1),
+		Start:     uint32(begin),
+		Text:      string(src[begin:finish]),
+	}
+}
+
+// lineEnd returns the offset of the newline that ends the line
+// containing src[i], or len(src) if the line is the last line.
+func lineEnd(src []byte, i int) int {
+	if i >= len(src) {
+		return len(src)
+	}
+	if n := bytes.IndexByte(src[i:], '\n'); n != -1 {
+		return i + n
+	}
+	return len(src)
+}
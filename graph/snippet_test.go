@@ -0,0 +1,65 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMakeSnippet(t *testing.T) {
+	src := []byte("a\nbb\nccc\ndddd\ne")
+	tests := []struct {
+		start, end   uint32
+		contextLines int
+		want         *Snippet
+	}{
+		{start: 5, end: 8, want: &Snippet{StartLine: 3, Start: 5, Text: "ccc"}},
+		{start: 6, end: 7, contextLines: 1, want: &Snippet{StartLine: 2, Start: 2, Text: "bb\nccc\ndddd"}},
+		{start: 0, end: 1, contextLines: 2, want: &Snippet{StartLine: 1, Start: 0, Text: "a\nbb\nccc"}},
+		{start: 14, end: 15, contextLines: 3, want: &Snippet{StartLine: 2, Start: 2, Text: "bb\nccc\ndddd\ne"}},
+
+		// Spans of several lines.
+		{start: 3, end: 11, want: &Snippet{StartLine: 2, Start: 2, Text: "bb\nccc\ndddd"}},
+
+		// A span ending with a newline doesn't include the next line.
+		{start: 5, end: 9, want: &Snippet{StartLine: 3, Start: 5, Text: "ccc"}},
+
+		// Empty and out-of-range spans.
+		{start: 5, end: 5, want: &Snippet{StartLine: 3, Start: 5, Text: "ccc"}},
+		{start: 14, end: 100, want: &Snippet{StartLine: 5, Start: 14, Text: "e"}},
+		{start: 100, end: 101, want: nil},
+	}
+	for _, test := range tests {
+		got := MakeSnippet(src, test.start, test.end, test.contextLines)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("MakeSnippet(%d, %d, %d): got %#v, want %#v", test.start, test.end, test.contextLines, got, test.want)
+		}
+	}
+}
+
+func TestSnippet_marshal(t *testing.T) {
+	ref := &Ref{DefPath: "p", File: "f", Start: 1, End: 2, Snippet: &Snippet{StartLine: 3, Start: 4, Text: "x\ny"}}
+	data, err := ref.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ref2 Ref
+	if err := ref2.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&ref2, ref) {
+		t.Errorf("got %#v, want %#v", &ref2, ref)
+	}
+
+	def := &Def{DefKey: DefKey{Path: "p"}, Snippet: &Snippet{StartLine: 1, Text: "func p() {"}}
+	data, err = def.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var def2 Def
+	if err := def2.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&def2, def) {
+		t.Errorf("got %#v, want %#v", &def2, def)
+	}
+}
@@ -0,0 +1,89 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// A URIRule rewrites repository URIs, such as to map a mirror of a
+// repository to the canonical repository, so that refs to and
+// dependencies on either one are attributed to the same repository.
+// Rules are set with SetURIRules and applied by TryMakeURI.
+type URIRule struct {
+	// From is the URI (or the URI prefix, matched at path component
+	// boundaries and ignoring case) that the rule applies to, such as
+	// "mirror.example.com/github". It may be given as a clone URL; it
+	// is normalized lexically (as described in TryMakeURI).
+	From string
+
+	// To replaces the part of the URI that From matched, such as
+	// "github.com". It is normalized in the same way as From.
+	To string
+}
+
+var (
+	uriRulesMu sync.RWMutex
+	uriRules   []URIRule
+)
+
+// SetURIRules sets the rules that TryMakeURI applies to all URIs,
+// replacing any previously set rules. Only the first rule that
+// matches a URI is applied (rules are not applied to URIs that other
+// rules produce). It returns an error, and leaves the current rules
+// unchanged, if a rule's From or To is empty or malformed.
+func SetURIRules(rules []URIRule) error {
+	normalized := make([]URIRule, len(rules))
+	for i, r := range rules {
+		if r.From == "" || r.To == "" {
+			return errors.New("URI rule must have a From and a To")
+		}
+		from, err := lexicalURI(r.From)
+		if err != nil {
+			return fmt.Errorf("URI rule From: %s", err)
+		}
+		to, err := lexicalURI(r.To)
+		if err != nil {
+			return fmt.Errorf("URI rule To: %s", err)
+		}
+		normalized[i] = URIRule{From: from, To: to}
+	}
+
+	uriRulesMu.Lock()
+	defer uriRulesMu.Unlock()
+	uriRules = normalized
+	return nil
+}
+
+// URIRules returns the rules set by SetURIRules (normalized).
+func URIRules() []URIRule {
+	uriRulesMu.RLock()
+	defer uriRulesMu.RUnlock()
+	return append([]URIRule(nil), uriRules...)
+}
+
+// applyURIRules applies the first URI rule that matches uri.
+func applyURIRules(uri string) string {
+	uriRulesMu.RLock()
+	defer uriRulesMu.RUnlock()
+	for _, r := range uriRules {
+		if rest, ok := r.match(uri); ok {
+			return r.To + rest
+		}
+	}
+	return uri
+}
+
+// match reports whether r applies to uri, and if so, returns the
+// part of uri after the part that r.From matched.
+func (r URIRule) match(uri string) (rest string, ok bool) {
+	if len(uri) < len(r.From) || !strings.EqualFold(uri[:len(r.From)], r.From) {
+		return "", false
+	}
+	rest = uri[len(r.From):]
+	if rest != "" && rest[0] != '/' {
+		return "", false
+	}
+	return rest, true
+}
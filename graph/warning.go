@@ -0,0 +1,50 @@
+package graph
+
+// Severities of warnings (see Warning.Severity).
+const (
+	// SeverityInfo is for expected omissions that don't make the
+	// output incorrect, such as offsets in a binary file that weren't
+	// converted.
+	SeverityInfo = "info"
+
+	// SeverityWarning is for problems that may make some of the
+	// output incorrect, such as offsets in a file that changed after
+	// the grapher ran.
+	SeverityWarning = "warning"
+
+	// SeverityError is for problems that make some of the output
+	// missing, such as a file that the grapher couldn't parse.
+	SeverityError = "error"
+)
+
+// ValidSeverity reports whether s is a valid Warning.Severity (or
+// empty, which means SeverityWarning).
+func ValidSeverity(s string) bool {
+	switch s {
+	case "", SeverityInfo, SeverityWarning, SeverityError:
+		return true
+	}
+	return false
+}
+
+// WarningPhaseGraph is the Phase of warnings that a toolchain's
+// grapher emitted.
+const WarningPhaseGraph = "graph"
+
+type Warnings []*Warning
+
+func (w *Warning) sortKey() [6]string {
+	return [...]string{w.UnitType, w.Unit, w.File, w.Phase, w.Severity, w.Message}
+}
+
+func (vs Warnings) Len() int      { return len(vs) }
+func (vs Warnings) Swap(i, j int) { vs[i], vs[j] = vs[j], vs[i] }
+func (vs Warnings) Less(i, j int) bool {
+	ki, kj := vs[i].sortKey(), vs[j].sortKey()
+	for n := range ki {
+		if ki[n] != kj[n] {
+			return ki[n] < kj[n]
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package grapher
+
+import (
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func init() {
+	buildstore.RegisterDataType("coverage", []*FileCoverage{})
+}
+
+// FileCoverage describes how many of the refs in a file were
+// successfully linked to defs.
+type FileCoverage struct {
+	// File is the path of the file, relative to the repository root.
+	File string
+
+	// Refs is the total number of refs in the file.
+	Refs int
+
+	// ResolvedRefs is the number of internal refs in the file that
+	// point to existing defs.
+	ResolvedRefs int
+
+	// UncheckedRefs is the number of refs in the file that point to
+	// defs in other repositories. Their resolution can't be checked
+	// without loading external data (see UnresolvedInternalRefs), so
+	// they don't count toward the file's Score.
+	UncheckedRefs int `json:",omitempty"`
+
+	// Score is the fraction (between 0 and 1) of checked refs in the
+	// file that were resolved. A file with no checked refs has a
+	// score of 1.
+	Score float64
+}
+
+// ComputeFileCoverage computes the ref coverage of each file that
+// contains refs. CurrentRepoURI, refs, and defs have the same meaning
+// as in UnresolvedInternalRefs; defs should include all of the defs in
+// the repository (not just those in the same source unit as refs) so
+// that refs across source units are detected as resolved. The returned
+// list is sorted by filename.
+func ComputeFileCoverage(currentRepoURI string, refs []*graph.Ref, defs []*graph.Def) []*FileCoverage {
+	unresolved := map[*graph.Ref]struct{}{}
+	for _, refs := range UnresolvedInternalRefs(currentRepoURI, refs, defs) {
+		for _, ref := range refs {
+			unresolved[ref] = struct{}{}
+		}
+	}
+
+	covByFile := map[string]*FileCoverage{}
+	for _, ref := range refs {
+		cov, present := covByFile[ref.File]
+		if !present {
+			cov = &FileCoverage{File: ref.File}
+			covByFile[ref.File] = cov
+		}
+		cov.Refs++
+		if _, isUnresolved := unresolved[ref]; isUnresolved {
+			continue
+		}
+		if graph.URIEqual(ref.DefRepo, currentRepoURI) {
+			cov.ResolvedRefs++
+		} else {
+			cov.UncheckedRefs++
+		}
+	}
+
+	covs := make([]*FileCoverage, 0, len(covByFile))
+	for _, cov := range covByFile {
+		if checked := cov.Refs - cov.UncheckedRefs; checked > 0 {
+			cov.Score = float64(cov.ResolvedRefs) / float64(checked)
+		} else {
+			cov.Score = 1
+		}
+		covs = append(covs, cov)
+	}
+	sort.Sort(fileCoverages(covs))
+	return covs
+}
+
+type fileCoverages []*FileCoverage
+
+func (v fileCoverages) Len() int           { return len(v) }
+func (v fileCoverages) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v fileCoverages) Less(i, j int) bool { return v[i].File < v[j].File }
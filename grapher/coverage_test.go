@@ -0,0 +1,35 @@
+package grapher
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestComputeFileCoverage(t *testing.T) {
+	defs := []*graph.Def{
+		{DefKey: graph.DefKey{Repo: "r", UnitType: "t", Unit: "u", Path: "p1"}},
+		{DefKey: graph.DefKey{Repo: "r", UnitType: "t", Unit: "u2", Path: "p2"}},
+	}
+	refs := []*graph.Ref{
+		{DefRepo: "r", DefUnitType: "t", DefUnit: "u", DefPath: "p1", File: "a"},
+		{DefRepo: "r", DefUnitType: "t", DefUnit: "u2", DefPath: "p2", File: "a"},
+		{DefRepo: "r", DefUnitType: "t", DefUnit: "u", DefPath: "x", File: "a"},
+		{DefRepo: "r", DefUnitType: "t", DefUnit: "u", DefPath: "x", File: "b"},
+		{DefRepo: "r2", DefUnitType: "t", DefUnit: "u", DefPath: "p", File: "c"},
+	}
+
+	want := []*FileCoverage{
+		{File: "a", Refs: 3, ResolvedRefs: 2, Score: 2.0 / 3.0},
+		{File: "b", Refs: 1, ResolvedRefs: 0, Score: 0},
+		{File: "c", Refs: 1, UncheckedRefs: 1, Score: 1},
+	}
+	got := ComputeFileCoverage("r", refs, defs)
+	if !reflect.DeepEqual(got, want) {
+		for _, c := range got {
+			t.Logf("%+v", c)
+		}
+		t.Errorf("got file coverage != want")
+	}
+}
@@ -0,0 +1,155 @@
+package grapher
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// A textEncoding is a character encoding of source files, which
+// determines how the character offsets that graphers emit are
+// converted to byte offsets (see runeIndex).
+type textEncoding struct {
+	name string
+
+	// bomLen is the length of the byte order mark that the encoding
+	// was detected by (if any). The BOM isn't counted as a character,
+	// since graphers' decoders strip it.
+	bomLen int
+
+	// charLen returns the length in bytes of the first character in
+	// data (which is not empty). It is nil for single-byte encodings.
+	charLen func(data []byte) int
+}
+
+var (
+	encodingUTF8   = &textEncoding{name: "utf-8", charLen: utf8CharLen}
+	encodingLatin1 = &textEncoding{name: "iso-8859-1"}
+
+	// byteOrderMarks are the encodings that are detected by the BOM
+	// at the start of a file. UTF-32LE must be checked before
+	// UTF-16LE, whose BOM is a prefix of it.
+	byteOrderMarks = []struct {
+		bom string
+		enc *textEncoding
+	}{
+		{"\xff\xfe\x00\x00", &textEncoding{name: "utf-32le", bomLen: 4, charLen: fixedCharLen(4)}},
+		{"\x00\x00\xfe\xff", &textEncoding{name: "utf-32be", bomLen: 4, charLen: fixedCharLen(4)}},
+		{"\xff\xfe", &textEncoding{name: "utf-16le", bomLen: 2, charLen: utf16CharLen(false)}},
+		{"\xfe\xff", &textEncoding{name: "utf-16be", bomLen: 2, charLen: utf16CharLen(true)}},
+		{"\xef\xbb\xbf", &textEncoding{name: "utf-8", bomLen: 3, charLen: utf8CharLen}},
+	}
+)
+
+func utf8CharLen(data []byte) int {
+	_, size := utf8.DecodeRune(data)
+	return size
+}
+
+func fixedCharLen(n int) func([]byte) int {
+	return func(data []byte) int {
+		if len(data) < n {
+			return len(data)
+		}
+		return n
+	}
+}
+
+// utf16CharLen returns the charLen func of UTF-16 (big-endian if be).
+// Characters outside the BMP (encoded as surrogate pairs) are 4 bytes.
+func utf16CharLen(be bool) func([]byte) int {
+	return func(data []byte) int {
+		if len(data) < 4 {
+			if len(data) < 2 {
+				return len(data)
+			}
+			return 2
+		}
+		hi, lo := data[1], data[3]
+		if be {
+			hi, lo = data[0], data[2]
+		}
+		if hi >= 0xd8 && hi <= 0xdb && lo >= 0xdc && lo <= 0xdf {
+			return 4
+		}
+		return 2
+	}
+}
+
+// encodingDeclPattern matches the encoding declarations (e.g., "#
+// -*- coding: latin-1 -*-") that Python (PEP 263) and Ruby (magic
+// comments) allow on the first 2 lines of a file.
+var encodingDeclPattern = regexp.MustCompile(`^[ \t\f]*#.*?coding[:=][ \t]*([-\w.]+)`)
+
+// encodingDeclExts are the extensions of the files whose encoding
+// declarations are recognized.
+var encodingDeclExts = map[string]bool{".py": true, ".pyw": true, ".rb": true, ".rake": true, ".gemspec": true}
+
+// declaredEncoding returns the name of the encoding declared in the
+// first 2 lines of data (if file is a Python or Ruby file), or "" if
+// there is none.
+func declaredEncoding(file string, data []byte) string {
+	if !encodingDeclExts[strings.ToLower(path.Ext(file))] {
+		return ""
+	}
+	for i := 0; i < 2 && len(data) > 0; i++ {
+		line := data
+		if j := bytes.IndexByte(data, '\n'); j != -1 {
+			line, data = data[:j], data[j+1:]
+		} else {
+			data = nil
+		}
+		if m := encodingDeclPattern.FindSubmatch(line); m != nil {
+			return string(m[1])
+		}
+	}
+	return ""
+}
+
+// singleByteEncodings are the names (lowercased, with "_" replaced by
+// "-") of the supported declared encodings that encode each character
+// in 1 byte. Their offsets are converted the same way, so the
+// differences between their character sets don't matter.
+var singleByteEncodings = map[string]bool{
+	"ascii": true, "us-ascii": true,
+	"latin-1": true, "latin1": true, "l1": true,
+	"iso-8859-1": true, "iso8859-1": true, "iso-8859-2": true, "iso8859-2": true,
+	"iso-8859-5": true, "iso8859-5": true, "iso-8859-7": true, "iso8859-7": true,
+	"iso-8859-9": true, "iso8859-9": true, "iso-8859-15": true, "iso8859-15": true,
+	"latin-9": true, "latin9": true,
+	"cp1250": true, "cp1251": true, "cp1252": true, "cp1253": true, "cp1254": true,
+	"windows-1250": true, "windows-1251": true, "windows-1252": true, "windows-1253": true, "windows-1254": true,
+	"cp437": true, "cp850": true, "cp866": true,
+	"koi8-r": true, "koi8-u": true,
+	"mac-roman": true, "macroman": true,
+}
+
+// detectEncoding determines the encoding of the contents (data) of
+// file: the encoding indicated by its byte order mark, if it has one;
+// otherwise, the encoding that it declares (in a Python or Ruby
+// encoding declaration), if it is supported; otherwise, UTF-8 if data
+// is valid UTF-8, and ISO-8859-1 (Latin-1) if not. If the file
+// declares an unsupported encoding, it is returned as unsupported.
+func detectEncoding(file string, data []byte) (enc *textEncoding, unsupported string) {
+	for _, b := range byteOrderMarks {
+		if bytes.HasPrefix(data, []byte(b.bom)) {
+			return b.enc, ""
+		}
+	}
+	if decl := declaredEncoding(file, data); decl != "" {
+		name := strings.Replace(strings.ToLower(decl), "_", "-", -1)
+		switch {
+		case name == "utf-8" || name == "utf8":
+			return encodingUTF8, ""
+		case singleByteEncodings[name]:
+			return &textEncoding{name: name}, ""
+		}
+		unsupported = decl
+	}
+	if utf8.Valid(data) {
+		return encodingUTF8, unsupported
+	}
+	return encodingLatin1, unsupported
+}
@@ -0,0 +1,119 @@
+package grapher
+
+import (
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	tests := map[string]struct {
+		file            string
+		data            string
+		want            string
+		wantUnsupported string
+	}{
+		"empty":            {"a.go", "", "utf-8", ""},
+		"utf-8":            {"a.go", "héllo", "utf-8", ""},
+		"invalid utf-8":    {"a.go", "h\xe9llo", "iso-8859-1", ""},
+		"utf-8 BOM":        {"a.go", "\xef\xbb\xbfa", "utf-8", ""},
+		"utf-16le BOM":     {"a.cs", "\xff\xfea\x00", "utf-16le", ""},
+		"utf-16be BOM":     {"a.cs", "\xfe\xff\x00a", "utf-16be", ""},
+		"utf-32le BOM":     {"a.cs", "\xff\xfe\x00\x00a\x00\x00\x00", "utf-32le", ""},
+		"utf-32be BOM":     {"a.cs", "\x00\x00\xfe\xff\x00\x00\x00a", "utf-32be", ""},
+		"python decl":      {"a.py", "# -*- coding: latin-1 -*-\nx = '\xe9'\n", "latin-1", ""},
+		"python decl L2":   {"a.py", "#!/usr/bin/python\n# vim: set fileencoding=cp1252 :\n", "cp1252", ""},
+		"python decl L3":   {"a.py", "#!/usr/bin/python\n\n# coding: latin-1\n\xe9", "iso-8859-1", ""},
+		"python utf-8":     {"a.py", "# coding: utf_8\nx = 'é'\n", "utf-8", ""},
+		"ruby decl":        {"a.rb", "# encoding: ISO-8859-15\n", "iso-8859-15", ""},
+		"unsupported decl": {"a.py", "# coding: shift_jis\n", "utf-8", "shift_jis"},
+		"not a comment":    {"a.py", "coding = 'latin-1'\n\xe9", "iso-8859-1", ""},
+		"other language":   {"a.go", "// coding: latin-1\nx", "utf-8", ""},
+	}
+	for label, test := range tests {
+		enc, unsupported := detectEncoding(test.file, []byte(test.data))
+		if enc.name != test.want || unsupported != test.wantUnsupported {
+			t.Errorf("%s: got encoding %q (unsupported %q), want %q (unsupported %q)", label, enc.name, unsupported, test.want, test.wantUnsupported)
+		}
+	}
+}
+
+func TestRuneIndex_encodings(t *testing.T) {
+	tests := map[string]struct {
+		data string
+		want []int // byte offset of each character, and of the end
+	}{
+		"latin-1":      {"# coding: latin-1\n\xe9\xe9", append(seq(0, 18), 18, 19, 20)},
+		"utf-8 BOM":    {"\xef\xbb\xbfa\xc3\xa9b", []int{3, 4, 6, 7}},
+		"utf-16le":     {"\xff\xfea\x00\xe9\x00=\xd8\x00\xdeb\x00", []int{2, 4, 6, 10, 12}},
+		"utf-16be":     {"\xfe\xff\x00a\xd8=\xde\x00", []int{2, 4, 8}},
+		"utf-32le":     {"\xff\xfe\x00\x00a\x00\x00\x00\x00\xf6\x01\x00", []int{4, 8, 12}},
+		"utf-16le BOM": {"\xff\xfe", []int{2}},
+	}
+	for label, test := range tests {
+		enc, _ := detectEncoding("a.py", []byte(test.data))
+		x := newRuneIndex([]byte(test.data), enc)
+		if x.runes != len(test.want)-1 {
+			t.Errorf("%s: got %d runes, want %d", label, x.runes, len(test.want)-1)
+			continue
+		}
+		for r, want := range test.want {
+			if got, ok := x.byteOffset(r); !ok || got != want {
+				t.Errorf("%s: rune %d: got byte offset %d (%v), want %d", label, r, got, ok, want)
+			}
+		}
+		if _, ok := x.byteOffset(len(test.want)); ok {
+			t.Errorf("%s: got ok for offset beyond the end", label)
+		}
+	}
+}
+
+// seq returns the ints from start up to (but not including) end.
+func seq(start, end int) []int {
+	var s []int
+	for i := start; i < end; i++ {
+		s = append(s, i)
+	}
+	return s
+}
+
+func TestEnsureOffsetsAreByteOffsets_encodings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-encodings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"latin1.py": "# coding: latin-1\n\xe9 = 1\n",
+		"utf16.cs":  "\xff\xfe\xe9\x00 \x00=\x00",
+		"sjis.py":   "# coding: shift_jis\nx = 1\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := slog.New(slog.NewTextHandler(ioutil.Discard, nil))
+
+	o := &graph.Output{Refs: []*graph.Ref{
+		{DefPath: "x", File: "latin1.py", Start: 18, End: 19},
+		{DefPath: "x", File: "utf16.cs", Start: 0, End: 1},
+		{DefPath: "x", File: "sjis.py", Start: 20, End: 21},
+	}}
+	if err := ensureOffsetsAreByteOffsets(dir, o, "", false, l); err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]uint32{{18, 19}, {2, 4}, {20, 21}}
+	for i, r := range o.Refs {
+		if got := [2]uint32{r.Start, r.End}; got != want[i] {
+			t.Errorf("ref %d (%s): got offsets %v, want %v", i, r.File, got, want[i])
+		}
+	}
+	if len(o.Warnings) != 1 || o.Warnings[0].File != "sjis.py" || o.Warnings[0].Severity != graph.SeverityWarning {
+		t.Errorf("got warnings %v, want 1 warning for sjis.py", o.Warnings)
+	}
+}
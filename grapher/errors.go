@@ -0,0 +1,38 @@
+package grapher
+
+import "fmt"
+
+// An OutputError reports that a grapher's output is invalid (e.g., it
+// contains duplicate defs or refers to files that may not be read).
+// It is returned by NormalizeData and is distinct from errors running
+// the grapher itself (see toolchain.RunError).
+type OutputError struct {
+	// UnitType is the type of the source unit whose output is invalid.
+	UnitType string
+
+	// Unit is the name of the source unit, if known.
+	Unit string
+
+	// File is the file that the error pertains to, if any.
+	File string
+
+	// Phase is the normalization step that failed ("paths",
+	// "offsets", "summary", "validate", or "postprocess").
+	Phase string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *OutputError) Error() string {
+	unit := e.UnitType
+	if e.Unit != "" {
+		unit += " " + e.Unit
+	}
+	if e.File != "" {
+		return fmt.Sprintf("invalid %s grapher output (%s) in file %s: %s", unit, e.Phase, e.File, e.Err)
+	}
+	return fmt.Sprintf("invalid %s grapher output (%s): %s", unit, e.Phase, e.Err)
+}
+
+func (e *OutputError) Unwrap() error { return e.Err }
@@ -0,0 +1,81 @@
+package grapher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// maxFuzzInputSize is the size of the largest input that fuzzOutput
+// accepts. Graph output that large is valid, but fuzzing with it is
+// slow and makes memory usage unbounded.
+const maxFuzzInputSize = 1 << 20
+
+var (
+	fuzzDirOnce sync.Once
+	fuzzDirPath string
+)
+
+// fuzzDir returns a directory containing files that the fuzzed
+// output's offsets may refer to (so that offset conversion is
+// exercised).
+func fuzzDir() string {
+	fuzzDirOnce.Do(func() {
+		dir, err := ioutil.TempDir("", "srclib-grapher-fuzz")
+		if err != nil {
+			panic(err)
+		}
+		files := map[string]string{
+			"a.go":      "package a\n\n// Π is π.\nconst Π = 3.14\n",
+			"b/c.py":    "def f(x):\n    return x  # ✓\n",
+			"empty.txt": "",
+		}
+		for name, data := range files {
+			name = filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+				panic(err)
+			}
+			if err := ioutil.WriteFile(name, []byte(data), 0600); err != nil {
+				panic(err)
+			}
+		}
+		fuzzDirPath = dir
+	})
+	return fuzzDirPath
+}
+
+// fuzzOutput feeds data (as grapher output) to VerifyOutput and
+// NormalizeData, which must not panic. It panics if NormalizeData
+// returns an unexpected error or if the normalized output can't be
+// re-encoded. It returns 1 if data is valid output (which
+// go-fuzz should prioritize when mutating inputs) and 0 otherwise.
+func fuzzOutput(data []byte) int {
+	if len(data) > maxFuzzInputSize {
+		return 0
+	}
+
+	// VerifyOutput only returns errors (such as ENAMETOOLONG) reading
+	// the files that the output refers to, which aren't bugs.
+	VerifyOutput(data, VerifyOptions{Dir: fuzzDir(), CharOffsets: true})
+
+	var o graph.Output
+	if err := json.Unmarshal(data, &o); err != nil {
+		return 0
+	}
+	opt := NormalizeOptions{Logger: slog.New(slog.NewTextHandler(ioutil.Discard, nil))}
+	if err := NormalizeDataWithOptions("example.com/repo", "t", fuzzDir(), &o, opt); err != nil {
+		if _, ok := err.(*OutputError); !ok {
+			panic(err)
+		}
+		return 0
+	}
+	if _, err := json.Marshal(&o); err != nil {
+		panic(err)
+	}
+	return 1
+}
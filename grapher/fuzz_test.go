@@ -0,0 +1,45 @@
+package grapher
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// TestFuzzCorpus runs the fuzz corpus (see Fuzz) through fuzzOutput,
+// which panics on failure.
+func TestFuzzCorpus(t *testing.T) {
+	files, err := filepath.Glob("testdata/fuzz/corpus/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no fuzz corpus files")
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fuzzOutput(data)
+	}
+}
+
+func TestNormalizeData_malformed(t *testing.T) {
+	tests := map[string]*graph.Output{
+		"null def":      {Defs: []*graph.Def{nil}},
+		"null ref":      {Refs: []*graph.Ref{{DefPath: "a"}, nil}},
+		"null doc":      {Docs: []*graph.Doc{nil}},
+		"bad DefRepo":   {Refs: []*graph.Ref{{DefRepo: "%zz", DefPath: "a"}}},
+		"bad ref Repo":  {Refs: []*graph.Ref{{Repo: "http://[::1", DefPath: "a"}}},
+		"duplicate def": {Defs: []*graph.Def{{DefKey: graph.DefKey{Path: "a"}}, {DefKey: graph.DefKey{Path: "a"}}}},
+	}
+	for label, o := range tests {
+		err := NormalizeData("example.com/repo", "GoPackage", "", o)
+		if _, ok := err.(*OutputError); !ok {
+			t.Errorf("%s: got error %v, want *OutputError", label, err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build gofuzz
+// +build gofuzz
+
+package grapher
+
+// Fuzz is the entry point for go-fuzz
+// (https://github.com/dvyukov/go-fuzz), which feeds it mutations of
+// the grapher output in testdata/fuzz/corpus. To run it:
+//
+//	go-fuzz-build sourcegraph.com/sourcegraph/srclib/grapher
+//	go-fuzz -bin=grapher-fuzz.zip -workdir=testdata/fuzz
+func Fuzz(data []byte) int { return fuzzOutput(data) }
@@ -1,69 +1,197 @@
 package grapher
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
-
-	"github.com/sqs/fileset"
 
 	"sourcegraph.com/sourcegraph/srclib/ann"
 	"sourcegraph.com/sourcegraph/srclib/config"
 	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
 type Grapher interface {
-	Graph(dir string, unit *unit.SourceUnit, c *config.Repository) (*graph.Output, error)
+	// Graph analyzes the source unit in dir. It should stop and return
+	// ctx.Err() if ctx is done.
+	Graph(ctx context.Context, dir string, unit *unit.SourceUnit, c *config.Repository) (*graph.Output, error)
 }
 
 // TODO(sqs): add grapher validation of output
 
-func ensureOffsetsAreByteOffsets(dir string, output *graph.Output) {
-	fset := fileset.NewFileSet()
-	files := make(map[string]*fileset.File)
+var (
+	// MaxOffsetFixFileSize is the maximum size (in bytes) of a file
+	// that is read to convert grapher output offsets from unicode
+	// character offsets to byte offsets. Offsets in larger files are
+	// left unchanged (graphers sometimes erroneously refer to large
+	// generated or binary files).
+	MaxOffsetFixFileSize int64 = 25 * 1024 * 1024
+
+	// MaxOffsetFixTotalSize is the maximum total number of bytes that
+	// are read (across all files) when converting the offsets in a
+	// single grapher output. After it is exhausted, offsets in the
+	// remaining files are left unchanged.
+	MaxOffsetFixTotalSize int64 = 500 * 1024 * 1024
+)
+
+// binarySniffLen is the number of leading bytes of a file that
+// isBinary checks.
+const binarySniffLen = 8000
+
+// isBinary reports whether data appears to be the contents of a
+// binary (non-text) file; that is, whether a NUL byte occurs in its
+// first binarySniffLen bytes.
+func isBinary(data []byte) bool {
+	if len(data) > binarySniffLen {
+		data = data[:binarySniffLen]
+	}
+	return bytes.IndexByte(data, 0) != -1
+}
+
+// ensureOffsetsAreByteOffsets converts the unicode character offsets
+// in output to byte offsets, by reading the files they refer to.
+//
+// Files that can't be read (such as files that were deleted after
+// the grapher ran) and files that don't contain all of the offsets
+// that refer to them (such as files that changed after the grapher
+// ran) are recorded in output.Warnings (with SeverityWarning), and
+// their offsets are left unchanged. If strict is true, an
+// *OutputError is returned for them instead. Files that are skipped
+// deliberately (such as binary files) are recorded with SeverityInfo.
+//
+// Each file's encoding is detected by detectEncoding, so that files
+// in UTF-16, UTF-32, or legacy single-byte encodings (such as
+// Latin-1) are converted correctly. Files that declare an unsupported
+// encoding are converted as UTF-8 (or Latin-1) and recorded with
+// SeverityWarning.
+func ensureOffsetsAreByteOffsets(dir string, output *graph.Output, symlinks config.SymlinkPolicy, strict bool, l *slog.Logger) error {
+	if !symlinks.Valid() {
+		return config.ErrInvalidSymlinkPolicy
+	}
+
+	files := make(map[string]*runeIndex)
+	allowed := make(map[string]bool) // whether the symlink policy allows reading each file
+	warned := make(map[string]bool)  // whether a warning has been recorded for each file
+	var err error                    // first symlink policy error (or, if strict, warning)
+
+	readBudget := MaxOffsetFixTotalSize
 
-	addOrGetFile := func(filename string) *fileset.File {
-		if f, ok := files[filename]; ok {
+	// warn records a warning about a file (at most one per file), or
+	// fails if strict and the warning has SeverityWarning.
+	warn := func(filename, severity string, format string, args ...interface{}) {
+		if warned[filename] {
+			return
+		}
+		warned[filename] = true
+		msg := fmt.Sprintf(format, args...)
+		if strict && severity == graph.SeverityWarning {
+			err = &OutputError{File: filename, Phase: "offsets", Err: errors.New(msg)}
+			return
+		}
+		l.Warn("Not converting offsets: "+msg+".", "file", filename)
+		output.Warnings = append(output.Warnings, &graph.Warning{File: filename, Message: msg, Phase: "offsets", Severity: severity})
+	}
+
+	// addOrGetFile returns nil if the file can't or shouldn't be read.
+	addOrGetFile := func(filename string) *runeIndex {
+		if f, present := files[filename]; present {
 			return f
 		}
-		data, err := ioutil.ReadFile(filename)
-		if err != nil {
-			panic("ReadFile " + filename + ": " + err.Error())
+		files[filename] = nil
+		path := filepath.Join(dir, filename)
+		fi, statErr := os.Stat(path)
+		if os.IsNotExist(statErr) {
+			warn(filename, graph.SeverityWarning, "file does not exist (it may have been deleted after the grapher ran)")
+			return nil
+		} else if statErr != nil {
+			warn(filename, graph.SeverityWarning, "failed to read file: %s", statErr)
+			return nil
+		}
+		if !fi.Mode().IsRegular() {
+			warn(filename, graph.SeverityWarning, "not a regular file")
+			return nil
+		}
+		if size := fi.Size(); size > MaxOffsetFixFileSize {
+			warn(filename, graph.SeverityInfo, "file is too large (%d bytes; the limit is %d)", size, MaxOffsetFixFileSize)
+			return nil
+		} else if size > readBudget {
+			warn(filename, graph.SeverityInfo, "total read limit (%d bytes) exceeded", MaxOffsetFixTotalSize)
+			return nil
+		}
+		data, readErr := ioutil.ReadFile(path)
+		if os.IsNotExist(readErr) {
+			warn(filename, graph.SeverityWarning, "file does not exist (it may have been deleted after the grapher ran)")
+			return nil
+		} else if readErr != nil {
+			warn(filename, graph.SeverityWarning, "failed to read file: %s", readErr)
+			return nil
+		}
+		readBudget -= int64(len(data))
+		enc, unsupported := detectEncoding(filename, data)
+		if enc.bomLen == 0 && isBinary(data) {
+			warn(filename, graph.SeverityInfo, "file appears to be binary")
+			return nil
+		}
+		if unsupported != "" {
+			warn(filename, graph.SeverityWarning, "file declares unsupported encoding %q (assuming %s; offsets may be incorrect)", unsupported, enc.name)
+			if err != nil {
+				return nil
+			}
+		} else if enc == encodingLatin1 {
+			l.Debug("File is not valid UTF-8; assuming ISO-8859-1.", "file", filename)
 		}
 
-		f := fset.AddFile(filename, fset.Base(), len(data))
-		f.SetByteOffsetsForContent(data)
+		f := newRuneIndex(data, enc)
 		files[filename] = f
 		return f
 	}
 
 	fix := func(filename string, offsets ...*uint32) {
-		defer func() {
-			if e := recover(); e != nil {
-				log.Printf("failed to convert unicode offset to byte offset in file %s (did grapher output a nonexistent byte offset?) continuing anyway...", filename)
-			}
-		}()
-		if filename == "" {
+		if filename == "" || err != nil {
+			return
+		}
+		if isOutsideTree(filename) {
+			warn(filename, graph.SeverityInfo, "file is outside of the tree")
 			return
 		}
-		filename = filepath.Join(dir, filename)
-		if fi, err := os.Stat(filename); err != nil || !fi.Mode().IsRegular() {
+		ok, checked := allowed[filename]
+		if !checked {
+			var err2 error
+			ok, err2 = symlinks.CheckSymlink(dir, filename)
+			if err2 != nil {
+				err = &OutputError{File: filename, Phase: "offsets", Err: err2}
+				return
+			}
+			allowed[filename] = ok
+		}
+		if !ok {
 			return
 		}
 		f := addOrGetFile(filename)
-		for _, offset := range offsets {
-			if *offset == 0 {
-				continue
+		if f == nil {
+			return
+		}
+		converted := make([]uint32, len(offsets))
+		for i, offset := range offsets {
+			after, ok := f.byteOffset(int(*offset))
+			if !ok {
+				warn(filename, graph.SeverityWarning, "offset %d is beyond the end of the file (%d characters long; it may have changed after the grapher ran)", *offset, f.runes)
+				return
 			}
-			before, after := *offset, uint32(f.ByteOffsetOfRune(int(*offset)))
-			if before != after {
-				log.Printf("Changed pos %d to %d in %s", before, after, filename)
+			converted[i] = uint32(after)
+		}
+		for i, offset := range offsets {
+			if *offset != converted[i] {
+				l.Debug("Changed offset.", "file", filename, "from", *offset, "to", converted[i])
 			}
-			*offset = uint32(f.ByteOffsetOfRune(int(*offset)))
+			*offset = converted[i]
 		}
 	}
 
@@ -79,6 +207,7 @@ func ensureOffsetsAreByteOffsets(dir string, output *graph.Output) {
 	for _, a := range output.Anns {
 		fix(a.File, &a.Start, &a.End)
 	}
+	return err
 }
 
 func sortedOutput(o *graph.Output) *graph.Output {
@@ -86,40 +215,164 @@ func sortedOutput(o *graph.Output) *graph.Output {
 	sort.Sort(graph.Refs(o.Refs))
 	sort.Sort(graph.Docs(o.Docs))
 	sort.Sort(ann.Anns(o.Anns))
+	sort.Sort(graph.Warnings(o.Warnings))
+	sort.Sort(graph.FileSummaries(o.Files))
 	return o
 }
 
-// NormalizeData sorts data and performs other postprocessing.
+// NormalizeOptions configures NormalizeDataWithOptions.
+type NormalizeOptions struct {
+	// FoldCase lowercases all file paths in the output (see
+	// NormalizePath). It should be used for repositories built on
+	// case-insensitive filesystems, whose graphers may emit paths
+	// whose case doesn't match the case used elsewhere.
+	FoldCase bool
+
+	// SymlinkPolicy determines whether symlinked files are read when
+	// converting offsets (see config.SymlinkPolicy).
+	SymlinkPolicy config.SymlinkPolicy
+
+	// Vanity, if set, resolves refs' Repo and DefRepo URIs on vanity
+	// domains to the repositories that host them. URIs that it fails
+	// to resolve are logged and kept as they are.
+	Vanity *VanityResolver
+
+	// Strict makes NormalizeData fail (instead of recording a warning,
+	// with SeverityWarning, in the output's Warnings) when a file that
+	// the output refers to can't be read or doesn't contain the
+	// output's offsets; for example, because it was deleted or changed
+	// after the grapher ran.
+	Strict bool
+
+	// Logger receives warnings about the output. Its records should
+	// identify the source unit (see logutil.ForUnit). If nil,
+	// logutil.Default is used.
+	Logger *slog.Logger
+}
+
+// byteOffsetUnitTypes are the source unit types whose graphers emit
+// byte offsets, which NormalizeData needn't convert (see
+// ensureOffsetsAreByteOffsets). Graphers for other source unit types
+// (except Java) emit character offsets.
+var byteOffsetUnitTypes = map[string]bool{"GoPackage": true, "Dockerfile": true}
+
+// RegisterByteOffsetUnitType records that the grapher for the given
+// source unit type emits byte offsets (instead of character offsets),
+// so NormalizeData doesn't convert them. Built-in toolchains (see
+// toolchain.RegisterBuiltin) call it for their source unit types.
+func RegisterByteOffsetUnitType(unitType string) {
+	if unitType == "" {
+		panic("grapher: RegisterByteOffsetUnitType unit type is empty")
+	}
+	byteOffsetUnitTypes[unitType] = true
+}
+
+// NormalizeData sorts data and performs other postprocessing, using
+// the default options.
 func NormalizeData(currentRepoURI, unitType, dir string, o *graph.Output) error {
-	for _, ref := range o.Refs {
-		if ref.DefRepo == currentRepoURI {
-			ref.DefRepo = ""
+	return NormalizeDataWithOptions(currentRepoURI, unitType, dir, o, NormalizeOptions{})
+}
+
+// NormalizeDataWithOptions sorts data and performs other
+// postprocessing.
+func NormalizeDataWithOptions(currentRepoURI, unitType, dir string, o *graph.Output, opt NormalizeOptions) error {
+	logger := opt.Logger
+	if logger == nil {
+		logger = logutil.Default
+	}
+
+	if err := validateNotNull(o); err != nil {
+		return &OutputError{UnitType: unitType, Phase: "validate", Err: err}
+	}
+
+	if err := normalizeWarnings(o); err != nil {
+		return &OutputError{UnitType: unitType, Phase: "validate", Err: err}
+	}
+
+	if err := NormalizePaths(o, false); err != nil {
+		return &OutputError{UnitType: unitType, Phase: "paths", Err: err}
+	}
+
+	dropIgnoredFiles(dir, o, opt.SymlinkPolicy, logger)
+
+	// Normalize repository URIs before comparing them to the current
+	// repository's URI, so that refs to the current repository by
+	// another clone URL form (or a mirror's URI) are recognized.
+	normalizeRepoURI := func(uri string) (string, error) {
+		if uri == "" || uri == currentRepoURI {
+			return "", nil
+		}
+		uri, err := graph.TryMakeURI(uri)
+		if err != nil {
+			return "", err
 		}
-		if ref.DefRepo != "" {
-			ref.DefRepo = graph.MakeURI(string(ref.DefRepo))
+		if opt.Vanity != nil {
+			resolved, err := opt.Vanity.Resolve(context.Background(), uri)
+			if err != nil {
+				logger.Warn("Not resolving vanity repository URI: failed to fetch it.", "uri", uri, "err", err)
+			}
+			uri = resolved
 		}
-		if ref.Repo == currentRepoURI {
-			ref.Repo = ""
+		if uri == currentRepoURI {
+			return "", nil
 		}
-		if ref.Repo != "" {
-			ref.Repo = graph.MakeURI(string(ref.Repo))
+		return uri, nil
+	}
+	for _, ref := range o.Refs {
+		var err error
+		if ref.DefRepo, err = normalizeRepoURI(ref.DefRepo); err != nil {
+			return &OutputError{UnitType: unitType, File: ref.File, Phase: "validate", Err: err}
+		}
+		if ref.Repo, err = normalizeRepoURI(ref.Repo); err != nil {
+			return &OutputError{UnitType: unitType, File: ref.File, Phase: "validate", Err: err}
 		}
 	}
 
-	if unitType != "GoPackage" && unitType != "Dockerfile" && !strings.HasPrefix(unitType, "Java") {
-		ensureOffsetsAreByteOffsets(dir, o)
+	if !EmitsByteOffsets(unitType) {
+		if err := ensureOffsetsAreByteOffsets(dir, o, opt.SymlinkPolicy, opt.Strict, logger); err != nil {
+			if e, ok := err.(*OutputError); ok {
+				e.UnitType = unitType
+			}
+			return err
+		}
 	}
 
-	if err := ValidateRefs(o.Refs); err != nil {
+	if err := summarizeFiles(dir, o, opt.SymlinkPolicy); err != nil {
+		if e, ok := err.(*OutputError); ok {
+			e.UnitType = unitType
+		}
 		return err
 	}
-	if err := ValidateDefs(o.Defs); err != nil {
-		return err
+
+	// Fold case only after the files have been read (above), in case
+	// the filesystem is case-sensitive after all.
+	if opt.FoldCase {
+		if err := NormalizePaths(o, true); err != nil {
+			return &OutputError{UnitType: unitType, Phase: "paths", Err: err}
+		}
 	}
-	if err := ValidateDocs(o.Docs); err != nil {
+
+	for _, def := range o.Defs {
+		def.NormalizeMonikers()
+	}
+
+	if err := validateOutput(unitType, o); err != nil {
 		return err
 	}
 
 	sortedOutput(o)
 	return nil
 }
+
+func validateOutput(unitType string, o *graph.Output) error {
+	if err := ValidateRefs(o.Refs); err != nil {
+		return &OutputError{UnitType: unitType, Phase: "validate", Err: err}
+	}
+	if err := ValidateDefs(o.Defs); err != nil {
+		return &OutputError{UnitType: unitType, Phase: "validate", Err: err}
+	}
+	if err := ValidateDocs(o.Docs); err != nil {
+		return &OutputError{UnitType: unitType, Phase: "validate", Err: err}
+	}
+	return nil
+}
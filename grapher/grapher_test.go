@@ -0,0 +1,113 @@
+package grapher
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestIsBinary(t *testing.T) {
+	tests := map[string]struct {
+		data []byte
+		want bool
+	}{
+		"empty":            {nil, false},
+		"text":             {[]byte("package main\n"), false},
+		"utf-8":            {[]byte("héllo, 世界"), false},
+		"NUL":              {[]byte("ab\x00cd"), true},
+		"NUL after sniff":  {append(bytes.Repeat([]byte("a"), binarySniffLen), 0), false},
+		"NUL before sniff": {append(bytes.Repeat([]byte("a"), binarySniffLen-1), 0), true},
+	}
+	for label, test := range tests {
+		if got := isBinary(test.data); got != test.want {
+			t.Errorf("%s: got %v, want %v", label, got, test.want)
+		}
+	}
+}
+
+func TestRuneIndex(t *testing.T) {
+	for _, s := range []string{"", "abc", "héllo, 世界", strings.Repeat("aé世😀", 100), "a\xffb"} {
+		x := newRuneIndex([]byte(s), nil)
+		r := 0
+		for i := range s {
+			if got, ok := x.byteOffset(r); !ok || got != i {
+				t.Errorf("%q: rune %d: got byte offset %d (%v), want %d", s, r, got, ok, i)
+			}
+			r++
+		}
+		if got, ok := x.byteOffset(r); !ok || got != len(s) {
+			t.Errorf("%q: end: got byte offset %d (%v), want %d", s, got, ok, len(s))
+		}
+		if _, ok := x.byteOffset(r + 1); ok {
+			t.Errorf("%q: got ok for offset beyond the end", s)
+		}
+	}
+}
+
+func TestEnsureOffsetsAreByteOffsets_missingFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-offsets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.py"), []byte("é = 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "d"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	l := slog.New(slog.NewTextHandler(ioutil.Discard, nil))
+
+	newOutput := func() *graph.Output {
+		return &graph.Output{
+			Defs: []*graph.Def{{DefKey: graph.DefKey{Path: "x"}, File: "a.py", DefStart: 2, DefEnd: 3}},
+			Refs: []*graph.Ref{
+				{DefPath: "x", File: "a.py", Start: 1, End: 2},
+				{DefPath: "x", File: "a.py", Start: 5, End: 7}, // beyond the end of a.py
+				{DefPath: "x", File: "deleted.py", Start: 1, End: 2},
+				{DefPath: "x", File: "deleted.py", Start: 3, End: 4},
+				{DefPath: "x", File: "d", Start: 1, End: 2},
+			},
+		}
+	}
+
+	o := newOutput()
+	if err := ensureOffsetsAreByteOffsets(dir, o, "", false, l); err != nil {
+		t.Fatal(err)
+	}
+	if d := o.Defs[0]; d.DefStart != 3 || d.DefEnd != 4 {
+		t.Errorf("got def offsets %d-%d, want 3-4", d.DefStart, d.DefEnd)
+	}
+	wantRefs := [][2]uint32{{2, 3}, {5, 7}, {1, 2}, {3, 4}, {1, 2}}
+	for i, r := range o.Refs {
+		if got := [2]uint32{r.Start, r.End}; got != wantRefs[i] {
+			t.Errorf("ref %d: got offsets %v, want %v", i, got, wantRefs[i])
+		}
+	}
+	var files []string
+	for _, w := range o.Warnings {
+		files = append(files, w.File)
+		if w.Phase != "offsets" || w.Severity != graph.SeverityWarning {
+			t.Errorf("got warning phase %q and severity %q, want offsets and warning", w.Phase, w.Severity)
+		}
+	}
+	if want := []string{"a.py", "deleted.py", "d"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("got warnings for files %v, want %v (warnings: %v)", files, want, o.Warnings)
+	}
+
+	o = newOutput()
+	err = ensureOffsetsAreByteOffsets(dir, o, "", true, l)
+	if oe, ok := err.(*OutputError); !ok || oe.Phase != "offsets" || oe.File != "a.py" {
+		t.Errorf("strict: got error %v, want offsets OutputError for a.py", err)
+	}
+	if len(o.Warnings) != 0 {
+		t.Errorf("strict: got warnings %v, want none", o.Warnings)
+	}
+}
@@ -0,0 +1,69 @@
+package grapher
+
+import (
+	"log/slog"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// dropIgnoredFiles removes the defs, refs, docs, and anns in files
+// that contain the config.IgnoreFilePragma from o. (Scanners' source
+// units don't include such files, but graphers may graph all of the
+// files in a source unit's dir.) Files that are outside of the tree
+// or that the symlink policy doesn't allow reading aren't checked.
+func dropIgnoredFiles(dir string, o *graph.Output, symlinks config.SymlinkPolicy, l *slog.Logger) {
+	ignored := map[string]bool{}
+	isIgnored := func(file string) bool {
+		if file == "" {
+			return false
+		}
+		if ig, checked := ignored[file]; checked {
+			return ig
+		}
+		ig := false
+		if !isOutsideTree(file) {
+			if ok, err := symlinks.CheckSymlink(dir, file); ok && err == nil {
+				ig = config.HasIgnoreFilePragma(filepath.Join(dir, file))
+			}
+		}
+		if ig {
+			l.Debug("Dropping graph output in file with ignore-file pragma.", "file", file)
+		}
+		ignored[file] = ig
+		return ig
+	}
+
+	defs := o.Defs[:0]
+	for _, def := range o.Defs {
+		if !isIgnored(def.File) {
+			defs = append(defs, def)
+		}
+	}
+	o.Defs = defs
+
+	refs := o.Refs[:0]
+	for _, ref := range o.Refs {
+		if !isIgnored(ref.File) {
+			refs = append(refs, ref)
+		}
+	}
+	o.Refs = refs
+
+	docs := o.Docs[:0]
+	for _, doc := range o.Docs {
+		if !isIgnored(doc.File) {
+			docs = append(docs, doc)
+		}
+	}
+	o.Docs = docs
+
+	anns := o.Anns[:0]
+	for _, a := range o.Anns {
+		if !isIgnored(a.File) {
+			anns = append(anns, a)
+		}
+	}
+	o.Anns = anns
+}
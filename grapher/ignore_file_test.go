@@ -0,0 +1,54 @@
+package grapher
+
+import (
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/ann"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestDropIgnoredFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-ignore-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.go":     "package a\n",
+		"gen.go":   "// Code generated by x.\n// srclib:ignore-file\n\npackage a\n",
+		"b/gen.py": "# srclib:ignore-file\n",
+	}
+	for name, data := range files {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o := &graph.Output{
+		Defs: []*graph.Def{{DefKey: graph.DefKey{Path: "A"}, File: "a.go"}, {DefKey: graph.DefKey{Path: "G"}, File: "gen.go"}, {DefKey: graph.DefKey{Path: "X"}}},
+		Refs: []*graph.Ref{{DefPath: "G", File: "a.go"}, {DefPath: "A", File: "gen.go"}, {DefPath: "A", File: "b/gen.py"}, {DefPath: "A", File: "missing.go"}},
+		Docs: []*graph.Doc{{Data: "d", File: "gen.go"}},
+		Anns: []*ann.Ann{{Type: "t", File: "a.go"}, {Type: "t", File: "b/gen.py"}},
+	}
+	dropIgnoredFiles(dir, o, "", slog.New(slog.NewTextHandler(ioutil.Discard, nil)))
+	if len(o.Defs) != 2 || o.Defs[0].Path != "A" || o.Defs[1].Path != "X" {
+		t.Errorf("got defs %+v, want A and X", o.Defs)
+	}
+	if len(o.Refs) != 2 || o.Refs[0].File != "a.go" || o.Refs[1].File != "missing.go" {
+		t.Errorf("got refs %+v, want the refs in a.go and missing.go", o.Refs)
+	}
+	if len(o.Docs) != 0 {
+		t.Errorf("got docs %+v, want none", o.Docs)
+	}
+	if len(o.Anns) != 1 || o.Anns[0].File != "a.go" {
+		t.Errorf("got anns %+v, want the ann in a.go", o.Anns)
+	}
+}
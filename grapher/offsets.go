@@ -0,0 +1,73 @@
+package grapher
+
+import "unicode/utf8"
+
+// runeIndexInterval is the number of runes between the byte offsets
+// that a runeIndex records.
+const runeIndexInterval = 64
+
+// A runeIndex converts unicode character (rune) offsets in a file to
+// byte offsets.
+type runeIndex struct {
+	data  []byte
+	enc   *textEncoding
+	runes int // number of runes in data (excluding the BOM)
+
+	// offsets holds the byte offset of every runeIndexInterval'th
+	// rune. It is nil if each rune is 1 byte (e.g., if data is ASCII),
+	// so byte offsets are rune offsets plus the BOM length.
+	offsets []int
+}
+
+// newRuneIndex returns an index of the runes in data, which is
+// encoded in enc (or UTF-8, if enc is nil).
+func newRuneIndex(data []byte, enc *textEncoding) *runeIndex {
+	if enc == nil {
+		enc = encodingUTF8
+	}
+	x := &runeIndex{data: data, enc: enc}
+	if len(data) < enc.bomLen {
+		return x
+	}
+	singleByte := enc.charLen == nil
+	if !singleByte && enc.bomLen == 0 && enc == encodingUTF8 {
+		singleByte = true
+		for _, b := range data {
+			if b >= utf8.RuneSelf {
+				singleByte = false
+				break
+			}
+		}
+	}
+	if singleByte {
+		x.runes = len(data) - enc.bomLen
+		return x
+	}
+	for i := enc.bomLen; i < len(data); x.runes++ {
+		if x.runes%runeIndexInterval == 0 {
+			x.offsets = append(x.offsets, i)
+		}
+		i += enc.charLen(data[i:])
+	}
+	return x
+}
+
+// byteOffset returns the byte offset of the rune at the given offset.
+// The offset just past the last rune (the end of the file) is valid.
+// It returns false if the offset is beyond the end of the file.
+func (x *runeIndex) byteOffset(runeOffset int) (int, bool) {
+	if runeOffset < 0 || runeOffset > x.runes {
+		return 0, false
+	}
+	if x.offsets == nil {
+		return runeOffset + x.enc.bomLen, true
+	}
+	if runeOffset == x.runes {
+		return len(x.data), true
+	}
+	i := x.offsets[runeOffset/runeIndexInterval]
+	for n := runeOffset % runeIndexInterval; n > 0; n-- {
+		i += x.enc.charLen(x.data[i:])
+	}
+	return i, true
+}
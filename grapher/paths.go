@@ -0,0 +1,109 @@
+package grapher
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// NormalizePath converts p to a clean, slash-separated path (so that
+// paths produced on Windows, such as "a\b.go", match store keys
+// produced elsewhere). If foldCase is true, p is also lowercased
+// (for repositories built on case-insensitive filesystems). The empty
+// path is returned unchanged.
+func NormalizePath(p string, foldCase bool) string {
+	if p == "" {
+		return ""
+	}
+	p = path.Clean(strings.Replace(p, `\`, "/", -1))
+	if foldCase {
+		p = strings.ToLower(p)
+	}
+	return p
+}
+
+// isOutsideTree reports whether the file path p (which is relative to
+// the root of a tree) refers to a file outside the tree.
+func isOutsideTree(p string) bool {
+	p = filepath.Clean(filepath.FromSlash(p))
+	return filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator))
+}
+
+// pathNormalizer normalizes paths and detects collisions between
+// distinct paths that normalize to the same path (which can only
+// occur when case-folding).
+type pathNormalizer struct {
+	foldCase bool
+	orig     map[string]string // normalized path -> path before case-folding
+	errs     MultiError
+}
+
+func newPathNormalizer(foldCase bool) *pathNormalizer {
+	return &pathNormalizer{foldCase: foldCase, orig: map[string]string{}}
+}
+
+func (n *pathNormalizer) normalize(p *string) {
+	if *p == "" {
+		return
+	}
+	unfolded := NormalizePath(*p, false)
+	norm := unfolded
+	if n.foldCase {
+		norm = strings.ToLower(unfolded)
+		if other, present := n.orig[norm]; present && other != unfolded {
+			n.errs = append(n.errs, fmt.Errorf("paths %q and %q differ only in case (can't fold case)", other, unfolded))
+		} else {
+			n.orig[norm] = unfolded
+		}
+	}
+	*p = norm
+}
+
+func (n *pathNormalizer) err() error {
+	if len(n.errs) == 0 {
+		return nil
+	}
+	return n.errs
+}
+
+// NormalizePaths normalizes the File fields of all defs, refs, docs,
+// anns, warnings, and file summaries in o (see NormalizePath). If foldCase is true and two
+// distinct paths differ only in case, an error is returned.
+func NormalizePaths(o *graph.Output, foldCase bool) error {
+	n := newPathNormalizer(foldCase)
+	for _, def := range o.Defs {
+		n.normalize(&def.File)
+	}
+	for _, ref := range o.Refs {
+		n.normalize(&ref.File)
+	}
+	for _, doc := range o.Docs {
+		n.normalize(&doc.File)
+	}
+	for _, ann := range o.Anns {
+		n.normalize(&ann.File)
+	}
+	for _, w := range o.Warnings {
+		n.normalize(&w.File)
+	}
+	for _, s := range o.Files {
+		n.normalize(&s.File)
+	}
+	return n.err()
+}
+
+// NormalizeUnitPaths normalizes the Files and Dir fields of u (see
+// NormalizePath). If foldCase is true and two distinct paths differ
+// only in case, an error is returned.
+func NormalizeUnitPaths(u *unit.SourceUnit, foldCase bool) error {
+	n := newPathNormalizer(foldCase)
+	for i := range u.Files {
+		n.normalize(&u.Files[i])
+	}
+	n.normalize(&u.Dir)
+	return n.err()
+}
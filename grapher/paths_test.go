@@ -0,0 +1,57 @@
+package grapher
+
+import (
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		foldCase bool
+		want     string
+	}{
+		{"", false, ""},
+		{"a/b.go", false, "a/b.go"},
+		{`a\b.go`, false, "a/b.go"},
+		{"./a//b/../c.go", false, "a/c.go"},
+		{`A\B.go`, true, "a/b.go"},
+		{"A/B.go", false, "A/B.go"},
+	}
+	for _, test := range tests {
+		if got := NormalizePath(test.path, test.foldCase); got != test.want {
+			t.Errorf("NormalizePath(%q, %v): got %q, want %q", test.path, test.foldCase, got, test.want)
+		}
+	}
+}
+
+func TestNormalizePaths(t *testing.T) {
+	o := &graph.Output{
+		Defs: []*graph.Def{{File: `A\b.go`}},
+		Refs: []*graph.Ref{{File: "A/b.go"}, {File: "c.go"}},
+	}
+	if err := NormalizePaths(o, true); err != nil {
+		t.Fatal(err)
+	}
+	if o.Defs[0].File != "a/b.go" || o.Refs[0].File != "a/b.go" || o.Refs[1].File != "c.go" {
+		t.Errorf("got def file %q, ref files %q and %q", o.Defs[0].File, o.Refs[0].File, o.Refs[1].File)
+	}
+}
+
+func TestNormalizePaths_collision(t *testing.T) {
+	o := &graph.Output{
+		Refs: []*graph.Ref{{File: "a/B.go"}, {File: "a/b.go"}},
+	}
+	if err := NormalizePaths(o, true); err == nil {
+		t.Error("got nil error, want case collision error")
+	}
+
+	// Without case-folding, there is no collision.
+	o = &graph.Output{
+		Refs: []*graph.Ref{{File: "a/B.go"}, {File: "a/b.go"}},
+	}
+	if err := NormalizePaths(o, false); err != nil {
+		t.Error(err)
+	}
+}
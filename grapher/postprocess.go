@@ -0,0 +1,265 @@
+package grapher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+// A PostProcessor modifies a source unit's graph output after it has
+// been normalized (e.g., to add organization-specific annotations,
+// strip internal paths, or enrich defs). The output is normalized and
+// validated again after all post-processors have run (see
+// PostProcessData), so post-processors can't produce invalid output.
+type PostProcessor interface {
+	PostProcess(ctx context.Context, unitType, unit string, o *graph.Output) error
+}
+
+// PostProcessorFunc is a PostProcessor that is a function.
+type PostProcessorFunc func(ctx context.Context, unitType, unit string, o *graph.Output) error
+
+// PostProcess implements PostProcessor.
+func (f PostProcessorFunc) PostProcess(ctx context.Context, unitType, unit string, o *graph.Output) error {
+	return f(ctx, unitType, unit, o)
+}
+
+// PostProcessors holds the registered post-processors, keyed by name.
+var PostProcessors = make(map[string]PostProcessor)
+
+// RegisterPostProcessor makes a post-processor available by name (see
+// OpenPostProcessor). If RegisterPostProcessor is called twice with
+// the same name, if name is empty, or if p is nil, it panics.
+func RegisterPostProcessor(name string, p PostProcessor) {
+	if name == "" {
+		panic("grapher: RegisterPostProcessor name is empty")
+	}
+	if _, dup := PostProcessors[name]; dup {
+		panic("grapher: RegisterPostProcessor called twice for name " + name)
+	}
+	if p == nil {
+		panic("grapher: RegisterPostProcessor post-processor is nil")
+	}
+	PostProcessors[name] = p
+}
+
+// OpenPostProcessor returns the post-processor specified by spec,
+// which is one of:
+//
+//   - "exec:PROGRAM [ARGS...]", which runs an external program (see
+//     ExecPostProcessor);
+//   - "plugin:PATH", which loads a Go plugin (see OpenPluginPostProcessor);
+//   - or the name of a post-processor registered with
+//     RegisterPostProcessor.
+func OpenPostProcessor(spec string) (PostProcessor, error) {
+	switch {
+	case strings.HasPrefix(spec, "exec:"):
+		args := strings.Fields(strings.TrimPrefix(spec, "exec:"))
+		if len(args) == 0 {
+			return nil, fmt.Errorf("post-processor %q has no program", spec)
+		}
+		return &ExecPostProcessor{Program: args[0], Args: args[1:]}, nil
+	case strings.HasPrefix(spec, "plugin:"):
+		return OpenPluginPostProcessor(strings.TrimPrefix(spec, "plugin:"))
+	}
+	if p, present := PostProcessors[spec]; present {
+		return p, nil
+	}
+	return nil, fmt.Errorf("no post-processor registered with name %q", spec)
+}
+
+// An ExecPostProcessor runs an external program to post-process graph
+// output. The program reads the output as JSON on stdin and writes the
+// modified output as JSON on stdout. The source unit's type and name
+// are in the SRCLIB_UNIT_TYPE and SRCLIB_UNIT environment variables.
+type ExecPostProcessor struct {
+	Program string
+	Args    []string
+}
+
+// PostProcess implements PostProcessor.
+func (p *ExecPostProcessor) PostProcess(ctx context.Context, unitType, unit string, o *graph.Output) error {
+	in, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(p.Program, p.Args...)
+	cmd.Env = append(os.Environ(), "SRCLIB_UNIT_TYPE="+unitType, "SRCLIB_UNIT="+unit)
+	cmd.Stdin = bytes.NewReader(in)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := toolchain.RunCmd(ctx, cmd); err != nil {
+		return fmt.Errorf("post-processor %s: %s", p.Program, err)
+	}
+
+	var o2 graph.Output
+	if err := json.Unmarshal(out.Bytes(), &o2); err != nil {
+		return fmt.Errorf("post-processor %s: invalid output: %s", p.Program, err)
+	}
+	*o = o2
+	return nil
+}
+
+// OpenPluginPostProcessor loads a post-processor from the Go plugin at
+// path. The plugin must export a variable named PostProcessor whose
+// type implements PostProcessor.
+func OpenPluginPostProcessor(path string) (PostProcessor, error) {
+	plug, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := plug.Lookup("PostProcessor")
+	if err != nil {
+		return nil, err
+	}
+	switch p := sym.(type) {
+	case *PostProcessor:
+		return *p, nil
+	case PostProcessor:
+		return p, nil
+	}
+	return nil, fmt.Errorf("plugin %s: PostProcessor (type %T) does not implement grapher.PostProcessor", path, sym)
+}
+
+// PostProcessData runs the post-processors ps (in order) on o, which
+// must already be normalized (see NormalizeData). Afterwards, it
+// normalizes o again and validates it as NormalizeData does. It also
+// checks that all spans are in order and (if dir, the dir that the
+// output's file paths are relative to, is set) within their files,
+// and that the post-processors didn't leave refs to nonexistent defs
+// in the source unit (other than refs that were already dangling).
+func PostProcessData(ctx context.Context, ps []PostProcessor, unitType, unit, dir string, o *graph.Output) (err error) {
+	if len(ps) == 0 {
+		return nil
+	}
+	defer func() {
+		if oe, ok := err.(*OutputError); ok {
+			oe.Unit = unit
+		}
+	}()
+	dangling := danglingUnitRefDefs(unitType, unit, o)
+	for _, p := range ps {
+		if err := p.PostProcess(ctx, unitType, unit, o); err != nil {
+			return &OutputError{UnitType: unitType, Phase: "postprocess", Err: err}
+		}
+	}
+
+	if err := validateNotNull(o); err != nil {
+		return &OutputError{UnitType: unitType, Phase: "validate", Err: err}
+	}
+	if err := normalizeWarnings(o); err != nil {
+		return &OutputError{UnitType: unitType, Phase: "validate", Err: err}
+	}
+	if err := NormalizePaths(o, false); err != nil {
+		return &OutputError{UnitType: unitType, Phase: "paths", Err: err}
+	}
+	for _, def := range o.Defs {
+		def.NormalizeMonikers()
+	}
+	countFileDefs(o)
+	if err := validateOutput(unitType, o); err != nil {
+		return err
+	}
+	if err := validateSpans(dir, o); err != nil {
+		return &OutputError{UnitType: unitType, Phase: "validate", Err: err}
+	}
+	var newlyDangling []string
+	for path := range danglingUnitRefDefs(unitType, unit, o) {
+		if _, wasDangling := dangling[path]; !wasDangling {
+			newlyDangling = append(newlyDangling, path)
+		}
+	}
+	if len(newlyDangling) > 0 {
+		sort.Strings(newlyDangling)
+		var errs MultiError
+		for _, path := range newlyDangling {
+			errs = append(errs, fmt.Errorf("refs to nonexistent def %q in the source unit", path))
+		}
+		return &OutputError{UnitType: unitType, Phase: "validate", Err: errs}
+	}
+	sortedOutput(o)
+	return nil
+}
+
+// danglingUnitRefDefs returns the paths of the nonexistent defs that
+// refs in o to defs in the same source unit point to.
+func danglingUnitRefDefs(unitType, unit string, o *graph.Output) map[string]struct{} {
+	defs := make(map[string]struct{}, len(o.Defs))
+	for _, def := range o.Defs {
+		if def != nil {
+			defs[def.Path] = struct{}{}
+		}
+	}
+	dangling := map[string]struct{}{}
+	for _, ref := range o.Refs {
+		if ref == nil || ref.DefRepo != "" {
+			continue
+		}
+		if (ref.DefUnitType != "" || ref.DefUnit != "") && (ref.DefUnitType != unitType || ref.DefUnit != unit) {
+			continue
+		}
+		if _, exists := defs[ref.DefPath]; !exists {
+			dangling[ref.DefPath] = struct{}{}
+		}
+	}
+	return dangling
+}
+
+// validateSpans checks that the spans of the defs, refs, docs, and
+// anns in o are in order, and, if dir is set, that they end within
+// their files (which are read relative to dir). Files that don't
+// exist or are outside of dir aren't checked (NormalizeData records
+// warnings for them).
+func validateSpans(dir string, o *graph.Output) error {
+	var errs MultiError
+	sizes := map[string]int64{} // -> -1 if not checked
+	check := func(what, file string, start, end uint32) {
+		if start > end {
+			errs = append(errs, fmt.Errorf("%s: span %d-%d ends before it starts", what, start, end))
+			return
+		}
+		if dir == "" || file == "" {
+			return
+		}
+		size, present := sizes[file]
+		if !present {
+			size = -1
+			if !isOutsideTree(file) {
+				if fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(file))); err == nil && fi.Mode().IsRegular() {
+					size = fi.Size()
+				}
+			}
+			sizes[file] = size
+		}
+		if size >= 0 && int64(end) > size {
+			errs = append(errs, fmt.Errorf("%s: span %d-%d is out of bounds of file %s (%d bytes)", what, start, end, file, size))
+		}
+	}
+	for _, def := range o.Defs {
+		check("def "+def.Path, def.File, def.DefStart, def.DefEnd)
+	}
+	for _, ref := range o.Refs {
+		check("ref to "+ref.DefPath, ref.File, ref.Start, ref.End)
+	}
+	for _, doc := range o.Docs {
+		check("doc of "+doc.Path, doc.File, doc.Start, doc.End)
+	}
+	for _, a := range o.Anns {
+		check("ann of "+a.File, a.File, a.Start, a.End)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,106 @@
+package grapher
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestPostProcessData(t *testing.T) {
+	o := &graph.Output{Defs: []*graph.Def{{DefKey: graph.DefKey{Path: "a"}, File: "a.go"}}}
+	addDef := PostProcessorFunc(func(ctx context.Context, unitType, unit string, o *graph.Output) error {
+		o.Defs = append(o.Defs, &graph.Def{DefKey: graph.DefKey{Path: "b"}, File: `x\b.go`})
+		return nil
+	})
+	if err := PostProcessData(context.Background(), []PostProcessor{addDef}, "t", "u", "", o); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Defs) != 2 || o.Defs[1].File != "x/b.go" {
+		t.Errorf("got defs %+v, want def b added (with normalized file path)", o.Defs)
+	}
+}
+
+func TestPostProcessData_invalid(t *testing.T) {
+	o := &graph.Output{Defs: []*graph.Def{{DefKey: graph.DefKey{Path: "a"}}}}
+	dupDef := PostProcessorFunc(func(ctx context.Context, unitType, unit string, o *graph.Output) error {
+		o.Defs = append(o.Defs, &graph.Def{DefKey: graph.DefKey{Path: "a"}})
+		return nil
+	})
+	err := PostProcessData(context.Background(), []PostProcessor{dupDef}, "t", "u", "", o)
+	if oe, ok := err.(*OutputError); !ok || oe.Phase != "validate" || oe.Unit != "u" {
+		t.Errorf("got error %v, want validate OutputError for unit u", err)
+	}
+}
+
+func TestPostProcessData_validate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-postprocess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("func a() {}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		modify  func(o *graph.Output)
+		wantErr string // empty if no error is expected
+	}{
+		"unchanged": {
+			modify: func(o *graph.Output) {},
+		},
+		"reversed def span": {
+			modify:  func(o *graph.Output) { o.Defs[0].DefStart, o.Defs[0].DefEnd = 11, 5 },
+			wantErr: "def a: span 11-5 ends before it starts",
+		},
+		"def span past end of file": {
+			modify:  func(o *graph.Output) { o.Defs[0].DefEnd = 100 },
+			wantErr: "def a: span 5-100 is out of bounds of file a.go (11 bytes)",
+		},
+		"reversed ref span": {
+			modify:  func(o *graph.Output) { o.Refs[0].Start = 7 },
+			wantErr: "ref to a: span 7-6 ends before it starts",
+		},
+		"null def": {
+			modify:  func(o *graph.Output) { o.Defs = append(o.Defs, nil) },
+			wantErr: "Defs[1] is null",
+		},
+		"removed def": {
+			modify:  func(o *graph.Output) { o.Defs = nil },
+			wantErr: `refs to nonexistent def "a" in the source unit`,
+		},
+		"already dangling ref": {
+			// Refs that were dangling before post-processing are
+			// left alone.
+			modify: func(o *graph.Output) { o.Refs[1].File = "a.go" },
+		},
+	}
+	for label, test := range tests {
+		o := &graph.Output{
+			Defs: []*graph.Def{{DefKey: graph.DefKey{Path: "a"}, Name: "a", File: "a.go", DefStart: 5, DefEnd: 11}},
+			Refs: []*graph.Ref{
+				{DefPath: "a", File: "a.go", Start: 5, End: 6},
+				{DefPath: "x", File: "b.go", Start: 1, End: 2},
+			},
+		}
+		modify := PostProcessorFunc(func(ctx context.Context, unitType, unit string, o *graph.Output) error {
+			test.modify(o)
+			return nil
+		})
+		err := PostProcessData(context.Background(), []PostProcessor{modify}, "t", "u", dir, o)
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %s", label, err)
+			}
+			continue
+		}
+		if oe, ok := err.(*OutputError); !ok || oe.Phase != "validate" || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: got error %v, want validate OutputError containing %q", label, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package grapher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// Redaction describes data to remove from build data before it is
+// shared outside of the organization that produced it (e.g., by
+// uploading it or importing it into a store that others query). It
+// is typically read from a JSON file (see ReadRedaction).
+type Redaction struct {
+	// ExcludeFiles is a list of patterns (in path.Match syntax) that
+	// match files whose defs, refs, docs, and anns are dropped. A
+	// pattern that matches a directory excludes all files beneath
+	// it. Paths are relative to the repository root.
+	ExcludeFiles []string `json:",omitempty"`
+
+	// StripDocs removes the contents of all docs (leaving their keys
+	// and spans, so that doc links still resolve).
+	StripDocs bool `json:",omitempty"`
+
+	// Anonymize removes authorship information (see authorshipKeys)
+	// from the opaque Data fields of source units, defs, and anns.
+	Anonymize bool `json:",omitempty"`
+}
+
+// authorshipKeys are the (lowercased) top-level keys of Data JSON
+// objects that are removed when anonymizing. Toolchains often copy
+// these from package metadata (e.g., npm's package.json).
+var authorshipKeys = map[string]struct{}{
+	"author":       {},
+	"authors":      {},
+	"committer":    {},
+	"committers":   {},
+	"contributors": {},
+	"maintainers":  {},
+	"email":        {},
+}
+
+// ReadRedaction reads a JSON-encoded Redaction from the named file and
+// validates it.
+func ReadRedaction(filename string) (*Redaction, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r *Redaction
+	if err := json.NewDecoder(f).Decode(&r); err != nil {
+		return nil, fmt.Errorf("redaction rules %s: %s", filename, err)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("redaction rules %s: %s", filename, err)
+	}
+	return r, nil
+}
+
+// Validate returns an error if any of r's ExcludeFiles patterns are
+// malformed.
+func (r *Redaction) Validate() error {
+	for _, pat := range r.ExcludeFiles {
+		if _, err := path.Match(pat, ""); err != nil {
+			return fmt.Errorf("invalid ExcludeFiles pattern %q: %s", pat, err)
+		}
+	}
+	return nil
+}
+
+// Excluded returns whether file (or any of its parent dirs) matches
+// one of r's ExcludeFiles patterns.
+func (r *Redaction) Excluded(file string) bool {
+	if file == "" || len(r.ExcludeFiles) == 0 {
+		return false
+	}
+	file = NormalizePath(file, false)
+	for p := file; p != "." && p != "/"; p = path.Dir(p) {
+		for _, pat := range r.ExcludeFiles {
+			if ok, _ := path.Match(pat, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Redact removes the data described by r from o, in place. Refs in
+// other files that point to defs in excluded files are kept (only
+// the def itself is hidden). Docs are removed if they are in excluded
+// files or document removed defs (since a doc's File is optional).
+func (r *Redaction) Redact(o *graph.Output) error {
+	if r == nil {
+		return nil
+	}
+
+	redacted := map[graph.DefKey]struct{}{}
+	defs := o.Defs[:0]
+	for _, def := range o.Defs {
+		if r.Excluded(def.File) {
+			redacted[def.DefKey] = struct{}{}
+			continue
+		}
+		if r.StripDocs {
+			def.Docs = nil
+		}
+		if r.Anonymize {
+			data, err := anonymizeJSON(def.Data)
+			if err != nil {
+				return fmt.Errorf("def %s: %s", def.Path, err)
+			}
+			def.Data = data
+		}
+		defs = append(defs, def)
+	}
+	o.Defs = defs
+
+	refs := o.Refs[:0]
+	for _, ref := range o.Refs {
+		if !r.Excluded(ref.File) {
+			refs = append(refs, ref)
+		}
+	}
+	o.Refs = refs
+
+	docs := o.Docs[:0]
+	for _, doc := range o.Docs {
+		if _, isRedacted := redacted[doc.DefKey]; isRedacted || r.Excluded(doc.File) {
+			continue
+		}
+		if r.StripDocs {
+			doc.Data = ""
+		}
+		docs = append(docs, doc)
+	}
+	o.Docs = docs
+
+	anns := o.Anns[:0]
+	for _, a := range o.Anns {
+		if r.Excluded(a.File) {
+			continue
+		}
+		if r.Anonymize {
+			data, err := anonymizeJSON(a.Data)
+			if err != nil {
+				return fmt.Errorf("ann %s %d-%d: %s", a.File, a.Start, a.End, err)
+			}
+			a.Data = data
+		}
+		anns = append(anns, a)
+	}
+	o.Anns = anns
+
+	warnings := o.Warnings[:0]
+	for _, w := range o.Warnings {
+		if r.Excluded(w.File) {
+			continue
+		}
+		warnings = append(warnings, w)
+	}
+	o.Warnings = warnings
+
+	files := o.Files[:0]
+	for _, s := range o.Files {
+		if !r.Excluded(s.File) {
+			files = append(files, s)
+		}
+	}
+	o.Files = files
+	return nil
+}
+
+// RedactUnit removes the data described by r from u, in place.
+func (r *Redaction) RedactUnit(u *unit.SourceUnit) {
+	if r == nil {
+		return
+	}
+	files := u.Files[:0]
+	for _, f := range u.Files {
+		if !r.Excluded(f) {
+			files = append(files, f)
+		}
+	}
+	u.Files = files
+	if r.Anonymize {
+		if m, ok := u.Data.(map[string]interface{}); ok {
+			for k := range m {
+				if _, isAuthorship := authorshipKeys[strings.ToLower(k)]; isAuthorship {
+					delete(m, k)
+				}
+			}
+		}
+	}
+}
+
+// RedactCoverage removes the coverage of excluded files from cov.
+func (r *Redaction) RedactCoverage(cov []*FileCoverage) []*FileCoverage {
+	if r == nil {
+		return cov
+	}
+	keep := cov[:0]
+	for _, c := range cov {
+		if !r.Excluded(c.File) {
+			keep = append(keep, c)
+		}
+	}
+	return keep
+}
+
+// anonymizeJSON removes authorship keys from data if it is a JSON
+// object. Other JSON values are returned unchanged.
+func anonymizeJSON(data json.RawMessage) (json.RawMessage, error) {
+	if t := bytes.TrimSpace(data); len(t) == 0 || t[0] != '{' {
+		return data, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	changed := false
+	for k := range m {
+		if _, isAuthorship := authorshipKeys[strings.ToLower(k)]; isAuthorship {
+			delete(m, k)
+			changed = true
+		}
+	}
+	if !changed {
+		return data, nil
+	}
+	return json.Marshal(m)
+}
@@ -0,0 +1,104 @@
+package grapher
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/ann"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestRedaction_Excluded(t *testing.T) {
+	r := &Redaction{ExcludeFiles: []string{"internal", "*.secret.go", "a/*/c.go"}}
+	tests := map[string]bool{
+		"":                   false,
+		"a.go":               false,
+		"internal/x.go":      true,
+		"internal/y/z.go":    true,
+		"x/internal/y.go":    false,
+		"k.secret.go":        true,
+		"d/k.secret.go":      false,
+		"a/b/c.go":           true,
+		`a\b\c.go`:           true,
+		"a/b/d.go":           false,
+		"internalfoo/bar.go": false,
+	}
+	for file, want := range tests {
+		if got := r.Excluded(file); got != want {
+			t.Errorf("%q: got excluded %v, want %v", file, got, want)
+		}
+	}
+}
+
+func TestRedaction_Redact(t *testing.T) {
+	r := &Redaction{ExcludeFiles: []string{"secret"}, StripDocs: true, Anonymize: true}
+	o := &graph.Output{
+		Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "a"}, File: "a.go", Data: json.RawMessage(`{"Author":"x","Kind":"func"}`), Docs: []graph.DefDoc{{Format: "text/plain", Data: "d"}}},
+			{DefKey: graph.DefKey{Path: "b"}, File: "secret/b.go"},
+		},
+		Refs: []*graph.Ref{
+			{DefPath: "b", File: "a.go"},
+			{DefPath: "a", File: "secret/b.go"},
+		},
+		Docs: []*graph.Doc{
+			{DefKey: graph.DefKey{Path: "a"}, Data: "d", File: "a.go"},
+			{DefKey: graph.DefKey{Path: "b"}, Data: "d", File: "secret/b.go"},
+			{DefKey: graph.DefKey{Path: "b"}, Data: "d2"}, // no File
+		},
+		Anns: []*ann.Ann{
+			{File: "a.go", Type: "t", Data: json.RawMessage(`"x"`)},
+			{File: "secret/b.go", Type: "t"},
+		},
+	}
+	if err := r.Redact(o); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(o.Defs) != 1 || o.Defs[0].Path != "a" {
+		t.Fatalf("got defs %+v, want only def a", o.Defs)
+	}
+	if o.Defs[0].Docs != nil {
+		t.Errorf("got def docs %+v, want none", o.Defs[0].Docs)
+	}
+	if want := `{"Kind":"func"}`; string(o.Defs[0].Data) != want {
+		t.Errorf("got def data %s, want %s", o.Defs[0].Data, want)
+	}
+	if len(o.Refs) != 1 || o.Refs[0].DefPath != "b" {
+		t.Errorf("got refs %+v, want only ref from a.go", o.Refs)
+	}
+	if len(o.Docs) != 1 || o.Docs[0].Data != "" {
+		t.Errorf("got docs %+v, want only doc for a (with no data)", o.Docs)
+	}
+	if len(o.Anns) != 1 || string(o.Anns[0].Data) != `"x"` {
+		t.Errorf("got anns %+v, want only ann in a.go (with unchanged data)", o.Anns)
+	}
+}
+
+func TestRedaction_RedactUnit(t *testing.T) {
+	r := &Redaction{ExcludeFiles: []string{"secret"}, Anonymize: true}
+	u := &unit.SourceUnit{
+		Files: []string{"a.go", "secret/b.go"},
+		Data:  map[string]interface{}{"name": "u", "author": "x", "Contributors": []interface{}{"y"}},
+	}
+	r.RedactUnit(u)
+	if want := []string{"a.go"}; !reflect.DeepEqual(u.Files, want) {
+		t.Errorf("got files %v, want %v", u.Files, want)
+	}
+	if want := map[string]interface{}{"name": "u"}; !reflect.DeepEqual(u.Data, want) {
+		t.Errorf("got data %v, want %v", u.Data, want)
+	}
+}
+
+func TestRedaction_nil(t *testing.T) {
+	var r *Redaction
+	o := &graph.Output{Defs: []*graph.Def{{File: "a.go"}}}
+	if err := r.Redact(o); err != nil {
+		t.Fatal(err)
+	}
+	if len(o.Defs) != 1 {
+		t.Errorf("got %d defs, want 1", len(o.Defs))
+	}
+}
@@ -16,6 +16,13 @@ import (
 
 const graphOp = "graph"
 
+// GraphLastConfigKey is the source unit Config key that, if set to
+// true, makes the source unit be graphed after all other source units
+// that aren't graphed last. Its graph rules depend on the other
+// source units' graph output, so its grapher can read it (e.g., to
+// resolve refs by name) and it is regraphed when they change.
+const GraphLastConfigKey = "GraphLast"
+
 func init() {
 	plan.RegisterRuleMaker(graphOp, makeGraphRules)
 	buildstore.RegisterDataType("graph", &graph.Output{})
@@ -34,32 +41,119 @@ func makeGraphRules(c *config.Tree, dataDir string, existing []makex.Rule, opt p
 			toolRef = choice
 		}
 
-		rules = append(rules, &GraphUnitRule{dataDir, u, toolRef, opt})
+		rules = append(rules, &GraphUnitRule{dataDir: dataDir, Unit: u, Tool: toolRef, opt: opt})
+
+		// Graph each variant as a separate source unit, so that code
+		// that is only compiled in some build configurations is
+		// graphed.
+		for _, v := range u.Variants {
+			rules = append(rules, &GraphUnitRule{dataDir: dataDir, Unit: u.Variant(v, true), Tool: toolRef, Variant: v, opt: opt})
+		}
+	}
+
+	var others []string // targets of rules for units not graphed last
+	for _, r := range rules {
+		if r := r.(*GraphUnitRule); !graphLast(r.Unit) {
+			others = append(others, r.Target())
+		}
+	}
+	for _, r := range rules {
+		if r := r.(*GraphUnitRule); graphLast(r.Unit) {
+			r.after = others
+		}
 	}
 	return rules, nil
 }
 
+func graphLast(u *unit.SourceUnit) bool {
+	last, _ := u.Config[GraphLastConfigKey].(bool)
+	return last
+}
+
 type GraphUnitRule struct {
 	dataDir string
 	Unit    *unit.SourceUnit
 	Tool    *srclib.ToolRef
-	opt     plan.Options
+
+	// Variant is the build configuration that the rule graphs the
+	// source unit under, or nil for the source unit's own
+	// configuration. If set, Unit is the variant source unit (see
+	// (*unit.SourceUnit).Variant).
+	Variant *unit.Variant
+
+	// after are the targets of the rules that must run first (see
+	// GraphLastConfigKey).
+	after []string
+
+	opt plan.Options
 }
 
 func (r *GraphUnitRule) Target() string {
 	return filepath.Join(r.dataDir, plan.SourceUnitDataFilename(&graph.Output{}, r.Unit))
 }
 
+// unitFile returns the path to the source unit file that the tool
+// reads. Variant source units have no source unit files of their own;
+// they are derived from the source unit file of the source unit that
+// they are a variant of.
+func (r *GraphUnitRule) unitFile() string {
+	u := r.Unit
+	if r.Variant != nil {
+		name, _ := unit.SplitVariantName(u.Name)
+		u = &unit.SourceUnit{Name: name, Type: u.Type}
+	}
+	return filepath.Join(r.dataDir, plan.SourceUnitDataFilename(unit.SourceUnit{}, u))
+}
+
+// Prereqs returns the source unit file and, if the source unit has no
+// fingerprint, its files. If it has a fingerprint, the source unit file
+// is only rewritten (by `src config`) when the fingerprint changes, so
+// the files themselves needn't be prereqs. Source units that are
+// graphed last also depend on the other source units' graph output.
 func (r *GraphUnitRule) Prereqs() []string {
-	ps := []string{filepath.Join(r.dataDir, plan.SourceUnitDataFilename(unit.SourceUnit{}, r.Unit))}
-	ps = append(ps, r.Unit.Files...)
-	return ps
+	ps := []string{r.unitFile()}
+	if r.Unit.Fingerprint == "" {
+		ps = append(ps, r.Unit.Files...)
+	}
+	return append(ps, r.after...)
 }
 
 func (r *GraphUnitRule) Recipes() []string {
-	return []string{
-		fmt.Sprintf("src tool %s %q %q < $< | src internal normalize-graph-data --unit-type %q --dir . 1> $@", r.opt.ToolchainExecOpt, r.Tool.Toolchain, r.Tool.Subcmd, r.Unit.Type),
+	var normalizeOpts string
+	if p := config.UnitSymlinkPolicy(r.Unit); p != "" {
+		normalizeOpts = fmt.Sprintf(" --symlinks %q", p)
+	}
+	for _, p := range config.UnitPostProcessors(r.Unit) {
+		normalizeOpts += fmt.Sprintf(" --post-process %q", p)
+	}
+	if config.UnitResolveVanityURIs(r.Unit) {
+		normalizeOpts += " --resolve-vanity-uris"
 	}
+	if r.opt.Strict {
+		normalizeOpts += " --strict"
+	}
+	tool := fmt.Sprintf("src tool %s %q %q < $<", r.opt.ToolchainExecOpt, r.Tool.Toolchain, r.Tool.Subcmd)
+	if r.Variant != nil {
+		// Give the tool the source unit configured for the variant.
+		tool = fmt.Sprintf("src internal unit-variant --variant %q < $< | src tool %s %q %q", r.Variant.Name, r.opt.ToolchainExecOpt, r.Tool.Toolchain, r.Tool.Subcmd)
+	}
+	cmd := fmt.Sprintf("%s | src internal normalize-graph-data --unit-type %q --unit %q --dir .%s", tool, r.Unit.Type, r.Unit.Name, normalizeOpts)
+	if r.opt.VerifyDeterminism {
+		return []string{
+			cmd + " 1> $@",
+			cmd + " 1> $@" + determinismCheckSuffix,
+			"src internal verify-determinism $@ $@" + determinismCheckSuffix,
+		}
+	}
+	return []string{cmd + " 1> $@"}
 }
 
+// determinismCheckSuffix is appended to the target of a graph rule to
+// get the name of the file that the second graph run's output is
+// written to when verifying that graphing is deterministic (see
+// plan.Options.VerifyDeterminism).
+const determinismCheckSuffix = ".determinism-check"
+
 func (r *GraphUnitRule) SourceUnit() *unit.SourceUnit { return r.Unit }
+
+func (r *GraphUnitRule) Op() string { return graphOp }
@@ -0,0 +1,101 @@
+package grapher
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// spanSlack is the number of bytes before and after a def's span that
+// ValidateDefSpans searches for the def's name when it does not occur
+// in or adjacent to the span (to report how far off the span is).
+const spanSlack = 16
+
+// ValidateDefSpans checks that each def's Name occurs within (or
+// immediately before or after) its DefStart-DefEnd byte span in the
+// def's file, which is read from the filesystem (relative to dir).
+// Adjacent names are accepted because some graphers' spans cover only
+// the def's body or only the keywords before its name. Graphers that
+// emit off-by-one or stale offsets fail this check.
+//
+// Defs with no name, file, or span are not checked. Because some
+// languages have defs whose names do not literally appear in the
+// source (e.g., anonymous or synthesized defs), this check is
+// heuristic and optional.
+func ValidateDefSpans(dir string, defs []*graph.Def) (errs MultiError) {
+	files := map[string][]byte{}
+	fileErrs := map[string]error{}
+	readFile := func(name string) ([]byte, error) {
+		if data, present := files[name]; present {
+			return data, nil
+		}
+		if err, present := fileErrs[name]; present {
+			return nil, err
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			fileErrs[name] = err
+			errs = append(errs, err)
+			return nil, err
+		}
+		files[name] = data
+		return data, nil
+	}
+
+	for _, def := range defs {
+		if def.Name == "" || def.File == "" || (def.DefStart == 0 && def.DefEnd == 0) {
+			continue
+		}
+		data, err := readFile(def.File)
+		if err != nil {
+			continue
+		}
+		if err := checkDefSpan(data, def); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return
+}
+
+func checkDefSpan(data []byte, def *graph.Def) error {
+	start, end := int(def.DefStart), int(def.DefEnd)
+	if start > end || end > len(data) {
+		return fmt.Errorf("def %s: span %d-%d is out of bounds of file %s (%d bytes)", def.DefKey, start, end, def.File, len(data))
+	}
+
+	name := []byte(def.Name)
+	if bytes.Contains(data[start:end], name) {
+		return nil
+	}
+	if bytes.HasSuffix(data[:start], name) || bytes.HasPrefix(data[end:], name) {
+		return nil
+	}
+
+	// Search near the span to report how far off it is.
+	nearStart, nearEnd := start-spanSlack, end+spanSlack
+	if nearStart < 0 {
+		nearStart = 0
+	}
+	if nearEnd > len(data) {
+		nearEnd = len(data)
+	}
+	if i := bytes.Index(data[nearStart:nearEnd], name); i != -1 {
+		pos := nearStart + i
+		delta := pos - start
+		if pos > start {
+			delta = pos + len(name) - end
+		}
+		return fmt.Errorf("def %s: name %q is %d bytes outside of span %d-%d of file %s (off-by-%d offsets?)", def.DefKey, def.Name, abs(delta), start, end, def.File, abs(delta))
+	}
+	return fmt.Errorf("def %s: name %q is not in or near span %d-%d of file %s (stale offsets?)", def.DefKey, def.Name, start, end, def.File)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
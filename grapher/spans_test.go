@@ -0,0 +1,43 @@
+package grapher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestValidateDefSpans(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-grapher-spans")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "f"), []byte("func Foo() {}\nfunc Bar() {}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		def   *graph.Def
+		valid bool
+	}{
+		"name in span":     {&graph.Def{Name: "Foo", File: "f", DefStart: 5, DefEnd: 8}, true},
+		"name in decl":     {&graph.Def{Name: "Bar", File: "f", DefStart: 14, DefEnd: 27}, true},
+		"name before span": {&graph.Def{Name: "Foo", File: "f", DefStart: 8, DefEnd: 13}, true},
+		"name after span":  {&graph.Def{Name: "Bar", File: "f", DefStart: 14, DefEnd: 19}, true},
+		"off by one":       {&graph.Def{Name: "Foo", File: "f", DefStart: 6, DefEnd: 9}, false},
+		"stale":            {&graph.Def{Name: "Qux", File: "f", DefStart: 5, DefEnd: 8}, false},
+		"out of bounds":    {&graph.Def{Name: "Foo", File: "f", DefStart: 5, DefEnd: 100}, false},
+		"no span":          {&graph.Def{Name: "Qux", File: "f"}, true},
+		"nonexistent file": {&graph.Def{Name: "Foo", File: "g", DefStart: 5, DefEnd: 8}, false},
+	}
+	for label, test := range tests {
+		errs := ValidateDefSpans(dir, []*graph.Def{test.def})
+		if valid := len(errs) == 0; valid != test.valid {
+			t.Errorf("%s: got valid == %v, want %v (errors: %v)", label, valid, test.valid, errs)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package grapher
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// fileLanguages maps file extensions to the languages of the files
+// that have them (see FileLanguage).
+var fileLanguages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".rb":    "ruby",
+	".js":    "javascript",
+	".jsx":   "javascript",
+	".java":  "java",
+	".scala": "scala",
+	".ts":    "typescript",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "c++",
+	".cpp":   "c++",
+	".cs":    "c#",
+	".php":   "php",
+	".rs":    "rust",
+}
+
+// FileLanguage returns the programming language of the named file
+// (based on its extension), or "" if it is unknown.
+func FileLanguage(name string) string {
+	return fileLanguages[path.Ext(name)]
+}
+
+// summarizeFiles sets o.Files to summaries of the files that o's defs,
+// refs, docs, and anns are in. The files' SLOC is counted by reading
+// them in dir (unless dir is empty); files that the symlink policy
+// doesn't allow reading, that are too large (see
+// MaxOffsetFixFileSize), or that are binary have SLOC 0.
+func summarizeFiles(dir string, o *graph.Output, symlinks config.SymlinkPolicy) error {
+	files := map[string]bool{}
+	for _, def := range o.Defs {
+		files[def.File] = true
+	}
+	for _, ref := range o.Refs {
+		files[ref.File] = true
+	}
+	for _, doc := range o.Docs {
+		files[doc.File] = true
+	}
+	for _, a := range o.Anns {
+		files[a.File] = true
+	}
+	delete(files, "")
+
+	o.Files = make([]*graph.FileSummary, 0, len(files))
+	for file := range files {
+		s := &graph.FileSummary{File: file, Language: FileLanguage(file)}
+		if dir != "" && !isOutsideTree(file) {
+			n, err := countSLOC(dir, file, symlinks)
+			if err != nil {
+				return &OutputError{File: file, Phase: "summary", Err: err}
+			}
+			s.SLOC = n
+		}
+		o.Files = append(o.Files, s)
+	}
+	countFileDefs(o)
+	return nil
+}
+
+// countSLOC returns the number of lines in file (in dir) that aren't
+// blank, or 0 if the file can't or shouldn't be read. Only symlink
+// policy errors are returned.
+func countSLOC(dir, file string, symlinks config.SymlinkPolicy) (uint32, error) {
+	if ok, err := symlinks.CheckSymlink(dir, file); err != nil || !ok {
+		return 0, err
+	}
+	name := filepath.Join(dir, filepath.FromSlash(file))
+	if fi, err := os.Stat(name); err != nil || !fi.Mode().IsRegular() || fi.Size() > MaxOffsetFixFileSize {
+		return 0, nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil || isBinary(data) {
+		return 0, nil
+	}
+	var n uint32
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i != -1 {
+			line, data = data[:i], data[i+1:]
+		} else {
+			data = nil
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// countFileDefs sets the DefCount and TopLevelDefs of o.Files from
+// o.Defs (adding summaries for files that o.Files is missing), so that
+// they reflect changes to the defs (e.g., by post-processors).
+func countFileDefs(o *graph.Output) {
+	summaries := make(map[string]*graph.FileSummary, len(o.Files))
+	for _, s := range o.Files {
+		s.DefCount, s.TopLevelDefs = 0, nil
+		summaries[s.File] = s
+	}
+	defsByFile := map[string][]*graph.Def{}
+	for _, def := range o.Defs {
+		if def.File == "" {
+			continue
+		}
+		s, ok := summaries[def.File]
+		if !ok {
+			s = &graph.FileSummary{File: def.File, Language: FileLanguage(def.File)}
+			summaries[def.File] = s
+			o.Files = append(o.Files, s)
+		}
+		s.DefCount++
+		defsByFile[def.File] = append(defsByFile[def.File], def)
+	}
+	for file, defs := range defsByFile {
+		s := summaries[file]
+		for _, n := range graph.Outline(defs) {
+			if !n.Def.Local {
+				s.TopLevelDefs = append(s.TopLevelDefs, n.Def.Path)
+			}
+		}
+	}
+	sort.Sort(graph.FileSummaries(o.Files))
+}
@@ -0,0 +1,67 @@
+package grapher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestSummarizeFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"a.go":    "package a\n\n// A is a type.\ntype A struct{}\n  \nfunc (A) M() {}",
+		"b/c.py":  "x = 1\n",
+		"bin.dat": "\x00\x01\x02\n",
+	}
+	for name, data := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	o := &graph.Output{
+		Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "A/M"}, File: "a.go", ParentPath: "A", DefStart: 60, DefEnd: 75},
+			{DefKey: graph.DefKey{Path: "A"}, File: "a.go", DefStart: 28, DefEnd: 44},
+			{DefKey: graph.DefKey{Path: "x"}, File: "b/c.py", DefStart: 0, DefEnd: 5},
+			{DefKey: graph.DefKey{Path: "x/y"}, File: "b/c.py", Local: true, DefStart: 6, DefEnd: 7},
+		},
+		Refs: []*graph.Ref{
+			{DefPath: "A", File: "bin.dat"},
+			{DefPath: "A", File: "missing.go"},
+		},
+	}
+	if err := summarizeFiles(dir, o, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := []*graph.FileSummary{
+		{File: "a.go", Language: "go", SLOC: 4, DefCount: 2, TopLevelDefs: []string{"A"}},
+		{File: "b/c.py", Language: "python", SLOC: 1, DefCount: 2, TopLevelDefs: []string{"x"}},
+		{File: "bin.dat"},
+		{File: "missing.go", Language: "go"},
+	}
+	if !reflect.DeepEqual(o.Files, want) {
+		t.Errorf("got summaries %+v, want %+v", o.Files, want)
+	}
+
+	// Recounting reflects defs that were removed (and added).
+	o.Defs = append(o.Defs[1:], &graph.Def{DefKey: graph.DefKey{Path: "D"}, File: "d.rb"})
+	countFileDefs(o)
+	want[0].DefCount = 1
+	want = append(want[:3], &graph.FileSummary{File: "d.rb", Language: "ruby", DefCount: 1, TopLevelDefs: []string{"D"}}, want[3])
+	if !reflect.DeepEqual(o.Files, want) {
+		t.Errorf("after recount: got summaries %+v, want %+v", o.Files, want)
+	}
+}
@@ -17,23 +17,106 @@ func ValidateRefs(refs []*graph.Ref) (errs MultiError) {
 		} else {
 			refKeys[key] = struct{}{}
 		}
+		if !graph.ValidConfidence(ref.Confidence) {
+			errs = append(errs, fmt.Errorf("ref %+v: Confidence %v is not between 0 and 1", key, ref.Confidence))
+		}
 	}
 	return
 }
 
 func ValidateDefs(defs []*graph.Def) (errs MultiError) {
-	defKeys := make(map[graph.DefKey]struct{})
+	defKeys := make(map[graph.DefKey]*graph.Def)
 	for _, def := range defs {
 		key := def.DefKey
 		if _, in := defKeys[key]; in {
 			errs = append(errs, fmt.Errorf("duplicate def key: %+v", key))
 		} else {
-			defKeys[key] = struct{}{}
+			defKeys[key] = def
+		}
+		for _, m := range def.Monikers {
+			if _, _, err := graph.ParseMoniker(m); err != nil {
+				errs = append(errs, fmt.Errorf("def %+v: %s", key, err))
+			}
+		}
+	}
+	for _, def := range defs {
+		if err := checkDefParent(def, defKeys); err != nil {
+			errs = append(errs, fmt.Errorf("def %+v: %s", def.DefKey, err))
+		}
+		if err := checkDefAlias(def, defKeys); err != nil {
+			errs = append(errs, fmt.Errorf("def %+v: %s", def.DefKey, err))
 		}
 	}
 	return
 }
 
+// checkDefParent returns an error if def's ParentPath (if any) isn't
+// the path of another def in defs (in the same source unit), or if it
+// is in a ParentPath cycle.
+func checkDefParent(def *graph.Def, defs map[graph.DefKey]*graph.Def) error {
+	if def.ParentPath == "" {
+		return nil
+	}
+	if def.ParentPath == def.Path {
+		return fmt.Errorf("ParentPath %q is the def's own path", def.ParentPath)
+	}
+	key := def.DefKey
+	for p, n := def, 0; p.ParentPath != ""; n++ {
+		key.Path = p.ParentPath
+		parent, ok := defs[key]
+		if !ok {
+			if p == def {
+				return fmt.Errorf("ParentPath %q is not the path of a def in the output", def.ParentPath)
+			}
+			break
+		}
+		if parent == def || n > len(defs) {
+			return fmt.Errorf("ParentPath %q is in a cycle of ParentPaths", def.ParentPath)
+		}
+		p = parent
+	}
+	return nil
+}
+
+// checkDefAlias returns an error if def's Alias* fields (if any) are
+// incomplete, or if def is an alias of a def in the same source unit
+// that isn't in defs or that is in a cycle of aliases. (Aliases of
+// defs in other source units can't be checked.)
+func checkDefAlias(def *graph.Def, defs map[graph.DefKey]*graph.Def) error {
+	if def.AliasPath == "" {
+		if def.AliasRepo != "" || def.AliasUnitType != "" || def.AliasUnit != "" {
+			return fmt.Errorf("AliasRepo, AliasUnitType, and AliasUnit require AliasPath")
+		}
+		return nil
+	}
+	if (def.AliasUnitType == "") != (def.AliasUnit == "") {
+		return fmt.Errorf("must set both or neither of AliasUnitType and AliasUnit")
+	}
+	sameUnit := func(d *graph.Def) bool { return d.AliasRepo == "" && d.AliasUnitType == "" && d.AliasUnit == "" }
+	if !sameUnit(def) {
+		return nil
+	}
+	if def.AliasPath == def.Path {
+		return fmt.Errorf("AliasPath %q is the def's own path", def.AliasPath)
+	}
+	key := def.DefKey
+	for a, n := def, 0; a.AliasPath != "" && sameUnit(a); n++ {
+		key.Path = a.AliasPath
+		orig, ok := defs[key]
+		if !ok {
+			if a == def {
+				return fmt.Errorf("AliasPath %q is not the path of a def in the output", def.AliasPath)
+			}
+			break
+		}
+		if orig == def || n > len(defs) {
+			return fmt.Errorf("AliasPath %q is in a cycle of aliases", def.AliasPath)
+		}
+		a = orig
+	}
+	return nil
+}
+
 func ValidateDocs(docs []*graph.Doc) (errs MultiError) {
 	docKeys := make(map[graph.DocKey]struct{})
 	for _, doc := range docs {
@@ -49,6 +132,63 @@ func ValidateDocs(docs []*graph.Doc) (errs MultiError) {
 	return
 }
 
+// validateNotNull returns an error if any of the defs, refs, docs,
+// anns, or warnings in o are null (which the JSON decoder permits but the rest of
+// srclib assumes never occurs).
+func validateNotNull(o *graph.Output) error {
+	var errs MultiError
+	for i, def := range o.Defs {
+		if def == nil {
+			errs = append(errs, fmt.Errorf("Defs[%d] is null", i))
+		}
+	}
+	for i, ref := range o.Refs {
+		if ref == nil {
+			errs = append(errs, fmt.Errorf("Refs[%d] is null", i))
+		}
+	}
+	for i, doc := range o.Docs {
+		if doc == nil {
+			errs = append(errs, fmt.Errorf("Docs[%d] is null", i))
+		}
+	}
+	for i, ann := range o.Anns {
+		if ann == nil {
+			errs = append(errs, fmt.Errorf("Anns[%d] is null", i))
+		}
+	}
+	for i, w := range o.Warnings {
+		if w == nil {
+			errs = append(errs, fmt.Errorf("Warnings[%d] is null", i))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// normalizeWarnings fills in the default Phase and Severity of the
+// warnings that the grapher emitted in o, and returns an error if any
+// have an invalid Severity.
+func normalizeWarnings(o *graph.Output) error {
+	var errs MultiError
+	for i, w := range o.Warnings {
+		if w.Phase == "" {
+			w.Phase = graph.WarningPhaseGraph
+		}
+		if !graph.ValidSeverity(w.Severity) {
+			errs = append(errs, fmt.Errorf("Warnings[%d] has invalid severity %q (must be %q, %q, or %q)", i, w.Severity, graph.SeverityInfo, graph.SeverityWarning, graph.SeverityError))
+		} else if w.Severity == "" {
+			w.Severity = graph.SeverityWarning
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
 type MultiError []error
 
 func (e MultiError) Error() string {
@@ -140,4 +280,12 @@ func PopulateImpliedFields(repo, commitID, unitType, unit string, o *graph.Outpu
 		ann.Repo = repo
 		ann.CommitID = commitID
 	}
+	for _, w := range o.Warnings {
+		w.UnitType = unitType
+		w.Unit = unit
+	}
+	for _, s := range o.Files {
+		s.UnitType = unitType
+		s.Unit = unit
+	}
 }
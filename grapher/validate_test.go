@@ -46,3 +46,24 @@ func TestValidateDocs_dup(t *testing.T) {
 		t.Fatalf("got nil err, want validation error")
 	}
 }
+
+func TestNormalizeWarnings(t *testing.T) {
+	o := &graph.Output{Warnings: []*graph.Warning{
+		{Message: "m"},
+		{Message: "m", Phase: "offsets", Severity: graph.SeverityInfo},
+	}}
+	if err := normalizeWarnings(o); err != nil {
+		t.Fatal(err)
+	}
+	if w := o.Warnings[0]; w.Phase != graph.WarningPhaseGraph || w.Severity != graph.SeverityWarning {
+		t.Errorf("got phase %q and severity %q, want defaults", w.Phase, w.Severity)
+	}
+	if w := o.Warnings[1]; w.Phase != "offsets" || w.Severity != graph.SeverityInfo {
+		t.Errorf("got phase %q and severity %q, want them unchanged", w.Phase, w.Severity)
+	}
+
+	o = &graph.Output{Warnings: []*graph.Warning{{Message: "m", Severity: "fatal"}}}
+	if err := normalizeWarnings(o); err == nil {
+		t.Error("got no error for invalid severity")
+	}
+}
@@ -0,0 +1,323 @@
+package grapher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// A VanityResolver resolves repository URIs on vanity (custom)
+// domains, such as "gopkg.in/yaml.v2" or "go.uber.org/zap", to the
+// URIs of the repositories that they're hosted in (such as
+// "github.com/go-yaml/yaml"), so that refs to defs in them are
+// attributed to the canonical repositories in multi-repo stores.
+//
+// It fetches https://URI?go-get=1 and uses, in order of preference:
+//
+//   - the repository root in the page's go-import meta tag, unless it
+//     is on the vanity domain itself (as for gopkg.in, which proxies
+//     the repositories that it serves);
+//   - the home (or directory) URL in the page's go-source meta tag,
+//     with the "/tree/..." or "/src/..." part (which refers to a
+//     branch or directory) removed;
+//   - the URL that the request was redirected to.
+//
+// URIs on well-known hosting sites (see VanityResolver.CanonicalHosts)
+// and URIs that can't be resolved are returned unchanged. Results are
+// cached in memory and, if CacheDir is set, on disk (so that they're
+// shared among the processes that normalize each source unit's
+// output). In offline mode (see srclib.Offline), only cached results
+// are used, even if they have expired.
+type VanityResolver struct {
+	// Client makes the HTTP requests. If nil, a client with a 10s
+	// timeout is used.
+	Client *http.Client
+
+	// CacheDir, if set, is the directory where resolved URIs are
+	// cached, with one file per URI. Cached results expire after
+	// CacheTTL.
+	CacheDir string
+	CacheTTL time.Duration
+
+	// CanonicalHosts are the hosts whose URIs are never resolved
+	// (because they aren't vanity domains). If nil,
+	// DefaultCanonicalHosts is used.
+	CanonicalHosts []string
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// DefaultCanonicalHosts are the hosts whose URIs VanityResolver
+// doesn't resolve by default.
+var DefaultCanonicalHosts = []string{"github.com", "bitbucket.org", "gitlab.com", "code.google.com", "launchpad.net"}
+
+// DefaultVanityCacheTTL is the duration for which a VanityResolver
+// with a CacheDir and a zero CacheTTL caches resolved URIs.
+const DefaultVanityCacheTTL = 24 * time.Hour
+
+// maxVanityPageSize is the number of bytes of a vanity domain's page
+// that VanityResolver reads looking for meta tags (which must be in
+// the page's head).
+const maxVanityPageSize = 1 << 20
+
+// Resolve returns the URI of the repository that hosts the (possibly
+// vanity) repository URI uri. If uri can't be resolved, it returns
+// uri and the error.
+func (r *VanityResolver) Resolve(ctx context.Context, uri string) (string, error) {
+	if r.isCanonicalHost(uri) {
+		return uri, nil
+	}
+
+	r.mu.Lock()
+	resolved, cached := r.cache[uri]
+	r.mu.Unlock()
+	if cached {
+		return resolved, nil
+	}
+	if resolved, ok := r.readCache(uri); ok {
+		r.remember(uri, resolved)
+		return resolved, nil
+	}
+
+	resolved, err := r.resolve(ctx, uri)
+	if err != nil {
+		// Don't cache errors, which may be temporary.
+		return uri, err
+	}
+	r.remember(uri, resolved)
+	r.writeCache(uri, resolved)
+	return resolved, nil
+}
+
+func (r *VanityResolver) isCanonicalHost(uri string) bool {
+	hosts := r.CanonicalHosts
+	if hosts == nil {
+		hosts = DefaultCanonicalHosts
+	}
+	host := strings.SplitN(uri, "/", 2)[0]
+	for _, h := range hosts {
+		if strings.EqualFold(host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *VanityResolver) remember(uri, resolved string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cache == nil {
+		r.cache = make(map[string]string)
+	}
+	r.cache[uri] = resolved
+}
+
+func (r *VanityResolver) resolve(ctx context.Context, uri string) (string, error) {
+	if err := srclib.CheckOnline("resolving vanity URI " + uri); err != nil {
+		return "", err
+	}
+	client := r.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequest("GET", "https://"+uri+"?go-get=1", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("resolving vanity URI %s: HTTP status %s", uri, resp.Status)
+	}
+
+	imports, sources, err := parseGoMetaTags(io.LimitReader(resp.Body, maxVanityPageSize))
+	if err != nil {
+		return "", fmt.Errorf("resolving vanity URI %s: %s", uri, err)
+	}
+	host := strings.SplitN(uri, "/", 2)[0]
+	if m := matchGoMetaTag(imports, uri); m != nil {
+		root, err := graph.TryMakeURI(m[2])
+		if err != nil {
+			return "", fmt.Errorf("resolving vanity URI %s: go-import repo root: %s", uri, err)
+		}
+		if !strings.EqualFold(strings.SplitN(root, "/", 2)[0], host) {
+			return root, nil
+		}
+	}
+	if m := matchGoMetaTag(sources, uri); m != nil {
+		if home, err := sourceHomeURI(m); err == nil && !strings.EqualFold(strings.SplitN(home, "/", 2)[0], host) {
+			return home, nil
+		}
+	}
+	if u := resp.Request.URL; !strings.EqualFold(u.Host, host) {
+		u.RawQuery = ""
+		return graph.TryMakeURI(u.String())
+	}
+	return uri, nil
+}
+
+// parseGoMetaTags returns the fields of the go-import and go-source
+// meta tags in the HTML page read from r. It stops at the end of the
+// page's head.
+func parseGoMetaTags(r io.Reader) (imports, sources [][]string, err error) {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "ascii") {
+			return input, nil
+		}
+		return nil, fmt.Errorf("can't decode XML document using charset %q", charset)
+	}
+	d.Strict = false
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			if err == io.EOF || len(imports) > 0 || len(sources) > 0 {
+				err = nil
+			}
+			return imports, sources, err
+		}
+		if e, ok := t.(xml.StartElement); ok && strings.EqualFold(e.Name.Local, "body") {
+			return imports, sources, nil
+		}
+		if e, ok := t.(xml.EndElement); ok && strings.EqualFold(e.Name.Local, "head") {
+			return imports, sources, nil
+		}
+		e, ok := t.(xml.StartElement)
+		if !ok || !strings.EqualFold(e.Name.Local, "meta") {
+			continue
+		}
+		var name, content string
+		for _, a := range e.Attr {
+			switch strings.ToLower(a.Name.Local) {
+			case "name":
+				name = a.Value
+			case "content":
+				content = a.Value
+			}
+		}
+		switch f := strings.Fields(content); {
+		case name == "go-import" && len(f) == 3:
+			imports = append(imports, f)
+		case name == "go-source" && len(f) >= 2:
+			sources = append(sources, f)
+		}
+	}
+}
+
+// matchGoMetaTag returns the fields of the meta tag (in tags) whose
+// import prefix (the first field) is the longest prefix of uri, or nil
+// if there is none.
+func matchGoMetaTag(tags [][]string, uri string) []string {
+	var match []string
+	for _, f := range tags {
+		prefix := f[0]
+		if uri != prefix && !strings.HasPrefix(uri, prefix+"/") {
+			continue
+		}
+		if match == nil || len(prefix) > len(match[0]) {
+			match = f
+		}
+	}
+	return match
+}
+
+// sourceHomeURI returns the repository URI for the fields of a
+// go-source meta tag. It uses the home URL (such as
+// "https://github.com/go-yaml/yaml/tree/v2"), or if that is "_", the
+// directory URL template (such as
+// "https://github.com/go-yaml/yaml/tree/v2{/dir}").
+func sourceHomeURI(fields []string) (string, error) {
+	home := fields[1]
+	if home == "_" {
+		if len(fields) < 3 {
+			return "", errors.New("go-source meta tag has no home or directory URL")
+		}
+		home = strings.Replace(fields[2], "{/dir}", "", -1)
+	}
+	u, err := url.Parse(home)
+	if err != nil {
+		return "", err
+	}
+	for _, sep := range []string{"/tree/", "/src/", "/blob/"} {
+		if i := strings.Index(u.Path, sep); i != -1 {
+			u.Path = u.Path[:i]
+		}
+	}
+	u.RawQuery, u.Fragment = "", ""
+	return graph.TryMakeURI(u.String())
+}
+
+func (r *VanityResolver) cacheFile(uri string) string {
+	sum := sha256.Sum256([]byte(uri))
+	return filepath.Join(r.CacheDir, hex.EncodeToString(sum[:]))
+}
+
+func (r *VanityResolver) readCache(uri string) (string, bool) {
+	if r.CacheDir == "" {
+		return "", false
+	}
+	ttl := r.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultVanityCacheTTL
+	}
+	file := r.cacheFile(uri)
+	fi, err := os.Stat(file)
+	if err != nil || (time.Since(fi.ModTime()) > ttl && !srclib.Offline) {
+		return "", false
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", false
+	}
+	// The file contains the URI and the resolved URI (to detect hash
+	// collisions and partially written files).
+	lines := strings.Split(string(data), "\n")
+	if len(lines) != 3 || lines[0] != uri || lines[2] != "" {
+		return "", false
+	}
+	return lines[1], true
+}
+
+// writeCache caches the resolved URI on disk. The cache is an
+// optimization, so errors are ignored.
+func (r *VanityResolver) writeCache(uri, resolved string) {
+	if r.CacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(r.CacheDir, 0700); err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(r.CacheDir, "tmp-")
+	if err != nil {
+		return
+	}
+	_, writeErr := f.WriteString(uri + "\n" + resolved + "\n")
+	if err := f.Close(); writeErr != nil || err != nil {
+		os.Remove(f.Name())
+		return
+	}
+	// Rename the file into place so that concurrent readers never see
+	// a partially written file.
+	if err := os.Rename(f.Name(), r.cacheFile(uri)); err != nil {
+		os.Remove(f.Name())
+	}
+}
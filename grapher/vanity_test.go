@@ -0,0 +1,94 @@
+package grapher
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVanityResolver(t *testing.T) {
+	// The canonical host, to which the vanity host redirects.
+	canonical := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><head></head><body></body></html>")
+	}))
+	defer canonical.Close()
+	canonicalHost := strings.TrimPrefix(canonical.URL, "https://")
+
+	var requests int
+	vanity := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("go-get") != "1" {
+			http.Error(w, "no go-get=1", http.StatusBadRequest)
+			return
+		}
+		host := r.Host
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/import"):
+			fmt.Fprintf(w, `<html><head>
+<meta name="go-import" content="%s/import git https://github.com/user/repo.git">
+<meta name="go-import" content="%s/import/sub git https://github.com/user/sub">
+</head><body><meta name="go-import" content="%s/import git https://github.com/other/repo"></body></html>`, host, host, host)
+		case strings.HasPrefix(r.URL.Path, "/proxy.v2"):
+			fmt.Fprintf(w, `<html><head>
+<meta name="go-import" content="%s/proxy.v2 git https://%s/proxy.v2">
+<meta name="go-source" content="%s/proxy.v2 _ https://github.com/user/proxy/tree/v2{/dir} https://github.com/user/proxy/blob/v2{/dir}/{file}#L{line}">
+</head></html>`, host, host, host)
+		case r.URL.Path == "/redirect":
+			http.Redirect(w, r, canonical.URL+"/user/redirected?go-get=1", http.StatusFound)
+		case r.URL.Path == "/none":
+			fmt.Fprint(w, "<html><head><title>x</title></head></html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer vanity.Close()
+	vanityHost := strings.TrimPrefix(vanity.URL, "https://")
+
+	cacheDir, err := ioutil.TempDir("", "srclib-vanity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(cacheDir)
+	r := &VanityResolver{Client: vanity.Client(), CacheDir: cacheDir}
+
+	tests := map[string]string{
+		vanityHost + "/import":         "github.com/user/repo",
+		vanityHost + "/import/pkg":     "github.com/user/repo",
+		vanityHost + "/import/sub/pkg": "github.com/user/sub",
+		vanityHost + "/proxy.v2":       "github.com/user/proxy",
+		vanityHost + "/redirect":       canonicalHost + "/user/redirected",
+		vanityHost + "/none":           vanityHost + "/none",
+		"github.com/a/b":               "github.com/a/b",
+	}
+	for uri, want := range tests {
+		got, err := r.Resolve(context.Background(), uri)
+		if err != nil {
+			t.Errorf("%s: %s", uri, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: got %s, want %s", uri, got, want)
+		}
+	}
+
+	if got, err := r.Resolve(context.Background(), vanityHost+"/notfound"); err == nil || got != vanityHost+"/notfound" {
+		t.Errorf("notfound: got %q, %v, want the URI and an error", got, err)
+	}
+
+	// Results are cached in memory and on disk.
+	before := requests
+	r2 := &VanityResolver{Client: vanity.Client(), CacheDir: cacheDir}
+	for _, res := range []*VanityResolver{r, r2} {
+		if got, _ := res.Resolve(context.Background(), vanityHost+"/import"); got != "github.com/user/repo" {
+			t.Errorf("cached: got %s, want github.com/user/repo", got)
+		}
+	}
+	if requests != before {
+		t.Errorf("got %d requests for cached URIs, want 0", requests-before)
+	}
+}
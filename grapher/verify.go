@@ -0,0 +1,497 @@
+package grapher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/ann"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// An OutputIssue is a problem with a grapher's output file that
+// VerifyOutput found.
+type OutputIssue struct {
+	// Line and Column are the (1-based) location in the output file
+	// of the problem, or of the start of the def, ref, doc, or ann
+	// that has the problem.
+	Line, Column int
+
+	// Path is the location of the problem in the output (e.g.,
+	// "Refs[3].End"), or empty if the problem isn't in any one def,
+	// ref, doc, or ann.
+	Path string `json:",omitempty"`
+
+	Message string
+}
+
+func (i *OutputIssue) String() string {
+	if i.Path == "" {
+		return fmt.Sprintf("%d:%d: %s", i.Line, i.Column, i.Message)
+	}
+	return fmt.Sprintf("%d:%d: %s: %s", i.Line, i.Column, i.Path, i.Message)
+}
+
+// VerifyOptions configures VerifyOutput.
+type VerifyOptions struct {
+	// Dir is the dir that the file paths in the output are relative
+	// to (the repository root). If empty, offsets aren't checked
+	// against the files' sizes.
+	Dir string
+
+	// CharOffsets indicates that the output's offsets are character
+	// offsets, not byte offsets (see EmitsByteOffsets).
+	CharOffsets bool
+}
+
+// VerifyOutput checks a grapher's output file (data, which is JSON)
+// for all of the problems that would cause srclib to reject the
+// output or import incorrect data:
+//
+//   - JSON syntax and type errors, and unknown fields;
+//   - defs with empty or duplicate paths, and invalid monikers;
+//   - offsets that are reversed or beyond the end of their file;
+//   - defs, refs, docs, and anns that aren't sorted (as
+//     sort.Sort(graph.Defs(...)), etc., sort them);
+//   - refs and docs for defs in the same source unit that don't exist.
+//
+// The issues are sorted by location. The returned error is only for
+// failures to read the files referred to by the output.
+func VerifyOutput(data []byte, opt VerifyOptions) ([]*OutputIssue, error) {
+	v := &outputVerifier{data: data, opt: opt, files: map[string]int{}}
+	if !v.decode() {
+		return v.issues, nil
+	}
+	if err := v.check(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(v.issues, func(i, j int) bool {
+		a, b := v.issues[i], v.issues[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return v.issues, nil
+}
+
+type outputVerifier struct {
+	data []byte
+	opt  VerifyOptions
+
+	out graph.Output
+
+	// The offsets in data of the start of each def, ref, doc, and ann.
+	defOffsets, refOffsets, docOffsets, annOffsets, warningOffsets []int
+
+	files map[string]int // file -> length (see fileLength)
+
+	issues []*OutputIssue
+}
+
+func (v *outputVerifier) addIssue(offset int, path, format string, args ...interface{}) {
+	line, col := offsetToLineColumn(v.data, offset)
+	v.issues = append(v.issues, &OutputIssue{Line: line, Column: col, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// offsetToLineColumn returns the 1-based line and column (in bytes) of
+// the byte offset in data.
+func offsetToLineColumn(data []byte, offset int) (line, col int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line = 1 + bytes.Count(data[:offset], []byte("\n"))
+	col = offset - bytes.LastIndexByte(data[:offset], '\n')
+	return line, col
+}
+
+// decode decodes the output, recording the location of each element.
+// It returns false if the output's structure is too broken to check
+// further.
+func (v *outputVerifier) decode() bool {
+	dec := json.NewDecoder(bytes.NewReader(v.data))
+	syntaxError := func(err error) bool {
+		offset := int(dec.InputOffset())
+		if e, ok := err.(*json.SyntaxError); ok {
+			offset = int(e.Offset)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			v.addIssue(len(v.data), "", "unexpected end of JSON input")
+		} else {
+			v.addIssue(offset, "", "%s", err)
+		}
+		return false
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return syntaxError(err)
+	}
+	if tok != json.Delim('{') {
+		v.addIssue(0, "", "output must be a JSON object (with Defs, Refs, Docs, Anns, and Warnings fields)")
+		return false
+	}
+	seen := map[string]bool{}
+	for dec.More() {
+		keyOffset := v.skipSpace(int(dec.InputOffset()))
+		tok, err := dec.Token()
+		if err != nil {
+			return syntaxError(err)
+		}
+		key := tok.(string)
+		if seen[key] {
+			v.addIssue(keyOffset, key, "duplicate field")
+		}
+		seen[key] = true
+
+		var decodeElem func(offset int, raw json.RawMessage, path string)
+		switch key {
+		case "Defs":
+			decodeElem = func(offset int, raw json.RawMessage, path string) {
+				var def graph.Def
+				if v.decodeStrict(offset, raw, path, &def) {
+					v.out.Defs = append(v.out.Defs, &def)
+					v.defOffsets = append(v.defOffsets, offset)
+				}
+			}
+		case "Refs":
+			decodeElem = func(offset int, raw json.RawMessage, path string) {
+				var ref graph.Ref
+				if v.decodeStrict(offset, raw, path, &ref) {
+					v.out.Refs = append(v.out.Refs, &ref)
+					v.refOffsets = append(v.refOffsets, offset)
+				}
+			}
+		case "Docs":
+			decodeElem = func(offset int, raw json.RawMessage, path string) {
+				var doc graph.Doc
+				if v.decodeStrict(offset, raw, path, &doc) {
+					v.out.Docs = append(v.out.Docs, &doc)
+					v.docOffsets = append(v.docOffsets, offset)
+				}
+			}
+		case "Anns":
+			decodeElem = func(offset int, raw json.RawMessage, path string) {
+				var a ann.Ann
+				if v.decodeStrict(offset, raw, path, &a) {
+					v.out.Anns = append(v.out.Anns, &a)
+					v.annOffsets = append(v.annOffsets, offset)
+				}
+			}
+		case "Warnings":
+			decodeElem = func(offset int, raw json.RawMessage, path string) {
+				var w graph.Warning
+				if v.decodeStrict(offset, raw, path, &w) {
+					v.out.Warnings = append(v.out.Warnings, &w)
+					v.warningOffsets = append(v.warningOffsets, offset)
+				}
+			}
+		default:
+			v.addIssue(keyOffset, key, "unknown field (must be Defs, Refs, Docs, Anns, or Warnings)")
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return syntaxError(err)
+			}
+			continue
+		}
+
+		valueOffset := v.skipSpace(int(dec.InputOffset()))
+		tok, err = dec.Token()
+		if err != nil {
+			return syntaxError(err)
+		}
+		if tok == nil {
+			continue // null
+		}
+		if tok != json.Delim('[') {
+			v.addIssue(valueOffset, key, "must be an array")
+			return false
+		}
+		for i := 0; dec.More(); i++ {
+			offset := v.skipSpace(int(dec.InputOffset()))
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return syntaxError(err)
+			}
+			path := fmt.Sprintf("%s[%d]", key, i)
+			if string(raw) == "null" {
+				v.addIssue(offset, path, "must not be null")
+				continue
+			}
+			decodeElem(offset, raw, path)
+		}
+		if _, err := dec.Token(); err != nil { // ']'
+			return syntaxError(err)
+		}
+	}
+	if _, err := dec.Token(); err != nil { // '}'
+		return syntaxError(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		v.addIssue(v.skipSpace(int(dec.InputOffset())), "", "unexpected data after the output object")
+	}
+	return true
+}
+
+// skipSpace returns the offset of the first byte at or after offset
+// in v.data that isn't whitespace or a separator (which the JSON
+// decoder's InputOffset may precede).
+func (v *outputVerifier) skipSpace(offset int) int {
+	for ; offset < len(v.data); offset++ {
+		switch v.data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// decodeStrict decodes raw (which is at offset in v.data) into x,
+// reporting type errors and unknown fields. It returns whether x was
+// decoded.
+func (v *outputVerifier) decodeStrict(offset int, raw json.RawMessage, path string, x interface{}) bool {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(x); err != nil {
+		if e, ok := err.(*json.UnmarshalTypeError); ok {
+			fieldPath := path
+			if e.Field != "" {
+				fieldPath += "." + e.Field
+			}
+			v.addIssue(offset+valueStart(raw, int(e.Offset)), fieldPath, "cannot use JSON %s as %s", e.Value, e.Type)
+		} else {
+			v.addIssue(offset, path, "%s", err)
+		}
+		return false
+	}
+	return true
+}
+
+// valueStart returns the offset in data of the start of the JSON
+// string, number, or literal that ends at end (which is where the JSON
+// decoder reports type errors).
+func valueStart(data []byte, end int) int {
+	if end > len(data) {
+		end = len(data)
+	}
+	if end >= 2 && data[end-1] == '"' {
+		for i := end - 2; i >= 0; i-- {
+			if data[i] != '"' {
+				continue
+			}
+			var backslashes int
+			for j := i - 1; j >= 0 && data[j] == '\\'; j-- {
+				backslashes++
+			}
+			if backslashes%2 == 0 {
+				return i
+			}
+		}
+	}
+	i := end
+	for i > 0 && bytes.IndexByte([]byte(" \t\r\n:,[{"), data[i-1]) == -1 {
+		i--
+	}
+	return i
+}
+
+func (v *outputVerifier) check() error {
+	defPaths := map[graph.DefKey]int{} // -> index in Defs
+	for i, def := range v.out.Defs {
+		path := fmt.Sprintf("Defs[%d]", i)
+		offset := v.defOffsets[i]
+		if def.Path == "" {
+			v.addIssue(offset, path+".Path", "must not be empty")
+		} else if j, dup := defPaths[def.DefKey]; dup {
+			line, _ := offsetToLineColumn(v.data, v.defOffsets[j])
+			v.addIssue(offset, path+".Path", "duplicate def path %q (also used by Defs[%d] at line %d)", def.Path, j, line)
+		} else {
+			defPaths[def.DefKey] = i
+		}
+		for _, m := range def.Monikers {
+			if _, _, err := graph.ParseMoniker(m); err != nil {
+				v.addIssue(offset, path+".Monikers", "%s", err)
+			}
+		}
+		if def.DefStart != 0 || def.DefEnd != 0 {
+			if err := v.checkSpan(offset, path, "DefStart", "DefEnd", def.File, def.DefStart, def.DefEnd); err != nil {
+				return err
+			}
+		}
+	}
+	defs := make(map[graph.DefKey]*graph.Def, len(defPaths))
+	for key, i := range defPaths {
+		defs[key] = v.out.Defs[i]
+	}
+	for i, def := range v.out.Defs {
+		if err := checkDefParent(def, defs); err != nil {
+			v.addIssue(v.defOffsets[i], fmt.Sprintf("Defs[%d].ParentPath", i), "%s", err)
+		}
+		if err := checkDefAlias(def, defs); err != nil {
+			v.addIssue(v.defOffsets[i], fmt.Sprintf("Defs[%d].AliasPath", i), "%s", err)
+		}
+	}
+
+	// defExists reports whether a ref or doc for the def with the
+	// given key (which is relative to the source unit) refers to a def
+	// in this output. Refs and docs for defs in other units or repos
+	// can't be checked.
+	defExists := func(key graph.DefKey) (checked, exists bool) {
+		if key.Repo != "" || key.UnitType != "" || key.Unit != "" {
+			return false, false
+		}
+		_, exists = defPaths[graph.DefKey{Path: key.Path}]
+		return true, exists
+	}
+
+	for i, ref := range v.out.Refs {
+		path := fmt.Sprintf("Refs[%d]", i)
+		offset := v.refOffsets[i]
+		if ref.DefPath == "" {
+			v.addIssue(offset, path+".DefPath", "must not be empty")
+		} else if checked, exists := defExists(ref.DefKey()); checked && !exists {
+			v.addIssue(offset, path+".DefPath", "refers to nonexistent def %q in the same source unit", ref.DefPath)
+		}
+		if ref.File == "" {
+			v.addIssue(offset, path+".File", "must not be empty")
+		}
+		if !graph.ValidConfidence(ref.Confidence) {
+			v.addIssue(offset, path+".Confidence", "Confidence %v is not between 0 and 1", ref.Confidence)
+		}
+		if err := v.checkSpan(offset, path, "Start", "End", ref.File, ref.Start, ref.End); err != nil {
+			return err
+		}
+	}
+
+	for i, doc := range v.out.Docs {
+		path := fmt.Sprintf("Docs[%d]", i)
+		offset := v.docOffsets[i]
+		if doc.Path != "" {
+			if checked, exists := defExists(doc.DefKey); checked && !exists {
+				v.addIssue(offset, path+".Path", "documents nonexistent def %q in the same source unit", doc.Path)
+			}
+		}
+		if doc.File != "" || doc.Start != 0 || doc.End != 0 {
+			if err := v.checkSpan(offset, path, "Start", "End", doc.File, doc.Start, doc.End); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, a := range v.out.Anns {
+		path := fmt.Sprintf("Anns[%d]", i)
+		if err := v.checkSpan(v.annOffsets[i], path, "Start", "End", a.File, a.Start, a.End); err != nil {
+			return err
+		}
+	}
+
+	for i, w := range v.out.Warnings {
+		path := fmt.Sprintf("Warnings[%d]", i)
+		offset := v.warningOffsets[i]
+		if w.Message == "" {
+			v.addIssue(offset, path+".Message", "must not be empty")
+		}
+		if !graph.ValidSeverity(w.Severity) {
+			v.addIssue(offset, path+".Severity", "invalid severity %q (must be %q, %q, or %q)", w.Severity, graph.SeverityInfo, graph.SeverityWarning, graph.SeverityError)
+		}
+	}
+
+	v.checkSorted("Defs", v.defOffsets, graph.Defs(v.out.Defs))
+	v.checkSorted("Refs", v.refOffsets, graph.Refs(v.out.Refs))
+	v.checkSorted("Docs", v.docOffsets, graph.Docs(v.out.Docs))
+	v.checkSorted("Anns", v.annOffsets, ann.Anns(v.out.Anns))
+	return nil
+}
+
+// checkSpan checks that the span start-end is in the file.
+func (v *outputVerifier) checkSpan(offset int, path, startField, endField, file string, start, end uint32) error {
+	if start > end {
+		v.addIssue(offset, path+"."+endField, "%s %d is before %s %d", endField, end, startField, start)
+		return nil
+	}
+	if v.opt.Dir == "" || file == "" {
+		return nil
+	}
+	if isOutsideTree(file) {
+		v.addIssue(offset, path+".File", "file %q is outside the repository (paths must be relative to the repository root)", file)
+		return nil
+	}
+	n, err := v.fileLength(file)
+	if err != nil {
+		return err
+	}
+	if n == fileNotExist {
+		v.addIssue(offset, path+".File", "file %q does not exist (paths must be relative to the repository root)", file)
+	} else if n == fileNotRegular {
+		v.addIssue(offset, path+".File", "file %q is not a regular file", file)
+	} else if int(end) > n {
+		unit := "bytes"
+		if v.opt.CharOffsets {
+			unit = "characters"
+		}
+		v.addIssue(offset, path+"."+endField, "%s %d is beyond the end of file %q (%d %s)", endField, end, file, n, unit)
+	}
+	return nil
+}
+
+// Lengths returned by fileLength for files that can't be read.
+const (
+	fileNotExist   = -1
+	fileNotRegular = -2 // e.g., a directory or device
+)
+
+// fileLength returns the length of the file (in bytes, or characters
+// in its detected encoding if CharOffsets is set; see
+// detectEncoding), or fileNotExist or fileNotRegular.
+func (v *outputVerifier) fileLength(file string) (int, error) {
+	if n, present := v.files[file]; present {
+		return n, nil
+	}
+	name := filepath.Join(v.opt.Dir, filepath.FromSlash(file))
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		v.files[file] = fileNotExist
+		return fileNotExist, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if !fi.Mode().IsRegular() {
+		v.files[file] = fileNotRegular
+		return fileNotRegular, nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+	n := len(data)
+	if v.opt.CharOffsets {
+		enc, _ := detectEncoding(file, data)
+		n = newRuneIndex(data, enc).runes
+	}
+	v.files[file] = n
+	return n, nil
+}
+
+// checkSorted reports the elements of xs that sort before the element
+// preceding them.
+func (v *outputVerifier) checkSorted(field string, offsets []int, xs sort.Interface) {
+	for i := 1; i < xs.Len(); i++ {
+		if xs.Less(i, i-1) {
+			v.addIssue(offsets[i], fmt.Sprintf("%s[%d]", field, i), "not sorted (must come before %s[%d])", field, i-1)
+		}
+	}
+}
+
+// EmitsByteOffsets reports whether the grapher for the given source
+// unit type emits byte offsets (instead of character offsets, which
+// NormalizeData converts to byte offsets).
+func EmitsByteOffsets(unitType string) bool {
+	return byteOffsetUnitTypes[unitType] || strings.HasPrefix(unitType, "Java")
+}
@@ -0,0 +1,120 @@
+package grapher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "f.go"), []byte("package f\n\nfunc A() {}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		output string
+		want   []string
+	}{
+		"ok": {
+			output: `{"Defs": [{"Path": "A", "Name": "A", "File": "f.go", "DefStart": 12, "DefEnd": 23}],
+ "Refs": [{"DefPath": "A", "File": "f.go", "Start": 17, "End": 18}]}`,
+		},
+		"syntax error": {
+			output: "{\"Defs\": [\n  {\"Path\": }]}",
+			want:   []string{"2:13: invalid character '}' looking for beginning of value"},
+		},
+		"unknown field": {
+			output: "{\"Defs\": [\n  {\"Path\": \"A\", \"Nmae\": \"A\"}]}",
+			want:   []string{`2:3: Defs[0]: json: unknown field "Nmae"`},
+		},
+		"warnings": {
+			output: `{"Warnings": [{"File": "f.go", "Message": "m", "Severity": "error"}, {"Message": "", "Severity": "bad"}]}`,
+			want: []string{
+				`1:70: Warnings[1].Message: must not be empty`,
+				`1:70: Warnings[1].Severity: invalid severity "bad" (must be "info", "warning", or "error")`,
+			},
+		},
+		"null element": {
+			output: `{"Defs": [null]}`,
+			want:   []string{"1:11: Defs[0]: must not be null"},
+		},
+		"type error": {
+			output: "{\"Refs\": [{\"DefPath\": \"A\", \"File\": \"f.go\", \"Start\": \"1\"}]}",
+			want:   []string{"1:53: Refs[0].Start: cannot use JSON string as uint32"},
+		},
+		"parent paths": {
+			output: `{"Defs": [
+  {"Path": "A"},
+  {"Path": "A/m", "ParentPath": "A"},
+  {"Path": "B", "ParentPath": "X"},
+  {"Path": "C", "ParentPath": "D"},
+  {"Path": "D", "ParentPath": "C"}
+]}`,
+			want: []string{
+				`4:3: Defs[2].ParentPath: ParentPath "X" is not the path of a def in the output`,
+				`5:3: Defs[3].ParentPath: ParentPath "D" is in a cycle of ParentPaths`,
+				`6:3: Defs[4].ParentPath: ParentPath "C" is in a cycle of ParentPaths`,
+			},
+		},
+		"aliases": {
+			output: `{"Defs": [
+  {"Path": "A"},
+  {"Path": "B", "AliasPath": "A"},
+  {"Path": "C", "AliasPath": "B"},
+  {"Path": "D", "AliasPath": "X"},
+  {"Path": "E", "AliasUnitType": "t", "AliasUnit": "u", "AliasPath": "X"},
+  {"Path": "F", "AliasUnit": "u", "AliasPath": "X"},
+  {"Path": "G", "AliasPath": "H"},
+  {"Path": "H", "AliasPath": "G"}
+]}`,
+			want: []string{
+				`5:3: Defs[3].AliasPath: AliasPath "X" is not the path of a def in the output`,
+				`7:3: Defs[5].AliasPath: must set both or neither of AliasUnitType and AliasUnit`,
+				`8:3: Defs[6].AliasPath: AliasPath "H" is in a cycle of aliases`,
+				`9:3: Defs[7].AliasPath: AliasPath "G" is in a cycle of aliases`,
+			},
+		},
+		"semantic errors": {
+			output: `{"Defs": [
+  {"Path": "B", "File": "f.go", "DefStart": 1, "DefEnd": 100},
+  {"Path": "A", "File": "g.go", "DefStart": 1, "DefEnd": 2},
+  {"Path": "A", "File": "f.go", "DefStart": 3, "DefEnd": 2}
+],
+"Refs": [
+  {"DefPath": "C", "File": "f.go", "Start": 1, "End": 2},
+  {"DefPath": "X", "DefUnit": "other", "File": "f.go", "Start": 1, "End": 2},
+  {"DefPath": "X", "DefUnit": "other", "File": "f.go", "Start": 3, "End": 4, "Confidence": 1.5}
+]}`,
+			want: []string{
+				`2:3: Defs[0].DefEnd: DefEnd 100 is beyond the end of file "f.go" (23 bytes)`,
+				`3:3: Defs[1].File: file "g.go" does not exist (paths must be relative to the repository root)`,
+				`3:3: Defs[1]: not sorted (must come before Defs[0])`,
+				`4:3: Defs[2].Path: duplicate def path "A" (also used by Defs[1] at line 3)`,
+				`4:3: Defs[2].DefEnd: DefEnd 2 is before DefStart 3`,
+				`7:3: Refs[0].DefPath: refers to nonexistent def "C" in the same source unit`,
+				`9:3: Refs[2].Confidence: Confidence 1.5 is not between 0 and 1`,
+			},
+		},
+	}
+	for label, test := range tests {
+		issues, err := VerifyOutput([]byte(test.output), VerifyOptions{Dir: dir})
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		var got []string
+		for _, issue := range issues {
+			got = append(got, issue.String())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got issues\n%q\nwant\n%q", label, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package importer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// importContentIndex builds a content index of the files in units
+// (read from opt.ContentDir) and stores it in stor. Files excluded by
+// redaction are not indexed.
+func importContentIndex(stor interface{}, opt Options, units []*unit.SourceUnit, redaction *grapher.Redaction) error {
+	dir := opt.ContentDir
+	if dir == "" {
+		dir = "."
+	}
+
+	filesByPath := map[string]*store.ContentFile{}
+	var files []*store.ContentFile
+	for _, u := range units {
+		for _, path := range u.Files {
+			if redaction != nil && redaction.Excluded(path) {
+				continue
+			}
+			f, present := filesByPath[path]
+			if !present {
+				data, err := ioutil.ReadFile(filepath.Join(dir, path))
+				if err != nil {
+					logutil.Default.Warn("Not indexing contents of file.", "file", path, "err", err)
+					continue
+				}
+				f = &store.ContentFile{Path: path, Data: data}
+				filesByPath[path] = f
+				files = append(files, f)
+			}
+			f.Units = append(f.Units, u.ID2())
+		}
+	}
+	x := store.NewContentIndex(files)
+	if opt.Verbose {
+		log.Printf("# Indexed contents of %d files (%d trigrams).", len(x.Files), len(x.Trigrams))
+	}
+
+	switch s := stor.(type) {
+	case store.RepoContentIndexer:
+		return s.ImportContentIndex(opt.CommitID, x)
+	case store.MultiRepoContentIndexer:
+		return s.ImportContentIndex(opt.Repo, opt.CommitID, x)
+	}
+	return fmt.Errorf("store (type %T) does not implement content indexing", stor)
+}
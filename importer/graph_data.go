@@ -0,0 +1,152 @@
+package importer
+
+import (
+	"io"
+	"os"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// importWarnings stores the warnings in the graph output of an import
+// (see Import) in stor. If only some source units were imported (with
+// --unit or --unit-type), the warnings of the commit's other source
+// units are kept. Stores that don't support warnings are skipped.
+func importWarnings(stor interface{}, opt Options, commitID string, units []*unit.SourceUnit, warnings []*graph.Warning) error {
+	if opt.Unit != "" || opt.UnitType != "" {
+		existing, err := existingWarnings(stor, opt.Repo, commitID)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		imported := make(map[unit.ID2]bool, len(units))
+		for _, u := range units {
+			imported[u.ID2()] = true
+		}
+		for _, w := range existing {
+			if !imported[unit.ID2{Type: w.UnitType, Name: w.Unit}] {
+				warnings = append(warnings, w)
+			}
+		}
+	}
+	sort.Sort(graph.Warnings(warnings))
+
+	switch s := stor.(type) {
+	case store.RepoWarner:
+		return s.ImportWarnings(commitID, warnings)
+	case store.MultiRepoWarner:
+		return s.ImportWarnings(opt.Repo, commitID, warnings)
+	}
+	return nil
+}
+
+// importQuarantinedRefs stores the refs in quarantined (see
+// Options.QuarantineDanglingRefs) in stor. If only some source units
+// were imported (with --unit or --unit-type), the quarantined refs of
+// the commit's other source units are kept. Stores that don't support
+// quarantined refs are skipped.
+func importQuarantinedRefs(stor interface{}, opt Options, commitID string, units []*unit.SourceUnit, quarantined *refSpool) error {
+	if opt.Unit != "" || opt.UnitType != "" {
+		existing, err := existingQuarantinedRefs(stor, opt.Repo, commitID)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		imported := make(map[unit.ID2]bool, len(units))
+		for _, u := range units {
+			imported[u.ID2()] = true
+		}
+		var kept []*graph.Ref
+		for _, ref := range existing {
+			if !imported[unit.ID2{Type: ref.UnitType, Name: ref.Unit}] {
+				kept = append(kept, ref)
+			}
+		}
+		if err := quarantined.add(kept); err != nil {
+			return err
+		}
+	}
+
+	// Stream the (possibly spilled) refs to the store.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(quarantined.writeTo(pw))
+	}()
+	defer pr.Close()
+	switch s := stor.(type) {
+	case store.RepoRefQuarantiner:
+		return s.ImportQuarantinedRefs(commitID, pr)
+	case store.MultiRepoRefQuarantiner:
+		return s.ImportQuarantinedRefs(opt.Repo, commitID, pr)
+	}
+	return nil
+}
+
+// importFileSummaries stores the file summaries in the graph output of
+// an import (see Import) in stor. If only some source units were
+// imported (with --unit or --unit-type), the summaries of the commit's
+// other source units are kept. Stores that don't support file
+// summaries are skipped.
+func importFileSummaries(stor interface{}, opt Options, commitID string, units []*unit.SourceUnit, summaries []*graph.FileSummary) error {
+	if opt.Unit != "" || opt.UnitType != "" {
+		existing, err := existingFileSummaries(stor, opt.Repo, commitID)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		imported := make(map[unit.ID2]bool, len(units))
+		for _, u := range units {
+			imported[u.ID2()] = true
+		}
+		for _, s := range existing {
+			if !imported[unit.ID2{Type: s.UnitType, Name: s.Unit}] {
+				summaries = append(summaries, s)
+			}
+		}
+	}
+	sort.Sort(graph.FileSummaries(summaries))
+
+	switch s := stor.(type) {
+	case store.RepoFileSummarizer:
+		return s.ImportFileSummaries(commitID, summaries)
+	case store.MultiRepoFileSummarizer:
+		return s.ImportFileSummaries(opt.Repo, commitID, summaries)
+	}
+	return nil
+}
+
+// existingWarnings returns the warnings of the commit (and, for
+// multi-repo stores, repo) that were already imported into stor.
+func existingWarnings(stor interface{}, repo, commitID string) ([]*graph.Warning, error) {
+	switch s := stor.(type) {
+	case store.RepoWarner:
+		return s.Warnings(commitID)
+	case store.MultiRepoWarner:
+		return s.Warnings(repo, commitID)
+	}
+	return nil, nil
+}
+
+// existingQuarantinedRefs returns the quarantined refs of the commit
+// (and, for multi-repo stores, repo) that were already imported into
+// stor.
+func existingQuarantinedRefs(stor interface{}, repo, commitID string) ([]*graph.Ref, error) {
+	switch s := stor.(type) {
+	case store.RepoRefQuarantiner:
+		return s.QuarantinedRefs(commitID)
+	case store.MultiRepoRefQuarantiner:
+		return s.QuarantinedRefs(repo, commitID)
+	}
+	return nil, nil
+}
+
+// existingFileSummaries returns the file summaries of the commit (and,
+// for multi-repo stores, repo) that were already imported into stor.
+func existingFileSummaries(stor interface{}, repo, commitID string) ([]*graph.FileSummary, error) {
+	switch s := stor.(type) {
+	case store.RepoFileSummarizer:
+		return s.FileSummaries(commitID)
+	case store.MultiRepoFileSummarizer:
+		return s.FileSummaries(repo, commitID)
+	}
+	return nil, nil
+}
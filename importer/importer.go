@@ -0,0 +1,558 @@
+// Package importer imports srclib build data (the output of "src
+// make") into a store. It implements "src store import", and is used
+// by other programs (such as the build package) to import build data
+// without running the src binary.
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"code.google.com/p/rog-go/parallel"
+	"golang.org/x/tools/godoc/vfs"
+
+	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/flagutil"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/metrics"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/tracing"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// Options configures an import. The fields with flag tags are the
+// flags of "src store import".
+type Options struct {
+	DryRun  bool `short:"n" long:"dry-run" description:"print what would be done but don't do anything"`
+	NoIndex bool `long:"no-index" description:"don't build indexes (indexes inside a single source unit are always built)"`
+
+	Repo     string `long:"repo" description:"only import for this repo"`
+	Unit     string `long:"unit" description:"only import source units with this name"`
+	UnitType string `long:"unit-type" description:"only import source units with this type"`
+	CommitID string `long:"commit" description:"commit ID of commit whose data to import"`
+
+	FoldCase bool `long:"fold-case" description:"lowercase all file paths in imported data (for build data produced on case-insensitive filesystems)"`
+
+	QuarantineDanglingRefs bool `long:"quarantine-dangling-refs" description:"don't import refs to nonexistent defs in the same repo; store them apart with the commit instead (see 'src store quarantined-refs')"`
+
+	Redact string `long:"redact" description:"remove data matching the redaction rules in FILE (JSON) before importing (and indexing) it" value-name:"FILE"`
+
+	IndexContent bool `long:"index-content" description:"also build a trigram index of the contents of source unit files (for src search --regex)"`
+
+	Jobs      int    `short:"j" long:"jobs" description:"number of source units to import in parallel (default: 10)" value-name:"N"`
+	MaxMemory string `long:"max-memory" description:"import fewer source units at once when their estimated memory use (about 4 times the size of their build data) would exceed SIZE, e.g., 512MB or 2GiB; a larger unit is imported alone, and isn't otherwise limited" value-name:"SIZE"`
+
+	// ContentDir is the dir that source unit files are read from
+	// when IndexContent is set (default: the current dir).
+	ContentDir string
+
+	// DefRepos maps the DefRepos of refs to the repositories that the
+	// refs are imported as referring to (e.g., the URI of a workspace
+	// repository's upstream repository to the workspace repository's
+	// URI; see config.Workspace).
+	DefRepos map[string]string
+
+	// Verbose logs the progress of the import.
+	Verbose bool
+
+	// Process describes the program that is importing the data, and
+	// is recorded in the imported commit's provenance manifest (see
+	// store.Provenance). If nil, only the Go version, OS, arch, and
+	// time are recorded.
+	Process *store.ProcessProvenance
+}
+
+func init() {
+	metrics.Describe("srclib_import_duration_seconds", "Duration of build data imports into the store, in seconds.")
+}
+
+// Import imports the build data in buildDataFS (the build data dir of
+// a commit, as written by "src make") into stor, a RepoStore or
+// MultiRepoStore. If ctx is done, source units that have not yet been
+// imported are skipped and ctx.Err() is returned (without building
+// indexes).
+func Import(ctx context.Context, buildDataFS vfs.FileSystem, stor interface{}, opt Options) (err error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "import", "repo", opt.Repo, "commit", opt.CommitID)
+	defer func() {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		metrics.Observe("srclib_import_duration_seconds", time.Since(start), "result", result)
+		span.End(err)
+	}()
+
+	// Key the imported data on the normalized repository URI (with the
+	// URI rules applied), which is the form of the URIs in refs'
+	// DefRepos.
+	if opt.Repo != "" {
+		if opt.Repo, err = graph.TryMakeURI(opt.Repo); err != nil {
+			return err
+		}
+	}
+
+	// Traverse the build data directory for this repo and commit to
+	// create the makefile that lists the targets (which are the data
+	// files we will import).
+	treeConfig, err := config.ReadCached(buildDataFS)
+	if err != nil {
+		return err
+	}
+	mf, err := plan.CreateMakefile(".", nil, "", treeConfig, plan.Options{NoCache: true})
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu               sync.Mutex
+		hasIndexableData bool
+
+		// dangling holds the indexes (within each unit's graph
+		// data) of refs to quarantine, and quarantined holds the
+		// refs that have been removed from the imported data.
+		dangling    map[unit.ID2]map[int]struct{}
+		quarantined refSpool
+
+		importedUnits []*unit.SourceUnit // for the content index
+		warnings      []*graph.Warning
+		fileSummaries []*graph.FileSummary
+	)
+	if opt.QuarantineDanglingRefs {
+		dangling, err = findDanglingRefs(buildDataFS, mf.Rules, opt)
+		if err != nil {
+			return err
+		}
+	}
+
+	var redaction *grapher.Redaction // nil redacts nothing
+	if opt.Redact != "" {
+		if redaction, err = grapher.ReadRedaction(opt.Redact); err != nil {
+			return err
+		}
+	}
+
+	jobs := opt.Jobs
+	if jobs <= 0 {
+		jobs = 10
+	}
+	var budget *memoryBudget
+	if opt.MaxMemory != "" {
+		max, err := flagutil.ParseByteSize(opt.MaxMemory)
+		if err != nil {
+			return err
+		}
+		budget = newMemoryBudget(max)
+		// Quarantined refs accumulate across all units, so keep
+		// them on disk beyond a quarter of the budget.
+		quarantined.limit = int(max / 4 / refMemoryEstimate)
+	}
+	defer quarantined.remove()
+
+	// Stage the import (if the store supports it), so that readers
+	// never see a partially imported commit. Imports of only some
+	// source units add to the commit's existing data, so they aren't
+	// staged.
+	commitID := opt.CommitID
+	if !opt.DryRun && opt.Unit == "" && opt.UnitType == "" {
+		staged, stageErr := stageImport(stor, opt.Repo, opt.CommitID)
+		if stageErr != nil {
+			return stageErr
+		}
+		if staged != nil {
+			commitID = staged.stagingID
+			defer func() {
+				if err == nil {
+					err = staged.publish()
+				} else {
+					staged.discard()
+				}
+			}()
+		}
+	}
+
+	par := parallel.NewRun(jobs)
+	for _, rule_ := range mf.Rules {
+		rule := rule_
+
+		if opt.Unit != "" || opt.UnitType != "" {
+			type ruleForSourceUnit interface {
+				SourceUnit() *unit.SourceUnit
+			}
+			if rule, ok := rule.(ruleForSourceUnit); ok {
+				u := rule.SourceUnit()
+				if (opt.Unit != "" && u.Name != opt.Unit) || (opt.UnitType != "" && u.Type != opt.UnitType) {
+					continue
+				}
+			} else {
+				// Skip all non-source-unit rules if --unit or
+				// --unit-type are specified.
+				continue
+			}
+		}
+
+		par.Do(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			switch rule := rule.(type) {
+			case *grapher.GraphUnitRule:
+				ul := logutil.ForUnit(nil, opt.Repo, rule.Unit.Type, rule.Unit.Name)
+
+				// Wait until there is room in the memory budget for
+				// the unit's data (estimated from its size on disk).
+				var mem uint64
+				if budget != nil {
+					if fi, err := buildDataFS.Stat(rule.Target()); err == nil {
+						mem = uint64(fi.Size()) * importMemoryFactor
+					}
+					budget.acquire(mem)
+					defer budget.release(mem)
+				}
+
+				var data graph.Output
+				if err := readGraphOutput(buildDataFS, rule.Target(), &data); err != nil {
+					if os.IsNotExist(err) {
+						ul.Warn("No build data for source unit.")
+						return nil
+					}
+					return err
+				}
+				if opt.DryRun || opt.Verbose {
+					ul.Info("Importing graph data.", "defs", len(data.Defs), "refs", len(data.Refs), "docs", len(data.Docs), "anns", len(data.Anns))
+					if opt.DryRun {
+						return nil
+					}
+				}
+
+				// Normalize paths so that build data produced on
+				// Windows or case-insensitive filesystems matches
+				// store keys.
+				if err := grapher.NormalizePaths(&data, opt.FoldCase); err != nil {
+					return fmt.Errorf("unit %s %s: %s", rule.Unit.Type, rule.Unit.Name, err)
+				}
+				u := *rule.Unit
+				u.Files = append([]string(nil), u.Files...)
+				if err := grapher.NormalizeUnitPaths(&u, opt.FoldCase); err != nil {
+					return fmt.Errorf("unit %s %s: %s", rule.Unit.Type, rule.Unit.Name, err)
+				}
+				redaction.RedactUnit(&u)
+
+				if idxs := dangling[rule.Unit.ID2()]; len(idxs) > 0 {
+					refs := make([]*graph.Ref, 0, len(data.Refs)-len(idxs))
+					var q graph.Output
+					for i, ref := range data.Refs {
+						if _, isDangling := idxs[i]; isDangling {
+							q.Refs = append(q.Refs, ref)
+						} else {
+							refs = append(refs, ref)
+						}
+					}
+					data.Refs = refs
+					// Quarantined refs are stored apart from their
+					// source unit, so fill in their implied fields.
+					grapher.PopulateImpliedFields(opt.Repo, opt.CommitID, rule.Unit.Type, rule.Unit.Name, &q)
+					if err := redaction.Redact(&q); err != nil {
+						return fmt.Errorf("unit %s %s: %s", rule.Unit.Type, rule.Unit.Name, err)
+					}
+					if err := quarantined.add(q.Refs); err != nil {
+						return err
+					}
+				}
+
+				// Redact after quarantining (which refers to refs by
+				// their index in the original data).
+				if err := redaction.Redact(&data); err != nil {
+					return fmt.Errorf("unit %s %s: %s", rule.Unit.Type, rule.Unit.Name, err)
+				}
+
+				if len(opt.DefRepos) > 0 {
+					for _, ref := range data.Refs {
+						if repo, ok := opt.DefRepos[ref.DefRepo]; ok {
+							ref.DefRepo = repo
+						}
+					}
+				}
+
+				// HACK: Transfer docs to [def].Docs.
+				docsByPath := make(map[string]*graph.Doc, len(data.Docs))
+				for _, doc := range data.Docs {
+					docsByPath[doc.Path] = doc
+				}
+				for _, def := range data.Defs {
+					if doc, present := docsByPath[def.Path]; present {
+						def.Docs = append(def.Docs, graph.DefDoc{Format: doc.Format, Data: doc.Data})
+					}
+				}
+
+				// Rank defs for ordering search results.
+				graph.ComputeDefRanks(&data)
+
+				for _, w := range data.Warnings {
+					w.UnitType, w.Unit = u.Type, u.Name
+				}
+				for _, s := range data.Files {
+					s.UnitType, s.Unit = u.Type, u.Name
+				}
+
+				_, unitSpan := tracing.Start(ctx, "import unit",
+					"unit_type", u.Type, "unit", u.Name,
+					"defs", len(data.Defs), "refs", len(data.Refs),
+				)
+				var importErr error
+				switch imp := stor.(type) {
+				case store.RepoImporter:
+					importErr = imp.Import(commitID, &u, data)
+				case store.MultiRepoImporter:
+					importErr = imp.Import(opt.Repo, commitID, &u, data)
+				default:
+					importErr = fmt.Errorf("store (type %T) does not implement importing", stor)
+				}
+				unitSpan.End(importErr)
+				if importErr != nil {
+					return importErr
+				}
+
+				mu.Lock()
+				hasIndexableData = true
+				importedUnits = append(importedUnits, &u)
+				warnings = append(warnings, data.Warnings...)
+				fileSummaries = append(fileSummaries, data.Files...)
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+	if err := par.Wait(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if opt.QuarantineDanglingRefs && !opt.DryRun {
+		if n := quarantined.Len(); n > 0 {
+			logutil.Default.Info("Quarantined dangling refs.", "refs", n)
+		}
+		if err := importQuarantinedRefs(stor, opt, commitID, importedUnits, &quarantined); err != nil {
+			return err
+		}
+	}
+
+	if hasIndexableData && !opt.NoIndex {
+		if opt.Verbose {
+			log.Printf("# Building indexes")
+		}
+		switch s := stor.(type) {
+		case store.RepoIndexer:
+			if err := s.Index(commitID); err != nil {
+				return err
+			}
+		case store.MultiRepoIndexer:
+			if err := s.Index(opt.Repo, commitID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if hasIndexableData && opt.IndexContent {
+		if opt.Verbose {
+			log.Printf("# Building content index")
+		}
+		contentOpt := opt
+		contentOpt.CommitID = commitID
+		if err := importContentIndex(stor, contentOpt, importedUnits, redaction); err != nil {
+			return err
+		}
+	}
+
+	if hasIndexableData {
+		if err := importProvenance(stor, buildDataFS, opt, commitID); err != nil {
+			return err
+		}
+		if err := importWarnings(stor, opt, commitID, importedUnits, warnings); err != nil {
+			return err
+		}
+		if err := importFileSummaries(stor, opt, commitID, importedUnits, fileSummaries); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A stagedImport is an import into a staging area of a store (see
+// store.RepoStager).
+type stagedImport struct {
+	stor                      interface{}
+	repo, commitID, stagingID string
+}
+
+// stageImport starts a staged import of the commit into stor. If stor
+// can't stage imports, it returns nil.
+func stageImport(stor interface{}, repo, commitID string) (*stagedImport, error) {
+	var stagingID string
+	var err error
+	switch s := stor.(type) {
+	case store.RepoStager:
+		stagingID, err = s.Stage(commitID)
+	case store.MultiRepoStager:
+		stagingID, err = s.Stage(repo, commitID)
+	default:
+		return nil, nil
+	}
+	if err == store.ErrStagingUnsupported {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &stagedImport{stor: stor, repo: repo, commitID: commitID, stagingID: stagingID}, nil
+}
+
+// publish makes the imported data visible to readers.
+func (s *stagedImport) publish() error {
+	switch stor := s.stor.(type) {
+	case store.RepoStager:
+		return stor.Publish(s.stagingID, s.commitID)
+	case store.MultiRepoStager:
+		return stor.Publish(s.repo, s.stagingID, s.commitID)
+	}
+	panic("unreachable")
+}
+
+// discard removes the imported data (after a failed import).
+func (s *stagedImport) discard() {
+	var err error
+	switch stor := s.stor.(type) {
+	case store.RepoStager:
+		err = stor.Discard(s.stagingID)
+	case store.MultiRepoStager:
+		err = stor.Discard(s.repo, s.stagingID)
+	}
+	if err != nil {
+		logutil.Default.Warn("Failed to remove staged import data.", "staging_id", s.stagingID, "err", err)
+	}
+}
+
+// findDanglingRefs returns the indexes of the refs in each source
+// unit's graph data that point to nonexistent defs in the same repo.
+// Only the refs of the source units selected by opt.Unit and
+// opt.UnitType are checked, but defs are read from all source units
+// in rules, so that refs to other units' defs aren't dangling.
+//
+// The graph data is read one source unit at a time (once for the
+// defs, whose keys are kept, and again for the refs), so that the
+// data of all source units needn't be in memory at once.
+func findDanglingRefs(buildDataFS vfs.FileSystem, rules []makex.Rule, opt Options) (map[unit.ID2]map[int]struct{}, error) {
+	var unitRules []*grapher.GraphUnitRule
+	for _, rule := range rules {
+		if rule, ok := rule.(*grapher.GraphUnitRule); ok {
+			unitRules = append(unitRules, rule)
+		}
+	}
+
+	// readUnit reads the rule's graph data, returning nil if the
+	// source unit has none.
+	readUnit := func(rule *grapher.GraphUnitRule) (*graph.Output, error) {
+		var data graph.Output
+		if err := readGraphOutput(buildDataFS, rule.Target(), &data); err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		grapher.PopulateImpliedFields(opt.Repo, "", rule.Unit.Type, rule.Unit.Name, &data)
+		return &data, nil
+	}
+
+	// Collect the keys (without CommitID, which refs to defs in the
+	// same repo leave implied) of all defs.
+	defKeys := map[graph.DefKey]struct{}{}
+	for _, rule := range unitRules {
+		data, err := readUnit(rule)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		for _, def := range data.Defs {
+			key := def.DefKey
+			key.CommitID = ""
+			defKeys[key] = struct{}{}
+		}
+	}
+
+	dangling := map[unit.ID2]map[int]struct{}{}
+	for _, rule := range unitRules {
+		if (opt.Unit != "" && rule.Unit.Name != opt.Unit) || (opt.UnitType != "" && rule.Unit.Type != opt.UnitType) {
+			continue
+		}
+		data, err := readUnit(rule)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		for i, ref := range data.Refs {
+			if !graph.URIEqual(ref.DefRepo, opt.Repo) {
+				continue
+			}
+			if _, resolved := defKeys[ref.DefKey()]; resolved {
+				continue
+			}
+			id := rule.Unit.ID2()
+			if dangling[id] == nil {
+				dangling[id] = map[int]struct{}{}
+			}
+			dangling[id][i] = struct{}{}
+		}
+	}
+	return dangling, nil
+}
+
+// readGraphOutput reads the graph output in file into o, using the
+// faster graph.DecodeOutput instead of encoding/json.
+func readGraphOutput(fs vfs.FileSystem, file string, o *graph.Output) error {
+	f, err := fs.Open(file)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	decoded, err := graph.DecodeOutput(data)
+	if err != nil {
+		return err
+	}
+	*o = *decoded
+	return nil
+}
+
+func readJSONFile(fs vfs.FileSystem, file string, v interface{}) (err error) {
+	f, err := fs.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := f.Close()
+		if err == nil {
+			err = err2
+		}
+	}()
+	return json.NewDecoder(f).Decode(v)
+}
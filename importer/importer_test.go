@@ -0,0 +1,135 @@
+package importer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/godoc/vfs/mapfs"
+
+	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestFindDanglingRefs(t *testing.T) {
+	ref := func(defRepo, defUnit, defPath string) *graph.Ref {
+		return &graph.Ref{DefRepo: defRepo, DefUnitType: "t", DefUnit: defUnit, DefPath: defPath, File: "f"}
+	}
+	data := map[string]*graph.Output{
+		"u1": {
+			Defs: []*graph.Def{{DefKey: graph.DefKey{Path: "a"}}},
+			Refs: []*graph.Ref{ref("r", "u1", "a"), ref("r", "u1", "x")},
+		},
+		"u2": {
+			Refs: []*graph.Ref{ref("r", "u1", "a"), ref("r", "u2", "y"), ref("other", "u2", "y")},
+		},
+	}
+	files := map[string]string{}
+	var rules []makex.Rule
+	for _, name := range []string{"u1", "u2", "nodata"} {
+		rule := &grapher.GraphUnitRule{Unit: &unit.SourceUnit{Type: "t", Name: name}}
+		rules = append(rules, rule)
+		if data[name] != nil {
+			b, err := json.Marshal(data[name])
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[rule.Target()] = string(b)
+		}
+	}
+
+	u1, u2 := unit.ID2{Type: "t", Name: "u1"}, unit.ID2{Type: "t", Name: "u2"}
+	tests := map[string]struct {
+		opt  Options
+		want map[unit.ID2]map[int]struct{}
+	}{
+		"all units": {
+			opt: Options{Repo: "r"},
+			want: map[unit.ID2]map[int]struct{}{
+				u1: {1: {}},
+				u2: {1: {}},
+			},
+		},
+		"unit": {
+			// u2's ref to u1's def resolves, even though u1's refs
+			// aren't checked.
+			opt:  Options{Repo: "r", Unit: "u2"},
+			want: map[unit.ID2]map[int]struct{}{u2: {1: {}}},
+		},
+		"other unit type": {
+			opt:  Options{Repo: "r", UnitType: "t2"},
+			want: map[unit.ID2]map[int]struct{}{},
+		},
+	}
+	for label, test := range tests {
+		got, err := findDanglingRefs(mapfs.New(files), rules, test.opt)
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", label, got, test.want)
+		}
+	}
+}
+
+func TestImportQuarantinedRefs_unit(t *testing.T) {
+	s := store.NewFSMultiRepoStore(rwvfs.Walkable(rwvfs.Map(map[string]string{})), nil)
+	ref := func(u, defPath string) *graph.Ref {
+		return &graph.Ref{DefRepo: "r", DefUnitType: "t", DefUnit: u, DefPath: defPath, Repo: "r", CommitID: "c", UnitType: "t", Unit: u, File: "f"}
+	}
+	units := func(names ...string) []*unit.SourceUnit {
+		var us []*unit.SourceUnit
+		for _, name := range names {
+			us = append(us, &unit.SourceUnit{Type: "t", Name: name})
+		}
+		return us
+	}
+
+	// Each import's quarantined refs replace those of the source
+	// units it imported, and keep the other source units'.
+	imports := []struct {
+		opt         Options
+		units       []*unit.SourceUnit
+		quarantined []*graph.Ref
+		want        []*graph.Ref
+	}{
+		{
+			opt:         Options{Repo: "r"},
+			units:       units("u1", "u2"),
+			quarantined: []*graph.Ref{ref("u1", "x"), ref("u2", "y")},
+			want:        []*graph.Ref{ref("u1", "x"), ref("u2", "y")},
+		},
+		{
+			opt:         Options{Repo: "r", Unit: "u2"},
+			units:       units("u2"),
+			quarantined: []*graph.Ref{ref("u2", "z")},
+			want:        []*graph.Ref{ref("u1", "x"), ref("u2", "z")},
+		},
+		{
+			opt:   Options{Repo: "r", Unit: "u1"},
+			units: units("u1"),
+			want:  []*graph.Ref{ref("u2", "z")},
+		},
+	}
+	for i, imp := range imports {
+		var spool refSpool
+		if err := spool.add(imp.quarantined); err != nil {
+			t.Fatal(err)
+		}
+		if err := importQuarantinedRefs(s, imp.opt, "c", imp.units, &spool); err != nil {
+			t.Fatalf("import %d: %s", i, err)
+		}
+		got, err := s.(store.MultiRepoRefQuarantiner).QuarantinedRefs("r", "c")
+		if err != nil {
+			t.Fatalf("import %d: %s", i, err)
+		}
+		if !reflect.DeepEqual(got, imp.want) {
+			t.Errorf("import %d: got quarantined refs %+v, want %+v", i, got, imp.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package importer
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// importMemoryFactor is the estimated ratio of the memory used to
+// import a source unit's graph data to the size of its (JSON) build
+// data file.
+const importMemoryFactor = 4
+
+// refMemoryEstimate is the estimated memory used by a ref (including
+// its strings), for deciding when to spill refs to disk.
+const refMemoryEstimate = 512
+
+// A memoryBudget limits the total (estimated) memory used by
+// concurrent operations. A nil *memoryBudget has no limit.
+type memoryBudget struct {
+	max uint64
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	used uint64
+}
+
+func newMemoryBudget(max uint64) *memoryBudget {
+	if max == 0 {
+		return nil
+	}
+	b := &memoryBudget{max: max}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// acquire blocks until n bytes are available in the budget and
+// reserves them. If n exceeds the whole budget, acquire waits until no
+// other operations hold any of the budget, so that the operation runs
+// alone.
+func (b *memoryBudget) acquire(n uint64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.used > 0 && b.used+n > b.max {
+		b.cond.Wait()
+	}
+	b.used += n
+}
+
+// release returns n bytes (previously acquired) to the budget.
+func (b *memoryBudget) release(n uint64) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	b.mu.Unlock()
+	b.cond.Broadcast()
+}
+
+// A refSpool collects refs to be written (sorted) to a writer. When
+// more than limit refs are collected, they are sorted and spilled to a
+// temporary file, and the sorted batches are merged when written, so
+// that the refs needn't all be in memory at once. A limit of 0 means
+// no limit.
+type refSpool struct {
+	limit int
+
+	mu    sync.Mutex
+	refs  []*graph.Ref
+	runs  []string // temporary files holding sorted batches of refs
+	count int
+}
+
+// add adds refs to the spool.
+func (s *refSpool) add(refs []*graph.Ref) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refs = append(s.refs, refs...)
+	s.count += len(refs)
+	if s.limit > 0 && len(s.refs) > s.limit {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill writes the refs in memory to a temporary file, sorted.
+func (s *refSpool) spill() error {
+	sort.Sort(graph.Refs(s.refs))
+	f, err := ioutil.TempFile("", "srclib-import-refs")
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f.Name())
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, ref := range s.refs {
+		if err := enc.Encode(ref); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	s.refs = nil
+	return f.Close()
+}
+
+// Len returns the number of refs added to the spool.
+func (s *refSpool) Len() int { return s.count }
+
+// writeTo writes all of the spool's refs, sorted, to w as a JSON
+// array.
+func (s *refSpool) writeTo(w io.Writer) error {
+	if len(s.runs) == 0 {
+		sort.Sort(graph.Refs(s.refs))
+		refs := s.refs
+		if refs == nil {
+			refs = []*graph.Ref{}
+		}
+		return json.NewEncoder(w).Encode(refs)
+	}
+	if len(s.refs) > 0 {
+		if err := s.spill(); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := s.merge(bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// merge writes the sorted batches of refs in the spool's temporary
+// files to w, as a single sorted JSON array.
+func (s *refSpool) merge(w io.Writer) error {
+	var h refRunHeap
+	for _, name := range s.runs {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r := &refRun{dec: json.NewDecoder(bufio.NewReader(f))}
+		if err := r.next(); err != nil {
+			return err
+		}
+		if r.ref != nil {
+			h = append(h, r)
+		}
+	}
+	heap.Init(&h)
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i := 0; len(h) > 0; i++ {
+		r := h[0]
+		data, err := json.Marshal(r.ref)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			data = append([]byte{','}, data...)
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if err := r.next(); err != nil {
+			return err
+		}
+		if r.ref == nil {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+// remove removes the spool's temporary files.
+func (s *refSpool) remove() {
+	for _, name := range s.runs {
+		os.Remove(name)
+	}
+	s.runs = nil
+}
+
+// A refRun reads a sorted batch of refs from a refSpool's temporary
+// file.
+type refRun struct {
+	dec *json.Decoder
+	ref *graph.Ref // current ref (nil at EOF)
+}
+
+func (r *refRun) next() error {
+	var ref graph.Ref
+	if err := r.dec.Decode(&ref); err == io.EOF {
+		r.ref = nil
+		return nil
+	} else if err != nil {
+		return err
+	}
+	r.ref = &ref
+	return nil
+}
+
+// refRunHeap is a min-heap of refRuns, ordered by their current refs.
+type refRunHeap []*refRun
+
+func (h refRunHeap) Len() int            { return len(h) }
+func (h refRunHeap) Less(i, j int) bool  { return graph.Refs{h[i].ref, h[j].ref}.Less(0, 1) }
+func (h refRunHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *refRunHeap) Push(x interface{}) { *h = append(*h, x.(*refRun)) }
+func (h *refRunHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
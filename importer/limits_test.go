@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	// A nil budget has no limit.
+	var nilBudget *memoryBudget
+	nilBudget.acquire(1 << 40)
+	nilBudget.release(1 << 40)
+	if b := newMemoryBudget(0); b != nil {
+		t.Errorf("got budget %+v for max 0, want nil", b)
+	}
+
+	b := newMemoryBudget(100)
+	b.acquire(60)
+	acquired := make(chan uint64)
+	go func() {
+		b.acquire(50) // waits for the first 60
+		acquired <- 50
+		b.acquire(200) // larger than the budget, so waits to run alone
+		acquired <- 200
+	}()
+	select {
+	case n := <-acquired:
+		t.Fatalf("acquired %d while over budget", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+	b.release(60)
+	if n := <-acquired; n != 50 {
+		t.Fatalf("got %d, want 50", n)
+	}
+	select {
+	case n := <-acquired:
+		t.Fatalf("acquired %d while another operation holds part of the budget", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+	b.release(50)
+	if n := <-acquired; n != 200 {
+		t.Fatalf("got %d, want 200", n)
+	}
+	b.release(200)
+	if b.used != 0 {
+		t.Errorf("got %d used, want 0", b.used)
+	}
+}
+
+func TestRefSpool_writeTo(t *testing.T) {
+	ref := func(defPath, file string, start uint32) *graph.Ref {
+		return &graph.Ref{DefRepo: "r", DefUnitType: "t", DefUnit: "u", DefPath: defPath, Repo: "r", UnitType: "t", Unit: "u", File: file, Start: start, End: start + 1}
+	}
+	batches := [][]*graph.Ref{
+		{ref("c", "f", 1), ref("a", "f", 5)},
+		{ref("b", "f", 2), ref("a", "f", 1), ref("d", "g", 0)},
+		{},
+		{ref("a", "g", 3)},
+		{ref("c", "f", 0), ref("b", "e", 9)},
+	}
+
+	tests := map[string]struct {
+		limit    int
+		wantRuns bool
+	}{
+		"in memory":   {limit: 0},
+		"spilled":     {limit: 2, wantRuns: true},
+		"spilled all": {limit: 1, wantRuns: true},
+	}
+	for label, test := range tests {
+		s := refSpool{limit: test.limit}
+		var want []*graph.Ref
+		for _, batch := range batches {
+			if err := s.add(batch); err != nil {
+				t.Fatalf("%s: %s", label, err)
+			}
+			want = append(want, batch...)
+		}
+		sort.Sort(graph.Refs(want))
+		if (len(s.runs) > 0) != test.wantRuns {
+			t.Errorf("%s: got %d temporary files, want spilled %v", label, len(s.runs), test.wantRuns)
+		}
+		if s.Len() != len(want) {
+			t.Errorf("%s: got Len %d, want %d", label, s.Len(), len(want))
+		}
+
+		var buf bytes.Buffer
+		if err := s.writeTo(&buf); err != nil {
+			t.Fatalf("%s: %s", label, err)
+		}
+		runs := s.runs
+		s.remove()
+		for _, name := range runs {
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Errorf("%s: temporary file %s not removed", label, name)
+			}
+		}
+
+		var refs []*graph.Ref
+		if err := json.Unmarshal(buf.Bytes(), &refs); err != nil {
+			t.Fatalf("%s: %s", label, err)
+		}
+		if !reflect.DeepEqual(refs, want) {
+			t.Errorf("%s: got refs\n%+v\nwant\n%+v", label, refs, want)
+		}
+	}
+}
+
+func TestRefSpool_writeToEmpty(t *testing.T) {
+	var s refSpool
+	var buf bytes.Buffer
+	if err := s.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "[]\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
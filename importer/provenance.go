@@ -0,0 +1,50 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"golang.org/x/tools/godoc/vfs"
+
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+// BuildProvenanceFilename is the name of the file (in a commit's build
+// data dir) that "src make" writes the build's provenance to. Import
+// reads it and stores it in the commit's provenance manifest (see
+// store.Provenance).
+const BuildProvenanceFilename = "provenance.json"
+
+// importProvenance stores the provenance manifest of an import of the
+// build data in buildDataFS (see Import) in stor. The build's
+// provenance is read from the build data, if it has any. Stores that
+// don't support provenance manifests are skipped.
+func importProvenance(stor interface{}, buildDataFS vfs.FileSystem, opt Options, stagingID string) error {
+	var p store.Provenance
+	if err := readJSONFile(buildDataFS, BuildProvenanceFilename, &p); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("reading build provenance: %s", err)
+	}
+	if opt.Repo != "" {
+		p.Repo = opt.Repo
+	}
+	if opt.CommitID != "" {
+		p.CommitID = opt.CommitID
+	}
+	if opt.Process != nil {
+		process := *opt.Process
+		p.Import = &process
+	} else {
+		p.Import = &store.ProcessProvenance{GoVersion: runtime.Version(), OS: runtime.GOOS, Arch: runtime.GOARCH}
+	}
+	p.Import.Time = time.Now().UTC()
+
+	switch s := stor.(type) {
+	case store.RepoProvenancer:
+		return s.ImportProvenance(stagingID, &p)
+	case store.MultiRepoProvenancer:
+		return s.ImportProvenance(opt.Repo, stagingID, &p)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+// Package jsonutil provides the canonical JSON encoding that srclib
+// uses for build data files, so that the same data is always encoded
+// as the same bytes (regardless of the Go version, platform, or
+// toolchain that produced it) and can be content-hashed and diffed.
+//
+// The canonical encoding of a JSON value is its encoding with:
+//
+//   - no whitespace between tokens;
+//   - object keys sorted bytewise (by their UTF-8 encoding), with each
+//     key appearing only once (the last value of a duplicated key is
+//     kept, as when decoding);
+//   - strings escaped only where required: '"', '\\', and control
+//     characters (as \b, \f, \n, \r, \t, or \u00XX), U+2028 and U+2029
+//     (as \u2028 and \u2029), and invalid UTF-8 (replaced by U+FFFD);
+//   - integers (numbers without a fraction or exponent) written as
+//     they appear (except that -0 is written as 0), and other numbers
+//     written as the shortest decimal that round-trips to the same
+//     float64 value, in exponent notation only if they are less than
+//     1e-6 or at least 1e21 in magnitude (as in ECMAScript).
+package jsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Marshal returns the canonical JSON encoding of v (which is first
+// encoded using encoding/json).
+func Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Canonicalize(data)
+}
+
+// Canonicalize returns the canonical encoding of the JSON value in
+// data.
+func Canonicalize(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("jsonutil: unexpected data after top-level JSON value")
+	}
+	return appendValue(make([]byte, 0, len(data)), v)
+}
+
+// IsCanonical reports whether data is the canonical encoding of a JSON
+// value.
+func IsCanonical(data []byte) bool {
+	c, err := Canonicalize(data)
+	return err == nil && bytes.Equal(c, data)
+}
+
+func appendValue(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, "null"...), nil
+	case bool:
+		return strconv.AppendBool(b, v), nil
+	case json.Number:
+		return appendNumber(b, v)
+	case string:
+		return appendString(b, v), nil
+	case []interface{}:
+		b = append(b, '[')
+		for i, e := range v {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			var err error
+			if b, err = appendValue(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, ']'), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = append(b, '{')
+		for i, k := range keys {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendString(b, k)
+			b = append(b, ':')
+			var err error
+			if b, err = appendValue(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, '}'), nil
+	}
+	return nil, fmt.Errorf("jsonutil: unexpected decoded JSON value of type %T", v)
+}
+
+func appendNumber(b []byte, n json.Number) ([]byte, error) {
+	s := string(n)
+	if !strings.ContainsAny(s, ".eE") {
+		if s == "-0" {
+			s = "0"
+		}
+		return append(b, s...), nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("jsonutil: number %s can't be represented as a float64", s)
+	}
+	if f == 0 {
+		return append(b, '0'), nil // also for -0
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs < 1e-6 || abs >= 1e21 {
+		format = 'e'
+	}
+	start := len(b)
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// Write e-07 as e-7 (like ECMAScript).
+		if n := len(b); n-start >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b, nil
+}
+
+const hex = "0123456789abcdef"
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c >= 0x20:
+				b = append(b, c)
+			case c == '\b':
+				b = append(b, `\b`...)
+			case c == '\f':
+				b = append(b, `\f`...)
+			case c == '\n':
+				b = append(b, `\n`...)
+			case c == '\r':
+				b = append(b, `\r`...)
+			case c == '\t':
+				b = append(b, `\t`...)
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b = append(b, "\ufffd"...)
+		case r == '\u2028' || r == '\u2029':
+			b = append(b, '\\', 'u', '2', '0', '2', hex[r&0xF])
+		default:
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(b, '"')
+}
@@ -0,0 +1,53 @@
+package jsonutil
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	tests := map[string]struct {
+		in, want string
+	}{
+		"whitespace":     {" { \"a\" : [ 1 , 2 ] }\n", `{"a":[1,2]}`},
+		"key order":      {`{"b": 1, "a": {"d": null, "c": true}}`, `{"a":{"c":true,"d":null},"b":1}`},
+		"bytewise keys":  {`{"é": 1, "z": 2, "Z": 3}`, `{"Z":3,"z":2,"é":1}`},
+		"duplicate keys": {`{"a": 1, "a": 2}`, `{"a":2}`},
+		"escapes":        {"\"A\\/é<>&\u2028\\u0001\\n\\\"\"", `"A/é<>&\u2028\u0001\n\""`},
+		"invalid UTF-8":  {"\"a\xffb\"", "\"a�b\""},
+		"integers":       {`[0, -0, 12345678901234567890123]`, `[0,0,12345678901234567890123]`},
+		"floats":         {`[1.0, 1e2, -0.0, 0.1, 1e-7, 1.5e300, 1e21, 123456789.125]`, `[1,100,0,0.1,1e-7,1.5e+300,1e+21,123456789.125]`},
+	}
+	for label, test := range tests {
+		got, err := Canonicalize([]byte(test.in))
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: got %s, want %s", label, got, test.want)
+		}
+		if !IsCanonical(got) {
+			t.Errorf("%s: canonical encoding %s is not canonical", label, got)
+		}
+	}
+}
+
+func TestCanonicalize_invalid(t *testing.T) {
+	for _, in := range []string{"", "{", `{"a": 1} x`, "1 2", "1e999"} {
+		if got, err := Canonicalize([]byte(in)); err == nil {
+			t.Errorf("%q: got %s, want error", in, got)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	v := struct {
+		B string
+		A map[string]float64
+	}{B: "<b>", A: map[string]float64{"y": 2.5, "x": 1}}
+	got, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"A":{"x":1,"y":2.5},"B":"<b>"}`; string(got) != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+// Package license detects the licenses of source code from the text
+// of license files, and identifies them by their SPDX license
+// identifiers (see https://spdx.org/licenses/).
+package license
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Filenames are the (case-insensitive) names of files that
+// DetectDir checks, in order of preference.
+var Filenames = []string{
+	"LICENSE", "LICENSE.txt", "LICENSE.md", "LICENSE.rst",
+	"LICENCE", "LICENCE.txt", "LICENCE.md",
+	"COPYING", "COPYING.txt",
+}
+
+// A rule identifies a license by phrases that its text contains.
+type rule struct {
+	id      string
+	title   string   // phrase that must be in the first titleLen bytes
+	all     []string // phrases that must all be present
+	without []string // phrases that must not be present
+}
+
+// titleLen is the length of the prefix of a license text in which
+// its title is searched for. (Titles are checked only near the start,
+// because some licenses mention others; e.g., the GPL mentions the
+// LGPL.)
+const titleLen = 500
+
+// rules are checked in order, so more specific rules come before the
+// rules that they would otherwise also match. Phrases are lowercase
+// and have single spaces (since the text is normalized before
+// matching).
+var rules = []rule{
+	{id: "AGPL-3.0", title: "gnu affero general public license version 3"},
+	{id: "LGPL-3.0", title: "gnu lesser general public license version 3"},
+	{id: "LGPL-2.1", title: "gnu lesser general public license version 2.1"},
+	{id: "GPL-3.0", title: "gnu general public license version 3"},
+	{id: "GPL-2.0", title: "gnu general public license version 2"},
+	{id: "Apache-2.0", title: "apache license version 2.0"},
+	{id: "MPL-2.0", title: "mozilla public license", all: []string{"version 2.0"}},
+	{id: "EPL-2.0", title: "eclipse public license - v 2.0"},
+	{id: "EPL-1.0", title: "eclipse public license - v 1.0"},
+	{id: "BSD-3-Clause", all: []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{id: "BSD-2-Clause", all: []string{"redistribution and use in source and binary forms"}, without: []string{"neither the name"}},
+	{id: "ISC", all: []string{"permission to use, copy, modify, and/or distribute this software for any purpose with or without fee is hereby granted"}},
+	{id: "MIT", all: []string{"permission is hereby granted, free of charge, to any person obtaining a copy"}},
+	{id: "Unlicense", all: []string{"this is free and unencumbered software released into the public domain"}},
+}
+
+var (
+	spdxTagPattern = regexp.MustCompile(`SPDX-License-Identifier:\s*([^\s*/#-][^\r\n*]*)`)
+	spacePattern   = regexp.MustCompile(`\s+`)
+)
+
+// Detect returns the SPDX identifier (or, for files with an
+// SPDX-License-Identifier tag, the tag's license expression) of the
+// license whose text is data. It returns the empty string if the
+// license isn't recognized.
+func Detect(data []byte) string {
+	if m := spdxTagPattern.FindSubmatch(data); m != nil {
+		return strings.TrimSpace(string(m[1]))
+	}
+
+	text := strings.ToLower(spacePattern.ReplaceAllString(string(bytes.TrimSpace(data)), " "))
+	head := text
+	if len(head) > titleLen {
+		head = head[:titleLen]
+	}
+Rules:
+	for _, r := range rules {
+		if r.title != "" && !strings.Contains(head, r.title) {
+			continue
+		}
+		for _, p := range r.all {
+			if !strings.Contains(text, p) {
+				continue Rules
+			}
+		}
+		for _, p := range r.without {
+			if strings.Contains(text, p) {
+				continue Rules
+			}
+		}
+		return r.id
+	}
+	return ""
+}
+
+// DetectDir returns the SPDX identifier of the license in the first
+// license file (see Filenames) in dir whose license is recognized. If
+// there is none, it returns the empty string.
+func DetectDir(dir string) (string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	for _, name := range Filenames {
+		for _, fi := range entries {
+			if fi.Mode().IsRegular() && strings.EqualFold(fi.Name(), name) {
+				data, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+				if err != nil {
+					return "", err
+				}
+				if id := Detect(data); id != "" {
+					return id, nil
+				}
+			}
+		}
+	}
+	return "", nil
+}
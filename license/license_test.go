@@ -0,0 +1,54 @@
+package license
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"All rights reserved.", ""},
+		{"// SPDX-License-Identifier: Apache-2.0 OR MIT\n", "Apache-2.0 OR MIT"},
+		{"/* SPDX-License-Identifier: GPL-2.0-only */", "GPL-2.0-only"},
+		{"The MIT License (MIT)\n\nPermission is hereby granted, free of charge, to any person\nobtaining a copy of this software", "MIT"},
+		{"\n   Apache License\n   Version 2.0, January 2004\n", "Apache-2.0"},
+		{"GNU GENERAL PUBLIC LICENSE\nVersion 3, 29 June 2007\n... use the GNU Lesser General Public License instead", "GPL-3.0"},
+		{"GNU LESSER GENERAL PUBLIC LICENSE\nVersion 2.1, February 1999", "LGPL-2.1"},
+		{"Redistribution and use in source and binary forms, with or without\nmodification, are permitted ... Neither the name of", "BSD-3-Clause"},
+		{"Redistribution and use in source and binary forms, with or without\nmodification, are permitted", "BSD-2-Clause"},
+	}
+	for _, test := range tests {
+		if got := Detect([]byte(test.text)); got != test.want {
+			t.Errorf("Detect(%q): got %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestDetectDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "license")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if id, err := DetectDir(dir); err != nil || id != "" {
+		t.Errorf("empty dir: got %q (err %v), want none", id, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "license.md"), []byte("ISC License\n\nPermission to use, copy, modify, and/or distribute this software for any\npurpose with or without fee is hereby granted"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := DetectDir(dir); err != nil || id != "ISC" {
+		t.Errorf("got %q (err %v), want ISC", id, err)
+	}
+
+	if id, err := DetectDir(filepath.Join(dir, "nonexistent")); err != nil || id != "" {
+		t.Errorf("nonexistent dir: got %q (err %v), want none", id, err)
+	}
+}
@@ -0,0 +1,42 @@
+// Package logutil provides the structured, leveled logger used by
+// srclib packages to report progress and warnings about the source
+// units and files they process.
+package logutil
+
+import (
+	"log/slog"
+	"os"
+)
+
+// Default is the logger that srclib packages use when no logger is
+// passed to them explicitly. Programs may replace it (the src CLI
+// configures it using its --log-format and --log-level flags).
+var Default = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// ForUnit returns a logger (derived from l, or Default if l is nil)
+// whose records carry fields identifying a source unit. The unit_id
+// field is a correlation ID that is the same in all records about the
+// source unit, across all build steps.
+func ForUnit(l *slog.Logger, repo, unitType, unit string) *slog.Logger {
+	if l == nil {
+		l = Default
+	}
+	attrs := make([]any, 0, 8)
+	if repo != "" {
+		attrs = append(attrs, "repo", repo)
+	}
+	if unitType != "" || unit != "" {
+		attrs = append(attrs, "unit_type", unitType, "unit", unit, "unit_id", UnitID(repo, unitType, unit))
+	}
+	return l.With(attrs...)
+}
+
+// UnitID returns the correlation ID of a source unit, which is of the
+// form "REPO:UNITTYPE:UNIT" (or "UNITTYPE:UNIT" if repo is empty).
+func UnitID(repo, unitType, unit string) string {
+	id := unitType + ":" + unit
+	if repo != "" {
+		id = repo + ":" + id
+	}
+	return id
+}
@@ -0,0 +1,25 @@
+package logutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestForUnit(t *testing.T) {
+	var buf bytes.Buffer
+	l := ForUnit(slog.New(slog.NewJSONHandler(&buf, nil)), "r", "t", "u")
+	l.Info("hello", "file", "f")
+
+	var rec map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"msg": "hello", "repo": "r", "unit_type": "t", "unit": "u", "unit_id": "r:t:u", "file": "f"}
+	for k, v := range want {
+		if rec[k] != v {
+			t.Errorf("record field %q: got %v, want %q", k, rec[k], v)
+		}
+	}
+}
@@ -0,0 +1,469 @@
+// Package lsif exports srclib graph data as an LSIF (Language Server
+// Index Format) dump, the code intelligence format that Sourcegraph
+// (and other code hosts) import, and uploads dumps to Sourcegraph.
+//
+// Each def is exported as a result set with its definition range (the
+// def's name, if it has a def ref), its references, a hover with its
+// docs, and an export moniker (with the "srclib" scheme) that
+// identifies it across repositories. Refs to defs in other
+// repositories are exported with import monikers, so that Sourcegraph
+// can link them to the dumps of those repositories.
+//
+// See https://microsoft.github.io/language-server-protocol/specifications/lsif/0.4.0/specification/.
+package lsif
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// Version is the LSIF version of exported dumps.
+const Version = "0.4.3"
+
+// MonikerScheme is the scheme of the monikers of exported defs.
+const MonikerScheme = "srclib"
+
+// An Exporter writes LSIF dumps of a repository's defs and refs at a
+// commit.
+type Exporter struct {
+	// ProjectRoot is the URI of the repository root (such as
+	// "file:///home/alice/src/repo"). Document URIs are relative to it.
+	ProjectRoot string
+
+	// Repo is the URI of the repository whose data is exported. Refs
+	// to defs in other repositories are exported with import
+	// monikers.
+	Repo string
+
+	// ToolVersion is the version of srclib that wrote the dump.
+	ToolVersion string
+
+	// ReadFile returns the contents of a file (relative to the
+	// repository root) at the exported commit. It is used to convert
+	// byte offsets to the line and character positions that LSIF
+	// uses. Defs and refs in files that can't be read are skipped, and
+	// the errors are returned by Export in a *SkippedFilesError.
+	ReadFile func(file string) ([]byte, error)
+}
+
+// SkippedFilesError is returned by Export if it couldn't read some
+// files. The dump was written without them.
+type SkippedFilesError struct {
+	Errs map[string]error // file -> error
+}
+
+func (e *SkippedFilesError) Error() string {
+	files := make([]string, 0, len(e.Errs))
+	for f := range e.Errs {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return fmt.Sprintf("skipped %d unreadable files (first: %s: %s)", len(files), files[0], e.Errs[files[0]])
+}
+
+// Export writes an LSIF dump of defs and refs (which must all be in
+// e.Repo at the same commit) to w, as newline-delimited JSON.
+func (e *Exporter) Export(w io.Writer, defs []*graph.Def, refs []*graph.Ref) error {
+	x := &exporter{
+		Exporter:   e,
+		w:          bufio.NewWriter(w),
+		docs:       map[string]*document{},
+		resultSets: map[graph.DefKey]int{},
+		ranges:     map[rangeKey]int{},
+		skipped:    map[string]error{},
+	}
+	x.enc = json.NewEncoder(x.w)
+	x.enc.SetEscapeHTML(false)
+	if err := x.export(defs, refs); err != nil {
+		return err
+	}
+	if err := x.w.Flush(); err != nil {
+		return err
+	}
+	if len(x.skipped) > 0 {
+		return &SkippedFilesError{Errs: x.skipped}
+	}
+	return nil
+}
+
+type exporter struct {
+	*Exporter
+	w   *bufio.Writer
+	enc *json.Encoder
+	err error // first write error
+
+	nextID     int
+	docs       map[string]*document
+	resultSets map[graph.DefKey]int // def key -> result set ID
+	ranges     map[rangeKey]int     // range -> range ID
+	skipped    map[string]error     // unreadable file -> error
+
+	// definitions and references are the ranges of each result set's
+	// definitions and references, by document.
+	definitions map[int]map[int][]int // result set ID -> document ID -> range IDs
+	references  map[int]map[int][]int
+}
+
+// A document is an exported file.
+type document struct {
+	id     int
+	lines  lineIndex
+	ranges []int
+}
+
+type rangeKey struct {
+	file       string
+	start, end uint32
+}
+
+// element is a vertex or edge.
+type element map[string]interface{}
+
+func (x *exporter) emit(e element) int {
+	x.nextID++
+	e["id"] = x.nextID
+	if x.err == nil {
+		x.err = x.enc.Encode(e)
+	}
+	return x.nextID
+}
+
+func (x *exporter) vertex(label string, e element) int {
+	if e == nil {
+		e = element{}
+	}
+	e["type"], e["label"] = "vertex", label
+	return x.emit(e)
+}
+
+// edge emits a 1:1 edge.
+func (x *exporter) edge(label string, outV, inV int) {
+	x.emit(element{"type": "edge", "label": label, "outV": outV, "inV": inV})
+}
+
+// edges emits a 1:n edge (with the extra properties in e).
+func (x *exporter) edges(label string, outV int, inVs []int, e element) {
+	if e == nil {
+		e = element{}
+	}
+	e["type"], e["label"], e["outV"], e["inVs"] = "edge", label, outV, inVs
+	x.emit(e)
+}
+
+func (x *exporter) export(defs []*graph.Def, refs []*graph.Ref) error {
+	x.definitions = map[int]map[int][]int{}
+	x.references = map[int]map[int][]int{}
+
+	x.vertex("metaData", element{
+		"version":          Version,
+		"projectRoot":      strings.TrimSuffix(x.ProjectRoot, "/"),
+		"positionEncoding": "utf-16",
+		"toolInfo":         element{"name": "srclib", "version": x.ToolVersion},
+	})
+	x.vertex("project", element{"kind": "srclib"})
+
+	// Export defs and refs in a deterministic order.
+	defs = append([]*graph.Def(nil), defs...)
+	sort.Slice(defs, func(i, j int) bool { return defKeyLess(defs[i].DefKey, defs[j].DefKey) })
+	refs = append([]*graph.Ref(nil), refs...)
+	sort.Slice(refs, func(i, j int) bool {
+		a, b := refs[i], refs[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Start != b.Start {
+			return a.Start < b.Start
+		}
+		return a.End < b.End
+	})
+
+	// Result sets (with hovers and export monikers) for defs.
+	for _, def := range defs {
+		key := def.DefKey
+		key.Repo, key.CommitID = x.Repo, ""
+		if _, present := x.resultSets[key]; present {
+			continue
+		}
+		rs := x.vertex("resultSet", nil)
+		x.resultSets[key] = rs
+		if hover := hoverContents(def); hover != nil {
+			h := x.vertex("hoverResult", element{"result": element{"contents": hover}})
+			x.edge("textDocument/hover", rs, h)
+		}
+		x.moniker(rs, "export", key)
+	}
+
+	// Definition ranges: the def refs, or if a def has none, its whole
+	// definition.
+	hasDefRef := map[graph.DefKey]bool{}
+	for _, ref := range refs {
+		if ref.Def && x.isLocal(ref) {
+			hasDefRef[x.refDefKey(ref)] = true
+		}
+	}
+	for _, def := range defs {
+		key := def.DefKey
+		key.Repo, key.CommitID = x.Repo, ""
+		if hasDefRef[key] || def.File == "" || def.DefStart >= def.DefEnd {
+			continue
+		}
+		if doc, r, isNew := x.rangeVertex(def.File, def.DefStart, def.DefEnd); isNew {
+			x.edge("next", r, x.resultSets[key])
+			addItem(x.definitions, x.resultSets[key], doc.id, r)
+		}
+	}
+
+	// Ranges for refs, linked to the result sets of their defs.
+	for _, ref := range refs {
+		key := x.refDefKey(ref)
+		rs, present := x.resultSets[key]
+		if !present {
+			// The def is in another repository (or it's missing from
+			// this one).
+			rs = x.vertex("resultSet", nil)
+			x.resultSets[key] = rs
+			if !x.isLocal(ref) {
+				x.moniker(rs, "import", key)
+			}
+		}
+		// A range can only be in one result set, so if refs have the
+		// same range, the first one wins.
+		doc, r, isNew := x.rangeVertex(ref.File, ref.Start, ref.End)
+		if !isNew {
+			continue
+		}
+		x.edge("next", r, rs)
+		if ref.Def && x.isLocal(ref) {
+			addItem(x.definitions, rs, doc.id, r)
+		} else {
+			addItem(x.references, rs, doc.id, r)
+		}
+	}
+
+	// Documents contain their ranges.
+	files := make([]string, 0, len(x.docs))
+	for f := range x.docs {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		if doc := x.docs[f]; doc != nil && len(doc.ranges) > 0 {
+			x.edges("contains", doc.id, doc.ranges, nil)
+		}
+	}
+
+	// Definition and reference results.
+	keys := make([]graph.DefKey, 0, len(x.resultSets))
+	for k := range x.resultSets {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return defKeyLess(keys[i], keys[j]) })
+	for _, k := range keys {
+		rs := x.resultSets[k]
+		defsByDoc, refsByDoc := x.definitions[rs], x.references[rs]
+		if len(defsByDoc) > 0 {
+			dr := x.vertex("definitionResult", nil)
+			x.edge("textDocument/definition", rs, dr)
+			x.items(dr, defsByDoc, "")
+		}
+		if len(defsByDoc) > 0 || len(refsByDoc) > 0 {
+			rr := x.vertex("referenceResult", nil)
+			x.edge("textDocument/references", rs, rr)
+			x.items(rr, defsByDoc, "definitions")
+			x.items(rr, refsByDoc, "references")
+		}
+	}
+	return x.err
+}
+
+func (x *exporter) isLocal(ref *graph.Ref) bool {
+	return ref.DefRepo == "" || ref.DefRepo == x.Repo
+}
+
+func (x *exporter) refDefKey(ref *graph.Ref) graph.DefKey {
+	key := ref.DefKey()
+	if key.Repo == "" {
+		key.Repo = x.Repo
+	}
+	key.CommitID = ""
+	return key
+}
+
+// moniker attaches a moniker of kind ("export" or "import") that
+// identifies the def with key across repositories to the result set
+// rs.
+func (x *exporter) moniker(rs int, kind string, key graph.DefKey) {
+	m := x.vertex("moniker", element{
+		"scheme":     MonikerScheme,
+		"identifier": MonikerIdentifier(key),
+		"kind":       kind,
+	})
+	x.edge("moniker", rs, m)
+}
+
+// MonikerIdentifier returns the identifier of the moniker of the def
+// with key (in which CommitID is ignored).
+func MonikerIdentifier(key graph.DefKey) string {
+	return strings.Join([]string{key.Repo, key.UnitType, key.Unit, key.Path}, " ")
+}
+
+// items emits item edges from the result res to the ranges in
+// rangesByDoc (document ID -> range IDs), with property (if set).
+func (x *exporter) items(res int, rangesByDoc map[int][]int, property string) {
+	docs := make([]int, 0, len(rangesByDoc))
+	for d := range rangesByDoc {
+		docs = append(docs, d)
+	}
+	sort.Ints(docs)
+	for _, d := range docs {
+		e := element{"document": d}
+		if property != "" {
+			e["property"] = property
+		}
+		x.edges("item", res, rangesByDoc[d], e)
+	}
+}
+
+func addItem(m map[int]map[int][]int, rs, doc, r int) {
+	if m[rs] == nil {
+		m[rs] = map[int][]int{}
+	}
+	for _, r2 := range m[rs][doc] {
+		if r2 == r {
+			return
+		}
+	}
+	m[rs][doc] = append(m[rs][doc], r)
+}
+
+// rangeVertex emits the range vertex (and if needed, its document)
+// for the byte range [start, end) of file, if it hasn't been emitted
+// already. It returns false if the range was already emitted or if the
+// file can't be read.
+func (x *exporter) rangeVertex(file string, start, end uint32) (doc *document, r int, isNew bool) {
+	doc = x.document(file)
+	if doc == nil {
+		return nil, 0, false
+	}
+	k := rangeKey{file: file, start: start, end: end}
+	if _, present := x.ranges[k]; present {
+		return doc, 0, false
+	}
+	r = x.vertex("range", element{"start": doc.lines.position(start), "end": doc.lines.position(end)})
+	x.ranges[k] = r
+	doc.ranges = append(doc.ranges, r)
+	return doc, r, true
+}
+
+// document returns the document for file, emitting it if needed, or
+// nil if file can't be read.
+func (x *exporter) document(file string) *document {
+	if doc, present := x.docs[file]; present {
+		return doc
+	}
+	data, err := x.ReadFile(file)
+	if err != nil {
+		x.skipped[file] = err
+		x.docs[file] = nil
+		return nil
+	}
+	doc := &document{lines: newLineIndex(data)}
+	doc.id = x.vertex("document", element{
+		"uri":        strings.TrimSuffix(x.ProjectRoot, "/") + "/" + strings.TrimPrefix(path.Clean(file), "/"),
+		"languageId": languageID(file),
+	})
+	x.docs[file] = doc
+	return doc
+}
+
+// hoverContents returns the hover contents of def (its name and
+// kind, and its plain-text or Markdown docs), or nil if there are none.
+func hoverContents(def *graph.Def) []interface{} {
+	var contents []interface{}
+	if def.Name != "" {
+		title := "`" + def.Name + "`"
+		if def.Kind != "" {
+			title = def.Kind + " " + title
+		}
+		contents = append(contents, title)
+	}
+	for _, doc := range def.Docs {
+		if doc.Format == "text/plain" || doc.Format == "text/x-markdown" || doc.Format == "" {
+			contents = append(contents, doc.Data)
+			break
+		}
+	}
+	return contents
+}
+
+// languageIDs maps file extensions to LSP language IDs.
+var languageIDs = map[string]string{
+	".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".hpp": "cpp",
+	".cs": "csharp", ".css": "css", ".go": "go", ".java": "java",
+	".js": "javascript", ".jsx": "javascriptreact", ".json": "json",
+	".php": "php", ".proto": "proto", ".py": "python", ".rb": "ruby",
+	".rs": "rust", ".scala": "scala", ".sh": "shellscript",
+	".ts": "typescript", ".tsx": "typescriptreact",
+}
+
+func languageID(file string) string {
+	return languageIDs[strings.ToLower(path.Ext(file))]
+}
+
+func defKeyLess(a, b graph.DefKey) bool {
+	if a.Repo != b.Repo {
+		return a.Repo < b.Repo
+	}
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	if a.Unit != b.Unit {
+		return a.Unit < b.Unit
+	}
+	return a.Path < b.Path
+}
+
+// A lineIndex converts byte offsets in a file to LSP positions (with
+// zero-based lines and UTF-16 characters). Lines end in LF, CRLF, or
+// CR, as in LSP.
+type lineIndex struct {
+	data   []byte
+	starts []int // byte offsets of the start of each line
+}
+
+func newLineIndex(data []byte) lineIndex {
+	starts := []int{0}
+	for i, b := range data {
+		if b == '\n' || (b == '\r' && (i+1 == len(data) || data[i+1] != '\n')) {
+			starts = append(starts, i+1)
+		}
+	}
+	return lineIndex{data: data, starts: starts}
+}
+
+func (l lineIndex) position(offset uint32) element {
+	off := int(offset)
+	if off > len(l.data) {
+		off = len(l.data)
+	}
+	line := sort.Search(len(l.starts), func(i int) bool { return l.starts[i] > off }) - 1
+	var char int
+	for b := l.data[l.starts[line]:off]; len(b) > 0; {
+		r, size := utf8.DecodeRune(b)
+		if r >= 0x10000 {
+			char += 2 // surrogate pair
+		} else {
+			char++
+		}
+		b = b[size:]
+	}
+	return element{"line": line, "character": char}
+}
@@ -0,0 +1,188 @@
+package lsif
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestExport(t *testing.T) {
+	files := map[string]string{
+		"a.go": "package a\n\nfunc F() { G() }\n",
+		"b.go": "package a\n\n// é\nfunc G() { fmt.Println() }\n",
+	}
+	e := &Exporter{
+		ProjectRoot: "file:///src/r",
+		Repo:        "example.com/r",
+		ReadFile: func(file string) ([]byte, error) {
+			if data, ok := files[file]; ok {
+				return []byte(data), nil
+			}
+			return nil, os.ErrNotExist
+		},
+	}
+	defs := []*graph.Def{
+		{DefKey: graph.DefKey{UnitType: "GoPackage", Unit: "a", Path: "F"}, Name: "F", Kind: "func", File: "a.go", DefStart: 11, DefEnd: 27},
+		{DefKey: graph.DefKey{UnitType: "GoPackage", Unit: "a", Path: "G"}, Name: "G", Kind: "func", File: "b.go", DefStart: 17, DefEnd: 43, Docs: []graph.DefDoc{{Format: "text/plain", Data: "G does things."}}},
+		{DefKey: graph.DefKey{UnitType: "GoPackage", Unit: "a", Path: "H"}, Name: "H", File: "c.go", DefStart: 0, DefEnd: 10},
+	}
+	refs := []*graph.Ref{
+		{DefUnitType: "GoPackage", DefUnit: "a", DefPath: "F", Def: true, File: "a.go", Start: 16, End: 17},
+		{DefUnitType: "GoPackage", DefUnit: "a", DefPath: "G", File: "a.go", Start: 22, End: 23},
+		{DefRepo: "example.com/fmt", DefUnitType: "GoPackage", DefUnit: "fmt", DefPath: "Println", File: "b.go", Start: 32, End: 39},
+	}
+
+	var buf bytes.Buffer
+	err := e.Export(&buf, defs, refs)
+	if skipped, ok := err.(*SkippedFilesError); !ok || len(skipped.Errs) != 1 || skipped.Errs["c.go"] == nil {
+		t.Fatalf("got error %v, want c.go to be skipped", err)
+	}
+
+	// Index the dump's elements.
+	var elems []map[string]interface{}
+	byID := map[float64]map[string]interface{}{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var el map[string]interface{}
+		if err := dec.Decode(&el); err != nil {
+			t.Fatal(err)
+		}
+		if byID[el["id"].(float64)] != nil {
+			t.Fatalf("duplicate ID in %v", el)
+		}
+		byID[el["id"].(float64)] = el
+		elems = append(elems, el)
+	}
+	if l := elems[0]["label"]; l != "metaData" {
+		t.Fatalf("got first element %v, want metaData", l)
+	}
+	edgesFrom := func(label string, outV float64) []map[string]interface{} {
+		var es []map[string]interface{}
+		for _, el := range elems {
+			if el["type"] == "edge" && el["label"] == label && el["outV"] == outV {
+				es = append(es, el)
+			}
+		}
+		return es
+	}
+	// Every edge's vertices are emitted before it.
+	for _, el := range elems {
+		if el["type"] != "edge" {
+			continue
+		}
+		vs := []interface{}{el["outV"], el["inV"]}
+		if inVs, ok := el["inVs"].([]interface{}); ok {
+			vs = append(vs[:1], inVs...)
+		}
+		for _, v := range vs {
+			if v != nil && (byID[v.(float64)] == nil || v.(float64) > el["id"].(float64)) {
+				t.Errorf("edge %v refers to vertex %v that isn't emitted before it", el, v)
+			}
+		}
+	}
+
+	// rangeAt returns the range vertex at the position.
+	rangeAt := func(uri string, line, char float64) map[string]interface{} {
+		for _, doc := range elems {
+			if doc["label"] != "document" || doc["uri"] != uri {
+				continue
+			}
+			for _, c := range edgesFrom("contains", doc["id"].(float64)) {
+				for _, r := range c["inVs"].([]interface{}) {
+					rv := byID[r.(float64)]
+					start := rv["start"].(map[string]interface{})
+					if start["line"] == line && start["character"] == char {
+						return rv
+					}
+				}
+			}
+		}
+		t.Fatalf("no range at %s:%v:%v", uri, line, char)
+		return nil
+	}
+	resultSet := func(r map[string]interface{}) float64 {
+		next := edgesFrom("next", r["id"].(float64))
+		if len(next) != 1 {
+			t.Fatalf("range %v has %d next edges, want 1", r, len(next))
+		}
+		return next[0]["inV"].(float64)
+	}
+	definition := func(rs float64) []interface{} {
+		drs := edgesFrom("textDocument/definition", rs)
+		if len(drs) != 1 {
+			return nil
+		}
+		items := edgesFrom("item", drs[0]["inV"].(float64))
+		if len(items) != 1 {
+			t.Fatalf("got %d definition items, want 1", len(items))
+		}
+		return items[0]["inVs"].([]interface{})
+	}
+	moniker := func(rs float64) map[string]interface{} {
+		ms := edgesFrom("moniker", rs)
+		if len(ms) != 1 {
+			t.Fatalf("result set %v has %d monikers, want 1", rs, len(ms))
+		}
+		return byID[ms[0]["inV"].(float64)]
+	}
+
+	// The ref to G in a.go is linked to G's definition in b.go (at
+	// its whole definition, since it has no def ref).
+	gRef := rangeAt("file:///src/r/a.go", 2, 11)
+	gRS := resultSet(gRef)
+	gDef := definition(gRS)
+	if len(gDef) != 1 {
+		t.Fatalf("got G definitions %v, want 1", gDef)
+	}
+	if start := byID[gDef[0].(float64)]["start"]; !reflect.DeepEqual(start, map[string]interface{}{"line": 3.0, "character": 0.0}) {
+		t.Errorf("got G definition at %v, want 3:0", start)
+	}
+	if m := moniker(gRS); m["identifier"] != "example.com/r GoPackage a G" || m["kind"] != "export" {
+		t.Errorf("got G moniker %v", m)
+	}
+	hover := edgesFrom("textDocument/hover", gRS)
+	if len(hover) != 1 || !reflect.DeepEqual(byID[hover[0]["inV"].(float64)]["result"], map[string]interface{}{"contents": []interface{}{"func `G`", "G does things."}}) {
+		t.Errorf("got G hover %v", hover)
+	}
+
+	// F's def ref is its definition.
+	fRef := rangeAt("file:///src/r/a.go", 2, 5)
+	if def := definition(resultSet(fRef)); len(def) != 1 || def[0] != fRef["id"] {
+		t.Errorf("got F definitions %v, want its def ref", def)
+	}
+
+	// The ref to Println (in another repo) has an import moniker and
+	// no definition.
+	pRef := rangeAt("file:///src/r/b.go", 3, 15)
+	pRS := resultSet(pRef)
+	if def := definition(pRS); def != nil {
+		t.Errorf("got Println definitions %v, want none", def)
+	}
+	if m := moniker(pRS); m["identifier"] != "example.com/fmt GoPackage fmt Println" || m["kind"] != "import" {
+		t.Errorf("got Println moniker %v", m)
+	}
+}
+
+func TestLineIndex(t *testing.T) {
+	l := newLineIndex([]byte("ab\n\U0001F600x\n"))
+	tests := map[uint32][2]int{0: {0, 0}, 2: {0, 2}, 3: {1, 0}, 7: {1, 2}, 8: {1, 3}, 9: {2, 0}, 100: {2, 0}}
+	for offset, want := range tests {
+		got := l.position(offset)
+		if got["line"] != want[0] || got["character"] != want[1] {
+			t.Errorf("offset %d: got %v, want %v", offset, got, want)
+		}
+	}
+
+	l = newLineIndex([]byte("a\r\nb\rc\n"))
+	tests = map[uint32][2]int{1: {0, 1}, 2: {0, 2}, 3: {1, 0}, 4: {1, 1}, 5: {2, 0}, 7: {3, 0}}
+	for offset, want := range tests {
+		got := l.position(offset)
+		if got["line"] != want[0] || got["character"] != want[1] {
+			t.Errorf("CRLF and CR: offset %d: got %v, want %v", offset, got, want)
+		}
+	}
+}
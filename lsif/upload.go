@@ -0,0 +1,213 @@
+package lsif
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// An Uploader uploads LSIF dumps to a Sourcegraph instance, which
+// processes them into code intelligence data for a repository commit.
+type Uploader struct {
+	// Endpoint is the URL of the Sourcegraph instance (such as
+	// "https://sourcegraph.example.com").
+	Endpoint string
+
+	// AccessToken authenticates the uploads. It must belong to a site
+	// admin (or, on instances that check repository permissions, to a
+	// user with write access to the repository).
+	AccessToken string
+
+	// Client makes the HTTP requests. If nil, http.DefaultClient is
+	// used.
+	Client *http.Client
+
+	// Retries is the max number of times that a failed upload is
+	// retried, after RetryDelay (which doubles after each retry).
+	// Uploads are retried after network errors and 5xx and 429
+	// responses; other errors (such as those for invalid tokens) are
+	// permanent.
+	Retries    int
+	RetryDelay time.Duration
+
+	// Progress, if set, is called periodically during each upload
+	// attempt with the number of (compressed) bytes sent so far and
+	// the total.
+	Progress func(sent, total int64)
+}
+
+// UploadOptions describe an uploaded dump.
+type UploadOptions struct {
+	Repo     string // repository URI, as named on the Sourcegraph instance
+	CommitID string // full commit ID
+
+	// Root is the dir (relative to the repository root) that the dump
+	// is for, or "" for the whole repository.
+	Root string
+
+	// Indexer and IndexerVersion are the name and version of the tool
+	// that produced the dump (such as "srclib").
+	Indexer, IndexerVersion string
+}
+
+// Upload gzips the dump in the file named dumpFile and uploads it. It
+// returns the ID that the Sourcegraph instance assigned to the upload
+// (with which its processing can be tracked).
+func (u *Uploader) Upload(ctx context.Context, dumpFile string, opt UploadOptions) (string, error) {
+	gz, err := gzipFile(dumpFile)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(gz)
+
+	delay := u.RetryDelay
+	if delay == 0 {
+		delay = time.Second
+	}
+	for attempt := 0; ; attempt++ {
+		id, err := u.upload(ctx, gz, opt)
+		if err == nil {
+			return id, nil
+		}
+		if _, permanent := err.(*permanentError); permanent || attempt >= u.Retries {
+			return "", err
+		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		delay *= 2
+	}
+}
+
+// permanentError is an upload error that retrying won't fix.
+type permanentError struct{ error }
+
+func (u *Uploader) upload(ctx context.Context, gzFile string, opt UploadOptions) (string, error) {
+	f, err := os.Open(gzFile)
+	if err != nil {
+		return "", &permanentError{err}
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", &permanentError{err}
+	}
+
+	q := url.Values{}
+	q.Set("repository", opt.Repo)
+	q.Set("commit", opt.CommitID)
+	if opt.Root != "" {
+		q.Set("root", opt.Root)
+	}
+	if opt.Indexer != "" {
+		q.Set("indexerName", opt.Indexer)
+	}
+	if opt.IndexerVersion != "" {
+		q.Set("indexerVersion", opt.IndexerVersion)
+	}
+	urlStr := strings.TrimSuffix(u.Endpoint, "/") + "/.api/lsif/upload?" + q.Encode()
+
+	var body io.Reader = f
+	if u.Progress != nil {
+		body = &progressReader{r: f, total: fi.Size(), progress: u.Progress}
+	}
+	req, err := http.NewRequest("POST", urlStr, body)
+	if err != nil {
+		return "", &permanentError{err}
+	}
+	req.ContentLength = fi.Size()
+	// The body is the gzipped dump itself (not a gzip-encoded
+	// request), which Sourcegraph stores as is.
+	req.Header.Set("Content-Type", "application/x-ndjson+lsif")
+	if u.AccessToken != "" {
+		req.Header.Set("Authorization", "token "+u.AccessToken)
+	}
+
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("uploading LSIF dump to %s: HTTP status %s: %s", u.Endpoint, resp.Status, strings.TrimSpace(string(respBody)))
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return "", err
+		}
+		return "", &permanentError{err}
+	}
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", &permanentError{fmt.Errorf("uploading LSIF dump to %s: invalid response: %s", u.Endpoint, err)}
+	}
+	return result.ID, nil
+}
+
+// gzipFile writes a gzipped copy of file to a temporary file and
+// returns its name.
+func gzipFile(file string) (string, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := ioutil.TempFile("", "srclib-lsif-")
+	if err != nil {
+		return "", err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err2 := zw.Close(); err == nil {
+		err = err2
+	}
+	if err2 := out.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+// progressReader calls progress at most every progressInterval as it
+// is read.
+type progressReader struct {
+	r        io.Reader
+	sent     int64
+	total    int64
+	last     time.Time
+	progress func(sent, total int64)
+}
+
+const progressInterval = time.Second
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.sent += int64(n)
+	if now := time.Now(); now.Sub(r.last) >= progressInterval || err == io.EOF {
+		r.last = now
+		r.progress(r.sent, r.total)
+	}
+	return n, err
+}
@@ -0,0 +1,76 @@
+package lsif
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestUploader(t *testing.T) {
+	var attempts int
+	var got string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if auth := r.Header.Get("Authorization"); auth != "token t" {
+			http.Error(w, "bad token "+auth, http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/.api/lsif/upload" || r.URL.Query().Get("repository") != "example.com/r" || r.URL.Query().Get("commit") != "c" {
+			http.Error(w, "bad URL "+r.URL.String(), http.StatusBadRequest)
+			return
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := ioutil.ReadAll(zr)
+		got = string(data)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"id":"42"}`)
+	}))
+	defer s.Close()
+
+	f, err := ioutil.TempFile("", "lsif-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	const dump = `{"id":1,"type":"vertex","label":"metaData"}` + "\n"
+	if _, err := f.WriteString(dump); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var progressed bool
+	u := &Uploader{
+		Endpoint:    s.URL,
+		AccessToken: "t",
+		Retries:     1,
+		RetryDelay:  1,
+		Progress:    func(sent, total int64) { progressed = sent == total },
+	}
+	id, err := u.Upload(context.Background(), f.Name(), UploadOptions{Repo: "example.com/r", CommitID: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "42" || got != dump || attempts != 2 || !progressed {
+		t.Errorf("got ID %q, dump %q, %d attempts, progressed %v", id, got, attempts, progressed)
+	}
+
+	// Permanent errors aren't retried.
+	attempts = 1
+	u.AccessToken = "bad"
+	if _, err := u.Upload(context.Background(), f.Name(), UploadOptions{Repo: "example.com/r", CommitID: "c"}); err == nil || attempts != 2 {
+		t.Errorf("got error %v after %d attempts, want an error after 1 attempt", err, attempts-1)
+	}
+}
@@ -0,0 +1,269 @@
+package makefile
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// UnitType is the source unit type of Makefiles. Each Makefile is its
+// own source unit, named by its path.
+const UnitType = "Makefile"
+
+// IsMakefile returns whether file is a Makefile (named "Makefile",
+// "makefile", or "GNUmakefile", or with a ".mk" or ".make" extension).
+func IsMakefile(file string) bool {
+	switch path.Base(file) {
+	case "Makefile", "makefile", "GNUmakefile":
+		return true
+	}
+	ext := path.Ext(file)
+	return ext == ".mk" || ext == ".make"
+}
+
+// isSpecialTarget returns whether name is a special built-in target
+// name (such as ".PHONY").
+func isSpecialTarget(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Trim(name[1:], "ABCDEFGHIJKLMNOPQRSTUVWXYZ_") == ""
+}
+
+// makePattern matches recursive make invocations in recipes.
+var makePattern = regexp.MustCompile(`(?:\$\(MAKE\)|\$\{MAKE\}|(?:^|[\s;&|(])make)(?:\s|$)`)
+
+// pathPattern matches relative paths (of scripts and programs that are
+// run, and of the files they operate on) in recipes.
+var pathPattern = regexp.MustCompile(`(?:^|[\s;&|()'"=])((?:\./|\.\./)?(?:[\w.-]+/)+[\w.-]+|\./[\w.-]+)`)
+
+// Graph returns the defs and refs in the Makefile with the given path
+// and contents.
+//
+// The Makefile's targets and variables are defs. Refs are emitted for
+// prerequisites (to targets, or to the files in the repository that
+// they name), for variable references, for targets of recursive make
+// invocations in recipes, and for the files in the repository that
+// recipes run. Included Makefiles are resolved too (and so are the
+// targets and variables defined in them). Paths are resolved relative
+// to the Makefile's directory.
+//
+// The stat and readFile funcs are called to determine whether files
+// exist and to read included Makefiles. If they are nil, no refs to
+// other files are emitted.
+func Graph(file string, data []byte, stat func(string) (os.FileInfo, error), readFile func(string) ([]byte, error)) (*graph.Output, error) {
+	f := Parse(data)
+	g := &grapher{file: file, dir: path.Dir(file), stat: stat, o: &graph.Output{}, defs: map[string]bool{}, included: map[string]string{}}
+	g.o.Defs = append(g.o.Defs, &graph.Def{
+		DefKey:   graph.DefKey{Path: "."},
+		Name:     path.Base(file),
+		Kind:     "makefile",
+		Exported: true,
+	})
+
+	for _, r := range f.Rules {
+		for _, t := range r.Targets {
+			if t.Literal() && !isSpecialTarget(t.Text) && !strings.Contains(t.Text, "%") {
+				g.def("target", t)
+			}
+		}
+	}
+	// Variables are defined by their first assignment; later
+	// assignments are refs.
+	for _, a := range f.Assignments {
+		if !g.def("var", a) {
+			g.ref("var/"+a.Text, a.Start, a.End)
+		}
+	}
+
+	for _, inc := range f.Includes {
+		p := g.resolve(inc)
+		if p == "" {
+			continue
+		}
+		if !IsMakefile(p) {
+			g.fileRef(p, inc)
+			continue
+		}
+		g.o.Refs = append(g.o.Refs, &graph.Ref{
+			DefUnitType: UnitType,
+			DefUnit:     p,
+			DefPath:     ".",
+			File:        g.file,
+			Start:       uint32(inc.Start),
+			End:         uint32(inc.End),
+		})
+		if readFile != nil {
+			if data, err := readFile(p); err == nil {
+				g.addIncluded(p, Parse(data))
+			}
+		}
+	}
+
+	for _, r := range f.Rules {
+		for _, w := range r.Prereqs {
+			g.prereqRef(w)
+		}
+		for _, line := range r.Recipe {
+			g.recipeRefs(line)
+		}
+	}
+	for _, ref := range f.Refs {
+		g.ref("var/"+ref.Text, ref.Start, ref.End)
+	}
+	return g.o, nil
+}
+
+type grapher struct {
+	file, dir string
+	stat      func(string) (os.FileInfo, error)
+	o         *graph.Output
+	defs      map[string]bool   // paths of emitted defs
+	included  map[string]string // def path -> included Makefile that defines it
+}
+
+// def emits a def of the given kind for w, unless one with the same
+// path was already emitted. It returns whether it emitted a def.
+func (g *grapher) def(kind string, w *Word) bool {
+	defPath := kind + "/" + w.Text
+	if g.defs[defPath] {
+		return false
+	}
+	g.defs[defPath] = true
+	g.o.Defs = append(g.o.Defs, &graph.Def{
+		DefKey:   graph.DefKey{Path: defPath},
+		Name:     w.Text,
+		Kind:     kind,
+		File:     g.file,
+		DefStart: uint32(w.Start),
+		DefEnd:   uint32(w.End),
+		Exported: true,
+	})
+	g.o.Refs = append(g.o.Refs, &graph.Ref{DefPath: defPath, Def: true, File: g.file, Start: uint32(w.Start), End: uint32(w.End)})
+	return true
+}
+
+// ref emits a ref to the def with the given path, in this Makefile or
+// in one that it includes, if there is one.
+func (g *grapher) ref(defPath string, start, end int) bool {
+	ref := &graph.Ref{DefPath: defPath, File: g.file, Start: uint32(start), End: uint32(end)}
+	if !g.defs[defPath] {
+		unit := g.included[defPath]
+		if unit == "" {
+			return false
+		}
+		ref.DefUnitType, ref.DefUnit = UnitType, unit
+	}
+	g.o.Refs = append(g.o.Refs, ref)
+	return true
+}
+
+// addIncluded records the targets and variables defined in the
+// included Makefile p (that aren't defined in this Makefile).
+func (g *grapher) addIncluded(p string, f *File) {
+	add := func(key string) {
+		if !g.defs[key] && g.included[key] == "" {
+			g.included[key] = p
+		}
+	}
+	for _, r := range f.Rules {
+		for _, t := range r.Targets {
+			if t.Literal() && !isSpecialTarget(t.Text) {
+				add("target/" + t.Text)
+			}
+		}
+	}
+	for _, a := range f.Assignments {
+		add("var/" + a.Text)
+	}
+}
+
+// resolve returns the path, relative to the repository root, of the
+// existing file that w (a literal path relative to the Makefile's
+// directory) refers to, or "".
+func (g *grapher) resolve(w *Word) string {
+	if g.stat == nil || !w.Literal() || path.IsAbs(w.Text) || strings.ContainsAny(w.Text, "*?[%") {
+		return ""
+	}
+	p := path.Join(g.dir, w.Text)
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return ""
+	}
+	if fi, err := g.stat(p); err != nil || fi.IsDir() {
+		return ""
+	}
+	return p
+}
+
+// fileRef emits a ref (at w) to the file in the repository with the
+// given path, and a def (of kind "file") for it.
+func (g *grapher) fileRef(p string, w *Word) {
+	defPath := "file/" + p
+	if !g.defs[defPath] {
+		g.defs[defPath] = true
+		g.o.Defs = append(g.o.Defs, &graph.Def{
+			DefKey:   graph.DefKey{Path: defPath},
+			Name:     p,
+			Kind:     "file",
+			File:     p,
+			Exported: true,
+		})
+	}
+	g.ref(defPath, w.Start, w.End)
+}
+
+// prereqRef emits a ref for the prerequisite w, to the target or file
+// that it names.
+func (g *grapher) prereqRef(w *Word) {
+	if !w.Literal() || g.ref("target/"+w.Text, w.Start, w.End) {
+		return
+	}
+	if p := g.resolve(w); p != "" {
+		g.fileRef(p, w)
+	}
+}
+
+// recipeRefs emits refs for the targets of recursive make invocations
+// (in the same directory) and the files in the repository that the
+// recipe line runs.
+func (g *grapher) recipeRefs(line *Word) {
+	text := line.Text
+	if loc := makePattern.FindStringIndex(text); loc != nil {
+		// Targets are the arguments up to the end of the command.
+		end := len(text)
+		if i := strings.IndexAny(text[loc[1]:], ";&|)"); i != -1 {
+			end = loc[1] + i
+		}
+		args := strings.Fields(text[loc[1]:end])
+		if !contains(args, "-C") && !contains(args, "-f") {
+			pos := loc[1]
+			for _, arg := range args {
+				i := strings.Index(text[pos:], arg)
+				start := pos + i
+				pos = start + len(arg)
+				if strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") || strings.Contains(arg, "$") {
+					continue
+				}
+				g.ref("target/"+arg, line.Start+start, line.Start+pos)
+			}
+		}
+	}
+	for _, m := range pathPattern.FindAllStringSubmatchIndex(text, -1) {
+		w := &Word{Text: text[m[2]:m[3]], Start: line.Start + m[2], End: line.Start + m[3]}
+		if g.defs["target/"+w.Text] {
+			continue // a generated file
+		}
+		if p := g.resolve(w); p != "" {
+			g.fileRef(p, w)
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, t := range list {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
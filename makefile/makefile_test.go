@@ -0,0 +1,159 @@
+package makefile
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func texts(words []*Word, data []byte) []string {
+	var s []string
+	for _, w := range words {
+		if got := string(data[w.Start:w.End]); got != w.Text {
+			s = append(s, w.Text+"@"+got)
+		} else {
+			s = append(s, w.Text)
+		}
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	data := []byte(`# comment: not a rule
+CC ?= gcc
+export CFLAGS := -O2 \
+	-Wall
+SRCS = main.c $(wildcard lib/*.c)
+OBJS = $(SRCS:.c=.o)
+define HELP
+usage: $(PROG)
+endef
+
+.PHONY: all clean
+all: $(PROG) docs | out # trailing comment
+	$(CC) $(CFLAGS) -o $@ $^
+
+$(PROG): $(OBJS) ; $(CC) -o $@ $(call link,$(OBJS))
+debug: CFLAGS += -g
+ifdef VERBOSE
+endif
+include config.mk
+`)
+	f := Parse(data)
+
+	if got, want := texts(f.Assignments, data), []string{"CC", "CFLAGS", "SRCS", "OBJS", "HELP"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got assignments %q, want %q", got, want)
+	}
+	want := []string{"SRCS", "PROG", "PROG", "CC", "CFLAGS", "PROG", "OBJS", "CC", "link", "OBJS", "VERBOSE"}
+	if got := texts(f.Refs, data); !reflect.DeepEqual(got, want) {
+		t.Errorf("got refs %q, want %q", got, want)
+	}
+	var rules []string
+	for _, r := range f.Rules {
+		rules = append(rules, joinTexts(r.Targets, data)+": "+joinTexts(r.Prereqs, data)+" ("+strconv.Itoa(len(r.Recipe))+")")
+	}
+	wantRules := []string{".PHONY: all clean (0)", "all: $(PROG) docs out (1)", "$(PROG): $(OBJS) (1)", "debug:  (0)"}
+	if !reflect.DeepEqual(rules, wantRules) {
+		t.Errorf("got rules %q, want %q", rules, wantRules)
+	}
+	if got, want := texts(f.Includes, data), []string{"config.mk"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got includes %q, want %q", got, want)
+	}
+}
+
+func joinTexts(words []*Word, data []byte) string {
+	var s []string
+	for _, w := range words {
+		s = append(s, string(data[w.Start:w.End]))
+	}
+	return strings.Join(s, " ")
+}
+
+type fileInfo struct{ os.FileInfo }
+
+func (fileInfo) IsDir() bool        { return false }
+func (fileInfo) ModTime() time.Time { return time.Time{} }
+
+func TestGraph(t *testing.T) {
+	files := map[string]string{
+		"app/common.mk":      "VERSION = 1.0\nlint:\n\tgolint ./...\n",
+		"app/main.go":        "",
+		"app/scripts/gen.sh": "",
+		"app/docs/README.md": "",
+	}
+	stat := func(p string) (os.FileInfo, error) {
+		if _, ok := files[p]; ok {
+			return fileInfo{}, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	readFile := func(p string) ([]byte, error) {
+		if data, ok := files[p]; ok {
+			return []byte(data), nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	data := []byte(`include common.mk
+BIN = app
+.PHONY: all test
+all: $(BIN) test lint
+$(BIN): main.go generated.go
+	go build -ldflags "-X main.version=$(VERSION)" -o $@
+generated.go:
+	./scripts/gen.sh docs/README.md > $@
+test:
+	$(MAKE) generated.go
+	$(MAKE) -C sub test
+`)
+	o, err := Graph("app/Makefile", data, stat, readFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var defs []string
+	for _, d := range o.Defs {
+		defs = append(defs, d.Kind+" "+d.Path)
+	}
+	sort.Strings(defs)
+	wantDefs := []string{
+		"file file/app/docs/README.md", "file file/app/main.go", "file file/app/scripts/gen.sh",
+		"makefile .",
+		"target target/all", "target target/generated.go", "target target/test",
+		"var var/BIN",
+	}
+	if !reflect.DeepEqual(defs, wantDefs) {
+		t.Errorf("got defs %q, want %q", defs, wantDefs)
+	}
+
+	refs := map[string][]string{}
+	for _, r := range o.Refs {
+		if r.Def {
+			continue
+		}
+		key := r.DefPath
+		if r.DefUnitType != "" {
+			key = r.DefUnit + " " + r.DefPath
+		}
+		refs[key] = append(refs[key], string(data[r.Start:r.End]))
+	}
+	want := map[string][]string{
+		"app/common.mk .":           {"common.mk"},
+		"app/common.mk target/lint": {"lint"},
+		"app/common.mk var/VERSION": {"VERSION"},
+		"target/all":                {"all"},
+		"target/test":               {"test", "test"},
+		"target/generated.go":       {"generated.go", "generated.go"},
+		"file/app/main.go":          {"main.go"},
+		"file/app/scripts/gen.sh":   {"./scripts/gen.sh"},
+		"file/app/docs/README.md":   {"docs/README.md"},
+		"var/BIN":                   {"BIN", "BIN"},
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("got refs %v, want %v", refs, want)
+	}
+}
@@ -0,0 +1,376 @@
+// Package makefile graphs Makefiles.
+package makefile
+
+import (
+	"bytes"
+	"strings"
+)
+
+// A Word is a word (such as a target or prerequisite name) at the
+// given byte offsets.
+type Word struct {
+	Text       string
+	Start, End int
+}
+
+// Literal returns whether the word contains no variable references or
+// function calls.
+func (w *Word) Literal() bool { return !strings.Contains(w.Text, "$") }
+
+// A Rule is a rule's targets and prerequisites (including order-only
+// prerequisites).
+type Rule struct {
+	Targets, Prereqs []*Word
+
+	// Recipe is the rule's recipe lines (without the leading tabs).
+	Recipe []*Word
+}
+
+// A File is the result of parsing a Makefile.
+type File struct {
+	Rules []*Rule
+
+	// Assignments are the names of the variables that are assigned
+	// (or defined with "define"), in order.
+	Assignments []*Word
+
+	// Refs are the names of the variables that are referenced, in
+	// order.
+	Refs []*Word
+
+	// Includes are the files that are included.
+	Includes []*Word
+}
+
+// functions are the names of GNU make's built-in functions.
+var functions = map[string]bool{
+	"abspath": true, "addprefix": true, "addsuffix": true, "and": true,
+	"basename": true, "call": true, "dir": true, "error": true, "eval": true,
+	"file": true, "filter": true, "filter-out": true, "findstring": true,
+	"firstword": true, "flavor": true, "foreach": true, "guile": true,
+	"if": true, "info": true, "join": true, "lastword": true, "notdir": true,
+	"or": true, "origin": true, "patsubst": true, "realpath": true,
+	"shell": true, "sort": true, "strip": true, "subst": true, "suffix": true,
+	"value": true, "warning": true, "wildcard": true, "word": true,
+	"wordlist": true, "words": true,
+}
+
+// line is a logical line (with continuations joined) of a Makefile.
+type line struct {
+	start, end int  // offsets of the line's text (excluding the newline)
+	recipe     bool // whether the line begins with a tab
+}
+
+// Parse parses the Makefile in data. Unrecognized lines are ignored.
+func Parse(data []byte) *File {
+	p := &parser{data: data, f: &File{}}
+	p.parse()
+	return p.f
+}
+
+type parser struct {
+	data []byte
+	f    *File
+}
+
+// lines splits data into logical lines. Continuation lines are part of
+// the logical line (the backslash-newlines are treated as spaces).
+func (p *parser) lines() []line {
+	var lines []line
+	for pos := 0; pos < len(p.data); {
+		l := line{start: pos, recipe: p.data[pos] == '\t'}
+		for pos < len(p.data) && !(p.data[pos] == '\n' && (pos == 0 || p.data[pos-1] != '\\')) {
+			pos++
+		}
+		l.end = pos
+		lines = append(lines, l)
+		pos++ // newline
+	}
+	return lines
+}
+
+func (p *parser) parse() {
+	var rule *Rule
+	define := false
+	for _, l := range p.lines() {
+		text := string(p.data[l.start:l.end])
+		if define {
+			if strings.TrimSpace(text) == "endef" {
+				define = false
+			} else {
+				p.expansions(l.start, l.end)
+			}
+			continue
+		}
+		if l.recipe && rule != nil {
+			start := l.start + 1
+			p.expansions(start, l.end)
+			rule.Recipe = append(rule.Recipe, &Word{Text: string(p.data[start:l.end]), Start: start, End: l.end})
+			continue
+		}
+
+		// Strip comments.
+		end := l.end
+		if i := commentStart(p.data[l.start:l.end]); i != -1 {
+			end = l.start + i
+		}
+		words := p.words(l.start, end)
+		if len(words) == 0 {
+			continue
+		}
+
+		// Directives.
+		switch kw := words[0].Text; kw {
+		case "include", "-include", "sinclude":
+			p.f.Includes = append(p.f.Includes, words[1:]...)
+			p.expansions(words[0].End, end)
+			continue
+		case "define":
+			define = true
+			if len(words) > 1 {
+				p.f.Assignments = append(p.f.Assignments, words[1])
+			}
+			continue
+		case "ifdef", "ifndef":
+			for _, w := range words[1:] {
+				if w.Literal() {
+					p.f.Refs = append(p.f.Refs, w)
+				}
+			}
+			p.expansions(words[0].End, end)
+			continue
+		case "ifeq", "ifneq", "else", "endif", "vpath", "unexport":
+			p.expansions(words[0].End, end)
+			continue
+		case "export", "override", "private":
+			if len(words) > 1 && !strings.ContainsAny(string(p.data[words[0].End:end]), "=:") {
+				// "export NAME..." affects existing variables.
+				for _, w := range words[1:] {
+					if w.Literal() {
+						p.f.Refs = append(p.f.Refs, w)
+					}
+				}
+				continue
+			}
+		}
+
+		if name, eq := p.assignment(l.start, end); name != nil {
+			p.f.Assignments = append(p.f.Assignments, name)
+			p.expansions(eq, end)
+			rule = nil
+			continue
+		}
+		if r := p.rule(l.start, end); r != nil {
+			rule = r
+			p.f.Rules = append(p.f.Rules, r)
+		}
+	}
+}
+
+// commentStart returns the offset of the "#" that begins a comment in
+// text, or -1.
+func commentStart(text []byte) int {
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '#':
+			return i
+		}
+	}
+	return -1
+}
+
+// words splits the region [start, end) into whitespace-separated words.
+// Variable references (which may contain spaces) are kept intact.
+func (p *parser) words(start, end int) []*Word {
+	var words []*Word
+	for pos := start; pos < end; {
+		c := p.data[pos]
+		if c == ' ' || c == '\t' || c == '\\' && pos+1 < end && p.data[pos+1] == '\n' || c == '\n' {
+			pos++
+			continue
+		}
+		w := &Word{Start: pos}
+		for pos < end && !isSpace(p.data[pos]) {
+			if p.data[pos] == '$' && pos+1 < end && (p.data[pos+1] == '(' || p.data[pos+1] == '{') {
+				pos = p.refEnd(pos+1, end)
+				continue
+			}
+			if p.data[pos] == '\\' && pos+1 < end && p.data[pos+1] == '\n' {
+				break
+			}
+			pos++
+		}
+		w.End = pos
+		w.Text = string(p.data[w.Start:w.End])
+		words = append(words, w)
+	}
+	return words
+}
+
+func isSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\n' }
+
+// refEnd returns the offset after the variable reference whose opening
+// paren or brace is at open.
+func (p *parser) refEnd(open, end int) int {
+	closer := byte(')')
+	if p.data[open] == '{' {
+		closer = '}'
+	}
+	depth := 0
+	for pos := open + 1; pos < end; pos++ {
+		switch p.data[pos] {
+		case p.data[open]:
+			depth++
+		case closer:
+			if depth == 0 {
+				return pos + 1
+			}
+			depth--
+		}
+	}
+	return end
+}
+
+// assignmentOps are the operators of variable assignments.
+var assignmentOps = []string{"::=", ":::=", ":=", "?=", "+=", "!=", "="}
+
+// assignment parses the variable assignment in the region [start,
+// end), if it is one. It returns the variable name and the offset of
+// the value.
+func (p *parser) assignment(start, end int) (*Word, int) {
+	pos := start
+	for pos < end {
+		c := p.data[pos]
+		if c == '$' && pos+1 < end && (p.data[pos+1] == '(' || p.data[pos+1] == '{') {
+			pos = p.refEnd(pos+1, end)
+			continue
+		}
+		rest := p.data[pos:end]
+		if c == ':' && !bytes.HasPrefix(rest, []byte(":=")) && !bytes.HasPrefix(rest, []byte("::=")) && !bytes.HasPrefix(rest, []byte(":::=")) {
+			return nil, 0 // a rule
+		}
+		if c == ';' {
+			return nil, 0
+		}
+		for _, op := range assignmentOps {
+			if bytes.HasPrefix(rest, []byte(op)) {
+				words := p.words(start, pos)
+				for len(words) > 1 && (words[0].Text == "export" || words[0].Text == "override" || words[0].Text == "private") {
+					words = words[1:]
+				}
+				if len(words) != 1 || !words[0].Literal() {
+					return nil, 0
+				}
+				return words[0], pos + len(op)
+			}
+		}
+		pos++
+	}
+	return nil, 0
+}
+
+// rule parses the rule line in the region [start, end), if it is one.
+func (p *parser) rule(start, end int) *Rule {
+	colon := -1
+	for pos := start; pos < end; pos++ {
+		c := p.data[pos]
+		if c == '$' && pos+1 < end && (p.data[pos+1] == '(' || p.data[pos+1] == '{') {
+			pos = p.refEnd(pos+1, end) - 1
+			continue
+		}
+		if c == ':' {
+			colon = pos
+			break
+		}
+	}
+	if colon == -1 {
+		p.expansions(start, end)
+		return nil
+	}
+	r := &Rule{Targets: p.words(start, colon)}
+	p.expansions(start, colon)
+
+	prereqStart := colon + 1
+	if prereqStart < end && p.data[prereqStart] == ':' {
+		prereqStart++ // double-colon rule
+	}
+	prereqEnd := end
+	if i := bytes.IndexByte(p.data[prereqStart:end], ';'); i != -1 {
+		prereqEnd = prereqStart + i
+	}
+	p.expansions(prereqStart, prereqEnd)
+	if recipeStart := prereqEnd + 1; recipeStart <= end {
+		p.expansions(recipeStart, end)
+		r.Recipe = append(r.Recipe, &Word{Text: string(p.data[recipeStart:end]), Start: recipeStart, End: end})
+	}
+	for _, w := range p.words(prereqStart, prereqEnd) {
+		if w.Text == "|" {
+			continue // order-only prerequisites follow
+		}
+		if strings.ContainsAny(w.Text, "=") {
+			// A target-specific variable assignment
+			// ("target: VAR = value").
+			r.Prereqs = nil
+			break
+		}
+		r.Prereqs = append(r.Prereqs, w)
+	}
+	return r
+}
+
+// expansions records the variables referenced in the region [start,
+// end).
+func (p *parser) expansions(start, end int) {
+	for pos := start; pos < end; pos++ {
+		if p.data[pos] != '$' || pos+1 >= end {
+			continue
+		}
+		switch c := p.data[pos+1]; c {
+		case '$':
+			pos++ // escaped "$$"
+		case '(', '{':
+			refEnd := p.refEnd(pos+1, end)
+			p.reference(pos+2, refEnd-1)
+			pos = refEnd - 1
+		}
+	}
+}
+
+// reference records the variables referenced in the contents
+// [start, end) of a variable reference or function call.
+func (p *parser) reference(start, end int) {
+	if start >= end {
+		return
+	}
+	nameEnd := start
+	for nameEnd < end && !isSpace(p.data[nameEnd]) && p.data[nameEnd] != ':' && p.data[nameEnd] != ',' && p.data[nameEnd] != '$' {
+		nameEnd++
+	}
+	name := string(p.data[start:nameEnd])
+	switch {
+	case nameEnd < end && isSpace(p.data[nameEnd]) && functions[name]:
+		argsStart := nameEnd + 1
+		if name == "call" {
+			// The first argument is the name of the variable to call.
+			args := p.words(argsStart, end)
+			if len(args) > 0 {
+				calleeEnd := args[0].Start + strings.IndexAny(args[0].Text+",", ",")
+				if callee := string(p.data[args[0].Start:calleeEnd]); callee != "" && !strings.Contains(callee, "$") {
+					p.f.Refs = append(p.f.Refs, &Word{Text: callee, Start: args[0].Start, End: calleeEnd})
+				}
+			}
+		}
+		p.expansions(argsStart, end)
+	case nameEnd == end || p.data[nameEnd] == ':':
+		// A variable reference (or substitution reference, such as
+		// "$(SRCS:.c=.o)").
+		if name != "" {
+			p.f.Refs = append(p.f.Refs, &Word{Text: name, Start: start, End: nameEnd})
+		}
+	default:
+		// A computed variable name (such as "$($(X)_FLAGS)").
+		p.expansions(start, end)
+	}
+}
@@ -0,0 +1,9 @@
+// Package metrics records counters and durations of srclib operations
+// (store queries, imports, build cache hits, and tool runs) and
+// exposes them in the Prometheus text exposition format.
+//
+// Metrics are recorded in the Default registry. Servers can expose
+// them by serving Handler (conventionally at /metrics), and
+// short-lived commands (such as `src make`) can write them to a file
+// with WriteFile when they exit.
+package metrics
@@ -0,0 +1,293 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Registry holds metric values. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	counters map[string]*series // counter name -> series
+	timers   map[string]*series // duration summary name -> series
+	help     map[string]string
+}
+
+// series holds the values of a metric, keyed on its formatted
+// labels.
+type series struct {
+	count map[string]uint64
+	sum   map[string]float64
+}
+
+func newSeries() *series {
+	return &series{count: map[string]uint64{}, sum: map[string]float64{}}
+}
+
+// NewRegistry creates a new, empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		counters: map[string]*series{},
+		timers:   map[string]*series{},
+		help:     map[string]string{},
+	}
+}
+
+// Default is the registry that the package-level functions use.
+var Default = NewRegistry()
+
+// Describe sets the help text for the named metric.
+func (r *Registry) Describe(name, help string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.help[name] = help
+}
+
+// Inc increments the named counter. Labels are alternating label
+// names and values (e.g., "op", "graph").
+func (r *Registry) Inc(name string, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seriesOf(r.counters, name).count[formatLabels(labels)]++
+}
+
+// Observe records a duration in the named summary (which has _count
+// and _sum series, in seconds).
+func (r *Registry) Observe(name string, d time.Duration, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := seriesOf(r.timers, name)
+	l := formatLabels(labels)
+	s.count[l]++
+	s.sum[l] += d.Seconds()
+}
+
+// Since records the duration since start in the named summary. It is
+// intended to be deferred: defer metrics.Since("x", time.Now()).
+func (r *Registry) Since(name string, start time.Time, labels ...string) {
+	r.Observe(name, time.Since(start), labels...)
+}
+
+// WritePrometheus writes all metrics to w in the Prometheus text
+// exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, name := range sortedKeys(r.counters) {
+		if err := r.writeHeader(w, name, "counter"); err != nil {
+			return err
+		}
+		s := r.counters[name]
+		for _, l := range sortedLabels(s.count) {
+			if _, err := fmt.Fprintf(w, "%s%s %d\n", name, l, s.count[l]); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range sortedKeys(r.timers) {
+		if err := r.writeHeader(w, name, "summary"); err != nil {
+			return err
+		}
+		s := r.timers[name]
+		for _, l := range sortedLabels(s.count) {
+			if _, err := fmt.Fprintf(w, "%s_count%s %d\n%s_sum%s %g\n", name, l, s.count[l], name, l, s.sum[l]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Registry) writeHeader(w io.Writer, name, typ string) error {
+	if help, present := r.help[name]; present {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n", name, help); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+	return err
+}
+
+// Handler returns an HTTP handler that serves the registry's metrics
+// in the Prometheus text exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := r.WritePrometheus(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// Merge adds the metrics in rd, in the format that WritePrometheus
+// writes, to r's metrics: counters' values and summaries' counts and
+// sums are added to r's, and help texts are kept unless r has its own.
+// It is used to combine the metrics of several processes (such as the
+// "src tool" subprocesses of "src make").
+func (r *Registry) Merge(rd io.Reader) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var name, typ string // of the current metric (from its TYPE line)
+	sc := bufio.NewScanner(rd)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "# HELP "):
+			f := strings.SplitN(strings.TrimPrefix(line, "# HELP "), " ", 2)
+			if _, present := r.help[f[0]]; !present && len(f) == 2 {
+				r.help[f[0]] = f[1]
+			}
+			continue
+		case strings.HasPrefix(line, "# TYPE "):
+			f := strings.Fields(strings.TrimPrefix(line, "# TYPE "))
+			if len(f) != 2 {
+				return fmt.Errorf("metrics: bad TYPE line %q", line)
+			}
+			name, typ = f[0], f[1]
+			continue
+		case strings.HasPrefix(line, "#"):
+			continue
+		}
+
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			return fmt.Errorf("metrics: bad sample %q", line)
+		}
+		metric, value, labels := line[:i], line[i+1:], ""
+		if j := strings.IndexByte(metric, '{'); j >= 0 {
+			metric, labels = metric[:j], metric[j:]
+		}
+		var err error
+		switch {
+		case typ == "counter" && metric == name:
+			var n uint64
+			n, err = strconv.ParseUint(value, 10, 64)
+			seriesOf(r.counters, name).count[labels] += n
+		case typ == "summary" && metric == name+"_count":
+			var n uint64
+			n, err = strconv.ParseUint(value, 10, 64)
+			seriesOf(r.timers, name).count[labels] += n
+		case typ == "summary" && metric == name+"_sum":
+			var v float64
+			v, err = strconv.ParseFloat(value, 64)
+			seriesOf(r.timers, name).sum[labels] += v
+		default:
+			return fmt.Errorf("metrics: unexpected sample %q", line)
+		}
+		if err != nil {
+			return fmt.Errorf("metrics: bad value in sample %q", line)
+		}
+	}
+	return sc.Err()
+}
+
+// MergeFile merges the metrics in the named file (see Merge).
+func (r *Registry) MergeFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return r.Merge(f)
+}
+
+// WriteFile writes the registry's metrics to the named file.
+func (r *Registry) WriteFile(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := r.WritePrometheus(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Describe sets the help text for the named metric in the Default
+// registry.
+func Describe(name, help string) { Default.Describe(name, help) }
+
+// Inc increments the named counter in the Default registry.
+func Inc(name string, labels ...string) { Default.Inc(name, labels...) }
+
+// Observe records a duration in the named summary in the Default
+// registry.
+func Observe(name string, d time.Duration, labels ...string) { Default.Observe(name, d, labels...) }
+
+// Since records the duration since start in the named summary in the
+// Default registry.
+func Since(name string, start time.Time, labels ...string) { Default.Since(name, start, labels...) }
+
+// Handler returns an HTTP handler that serves the Default registry's
+// metrics.
+func Handler() http.Handler { return Default.Handler() }
+
+// WriteFile writes the Default registry's metrics to the named file.
+func WriteFile(filename string) error { return Default.WriteFile(filename) }
+
+// MergeFile merges the metrics in the named file into the Default
+// registry.
+func MergeFile(filename string) error { return Default.MergeFile(filename) }
+
+// seriesOf returns the series of the named metric in m, adding it if
+// it doesn't exist.
+func seriesOf(m map[string]*series, name string) *series {
+	s, present := m[name]
+	if !present {
+		s = newSeries()
+		m[name] = s
+	}
+	return s
+}
+
+// formatLabels formats alternating label names and values as a
+// Prometheus label set (e.g., `{op="graph"}`).
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	if len(labels)%2 != 0 {
+		panic("metrics: odd number of label names and values")
+	}
+	parts := make([]string, 0, len(labels)/2)
+	for i := 0; i < len(labels); i += 2 {
+		parts = append(parts, labels[i]+`="`+labelValueEscaper.Replace(labels[i+1])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// labelValueEscaper escapes label values as the Prometheus text
+// format requires. Unlike Go string quoting, it escapes only
+// backslashes, double quotes, and newlines.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func sortedKeys(m map[string]*series) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedLabels(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_WritePrometheus(t *testing.T) {
+	r := NewRegistry()
+	r.Describe("srclib_tool_runs_total", "Tool runs.")
+	r.Inc("srclib_tool_runs_total", "op", "graph", "result", "ok")
+	r.Inc("srclib_tool_runs_total", "op", "graph", "result", "ok")
+	r.Inc("srclib_tool_runs_total", "op", "scan", "result", "run_error")
+	r.Observe("srclib_import_duration_seconds", 1500*time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := r.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP srclib_tool_runs_total Tool runs.
+# TYPE srclib_tool_runs_total counter
+srclib_tool_runs_total{op="graph",result="ok"} 2
+srclib_tool_runs_total{op="scan",result="run_error"} 1
+# TYPE srclib_import_duration_seconds summary
+srclib_import_duration_seconds_count 1
+srclib_import_duration_seconds_sum 1.5
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	tests := map[string]struct {
+		labels []string
+		want   string
+	}{
+		"none":      {want: ""},
+		"plain":     {labels: []string{"op", "graph", "result", "ok"}, want: `{op="graph",result="ok"}`},
+		"backslash": {labels: []string{"dir", `C:\src`}, want: `{dir="C:\\src"}`},
+		"quote":     {labels: []string{"unit", `a"b`}, want: `{unit="a\"b"}`},
+		"newline":   {labels: []string{"err", "a\nb"}, want: `{err="a\nb"}`},
+		"unicode":   {labels: []string{"unit", "é\t"}, want: "{unit=\"é\t\"}"},
+	}
+	for label, test := range tests {
+		if got := formatLabels(test.labels); got != test.want {
+			t.Errorf("%s: got %s, want %s", label, got, test.want)
+		}
+	}
+}
+
+func TestRegistry_Merge(t *testing.T) {
+	r1 := NewRegistry()
+	r1.Describe("srclib_tool_runs_total", "Tool runs.")
+	r1.Inc("srclib_tool_runs_total", "tool", "t graph", "result", "ok")
+	r1.Observe("srclib_make_duration_seconds", time.Second)
+
+	r2 := NewRegistry()
+	r2.Inc("srclib_tool_runs_total", "tool", "t graph", "result", "ok")
+	r2.Inc("srclib_tool_runs_total", "tool", "t graph", "result", "timeout")
+	r2.Observe("srclib_make_duration_seconds", 500*time.Millisecond)
+	var buf bytes.Buffer
+	if err := r2.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := r1.Merge(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	if err := r1.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP srclib_tool_runs_total Tool runs.
+# TYPE srclib_tool_runs_total counter
+srclib_tool_runs_total{tool="t graph",result="ok"} 2
+srclib_tool_runs_total{tool="t graph",result="timeout"} 1
+# TYPE srclib_make_duration_seconds summary
+srclib_make_duration_seconds_count 2
+srclib_make_duration_seconds_sum 1.5
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	if err := r1.Merge(strings.NewReader("srclib_x 1\n")); err == nil {
+		t.Error("got no error for sample without TYPE line")
+	}
+}
@@ -0,0 +1,250 @@
+package notebook
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// A jsonValue is a parsed JSON value. Unlike values decoded by
+// encoding/json, strings record the offset in the JSON text of each
+// byte of their decoded value, so that positions in notebook cell
+// sources can be mapped back to positions in the notebook file.
+type jsonValue struct {
+	kind byte // '{', '[', '"', or 0 (for numbers, booleans, and null)
+
+	obj map[string]*jsonValue
+	arr []*jsonValue
+
+	str []byte
+	// start[i] and end[i] are the offsets in the JSON text of the start
+	// and end of the (possibly escaped) character that produced str[i].
+	start, end []int
+}
+
+type jsonParser struct {
+	data []byte
+	pos  int
+}
+
+func parseJSON(data []byte) (*jsonValue, error) {
+	p := &jsonParser{data: data}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.data) {
+		return nil, p.errorf("unexpected data after top-level value")
+	}
+	return v, nil
+}
+
+func (p *jsonParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid JSON at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *jsonParser) value() (*jsonValue, error) {
+	p.skipSpace()
+	if p.pos == len(p.data) {
+		return nil, p.errorf("unexpected end of data")
+	}
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		return p.object()
+	case c == '[':
+		return p.array()
+	case c == '"':
+		return p.string()
+	case c == '-' || (c >= '0' && c <= '9'):
+		for p.pos < len(p.data) && isNumberByte(p.data[p.pos]) {
+			p.pos++
+		}
+		return &jsonValue{}, nil
+	default:
+		for _, lit := range []string{"true", "false", "null"} {
+			if len(p.data)-p.pos >= len(lit) && string(p.data[p.pos:p.pos+len(lit)]) == lit {
+				p.pos += len(lit)
+				return &jsonValue{}, nil
+			}
+		}
+		return nil, p.errorf("unexpected character %q", c)
+	}
+}
+
+func isNumberByte(c byte) bool {
+	return (c >= '0' && c <= '9') || c == '-' || c == '+' || c == '.' || c == 'e' || c == 'E'
+}
+
+func (p *jsonParser) object() (*jsonValue, error) {
+	v := &jsonValue{kind: '{', obj: map[string]*jsonValue{}}
+	p.pos++ // '{'
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == '}' {
+		p.pos++
+		return v, nil
+	}
+	for {
+		p.skipSpace()
+		if p.pos == len(p.data) || p.data[p.pos] != '"' {
+			return nil, p.errorf("expected object key")
+		}
+		key, err := p.string()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos == len(p.data) || p.data[p.pos] != ':' {
+			return nil, p.errorf("expected ':'")
+		}
+		p.pos++
+		elem, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		v.obj[string(key.str)] = elem
+		p.skipSpace()
+		if p.pos == len(p.data) {
+			return nil, p.errorf("unexpected end of data in object")
+		}
+		p.pos++
+		switch p.data[p.pos-1] {
+		case ',':
+		case '}':
+			return v, nil
+		default:
+			p.pos--
+			return nil, p.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+func (p *jsonParser) array() (*jsonValue, error) {
+	v := &jsonValue{kind: '['}
+	p.pos++ // '['
+	p.skipSpace()
+	if p.pos < len(p.data) && p.data[p.pos] == ']' {
+		p.pos++
+		return v, nil
+	}
+	for {
+		elem, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		v.arr = append(v.arr, elem)
+		p.skipSpace()
+		if p.pos == len(p.data) {
+			return nil, p.errorf("unexpected end of data in array")
+		}
+		p.pos++
+		switch p.data[p.pos-1] {
+		case ',':
+		case ']':
+			return v, nil
+		default:
+			p.pos--
+			return nil, p.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+var errBadEscape = errors.New("invalid escape sequence")
+
+func (p *jsonParser) string() (*jsonValue, error) {
+	v := &jsonValue{kind: '"'}
+	p.pos++ // '"'
+	for {
+		if p.pos == len(p.data) {
+			return nil, p.errorf("unterminated string")
+		}
+		start := p.pos
+		c := p.data[p.pos]
+		switch {
+		case c == '"':
+			p.pos++
+			return v, nil
+		case c < 0x20:
+			return nil, p.errorf("control character in string")
+		case c != '\\':
+			p.pos++
+			v.add(start, p.pos, c)
+			continue
+		}
+
+		// Escape sequence.
+		if p.pos+1 == len(p.data) {
+			return nil, p.errorf("unterminated string")
+		}
+		p.pos += 2
+		var r rune
+		switch e := p.data[p.pos-1]; e {
+		case '"', '\\', '/':
+			r = rune(e)
+		case 'b':
+			r = '\b'
+		case 'f':
+			r = '\f'
+		case 'n':
+			r = '\n'
+		case 'r':
+			r = '\r'
+		case 't':
+			r = '\t'
+		case 'u':
+			var err error
+			if r, err = p.hex4(); err != nil {
+				return nil, err
+			}
+			if utf16.IsSurrogate(r) && p.pos+6 <= len(p.data) && p.data[p.pos] == '\\' && p.data[p.pos+1] == 'u' {
+				save := p.pos
+				p.pos += 2
+				r2, err := p.hex4()
+				if d := utf16.DecodeRune(r, r2); err == nil && d != utf8.RuneError {
+					r = d
+				} else {
+					p.pos = save
+					r = utf8.RuneError
+				}
+			}
+		default:
+			return nil, p.errorf("%s", errBadEscape)
+		}
+		var buf [utf8.UTFMax]byte
+		n := utf8.EncodeRune(buf[:], r)
+		for _, b := range buf[:n] {
+			v.add(start, p.pos, b)
+		}
+	}
+}
+
+func (p *jsonParser) hex4() (rune, error) {
+	if p.pos+4 > len(p.data) {
+		return 0, p.errorf("%s", errBadEscape)
+	}
+	n, err := strconv.ParseUint(string(p.data[p.pos:p.pos+4]), 16, 16)
+	if err != nil {
+		return 0, p.errorf("%s", errBadEscape)
+	}
+	p.pos += 4
+	return rune(n), nil
+}
+
+func (v *jsonValue) add(start, end int, b byte) {
+	v.str = append(v.str, b)
+	v.start = append(v.start, start)
+	v.end = append(v.end, end)
+}
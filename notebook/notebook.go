@@ -0,0 +1,211 @@
+// Package notebook extracts the code cells of Jupyter (IPython)
+// notebooks (.ipynb files) into virtual source files that language
+// toolchains can graph, and maps positions in the virtual files back
+// to positions in the notebooks.
+//
+// The virtual file for a notebook is named by appending the
+// extension of the notebook's language (see VirtualFilename). It
+// contains the sources of the notebook's code cells, in order,
+// separated by newlines. The "notebook" post-processor (see
+// PostProcess) rewrites the spans of defs, refs, docs, and anns in
+// virtual files to spans in their notebooks.
+package notebook
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// Ext is the file extension of notebooks.
+const Ext = ".ipynb"
+
+// languageExts maps notebook languages (as specified in their
+// kernelspec or language_info metadata) to the extensions of their
+// virtual files.
+var languageExts = map[string]string{
+	"python":     ".py",
+	"python2":    ".py",
+	"python3":    ".py",
+	"r":          ".r",
+	"julia":      ".jl",
+	"scala":      ".scala",
+	"javascript": ".js",
+	"typescript": ".ts",
+	"ruby":       ".rb",
+	"go":         ".go",
+}
+
+// DefaultLanguage is the language of notebooks whose metadata doesn't
+// specify one.
+const DefaultLanguage = "python"
+
+// A Notebook is a parsed notebook.
+type Notebook struct {
+	// Language is the (lowercased) language of the notebook's code
+	// cells.
+	Language string
+
+	// Cells are the notebook's code cells (other cells are omitted).
+	Cells []*Cell
+
+	// code is the concatenated source of the code cells.
+	code []byte
+
+	// start[i] and end[i] are the offsets in the notebook file of the
+	// start and end of the JSON-encoded character that produced
+	// code[i].
+	start, end []int
+}
+
+// A Cell is a code cell in a notebook.
+type Cell struct {
+	// Index is the index of the cell in the notebook (counting all
+	// cells, not just code cells).
+	Index int
+
+	// Source is the cell's source code.
+	Source []byte
+
+	// CodeStart is the offset of the cell's source in the notebook's
+	// virtual file.
+	CodeStart int
+}
+
+// Parse parses the notebook file data (in nbformat 4 or later).
+func Parse(data []byte) (*Notebook, error) {
+	root, err := parseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	if root.kind != '{' {
+		return nil, errors.New("notebook is not a JSON object")
+	}
+	cells := root.obj["cells"]
+	if cells == nil || cells.kind != '[' {
+		return nil, errors.New("notebook has no cells list (only nbformat 4 and later are supported)")
+	}
+
+	nb := &Notebook{Language: language(root)}
+	for i, c := range cells.arr {
+		if c.kind != '{' {
+			return nil, errors.New("notebook cell is not a JSON object")
+		}
+		if t := c.obj["cell_type"]; t == nil || t.kind != '"' || string(t.str) != "code" {
+			continue
+		}
+
+		// The source is either a string or a list of strings (lines)
+		// to concatenate.
+		var parts []*jsonValue
+		switch src := c.obj["source"]; {
+		case src == nil:
+		case src.kind == '"':
+			parts = []*jsonValue{src}
+		case src.kind == '[':
+			parts = src.arr
+		default:
+			return nil, errors.New("notebook cell source is not a string or list")
+		}
+
+		cell := &Cell{Index: i, CodeStart: len(nb.code)}
+		sepOffset := len(data) // where the separator after the cell maps to
+		for _, part := range parts {
+			if part.kind != '"' {
+				return nil, errors.New("notebook cell source line is not a string")
+			}
+			cell.Source = append(cell.Source, part.str...)
+			nb.code = append(nb.code, part.str...)
+			nb.start = append(nb.start, part.start...)
+			nb.end = append(nb.end, part.end...)
+			if len(part.end) > 0 {
+				sepOffset = part.end[len(part.end)-1]
+			}
+		}
+		if len(nb.code) > 0 && nb.code[len(nb.code)-1] != '\n' {
+			nb.code = append(nb.code, '\n')
+			nb.start = append(nb.start, sepOffset)
+			nb.end = append(nb.end, sepOffset)
+		}
+		nb.Cells = append(nb.Cells, cell)
+	}
+	return nb, nil
+}
+
+// language returns the language of the notebook whose top-level JSON
+// object is root.
+func language(root *jsonValue) string {
+	if md := root.obj["metadata"]; md != nil && md.kind == '{' {
+		for _, k := range [][2]string{{"kernelspec", "language"}, {"language_info", "name"}} {
+			if o := md.obj[k[0]]; o != nil && o.kind == '{' {
+				if v := o.obj[k[1]]; v != nil && v.kind == '"' && len(v.str) > 0 {
+					return strings.ToLower(string(v.str))
+				}
+			}
+		}
+	}
+	return DefaultLanguage
+}
+
+// Code returns the concatenated source of the notebook's code cells
+// (i.e., the contents of its virtual file).
+func (nb *Notebook) Code() []byte { return nb.code }
+
+// Span returns the span in the notebook file that corresponds to the
+// span [start, end) in its virtual file. Offsets past the end of the
+// virtual file are clamped to it.
+func (nb *Notebook) Span(start, end uint32) (uint32, uint32) {
+	if len(nb.code) == 0 {
+		return 0, 0
+	}
+	last := uint32(len(nb.code) - 1)
+	if start > last {
+		return uint32(nb.end[last]), uint32(nb.end[last])
+	}
+	s := uint32(nb.start[start])
+	if end <= start {
+		return s, s
+	}
+	if end-1 > last {
+		end = last + 1
+	}
+	return s, uint32(nb.end[end-1])
+}
+
+// Cell returns the code cell that contains the offset off in the
+// virtual file, and the offset relative to the start of the cell's
+// source. If off is not in any cell's source (e.g., it is the newline
+// added after a cell), it returns a nil cell.
+func (nb *Notebook) Cell(off int) (*Cell, int) {
+	for i := len(nb.Cells) - 1; i >= 0; i-- {
+		c := nb.Cells[i]
+		if off >= c.CodeStart {
+			if off-c.CodeStart < len(c.Source) {
+				return c, off - c.CodeStart
+			}
+			return nil, 0
+		}
+	}
+	return nil, 0
+}
+
+// VirtualFilename returns the name of the virtual file for the
+// notebook file in the given language.
+func VirtualFilename(file, language string) string {
+	ext, present := languageExts[strings.ToLower(language)]
+	if !present {
+		ext = ".txt"
+	}
+	return file + ext
+}
+
+// NotebookFilename returns the name of the notebook file whose
+// virtual file is file, or the empty string if file is not a virtual
+// notebook file.
+func NotebookFilename(file string) string {
+	nbFile := strings.TrimSuffix(file, path.Ext(file))
+	if nbFile == file || !strings.HasSuffix(nbFile, Ext) {
+		return ""
+	}
+	return nbFile
+}
@@ -0,0 +1,101 @@
+package notebook
+
+import (
+	"bytes"
+	"testing"
+)
+
+const testNotebook = `{
+ "cells": [
+  {"cell_type": "markdown", "metadata": {}, "source": ["# Title\n"]},
+  {
+   "cell_type": "code",
+   "execution_count": 1,
+   "metadata": {},
+   "outputs": [],
+   "source": [
+    "import os\n",
+    "x = \"café\"\n",
+    "print(x)"
+   ]
+  },
+  {"cell_type": "code", "metadata": {}, "outputs": [], "source": "def f():\n\treturn x"}
+ ],
+ "metadata": {"kernelspec": {"language": "Python", "name": "python3"}},
+ "nbformat": 4,
+ "nbformat_minor": 2
+}`
+
+func TestParse(t *testing.T) {
+	nb, err := Parse([]byte(testNotebook))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nb.Language != "python" {
+		t.Errorf("got Language %q, want python", nb.Language)
+	}
+	if len(nb.Cells) != 2 || nb.Cells[0].Index != 1 || nb.Cells[1].Index != 2 {
+		t.Fatalf("got cells %+v, want cells 1 and 2", nb.Cells)
+	}
+
+	wantCode := "import os\nx = \"café\"\nprint(x)\ndef f():\n\treturn x\n"
+	if string(nb.Code()) != wantCode {
+		t.Errorf("got code %q, want %q", nb.Code(), wantCode)
+	}
+	if nb.Cells[1].CodeStart != bytes.Index(nb.Code(), []byte("def")) {
+		t.Errorf("got second cell CodeStart %d, want start of def", nb.Cells[1].CodeStart)
+	}
+}
+
+func TestNotebook_Span(t *testing.T) {
+	data := []byte(testNotebook)
+	nb, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := nb.Code()
+
+	tests := []struct {
+		code string // text in the virtual file
+		want string // text that it maps to in the notebook file
+	}{
+		{"os", "os"},
+		{"print", "print"},
+		{"\treturn x", `\treturn x`},
+		{"café", `café`},
+		{"\"café\"", `\"café\"`},
+	}
+	for _, test := range tests {
+		i := bytes.Index(code, []byte(test.code))
+		if i == -1 {
+			t.Fatalf("%q not found in code", test.code)
+		}
+		start, end := nb.Span(uint32(i), uint32(i+len(test.code)))
+		if got := string(data[start:end]); got != test.want {
+			t.Errorf("%q: got notebook text %q, want %q", test.code, got, test.want)
+		}
+	}
+
+	if c, off := nb.Cell(bytes.Index(code, []byte("return"))); c == nil || c.Index != 2 || off != len("def f():\n\t") {
+		t.Errorf("got cell %v offset %d, want cell 2", c, off)
+	}
+	if c, _ := nb.Cell(bytes.Index(code, []byte("def")) - 1); c != nil {
+		t.Errorf("got cell %v for separator, want none", c)
+	}
+}
+
+func TestNotebookFilename(t *testing.T) {
+	tests := map[string]string{
+		"a/b.ipynb.py": "a/b.ipynb",
+		"b.ipynb":      "",
+		"b.py":         "",
+	}
+	for file, want := range tests {
+		if got := NotebookFilename(file); got != want {
+			t.Errorf("%s: got %q, want %q", file, got, want)
+		}
+	}
+	if got := VirtualFilename("a.ipynb", "Python"); got != "a.ipynb.py" {
+		t.Errorf("got virtual filename %q", got)
+	}
+}
@@ -0,0 +1,86 @@
+package notebook
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+)
+
+func init() {
+	grapher.RegisterPostProcessor("notebook", grapher.PostProcessorFunc(PostProcess))
+}
+
+// PostProcess is a grapher.PostProcessor (registered as "notebook")
+// that rewrites the files and spans of defs, refs, docs, and anns in
+// virtual notebook files to the corresponding notebook files and
+// spans. Notebook files are read relative to the current directory,
+// which is the repository root when graph output is processed.
+func PostProcess(ctx context.Context, unitType, unit string, o *graph.Output) error {
+	nbs := map[string]*Notebook{}
+	notebook := func(file string) (string, *Notebook, error) {
+		nbFile := NotebookFilename(file)
+		if nbFile == "" {
+			return "", nil, nil
+		}
+		nb, present := nbs[nbFile]
+		if !present {
+			data, err := ioutil.ReadFile(filepath.FromSlash(nbFile))
+			if err != nil {
+				return "", nil, err
+			}
+			if nb, err = Parse(data); err != nil {
+				return "", nil, err
+			}
+			if VirtualFilename(nbFile, nb.Language) != file {
+				nb = nil // a file that merely looks like a virtual file
+			}
+			nbs[nbFile] = nb
+		}
+		return nbFile, nb, nil
+	}
+
+	for _, def := range o.Defs {
+		nbFile, nb, err := notebook(def.File)
+		if err != nil {
+			return err
+		}
+		if nb != nil {
+			def.File = nbFile
+			def.DefStart, def.DefEnd = nb.Span(def.DefStart, def.DefEnd)
+		}
+	}
+	for _, ref := range o.Refs {
+		nbFile, nb, err := notebook(ref.File)
+		if err != nil {
+			return err
+		}
+		if nb != nil {
+			ref.File = nbFile
+			ref.Start, ref.End = nb.Span(ref.Start, ref.End)
+		}
+	}
+	for _, doc := range o.Docs {
+		nbFile, nb, err := notebook(doc.File)
+		if err != nil {
+			return err
+		}
+		if nb != nil {
+			doc.File = nbFile
+			doc.Start, doc.End = nb.Span(doc.Start, doc.End)
+		}
+	}
+	for _, ann := range o.Anns {
+		nbFile, nb, err := notebook(ann.File)
+		if err != nil {
+			return err
+		}
+		if nb != nil {
+			ann.File = nbFile
+			ann.Start, ann.End = nb.Span(ann.Start, ann.End)
+		}
+	}
+	return nil
+}
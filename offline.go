@@ -0,0 +1,73 @@
+package srclib
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// OfflineEnv is the environment variable that enables offline mode. It
+// is set by `src --offline`, so that offline mode is inherited by the
+// src and toolchain processes that src runs. Toolchains should check
+// it and avoid network access (such as fetching dependencies) when it
+// is set, using only local caches or failing with an error.
+const OfflineEnv = "SRCLIB_OFFLINE"
+
+// Offline is whether offline mode is enabled. In offline mode, all
+// network access is forbidden: operations that need it use local
+// caches or fail with an *OfflineError. It is initialized from the
+// SRCLIB_OFFLINE environment variable.
+var Offline, _ = strconv.ParseBool(os.Getenv(OfflineEnv))
+
+// An OfflineError is returned by operations that need network access
+// in offline mode.
+type OfflineError struct {
+	Op string // the operation that needs network access, such as "downloading toolchain x"
+}
+
+func (e *OfflineError) Error() string {
+	return e.Op + " requires network access, which is disabled in offline mode (--offline or " + OfflineEnv + ")"
+}
+
+// CheckOnline returns an *OfflineError for op if offline mode is
+// enabled, and nil otherwise.
+func CheckOnline(op string) error {
+	if Offline {
+		return &OfflineError{Op: op}
+	}
+	return nil
+}
+
+// OfflineTransport is an HTTP transport that, in offline mode, fails
+// requests to hosts other than the local host (with an
+// *OfflineError). In online mode, it is the same as its underlying
+// Transport.
+type OfflineTransport struct {
+	Transport http.RoundTripper // underlying transport (or http.DefaultTransport if nil)
+}
+
+func (t *OfflineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if Offline && !IsLocalHost(req.URL.Hostname()) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, &OfflineError{Op: req.Method + " " + req.URL.Scheme + "://" + req.URL.Host}
+	}
+	u := t.Transport
+	if u == nil {
+		u = http.DefaultTransport
+	}
+	return u.RoundTrip(req)
+}
+
+// IsLocalHost returns whether host (without a port) is a loopback
+// address or "localhost".
+func IsLocalHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,89 @@
+package srclib
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// recordingTransport records the requests that it is asked to send.
+type recordingTransport struct{ reqs []*http.Request }
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.reqs = append(t.reqs, req)
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+}
+
+// closeRecorder is a request body that records whether it was closed.
+type closeRecorder struct {
+	*strings.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error { c.closed = true; return nil }
+
+func TestCheckOnline(t *testing.T) {
+	defer func(offline bool) { Offline = offline }(Offline)
+
+	Offline = false
+	if err := CheckOnline("fetching x"); err != nil {
+		t.Errorf("online: got error %v, want nil", err)
+	}
+
+	Offline = true
+	err := CheckOnline("fetching x")
+	if e, ok := err.(*OfflineError); !ok || e.Op != "fetching x" {
+		t.Errorf("offline: got error %v, want *OfflineError for the op", err)
+	}
+}
+
+func TestOfflineTransport(t *testing.T) {
+	defer func(offline bool) { Offline = offline }(Offline)
+
+	tests := map[string]struct {
+		offline bool
+		url     string
+		wantErr bool
+	}{
+		"online remote":        {url: "https://example.com/x"},
+		"online local":         {url: "http://localhost:3080/x"},
+		"offline localhost":    {offline: true, url: "http://localhost:3080/x"},
+		"offline ipv4":         {offline: true, url: "http://127.0.0.1:3080/x"},
+		"offline ipv6":         {offline: true, url: "http://[::1]:3080/x"},
+		"offline remote":       {offline: true, url: "https://example.com/x", wantErr: true},
+		"offline remote ip":    {offline: true, url: "http://10.0.0.1/x", wantErr: true},
+		"offline localhost as": {offline: true, url: "http://localhost.example.com/x", wantErr: true},
+	}
+	for label, test := range tests {
+		Offline = test.offline
+		rt := &recordingTransport{}
+		body := &closeRecorder{Reader: strings.NewReader("b")}
+		req, err := http.NewRequest("POST", test.url, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := (&OfflineTransport{Transport: rt}).RoundTrip(req)
+		if test.wantErr {
+			if _, ok := err.(*OfflineError); !ok {
+				t.Errorf("%s: got error %v, want *OfflineError", label, err)
+			}
+			if len(rt.reqs) != 0 {
+				t.Errorf("%s: request was sent in offline mode", label)
+			}
+			if !body.closed {
+				t.Errorf("%s: request body was not closed", label)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		resp.Body.Close()
+		if len(rt.reqs) != 1 || rt.reqs[0] != req {
+			t.Errorf("%s: got %d requests sent, want the request", label, len(rt.reqs))
+		}
+	}
+}
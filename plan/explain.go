@@ -0,0 +1,109 @@
+package plan
+
+import (
+	"fmt"
+	"os"
+
+	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// An Explanation describes what a build plan will do for an operation
+// on a source unit, and why.
+type Explanation struct {
+	UnitType string
+	Unit     string
+	Op       string
+
+	// Tool is the tool that performs Op on the source unit (nil if no
+	// tool was found).
+	Tool *srclib.ToolRef `json:",omitempty"`
+
+	// Reason describes why Tool was selected, or why no tool was
+	// selected.
+	Reason string
+
+	// Target is the build data file that the plan produces (empty if
+	// the plan has no rule for the operation on the source unit).
+	Target string `json:",omitempty"`
+
+	// CachedFrom is the build data file of a previous commit that is
+	// copied to Target (because none of the source unit's files
+	// changed since that commit), if any.
+	CachedFrom string `json:",omitempty"`
+
+	// UpToDate is whether Target already exists and is newer than all
+	// of its prereqs, so it will not be rebuilt.
+	UpToDate bool
+}
+
+// Explain describes, for each source unit in c and each operation that
+// rule makers are registered for, which tool will be run and why, and
+// which existing build data will be reused. If mf is non-nil, it must
+// be the plan created for c (by CreateMakefile); otherwise only tool
+// selection is explained. Nothing is executed.
+//
+// Rules are matched to operations by their Op method (rules without
+// SourceUnit and Op methods are not explained).
+func Explain(c *config.Tree, mf *makex.Makefile) []*Explanation {
+	type ruleKey struct {
+		u  unit.ID2
+		op string
+	}
+	rules := map[ruleKey]makex.Rule{}
+	if mf != nil {
+		for _, rule := range mf.Rules {
+			if r, ok := rule.(interface {
+				SourceUnit() *unit.SourceUnit
+				Op() string
+			}); ok {
+				rules[ruleKey{r.SourceUnit().ID2(), r.Op()}] = rule
+			}
+		}
+	}
+
+	var exps []*Explanation
+	for _, u := range c.SourceUnits {
+		for _, op := range ruleMakerNames {
+			e := &Explanation{UnitType: u.Type, Unit: u.Name, Op: op}
+			if t := u.Ops[op]; t != nil {
+				e.Tool = t
+				e.Reason = "specified in the source unit's Ops (by the Srcfile or scanner)"
+			} else if t, err := toolchain.ChooseTool(op, u.Type); err != nil {
+				e.Reason = err.Error()
+			} else {
+				e.Tool = t
+				e.Reason = fmt.Sprintf("the only installed tool that performs %q on %q source units", op, u.Type)
+			}
+
+			if rule, present := rules[ruleKey{u.ID2(), op}]; present {
+				e.Target = rule.Target()
+				if r, ok := rule.(*cachedRule); ok {
+					e.CachedFrom = r.cachedPath
+				}
+				e.UpToDate = TargetUpToDate(rule)
+			}
+			exps = append(exps, e)
+		}
+	}
+	return exps
+}
+
+// TargetUpToDate returns whether rule's target exists and is newer
+// than all of its prereqs (so that it will not be rebuilt).
+func TargetUpToDate(rule makex.Rule) bool {
+	fi, err := os.Stat(rule.Target())
+	if err != nil {
+		return false
+	}
+	for _, p := range rule.Prereqs() {
+		pfi, err := os.Stat(p)
+		if err != nil || pfi.ModTime().After(fi.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
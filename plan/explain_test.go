@@ -0,0 +1,46 @@
+package plan_test
+
+import (
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestExplain(t *testing.T) {
+	c := &config.Tree{
+		SourceUnits: []*unit.SourceUnit{
+			{
+				Name: "n",
+				Type: "t",
+				Ops: map[string]*srclib.ToolRef{
+					"graph":      {Toolchain: "tc", Subcmd: "g"},
+					"depresolve": {Toolchain: "tc", Subcmd: "d"},
+				},
+			},
+		},
+	}
+
+	mf, err := plan.CreateMakefile("testdata", nil, "", c, plan.Options{NoCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exps := plan.Explain(c, mf)
+	if len(exps) != 2 {
+		t.Fatalf("got %d explanations, want 2", len(exps))
+	}
+	for _, e := range exps {
+		if e.Tool == nil || e.Tool.Toolchain != "tc" {
+			t.Errorf("%s: got tool %v, want toolchain tc", e.Op, e.Tool)
+		}
+		if want := "testdata/n/t." + e.Op + ".json"; e.Target != want {
+			t.Errorf("%s: got target %q, want %q", e.Op, e.Target, want)
+		}
+		if e.CachedFrom != "" || e.UpToDate {
+			t.Errorf("%s: got cached from %q (up to date: %v), want neither", e.Op, e.CachedFrom, e.UpToDate)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package plan
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os/exec"
@@ -20,6 +21,21 @@ type Options struct {
 	// When NoCache is true, all files are rebuilt instead of only
 	// the ones associated with changed source units.
 	NoCache bool
+
+	// When VerifyDeterminism is true, each source unit is graphed
+	// twice, and the build fails if the normalized outputs differ.
+	VerifyDeterminism bool
+
+	// ReuseCommitID, if set, is the commit whose build data is reused
+	// for unchanged source units (unless NoCache is true). Otherwise,
+	// the build data of the latest of the last few commits that have
+	// build data is reused.
+	ReuseCommitID string
+
+	// When Strict is true, normalizing a source unit's graph output
+	// fails if a file that it refers to is missing or doesn't match
+	// its offsets (see grapher.NormalizeOptions.Strict).
+	Strict bool
 }
 
 type RuleMaker func(c *config.Tree, dataDir string, existing []makex.Rule, opt Options) ([]makex.Rule, error)
@@ -48,6 +64,7 @@ func RegisterRuleMaker(name string, r RuleMaker) {
 // cachedRule is a rule creates the target as a copy of cachedPath. It is
 // meant for files that haven't changed between commits.
 type cachedRule struct {
+	op         string
 	cachedPath string
 	target     string
 	unit       *unit.SourceUnit
@@ -75,6 +92,12 @@ func (r *cachedRule) SourceUnit() *unit.SourceUnit {
 	return r.unit
 }
 
+// Op returns the operation (the name of the rule maker) of the rule
+// that r replaced.
+func (r *cachedRule) Op() string {
+	return r.op
+}
+
 // listLatestCommitIDs lists the latest commit ids.
 func listLatestCommitIDs(vcsType string) ([]string, error) {
 	if vcsType != "git" {
@@ -85,17 +108,37 @@ func listLatestCommitIDs(vcsType string) ([]string, error) {
 	return strings.Split(string(bytes.TrimSpace(out)), "\n"), err
 }
 
-// filesChangedFromRevToIndex returns a list of the files that have
+// FilesChangedFromRevToIndex returns a list of the files that have
 // changed from fromRev to the current index.
-func filesChangedFromRevToIndex(vcsType, fromRev string) ([]string, error) {
+func FilesChangedFromRevToIndex(vcsType, fromRev string) ([]string, error) {
 	if vcsType != "git" {
-		return nil, fmt.Errorf("filesChangedFromRevToIndex: unsupported vcs type: %q", vcsType)
+		return nil, fmt.Errorf("FilesChangedFromRevToIndex: unsupported vcs type: %q", vcsType)
 	}
 	cmd := exec.Command("git", "diff", "--name-only", fromRev, "--")
 	out, err := cmd.CombinedOutput()
 	return strings.Split(string(bytes.TrimSpace(out)), "\n"), err
 }
 
+// UnitUnchangedSince returns whether u is unchanged since commit
+// prevCommitID. If u has a fingerprint, it is compared to the
+// fingerprint of the source unit that was built at prevCommitID;
+// otherwise, u is unchanged if none of its files are in changedFiles.
+func UnitUnchangedSince(buildStore buildstore.RepoBuildStore, prevCommitID string, u *unit.SourceUnit, changedFiles []string) bool {
+	if u.Fingerprint == "" {
+		return !u.ContainsAny(changedFiles)
+	}
+	f, err := buildStore.Commit(prevCommitID).Open(SourceUnitDataFilename(unit.SourceUnit{}, u))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	var prev unit.SourceUnit
+	if err := json.NewDecoder(f).Decode(&prev); err != nil {
+		return false
+	}
+	return prev.Fingerprint == u.Fingerprint
+}
+
 // CreateMakefile creates the makefiles for the source units in c.
 func CreateMakefile(buildDataDir string, buildStore buildstore.RepoBuildStore, vcsType string, c *config.Tree, opt Options) (*makex.Makefile, error) {
 	var allRules []makex.Rule
@@ -113,7 +156,17 @@ func CreateMakefile(buildDataDir string, buildStore buildstore.RepoBuildStore, v
 			// Check to see if a previous build exists.
 			var prevCommitID string
 			var changedFiles []string
-			if revs, err := listLatestCommitIDs(vcsType); err != nil {
+			if opt.ReuseCommitID != "" {
+				if exist, _ := buildstore.BuildDataExistsForCommit(buildStore, opt.ReuseCommitID); !exist {
+					return nil, fmt.Errorf("no build data to reuse for commit %s", opt.ReuseCommitID)
+				}
+				files, err := FilesChangedFromRevToIndex(vcsType, opt.ReuseCommitID)
+				if err != nil {
+					return nil, fmt.Errorf("listing files changed since commit %s: %s", opt.ReuseCommitID, err)
+				}
+				changedFiles = files
+				prevCommitID = opt.ReuseCommitID
+			} else if revs, err := listLatestCommitIDs(vcsType); err != nil {
 				log.Printf("Warning: could not list revisions, rebuilding from scratch: %s, %s", revs, err)
 			} else {
 				// Skip HEAD, the first revision in the list.
@@ -124,7 +177,7 @@ func CreateMakefile(buildDataDir string, buildStore buildstore.RepoBuildStore, v
 					// A build store exists for this commit. Now we need
 					// to get all the changed files between this rev and
 					// the current rev.
-					files, err := filesChangedFromRevToIndex(vcsType, revs[i])
+					files, err := FilesChangedFromRevToIndex(vcsType, revs[i])
 					if err != nil {
 						log.Printf("Warning: could not retrieve changed files, rebuilding from scratch: %s %s", files, err)
 						break
@@ -143,7 +196,7 @@ func CreateMakefile(buildDataDir string, buildStore buildstore.RepoBuildStore, v
 						continue
 					}
 					u := r.SourceUnit()
-					if u.ContainsAny(changedFiles) {
+					if !UnitUnchangedSince(buildStore, prevCommitID, u, changedFiles) {
 						continue
 					}
 
@@ -162,6 +215,7 @@ func CreateMakefile(buildDataDir string, buildStore buildstore.RepoBuildStore, v
 					}
 
 					rules[i] = &cachedRule{
+						op:         name,
 						cachedPath: strings.Join(p, "/"),
 						target:     rule.Target(),
 						unit:       u,
@@ -40,10 +40,10 @@ func TestCreateMakefile(t *testing.T) {
 all: testdata/n/t.graph.json testdata/n/t.depresolve.json
 
 testdata/n/t.graph.json: testdata/n/t.unit.json f
-	src tool  "tc" "t" < $< | src internal normalize-graph-data --unit-type "t" --dir . 1> $@
+	src tool  "tc" "t" < $< | src internal normalize-graph-data --unit-type "t" --unit "n" --dir . 1> $@
 
 testdata/n/t.depresolve.json: testdata/n/t.unit.json
-	src tool  "tc" "t" < $^ 1> $@
+	src tool  "tc" "t" < $^ | src internal canonicalize-json 1> $@
 
 .DELETE_ON_ERROR:
 `
@@ -60,3 +60,34 @@ testdata/n/t.depresolve.json: testdata/n/t.unit.json
 		t.Errorf("got makefile:\n==========\n%s\n==========\n\nwant makefile:\n==========\n%s\n==========", got, want)
 	}
 }
+
+func TestCreateMakefile_variants(t *testing.T) {
+	c := &config.Tree{
+		SourceUnits: []*unit.SourceUnit{
+			{
+				Name:     "n",
+				Type:     "t",
+				Files:    []string{"f"},
+				Ops:      map[string]*srclib.ToolRef{"graph": {Toolchain: "tc", Subcmd: "t"}, "depresolve": {Toolchain: "tc", Subcmd: "t"}},
+				Variants: []*unit.Variant{{Name: "v", Config: map[string]interface{}{"k": "v"}}},
+			},
+		},
+	}
+
+	mf, err := plan.CreateMakefile("testdata", nil, "", c, plan.Options{NoCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `
+testdata/n~v/t.graph.json: testdata/n/t.unit.json f
+	src internal unit-variant --variant "v" < $< | src tool  "tc" "t" | src internal normalize-graph-data --unit-type "t" --unit "n~v" --dir . 1> $@
+`
+	gotBytes, err := makex.Marshal(mf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(gotBytes), strings.TrimSpace(want)) {
+		t.Errorf("got makefile:\n==========\n%s\n==========\n\nwant it to contain:\n==========\n%s\n==========", gotBytes, strings.TrimSpace(want))
+	}
+}
@@ -0,0 +1,80 @@
+package plan
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/makex"
+)
+
+// WriteNinja writes mf to w as a Ninja build file, so that the plan can
+// be executed by Ninja (or by build systems that consume Ninja files)
+// instead of by `src make`.
+//
+// Each rule's recipes are run in sequence by a single build statement.
+// The make automatic variables $@, $<, and $^ in recipes are replaced
+// with their Ninja equivalents. The "all" rule becomes a phony default
+// target, and special targets (such as .DELETE_ON_ERROR) are omitted;
+// instead, each command removes its output if it fails.
+func WriteNinja(w io.Writer, mf *makex.Makefile) error {
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by `src plan --format=ninja`. DO NOT EDIT.\n\n")
+	buf.WriteString("rule src\n  command = $cmd\n  description = $desc\n\n")
+
+	for _, rule := range mf.Rules {
+		target := rule.Target()
+		if strings.HasPrefix(target, ".") {
+			continue
+		}
+
+		prereqs := make([]string, len(rule.Prereqs()))
+		for i, p := range rule.Prereqs() {
+			prereqs[i] = ninjaEscapePath(p)
+		}
+
+		recipes := rule.Recipes()
+		if len(recipes) == 0 {
+			fmt.Fprintf(&buf, "build %s: phony %s\n\n", ninjaEscapePath(target), strings.Join(prereqs, " "))
+			continue
+		}
+
+		var first string
+		if len(rule.Prereqs()) > 0 {
+			first = rule.Prereqs()[0]
+		}
+		cmds := make([]string, len(recipes))
+		for i, r := range recipes {
+			cmds[i] = ninjaRecipe(r, first)
+		}
+		fmt.Fprintf(&buf, "build %s: src %s\n", ninjaEscapePath(target), strings.Join(prereqs, " "))
+		fmt.Fprintf(&buf, "  cmd = (%s) || (rm -f $out; exit 1)\n", strings.Join(cmds, " && "))
+		fmt.Fprintf(&buf, "  desc = %s\n\n", ninjaEscape(target))
+	}
+
+	buf.WriteString("default all\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ninjaRecipe converts a Makefile recipe to a Ninja command, given the
+// rule's first prereq (for $<).
+func ninjaRecipe(recipe, firstPrereq string) string {
+	s := ninjaEscape(recipe)
+	s = strings.Replace(s, "$$@", "$out", -1)
+	s = strings.Replace(s, "$$^", "$in", -1)
+	s = strings.Replace(s, "$$<", ninjaEscape(firstPrereq), -1)
+	return s
+}
+
+// ninjaEscape escapes s for use in a Ninja variable value.
+func ninjaEscape(s string) string {
+	return strings.Replace(s, "$", "$$", -1)
+}
+
+// ninjaEscapePath escapes s for use as a path in a Ninja build
+// statement.
+func ninjaEscapePath(s string) string {
+	return strings.NewReplacer("$", "$$", " ", "$ ", ":", "$:").Replace(s)
+}
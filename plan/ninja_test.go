@@ -0,0 +1,64 @@
+package plan_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestWriteNinja(t *testing.T) {
+	c := &config.Tree{
+		SourceUnits: []*unit.SourceUnit{
+			{
+				Name:  "n",
+				Type:  "t",
+				Files: []string{"f"},
+				Ops: map[string]*srclib.ToolRef{
+					"graph":      {Toolchain: "tc", Subcmd: "t"},
+					"depresolve": {Toolchain: "tc", Subcmd: "t"},
+				},
+			},
+		},
+	}
+
+	mf, err := plan.CreateMakefile("testdata", nil, "", c, plan.Options{NoCache: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `
+# Generated by ` + "`src plan --format=ninja`" + `. DO NOT EDIT.
+
+rule src
+  command = $cmd
+  description = $desc
+
+build all: phony testdata/n/t.graph.json testdata/n/t.depresolve.json
+
+build testdata/n/t.graph.json: src testdata/n/t.unit.json f
+  cmd = (src tool  "tc" "t" < testdata/n/t.unit.json | src internal normalize-graph-data --unit-type "t" --unit "n" --dir . 1> $out) || (rm -f $out; exit 1)
+  desc = testdata/n/t.graph.json
+
+build testdata/n/t.depresolve.json: src testdata/n/t.unit.json
+  cmd = (src tool  "tc" "t" < $in 1> $out) || (rm -f $out; exit 1)
+  desc = testdata/n/t.depresolve.json
+
+default all
+`
+
+	var buf bytes.Buffer
+	if err := plan.WriteNinja(&buf, mf); err != nil {
+		t.Fatal(err)
+	}
+
+	want = strings.TrimSpace(want)
+	got := strings.TrimSpace(buf.String())
+	if got != want {
+		t.Errorf("got ninja file:\n==========\n%s\n==========\n\nwant ninja file:\n==========\n%s\n==========", got, want)
+	}
+}
@@ -0,0 +1,389 @@
+// Package query queries a srclib store (the data that "src store
+// import" writes and "src serve" serves) from Go programs, without
+// running the src binary.
+//
+// An Index is a store opened from a directory (with Open) or wrapping
+// an existing store (with New). Its methods take the same options as
+// the queries of the gRPC Query service (see storepb.QueryClient), so
+// code can switch between querying a local store and a remote server.
+// Indexes have no global state, and an Index may be used concurrently
+// (except while data is being imported into it).
+//
+// To build and import data, see package build. To export data, see
+// package export.
+package query
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/store/storepb"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// Store types (the values of OpenOptions.Type).
+const (
+	RepoStore      = "RepoStore"      // the data of a single repository
+	MultiRepoStore = "MultiRepoStore" // the data of many repositories
+)
+
+// OpenOptions configures how Open opens a store.
+type OpenOptions struct {
+	// Type is the type of the store (RepoStore or MultiRepoStore;
+	// default: RepoStore), as in "src store --type".
+	Type string
+
+	// ReadOnly opens the store for querying only. Open it read-only
+	// if other processes may import data into it.
+	ReadOnly bool
+
+	// Config is the configuration of the store backend of a store URL
+	// (see Open), or nil.
+	Config []byte
+
+	// ReadFile, if set, reads files of repositories at commits, for
+	// the snippets of query results (see storepb.DefsOptions). It
+	// should return an error if the file is unavailable, in which case
+	// results have no snippet.
+	ReadFile func(repo, commitID, file string) ([]byte, error)
+}
+
+// An Index is an opened srclib store.
+type Index struct {
+	stor     store.RepoStore
+	readFile func(repo, commitID, file string) ([]byte, error)
+}
+
+// Open opens the store in dir, as "src store --root DIR" does. A
+// writable store's imports are staged (see store.RepoStager), so
+// read-only stores opened by other processes never see partially
+// imported commits.
+//
+// If dir is the URL of a store of a registered store backend (see
+// store.RegisterBackend), Open opens it with the backend instead, and
+// opt.Type must match the backend's capabilities.
+func Open(dir string, opt OpenOptions) (*Index, error) {
+	if store.LookupBackend(dir) != nil {
+		return openBackend(dir, opt)
+	}
+
+	var fs rwvfs.WalkableFileSystem
+	if opt.ReadOnly {
+		fs = rwvfs.Walkable(rwvfs.ReadOnly(rwvfs.OS(dir)))
+	} else {
+		osFS := rwvfs.OS(dir)
+		type createParents interface {
+			CreateParentDirs(bool)
+		}
+		if osFS, ok := osFS.(createParents); ok {
+			osFS.CreateParentDirs(true)
+		}
+		fs = store.WithOSRename(rwvfs.Walkable(osFS), dir)
+	}
+
+	var s store.RepoStore
+	switch opt.Type {
+	case "", RepoStore:
+		s = store.NewFSRepoStore(fs)
+	case MultiRepoStore:
+		s = store.NewFSMultiRepoStore(fs, nil)
+	default:
+		return nil, fmt.Errorf("unrecognized store type %q (valid types are %s, %s)", opt.Type, RepoStore, MultiRepoStore)
+	}
+	x := New(s)
+	x.readFile = opt.ReadFile
+	return x, nil
+}
+
+// openBackend opens the store at the URL rawurl with its store
+// backend.
+func openBackend(rawurl string, opt OpenOptions) (*Index, error) {
+	s, caps, err := store.OpenURL(rawurl, store.BackendOptions{ReadOnly: opt.ReadOnly, Config: opt.Config})
+	if err != nil {
+		return nil, err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok || !caps.Has(store.CapQuery) {
+		return nil, fmt.Errorf("store backend for %s does not support queries (its capabilities are %s)", rawurl, caps)
+	}
+	if opt.Type == MultiRepoStore && !caps.Has(store.CapMultiRepo) {
+		return nil, fmt.Errorf("store backend for %s does not support %s (its capabilities are %s)", rawurl, MultiRepoStore, caps)
+	}
+	x := New(rs)
+	x.readFile = opt.ReadFile
+	return x, nil
+}
+
+// New returns an Index that queries s (such as a store.MultiRepoStore
+// federated with remote stores; see store.NewFederatedStore).
+func New(s store.RepoStore) *Index {
+	return &Index{stor: s}
+}
+
+// Store returns the index's underlying store (for importing data and
+// for queries that Index doesn't provide).
+func (x *Index) Store() store.RepoStore { return x.stor }
+
+// Repos returns the repositories in the index. It returns an error
+// unless the index is a MultiRepoStore.
+func (x *Index) Repos() ([]string, error) {
+	mrs, ok := x.stor.(store.MultiRepoStore)
+	if !ok {
+		return nil, fmt.Errorf("store (type %T) does not implement listing repositories", x.stor)
+	}
+	return mrs.Repos()
+}
+
+// Versions returns the indexed commits of repo (or, if repo is empty,
+// of all repositories).
+func (x *Index) Versions(repo string) ([]*store.Version, error) {
+	var fs []store.VersionFilter
+	if repo != "" {
+		fs = append(fs, store.ByRepos(repo))
+	}
+	return x.stor.Versions(fs...)
+}
+
+// Units returns the source units of repo at commitID (or, if either
+// is empty, of all repositories or commits).
+func (x *Index) Units(repo, commitID string) ([]*unit.SourceUnit, error) {
+	var fs []store.UnitFilter
+	if repo != "" {
+		fs = append(fs, store.ByRepos(repo))
+	}
+	if commitID != "" {
+		fs = append(fs, store.ByCommitIDs(commitID))
+	}
+	return x.stor.Units(fs...)
+}
+
+// Def returns the def with the given key. Its UnitType, Unit, and Path
+// are required. If there is no such def, it returns
+// graph.ErrDefNotExist.
+func (x *Index) Def(key graph.DefKey) (*graph.Def, error) {
+	if key.UnitType == "" || key.Unit == "" || key.Path == "" {
+		return nil, errors.New("UnitType, Unit, and Path are required")
+	}
+	defs, err := x.Defs(&storepb.DefsOptions{
+		Repo:     key.Repo,
+		CommitID: key.CommitID,
+		UnitType: key.UnitType,
+		Unit:     key.Unit,
+		Path:     key.Path,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(defs) == 0 {
+		return nil, graph.ErrDefNotExist
+	}
+	return defs[0], nil
+}
+
+// Defs returns the defs that match opt. If opt.Query is set, they are
+// ordered by rank (and, with opt.Fuzzy, by how well they match).
+func (x *Index) Defs(opt *storepb.DefsOptions) ([]*graph.Def, error) {
+	ufs, err := defFilters(opt.Repo, opt.CommitID, opt.UnitType, opt.Unit, opt.File)
+	if err != nil {
+		return nil, err
+	}
+	fs := make([]store.DefFilter, len(ufs), len(ufs)+4)
+	for i, f := range ufs {
+		fs[i] = f
+	}
+	if opt.Where != "" {
+		e, err := store.ParseDefExpr(opt.Where)
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, store.DefExprFilters(e)...)
+	}
+	if opt.Path != "" {
+		fs = append(fs, store.ByDefPath(opt.Path))
+	}
+	if opt.Query != "" {
+		if opt.Fuzzy {
+			fs = append(fs, store.ByDefFuzzyQuery(opt.Query))
+		} else {
+			fs = append(fs, store.ByDefQuery(opt.Query))
+		}
+	} else if opt.Limit != 0 || opt.Offset != 0 {
+		// Query results are ordered by rank (below), so they must be
+		// limited after sorting.
+		fs = append(fs, store.Limit(opt.Limit, opt.Offset))
+	}
+
+	defs, err := x.stor.Defs(fs...)
+	if err != nil {
+		return nil, err
+	}
+	if opt.FollowAliases {
+		if defs, err = store.ResolveAliases(x.stor, defs); err != nil {
+			return nil, err
+		}
+	}
+	if opt.Query != "" {
+		rankDefs(defs, opt.Query, opt.Fuzzy)
+		defs = LimitDefs(defs, opt.Limit, opt.Offset)
+	}
+	if opt.Snippets && x.readFile != nil {
+		SetDefSnippets(defs, opt.ContextLines, x.readFile)
+	}
+	return defs, nil
+}
+
+// Search returns the defs whose names match opt.Query (see
+// storepb.SearchOptions), ordered by rank.
+func (x *Index) Search(opt *storepb.SearchOptions) ([]*graph.Def, error) {
+	if opt.Query == "" {
+		return nil, errors.New("empty query")
+	}
+	return x.Defs(&storepb.DefsOptions{
+		Repo:         opt.Repo,
+		CommitID:     opt.CommitID,
+		UnitType:     opt.UnitType,
+		Unit:         opt.Unit,
+		File:         opt.File,
+		Query:        opt.Query,
+		Fuzzy:        opt.Fuzzy,
+		Limit:        opt.Limit,
+		Snippets:     opt.Snippets,
+		ContextLines: opt.ContextLines,
+	})
+}
+
+// Refs returns the refs that match opt. With opt.Linked, it also
+// returns the refs to the defs that are linked to opt.Def (see
+// store.LinkedDefs), and with opt.FollowAliases, the refs to the defs
+// that are aliases of opt.Def (see store.AliasDefs), after the refs to
+// opt.Def. With opt.SortByConfidence, all of the refs are sorted by
+// descending confidence instead.
+func (x *Index) Refs(opt *storepb.RefsOptions) ([]*graph.Ref, error) {
+	if opt.Linked && opt.Def.DefPath == "" {
+		return nil, errors.New("Linked requires Def.DefPath")
+	}
+	if opt.FollowAliases && opt.Def.DefPath == "" {
+		return nil, errors.New("FollowAliases requires Def.DefPath")
+	}
+	if !graph.ValidConfidence(opt.MinConfidence) {
+		return nil, errors.New("MinConfidence must be between 0 and 1")
+	}
+	refs, err := x.refs(opt, opt.Def)
+	if err != nil {
+		return nil, err
+	}
+	var related []*graph.Def
+	if opt.Linked {
+		linked, err := store.LinkedDefs(x.stor, opt.Def)
+		if err != nil {
+			return nil, err
+		}
+		related = append(related, linked...)
+	}
+	if opt.FollowAliases {
+		aliases, err := store.AliasDefs(x.stor, opt.Def)
+		if err != nil {
+			return nil, err
+		}
+		related = append(related, aliases...)
+	}
+	if len(related) > 0 {
+		for _, def := range related {
+			defRefs, err := x.refs(opt, graph.RefDefKey{DefRepo: def.Repo, DefUnitType: def.UnitType, DefUnit: def.Unit, DefPath: def.Path})
+			if err != nil {
+				return nil, err
+			}
+			refs = append(refs, defRefs...)
+		}
+		if opt.Limit > 0 && len(refs) > opt.Limit && !opt.SortByConfidence {
+			refs = refs[:opt.Limit]
+		}
+	}
+	if opt.SortByConfidence {
+		sort.Stable(graph.RefsByConfidence(refs))
+		refs = LimitRefs(refs, opt.Limit, opt.Offset)
+	}
+	if opt.Snippets && x.readFile != nil {
+		SetRefSnippets(refs, opt.ContextLines, x.readFile)
+	}
+	return refs, nil
+}
+
+// refs returns the refs that match opt's filters, to def.
+func (x *Index) refs(opt *storepb.RefsOptions, def graph.RefDefKey) ([]*graph.Ref, error) {
+	fs, err := defFilters(opt.Repo, opt.CommitID, opt.UnitType, opt.Unit, opt.File)
+	if err != nil {
+		return nil, err
+	}
+	rfs := make([]store.RefFilter, len(fs), len(fs)+4)
+	for i, f := range fs {
+		rfs[i] = f
+	}
+	if start := opt.Start; start != 0 {
+		rfs = append(rfs, store.RefFilterFunc(func(ref *graph.Ref) bool { return ref.Start >= start }))
+	}
+	if end := opt.End; end != 0 {
+		rfs = append(rfs, store.RefFilterFunc(func(ref *graph.Ref) bool { return ref.End <= end }))
+	}
+	if def.DefPath != "" {
+		rfs = append(rfs, store.ByRefDef(def))
+	} else if def != (graph.RefDefKey{}) {
+		// Refs are only indexed by complete def keys.
+		rfs = append(rfs, store.AbsRefFilterFunc(store.RefFilterFunc(func(ref *graph.Ref) bool {
+			return (def.DefRepo == "" || ref.DefRepo == def.DefRepo) &&
+				(def.DefUnitType == "" || ref.DefUnitType == def.DefUnitType) &&
+				(def.DefUnit == "" || ref.DefUnit == def.DefUnit)
+		})))
+	}
+	if min := opt.MinConfidence; min != 0 {
+		rfs = append(rfs, store.RefFilterFunc(func(ref *graph.Ref) bool { return ref.EffectiveConfidence() >= min }))
+	}
+	if (opt.Limit != 0 || opt.Offset != 0) && !opt.SortByConfidence {
+		// Refs sorted by confidence (in Refs) must be limited after
+		// sorting.
+		rfs = append(rfs, store.Limit(opt.Limit, opt.Offset))
+	}
+	return x.stor.Refs(rfs...)
+}
+
+// A filter is a filter of both defs and refs.
+type filter interface {
+	store.DefFilter
+	store.RefFilter
+}
+
+// defFilters returns the filters (of both defs and refs) selecting the
+// given repo, commit, source unit, and file (if they are set).
+func defFilters(repo, commitID, unitType, unitName, file string) ([]filter, error) {
+	var fs []filter
+	if (unitType == "") != (unitName == "") {
+		return nil, errors.New("must specify either both or neither of UnitType and Unit")
+	}
+	if unitType != "" {
+		fs = append(fs, store.ByUnits(unit.ID2{Type: unitType, Name: unitName}))
+	}
+	if commitID != "" {
+		fs = append(fs, store.ByCommitIDs(commitID))
+	}
+	if repo != "" {
+		fs = append(fs, store.ByRepos(repo))
+	}
+	if file != "" {
+		fs = append(fs, store.ByFiles(path.Clean(file)))
+	}
+	return fs, nil
+}
+
+// rankDefs sorts defs by rank and, if fuzzy, by how well their names
+// match the fuzzy query q (see store.FuzzyMatch).
+func rankDefs(defs []*graph.Def, q string, fuzzy bool) {
+	graph.SortDefsByRank(defs)
+	if fuzzy {
+		SortDefsByFuzzyScore(defs, q)
+	}
+}
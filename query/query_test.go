@@ -0,0 +1,155 @@
+package query
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/store/storepb"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// openTestIndex returns an Index of a MultiRepoStore in dir with the
+// defs and refs of a source unit in repo r at commit c.
+func openTestIndex(t *testing.T, dir string) *Index {
+	files := map[string]string{"f.go": "package p\n\nfunc HTTPServer() {}\nfunc Handle() { HTTPServer() }\n"}
+	x, err := Open(dir, OpenOptions{
+		Type: MultiRepoStore,
+		ReadFile: func(repo, commitID, file string) ([]byte, error) {
+			if data, ok := files[file]; ok && repo == "r" && commitID == "c" {
+				return []byte(data), nil
+			}
+			return nil, os.ErrNotExist
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &unit.SourceUnit{Type: "t", Name: "u", Files: []string{"f.go"}}
+	data := graph.Output{
+		Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "HTTPServer"}, Name: "HTTPServer", File: "f.go", DefStart: 11, DefEnd: 31},
+			{DefKey: graph.DefKey{Path: "Handle"}, Name: "Handle", File: "f.go", DefStart: 32, DefEnd: 63},
+		},
+		Refs: []*graph.Ref{
+			{DefPath: "HTTPServer", File: "f.go", Start: 16, End: 26, Def: true},
+			{DefPath: "Handle", File: "f.go", Start: 37, End: 43, Def: true},
+			{DefPath: "HTTPServer", File: "f.go", Start: 48, End: 58, Confidence: 0.5},
+		},
+	}
+	if err := x.Store().(store.MultiRepoImporter).Import("r", "c", u, data); err != nil {
+		t.Fatal(err)
+	}
+	return x
+}
+
+func TestIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-query-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	x := openTestIndex(t, dir)
+
+	repos, err := x.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != 1 || repos[0] != "r" {
+		t.Errorf("got repos %v, want [r]", repos)
+	}
+	versions, err := x.Versions("r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0].CommitID != "c" {
+		t.Errorf("got versions %v, want commit c", versions)
+	}
+	units, err := x.Units("r", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 1 || units[0].Name != "u" {
+		t.Errorf("got units %v, want unit u", units)
+	}
+
+	def, err := x.Def(graph.DefKey{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", Path: "Handle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.Name != "Handle" {
+		t.Errorf("got def %v, want Handle", def)
+	}
+	if _, err := x.Def(graph.DefKey{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", Path: "X"}); err != graph.ErrDefNotExist {
+		t.Errorf("got error %v for nonexistent def, want graph.ErrDefNotExist", err)
+	}
+	if _, err := x.Defs(&storepb.DefsOptions{UnitType: "t"}); err == nil {
+		t.Error("got no error for UnitType without Unit")
+	}
+	defs, err := x.Defs(&storepb.DefsOptions{Repo: "r", CommitID: "c", Where: "unittype:t unit:u name:^H -name:Server$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || defs[0].Name != "Handle" {
+		t.Errorf("got defs %v for Where, want Handle", defs)
+	}
+	if _, err := x.Defs(&storepb.DefsOptions{Where: "color:red"}); err == nil {
+		t.Error("got no error for bad Where")
+	}
+
+	defs, err = x.Search(&storepb.SearchOptions{Query: "HtpSrv", Fuzzy: true, Repo: "r", CommitID: "c", Snippets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || defs[0].Name != "HTTPServer" {
+		t.Fatalf("got defs %v, want HTTPServer", defs)
+	}
+	if s := defs[0].Snippet; s == nil || s.Text != "func HTTPServer() {}" {
+		t.Errorf("got snippet %+v, want the def's line", s)
+	}
+
+	refs, err := x.Refs(&storepb.RefsOptions{
+		Repo:     "r",
+		CommitID: "c",
+		Def:      graph.RefDefKey{DefRepo: "r", DefUnitType: "t", DefUnit: "u", DefPath: "HTTPServer"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 2 {
+		t.Errorf("got %d refs to HTTPServer, want 2", len(refs))
+	}
+	refs, err = x.Refs(&storepb.RefsOptions{Repo: "r", CommitID: "c", File: "f.go", Start: 40, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].Start != 48 {
+		t.Errorf("got refs %v, want the ref at 48", refs)
+	}
+
+	refs, err = x.Refs(&storepb.RefsOptions{Repo: "r", CommitID: "c", MinConfidence: 0.9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 2 || refs[0].Start != 16 || refs[1].Start != 37 {
+		t.Errorf("got refs %v with MinConfidence, want the refs at 16 and 37", refs)
+	}
+	refs, err = x.Refs(&storepb.RefsOptions{Repo: "r", CommitID: "c", SortByConfidence: true, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 2 || refs[0].Start != 37 || refs[1].Start != 48 {
+		t.Errorf("got refs %v with SortByConfidence and Offset, want the refs at 37 and 48", refs)
+	}
+	if _, err := x.Refs(&storepb.RefsOptions{MinConfidence: 2}); err == nil {
+		t.Error("got no error for MinConfidence greater than 1")
+	}
+}
+
+func TestOpen_badType(t *testing.T) {
+	if _, err := Open(os.TempDir(), OpenOptions{Type: "x"}); err == nil {
+		t.Error("got no error for an unrecognized store type")
+	}
+}
@@ -0,0 +1,77 @@
+package query
+
+import (
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+// SortDefsByFuzzyScore sorts defs by how well their names match the
+// fuzzy query q (see store.FuzzyMatch). Defs with equal scores keep
+// their original order.
+func SortDefsByFuzzyScore(defs []*graph.Def, q string) {
+	scores := make(map[*graph.Def]int, len(defs))
+	for _, def := range defs {
+		scores[def], _ = store.FuzzyMatch(q, def.Name)
+	}
+	sort.SliceStable(defs, func(i, j int) bool { return scores[defs[i]] > scores[defs[j]] })
+}
+
+// LimitDefs returns at most limit defs (or all defs if limit is 0)
+// from defs, starting at offset.
+func LimitDefs(defs []*graph.Def, limit, offset int) []*graph.Def {
+	if offset >= len(defs) {
+		return nil
+	}
+	defs = defs[offset:]
+	if limit > 0 && limit < len(defs) {
+		defs = defs[:limit]
+	}
+	return defs
+}
+
+// LimitRefs returns at most limit refs (or all refs if limit is 0)
+// from refs, starting at offset.
+func LimitRefs(refs []*graph.Ref, limit, offset int) []*graph.Ref {
+	if offset >= len(refs) {
+		return nil
+	}
+	refs = refs[offset:]
+	if limit > 0 && limit < len(refs) {
+		refs = refs[:limit]
+	}
+	return refs
+}
+
+// SetDefSnippets sets the snippets of defs to their first lines, with
+// contextLines lines before and after. (The whole def, such as a
+// class, is often too long to display with each result.) The files
+// are read with readFile (see OpenOptions.ReadFile).
+func SetDefSnippets(defs []*graph.Def, contextLines int, readFile func(repo, commitID, file string) ([]byte, error)) {
+	for _, def := range defs {
+		def.Snippet = snippet(readFile, def.Repo, def.CommitID, def.File, def.DefStart, def.DefStart, contextLines)
+	}
+}
+
+// SetRefSnippets sets the snippets of refs to the lines that contain
+// them, with contextLines lines before and after. The files are read
+// with readFile (see OpenOptions.ReadFile).
+func SetRefSnippets(refs []*graph.Ref, contextLines int, readFile func(repo, commitID, file string) ([]byte, error)) {
+	for _, ref := range refs {
+		ref.Snippet = snippet(readFile, ref.Repo, ref.CommitID, ref.File, ref.Start, ref.End, contextLines)
+	}
+}
+
+// snippet returns the snippet of the byte range [start, end) of file
+// in repo at commitID, or nil if the file can't be read.
+func snippet(readFile func(repo, commitID, file string) ([]byte, error), repo, commitID, file string, start, end uint32, contextLines int) *graph.Snippet {
+	if file == "" {
+		return nil
+	}
+	contents, err := readFile(repo, commitID, file)
+	if err != nil {
+		return nil
+	}
+	return graph.MakeSnippet(contents, start, end, contextLines)
+}
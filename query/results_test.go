@@ -0,0 +1,56 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestLimitDefs(t *testing.T) {
+	defs := []*graph.Def{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	tests := map[string]struct {
+		limit, offset int
+		want          []string
+	}{
+		"no limit":         {want: []string{"a", "b", "c"}},
+		"limit":            {limit: 2, want: []string{"a", "b"}},
+		"offset":           {offset: 1, want: []string{"b", "c"}},
+		"limit and offset": {limit: 1, offset: 1, want: []string{"b"}},
+		"limit past end":   {limit: 5, offset: 2, want: []string{"c"}},
+		"offset past end":  {offset: 3},
+	}
+	for label, test := range tests {
+		var got []string
+		for _, def := range LimitDefs(defs, test.limit, test.offset) {
+			got = append(got, def.Name)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", label, got, test.want)
+		}
+	}
+}
+
+func TestSetRefSnippets(t *testing.T) {
+	readFile := func(repo, commitID, file string) ([]byte, error) {
+		if file != "f.go" {
+			return nil, errors.New("not found")
+		}
+		return []byte("a\nb\nc\n"), nil
+	}
+	refs := []*graph.Ref{
+		{File: "f.go", Start: 2, End: 3},
+		{File: "g.go", Start: 2, End: 3},
+		{},
+	}
+	SetRefSnippets(refs, 0, readFile)
+	if s := refs[0].Snippet; s == nil || s.Text != "b" {
+		t.Errorf("got snippet %+v, want the ref's line", s)
+	}
+	for _, ref := range refs[1:] {
+		if ref.Snippet != nil {
+			t.Errorf("got snippet %+v for ref in unreadable file %q, want none", ref.Snippet, ref.File)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package region
+
+import (
+	"bytes"
+	"regexp"
+)
+
+func init() {
+	Register("html", []string{"*.html", "*.htm", "*.xhtml", "*.tmpl", "*.gohtml", "*.vue"}, ExtractorFunc(htmlRegions))
+}
+
+var (
+	htmlTagPattern  = regexp.MustCompile(`(?is)<(script|style)\b([^>]*)>`)
+	htmlTypePattern = regexp.MustCompile(`(?is)\btype\s*=\s*["']?([^"'\s>]+)`)
+)
+
+// htmlRegions returns the contents of the script and style elements
+// in an HTML document (or template). Scripts with a type attribute
+// other than a JavaScript MIME type or "module" (such as JSON data or
+// client-side templates) are skipped.
+func htmlRegions(data []byte) []*Region {
+	var regions []*Region
+	for pos := 0; pos < len(data); {
+		m := htmlTagPattern.FindSubmatchIndex(data[pos:])
+		if m == nil {
+			break
+		}
+		tag := string(bytes.ToLower(data[pos+m[2] : pos+m[3]]))
+		attrs := data[pos+m[4] : pos+m[5]]
+		start := pos + m[1]
+
+		end := bytes.Index(bytes.ToLower(data[start:]), []byte("</"+tag))
+		if end == -1 {
+			break
+		}
+		end += start
+		pos = end
+
+		lang := "css"
+		if tag == "script" {
+			lang = htmlScriptLanguage(attrs)
+			if lang == "" {
+				continue
+			}
+		}
+		if end > start {
+			regions = append(regions, &Region{Language: lang, Start: start, End: end})
+		}
+	}
+	return regions
+}
+
+// htmlScriptLanguage returns the language of a script element with
+// the given attributes, or the empty string if it isn't JavaScript or
+// TypeScript.
+func htmlScriptLanguage(attrs []byte) string {
+	m := htmlTypePattern.FindSubmatch(attrs)
+	if m == nil {
+		if bytes.Contains(bytes.ToLower(attrs), []byte(`lang="ts"`)) {
+			return "typescript" // Vue single-file components
+		}
+		return "javascript"
+	}
+	switch string(bytes.ToLower(m[1])) {
+	case "text/javascript", "application/javascript", "application/ecmascript", "text/ecmascript", "module":
+		return "javascript"
+	case "text/typescript", "application/typescript":
+		return "typescript"
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package region
+
+import (
+	"context"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+)
+
+func init() {
+	grapher.RegisterPostProcessor("regions", grapher.PostProcessorFunc(PostProcess))
+}
+
+// PostProcess is a grapher.PostProcessor (registered as "regions")
+// that rewrites the files of defs, refs, docs, and anns in virtual
+// files to their host files. Spans are unchanged, because virtual
+// files preserve the offsets of their host files.
+func PostProcess(ctx context.Context, unitType, unit string, o *graph.Output) error {
+	hosts := map[string]string{}
+	host := func(file string) string {
+		h, present := hosts[file]
+		if !present {
+			if h = HostFilename(file); h == "" {
+				h = file
+			}
+			hosts[file] = h
+		}
+		return h
+	}
+
+	for _, def := range o.Defs {
+		def.File = host(def.File)
+	}
+	for _, ref := range o.Refs {
+		ref.File = host(ref.File)
+	}
+	for _, doc := range o.Docs {
+		doc.File = host(doc.File)
+	}
+	for _, ann := range o.Anns {
+		ann.File = host(ann.File)
+	}
+	return nil
+}
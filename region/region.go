@@ -0,0 +1,206 @@
+// Package region extracts regions of code in embedded languages from
+// host files (such as JavaScript in HTML script tags or SQL in string
+// literals) so that the embedded code can be graphed by the
+// toolchains for its language.
+//
+// Extractors register for host file name patterns (see Register). The
+// regions of each embedded language in a host file are written to a
+// virtual file (see VirtualFilename) that has the same length as the
+// host file, with all bytes outside of the regions blanked out (see
+// VirtualFile). Offsets in a virtual file are therefore the same as in
+// its host file, and mapping graph output back to the host file only
+// requires renaming the file (see PostProcess).
+package region
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// A Region is a span of code in an embedded language in a host file.
+type Region struct {
+	// Language is the (lowercase) embedded language, such as
+	// "javascript" or "sql".
+	Language string
+
+	// Start and End are the byte offsets of the region in the host
+	// file.
+	Start, End int
+}
+
+// An Extractor finds the embedded regions of code in host files.
+type Extractor interface {
+	// Regions returns the regions in the host file data, sorted by
+	// offset. They must not overlap.
+	Regions(data []byte) []*Region
+}
+
+// ExtractorFunc is an Extractor that is a function.
+type ExtractorFunc func(data []byte) []*Region
+
+// Regions implements Extractor.
+func (f ExtractorFunc) Regions(data []byte) []*Region { return f(data) }
+
+type registeredExtractor struct {
+	patterns []string // host file name patterns (in path.Match syntax)
+	Extractor
+}
+
+// extractors holds the registered extractors, keyed by name.
+var extractors = map[string]*registeredExtractor{}
+
+// Register makes an extractor available for host files whose names
+// (without dirs) match any of patterns (in path.Match syntax). If
+// Register is called twice with the same name, if name is empty, or
+// if e is nil, it panics.
+func Register(name string, patterns []string, e Extractor) {
+	if name == "" {
+		panic("region: Register name is empty")
+	}
+	if _, dup := extractors[name]; dup {
+		panic("region: Register called twice for name " + name)
+	}
+	if e == nil {
+		panic("region: Register extractor is nil")
+	}
+	extractors[name] = &registeredExtractor{patterns: patterns, Extractor: e}
+}
+
+// extractorsFor returns the registered extractors for file, sorted by
+// name.
+func extractorsFor(file string) []Extractor {
+	var names []string
+	base := path.Base(file)
+	for name, e := range extractors {
+		for _, pat := range e.patterns {
+			if ok, _ := path.Match(pat, base); ok {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	es := make([]Extractor, len(names))
+	for i, name := range names {
+		es[i] = extractors[name]
+	}
+	return es
+}
+
+// IsHost returns whether any registered extractor handles file.
+func IsHost(file string) bool {
+	return len(extractorsFor(file)) > 0
+}
+
+// Extract returns the regions in the host file (whose contents are
+// data) found by the registered extractors for file, keyed by
+// language.
+func Extract(file string, data []byte) map[string][]*Region {
+	var byLang map[string][]*Region
+	for _, e := range extractorsFor(file) {
+		for _, r := range e.Regions(data) {
+			if byLang == nil {
+				byLang = map[string][]*Region{}
+			}
+			byLang[r.Language] = append(byLang[r.Language], r)
+		}
+	}
+	return byLang
+}
+
+// VirtualFile returns the contents of the virtual file for the given
+// regions (of one language) in the host file data: the regions are
+// copied verbatim, and all other bytes except newlines are replaced
+// by spaces, so that offsets and line numbers are preserved.
+func VirtualFile(data []byte, regions []*Region) []byte {
+	v := make([]byte, len(data))
+	for i, b := range data {
+		if b == '\n' || b == '\r' {
+			v[i] = b
+		} else {
+			v[i] = ' '
+		}
+	}
+	for _, r := range regions {
+		if r.Start >= 0 && r.Start <= r.End && r.End <= len(data) {
+			copy(v[r.Start:r.End], data[r.Start:r.End])
+		}
+	}
+	return v
+}
+
+// languageExts maps embedded languages to the extensions of their
+// virtual files.
+var languageExts = map[string]string{
+	"javascript": ".js",
+	"typescript": ".ts",
+	"css":        ".css",
+	"sql":        ".sql",
+}
+
+// VirtualFilename returns the name of the virtual file for the
+// regions of the given language in the host file.
+func VirtualFilename(file, language string) string {
+	ext, present := languageExts[language]
+	if !present {
+		ext = "." + language
+	}
+	return file + ext
+}
+
+// HostFilename returns the name of the host file whose virtual file
+// is file, or the empty string if file is not a virtual file of a
+// host file that a registered extractor handles.
+func HostFilename(file string) string {
+	host := strings.TrimSuffix(file, path.Ext(file))
+	if host == file || !IsHost(host) {
+		return ""
+	}
+	return host
+}
+
+// SubUnitSep separates the name of a source unit from the embedded
+// language in the names of its virtual sub-units.
+const SubUnitSep = "#"
+
+// SubUnits returns the virtual sub-units of u: for each language in
+// unitTypes (which maps embedded languages to source unit types), a
+// source unit of that type whose files are the virtual files of that
+// language for u's host files. Only virtual files for which exists
+// returns true are included, and no sub-unit is returned for a
+// language with no virtual files.
+func SubUnits(u *unit.SourceUnit, unitTypes map[string]string, exists func(file string) bool) []*unit.SourceUnit {
+	langs := make([]string, 0, len(unitTypes))
+	for lang := range unitTypes {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	var subs []*unit.SourceUnit
+	for _, lang := range langs {
+		var files []string
+		for _, f := range u.Files {
+			if !IsHost(f) || HostFilename(f) != "" {
+				continue
+			}
+			if vf := VirtualFilename(f, lang); exists(vf) {
+				files = append(files, vf)
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		subs = append(subs, &unit.SourceUnit{
+			Name:    u.Name + SubUnitSep + lang,
+			Type:    unitTypes[lang],
+			Repo:    u.Repo,
+			Dir:     u.Dir,
+			Files:   files,
+			License: u.License,
+		})
+	}
+	return subs
+}
@@ -0,0 +1,86 @@
+package region
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func regionTexts(data []byte, regions []*Region) []string {
+	var texts []string
+	for _, r := range regions {
+		texts = append(texts, string(data[r.Start:r.End]))
+	}
+	return texts
+}
+
+func TestExtract_html(t *testing.T) {
+	data := []byte(`<html><head>
+<STYLE>body { color: red }</STYLE>
+<script src="x.js"></script>
+<script type="text/template"><b>{{x}}</b></script>
+<script type="module">import x from "./x.js";</script>
+</head></html>`)
+	regions := Extract("a/index.html", data)
+	if got, want := regionTexts(data, regions["css"]), []string{"body { color: red }"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got css %q, want %q", got, want)
+	}
+	if got, want := regionTexts(data, regions["javascript"]), []string{`import x from "./x.js";`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got javascript %q, want %q", got, want)
+	}
+}
+
+func TestExtract_sql(t *testing.T) {
+	data := []byte("package db\n\nconst q = `\n  SELECT id FROM users WHERE name = $1`\nvar s = \"hello\"\nvar d = \"DELETE FROM users\"\n")
+	regions := Extract("db.go", data)
+	want := []string{"\n  SELECT id FROM users WHERE name = $1", "DELETE FROM users"}
+	if got := regionTexts(data, regions["sql"]); !reflect.DeepEqual(got, want) {
+		t.Errorf("got sql %q, want %q", got, want)
+	}
+	if len(regions) != 1 {
+		t.Errorf("got languages %v, want only sql", regions)
+	}
+
+	v := VirtualFile(data, regions["sql"])
+	if len(v) != len(data) {
+		t.Fatalf("got virtual file length %d, want %d", len(v), len(data))
+	}
+	for _, r := range regions["sql"] {
+		if string(v[r.Start:r.End]) != string(data[r.Start:r.End]) {
+			t.Errorf("region %q not preserved in virtual file", data[r.Start:r.End])
+		}
+	}
+	if v[0] != ' ' || v[len("package db")] != '\n' {
+		t.Errorf("non-region bytes not blanked: %q", v)
+	}
+}
+
+func TestHostFilename(t *testing.T) {
+	tests := map[string]string{
+		"a/index.html.js": "a/index.html",
+		"db.go.sql":       "db.go",
+		"jquery.min.js":   "",
+		"index.html":      "",
+	}
+	for file, want := range tests {
+		if got := HostFilename(file); got != want {
+			t.Errorf("%s: got %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestSubUnits(t *testing.T) {
+	u := &unit.SourceUnit{Name: "web", Type: "GoPackage", Dir: "web", Files: []string{"web/a.go", "web/b.go", "web/index.html"}}
+	exists := map[string]bool{"web/a.go.sql": true, "web/index.html.js": true}
+	subs := SubUnits(u, map[string]string{"sql": "SQLSchema", "javascript": "CommonJSPackage", "css": "CSS"}, func(f string) bool { return exists[f] })
+	if len(subs) != 2 {
+		t.Fatalf("got %d sub-units, want 2", len(subs))
+	}
+	if s := subs[0]; s.Name != "web#javascript" || s.Type != "CommonJSPackage" || !reflect.DeepEqual(s.Files, []string{"web/index.html.js"}) {
+		t.Errorf("got sub-unit %+v", s)
+	}
+	if s := subs[1]; s.Name != "web#sql" || s.Type != "SQLSchema" || !reflect.DeepEqual(s.Files, []string{"web/a.go.sql"}) {
+		t.Errorf("got sub-unit %+v", s)
+	}
+}
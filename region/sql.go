@@ -0,0 +1,39 @@
+package region
+
+import "regexp"
+
+func init() {
+	Register("sql-strings", []string{"*.go", "*.py", "*.java", "*.rb", "*.js"}, ExtractorFunc(sqlStringRegions))
+}
+
+var (
+	// sqlStringPattern matches the string literals whose contents can
+	// be extracted verbatim (so that offsets are preserved): Go raw
+	// strings, Python triple-quoted strings, and single-line quoted
+	// strings without escapes. The contents are in the first
+	// non-empty submatch.
+	sqlStringPattern = regexp.MustCompile("(?s)`([^`]*)`" + `|"""(.*?)"""|'''(.*?)'''|"([^"\\\n]*)"|'([^'\\\n]*)'`)
+
+	// sqlPattern matches the start of an SQL statement.
+	sqlPattern = regexp.MustCompile(`(?is)^\s*(select\s.+\sfrom\s|insert\s+into\s|update\s.+\sset\s|delete\s+from\s|create\s+(table|index|view|unique\s+index)\s|alter\s+table\s|drop\s+(table|index|view)\s|with\s.+\sas\s*\()`)
+)
+
+// sqlStringRegions returns the contents of the string literals in
+// source code that contain SQL statements. It recognizes the string
+// syntax of several languages, but it isn't a full tokenizer, so it
+// may find strings in comments.
+func sqlStringRegions(data []byte) []*Region {
+	var regions []*Region
+	for _, m := range sqlStringPattern.FindAllSubmatchIndex(data, -1) {
+		for i := 2; i < len(m); i += 2 {
+			if m[i] == -1 {
+				continue
+			}
+			if sqlPattern.Match(data[m[i]:m[i+1]]) {
+				regions = append(regions, &Region{Language: "sql", Start: m[i], End: m[i+1]})
+			}
+			break
+		}
+	}
+	return regions
+}
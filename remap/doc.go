@@ -0,0 +1,12 @@
+// Package remap maps byte offsets and spans between two versions of a
+// file, so that positions recorded against one version (such as the
+// version that was built and imported into the store) can be used with
+// another (such as an editor's unsaved buffer).
+//
+// The versions are compared with a line-based diff. Offsets in
+// unchanged lines are shifted by the net size of the changes before
+// them; offsets in changed lines can't be mapped. Optionally, lines
+// that differ only in their line endings (such as a file with LF line
+// endings in the repository and CRLF line endings in a Windows working
+// tree) are treated as unchanged.
+package remap
@@ -0,0 +1,323 @@
+package remap
+
+import "bytes"
+
+// maxEditDistance is the max number of inserted and deleted lines for
+// which New computes a minimal diff. Beyond it, everything between the
+// common leading and trailing lines of the two versions is treated as
+// changed.
+const maxEditDistance = 1000
+
+// A Map maps byte offsets in an old version of a file to a new
+// version. The zero value maps every offset to itself.
+type Map struct {
+	hunks []hunk // changed regions, sorted
+}
+
+// A hunk is a changed region: old[oldStart:oldEnd] was replaced by
+// new[newStart:newEnd]. Either region may be empty.
+type hunk struct {
+	oldStart, oldEnd int
+	newStart, newEnd int
+
+	// eol is whether the hunk only changes a line ending (such as LF
+	// to CRLF). Spans may contain such hunks (see Options).
+	eol bool
+}
+
+// Options configures NewWithOptions.
+type Options struct {
+	// IgnoreLineEndings makes lines that differ only in their line
+	// endings (LF, CRLF, or CR) unchanged, so that spans in them (and
+	// spans across them) can be mapped. It should be used when the
+	// versions may have been checked out on different platforms,
+	// such as a commit with LF line endings and a Windows working
+	// tree with CRLF line endings.
+	IgnoreLineEndings bool
+}
+
+// New returns a Map from offsets in old to offsets in new.
+func New(old, new []byte) *Map {
+	return NewWithOptions(old, new, Options{})
+}
+
+// NewWithOptions returns a Map from offsets in old to offsets in new.
+func NewWithOptions(old, new []byte, opt Options) *Map {
+	if !opt.IgnoreLineEndings {
+		a, b := splitLines(old), splitLines(new)
+		return newMap(a, b, a, b)
+	}
+	a, b := splitLinesAnyEOL(old), splitLinesAnyEOL(new)
+	return newMap(a, b, trimEOLs(a), trimEOLs(b))
+}
+
+// newMap returns a Map from the lines a to the lines b, which are
+// compared by their keys (aKeys and bKeys). Lines with identical keys
+// whose contents differ only differ in their line endings.
+func newMap(a, b, aKeys, bKeys [][]byte) *Map {
+	aOffs, bOffs := lineOffsets(a), lineOffsets(b)
+	m := &Map{}
+	addEOLHunks := func(oldStart, oldEnd, newStart int) {
+		for i, j := oldStart, newStart; i < oldEnd; i, j = i+1, j+1 {
+			if len(a[i]) != len(aKeys[i]) || len(b[j]) != len(bKeys[j]) {
+				if h, changed := eolHunk(a[i][len(aKeys[i]):], b[j][len(bKeys[j]):], aOffs[i]+len(aKeys[i]), bOffs[j]+len(bKeys[j])); changed {
+					m.hunks = append(m.hunks, h)
+				}
+			}
+		}
+	}
+	prevA, prevB := 0, 0
+	for _, h := range diffLines(aKeys, bKeys) {
+		addEOLHunks(prevA, h.oldStart, prevB)
+		m.hunks = append(m.hunks, hunk{
+			oldStart: aOffs[h.oldStart], oldEnd: aOffs[h.oldEnd],
+			newStart: bOffs[h.newStart], newEnd: bOffs[h.newEnd],
+		})
+		prevA, prevB = h.oldEnd, h.newEnd
+	}
+	addEOLHunks(prevA, len(a), prevB)
+	return m
+}
+
+// eolHunk returns the hunk that replaces the line ending oldEOL (at
+// oldOff) with newEOL (at newOff), excluding their common prefix and
+// suffix (e.g., LF to CRLF is the insertion of CR). If they are
+// equal, changed is false.
+func eolHunk(oldEOL, newEOL []byte, oldOff, newOff int) (h hunk, changed bool) {
+	if bytes.Equal(oldEOL, newEOL) {
+		return hunk{}, false
+	}
+	for len(oldEOL) > 0 && len(newEOL) > 0 && oldEOL[0] == newEOL[0] {
+		oldEOL, newEOL = oldEOL[1:], newEOL[1:]
+		oldOff++
+		newOff++
+	}
+	for len(oldEOL) > 0 && len(newEOL) > 0 && oldEOL[len(oldEOL)-1] == newEOL[len(newEOL)-1] {
+		oldEOL, newEOL = oldEOL[:len(oldEOL)-1], newEOL[:len(newEOL)-1]
+	}
+	return hunk{oldStart: oldOff, oldEnd: oldOff + len(oldEOL), newStart: newOff, newEnd: newOff + len(newEOL), eol: true}, true
+}
+
+// Identity returns whether the old and new versions are identical.
+func (m *Map) Identity() bool { return len(m.hunks) == 0 }
+
+// Reverse returns a Map from offsets in the new version to offsets in
+// the old version.
+func (m *Map) Reverse() *Map {
+	r := &Map{hunks: make([]hunk, len(m.hunks))}
+	for i, h := range m.hunks {
+		r.hunks[i] = hunk{oldStart: h.newStart, oldEnd: h.newEnd, newStart: h.oldStart, newEnd: h.oldEnd, eol: h.eol}
+	}
+	return r
+}
+
+// Offset maps the offset of a byte in the old version to its offset
+// in the new version. If the byte was changed (or removed), ok is
+// false. The offset just past the end of the old version maps to the
+// end of the new version.
+func (m *Map) Offset(off int) (newOff int, ok bool) {
+	delta := 0
+	for _, h := range m.hunks {
+		if off < h.oldStart {
+			break
+		}
+		if off < h.oldEnd {
+			return 0, false
+		}
+		delta += (h.newEnd - h.newStart) - (h.oldEnd - h.oldStart)
+	}
+	return off + delta, true
+}
+
+// Span maps the span [start, end) in the old version to the new
+// version. If any byte in the span was changed, or if text was
+// inserted inside of it, ok is false. Changed line endings inside of
+// the span (see Options.IgnoreLineEndings) don't make it !ok, but
+// they change its length.
+func (m *Map) Span(start, end int) (newStart, newEnd int, ok bool) {
+	if end < start {
+		return 0, 0, false
+	}
+	for _, h := range m.hunks {
+		if h.oldStart >= end {
+			break
+		}
+		if h.oldEnd > start && (h.oldStart < h.oldEnd || h.oldStart > start) && !h.eol {
+			return 0, 0, false
+		}
+	}
+	newStart, ok = m.Offset(start)
+	if !ok {
+		return 0, 0, false
+	}
+	if end == start {
+		return newStart, newStart, true
+	}
+	last, ok := m.Offset(end - 1)
+	if !ok {
+		return 0, 0, false
+	}
+	return newStart, last + 1, true
+}
+
+// splitLines splits data into lines, each of which includes its
+// trailing newline (if any).
+func splitLines(data []byte) [][]byte {
+	var lines [][]byte
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines = append(lines, data[:i])
+		data = data[i:]
+	}
+	return lines
+}
+
+// splitLinesAnyEOL is like splitLines, but lines may also end in CR
+// (not followed by LF).
+func splitLinesAnyEOL(data []byte) [][]byte {
+	var lines [][]byte
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "\r\n") + 1
+		if i == 0 {
+			i = len(data)
+		} else if data[i-1] == '\r' && i < len(data) && data[i] == '\n' {
+			i++
+		}
+		lines = append(lines, data[:i])
+		data = data[i:]
+	}
+	return lines
+}
+
+// trimEOLs returns lines without their line endings.
+func trimEOLs(lines [][]byte) [][]byte {
+	trimmed := make([][]byte, len(lines))
+	for i, line := range lines {
+		trimmed[i] = bytes.TrimRight(line, "\r\n")
+	}
+	return trimmed
+}
+
+// lineOffsets returns the byte offset of the start of each line, plus
+// the total length.
+func lineOffsets(lines [][]byte) []int {
+	offs := make([]int, len(lines)+1)
+	for i, line := range lines {
+		offs[i+1] = offs[i] + len(line)
+	}
+	return offs
+}
+
+// diffLines returns the hunks (in line indexes) of a minimal line diff
+// of a and b, computed with Myers' algorithm.
+func diffLines(a, b [][]byte) []hunk {
+	// Skip common leading and trailing lines, which are typically most
+	// of the file in the common case of a small edit.
+	pre := 0
+	for pre < len(a) && pre < len(b) && bytes.Equal(a[pre], b[pre]) {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && bytes.Equal(a[len(a)-1-suf], b[len(b)-1-suf]) {
+		suf++
+	}
+	a, b = a[pre:len(a)-suf], b[pre:len(b)-suf]
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+
+	matches, ok := myersMatches(a, b)
+	if !ok {
+		return []hunk{{oldStart: pre, oldEnd: pre + len(a), newStart: pre, newEnd: pre + len(b)}}
+	}
+
+	// The hunks are the gaps between matching lines.
+	var hunks []hunk
+	prevA, prevB := 0, 0
+	for _, mt := range append(matches, [2]int{len(a), len(b)}) {
+		if mt[0] > prevA || mt[1] > prevB {
+			hunks = append(hunks, hunk{
+				oldStart: pre + prevA, oldEnd: pre + mt[0],
+				newStart: pre + prevB, newEnd: pre + mt[1],
+			})
+		}
+		prevA, prevB = mt[0]+1, mt[1]+1
+	}
+	return hunks
+}
+
+// myersMatches returns the (sorted) index pairs of lines in a and b
+// that are kept by a minimal edit script. If the script's length
+// exceeds maxEditDistance, ok is false.
+func myersMatches(a, b [][]byte) (matches [][2]int, ok bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > maxEditDistance {
+		max = maxEditDistance
+	}
+
+	// v[k+off] is the furthest x reached on diagonal k = x - y.
+	// trace[d][k+d] is v[k+off] after step d.
+	off := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+off] < v[k+1+off]) {
+				x = v[k+1+off] // move down (insert b[y])
+			} else {
+				x = v[k-1+off] + 1 // move right (delete a[x])
+			}
+			y := x - k
+			for x < n && y < m && bytes.Equal(a[x], b[y]) {
+				x++
+				y++
+			}
+			v[k+off] = x
+		}
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		if v[n-m+off] >= n && n-m >= -d && n-m <= d {
+			return backtrack(a, b, trace), true
+		}
+	}
+	return nil, false
+}
+
+// backtrack follows the trace from myersMatches back from (len(a),
+// len(b)) to (0, 0), collecting the matching lines along the way.
+func backtrack(a, b [][]byte, trace [][]int) [][2]int {
+	var matches [][2]int
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		k := x - y
+		var startX, startY, prevX, prevY int
+		if d == 0 {
+			startX, startY = 0, 0
+		} else {
+			prev := func(k int) int { return trace[d-1][k+d-1] }
+			if k == -d || (k != d && prev(k-1) < prev(k+1)) {
+				prevX = prev(k + 1)
+				prevY = prevX - (k + 1)
+				startX, startY = prevX, prevY+1
+			} else {
+				prevX = prev(k - 1)
+				prevY = prevX - (k - 1)
+				startX, startY = prevX+1, prevY
+			}
+		}
+		for x > startX && y > startY {
+			x--
+			y--
+			matches = append(matches, [2]int{x, y})
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches
+}
@@ -0,0 +1,171 @@
+package remap
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestMap(t *testing.T) {
+	old := "package p\n\nfunc A() {}\n\nfunc B() {}\n"
+	new := "package p\n\n// A does nothing.\nfunc A() {}\n\nfunc Bee() {}\n"
+	m := New([]byte(old), []byte(new))
+
+	tests := []struct {
+		word   string // first occurrence in old
+		want   string // expected text at the mapped span in new
+		wantOK bool
+	}{
+		{"package", "package", true},
+		{"A()", "A()", true},
+		{"B()", "", false}, // changed line
+	}
+	for _, test := range tests {
+		start := strings.Index(old, test.word)
+		s, e, ok := m.Span(start, start+len(test.word))
+		if ok != test.wantOK {
+			t.Errorf("%q: got ok %v, want %v", test.word, ok, test.wantOK)
+			continue
+		}
+		if ok && new[s:e] != test.want {
+			t.Errorf("%q: got %q, want %q", test.word, new[s:e], test.want)
+		}
+	}
+
+	if off, ok := m.Offset(len(old)); !ok || off != len(new) {
+		t.Errorf("got EOF offset %d (ok %v), want %d", off, ok, len(new))
+	}
+
+	// Reverse maps back.
+	start := strings.Index(new, "A()")
+	if s, _, ok := m.Reverse().Span(start, start+3); !ok || old[s:s+3] != "A()" {
+		t.Errorf("reverse: got %d (ok %v)", s, ok)
+	}
+}
+
+func TestMap_insertionInSpan(t *testing.T) {
+	old := "a\nb\n"
+	new := "a\nx\nb\n"
+	m := New([]byte(old), []byte(new))
+	if _, _, ok := m.Span(0, len(old)); ok {
+		t.Error("got ok for span containing an insertion, want !ok")
+	}
+	if s, e, ok := m.Span(0, 1); !ok || s != 0 || e != 1 {
+		t.Errorf("got span %d-%d (ok %v) before insertion, want 0-1", s, e, ok)
+	}
+	if s, e, ok := m.Span(2, 3); !ok || new[s:e] != "b" {
+		t.Errorf("got span %d-%d (ok %v) after insertion, want %q", s, e, ok, "b")
+	}
+}
+
+func TestMap_identity(t *testing.T) {
+	data := []byte("a\nb\nc")
+	if m := New(data, data); !m.Identity() {
+		t.Errorf("got hunks %v for identical data, want none", m.hunks)
+	}
+	var m Map
+	if off, ok := m.Offset(7); !ok || off != 7 {
+		t.Errorf("zero Map: got %d (ok %v), want 7", off, ok)
+	}
+}
+
+// TestMap_random checks that every unchanged line is mapped to an
+// identical line and that the diff is minimal.
+func TestMap_random(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	words := []string{"a\n", "b\n", "c\n", "d\n"}
+	for i := 0; i < 200; i++ {
+		var old, new []string
+		for j := r.Intn(20); j > 0; j-- {
+			old = append(old, words[r.Intn(len(words))])
+		}
+		for _, line := range old {
+			switch r.Intn(4) {
+			case 0: // delete
+			case 1: // insert before
+				new = append(new, words[r.Intn(len(words))], line)
+			default:
+				new = append(new, line)
+			}
+		}
+		oldData, newData := strings.Join(old, ""), strings.Join(new, "")
+		m := New([]byte(oldData), []byte(newData))
+		kept := 0
+		for start := 0; start < len(oldData); start += 2 {
+			s, e, ok := m.Span(start, start+2)
+			if !ok {
+				continue
+			}
+			kept++
+			if newData[s:e] != oldData[start:start+2] {
+				t.Fatalf("%q -> %q: line at %d mapped to %q", oldData, newData, start, newData[s:e])
+			}
+		}
+		if want := lcsLen(old, new); kept != want {
+			t.Fatalf("%q -> %q: got %d lines kept, want %d (minimal diff)", oldData, newData, kept, want)
+		}
+	}
+}
+
+// lcsLen returns the length of the longest common subsequence of a and b.
+func lcsLen(a, b []string) int {
+	l := make([][]int, len(a)+1)
+	for i := range l {
+		l[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				l[i][j] = l[i+1][j+1] + 1
+			case l[i+1][j] > l[i][j+1]:
+				l[i][j] = l[i+1][j]
+			default:
+				l[i][j] = l[i][j+1]
+			}
+		}
+	}
+	return l[0][0]
+}
+
+func TestMap_ignoreLineEndings(t *testing.T) {
+	old := "package p\n\nfunc A() {\n}\n\nfunc B() {}\n"
+	tests := map[string]string{
+		"CRLF":  "package p\r\n\r\nfunc A() {\r\n}\r\n\r\nfunc B() {}\r\n",
+		"CR":    "package p\r\rfunc A() {\r}\r\rfunc B() {}\r",
+		"mixed": "package p\r\n\nfunc A() {\r\n}\r\r\nfunc B() {}",
+	}
+	for label, new := range tests {
+		if m := New([]byte(old), []byte(new)); m.hunks[0].oldStart != 0 {
+			t.Errorf("%s: without IgnoreLineEndings, got first hunk %+v, want the first line changed", label, m.hunks[0])
+		}
+		m := NewWithOptions([]byte(old), []byte(new), Options{IgnoreLineEndings: true})
+		for _, word := range []string{"package", "B()", "func A() {\n}"} {
+			start := strings.Index(old, word)
+			s, e, ok := m.Span(start, start+len(word))
+			if !ok {
+				t.Errorf("%s: %q: got !ok", label, word)
+				continue
+			}
+			want := strings.Replace(word, "\n", new[strings.Index(new, "{")+1:strings.Index(new, "}")], -1)
+			if new[s:e] != want {
+				t.Errorf("%s: %q: got %q, want %q", label, word, new[s:e], want)
+			}
+			if rs, re, ok := m.Reverse().Span(s, e); !ok || rs != start || re != start+len(word) {
+				t.Errorf("%s: %q: reverse: got %d-%d (ok %v), want %d-%d", label, word, rs, re, ok, start, start+len(word))
+			}
+		}
+		if off, ok := m.Offset(len(old)); !ok || off != len(new) {
+			t.Errorf("%s: got EOF offset %d (ok %v), want %d", label, off, ok, len(new))
+		}
+	}
+
+	// Changed lines still can't be mapped.
+	m := NewWithOptions([]byte("a\nb\nc\n"), []byte("a\r\nx\r\nc\r\n"), Options{IgnoreLineEndings: true})
+	if _, _, ok := m.Span(2, 3); ok {
+		t.Error("got ok for changed line, want !ok")
+	}
+	if s, e, ok := m.Span(4, 5); !ok || s != 6 || e != 7 {
+		t.Errorf("got span %d-%d (ok %v) after changed line, want 6-7", s, e, ok)
+	}
+}
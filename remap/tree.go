@@ -0,0 +1,124 @@
+package remap
+
+import (
+	"bytes"
+	"os"
+	"sync"
+)
+
+// A Tree maps spans in the files of a base version of a tree (such as
+// the commit whose build data is in the store) to the same files in a
+// current version (such as the working tree, possibly with unsaved
+// editor buffers). It is safe for concurrent use.
+type Tree struct {
+	// Base and Current read a file (given its path relative to the
+	// tree root) in the base and current versions, respectively. If
+	// the file doesn't exist in that version, they return an error
+	// satisfying os.IsNotExist.
+	Base, Current func(file string) ([]byte, error)
+
+	// IgnoreLineEndings makes lines that differ only in their line
+	// endings unchanged (see Options.IgnoreLineEndings).
+	IgnoreLineEndings bool
+
+	mu    sync.Mutex
+	files map[string]*treeFile
+}
+
+// treeFile holds the cached Maps of a file. They are recomputed when
+// the file's current contents change.
+type treeFile struct {
+	base    []byte
+	noBase  bool // whether the file doesn't exist in the base version
+	current []byte
+
+	m, rev *Map
+}
+
+// A Span is a span mapped by (*Tree).Span.
+type Span struct {
+	Start, End int
+
+	// Modified is whether the span was changed (or deleted) in the
+	// current version. If so, Start and End are the (unmapped)
+	// offsets of the span in the base version.
+	Modified bool
+}
+
+// Span maps the span [start, end) in file in the base version to the
+// current version. Spans in files that don't exist in the base
+// version are mapped unchanged (since they weren't built from it).
+func (t *Tree) Span(file string, start, end int) (Span, error) {
+	m, _, err := t.maps(file)
+	if os.IsNotExist(err) {
+		return Span{Start: start, End: end, Modified: true}, nil
+	} else if err != nil {
+		return Span{}, err
+	}
+	s, e, ok := m.Span(start, end)
+	if !ok {
+		return Span{Start: start, End: end, Modified: true}, nil
+	}
+	return Span{Start: s, End: e}, nil
+}
+
+// BaseOffset maps the offset of a byte in file in the current version
+// to its offset in the base version. If the byte was added or changed
+// in the current version, ok is false.
+func (t *Tree) BaseOffset(file string, off int) (baseOff int, ok bool, err error) {
+	_, rev, err := t.maps(file)
+	if err != nil {
+		return 0, false, err
+	}
+	baseOff, ok = rev.Offset(off)
+	return baseOff, ok, nil
+}
+
+// Invalidate discards the cached base contents of file (e.g., because
+// the base version changed).
+func (t *Tree) Invalidate(file string) {
+	t.mu.Lock()
+	delete(t.files, file)
+	t.mu.Unlock()
+}
+
+// maps returns the Maps from the base to the current version of file,
+// and vice versa. If the file doesn't exist in the current version,
+// an error satisfying os.IsNotExist is returned.
+func (t *Tree) maps(file string) (m, rev *Map, err error) {
+	current, err := t.Current(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t.mu.Lock()
+	f := t.files[file]
+	t.mu.Unlock()
+	if f == nil {
+		f = &treeFile{}
+		f.base, err = t.Base(file)
+		if os.IsNotExist(err) {
+			f.noBase = true
+		} else if err != nil {
+			return nil, nil, err
+		}
+	} else if f.m != nil && bytes.Equal(f.current, current) {
+		return f.m, f.rev, nil
+	}
+
+	f2 := &treeFile{base: f.base, noBase: f.noBase, current: current}
+	if f2.noBase {
+		f2.m = &Map{}
+	} else {
+		f2.m = NewWithOptions(f2.base, current, Options{IgnoreLineEndings: t.IgnoreLineEndings})
+	}
+	f2.rev = f2.m.Reverse()
+
+	t.mu.Lock()
+	if t.files == nil {
+		t.files = map[string]*treeFile{}
+	}
+	t.files[file] = f2
+	t.mu.Unlock()
+	return f2.m, f2.rev, nil
+}
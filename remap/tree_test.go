@@ -0,0 +1,57 @@
+package remap
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	base := map[string]string{
+		"a.go": "package a\n\nvar X = 1\n",
+		"b.go": "package b\n",
+	}
+	current := map[string]string{
+		"a.go": "package a\n\n// X is one.\nvar X = 1\n",
+		"c.go": "package c\n", // not in base
+	}
+	read := func(files map[string]string) func(string) ([]byte, error) {
+		return func(file string) ([]byte, error) {
+			data, ok := files[file]
+			if !ok {
+				return nil, &os.PathError{Op: "read", Path: file, Err: os.ErrNotExist}
+			}
+			return []byte(data), nil
+		}
+	}
+	tree := &Tree{Base: read(base), Current: read(current)}
+
+	tests := []struct {
+		file       string
+		start, end int
+		want       Span
+	}{
+		{"a.go", 15, 16, Span{Start: 28, End: 29}}, // X
+		{"a.go", 0, 7, Span{Start: 0, End: 7}},     // package
+		{"b.go", 0, 7, Span{Start: 0, End: 7, Modified: true}},
+		{"c.go", 8, 9, Span{Start: 8, End: 9}},
+	}
+	for _, test := range tests {
+		got, err := tree.Span(test.file, test.start, test.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%s:%d-%d: got %+v, want %+v", test.file, test.start, test.end, got, test.want)
+		}
+	}
+
+	if off, ok, err := tree.BaseOffset("a.go", 28); err != nil || !ok || off != 15 {
+		t.Errorf("got base offset %d (ok %v, err %v), want 15", off, ok, err)
+	}
+
+	// Changes to the current version are picked up.
+	current["a.go"] = base["a.go"]
+	if got, _ := tree.Span("a.go", 15, 16); got != (Span{Start: 15, End: 16}) {
+		t.Errorf("after edit: got %+v, want unchanged span", got)
+	}
+}
@@ -0,0 +1,110 @@
+package review
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A FileDiff is the changes to a file in a unified diff (such as the
+// output of `git diff`).
+type FileDiff struct {
+	// OldName and NewName are the file's paths (relative to the
+	// repository root) before and after the change. OldName is empty
+	// for added files, and NewName is empty for deleted files.
+	OldName, NewName string
+
+	Hunks []Hunk
+}
+
+// A Hunk is a changed region of a file: the OldLines lines starting
+// at line OldStart were replaced by the NewLines lines starting at
+// line NewStart. Lines are 1-based. If a region is empty, its start is
+// the line after which lines were inserted (or deleted).
+type Hunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+}
+
+// ParseDiff parses a unified diff with git-style headers ("diff
+// --git", "--- a/FILE", and "+++ b/FILE"). Hunk contents are skipped,
+// since only the hunks' line ranges are needed, so diffs with no
+// context (`git diff -U0`) are the cheapest to parse.
+func ParseDiff(r io.Reader) ([]*FileDiff, error) {
+	var diffs []*FileDiff
+	var cur *FileDiff
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for lineNum := 1; s.Scan(); lineNum++ {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "diff "):
+			cur = &FileDiff{}
+			diffs = append(diffs, cur)
+		case cur == nil:
+			// Skip any preamble (such as a commit message).
+		case strings.HasPrefix(line, "--- ") && len(cur.Hunks) == 0:
+			cur.OldName = diffFileName(line[len("--- "):], "a/")
+		case strings.HasPrefix(line, "+++ ") && len(cur.Hunks) == 0:
+			cur.NewName = diffFileName(line[len("+++ "):], "b/")
+		case strings.HasPrefix(line, "@@ "):
+			h, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("diff line %d: %s", lineNum, err)
+			}
+			cur.Hunks = append(cur.Hunks, h)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return diffs, nil
+}
+
+// diffFileName returns the file name in a "---" or "+++" header, or
+// "" for /dev/null.
+func diffFileName(name, prefix string) string {
+	if i := strings.IndexByte(name, '\t'); i != -1 {
+		name = name[:i] // strip the timestamp
+	}
+	if name == "/dev/null" {
+		return ""
+	}
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		name = unquoted
+	}
+	return strings.TrimPrefix(name, prefix)
+}
+
+// parseHunkHeader parses a hunk header such as "@@ -1,2 +3,4 @@".
+func parseHunkHeader(line string) (Hunk, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[3] != "@@" || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return Hunk{}, fmt.Errorf("invalid hunk header %q", line)
+	}
+	var h Hunk
+	var err error
+	if h.OldStart, h.OldLines, err = parseHunkRange(fields[1][1:]); err != nil {
+		return Hunk{}, fmt.Errorf("invalid hunk header %q: %s", line, err)
+	}
+	if h.NewStart, h.NewLines, err = parseHunkRange(fields[2][1:]); err != nil {
+		return Hunk{}, fmt.Errorf("invalid hunk header %q: %s", line, err)
+	}
+	return h, nil
+}
+
+// parseHunkRange parses a hunk range such as "3,4" or "3" (which is
+// 1 line long).
+func parseHunkRange(s string) (start, lines int, err error) {
+	lines = 1
+	if i := strings.IndexByte(s, ','); i != -1 {
+		if lines, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, err
+		}
+		s = s[:i]
+	}
+	start, err = strconv.Atoi(s)
+	return start, lines, err
+}
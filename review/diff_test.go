@@ -0,0 +1,57 @@
+package review
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+	diff := `commit message preamble
+diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -3 +3,2 @@ func A() {
+-	x := 1
++	x := 2
++	y := 3
+@@ -10,2 +11,0 @@
+-a
+-b
+diff --git a/old.go b/old.go
+deleted file mode 100644
+--- a/old.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package p
+-
+diff --git "a/new file.go" "b/new file.go"
+new file mode 100644
+--- /dev/null
++++ "b/new file.go"
+@@ -0,0 +1 @@
++package p
+`
+	diffs, err := ParseDiff(strings.NewReader(diff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*FileDiff{
+		{OldName: "a.go", NewName: "a.go", Hunks: []Hunk{{3, 1, 3, 2}, {10, 2, 11, 0}}},
+		{OldName: "old.go", Hunks: []Hunk{{1, 2, 0, 0}}},
+		{NewName: "new file.go", Hunks: []Hunk{{0, 0, 1, 1}}},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		for _, d := range diffs {
+			t.Logf("%+v", d)
+		}
+		t.Errorf("got diffs above, want %+v", want)
+	}
+}
+
+func TestParseDiff_invalidHunk(t *testing.T) {
+	if _, err := ParseDiff(strings.NewReader("diff --git a/a b/a\n@@ -x +1 @@\n")); err == nil {
+		t.Error("got no error, want an error")
+	}
+}
@@ -0,0 +1,44 @@
+package review
+
+import "context"
+
+// A Forge is a code host (such as GitHub) on which review feedback can
+// be posted on pull requests. Other forges (such as GitLab, whose merge
+// requests are its pull requests) are supported by implementing it.
+type Forge interface {
+	// Comment posts comments on lines of the pull request's files as
+	// a review of its head commit.
+	Comment(ctx context.Context, pr *PullRequest, comments []*Comment) error
+
+	// Check posts a check on the pull request's head commit, which is
+	// shown with the commit's build status.
+	Check(ctx context.Context, pr *PullRequest, check *Check) error
+}
+
+// A PullRequest identifies a pull request on a forge.
+type PullRequest struct {
+	// Repo is the name of the repository on the forge (such as
+	// "owner/name" on GitHub).
+	Repo string
+
+	Number int
+
+	// HeadCommitID is the full ID of the pull request's head commit,
+	// which comments and checks are posted on.
+	HeadCommitID string
+}
+
+// A Comment is a review comment on a line of a file.
+type Comment struct {
+	File string // relative to the repository root
+	Line int    // 1-based, in the head commit's version of the file
+	Body string // Markdown
+}
+
+// A Check is the result of an analysis of a commit. Checks are
+// informational: they never fail the commit.
+type Check struct {
+	Name    string // name of the analysis (such as "srclib")
+	Title   string // one-line summary
+	Summary string // Markdown
+}
@@ -0,0 +1,114 @@
+package review
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// GitHub is a Forge that posts to GitHub (or GitHub Enterprise) with
+// its REST API.
+type GitHub struct {
+	// BaseURL is the API URL. If empty, "https://api.github.com" is
+	// used. For GitHub Enterprise, it is "https://HOST/api/v3".
+	BaseURL string
+
+	// Token authenticates the requests. Posting checks requires a
+	// GitHub App installation token (such as the GITHUB_TOKEN of a
+	// GitHub Actions workflow); posting comments also works with a
+	// personal access token.
+	Token string
+
+	// Client makes the HTTP requests. If nil, http.DefaultClient is
+	// used.
+	Client *http.Client
+}
+
+var _ Forge = (*GitHub)(nil)
+
+// githubReviewComment is a comment in a GitHub pull request review.
+type githubReviewComment struct {
+	Path string `json:"path"`
+	Line int    `json:"line"`
+	Side string `json:"side"`
+	Body string `json:"body"`
+}
+
+// Comment implements Forge.
+func (g *GitHub) Comment(ctx context.Context, pr *PullRequest, comments []*Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	review := struct {
+		CommitID string                 `json:"commit_id"`
+		Event    string                 `json:"event"`
+		Comments []*githubReviewComment `json:"comments"`
+	}{CommitID: pr.HeadCommitID, Event: "COMMENT"}
+	for _, c := range comments {
+		review.Comments = append(review.Comments, &githubReviewComment{Path: c.File, Line: c.Line, Side: "RIGHT", Body: c.Body})
+	}
+	return g.post(ctx, fmt.Sprintf("/repos/%s/pulls/%d/reviews", pr.Repo, pr.Number), review)
+}
+
+// Check implements Forge.
+func (g *GitHub) Check(ctx context.Context, pr *PullRequest, check *Check) error {
+	type output struct {
+		Title   string `json:"title"`
+		Summary string `json:"summary"`
+	}
+	run := struct {
+		Name       string `json:"name"`
+		HeadSHA    string `json:"head_sha"`
+		Status     string `json:"status"`
+		Conclusion string `json:"conclusion"`
+		Output     output `json:"output"`
+	}{
+		Name:       check.Name,
+		HeadSHA:    pr.HeadCommitID,
+		Status:     "completed",
+		Conclusion: "neutral",
+		Output:     output{Title: check.Title, Summary: check.Summary},
+	}
+	return g.post(ctx, fmt.Sprintf("/repos/%s/check-runs", pr.Repo), run)
+}
+
+// post POSTs v as JSON to the API path.
+func (g *GitHub) post(ctx context.Context, path string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	baseURL := g.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(baseURL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		return fmt.Errorf("POST %s: HTTP status %s: %s", path, resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package review
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGitHub(t *testing.T) {
+	var paths []string
+	var bodies []map[string]interface{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer t" {
+			http.Error(w, "bad token "+auth, http.StatusUnauthorized)
+			return
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		paths = append(paths, r.URL.Path)
+		bodies = append(bodies, body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer s.Close()
+
+	g := &GitHub{BaseURL: s.URL, Token: "t"}
+	pr := &PullRequest{Repo: "o/r", Number: 7, HeadCommitID: "c"}
+	ctx := context.Background()
+	if err := g.Comment(ctx, pr, []*Comment{{File: "a.go", Line: 3, Body: "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Check(ctx, pr, &Check{Name: "srclib", Title: "T", Summary: "S"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"/repos/o/r/pulls/7/reviews", "/repos/o/r/check-runs"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got requests to %v, want %v", paths, want)
+	}
+	wantReview := map[string]interface{}{
+		"commit_id": "c",
+		"event":     "COMMENT",
+		"comments":  []interface{}{map[string]interface{}{"path": "a.go", "line": 3.0, "side": "RIGHT", "body": "x"}},
+	}
+	if !reflect.DeepEqual(bodies[0], wantReview) {
+		t.Errorf("got review %v, want %v", bodies[0], wantReview)
+	}
+	if b := bodies[1]; b["head_sha"] != "c" || b["conclusion"] != "neutral" || !reflect.DeepEqual(b["output"], map[string]interface{}{"title": "T", "summary": "S"}) {
+		t.Errorf("got check run %v", b)
+	}
+
+	g.Token = "bad"
+	if err := g.Check(ctx, pr, &Check{Name: "srclib"}); err == nil {
+		t.Error("got no error with a bad token, want an error")
+	}
+}
@@ -0,0 +1,243 @@
+// Package review computes the defs that a change (such as a pull
+// request) modifies and how widely they are used, and reports them as
+// review comments and check summaries on code hosts ("forges").
+package review
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// A Change is a def that a diff modifies.
+type Change struct {
+	Def *graph.Def
+
+	// Line is the first line of the def's definition that the diff
+	// changed (1-based, in the new version of the def's file). Review
+	// comments about the change are placed on it.
+	Line int
+
+	// Refs is the number of refs to the def (other than its def
+	// refs), and Repos are the URIs of the repositories that they are
+	// in, sorted. They are set by SetRefs.
+	Refs  int
+	Repos []string
+}
+
+// ChangedDefs returns the changes to defs whose definitions contain
+// lines that diffs added or changed, or from which diffs deleted
+// lines, sorted by file and line. defs are the defs in the new version
+// of the repository, and readFile returns the new version of a file
+// (which is needed to convert the defs' byte offsets to lines).
+func ChangedDefs(diffs []*FileDiff, defs []*graph.Def, readFile func(file string) ([]byte, error)) ([]*Change, error) {
+	hunksByFile := make(map[string][]Hunk, len(diffs))
+	for _, d := range diffs {
+		if d.NewName != "" {
+			hunksByFile[d.NewName] = append(hunksByFile[d.NewName], d.Hunks...)
+		}
+	}
+
+	lineStarts := map[string][]int{}
+	var changes []*Change
+	for _, def := range defs {
+		hunks := hunksByFile[def.File]
+		if len(hunks) == 0 || def.DefEnd <= def.DefStart {
+			continue
+		}
+		starts, ok := lineStarts[def.File]
+		if !ok {
+			src, err := readFile(def.File)
+			if err != nil {
+				return nil, err
+			}
+			starts = lineStartOffsets(src)
+			lineStarts[def.File] = starts
+		}
+		first, last := lineAt(starts, def.DefStart), lineAt(starts, def.DefEnd-1)
+		if line := firstChangedLine(hunks, first, last); line != 0 {
+			changes = append(changes, &Change{Def: def, Line: line})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Def.File != b.Def.File {
+			return a.Def.File < b.Def.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Def.Path < b.Def.Path
+	})
+	return changes, nil
+}
+
+// firstChangedLine returns the first line in [first, last] that hunks
+// changed, or 0 if there is none. For a hunk that only deleted lines,
+// the line before the deletion is returned if the deletion was inside
+// of [first, last].
+func firstChangedLine(hunks []Hunk, first, last int) int {
+	var min int
+	for _, h := range hunks {
+		var line int
+		if h.NewLines == 0 {
+			if h.NewStart >= first && h.NewStart < last {
+				line = h.NewStart
+			}
+		} else if start, end := h.NewStart, h.NewStart+h.NewLines-1; start <= last && end >= first {
+			line = start
+			if line < first {
+				line = first
+			}
+		}
+		if line != 0 && (min == 0 || line < min) {
+			min = line
+		}
+	}
+	return min
+}
+
+// lineStartOffsets returns the byte offset of the start of each line
+// of src.
+func lineStartOffsets(src []byte) []int {
+	starts := []int{0}
+	for i, b := range src {
+		if b == '\n' && i+1 < len(src) {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// lineAt returns the (1-based) line that contains the byte offset.
+func lineAt(lineStarts []int, offset uint32) int {
+	return sort.Search(len(lineStarts), func(i int) bool { return lineStarts[i] > int(offset) })
+}
+
+// SetRefs sets c.Refs and c.Repos from refs, the refs to c.Def. Def
+// refs are not counted, and refs that appear more than once (such as
+// those in several commits of a repository) are counted once.
+func (c *Change) SetRefs(refs []*graph.Ref) {
+	type refKey struct {
+		repo, unitType, unit, file string
+		start, end                 uint32
+	}
+	seen := map[refKey]struct{}{}
+	repos := map[string]struct{}{}
+	c.Refs, c.Repos = 0, nil
+	for _, ref := range refs {
+		if ref.Def {
+			continue
+		}
+		k := refKey{ref.Repo, ref.UnitType, ref.Unit, ref.File, ref.Start, ref.End}
+		if _, dup := seen[k]; dup {
+			continue
+		}
+		seen[k] = struct{}{}
+		c.Refs++
+		if _, present := repos[ref.Repo]; !present {
+			repos[ref.Repo] = struct{}{}
+			c.Repos = append(c.Repos, ref.Repo)
+		}
+	}
+	sort.Strings(c.Repos)
+}
+
+// Title returns a one-line summary of changes, such as "This change
+// modifies a def with 1,243 references across 14 repos."
+func Title(changes []*Change) string {
+	if len(changes) == 0 {
+		return "This change modifies no defs."
+	}
+	var refs int
+	repos := map[string]struct{}{}
+	for _, c := range changes {
+		refs += c.Refs
+		for _, repo := range c.Repos {
+			repos[repo] = struct{}{}
+		}
+	}
+	defs := "a def"
+	if len(changes) > 1 {
+		defs = formatCount(len(changes)) + " defs"
+	}
+	return fmt.Sprintf("This change modifies %s with %s across %s.", defs, plural(refs, "reference"), plural(len(repos), "repo"))
+}
+
+// Summary returns a Markdown summary of changes (for a check run or a
+// pull request comment): the title and a table of the changed defs,
+// most-referenced first.
+func Summary(changes []*Change) string {
+	var buf bytes.Buffer
+	buf.WriteString(Title(changes))
+	buf.WriteString("\n")
+	if len(changes) == 0 {
+		return buf.String()
+	}
+	sorted := make([]*Change, len(changes))
+	copy(sorted, changes)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Refs > sorted[j].Refs })
+
+	buf.WriteString("\n| Def | Location | References | Repos |\n| --- | --- | ---: | ---: |\n")
+	for _, c := range sorted {
+		fmt.Fprintf(&buf, "| %s | %s:%d | %s | %s |\n", defName(c.Def), markdownEscaper.Replace(c.Def.File), c.Line, formatCount(c.Refs), formatCount(len(c.Repos)))
+	}
+	return buf.String()
+}
+
+// Comments returns a review comment on each change, such as "This
+// change modifies `Foo` (func), which has 1,243 references across 14
+// repos."
+func Comments(changes []*Change) []*Comment {
+	comments := make([]*Comment, len(changes))
+	for i, c := range changes {
+		comments[i] = &Comment{
+			File: c.Def.File,
+			Line: c.Line,
+			Body: fmt.Sprintf("This change modifies %s, which has %s across %s.", defName(c.Def), plural(c.Refs, "reference"), plural(len(c.Repos), "repo")),
+		}
+	}
+	return comments
+}
+
+// defName returns the def's name (and kind) in Markdown.
+func defName(def *graph.Def) string {
+	name := def.Name
+	if name == "" {
+		name = def.Path
+	}
+	s := "`" + strings.Replace(name, "`", "", -1) + "`"
+	if def.Kind != "" {
+		s += " (" + markdownEscaper.Replace(def.Kind) + ")"
+	}
+	return s
+}
+
+// markdownEscaper escapes the Markdown (and table) syntax characters
+// that may appear in file names and def kinds.
+var markdownEscaper = strings.NewReplacer(`|`, `\|`, `*`, `\*`, `_`, `\_`, "`", "\\`", `[`, `\[`, `]`, `\]`)
+
+// plural returns the count and noun, such as "1 repo" or "1,243
+// references".
+func plural(n int, noun string) string {
+	if n != 1 {
+		noun += "s"
+	}
+	return formatCount(n) + " " + noun
+}
+
+// formatCount formats n with thousands separators (such as "1,243").
+func formatCount(n int) string {
+	s := strconv.Itoa(n)
+	if n < 0 {
+		return "-" + formatCount(-n)
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
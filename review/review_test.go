@@ -0,0 +1,116 @@
+package review
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestChangedDefs(t *testing.T) {
+	src := "package p\n\nfunc A() {\n\tx := 1\n}\n\nfunc B() {}\nfunc C() {}\n"
+	def := func(name, text string) *graph.Def {
+		start := strings.Index(src, text)
+		return &graph.Def{DefKey: graph.DefKey{Path: name}, Name: name, File: "p.go", DefStart: uint32(start), DefEnd: uint32(start + len(text))}
+	}
+	a, b, c := def("A", "func A() {\n\tx := 1\n}"), def("B", "func B() {}"), def("C", "func C() {}")
+	other := &graph.Def{DefKey: graph.DefKey{Path: "D"}, File: "q.go", DefStart: 0, DefEnd: 10}
+
+	diffs := []*FileDiff{{
+		OldName: "p.go", NewName: "p.go",
+		// Line 4 (in A) changed, lines were deleted after line 7 (B,
+		// which isn't inside of it), and line 8 (C) changed.
+		Hunks: []Hunk{{4, 1, 4, 1}, {8, 1, 7, 0}, {9, 1, 8, 1}},
+	}}
+	readFile := func(file string) ([]byte, error) {
+		if file != "p.go" {
+			t.Errorf("read unexpected file %q", file)
+		}
+		return []byte(src), nil
+	}
+	changes, err := ChangedDefs(diffs, []*graph.Def{c, other, b, a}, readFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*Change{{Def: a, Line: 4}, {Def: c, Line: 8}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("got %+v, want %+v", changes, want)
+	}
+}
+
+func TestFirstChangedLine(t *testing.T) {
+	tests := []struct {
+		hunks       []Hunk
+		first, last int
+		want        int
+	}{
+		{[]Hunk{{NewStart: 1, NewLines: 2}}, 3, 5, 0},
+		{[]Hunk{{NewStart: 2, NewLines: 2}}, 3, 5, 3},
+		{[]Hunk{{NewStart: 6, NewLines: 1}, {NewStart: 4, NewLines: 1}}, 3, 5, 4},
+		{[]Hunk{{NewStart: 3, NewLines: 0}}, 3, 5, 3}, // deletion after the first line
+		{[]Hunk{{NewStart: 5, NewLines: 0}}, 3, 5, 0}, // deletion after the last line
+		{[]Hunk{{NewStart: 2, NewLines: 0}}, 3, 5, 0}, // deletion before the first line
+	}
+	for _, test := range tests {
+		if got := firstChangedLine(test.hunks, test.first, test.last); got != test.want {
+			t.Errorf("%+v in lines %d-%d: got %d, want %d", test.hunks, test.first, test.last, got, test.want)
+		}
+	}
+}
+
+func TestChange_SetRefs(t *testing.T) {
+	refs := []*graph.Ref{
+		{Repo: "r", CommitID: "c1", File: "a.go", Start: 1, End: 2, Def: true},
+		{Repo: "r", CommitID: "c1", File: "a.go", Start: 5, End: 6},
+		{Repo: "r", CommitID: "c2", File: "a.go", Start: 5, End: 6}, // same ref at another commit
+		{Repo: "s", File: "b.go", Start: 5, End: 6},
+		{Repo: "q", File: "b.go", Start: 5, End: 6},
+	}
+	var c Change
+	c.SetRefs(refs)
+	if c.Refs != 3 || !reflect.DeepEqual(c.Repos, []string{"q", "r", "s"}) {
+		t.Errorf("got %d refs in repos %v, want 3 in [q r s]", c.Refs, c.Repos)
+	}
+}
+
+func TestTitle(t *testing.T) {
+	def := &graph.Def{DefKey: graph.DefKey{Path: "F"}, Name: "F", Kind: "func", File: "a.go"}
+	tests := []struct {
+		changes []*Change
+		want    string
+	}{
+		{nil, "This change modifies no defs."},
+		{
+			[]*Change{{Def: def, Refs: 1243, Repos: []string{"a"}}},
+			"This change modifies a def with 1,243 references across 1 repo.",
+		},
+		{
+			[]*Change{{Def: def, Refs: 1, Repos: []string{"a"}}, {Def: def, Refs: 1000, Repos: []string{"a", "b"}}},
+			"This change modifies 2 defs with 1,001 references across 2 repos.",
+		},
+	}
+	for _, test := range tests {
+		if got := Title(test.changes); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	def := &graph.Def{DefKey: graph.DefKey{Path: "F"}, Name: "F", Kind: "func", File: "a.go"}
+	comments := Comments([]*Change{{Def: def, Line: 3, Refs: 2, Repos: []string{"r"}}})
+	want := []*Comment{{File: "a.go", Line: 3, Body: "This change modifies `F` (func), which has 2 references across 1 repo."}}
+	if !reflect.DeepEqual(comments, want) {
+		t.Errorf("got %+v, want %+v", comments, want)
+	}
+}
+
+func TestFormatCount(t *testing.T) {
+	tests := map[int]string{0: "0", 999: "999", 1000: "1,000", 1243: "1,243", 1234567: "1,234,567", -1000: "-1,000"}
+	for n, want := range tests {
+		if got := formatCount(n); got != want {
+			t.Errorf("%d: got %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package scan
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// A Conflict describes source units from different scanners that claim
+// the same files (or that have the same ID). The conflict is resolved in
+// favor of Winner: the files are removed from Loser, and Loser is
+// dropped if it has no files left.
+type Conflict struct {
+	Winner, Loser unit.ID2
+
+	// WinnerScanner and LoserScanner are the indexes (in the list of
+	// scanners passed to ScanMulti) of the scanners that produced
+	// Winner and Loser.
+	WinnerScanner, LoserScanner int
+
+	// Files are the files claimed by both source units.
+	Files []string `json:",omitempty"`
+
+	// Dropped is whether Loser was dropped entirely.
+	Dropped bool
+
+	// Reason describes why Winner won.
+	Reason string
+}
+
+func (c *Conflict) String() string {
+	var what string
+	if len(c.Files) > 0 {
+		what = fmt.Sprintf("both claim %d files (e.g., %s); assigning them to %s", len(c.Files), c.Files[0], c.Winner)
+	} else {
+		what = fmt.Sprintf("are duplicates; keeping %s", c.Winner)
+	}
+	s := fmt.Sprintf("source units %s and %s %s (%s)", c.Winner, c.Loser, what, c.Reason)
+	if c.Dropped {
+		s += fmt.Sprintf("; dropping %s", c.Loser)
+	}
+	return s
+}
+
+// claim is a source unit produced by a scanner.
+type claim struct {
+	u        *unit.SourceUnit
+	scanner  int
+	priority int
+}
+
+// depth returns the depth of the claim's source unit's directory (or
+// the directory of its first file, if it has no Dir).
+func (c *claim) depth() int {
+	dir := c.u.Dir
+	if dir == "" && len(c.u.Files) > 0 {
+		dir = path.Dir(c.u.Files[0])
+	}
+	dir = path.Clean(dir)
+	if dir == "." || dir == "/" {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+// prefer returns whether a should win a conflict with b, and the reason.
+// The rules are, in order: higher scanner priority wins; the source unit
+// in the more deeply nested directory wins; the source unit with fewer
+// files wins; and the source unit from the scanner listed first wins.
+// If all else is equal, the source unit with the lesser ID wins, so that
+// resolution is deterministic.
+func prefer(a, b *claim) (bool, string) {
+	if a.priority != b.priority {
+		return a.priority > b.priority, "higher scanner priority"
+	}
+	if da, db := a.depth(), b.depth(); da != db {
+		return da > db, "more specific directory"
+	}
+	if na, nb := len(a.u.Files), len(b.u.Files); na != nb {
+		return na < nb, "fewer files"
+	}
+	if a.scanner != b.scanner {
+		return a.scanner < b.scanner, "scanner listed first"
+	}
+	return a.u.String() < b.u.String(), "lesser source unit ID"
+}
+
+// MergeUnits merges the source units produced by multiple scanners.
+// byScanner[i] is the list of source units produced by the i'th
+// scanner, and priorities[i] is its priority (higher wins); priorities
+// may be nil, in which case all scanners have equal priority.
+//
+// Files claimed by source units from different scanners are assigned to
+// a single source unit (see prefer for the rules), and source units
+// that are left with no files or that duplicate the ID of another
+// scanner's source unit are dropped. The conflicts are returned.
+// Overlapping source units from the same scanner are left as-is.
+func MergeUnits(byScanner [][]*unit.SourceUnit, priorities []int) ([]*unit.SourceUnit, []*Conflict) {
+	var claims []*claim
+	claimsByFile := map[string][]*claim{}
+	for i, units := range byScanner {
+		var p int
+		if i < len(priorities) {
+			p = priorities[i]
+		}
+		for _, u := range units {
+			c := &claim{u: u, scanner: i, priority: p}
+			claims = append(claims, c)
+			for _, f := range u.Files {
+				claimsByFile[f] = append(claimsByFile[f], c)
+			}
+		}
+	}
+
+	files := make([]string, 0, len(claimsByFile))
+	for f := range claimsByFile {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+
+	type pair struct{ winner, loser *claim }
+	var conflicts []*Conflict
+	conflictsByPair := map[pair]*Conflict{}
+	lost := map[*claim]map[string]bool{}
+	addConflict := func(w, l *claim, reason string) *Conflict {
+		k := pair{w, l}
+		c, present := conflictsByPair[k]
+		if !present {
+			c = &Conflict{Winner: w.u.ID2(), Loser: l.u.ID2(), WinnerScanner: w.scanner, LoserScanner: l.scanner, Reason: reason}
+			conflictsByPair[k] = c
+			conflicts = append(conflicts, c)
+		}
+		return c
+	}
+
+	for _, f := range files {
+		cs := claimsByFile[f]
+		w := cs[0]
+		for _, c := range cs[1:] {
+			if ok, _ := prefer(c, w); ok {
+				w = c
+			}
+		}
+		for _, c := range cs {
+			if c.scanner == w.scanner {
+				continue
+			}
+			_, reason := prefer(w, c)
+			conflict := addConflict(w, c, reason)
+			conflict.Files = append(conflict.Files, f)
+			if lost[c] == nil {
+				lost[c] = map[string]bool{}
+			}
+			lost[c][f] = true
+		}
+	}
+
+	// Remove lost files and drop source units with no files left.
+	dropped := map[*claim]bool{}
+	for _, c := range claims {
+		if len(lost[c]) == 0 {
+			continue
+		}
+		var keep []string
+		for _, f := range c.u.Files {
+			if !lost[c][f] {
+				keep = append(keep, f)
+			}
+		}
+		c.u.Files = keep
+		if len(keep) == 0 {
+			dropped[c] = true
+		}
+	}
+
+	// Drop source units that duplicate another scanner's source unit.
+	byID := map[unit.ID2]*claim{}
+	for _, c := range claims {
+		if dropped[c] {
+			continue
+		}
+		id := c.u.ID2()
+		other, present := byID[id]
+		if !present {
+			byID[id] = c
+			continue
+		}
+		if other.scanner == c.scanner {
+			continue
+		}
+		w, l := other, c
+		if ok, _ := prefer(c, other); ok {
+			w, l = c, other
+		}
+		_, reason := prefer(w, l)
+		addConflict(w, l, reason)
+		dropped[l] = true
+		byID[id] = w
+	}
+
+	for _, conflict := range conflicts {
+		for c := range dropped {
+			if c.u.ID2() == conflict.Loser && c.scanner == conflict.LoserScanner {
+				conflict.Dropped = true
+			}
+		}
+	}
+
+	var units []*unit.SourceUnit
+	for _, c := range claims {
+		if !dropped[c] {
+			units = append(units, c.u)
+		}
+	}
+	return units, conflicts
+}
@@ -0,0 +1,61 @@
+package scan
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestMergeUnits(t *testing.T) {
+	newUnits := func() [][]*unit.SourceUnit {
+		return [][]*unit.SourceUnit{
+			{
+				{Name: "js", Type: "JS", Files: []string{"a.js", "b.ts"}},
+			},
+			{
+				{Name: "ts", Type: "TS", Files: []string{"b.ts"}},
+				{Name: "dup", Type: "TS", Files: []string{"c.ts"}},
+			},
+			{
+				{Name: "dup", Type: "TS", Files: []string{"d.ts"}},
+			},
+		}
+	}
+
+	tests := map[string]struct {
+		priorities []int
+		wantUnits  map[string][]string // unit name -> files
+		wantReason string
+	}{
+		"most specific wins": {
+			wantUnits:  map[string][]string{"js": {"a.js"}, "ts": {"b.ts"}, "dup": {"c.ts"}},
+			wantReason: "fewer files",
+		},
+		"priority wins": {
+			priorities: []int{1, 0, 0},
+			wantUnits:  map[string][]string{"js": {"a.js", "b.ts"}, "dup": {"c.ts"}},
+			wantReason: "higher scanner priority",
+		},
+	}
+	for label, test := range tests {
+		units, conflicts := MergeUnits(newUnits(), test.priorities)
+		gotUnits := map[string][]string{}
+		for _, u := range units {
+			gotUnits[u.Name] = u.Files
+		}
+		if !reflect.DeepEqual(gotUnits, test.wantUnits) {
+			t.Errorf("%s: got units %v, want %v", label, gotUnits, test.wantUnits)
+		}
+		if len(conflicts) != 2 {
+			t.Errorf("%s: got %d conflicts, want 2", label, len(conflicts))
+			continue
+		}
+		if c := conflicts[0]; c.Reason != test.wantReason || !reflect.DeepEqual(c.Files, []string{"b.ts"}) {
+			t.Errorf("%s: got conflict %+v, want reason %q for file b.ts", label, c, test.wantReason)
+		}
+		if c := conflicts[1]; c.Loser.Name != "dup" || c.LoserScanner != 2 || !c.Dropped {
+			t.Errorf("%s: got conflict %+v, want duplicate from scanner 2 dropped", label, c)
+		}
+	}
+}
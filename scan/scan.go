@@ -1,6 +1,7 @@
 package scan
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -18,26 +19,36 @@ type Options struct {
 	config.Options
 	// Quiet silences all output.
 	Quiet bool
+
+	// Priorities optionally specifies the priority of each scanner
+	// passed to ScanMulti, for resolving conflicts between source
+	// units from different scanners (see MergeUnits).
+	Priorities []int
 }
 
 // ScanMulti runs multiple scanner tools in parallel. It passes command-line
 // options from opt to each one, and it sends the JSON representation of cfg
-// (the repo/tree's Config) to each tool's stdin.
-func ScanMulti(scanners []toolchain.Tool, opt Options, treeConfig map[string]interface{}) ([]*unit.SourceUnit, error) {
+// (the repo/tree's Config) to each tool's stdin. If ctx is done, running
+// scanners are killed.
+//
+// Conflicts between source units from different scanners are resolved
+// (see MergeUnits) and returned.
+func ScanMulti(ctx context.Context, scanners []toolchain.Tool, opt Options, treeConfig map[string]interface{}) ([]*unit.SourceUnit, []*Conflict, error) {
 	if treeConfig == nil {
 		treeConfig = map[string]interface{}{}
 	}
 
 	var (
-		units []*unit.SourceUnit
-		mu    sync.Mutex
+		byScanner = make([][]*unit.SourceUnit, len(scanners))
+		n         int
+		mu        sync.Mutex
 	)
 
 	run := parallel.NewRun(runtime.GOMAXPROCS(0))
-	for _, scanner_ := range scanners {
-		scanner := scanner_
+	for i_, scanner_ := range scanners {
+		i, scanner := i_, scanner_
 		run.Do(func() error {
-			units2, err := Scan(scanner, opt, treeConfig)
+			units2, err := Scan(ctx, scanner, opt, treeConfig)
 			if err != nil {
 				cmd, newErr := scanner.Command()
 				if newErr != nil {
@@ -48,19 +59,24 @@ func ScanMulti(scanners []toolchain.Tool, opt Options, treeConfig map[string]int
 
 			mu.Lock()
 			defer mu.Unlock()
-			units = append(units, units2...)
+			byScanner[i] = units2
+			n += len(units2)
 			return nil
 		})
 	}
 	err := run.Wait()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, nil, ctxErr
+	}
 	// Return error only if none of the commands succeeded.
-	if len(units) == 0 {
-		return nil, err
+	if n == 0 {
+		return nil, nil, err
 	}
-	return units, nil
+	units, conflicts := MergeUnits(byScanner, opt.Priorities)
+	return units, conflicts, nil
 }
 
-func Scan(scanner toolchain.Tool, opt Options, treeConfig map[string]interface{}) ([]*unit.SourceUnit, error) {
+func Scan(ctx context.Context, scanner toolchain.Tool, opt Options, treeConfig map[string]interface{}) ([]*unit.SourceUnit, error) {
 	args, err := flagutil.MarshalArgs(&opt)
 	if err != nil {
 		return nil, err
@@ -70,7 +86,7 @@ func Scan(scanner toolchain.Tool, opt Options, treeConfig map[string]interface{}
 		scanner.SetLogger(log.New(ioutil.Discard, "", 0))
 	}
 	var units []*unit.SourceUnit
-	if err := scanner.Run(args, treeConfig, &units); err != nil {
+	if err := scanner.Run(ctx, args, treeConfig, &units); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,295 @@
+// Package shell graphs shell scripts.
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// UnitType is the source unit type of shell scripts. Each script is
+// its own source unit, named by its path.
+const UnitType = "ShellScript"
+
+// shells are the interpreters of shell scripts.
+var shells = map[string]bool{"sh": true, "bash": true, "dash": true, "ksh": true, "zsh": true}
+
+// IsScript returns whether the file with the given path, which begins
+// with head, is a shell script: either its name ends in ".sh" or
+// ".bash", or it has no extension and a shell shebang line (such as
+// "#!/bin/sh" or "#!/usr/bin/env bash").
+func IsScript(file string, head []byte) bool {
+	switch path.Ext(file) {
+	case ".sh", ".bash":
+		return true
+	case "":
+		return shells[interpreter(head)]
+	}
+	return false
+}
+
+// interpreter returns the name of the interpreter in the shebang line
+// at the beginning of head, or "".
+func interpreter(head []byte) string {
+	if !bytes.HasPrefix(head, []byte("#!")) {
+		return ""
+	}
+	line := head[2:]
+	if i := bytes.IndexByte(line, '\n'); i != -1 {
+		line = line[:i]
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 {
+		return ""
+	}
+	name := path.Base(fields[0])
+	if name == "env" && len(fields) > 1 {
+		name = fields[1]
+	}
+	return name
+}
+
+// commandWrappers are commands that run the command given by their
+// (non-option) arguments.
+var commandWrappers = map[string]bool{
+	"builtin": true, "command": true, "env": true, "exec": true,
+	"nice": true, "nohup": true, "sudo": true, "time": true,
+}
+
+// scriptDirPattern matches the expansions that scripts commonly use to
+// refer to the directory they are in (such as `$(dirname "$0")` or
+// "$SCRIPT_DIR") at the beginning of a word.
+var scriptDirPattern = regexp.MustCompile(`^(?:\$\(dirname [^)]*\)|\$\(cd "?\$\(dirname [^)]*\)"? *(?:&&|;) *pwd\)|\$\{?(?:[A-Z_]*DIR|HERE|ROOT)\}?|\$\{BASH_SOURCE(?:\[0\])?%/\*\})/`)
+
+// Graph returns the defs and refs in the shell script with the given
+// path and contents.
+//
+// The script's functions and variables are defs. Refs are emitted for
+// function calls and variable expansions, and for the scripts and
+// programs in the repository that the script runs or sources (which
+// are resolved relative to the script's directory and to the
+// repository root, the current directory). Functions and variables
+// defined in scripts that the script sources are resolved as well.
+//
+// The stat and readFile funcs are called to determine whether files
+// exist and to read sourced scripts. If they are nil, no refs to other
+// files are emitted.
+func Graph(file string, data []byte, stat func(string) (os.FileInfo, error), readFile func(string) ([]byte, error)) (*graph.Output, error) {
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	g := &grapher{file: file, stat: stat, readFile: readFile, o: &graph.Output{}, defs: map[string]bool{}, sourced: map[string]string{}}
+	g.o.Defs = append(g.o.Defs, &graph.Def{
+		DefKey:   graph.DefKey{Path: "."},
+		Name:     path.Base(file),
+		Kind:     "script",
+		Exported: true,
+	})
+	for _, f := range s.Functions {
+		g.def("func", f)
+	}
+
+	// Variables are defined by their first assignment; later
+	// assignments are refs.
+	for _, a := range s.Assignments {
+		if !g.def("var", a) {
+			g.ref("var/"+a.Text, a.Start, a.End)
+		}
+	}
+
+	// Record the functions and variables defined in sourced scripts.
+	for _, cmd := range s.Commands {
+		if name := cmd.Words[0].Text; (name == "source" || name == ".") && len(cmd.Words) > 1 {
+			if p := g.resolve(cmd.Words[1]); p != "" {
+				g.addSourced(p)
+			}
+		}
+	}
+
+	for _, e := range s.Expansions {
+		g.ref("var/"+e.Text, e.Start, e.End)
+	}
+	for _, cmd := range s.Commands {
+		g.commandRefs(cmd.Words)
+	}
+	return g.o, nil
+}
+
+type grapher struct {
+	file     string
+	stat     func(string) (os.FileInfo, error)
+	readFile func(string) ([]byte, error)
+	o        *graph.Output
+	defs     map[string]bool   // paths of emitted defs
+	sourced  map[string]string // def path -> sourced script that defines it
+}
+
+// def emits a def of the given kind for n, unless one with the same
+// path was already emitted. It returns whether it emitted a def.
+func (g *grapher) def(kind string, n *Name) bool {
+	defPath := kind + "/" + n.Text
+	if g.defs[defPath] {
+		return false
+	}
+	g.defs[defPath] = true
+	g.o.Defs = append(g.o.Defs, &graph.Def{
+		DefKey:   graph.DefKey{Path: defPath},
+		Name:     n.Text,
+		Kind:     kind,
+		File:     g.file,
+		DefStart: uint32(n.Start),
+		DefEnd:   uint32(n.End),
+		Exported: true,
+	})
+	g.o.Refs = append(g.o.Refs, &graph.Ref{DefPath: defPath, Def: true, File: g.file, Start: uint32(n.Start), End: uint32(n.End)})
+	return true
+}
+
+// ref emits a ref to the def with the given path, in this script or in
+// a script that it sources, if there is one.
+func (g *grapher) ref(defPath string, start, end int) bool {
+	ref := &graph.Ref{DefPath: defPath, File: g.file, Start: uint32(start), End: uint32(end)}
+	if !g.defs[defPath] {
+		unit := g.sourced[defPath]
+		if unit == "" {
+			return false
+		}
+		ref.DefUnitType, ref.DefUnit = UnitType, unit
+	}
+	g.o.Refs = append(g.o.Refs, ref)
+	return true
+}
+
+// addSourced records the functions and variables defined in the
+// sourced script p (that aren't defined in this script).
+func (g *grapher) addSourced(p string) {
+	if g.readFile == nil {
+		return
+	}
+	data, err := g.readFile(p)
+	if err != nil {
+		return
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return
+	}
+	add := func(kind string, names []*Name) {
+		for _, n := range names {
+			if key := kind + "/" + n.Text; !g.defs[key] && g.sourced[key] == "" {
+				g.sourced[key] = p
+			}
+		}
+	}
+	add("func", s.Functions)
+	add("var", s.Assignments)
+}
+
+// isScript returns whether the file p in the repository is a shell
+// script (see IsScript).
+func (g *grapher) isScript(p string) bool {
+	var head []byte
+	if path.Ext(p) == "" && g.readFile != nil {
+		head, _ = g.readFile(p)
+	}
+	return IsScript(p, head)
+}
+
+// commandRefs emits refs for the function, script, or program that the
+// simple command consisting of words runs (or the script it sources).
+func (g *grapher) commandRefs(words []*Word) {
+	for len(words) > 0 && commandWrappers[words[0].Text] {
+		words = words[1:]
+		for len(words) > 0 && (strings.HasPrefix(words[0].Text, "-") || strings.Contains(words[0].Text, "=")) {
+			words = words[1:]
+		}
+	}
+	if len(words) == 0 {
+		return
+	}
+
+	name := words[0]
+	switch {
+	case g.ref("func/"+name.Text, name.Start, name.End):
+	case name.Text == "source" || name.Text == "." || shells[name.Text]:
+		// The first non-option argument is the script to run (or
+		// source).
+		for _, w := range words[1:] {
+			if strings.HasPrefix(w.Text, "-") {
+				if w.Text == "-c" {
+					return
+				}
+				continue
+			}
+			g.fileRef(w)
+			return
+		}
+	case strings.Contains(name.Text, "/"):
+		g.fileRef(name)
+	}
+}
+
+// resolve returns the path, relative to the repository root, of the
+// existing file that w (a path) refers to, or "".
+func (g *grapher) resolve(w *Word) string {
+	if g.stat == nil {
+		return ""
+	}
+	var candidates []string
+	if loc := scriptDirPattern.FindStringIndex(w.Text); loc != nil {
+		if rest := w.Text[loc[1]:]; !strings.ContainsAny(rest, "$`*?[") {
+			candidates = []string{path.Join(path.Dir(g.file), rest)}
+		}
+	} else if w.Literal && !path.IsAbs(w.Text) && !strings.ContainsAny(w.Text, "*?[~") {
+		candidates = []string{path.Join(path.Dir(g.file), w.Text), path.Clean(w.Text)}
+	}
+	for _, p := range candidates {
+		if p == ".." || strings.HasPrefix(p, "../") {
+			continue
+		}
+		if fi, err := g.stat(p); err == nil && !fi.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+// fileRef emits a ref to the script or program that w refers to, if it
+// exists in the repository. Refs to other shell scripts are to their
+// source units; other files are defs (of kind "file") in this script's
+// source unit.
+func (g *grapher) fileRef(w *Word) {
+	p := g.resolve(w)
+	if p == "" {
+		return
+	}
+	if g.isScript(p) {
+		g.o.Refs = append(g.o.Refs, &graph.Ref{
+			DefUnitType: UnitType,
+			DefUnit:     p,
+			DefPath:     ".",
+			File:        g.file,
+			Start:       uint32(w.Start),
+			End:         uint32(w.End),
+		})
+		return
+	}
+	defPath := "file/" + p
+	if !g.defs[defPath] {
+		g.defs[defPath] = true
+		g.o.Defs = append(g.o.Defs, &graph.Def{
+			DefKey:   graph.DefKey{Path: defPath},
+			Name:     p,
+			Kind:     "file",
+			File:     p,
+			Exported: true,
+		})
+	}
+	g.ref(defPath, w.Start, w.End)
+}
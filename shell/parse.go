@@ -0,0 +1,616 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A Word is a word in a shell command (such as a command name or an
+// argument).
+type Word struct {
+	// Text is the word's value (with quotes and escapes removed).
+	// Parameter expansions and command substitutions in the word are
+	// included verbatim.
+	Text string
+
+	// Literal is whether the word contains no expansions or
+	// substitutions.
+	Literal bool
+
+	// Start and End are the byte offsets of the word.
+	Start, End int
+}
+
+// A Name is a variable or function name, at the given byte offsets.
+type Name struct {
+	Text       string
+	Start, End int
+}
+
+// A Command is a simple command: the words after any reserved words
+// (such as "if" or "do"), redirections excluded.
+type Command struct {
+	Words []*Word
+}
+
+// A Script is the result of parsing a shell script. It records the
+// script's function definitions, variable assignments and expansions,
+// and simple commands (including the ones in command substitutions),
+// in order of appearance.
+type Script struct {
+	Functions   []*Name
+	Assignments []*Name
+	Expansions  []*Name
+	Commands    []*Command
+}
+
+// reservedWords are the words that introduce or end compound commands
+// (and are not command names) at the beginning of a command.
+var reservedWords = map[string]bool{
+	"!": true, "{": true, "}": true, "do": true, "done": true, "elif": true,
+	"else": true, "esac": true, "fi": true, "if": true, "then": true,
+	"time": true, "until": true, "while": true,
+}
+
+// Parse parses the shell script in data. The parser is lenient:
+// syntax that it doesn't understand is skipped over, and only
+// unterminated quotes and substitutions are errors.
+func Parse(data []byte) (*Script, error) {
+	s := &Script{}
+	p := &parser{data: data, end: len(data), s: s}
+	p.parseList(false)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return s, nil
+}
+
+type parser struct {
+	data []byte
+	pos  int
+	end  int // offset where parsing stops
+	s    *Script
+	err  error
+
+	heredocs    []heredoc // heredocs whose bodies begin at the next newline
+	casePattern bool      // whether a case pattern comes next
+}
+
+type heredoc struct {
+	delim     string
+	quoted    bool // whether expansions are disabled
+	stripTabs bool // "<<-"
+}
+
+func (p *parser) errorf(off int, format string, args ...interface{}) {
+	if p.err == nil {
+		line := 1 + strings.Count(string(p.data[:off]), "\n")
+		p.err = fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+	}
+}
+
+func (p *parser) peek(n int) byte {
+	if p.pos+n < p.end {
+		return p.data[p.pos+n]
+	}
+	return 0
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
+
+func isMeta(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', ';', '&', '|', '<', '>', '(', ')':
+		return true
+	}
+	return false
+}
+
+// operators are the control and redirection operators, longest first.
+var operators = []string{
+	"&>>", "<<<", "<<-", ";;&",
+	"&&", "||", ";;", ";&", "<<", ">>", "<&", ">&", "<>", ">|", "&>", "|&",
+	";", "&", "|", "<", ">", "(", ")", "\n",
+}
+
+func isRedirect(op string) bool {
+	return strings.ContainsAny(op, "<>") && op != "<<" && op != "<<-"
+}
+
+// parseList parses commands up to the end of the input or, if inParens
+// is true, up to the unmatched ")" (which is consumed).
+func (p *parser) parseList(inParens bool) {
+	var words []*Word
+	depth := 0
+	redirect := false // whether the next word is a redirection target
+	flush := func() {
+		if len(words) > 0 {
+			p.command(words)
+			words = nil
+		}
+	}
+	for p.err == nil {
+		// Skip blanks, line continuations, and comments.
+		for p.pos < p.end {
+			if c := p.data[p.pos]; c == ' ' || c == '\t' || c == '\r' {
+				p.pos++
+			} else if c == '\\' && p.peek(1) == '\n' {
+				p.pos += 2
+			} else if c == '#' {
+				for p.pos < p.end && p.data[p.pos] != '\n' {
+					p.pos++
+				}
+			} else {
+				break
+			}
+		}
+		if p.pos >= p.end {
+			if inParens {
+				p.errorf(p.pos, "unterminated command substitution")
+			}
+			flush()
+			return
+		}
+
+		op := p.operator()
+		if op == "" {
+			w := p.parseWord()
+			if redirect {
+				redirect = false
+				continue
+			}
+			// A number immediately before a redirection is a file
+			// descriptor.
+			if c := p.peek(0); (c == '<' || c == '>') && w.Literal && strings.Trim(w.Text, "0123456789") == "" {
+				continue
+			}
+			words = append(words, w)
+			continue
+		}
+		p.pos += len(op)
+
+		switch {
+		case isRedirect(op):
+			redirect = true
+		case op == "<<" || op == "<<-":
+			p.skipBlanks()
+			if p.pos < p.end && !isMeta(p.data[p.pos]) {
+				start := p.pos
+				delim := p.parseWord()
+				p.heredocs = append(p.heredocs, heredoc{
+					delim:     delim.Text,
+					quoted:    strings.ContainsAny(string(p.data[start:delim.End]), `'"\`),
+					stripTabs: op == "<<-",
+				})
+			}
+		case op == "(" && len(words) == 1 && !p.casePattern:
+			// "name() { ...; }" defines a function.
+			p.skipBlanks()
+			if p.peek(0) == ')' {
+				p.pos++
+				w := words[0]
+				p.s.Functions = append(p.s.Functions, &Name{Text: w.Text, Start: w.Start, End: w.End})
+				words = nil
+				continue
+			}
+			flush()
+			depth++
+		case op == "(":
+			if !p.casePattern {
+				flush()
+				depth++
+			}
+		case op == ")":
+			if p.casePattern {
+				// End of a case pattern.
+				p.casePattern = false
+				words = nil
+				continue
+			}
+			flush()
+			if depth == 0 && inParens {
+				return
+			}
+			if depth > 0 {
+				depth--
+			}
+		case op == ";;" || op == ";&" || op == ";;&":
+			flush()
+			p.casePattern = true
+		case op == "\n":
+			flush()
+			p.readHeredocs()
+		default:
+			flush()
+		}
+	}
+}
+
+func (p *parser) skipBlanks() {
+	for p.pos < p.end && (p.data[p.pos] == ' ' || p.data[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// operator returns the operator at the current position, or "".
+func (p *parser) operator() string {
+	rest := p.data[p.pos:p.end]
+	for _, op := range operators {
+		if bytes.HasPrefix(rest, []byte(op)) {
+			return op
+		}
+	}
+	return ""
+}
+
+// command records the simple command consisting of words.
+func (p *parser) command(words []*Word) {
+	if p.casePattern {
+		if words[0].Text == "esac" {
+			p.casePattern = false
+			words = words[1:]
+			if len(words) == 0 {
+				return
+			}
+		} else {
+			// A pattern may be preceded by the "(" (which is lexed as an
+			// operator) or by "in"; words before the ")" are patterns.
+			return
+		}
+	}
+	for len(words) > 0 && words[0].Literal && reservedWords[words[0].Text] {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return
+	}
+
+	switch words[0].Text {
+	case "for", "select":
+		if len(words) > 1 && isName(words[1].Text) {
+			p.assign(words[1], len(words[1].Text))
+		}
+		return
+	case "case":
+		p.casePattern = true
+		return
+	case "function":
+		if len(words) > 1 {
+			name := strings.TrimSuffix(words[1].Text, "()")
+			p.s.Functions = append(p.s.Functions, &Name{Text: name, Start: words[1].Start, End: words[1].Start + len(name)})
+			if rest := words[2:]; len(rest) > 0 {
+				// The body's first command (after "{").
+				p.command(rest)
+			}
+		}
+		return
+	}
+
+	// Leading assignments.
+	for len(words) > 0 && p.assignment(words[0]) {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return
+	}
+
+	switch words[0].Text {
+	case "declare", "export", "local", "readonly", "typeset":
+		for _, w := range words[1:] {
+			if !p.assignment(w) && isName(w.Text) {
+				p.assign(w, len(w.Text))
+			}
+		}
+	case "read":
+		for i := 1; i < len(words); i++ {
+			switch w := words[i]; {
+			case w.Text == "-p" || w.Text == "-d" || w.Text == "-t" || w.Text == "-n" || w.Text == "-N" || w.Text == "-u":
+				i++ // flag argument
+			case strings.HasPrefix(w.Text, "-"):
+			case isName(w.Text):
+				p.assign(w, len(w.Text))
+			}
+		}
+	}
+	p.s.Commands = append(p.s.Commands, &Command{Words: words})
+}
+
+func isName(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// assignment records the variable assignment (such as "FOO=bar" or
+// "PATH+=:/bin") that w is, if it is one.
+func (p *parser) assignment(w *Word) bool {
+	i := strings.IndexAny(w.Text, "=[+")
+	if i <= 0 || !isName(w.Text[:i]) || !strings.HasPrefix(string(p.data[w.Start:w.End]), w.Text[:i]) {
+		return false
+	}
+	if rest := w.Text[i:]; !strings.HasPrefix(rest, "=") && !strings.HasPrefix(rest, "+=") && !strings.HasPrefix(rest, "[") {
+		return false
+	}
+	p.assign(w, i)
+	return true
+}
+
+// assign records an assignment to the variable whose name is the
+// first n bytes of w.
+func (p *parser) assign(w *Word, n int) {
+	p.s.Assignments = append(p.s.Assignments, &Name{Text: w.Text[:n], Start: w.Start, End: w.Start + n})
+}
+
+// readHeredocs skips the bodies of the pending heredocs (which begin
+// at the current position), recording the expansions in them.
+func (p *parser) readHeredocs() {
+	for _, h := range p.heredocs {
+		bodyStart := p.pos
+		for p.pos < p.end {
+			lineEnd := p.pos
+			for lineEnd < p.end && p.data[lineEnd] != '\n' {
+				lineEnd++
+			}
+			line := string(p.data[p.pos:lineEnd])
+			if h.stripTabs {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == h.delim {
+				if !h.quoted {
+					sub := p.sub(bodyStart, p.pos)
+					sub.parseHeredocBody()
+					if sub.err != nil && p.err == nil {
+						p.err = sub.err
+					}
+				}
+				p.pos = lineEnd
+				if p.pos < p.end {
+					p.pos++
+				}
+				break
+			}
+			p.pos = lineEnd
+			if p.pos < p.end {
+				p.pos++
+			}
+		}
+	}
+	p.heredocs = nil
+}
+
+// parseWord parses the word at the current position.
+func (p *parser) parseWord() *Word {
+	w := &Word{Start: p.pos, Literal: true}
+	var text []byte
+	for p.pos < p.end && !isMeta(p.data[p.pos]) {
+		switch c := p.data[p.pos]; c {
+		case '\\':
+			p.pos++
+			if p.pos < p.end && p.data[p.pos] != '\n' {
+				text = append(text, p.data[p.pos])
+			}
+			p.pos++
+		case '\'':
+			start := p.pos
+			p.pos++
+			for p.pos < p.end && p.data[p.pos] != '\'' {
+				text = append(text, p.data[p.pos])
+				p.pos++
+			}
+			if p.pos >= p.end {
+				p.errorf(start, "unterminated single-quoted string")
+				break
+			}
+			p.pos++
+		case '"':
+			start := p.pos
+			p.pos++
+			t, lit := p.parseDoubleQuoted()
+			text = append(text, t...)
+			w.Literal = w.Literal && lit
+			if p.pos >= p.end {
+				p.errorf(start, "unterminated double-quoted string")
+				break
+			}
+			p.pos++
+		case '$', '`':
+			start := p.pos
+			p.parseExpansion()
+			text = append(text, p.data[start:p.pos]...)
+			w.Literal = false
+		default:
+			text = append(text, c)
+			p.pos++
+		}
+	}
+	w.Text, w.End = string(text), p.pos
+	return w
+}
+
+// parseDoubleQuoted parses the contents of a double-quoted string, up
+// to the closing quote (which isn't consumed).
+func (p *parser) parseDoubleQuoted() (text []byte, literal bool) {
+	literal = true
+	for p.pos < p.end && p.data[p.pos] != '"' {
+		switch c := p.data[p.pos]; c {
+		case '\\':
+			if e := p.peek(1); e == '$' || e == '`' || e == '"' || e == '\\' {
+				text = append(text, e)
+				p.pos += 2
+			} else if e == '\n' {
+				p.pos += 2
+			} else {
+				text = append(text, c)
+				p.pos++
+			}
+		case '$', '`':
+			start := p.pos
+			p.parseExpansion()
+			text = append(text, p.data[start:p.pos]...)
+			literal = false
+		default:
+			text = append(text, c)
+			p.pos++
+		}
+	}
+	return text, literal
+}
+
+// parseHeredocBody records the expansions in the body of a heredoc
+// (whose delimiter isn't quoted).
+func (p *parser) parseHeredocBody() {
+	for p.pos < p.end {
+		switch p.data[p.pos] {
+		case '\\':
+			p.pos += 2
+		case '$', '`':
+			p.parseExpansion()
+		default:
+			p.pos++
+		}
+	}
+	if p.pos > p.end {
+		p.pos = p.end
+	}
+}
+
+// parseExpansion parses the parameter expansion, command
+// substitution, or arithmetic expansion at the current position (which
+// begins with "$" or "`").
+func (p *parser) parseExpansion() {
+	start := p.pos
+	if p.data[p.pos] == '`' {
+		p.pos++
+		subStart := p.pos
+		for p.pos < p.end && p.data[p.pos] != '`' {
+			if p.data[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		if p.pos >= p.end {
+			p.errorf(start, "unterminated command substitution")
+			p.pos = p.end
+			return
+		}
+		p.parseSub(subStart, p.pos, false)
+		p.pos++
+		return
+	}
+
+	p.pos++ // "$"
+	switch c := p.peek(0); {
+	case c == '(' && p.peek(1) == '(':
+		// Arithmetic expansion: variables may be named without "$".
+		p.pos += 2
+		for depth := 0; p.pos < p.end; {
+			c := p.data[p.pos]
+			if c == ')' && depth == 0 && p.peek(1) == ')' {
+				p.pos += 2
+				return
+			}
+			switch {
+			case c == '(':
+				depth++
+			case c == ')':
+				depth--
+			case c == '$':
+				p.parseExpansion()
+				continue
+			case isNameStart(c):
+				nameStart := p.pos
+				for p.pos < p.end && isNameChar(p.data[p.pos]) {
+					p.pos++
+				}
+				p.expansion(nameStart, p.pos)
+				continue
+			}
+			p.pos++
+		}
+		p.errorf(start, "unterminated arithmetic expansion")
+	case c == '(':
+		p.pos = p.parseSub(p.pos+1, p.end, true)
+	case c == '{':
+		p.pos++
+		if c := p.peek(0); c == '#' || c == '!' {
+			p.pos++
+		}
+		nameStart := p.pos
+		for p.pos < p.end && isNameChar(p.data[p.pos]) {
+			p.pos++
+		}
+		if p.pos > nameStart && isNameStart(p.data[nameStart]) {
+			p.expansion(nameStart, p.pos)
+		}
+		// The rest (such as ":-default") may contain expansions.
+		for depth := 0; p.pos < p.end; {
+			switch p.data[p.pos] {
+			case '}':
+				if depth == 0 {
+					p.pos++
+					return
+				}
+				depth--
+			case '{':
+				depth++
+			case '\\':
+				p.pos++
+			case '\'':
+				for p.pos++; p.pos < p.end && p.data[p.pos] != '\''; p.pos++ {
+				}
+			case '"':
+				p.pos++
+				p.parseDoubleQuoted()
+			case '$', '`':
+				p.parseExpansion()
+				continue
+			}
+			p.pos++
+		}
+		p.errorf(start, "unterminated parameter expansion")
+	case isNameStart(c):
+		nameStart := p.pos
+		for p.pos < p.end && isNameChar(p.data[p.pos]) {
+			p.pos++
+		}
+		p.expansion(nameStart, p.pos)
+	case c != 0 && strings.IndexByte("0123456789@*#?-$!", c) != -1:
+		p.pos++ // special parameter
+	}
+}
+
+func (p *parser) expansion(start, end int) {
+	p.s.Expansions = append(p.s.Expansions, &Name{Text: string(p.data[start:end]), Start: start, End: end})
+}
+
+// sub returns a parser for the region [start, end) of p's input (such
+// as the contents of a command substitution), which records its
+// results in p's script.
+func (p *parser) sub(start, end int) *parser {
+	return &parser{data: p.data, pos: start, end: end, s: p.s}
+}
+
+// parseSub parses the commands in a command substitution in the region
+// [start, end) of p's input (see parseList), and returns the offset
+// where parsing stopped.
+func (p *parser) parseSub(start, end int, inParens bool) int {
+	sub := p.sub(start, end)
+	sub.parseList(inParens)
+	if sub.err != nil && p.err == nil {
+		p.err = sub.err
+	}
+	return sub.pos
+}
@@ -0,0 +1,171 @@
+package shell
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func names(ns []*Name, data []byte) []string {
+	var s []string
+	for _, n := range ns {
+		if got := string(data[n.Start:n.End]); got != n.Text {
+			s = append(s, n.Text+"@"+got)
+		} else {
+			s = append(s, n.Text)
+		}
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	data := []byte(`#!/bin/sh
+set -e
+VERSION=1.0 # comment $NOT_A_VAR
+log() { echo "[$(date +%T)] $*" >&2; }
+function die { log "$@"; exit 1; }
+for f in *.go; do gofmt -l "$f"; done
+case "$1" in
+  build|-b) make ${TARGET:-all} ;;
+  (test) go test ./... ;;
+esac
+export GOFLAGS=-mod=vendor PATH
+read -r -p "name? " NAME
+cat <<EOF > out.txt
+version: $VERSION ` + "`uname`" + `
+EOF
+cat <<'EOF'
+$QUOTED
+EOF
+echo 'single $quoted' "\$escaped" $((COUNT + 1))
+`)
+	s, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := names(s.Functions, data), []string{"log", "die"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got functions %q, want %q", got, want)
+	}
+	if got, want := names(s.Assignments, data), []string{"VERSION", "f", "GOFLAGS", "PATH", "NAME"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got assignments %q, want %q", got, want)
+	}
+	if got, want := names(s.Expansions, data), []string{"f", "TARGET", "VERSION", "COUNT"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got expansions %q, want %q", got, want)
+	}
+	var cmds []string
+	for _, c := range s.Commands {
+		cmds = append(cmds, c.Words[0].Text)
+	}
+	want := []string{"set", "date", "echo", "log", "exit", "gofmt", "make", "go", "export", "read", "cat", "uname", "cat", "echo"}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("got commands %q, want %q", cmds, want)
+	}
+
+	for _, bad := range []string{`echo "unterminated`, `echo $(date`, "echo `date"} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("%q: got no error", bad)
+		}
+	}
+}
+
+type fileInfo struct{ os.FileInfo }
+
+func (fileInfo) IsDir() bool        { return false }
+func (fileInfo) ModTime() time.Time { return time.Time{} }
+
+func TestGraph(t *testing.T) {
+	files := map[string]string{
+		"scripts/lib.sh":  "info() { echo \"$@\"; }\nLIB_VERSION=2\n",
+		"scripts/test.sh": "#!/bin/sh\n",
+		"bin/tool":        "\x7fELF",
+		"scripts/release": "#!/usr/bin/env bash\n",
+	}
+	stat := func(p string) (os.FileInfo, error) {
+		if _, ok := files[p]; ok {
+			return fileInfo{}, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	readFile := func(p string) ([]byte, error) {
+		if data, ok := files[p]; ok {
+			return []byte(data), nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	data := []byte(`#!/bin/bash
+DIR=$(dirname "$0")
+. "$DIR/lib.sh"
+build() {
+  info "building $LIB_VERSION"
+  ./bin/tool --out "$OUT"
+}
+OUT=dist
+build
+OUT=dist2
+bash scripts/test.sh -v
+exec "$(dirname "$0")/release" "$OUT"
+./missing.sh
+`)
+	o, err := Graph("scripts/build.sh", data, stat, readFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var defs []string
+	for _, d := range o.Defs {
+		defs = append(defs, d.Kind+" "+d.Path)
+	}
+	sort.Strings(defs)
+	wantDefs := []string{"file file/bin/tool", "func func/build", "script .", "var var/DIR", "var var/OUT"}
+	if !reflect.DeepEqual(defs, wantDefs) {
+		t.Errorf("got defs %q, want %q", defs, wantDefs)
+	}
+
+	refs := map[string][]string{}
+	for _, r := range o.Refs {
+		if r.Def {
+			continue
+		}
+		key := r.DefPath
+		if r.DefUnitType != "" {
+			key = r.DefUnit + " " + r.DefPath
+		}
+		refs[key] = append(refs[key], string(data[r.Start:r.End]))
+	}
+	want := map[string][]string{
+		"var/DIR":                        {"DIR"},
+		"var/OUT":                        {"OUT", "OUT", "OUT"},
+		"func/build":                     {"build"},
+		"file/bin/tool":                  {"./bin/tool"},
+		"scripts/lib.sh .":               {`"$DIR/lib.sh"`},
+		"scripts/lib.sh func/info":       {"info"},
+		"scripts/lib.sh var/LIB_VERSION": {"LIB_VERSION"},
+		"scripts/test.sh .":              {"scripts/test.sh"},
+		"scripts/release .":              {`"$(dirname "$0")/release"`},
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("got refs %v, want %v", refs, want)
+	}
+}
+
+func TestIsScript(t *testing.T) {
+	tests := []struct {
+		file, head string
+		want       bool
+	}{
+		{"a.sh", "", true},
+		{"bin/x", "#!/bin/bash\n", true},
+		{"bin/x", "#!/usr/bin/env zsh -f\n", true},
+		{"bin/x", "#!/usr/bin/env python3\n", false},
+		{"x.py", "#!/bin/sh\n", false},
+		{"Makefile", "all:\n", false},
+	}
+	for _, test := range tests {
+		if got := IsScript(test.file, []byte(test.head)); got != test.want {
+			t.Errorf("%s %q: got %v, want %v", test.file, test.head, got, test.want)
+		}
+	}
+}
@@ -8,9 +8,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
+	"code.google.com/p/rog-go/parallel"
 	"github.com/kr/fs"
 	"sourcegraph.com/sourcegraph/go-sourcegraph/sourcegraph"
 	"sourcegraph.com/sourcegraph/rwvfs"
@@ -18,6 +20,7 @@ import (
 	"sourcegraph.com/sourcegraph/srclib/config"
 	"sourcegraph.com/sourcegraph/srclib/dep"
 	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/importer"
 	"sourcegraph.com/sourcegraph/srclib/plan"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
@@ -34,14 +37,16 @@ func init() {
 
 	/* START APIDescribeCmdDoc OMIT
 	This command is used by editor plugins to retrieve information about
-	the identifier at a specific position in a file.
+	the identifier at a specific position in a file. With the flag
+	`--all`, it retrieves the same information for all identifiers in
+	the file at once.
 
 	It will hit Sourcegraph's API to get a definition's examples. With the
 	flag `--no-examples`, this command does not hit Sourcegraph's API.
 		END APIDescribeCmdDoc OMIT */
 	_, err = c.AddCommand("describe",
 		"display documentation for the def under the cursor",
-		"Returns information about the definition referred to by the cursor's current position in a file.",
+		"Returns information about the definition referred to by the cursor's current position in a file.\n\nWith --all, returns all refs in the file (sorted by offset), each with its resolved def, so that an editor can annotate a whole buffer with one command.",
 		&apiDescribeCmd,
 	)
 	if err != nil {
@@ -75,6 +80,42 @@ func init() {
 		log.Fatal(err)
 	}
 
+	_, err = c.AddCommand("dep-usage",
+		"list the defs in a dependency that are referenced",
+		"Return the defs in the given dependency repository that the current repository references, each with its number of refs and the files that contain them (sorted by most referenced first). A dependency with no referenced defs may be unneeded.",
+		&apiDepUsageCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = c.AddCommand("edit-plan",
+		"list the file edits that perform a refactoring",
+		"Return the file edits (byte ranges and replacement text) that perform a refactoring, computed from the refs in the current repository, so that external tools can apply them. The only supported refactoring is --rename, which renames the def (specified by --unit-type, --unit, and its def path) at its definition and at all of its refs.\n\nRefs in other repositories are not included. Refs whose text in the file doesn't match the def's name (e.g., because the file changed since it was built) are listed as skipped instead of edited.",
+		&apiEditPlanCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = c.AddCommand("file-annotations",
+		"list the decorated spans of a file",
+		"Return, in one payload, everything that a code viewer needs to decorate a file: the file's refs (each with the def that it refers to, if the def is in the current repository), the defs declared in the file, and the file's annotations (such as syntax highlighting), merged into spans.\n\nSpans are sorted by start offset and then by length (longest first). Items with the same byte range are merged into a single span (so that a def's name, which is both a ref and the def's declaration, is a single span). A def is declared at the span of its name if it has a def ref, and at the span of its whole definition otherwise. Spans don't overlap, except that a span may be nested in a longer one (such as a ref in a def's definition) and that items which partially overlap each other are kept in separate spans.\n\nWith --commit, the build data of an earlier commit (which must still exist in the repository's build data) is used instead of building the working tree.",
+		&apiFileAnnotationsCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = c.AddCommand("outline",
+		"show the hierarchy of defs in a file",
+		"Return the defs declared in a file as a tree (like an editor's document symbol outline): each def's children are the defs nested in it, such as a class's methods and a function's nested functions. Defs are nested under the def named by their ParentPath; for toolchains that don't emit ParentPath, nesting is inferred from the defs' spans. Each level of the tree is sorted by position.\n\nWith --commit, the build data of an earlier commit (which must still exist in the repository's build data) is used instead of building the working tree.",
+		&apiOutlineCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	/* START APIUnitsCmdDoc OMIT
 	This command returns a list of all of the source units in the current
 	repository.
@@ -97,7 +138,8 @@ func (c *APICmd) Execute(args []string) error { return nil }
 
 type APIDescribeCmd struct {
 	File      string `long:"file" required:"yes" value-name:"FILE"`
-	StartByte uint32 `long:"start-byte" required:"yes" value-name:"BYTE"`
+	StartByte uint32 `long:"start-byte" value-name:"BYTE"`
+	All       bool   `long:"all" description:"describe all refs in the file (ignores --start-byte)"`
 
 	NoExamples bool `long:"no-examples" describe:"don't show examples from Sourcegraph.com"`
 }
@@ -115,6 +157,38 @@ type APIDepsCmd struct {
 	} `positional-args:"yes"`
 }
 
+type APIDepUsageCmd struct {
+	Args struct {
+		Repo string    `name:"REPO" description:"URI (or clone URL) of the dependency repository"`
+		Dir  Directory `name:"DIR" default:"." description:"root directory of target project"`
+	} `positional-args:"yes"`
+}
+
+type APIEditPlanCmd struct {
+	Rename   bool   `long:"rename" description:"rename DEF to NEWNAME"`
+	UnitType string `long:"unit-type" description:"source unit type of the def" required:"yes"`
+	Unit     string `long:"unit" description:"source unit name of the def" required:"yes"`
+
+	Args struct {
+		Def     string `name:"DEF" description:"def path"`
+		NewName string `name:"NEWNAME" description:"new name of the def"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+type APIFileAnnotationsCmd struct {
+	File     string `long:"file" required:"yes" value-name:"FILE"`
+	CommitID string `long:"commit" description:"use the existing build data of this commit instead of building the working tree" value-name:"COMMIT"`
+
+	NoRefs bool `long:"no-refs"`
+	NoDefs bool `long:"no-defs"`
+	NoAnns bool `long:"no-anns"`
+}
+
+type APIOutlineCmd struct {
+	File     string `long:"file" required:"yes" value-name:"FILE"`
+	CommitID string `long:"commit" description:"use the existing build data of this commit instead of building the working tree" value-name:"COMMIT"`
+}
+
 type APIUnitsCmd struct {
 	Args struct {
 		Dir Directory `name:"DIR" default:"." description:"root directory of target project"`
@@ -125,6 +199,10 @@ var apiDescribeCmd APIDescribeCmd
 var apiListCmd APIListCmd
 var apiDepsCmd APIDepsCmd
 var apiUnitsCmd APIUnitsCmd
+var apiDepUsageCmd APIDepUsageCmd
+var apiEditPlanCmd APIEditPlanCmd
+var apiFileAnnotationsCmd APIFileAnnotationsCmd
+var apiOutlineCmd APIOutlineCmd
 
 type commandContext struct {
 	repo         *Repo
@@ -232,7 +310,7 @@ func ensureBuild(buildStore buildstore.RepoBuildStore, repo *Repo) error {
 
 	// Always re-import.
 	i := &StoreImportCmd{
-		ImportOpt: ImportOpt{
+		Options: importer.Options{
 			Repo:     repo.CloneURL,
 			CommitID: repo.CommitID,
 		},
@@ -406,6 +484,9 @@ func (c *APIDescribeCmd) Execute(args []string) error {
 	if err != nil {
 		return err
 	}
+	if c.All {
+		return c.describeAll(context)
+	}
 	file := context.relativeFile
 	units, err := getSourceUnitsWithFile(context.buildStore, context.repo, file)
 	if err != nil {
@@ -590,6 +671,171 @@ OuterLoop:
 	return nil
 }
 
+// apiDescribeRef is an element of the output of `src api describe
+// --all`: a ref and its def (nil if the def couldn't be found).
+type apiDescribeRef struct {
+	Ref *graph.Ref
+	Def *sourcegraph.Def `json:",omitempty"`
+}
+
+// describeAll prints all refs in c.File, sorted by offset, along with
+// their defs. Each distinct def is looked up only once. Examples are
+// never fetched.
+func (c *APIDescribeCmd) describeAll(context commandContext) error {
+	file := context.relativeFile
+	units, err := getSourceUnitsWithFile(context.buildStore, context.repo, file)
+	if err != nil {
+		return err
+	}
+
+	graphs := map[unit.ID2]*graph.Output{}
+	readGraph := func(u *unit.SourceUnit) (*graph.Output, error) {
+		if g, present := graphs[u.ID2()]; present {
+			return g, nil
+		}
+		var g *graph.Output
+		graphFile := plan.SourceUnitDataFilename("graph", u)
+		if err := readJSONFileFS(context.commitFS, graphFile, &g); err != nil {
+			if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("%s: %s", graphFile, err)
+			}
+		}
+		graphs[u.ID2()] = g
+		return g, nil
+	}
+
+	refs, err := describeFileRefs(file, context.repo.URI(), units, readGraph)
+	if err != nil {
+		return err
+	}
+
+	// Look up defs in the current repo from the build data, and the
+	// rest using the Sourcegraph API.
+	defs, remoteDefs, err := describeLocalDefs(refs, context.repo.URI(), context.repo.RootDir, readGraph)
+	if err != nil {
+		return err
+	}
+	if len(remoteDefs) > 0 {
+		apiclient := NewAPIClientWithAuthIfPresent()
+		var mu sync.Mutex
+		par := parallel.NewRun(8)
+		for _, k := range remoteDefs {
+			k := k
+			par.Do(func() error {
+				spec := sourcegraph.DefSpec{Repo: k.Repo, UnitType: k.UnitType, Unit: k.Unit, Path: k.Path}
+				d, _, err := apiclient.Defs.Get(spec, &sourcegraph.DefGetOptions{Doc: true})
+				if err != nil {
+					if GlobalOpt.Verbose {
+						log.Printf("Couldn't fetch definition %v: %s.", spec, err)
+					}
+					return nil
+				}
+				mu.Lock()
+				defs[k] = d
+				mu.Unlock()
+				return nil
+			})
+		}
+		par.Wait()
+	}
+	for _, r := range refs {
+		r.Def = defs[r.Ref.DefKey()]
+	}
+
+	if refs == nil {
+		refs = []*apiDescribeRef{}
+	}
+	return json.NewEncoder(os.Stdout).Encode(refs)
+}
+
+// describeFileRefs returns the refs in file (in the graph data of
+// units, read by readGraph), sorted by offset. Refs' implied def
+// fields are set to their unit and to repo.
+func describeFileRefs(file, repo string, units []*unit.SourceUnit, readGraph func(*unit.SourceUnit) (*graph.Output, error)) ([]*apiDescribeRef, error) {
+	var refs []*apiDescribeRef
+	for _, u := range units {
+		g, err := readGraph(u)
+		if err != nil {
+			return nil, err
+		}
+		if g == nil {
+			continue
+		}
+		for _, ref := range g.Refs {
+			if ref.File != file {
+				continue
+			}
+			if ref.DefUnit == "" {
+				ref.DefUnit = u.Name
+			}
+			if ref.DefUnitType == "" {
+				ref.DefUnitType = u.Type
+			}
+			if ref.DefRepo == "" {
+				ref.DefRepo = repo
+			}
+			refs = append(refs, &apiDescribeRef{Ref: ref})
+		}
+	}
+	sort.Sort(apiDescribeRefsByOffset(refs))
+	return refs, nil
+}
+
+// describeLocalDefs returns the defs of refs that are in repo (whose
+// files are made absolute by joining them to rootDir), read from the
+// build data by readGraph. Each def key of refs is in defs, with a nil
+// value if the def wasn't found. The keys of the defs in other repos
+// are returned in remoteDefs, so that they can be fetched.
+func describeLocalDefs(refs []*apiDescribeRef, repo, rootDir string, readGraph func(*unit.SourceUnit) (*graph.Output, error)) (defs map[graph.DefKey]*sourcegraph.Def, remoteDefs []graph.DefKey, err error) {
+	defs = map[graph.DefKey]*sourcegraph.Def{}
+	for _, r := range refs {
+		k := r.Ref.DefKey()
+		if _, present := defs[k]; present {
+			continue
+		}
+		defs[k] = nil
+		if k.Repo != repo {
+			if k.Repo != "" {
+				remoteDefs = append(remoteDefs, k)
+			}
+			continue
+		}
+		g, err := readGraph(&unit.SourceUnit{Name: k.Unit, Type: k.UnitType})
+		if err != nil {
+			return nil, nil, err
+		}
+		if g == nil {
+			continue
+		}
+		for _, def := range g.Defs {
+			if def.Path == k.Path {
+				d := &sourcegraph.Def{Def: *def}
+				for _, doc := range g.Docs {
+					if doc.Path == k.Path {
+						d.DocHTML = doc.Data
+					}
+				}
+				d.File = filepath.Join(rootDir, d.File)
+				defs[k] = d
+				break
+			}
+		}
+	}
+	return defs, remoteDefs, nil
+}
+
+type apiDescribeRefsByOffset []*apiDescribeRef
+
+func (v apiDescribeRefsByOffset) Len() int      { return len(v) }
+func (v apiDescribeRefsByOffset) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v apiDescribeRefsByOffset) Less(i, j int) bool {
+	a, b := v[i].Ref, v[j].Ref
+	if a.Start != b.Start {
+		return a.Start < b.Start
+	}
+	return a.End < b.End
+}
+
 func abs(n int) int {
 	if n < 0 {
 		return -1 * n
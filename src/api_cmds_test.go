@@ -0,0 +1,109 @@
+package src
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// testGraphReader returns a func that reads the graph data of the
+// named source units (of type "t") from graphs, and returns nil for
+// other units.
+func testGraphReader(graphs map[string]*graph.Output) func(*unit.SourceUnit) (*graph.Output, error) {
+	return func(u *unit.SourceUnit) (*graph.Output, error) {
+		if u.Type != "t" {
+			return nil, nil
+		}
+		return graphs[u.Name], nil
+	}
+}
+
+func TestDescribeFileRefs(t *testing.T) {
+	graphs := map[string]*graph.Output{
+		"u1": {Refs: []*graph.Ref{
+			{File: "f", Start: 10, End: 12, DefPath: "a"},
+			{File: "g", Start: 1, End: 2, DefPath: "a"},
+			{File: "f", Start: 3, End: 5, DefRepo: "r2", DefUnitType: "t", DefUnit: "x", DefPath: "b"},
+		}},
+		"u2": {Refs: []*graph.Ref{
+			{File: "f", Start: 3, End: 4, DefUnitType: "t", DefUnit: "u1", DefPath: "a"},
+		}},
+	}
+	units := []*unit.SourceUnit{{Type: "t", Name: "u1"}, {Type: "t", Name: "u2"}, {Type: "t", Name: "none"}}
+
+	refs, err := describeFileRefs("f", "r", units, testGraphReader(graphs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []graph.Ref{
+		{File: "f", Start: 3, End: 4, DefRepo: "r", DefUnitType: "t", DefUnit: "u1", DefPath: "a"},
+		{File: "f", Start: 3, End: 5, DefRepo: "r2", DefUnitType: "t", DefUnit: "x", DefPath: "b"},
+		{File: "f", Start: 10, End: 12, DefRepo: "r", DefUnitType: "t", DefUnit: "u1", DefPath: "a"},
+	}
+	var got []graph.Ref
+	for _, r := range refs {
+		got = append(got, *r.Ref)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got refs\n%+v\nwant\n%+v", got, want)
+	}
+
+	errRead := errors.New("read failed")
+	_, err = describeFileRefs("f", "r", units, func(*unit.SourceUnit) (*graph.Output, error) { return nil, errRead })
+	if err != errRead {
+		t.Errorf("got error %v, want the read error", err)
+	}
+}
+
+func TestDescribeLocalDefs(t *testing.T) {
+	graphs := map[string]*graph.Output{
+		"u1": {
+			Defs: []*graph.Def{
+				{DefKey: graph.DefKey{Path: "a"}, Name: "a", File: "a.go"},
+				{DefKey: graph.DefKey{Path: "b"}, Name: "b", File: "b.go"},
+			},
+			Docs: []*graph.Doc{{DefKey: graph.DefKey{Path: "a"}, Data: "doc of a"}},
+		},
+	}
+	ref := func(repo, unit, path string) *apiDescribeRef {
+		return &apiDescribeRef{Ref: &graph.Ref{DefRepo: repo, DefUnitType: "t", DefUnit: unit, DefPath: path}}
+	}
+	refs := []*apiDescribeRef{
+		ref("r", "u1", "a"),
+		ref("r", "u1", "a"),
+		ref("r", "u1", "b"),
+		ref("r", "u1", "missing"),
+		ref("r", "none", "c"),
+		ref("r2", "x", "d"),
+		ref("r2", "x", "d"),
+	}
+
+	defs, remoteDefs, err := describeLocalDefs(refs, "r", "/root", testGraphReader(graphs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := func(repo, unit, path string) graph.DefKey {
+		return graph.DefKey{Repo: repo, UnitType: "t", Unit: unit, Path: path}
+	}
+	if len(defs) != 5 {
+		t.Errorf("got %d def keys, want 5 (one for each distinct def)", len(defs))
+	}
+	if d := defs[key("r", "u1", "a")]; d == nil || d.Name != "a" || d.DocHTML != "doc of a" || d.File != filepath.Join("/root", "a.go") {
+		t.Errorf("got def a %+v, want a with its doc and absolute file", d)
+	}
+	if d := defs[key("r", "u1", "b")]; d == nil || d.Name != "b" || d.DocHTML != "" {
+		t.Errorf("got def b %+v, want b without docs", d)
+	}
+	for _, k := range []graph.DefKey{key("r", "u1", "missing"), key("r", "none", "c"), key("r2", "x", "d")} {
+		if d, present := defs[k]; !present || d != nil {
+			t.Errorf("%v: got def %+v (present: %v), want nil", k, d, present)
+		}
+	}
+	if want := []graph.DefKey{key("r2", "x", "d")}; !reflect.DeepEqual(remoteDefs, want) {
+		t.Errorf("got remote defs %v, want %v", remoteDefs, want)
+	}
+}
@@ -0,0 +1,166 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// apiDepUsage is the output of `src api dep-usage`.
+type apiDepUsage struct {
+	Repo string // the dependency repository
+	Refs int    // total number of refs to defs in Repo
+
+	// Defs are the referenced defs in Repo, sorted by number of refs
+	// (most first).
+	Defs []*apiDepUsageDef
+}
+
+// apiDepUsageDef is a def in a dependency and the refs to it.
+type apiDepUsageDef struct {
+	UnitType string
+	Unit     string
+	Path     string
+	Refs     int
+
+	// Files are the files that contain refs to the def, sorted by
+	// number of refs (most first).
+	Files []*apiDepUsageFile
+}
+
+// apiDepUsageFile is a file that refers to a def in a dependency.
+type apiDepUsageFile struct {
+	File       string
+	SourceUnit string // the source unit that contains the file
+	Refs       int
+}
+
+func (c *APIDepUsageCmd) Execute(args []string) error {
+	if c.Args.Repo == "" {
+		return errors.New("no dependency repository specified")
+	}
+	depRepo := c.Args.Repo
+	if strings.Contains(depRepo, "://") {
+		uri, err := graph.TryMakeURI(depRepo)
+		if err != nil {
+			return err
+		}
+		depRepo = uri
+	}
+
+	context, err := prepareCommandContext(c.Args.Dir.String())
+	if err != nil {
+		return err
+	}
+	unitFiles := getSourceUnits(context.commitFS, context.repo)
+	if len(unitFiles) == 0 {
+		return errors.New("No source units found. Try running `src config` first.")
+	}
+
+	units := make([]*unit.SourceUnit, len(unitFiles))
+	for i, unitFile := range unitFiles {
+		if err := readJSONFileFS(context.commitFS, unitFile, &units[i]); err != nil {
+			return err
+		}
+	}
+	usage, err := depUsage(depRepo, units, func(u *unit.SourceUnit) (*graph.Output, error) {
+		var g *graph.Output
+		graphFile := plan.SourceUnitDataFilename("graph", u)
+		if err := readJSONFileFS(context.commitFS, graphFile, &g); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return g, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if usage.Refs == 0 && GlobalOpt.Verbose {
+		fmt.Fprintf(os.Stderr, "No refs to defs in %s found; it may be an unneeded dependency.\n", depRepo)
+	}
+	return json.NewEncoder(os.Stdout).Encode(usage)
+}
+
+// depUsage returns the usage of the defs in depRepo by the refs in
+// the graph data of units (read by readGraph, which returns nil for
+// units that weren't graphed).
+func depUsage(depRepo string, units []*unit.SourceUnit, readGraph func(*unit.SourceUnit) (*graph.Output, error)) (*apiDepUsage, error) {
+	usage := &apiDepUsage{Repo: depRepo}
+	defs := map[graph.DefKey]*apiDepUsageDef{}
+	files := map[*apiDepUsageDef]map[string]*apiDepUsageFile{}
+	for _, u := range units {
+		g, err := readGraph(u)
+		if err != nil {
+			return nil, err
+		}
+		if g == nil {
+			continue
+		}
+
+		for _, ref := range g.Refs {
+			if !graph.URIEqual(ref.DefRepo, depRepo) {
+				continue
+			}
+			k := graph.DefKey{UnitType: ref.DefUnitType, Unit: ref.DefUnit, Path: ref.DefPath}
+			d, present := defs[k]
+			if !present {
+				d = &apiDepUsageDef{UnitType: k.UnitType, Unit: k.Unit, Path: k.Path}
+				defs[k] = d
+				files[d] = map[string]*apiDepUsageFile{}
+			}
+			f, present := files[d][ref.File]
+			if !present {
+				f = &apiDepUsageFile{File: ref.File, SourceUnit: u.Name}
+				files[d][ref.File] = f
+				d.Files = append(d.Files, f)
+			}
+			f.Refs++
+			d.Refs++
+			usage.Refs++
+		}
+	}
+
+	usage.Defs = make([]*apiDepUsageDef, 0, len(defs))
+	for _, d := range defs {
+		sort.Sort(apiDepUsageFiles(d.Files))
+		usage.Defs = append(usage.Defs, d)
+	}
+	sort.Sort(apiDepUsageDefs(usage.Defs))
+	return usage, nil
+}
+
+type apiDepUsageDefs []*apiDepUsageDef
+
+func (v apiDepUsageDefs) Len() int      { return len(v) }
+func (v apiDepUsageDefs) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v apiDepUsageDefs) Less(i, j int) bool {
+	a, b := v[i], v[j]
+	if a.Refs != b.Refs {
+		return a.Refs > b.Refs
+	}
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	if a.Unit != b.Unit {
+		return a.Unit < b.Unit
+	}
+	return a.Path < b.Path
+}
+
+type apiDepUsageFiles []*apiDepUsageFile
+
+func (v apiDepUsageFiles) Len() int      { return len(v) }
+func (v apiDepUsageFiles) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v apiDepUsageFiles) Less(i, j int) bool {
+	if v[i].Refs != v[j].Refs {
+		return v[i].Refs > v[j].Refs
+	}
+	return v[i].File < v[j].File
+}
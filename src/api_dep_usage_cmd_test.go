@@ -0,0 +1,78 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestDepUsage(t *testing.T) {
+	ref := func(file, repo, path string) *graph.Ref {
+		return &graph.Ref{File: file, DefRepo: repo, DefUnitType: "t", DefUnit: "x", DefPath: path}
+	}
+	def := func(path string, refs int, files ...*apiDepUsageFile) *apiDepUsageDef {
+		return &apiDepUsageDef{UnitType: "t", Unit: "x", Path: path, Refs: refs, Files: files}
+	}
+	units := []*unit.SourceUnit{{Type: "t", Name: "u1"}, {Type: "t", Name: "u2"}, {Type: "t", Name: "none"}}
+
+	tests := map[string]struct {
+		graphs map[string]*graph.Output
+		want   *apiDepUsage
+	}{
+		"no refs": {
+			graphs: map[string]*graph.Output{"u1": {Refs: []*graph.Ref{ref("f", "other.com/r", "a")}}},
+			want:   &apiDepUsage{Repo: "dep.com/r", Defs: []*apiDepUsageDef{}},
+		},
+		"case-insensitive repo": {
+			graphs: map[string]*graph.Output{"u1": {Refs: []*graph.Ref{ref("f", "Dep.com/R", "a")}}},
+			want: &apiDepUsage{Repo: "dep.com/r", Refs: 1, Defs: []*apiDepUsageDef{
+				def("a", 1, &apiDepUsageFile{File: "f", SourceUnit: "u1", Refs: 1}),
+			}},
+		},
+		"counts and order": {
+			graphs: map[string]*graph.Output{
+				"u1": {Refs: []*graph.Ref{
+					ref("f", "dep.com/r", "a"),
+					ref("g", "dep.com/r", "b"),
+					ref("f", "dep.com/r", "b"),
+					ref("f", "other.com/r", "b"),
+				}},
+				"u2": {Refs: []*graph.Ref{
+					ref("h", "dep.com/r", "b"),
+					ref("h", "dep.com/r", "b"),
+					ref("h", "dep.com/r", "c"),
+				}},
+			},
+			want: &apiDepUsage{Repo: "dep.com/r", Refs: 6, Defs: []*apiDepUsageDef{
+				def("b", 4,
+					&apiDepUsageFile{File: "h", SourceUnit: "u2", Refs: 2},
+					&apiDepUsageFile{File: "f", SourceUnit: "u1", Refs: 1},
+					&apiDepUsageFile{File: "g", SourceUnit: "u1", Refs: 1},
+				),
+				def("a", 1, &apiDepUsageFile{File: "f", SourceUnit: "u1", Refs: 1}),
+				def("c", 1, &apiDepUsageFile{File: "h", SourceUnit: "u2", Refs: 1}),
+			}},
+		},
+	}
+	for label, test := range tests {
+		got, err := depUsage("dep.com/r", units, testGraphReader(test.graphs))
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(test.want)
+			t.Errorf("%s: got %s, want %s", label, gotJSON, wantJSON)
+		}
+	}
+
+	errRead := errors.New("read failed")
+	if _, err := depUsage("dep.com/r", units, func(*unit.SourceUnit) (*graph.Output, error) { return nil, errRead }); err != errRead {
+		t.Errorf("got error %v, want the read error", err)
+	}
+}
@@ -0,0 +1,195 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	_, err := CLI.AddCommand("api-diff",
+		"compare the exported defs of two indexed commits",
+		`The api-diff command compares the exported defs at two commits in the store and lists, for each source unit, the defs that were added, removed, or changed (i.e., whose signature changed; see "src blame-def -h") from commit A to commit B.
+
+Removed and changed defs are breaking changes for consumers of a unit's API. With --breaking, the command exits with an error if there are any, which is useful in release checks.
+
+With --format table (the default), it prints the changes to each source unit for people ("-" for removed, "~" for changed, and "+" for added defs); with --format json, a JSON array of source units and their changes; and with --format quiet, nothing. It exits with status 3 if no exported defs changed (or with status 0, if --breaking is given), 1 if the query fails or (with --breaking) there are breaking changes, and 0 otherwise.`,
+		&apiDiffCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type APIDiffCmd struct {
+	Repo     string `long:"repo" description:"repo URI (if the store contains multiple repos)"`
+	UnitType string `long:"unit-type" description:"only compare defs in source units of this type"`
+	Unit     string `long:"unit" description:"only compare defs in source units with this name"`
+	Breaking bool   `long:"breaking" description:"exit with an error if any exported defs were removed or changed"`
+
+	Format string `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+
+	Args struct {
+		A string `name:"A" description:"old commit ID"`
+		B string `name:"B" description:"new commit ID"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var apiDiffCmd APIDiffCmd
+
+// An apiDiffUnit lists the changes to the exported defs of a source
+// unit.
+type apiDiffUnit struct {
+	UnitType, Unit string
+
+	Added   []*graph.Def     `json:",omitempty"`
+	Removed []*graph.Def     `json:",omitempty"`
+	Changed []*apiDiffChange `json:",omitempty"`
+}
+
+// An apiDiffChange is an exported def whose signature changed.
+type apiDiffChange struct {
+	Old, New                *graph.Def
+	OldSignature, Signature string
+}
+
+func (c *APIDiffCmd) Execute(args []string) error {
+	if (c.UnitType != "" && c.Unit == "") || (c.UnitType == "" && c.Unit != "") {
+		return fmt.Errorf("must specify either both or neither of --unit-type and --unit (to filter by source unit)")
+	}
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+
+	exportedDefs := func(commitID string) ([]*graph.Def, error) {
+		return (&StoreDefsCmd{
+			Repo:     c.Repo,
+			CommitID: commitID,
+			UnitType: c.UnitType,
+			Unit:     c.Unit,
+			Filter:   store.DefFilterFunc(func(def *graph.Def) bool { return def.Exported }),
+		}).Get()
+	}
+	oldDefs, err := exportedDefs(c.Args.A)
+	if err != nil {
+		return err
+	}
+	newDefs, err := exportedDefs(c.Args.B)
+	if err != nil {
+		return err
+	}
+	if len(oldDefs) == 0 && len(newDefs) == 0 {
+		return fmt.Errorf("no exported defs found at commits %s and %s (are they in the store?)", c.Args.A, c.Args.B)
+	}
+	units := diffAPIs(oldDefs, newDefs)
+
+	switch format {
+	case formatJSON:
+		PrintJSON(units, "  ")
+	case formatTable:
+		for _, u := range units {
+			fmt.Printf("%s %s\n", u.UnitType, u.Unit)
+			for _, def := range u.Removed {
+				fmt.Printf("\t- %s\t%s\n", def.Path, defSignature(def))
+			}
+			for _, ch := range u.Changed {
+				fmt.Printf("\t~ %s\t%s -> %s\n", ch.New.Path, ch.OldSignature, ch.Signature)
+			}
+			for _, def := range u.Added {
+				fmt.Printf("\t+ %s\t%s\n", def.Path, defSignature(def))
+			}
+		}
+	}
+
+	if c.Breaking {
+		var breaking int
+		for _, u := range units {
+			breaking += len(u.Removed) + len(u.Changed)
+		}
+		if breaking > 0 {
+			return fmt.Errorf("%d breaking changes to exported defs from %s to %s", breaking, c.Args.A, c.Args.B)
+		}
+		return nil
+	}
+	if len(units) == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// diffAPIs compares the exported defs of two commits (which are
+// matched by unit and def path). Only units with changes are
+// returned, sorted by unit type and name; the defs in each list are
+// sorted by path.
+func diffAPIs(oldDefs, newDefs []*graph.Def) []*apiDiffUnit {
+	type defKey struct {
+		unit unit.ID2
+		path string
+	}
+	oldByKey := make(map[defKey]*graph.Def, len(oldDefs))
+	for _, def := range oldDefs {
+		oldByKey[defKey{unit.ID2{Type: def.UnitType, Name: def.Unit}, def.Path}] = def
+	}
+
+	unitsByID := map[unit.ID2]*apiDiffUnit{}
+	diffUnit := func(def *graph.Def) *apiDiffUnit {
+		id := unit.ID2{Type: def.UnitType, Name: def.Unit}
+		u, present := unitsByID[id]
+		if !present {
+			u = &apiDiffUnit{UnitType: id.Type, Unit: id.Name}
+			unitsByID[id] = u
+		}
+		return u
+	}
+
+	for _, def := range newDefs {
+		k := defKey{unit.ID2{Type: def.UnitType, Name: def.Unit}, def.Path}
+		old, present := oldByKey[k]
+		if !present {
+			u := diffUnit(def)
+			u.Added = append(u.Added, def)
+			continue
+		}
+		delete(oldByKey, k) // the remaining old defs were removed
+		if sig, oldSig := defSignature(def), defSignature(old); sig != oldSig {
+			u := diffUnit(def)
+			u.Changed = append(u.Changed, &apiDiffChange{Old: old, New: def, OldSignature: oldSig, Signature: sig})
+		}
+	}
+	for _, def := range oldByKey {
+		u := diffUnit(def)
+		u.Removed = append(u.Removed, def)
+	}
+
+	units := make([]*apiDiffUnit, 0, len(unitsByID))
+	for _, u := range unitsByID {
+		sort.Sort(graph.Defs(u.Added))
+		sort.Sort(graph.Defs(u.Removed))
+		sort.Sort(apiDiffChangesByPath(u.Changed))
+		units = append(units, u)
+	}
+	sort.Sort(apiDiffUnits(units))
+	return units
+}
+
+type apiDiffUnits []*apiDiffUnit
+
+func (v apiDiffUnits) Len() int      { return len(v) }
+func (v apiDiffUnits) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v apiDiffUnits) Less(i, j int) bool {
+	if v[i].UnitType != v[j].UnitType {
+		return v[i].UnitType < v[j].UnitType
+	}
+	return v[i].Unit < v[j].Unit
+}
+
+type apiDiffChangesByPath []*apiDiffChange
+
+func (v apiDiffChangesByPath) Len() int           { return len(v) }
+func (v apiDiffChangesByPath) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v apiDiffChangesByPath) Less(i, j int) bool { return v[i].New.Path < v[j].New.Path }
@@ -0,0 +1,71 @@
+package src
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestDiffAPIs(t *testing.T) {
+	def := func(u, path, kind string) *graph.Def {
+		return &graph.Def{DefKey: graph.DefKey{UnitType: "t", Unit: u, Path: path}, Name: path, Kind: kind, Exported: true}
+	}
+
+	// summary describes a unit's changes as "-path", "~path", and
+	// "+path" entries.
+	type summary struct {
+		unit    string
+		changes []string
+	}
+	tests := map[string]struct {
+		old, new []*graph.Def
+		want     []summary
+	}{
+		"no changes": {
+			old: []*graph.Def{def("u", "a", "func")},
+			new: []*graph.Def{def("u", "a", "func")},
+		},
+		"position changes ignored": {
+			old: []*graph.Def{def("u", "a", "func")},
+			new: []*graph.Def{{DefKey: graph.DefKey{UnitType: "t", Unit: "u", Path: "a"}, Name: "a", Kind: "func", File: "moved.go", DefStart: 10}},
+		},
+		"added, removed, and changed": {
+			old:  []*graph.Def{def("u", "b", "func"), def("u", "a", "func"), def("u", "d", "func")},
+			new:  []*graph.Def{def("u", "c", "func"), def("u", "a", "var"), def("u", "b", "func"), def("u", "e", "type")},
+			want: []summary{{"u", []string{"-d", "~a", "+c", "+e"}}},
+		},
+		"units": {
+			old:  []*graph.Def{def("u2", "a", "func"), def("u1", "a", "func")},
+			new:  []*graph.Def{def("u1", "a", "func"), def("u3", "a", "func")},
+			want: []summary{{"u2", []string{"-a"}}, {"u3", []string{"+a"}}},
+		},
+		"same path in other unit": {
+			old:  []*graph.Def{def("u1", "a", "func")},
+			new:  []*graph.Def{def("u2", "a", "func")},
+			want: []summary{{"u1", []string{"-a"}}, {"u2", []string{"+a"}}},
+		},
+	}
+	for label, test := range tests {
+		var got []summary
+		for _, u := range diffAPIs(test.old, test.new) {
+			s := summary{unit: u.Unit}
+			for _, def := range u.Removed {
+				s.changes = append(s.changes, "-"+def.Path)
+			}
+			for _, ch := range u.Changed {
+				s.changes = append(s.changes, "~"+ch.New.Path)
+				if ch.Old.Path != ch.New.Path || ch.OldSignature != defSignature(ch.Old) || ch.Signature != defSignature(ch.New) {
+					t.Errorf("%s: got inconsistent change %+v", label, ch)
+				}
+			}
+			for _, def := range u.Added {
+				s.changes = append(s.changes, "+"+def.Path)
+			}
+			got = append(got, s)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", label, got, test.want)
+		}
+	}
+}
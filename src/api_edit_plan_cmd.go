@@ -0,0 +1,246 @@
+package src
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"unicode/utf8"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// An editPlan is the output of `src api edit-plan`: a list of file
+// edits that external tools (such as editor plugins) can apply to
+// perform a refactoring.
+type editPlan struct {
+	Def     graph.DefKey
+	OldName string
+	NewName string
+
+	// Edits are sorted by file and start offset, and they don't
+	// overlap. Tools should apply the edits in each file from last to
+	// first so that the offsets of the remaining edits stay valid.
+	Edits []*fileEdit
+
+	// Skipped are the refs to the def whose text in the file isn't (or
+	// doesn't end with a qualified) name of the def, typically because the file
+	// changed since it was built or the ref's span covers more than the
+	// name. They are not edited and must be checked manually.
+	Skipped []*fileEdit `json:",omitempty"`
+}
+
+// A fileEdit replaces the bytes in [Start, End) in File with
+// Replacement.
+type fileEdit struct {
+	File        string
+	Start, End  uint32
+	Replacement string
+}
+
+func (c *APIEditPlanCmd) Execute(args []string) error {
+	if !c.Rename {
+		return errors.New("no refactoring specified (the only supported refactoring is --rename)")
+	}
+	if c.Args.NewName == "" {
+		return errors.New("no new name specified")
+	}
+
+	context, err := prepareCommandContext(".")
+	if err != nil {
+		return err
+	}
+	unitFiles := getSourceUnits(context.commitFS, context.repo)
+	if len(unitFiles) == 0 {
+		return errors.New("No source units found. Try running `src config` first.")
+	}
+
+	defKey := graph.DefKey{UnitType: c.UnitType, Unit: c.Unit, Path: c.Args.Def}
+	var (
+		def  *graph.Def
+		refs []*graph.Ref
+	)
+	for _, unitFile := range unitFiles {
+		var u *unit.SourceUnit
+		if err := readJSONFileFS(context.commitFS, unitFile, &u); err != nil {
+			return err
+		}
+		var g graph.Output
+		if err := readJSONFileFS(context.commitFS, plan.SourceUnitDataFilename("graph", u), &g); err != nil {
+			if os.IsNotExist(err) {
+				continue // unit wasn't graphed
+			}
+			return err
+		}
+
+		if u.Type == defKey.UnitType && u.Name == defKey.Unit {
+			for _, d := range g.Defs {
+				if d.Path == defKey.Path {
+					def = d
+					break
+				}
+			}
+		}
+		for _, ref := range g.Refs {
+			if ref.DefRepo != "" && !graph.URIEqual(ref.DefRepo, context.repo.URI()) {
+				continue
+			}
+			defUnitType, defUnit := ref.DefUnitType, ref.DefUnit
+			if defUnitType == "" && defUnit == "" {
+				defUnitType, defUnit = u.Type, u.Name
+			}
+			if defUnitType == defKey.UnitType && defUnit == defKey.Unit && ref.DefPath == defKey.Path {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	if def == nil {
+		return fmt.Errorf("def %s %s %s not found", defKey.UnitType, defKey.Unit, defKey.Path)
+	}
+	if def.Name == c.Args.NewName {
+		return fmt.Errorf("def %s is already named %q", defKey.Path, c.Args.NewName)
+	}
+
+	p, err := planRename(context.repo.RootDir, def, refs, c.Args.NewName)
+	if err != nil {
+		return err
+	}
+	p.Def = defKey
+	return json.NewEncoder(os.Stdout).Encode(p)
+}
+
+// planRename returns the edits that rename def (whose files are
+// relative to rootDir) to newName, by replacing its name at its
+// definition and at each of its refs.
+func planRename(rootDir string, def *graph.Def, refs []*graph.Ref, newName string) (*editPlan, error) {
+	p := &editPlan{OldName: def.Name, NewName: newName}
+	name := []byte(def.Name)
+
+	files := map[string][]byte{}
+	readFile := func(file string) ([]byte, error) {
+		data, present := files[file]
+		if !present {
+			var err error
+			data, err = ioutil.ReadFile(filepath.Join(rootDir, file))
+			if err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			files[file] = data
+		}
+		return data, nil
+	}
+
+	type span struct {
+		file       string
+		start, end uint32
+	}
+	seen := map[span]struct{}{}
+	add := func(file string, start, end uint32) error {
+		data, err := readFile(file)
+		if err != nil {
+			return err
+		}
+		e := &fileEdit{File: file, Start: start, End: end, Replacement: newName}
+		if int(end) > len(data) || start > end || !bytes.HasSuffix(data[start:end], name) {
+			p.Skipped = append(p.Skipped, e)
+			return nil
+		}
+		// The span may cover a qualified name (e.g., "pkg.Name"), so
+		// only replace the name at its end. But a span that ends with
+		// a longer identifier (e.g., "MyName" when renaming "Name") is
+		// stale.
+		nameStart := end - uint32(len(name))
+		if nameStart > start && isIdentByte(data[nameStart-1]) {
+			p.Skipped = append(p.Skipped, e)
+			return nil
+		}
+		e.Start = nameStart
+		k := span{e.File, e.Start, e.End}
+		if _, dup := seen[k]; !dup {
+			seen[k] = struct{}{}
+			p.Edits = append(p.Edits, e)
+		}
+		return nil
+	}
+
+	var haveDefRef bool
+	for _, ref := range refs {
+		if ref.Def {
+			haveDefRef = true
+		}
+		if err := add(ref.File, ref.Start, ref.End); err != nil {
+			return nil, err
+		}
+	}
+	if !haveDefRef {
+		// Use the first occurrence of the name in the def's span as its
+		// definition site.
+		data, err := readFile(def.File)
+		if err != nil {
+			return nil, err
+		}
+		if int(def.DefEnd) <= len(data) && def.DefStart <= def.DefEnd {
+			if i := indexIdent(data[def.DefStart:def.DefEnd], name); i != -1 {
+				start := def.DefStart + uint32(i)
+				if err := add(def.File, start, start+uint32(len(name))); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	sort.Sort(fileEdits(p.Edits))
+	// Drop edits that overlap a preceding edit, so that the plan can
+	// be applied safely.
+	edits := p.Edits[:0]
+	for _, e := range p.Edits {
+		if n := len(edits); n > 0 && edits[n-1].File == e.File && e.Start < edits[n-1].End {
+			p.Skipped = append(p.Skipped, e)
+			continue
+		}
+		edits = append(edits, e)
+	}
+	p.Edits = edits
+	sort.Sort(fileEdits(p.Skipped))
+	return p, nil
+}
+
+// indexIdent returns the index of the first occurrence of the
+// identifier name in s that isn't part of a longer identifier, or -1.
+func indexIdent(s, name []byte) int {
+	for i := 0; i+len(name) <= len(s); {
+		j := bytes.Index(s[i:], name)
+		if j == -1 {
+			return -1
+		}
+		start, end := i+j, i+j+len(name)
+		if (start == 0 || !isIdentByte(s[start-1])) && (end == len(s) || !isIdentByte(s[end])) {
+			return start
+		}
+		i = start + 1
+	}
+	return -1
+}
+
+// isIdentByte returns whether b can be part of an identifier (in most
+// languages). The bytes of non-ASCII characters are assumed to be.
+func isIdentByte(b byte) bool {
+	return b == '_' || b == '$' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || b >= utf8.RuneSelf
+}
+
+type fileEdits []*fileEdit
+
+func (v fileEdits) Len() int      { return len(v) }
+func (v fileEdits) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v fileEdits) Less(i, j int) bool {
+	if v[i].File != v[j].File {
+		return v[i].File < v[j].File
+	}
+	return v[i].Start < v[j].Start
+}
@@ -0,0 +1,126 @@
+package src
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestPlanRename(t *testing.T) {
+	const src = "package p\n\ntype MyName int\n\nfunc Name() {}\n\nvar _ = Name\nvar _ = pkg.Name\nvar _ = MyName\nvar _ = aaa\n"
+	dir, err := ioutil.TempDir("", "srclib-edit-plan-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// at returns the span of the n'th occurrence (from 0) of s in src.
+	at := func(s string, n int) (start, end uint32) {
+		i := -1
+		for ; n >= 0; n-- {
+			i += 1 + strings.Index(src[i+1:], s)
+		}
+		return uint32(i), uint32(i + len(s))
+	}
+	ref := func(s string, n int) *graph.Ref {
+		start, end := at(s, n)
+		return &graph.Ref{File: "a.go", Start: start, End: end}
+	}
+	edit := func(s string, n int, newName string) *fileEdit {
+		start, end := at(s, n)
+		return &fileEdit{File: "a.go", Start: start, End: end, Replacement: newName}
+	}
+	funcStart, _ := at("func Name", 0)
+	_, funcEnd := at("{}", 0)
+	def := &graph.Def{Name: "Name", File: "a.go", DefStart: funcStart, DefEnd: funcEnd}
+
+	overlapStart, _ := at("aaa", 0)
+
+	tests := map[string]struct {
+		def         *graph.Def
+		newName     string
+		refs        []*graph.Ref
+		wantEdits   []*fileEdit
+		wantSkipped []*fileEdit
+	}{
+		"def site found in def span": {
+			def:       def,
+			refs:      []*graph.Ref{ref("Name", 2)},
+			wantEdits: []*fileEdit{edit("Name", 1, "N"), edit("Name", 2, "N")},
+		},
+		"def ref": {
+			def:       def,
+			refs:      []*graph.Ref{{File: "a.go", Start: funcStart + 5, End: funcStart + 9, Def: true}},
+			wantEdits: []*fileEdit{edit("Name", 1, "N")},
+		},
+		"qualified span": {
+			def:       def,
+			refs:      []*graph.Ref{ref("pkg.Name", 0)},
+			wantEdits: []*fileEdit{edit("Name", 1, "N"), edit("Name", 3, "N")},
+		},
+		"stale span ending with a longer identifier": {
+			def:         def,
+			refs:        []*graph.Ref{ref("MyName", 1)},
+			wantEdits:   []*fileEdit{edit("Name", 1, "N")},
+			wantSkipped: []*fileEdit{edit("MyName", 1, "N")},
+		},
+		"stale span not ending with the name": {
+			def:         def,
+			refs:        []*graph.Ref{ref("var", 0)},
+			wantEdits:   []*fileEdit{edit("Name", 1, "N")},
+			wantSkipped: []*fileEdit{edit("var", 0, "N")},
+		},
+		"duplicate spans": {
+			def:       def,
+			refs:      []*graph.Ref{ref("pkg.Name", 0), ref("Name", 3)},
+			wantEdits: []*fileEdit{edit("Name", 1, "N"), edit("Name", 3, "N")},
+		},
+		"overlapping spans": {
+			def:         &graph.Def{Name: "aa", File: "a.go"},
+			newName:     "b",
+			refs:        []*graph.Ref{ref("aa", 0), {File: "a.go", Start: overlapStart + 1, End: overlapStart + 3}},
+			wantEdits:   []*fileEdit{edit("aa", 0, "b")},
+			wantSkipped: []*fileEdit{{File: "a.go", Start: overlapStart + 1, End: overlapStart + 3, Replacement: "b"}},
+		},
+		"missing file": {
+			def:         def,
+			refs:        []*graph.Ref{{File: "b.go", Start: 0, End: 4}},
+			wantEdits:   []*fileEdit{edit("Name", 1, "N")},
+			wantSkipped: []*fileEdit{{File: "b.go", Start: 0, End: 4, Replacement: "N"}},
+		},
+	}
+	for label, test := range tests {
+		newName := test.newName
+		if newName == "" {
+			newName = "N"
+		}
+		p, err := planRename(dir, test.def, test.refs, newName)
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if !reflect.DeepEqual(p.Edits, test.wantEdits) {
+			t.Errorf("%s: got edits %s, want %s", label, fileEditsString(p.Edits), fileEditsString(test.wantEdits))
+		}
+		if !reflect.DeepEqual(p.Skipped, test.wantSkipped) {
+			t.Errorf("%s: got skipped %s, want %s", label, fileEditsString(p.Skipped), fileEditsString(test.wantSkipped))
+		}
+	}
+}
+
+func fileEditsString(edits []*fileEdit) string {
+	strs := make([]string, len(edits))
+	for i, e := range edits {
+		strs[i] = fmt.Sprintf("%s:%d-%d=%q", e.File, e.Start, e.End, e.Replacement)
+	}
+	return "[" + strings.Join(strs, " ") + "]"
+}
@@ -0,0 +1,288 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/ann"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// apiFileAnnotations is the output of `src api file-annotations`.
+type apiFileAnnotations struct {
+	Repo     string `json:",omitempty"`
+	CommitID string
+	File     string
+
+	// Spans are the file's decorated byte ranges, sorted by start
+	// offset and then by length (longest first).
+	Spans []*apiFileSpan
+}
+
+// apiFileSpan is a byte range of a file and the refs, defs, and
+// annotations at exactly that range.
+type apiFileSpan struct {
+	Start, End uint32
+
+	Refs []*apiFileSpanRef `json:",omitempty"`
+
+	// Defs are the defs declared at the span: those whose name is at
+	// the span (that have a def ref there), or else whose whole
+	// definition is the span.
+	Defs []*graph.Def `json:",omitempty"`
+
+	Anns []*ann.Ann `json:",omitempty"`
+}
+
+// apiFileSpanRef is a ref and the def that it refers to (nil if the
+// def is in another repository or couldn't be found).
+type apiFileSpanRef struct {
+	Ref *graph.Ref
+	Def *graph.Def `json:",omitempty"`
+}
+
+func (c *APIFileAnnotationsCmd) Execute(args []string) error {
+	context, err := c.commandContext()
+	if err != nil {
+		return err
+	}
+	file := filepath.ToSlash(context.relativeFile)
+	units, err := getSourceUnitsWithFile(context.buildStore, context.repo, context.relativeFile)
+	if err != nil {
+		return err
+	}
+	if GlobalOpt.Verbose {
+		log.Printf("File %s is in %d source units.", file, len(units))
+	}
+
+	graphs := map[unit.ID2]*graph.Output{}
+	readGraph := func(u *unit.SourceUnit) (*graph.Output, error) {
+		if g, present := graphs[u.ID2()]; present {
+			return g, nil
+		}
+		var g *graph.Output
+		graphFile := plan.SourceUnitDataFilename("graph", u)
+		if err := readJSONFileFS(context.commitFS, graphFile, &g); err != nil {
+			if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("%s: %s", graphFile, err)
+			}
+		}
+		graphs[u.ID2()] = g
+		return g, nil
+	}
+
+	repoURI := context.repo.URI()
+	spans, err := c.annotationSpans(file, repoURI, units, readGraph)
+	if err != nil {
+		return err
+	}
+
+	out := &apiFileAnnotations{
+		Repo:     repoURI,
+		CommitID: context.repo.CommitID,
+		File:     file,
+		Spans:    spans,
+	}
+	return json.NewEncoder(os.Stdout).Encode(out)
+}
+
+// annotationSpans returns the sorted spans of file's refs, defs, and
+// annotations in the graph data of units (read by readGraph, which
+// returns nil for units that weren't graphed). The refs' defs in
+// repoURI are looked up with readGraph too.
+func (c *APIFileAnnotationsCmd) annotationSpans(file, repoURI string, units []*unit.SourceUnit, readGraph func(*unit.SourceUnit) (*graph.Output, error)) ([]*apiFileSpan, error) {
+	spans := fileSpans{}
+	for _, u := range units {
+		g, err := readGraph(u)
+		if err != nil {
+			return nil, err
+		}
+		if g == nil {
+			continue
+		}
+
+		// Defs are declared at their def refs' spans if they have
+		// them (and the refs aren't omitted).
+		defs := map[string]*graph.Def{}
+		if !c.NoDefs {
+			for _, def := range g.Defs {
+				if def.File == file {
+					defs[def.Path] = def
+				}
+			}
+		}
+		for _, ref := range g.Refs {
+			if ref.File != file {
+				continue
+			}
+			if ref.DefUnit == "" {
+				ref.DefUnit = u.Name
+			}
+			if ref.DefUnitType == "" {
+				ref.DefUnitType = u.Type
+			}
+			if ref.DefRepo == "" {
+				ref.DefRepo = repoURI
+			}
+			sameUnit := ref.DefRepo == repoURI && ref.DefUnitType == u.Type && ref.DefUnit == u.Name
+			if def, ok := defs[ref.DefPath]; ref.Def && sameUnit && ok {
+				s := spans.get(ref.Start, ref.End)
+				s.Defs = append(s.Defs, def)
+				delete(defs, ref.DefPath)
+			}
+			if !c.NoRefs {
+				s := spans.get(ref.Start, ref.End)
+				s.Refs = append(s.Refs, &apiFileSpanRef{Ref: ref})
+			}
+		}
+		for _, def := range defs {
+			s := spans.get(def.DefStart, def.DefEnd)
+			s.Defs = append(s.Defs, def)
+		}
+		if !c.NoAnns {
+			for _, a := range g.Anns {
+				if a.File == file {
+					s := spans.get(a.Start, a.End)
+					s.Anns = append(s.Anns, a)
+				}
+			}
+		}
+	}
+
+	// Look up the defs that the refs refer to, in the current repo's
+	// build data.
+	targets := map[graph.DefKey]*graph.Def{}
+	for _, s := range spans {
+		for _, r := range s.Refs {
+			k := r.Ref.DefKey()
+			if k.Repo != repoURI {
+				continue
+			}
+			def, present := targets[k]
+			if !present {
+				g, err := readGraph(&unit.SourceUnit{Name: k.Unit, Type: k.UnitType})
+				if err != nil {
+					return nil, err
+				}
+				if g != nil {
+					for _, d := range g.Defs {
+						if d.Path == k.Path {
+							def = d
+							break
+						}
+					}
+				}
+				targets[k] = def
+			}
+			r.Def = def
+		}
+	}
+	return spans.sorted(), nil
+}
+
+// commandContext returns the context of the command: that of the
+// working tree (built if needed), or with --commit, that of the
+// existing build data at the commit.
+func (c *APIFileAnnotationsCmd) commandContext() (commandContext, error) {
+	if c.CommitID == "" {
+		return prepareCommandContext(c.File)
+	}
+
+	file, err := filepath.Abs(c.File)
+	if err != nil {
+		return commandContext{}, err
+	}
+	repo, err := OpenRepo(filepath.Dir(file))
+	if err != nil {
+		return commandContext{}, err
+	}
+	repo.CommitID = c.CommitID
+	rel, err := filepath.Rel(repo.RootDir, file)
+	if err != nil {
+		return commandContext{}, err
+	}
+	buildStore, err := buildstore.LocalRepo(repo.RootDir)
+	if err != nil {
+		return commandContext{}, err
+	}
+	exists, err := buildstore.BuildDataExistsForCommit(buildStore, c.CommitID)
+	if err != nil {
+		return commandContext{}, err
+	}
+	if !exists {
+		return commandContext{}, fmt.Errorf("no build data for commit %s (check out the commit and run `src make`)", c.CommitID)
+	}
+	return commandContext{
+		repo:         repo,
+		relativeFile: rel,
+		buildStore:   buildStore,
+		commitFS:     buildStore.Commit(c.CommitID),
+	}, nil
+}
+
+// fileSpans maps byte ranges to the spans that decorate them.
+type fileSpans map[[2]uint32]*apiFileSpan
+
+// get returns the span for the byte range [start, end), creating it
+// if needed.
+func (m fileSpans) get(start, end uint32) *apiFileSpan {
+	if end < start {
+		end = start
+	}
+	k := [2]uint32{start, end}
+	s, ok := m[k]
+	if !ok {
+		s = &apiFileSpan{Start: start, End: end}
+		m[k] = s
+	}
+	return s
+}
+
+// sorted returns the spans sorted by start offset and then by
+// length (longest first), so that a span comes before the spans
+// nested in it. The items in each span are sorted too, so that the
+// output is deterministic.
+func (m fileSpans) sorted() []*apiFileSpan {
+	spans := make([]*apiFileSpan, 0, len(m))
+	for _, s := range m {
+		sort.Slice(s.Refs, func(i, j int) bool {
+			a, b := s.Refs[i].Ref, s.Refs[j].Ref
+			if a.DefRepo != b.DefRepo {
+				return a.DefRepo < b.DefRepo
+			}
+			if a.DefUnitType != b.DefUnitType {
+				return a.DefUnitType < b.DefUnitType
+			}
+			if a.DefUnit != b.DefUnit {
+				return a.DefUnit < b.DefUnit
+			}
+			return a.DefPath < b.DefPath
+		})
+		sort.Slice(s.Defs, func(i, j int) bool {
+			a, b := s.Defs[i], s.Defs[j]
+			if a.UnitType != b.UnitType {
+				return a.UnitType < b.UnitType
+			}
+			if a.Unit != b.Unit {
+				return a.Unit < b.Unit
+			}
+			return a.Path < b.Path
+		})
+		sort.SliceStable(s.Anns, func(i, j int) bool { return s.Anns[i].Type < s.Anns[j].Type })
+		spans = append(spans, s)
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].Start != spans[j].Start {
+			return spans[i].Start < spans[j].Start
+		}
+		return spans[i].End > spans[j].End
+	})
+	return spans
+}
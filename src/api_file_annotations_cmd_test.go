@@ -0,0 +1,133 @@
+package src
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/ann"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestAPIFileAnnotationsCmd_annotationSpans(t *testing.T) {
+	// graphs returns new graph data for each test, because the spans'
+	// refs are modified.
+	graphs := func() map[string]*graph.Output {
+		return map[string]*graph.Output{
+			"u1": {
+				Defs: []*graph.Def{
+					{DefKey: graph.DefKey{UnitType: "t", Unit: "u1", Path: "a"}, Name: "a", File: "f", DefStart: 0, DefEnd: 20},
+					{DefKey: graph.DefKey{UnitType: "t", Unit: "u1", Path: "b"}, Name: "b", File: "f", DefStart: 30, DefEnd: 40},
+					{DefKey: graph.DefKey{UnitType: "t", Unit: "u1", Path: "z"}, Name: "z", File: "g", DefStart: 0, DefEnd: 5},
+				},
+				Refs: []*graph.Ref{
+					{File: "f", Start: 5, End: 6, DefPath: "a", Def: true},
+					{File: "f", Start: 10, End: 11, DefPath: "b"},
+					{File: "f", Start: 10, End: 11, DefRepo: "r2", DefUnitType: "t", DefUnit: "x", DefPath: "y"},
+					{File: "g", Start: 1, End: 2, DefPath: "z", Def: true},
+				},
+				Anns: []*ann.Ann{
+					{File: "f", Start: 0, End: 20, Type: "fold"},
+					{File: "g", Start: 0, End: 5, Type: "fold"},
+				},
+			},
+			"u2": {
+				Refs: []*graph.Ref{{File: "f", Start: 10, End: 11, DefUnitType: "t", DefUnit: "u1", DefPath: "a"}},
+			},
+		}
+	}
+	units := []*unit.SourceUnit{{Type: "t", Name: "u1"}, {Type: "t", Name: "u2"}, {Type: "t", Name: "none"}}
+
+	// span summarizes a span's refs (as "unit.path=def", or
+	// "unit.path" if the def wasn't found), defs, and anns.
+	type span struct {
+		Start, End       uint32
+		Refs, Defs, Anns []string
+	}
+	tests := map[string]struct {
+		cmd  APIFileAnnotationsCmd
+		want []span
+	}{
+		"all": {
+			want: []span{
+				{Start: 0, End: 20, Anns: []string{"fold"}},
+				{Start: 5, End: 6, Refs: []string{"u1.a=a"}, Defs: []string{"a"}},
+				{Start: 10, End: 11, Refs: []string{"u1.a=a", "u1.b=b", "x.y"}},
+				{Start: 30, End: 40, Defs: []string{"b"}},
+			},
+		},
+		"no refs": {
+			cmd: APIFileAnnotationsCmd{NoRefs: true},
+			want: []span{
+				{Start: 0, End: 20, Anns: []string{"fold"}},
+				{Start: 5, End: 6, Defs: []string{"a"}},
+				{Start: 30, End: 40, Defs: []string{"b"}},
+			},
+		},
+		"no defs": {
+			cmd: APIFileAnnotationsCmd{NoDefs: true},
+			want: []span{
+				{Start: 0, End: 20, Anns: []string{"fold"}},
+				{Start: 5, End: 6, Refs: []string{"u1.a=a"}},
+				{Start: 10, End: 11, Refs: []string{"u1.a=a", "u1.b=b", "x.y"}},
+			},
+		},
+		"no anns": {
+			cmd: APIFileAnnotationsCmd{NoAnns: true},
+			want: []span{
+				{Start: 5, End: 6, Refs: []string{"u1.a=a"}, Defs: []string{"a"}},
+				{Start: 10, End: 11, Refs: []string{"u1.a=a", "u1.b=b", "x.y"}},
+				{Start: 30, End: 40, Defs: []string{"b"}},
+			},
+		},
+	}
+	for label, test := range tests {
+		spans, err := test.cmd.annotationSpans("f", "r", units, testGraphReader(graphs()))
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		var got []span
+		for _, s := range spans {
+			gs := span{Start: s.Start, End: s.End}
+			for _, r := range s.Refs {
+				ref := r.Ref.DefUnit + "." + r.Ref.DefPath
+				if r.Def != nil {
+					ref += "=" + r.Def.Name
+				}
+				gs.Refs = append(gs.Refs, ref)
+			}
+			for _, d := range s.Defs {
+				gs.Defs = append(gs.Defs, d.Name)
+			}
+			for _, a := range s.Anns {
+				gs.Anns = append(gs.Anns, a.Type)
+			}
+			got = append(got, gs)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got spans\n%+v\nwant\n%+v", label, got, test.want)
+		}
+	}
+
+	errRead := errors.New("read failed")
+	var c APIFileAnnotationsCmd
+	if _, err := c.annotationSpans("f", "r", units, func(*unit.SourceUnit) (*graph.Output, error) { return nil, errRead }); err != errRead {
+		t.Errorf("got error %v, want the read error", err)
+	}
+}
+
+func TestFileSpans_get(t *testing.T) {
+	m := fileSpans{}
+	s := m.get(3, 5)
+	if s.Start != 3 || s.End != 5 {
+		t.Errorf("got span %d-%d, want 3-5", s.Start, s.End)
+	}
+	if m.get(3, 5) != s {
+		t.Error("got a new span for the same range, want the existing one")
+	}
+	if s := m.get(7, 2); s.Start != 7 || s.End != 7 {
+		t.Errorf("got span %d-%d for an inverted range, want 7-7", s.Start, s.End)
+	}
+}
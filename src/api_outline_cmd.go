@@ -0,0 +1,56 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+)
+
+func (c *APIOutlineCmd) Execute(args []string) error {
+	context, err := (&APIFileAnnotationsCmd{File: c.File, CommitID: c.CommitID}).commandContext()
+	if err != nil {
+		return err
+	}
+	file := filepath.ToSlash(context.relativeFile)
+	units, err := getSourceUnitsWithFile(context.buildStore, context.repo, context.relativeFile)
+	if err != nil {
+		return err
+	}
+	if GlobalOpt.Verbose {
+		log.Printf("File %s is in %d source units.", file, len(units))
+	}
+
+	var defs []*graph.Def
+	for _, u := range units {
+		var g *graph.Output
+		graphFile := plan.SourceUnitDataFilename("graph", u)
+		if err := readJSONFileFS(context.commitFS, graphFile, &g); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("%s: %s", graphFile, err)
+		}
+		if g == nil {
+			continue
+		}
+		for _, def := range g.Defs {
+			if def.File == file {
+				// Defs with the same path in different source units
+				// are distinct.
+				def.UnitType, def.Unit = u.Type, u.Name
+				defs = append(defs, def)
+			}
+		}
+	}
+
+	outline := graph.Outline(defs)
+	if outline == nil {
+		outline = []*graph.DefNode{}
+	}
+	return json.NewEncoder(os.Stdout).Encode(outline)
+}
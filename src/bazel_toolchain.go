@@ -0,0 +1,95 @@
+package src
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"sourcegraph.com/sourcegraph/srclib/bazel"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// BazelToolchain is the path of the built-in toolchain that graphs
+// Bazel BUILD files (see package bazel). Targets are defs, and the
+// labels that rules refer to (targets in the repository and source
+// files) are refs.
+const BazelToolchain = "sourcegraph.com/sourcegraph/srclib/bazel"
+
+func init() {
+	grapher.RegisterByteOffsetUnitType(bazel.UnitType)
+	toolchain.RegisterBuiltin(BazelToolchain, &toolchain.Builtin{
+		Config: &toolchain.Config{
+			Tools: []*toolchain.ToolInfo{
+				{Subcmd: "scan", Op: "scan"},
+				{Subcmd: "depresolve", Op: "depresolve", SourceUnitTypes: []string{bazel.UnitType}},
+				{Subcmd: "graph", Op: "graph", SourceUnitTypes: []string{bazel.UnitType}},
+			},
+		},
+		Tools: map[string]toolchain.BuiltinTool{
+			"scan":       bazelScan,
+			"depresolve": noDepresolve, // external repositories aren't resolved
+			"graph":      bazelGraph,
+		},
+	})
+}
+
+// bazelScan is the Bazel toolchain's scanner. Each package (directory
+// with a BUILD file) is a source unit, named by its path.
+func bazelScan(args []string, stdin io.Reader, stdout io.Writer) error {
+	dir, err := readScanInput(args, stdin)
+	if err != nil {
+		return err
+	}
+	files, err := scanFiles(dir, bazel.IsBuildFile)
+	if err != nil {
+		return err
+	}
+
+	units := []*unit.SourceUnit{}
+	byDir := map[string]*unit.SourceUnit{}
+	for _, file := range files {
+		d := path.Dir(file)
+		if u := byDir[d]; u != nil {
+			// Bazel uses BUILD.bazel if there are both BUILD and
+			// BUILD.bazel files (which sort after BUILD).
+			u.Files = []string{file}
+			continue
+		}
+		byDir[d] = &unit.SourceUnit{
+			Name:  d,
+			Type:  bazel.UnitType,
+			Dir:   d,
+			Files: []string{file},
+		}
+		units = append(units, byDir[d])
+	}
+	return json.NewEncoder(stdout).Encode(units)
+}
+
+// bazelGraph is the Bazel toolchain's grapher.
+func bazelGraph(args []string, stdin io.Reader, stdout io.Writer) error {
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(stdin).Decode(&u); err != nil {
+		return err
+	}
+
+	var o graph.Output
+	for _, file := range u.Files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fo, err := bazel.Graph(file, data, os.Stat)
+		if err != nil {
+			return err
+		}
+		o.Defs = append(o.Defs, fo.Defs...)
+		o.Refs = append(o.Refs, fo.Refs...)
+	}
+	return json.NewEncoder(stdout).Encode(o)
+}
@@ -0,0 +1,113 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"sourcegraph.com/sourcegraph/srclib/benchmarks"
+)
+
+func init() {
+	_, err := CLI.AddCommand("bench",
+		"run performance benchmarks",
+		`The bench command runs srclib's performance benchmarks (of decoding and normalizing graph output, importing it into a store, and querying the store) on a synthetic fixture and prints their results.
+
+To track performance across releases, save the JSON report of a release (with --format json or --save) and pass it to --compare when benchmarking a later one. The command exits with an error if any benchmark's time or allocations regressed by more than --threshold. Only compare reports from the same (or an identical) machine.
+
+With --format table (the default), it prints aligned columns (with a header row) for people as the benchmarks finish; with --format json, the JSON report; and with --format quiet, nothing (which is useful with --save and --compare).
+`,
+		&benchCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type BenchCmd struct {
+	Size      string  `long:"size" description:"size of the synthetic fixture" default:"medium" value-name:"small|medium|large"`
+	Run       string  `long:"run" description:"only run benchmarks whose names match this regexp" value-name:"REGEXP"`
+	Format    string  `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+	Save      string  `long:"save" description:"also write the JSON report to this file" value-name:"FILE"`
+	Compare   string  `long:"compare" description:"compare the results with this earlier JSON report and fail if any regressed" value-name:"FILE"`
+	Threshold float64 `long:"threshold" description:"relative regression (e.g., 0.1 for 10%) beyond which --compare fails" default:"0.1"`
+}
+
+var benchCmd BenchCmd
+
+func (c *BenchCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	opt := benchmarks.RunOptions{}
+	var ok bool
+	if opt.Size, ok = benchmarks.LookupSize(c.Size); !ok {
+		return fmt.Errorf("unknown --size %q (valid sizes are small, medium, and large)", c.Size)
+	}
+	if c.Run != "" {
+		if opt.Filter, err = regexp.Compile(c.Run); err != nil {
+			return fmt.Errorf("invalid --run regexp: %s", err)
+		}
+	}
+
+	// Read the old report first, so a bad path fails before the
+	// (slow) benchmarks run.
+	var old *benchmarks.Report
+	if c.Compare != "" {
+		old = &benchmarks.Report{}
+		if err := readJSONFile(c.Compare, old); err != nil {
+			return fmt.Errorf("reading --compare report: %s", err)
+		}
+	}
+
+	var tw *tabwriter.Writer
+	if format == formatTable {
+		tw = tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "BENCHMARK\tN\tNS/OP\tB/OP\tALLOCS/OP\tMB/S\t")
+		opt.Progress = func(r *benchmarks.Result) {
+			mbps := ""
+			if r.MBPerSec != 0 {
+				mbps = fmt.Sprintf("%.2f", r.MBPerSec)
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\t\n", r.Name, r.N, r.NsPerOp, r.BytesPerOp, r.AllocsPerOp, mbps)
+			tw.Flush()
+		}
+	}
+
+	rep, err := benchmarks.Run(opt)
+	if err != nil {
+		return err
+	}
+	rep.SrcVersion = Version
+
+	if format == formatJSON {
+		PrintJSON(rep, "")
+	}
+	if c.Save != "" {
+		if err := writeJSONFile(c.Save, rep); err != nil {
+			return err
+		}
+	}
+
+	if old != nil {
+		regs, err := benchmarks.Compare(old, rep, c.Threshold)
+		if err != nil {
+			return err
+		}
+		if len(regs) > 0 {
+			msgs := make([]string, len(regs))
+			for i, r := range regs {
+				msgs[i] = "\t" + r.String()
+			}
+			return fmt.Errorf("%d benchmark measurements regressed by more than %.0f%% compared to %s (src %s):\n%s", len(regs), 100*c.Threshold, c.Compare, old.SrcVersion, strings.Join(msgs, "\n"))
+		}
+		if format == formatTable {
+			fmt.Printf("No regressions compared to %s (src %s).\n", c.Compare, old.SrcVersion)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	_, err := CLI.AddCommand("blame-def",
+		"show the history of a def across indexed commits",
+		`The blame-def command walks the commits in the store (oldest first) and reports when a def first appeared, when its signature changed, and when it was removed.
+
+Defs are matched across commits by their def key (unit type, unit, and def path), which stays the same as long as the def isn't renamed or moved to another source unit. A def's signature is its formatted type (if the toolchain provides a def formatter) or else its kind and toolchain-specific data; changes to its position or docs aren't reported. Commits at which the def's source unit wasn't indexed are skipped.
+
+Commits are ordered by the history of the git repository in the current directory (if it contains all of them), and otherwise in the order that the store lists them.
+
+With --format table (the default), it prints aligned columns (with a header row) of the def's changes for people; with --format json, a JSON array of changes; and with --format quiet, nothing. It exits with status 3 if the def isn't found at any indexed commit, 1 if the query fails, and 0 otherwise.`,
+		&blameDefCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type BlameDefCmd struct {
+	Repo     string `long:"repo" description:"repo URI (if the store contains multiple repos)"`
+	UnitType string `long:"unit-type" description:"source unit type of the def" required:"yes"`
+	Unit     string `long:"unit" description:"source unit name of the def" required:"yes"`
+
+	Format string `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+
+	Args struct {
+		Path string `name:"DEF-PATH" description:"def path"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var blameDefCmd BlameDefCmd
+
+// A defHistoryEvent is a change to a def at a commit.
+type defHistoryEvent struct {
+	CommitID string
+	Change   string // "added", "changed", or "removed"
+
+	Signature    string     `json:",omitempty"` // the def's signature after the change
+	OldSignature string     `json:",omitempty"` // the def's signature before the change
+	Def          *graph.Def `json:",omitempty"` // the def after the change (nil if removed)
+}
+
+func (c *BlameDefCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing versions", s)
+	}
+
+	versions, err := rs.Versions((&StoreVersionsCmd{Repo: c.Repo}).filters()...)
+	if err != nil {
+		return err
+	}
+	commitIDs := make([]string, len(versions))
+	for i, v := range versions {
+		commitIDs[i] = v.CommitID
+	}
+
+	events, err := defHistory(rs, c.Repo, unit.ID2{Type: c.UnitType, Name: c.Unit}, c.Args.Path, orderCommits(commitIDs))
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case formatJSON:
+		if events == nil {
+			events = []*defHistoryEvent{}
+		}
+		PrintJSON(events, "  ")
+	case formatTable:
+		if len(events) == 0 {
+			log.Printf("Def %s %s %s was not found at any indexed commit.", c.UnitType, c.Unit, c.Args.Path)
+			break
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "COMMITID\tCHANGE\tSIGNATURE")
+		for _, e := range events {
+			sig := e.Signature
+			switch e.Change {
+			case "changed":
+				sig = e.OldSignature + " -> " + e.Signature
+			case "removed":
+				sig = e.OldSignature
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", e.CommitID, e.Change, sig)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(events) == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// defHistory returns the changes to the def (of repo, unit u, and
+// path) at each of commitIDs (oldest first). Commits at which u
+// wasn't indexed are skipped.
+func defHistory(rs store.RepoStore, repo string, u unit.ID2, path string, commitIDs []string) ([]*defHistoryEvent, error) {
+	var events []*defHistoryEvent
+	var prev *graph.Def
+	for _, commitID := range commitIDs {
+		ufs := []store.UnitFilter{store.ByCommitIDs(commitID), store.ByUnits(u)}
+		if repo != "" {
+			ufs = append(ufs, store.ByRepos(repo))
+		}
+		units, err := rs.Units(ufs...)
+		if err != nil {
+			return nil, err
+		}
+		if len(units) == 0 {
+			continue
+		}
+
+		defs, err := (&StoreDefsCmd{Repo: repo, CommitID: commitID, UnitType: u.Type, Unit: u.Name, Path: path}).Get()
+		if err != nil {
+			return nil, err
+		}
+		var def *graph.Def
+		if len(defs) > 0 {
+			def = defs[0]
+		}
+
+		switch {
+		case prev == nil && def != nil:
+			events = append(events, &defHistoryEvent{CommitID: commitID, Change: "added", Signature: defSignature(def), Def: def})
+		case prev != nil && def == nil:
+			events = append(events, &defHistoryEvent{CommitID: commitID, Change: "removed", OldSignature: defSignature(prev)})
+		case prev != nil && def != nil:
+			if sig, oldSig := defSignature(def), defSignature(prev); sig != oldSig {
+				events = append(events, &defHistoryEvent{CommitID: commitID, Change: "changed", Signature: sig, OldSignature: oldSig, Def: def})
+			}
+		}
+		prev = def
+	}
+	return events, nil
+}
+
+// defSignature returns a summary of def's API: its keyword, name, and
+// type if the toolchain provides a def formatter, and otherwise its
+// kind, name, and (toolchain-specific) data. It excludes the def's
+// position and docs.
+func defSignature(def *graph.Def) string {
+	if mk, ok := graph.MakeDefFormatters[def.UnitType]; ok {
+		f := mk(def)
+		return f.DefKeyword() + " " + f.Name(graph.ScopeQualified) + f.NameAndTypeSeparator() + f.Type(graph.ScopeQualified)
+	}
+	sig := def.Kind + " " + def.Name
+	if data := bytes.TrimSpace(def.Data); len(data) > 0 && string(data) != "null" {
+		sig += " " + string(data)
+	}
+	return sig
+}
+
+// orderCommits sorts commitIDs from oldest to newest by the history
+// of the git repository in the current dir. If there is no such
+// repository (or it doesn't contain all of the commits), commitIDs is
+// returned unchanged.
+func orderCommits(commitIDs []string) []string {
+	lrepo, err := openLocalRepo()
+	if err != nil || lrepo.VCSType != "git" || len(commitIDs) == 0 {
+		return commitIDs
+	}
+	cmd := exec.Command("git", append([]string{"rev-list", "--topo-order", "--reverse"}, commitIDs...)...)
+	cmd.Dir = lrepo.RootDir
+	out, err := cmd.Output()
+	if err != nil {
+		if GlobalOpt.Verbose {
+			log.Printf("Couldn't order commits by git history (%s); using store order.", err)
+		}
+		return commitIDs
+	}
+
+	indexed := make(map[string]struct{}, len(commitIDs))
+	for _, id := range commitIDs {
+		indexed[id] = struct{}{}
+	}
+	ordered := make([]string, 0, len(commitIDs))
+	for _, id := range strings.Fields(string(out)) {
+		if _, ok := indexed[id]; ok {
+			ordered = append(ordered, id)
+			delete(indexed, id)
+		}
+	}
+	if len(indexed) > 0 {
+		return commitIDs // some commit IDs were abbreviated or not in the history
+	}
+	return ordered
+}
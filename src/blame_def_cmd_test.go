@@ -0,0 +1,93 @@
+package src
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestDefSignature(t *testing.T) {
+	tests := map[string]struct {
+		def  *graph.Def
+		want string
+	}{
+		"kind and name": {def: &graph.Def{Kind: "func", Name: "F"}, want: "func F"},
+		"data":          {def: &graph.Def{Kind: "func", Name: "F", Data: json.RawMessage(` {"Type": "int"} `)}, want: `func F {"Type": "int"}`},
+		"null data":     {def: &graph.Def{Kind: "var", Name: "V", Data: json.RawMessage("null")}, want: "var V"},
+		"position and docs ignored": {
+			def:  &graph.Def{Kind: "func", Name: "F", File: "f.go", DefStart: 10, DefEnd: 20, Docs: []graph.DefDoc{{Data: "d"}}},
+			want: "func F",
+		},
+	}
+	for label, test := range tests {
+		if got := defSignature(test.def); got != test.want {
+			t.Errorf("%s: got %q, want %q", label, got, test.want)
+		}
+	}
+}
+
+func TestDefHistory(t *testing.T) {
+	s := store.NewFSMultiRepoStore(rwvfs.Walkable(rwvfs.Map(map[string]string{})), nil)
+	def := func(kind string) *graph.Def {
+		return &graph.Def{DefKey: graph.DefKey{Path: "p"}, Name: "p", Kind: kind, File: "f"}
+	}
+	u := unit.ID2{Type: "t", Name: "u"}
+	commits := []struct {
+		commitID string
+		unit     string // the indexed source unit
+		def      *graph.Def
+	}{
+		{"c1", "u", nil},          // before the def was added
+		{"c2", "u", def("func")},  // added
+		{"c3", "u", def("func")},  // unchanged
+		{"c4", "other", nil},      // u wasn't indexed
+		{"c5", "u", def("var")},   // changed
+		{"c6", "u", nil},          // removed
+		{"c7", "u", def("const")}, // added again
+	}
+	var commitIDs []string
+	for _, c := range commits {
+		var o graph.Output
+		if c.def != nil {
+			o.Defs = []*graph.Def{c.def}
+		}
+		if err := s.Import("r", c.commitID, &unit.SourceUnit{Type: "t", Name: c.unit}, o); err != nil {
+			t.Fatal(err)
+		}
+		commitIDs = append(commitIDs, c.commitID)
+	}
+	origOpenStore := OpenStore
+	defer func() { OpenStore = origOpenStore }()
+	OpenStore = func() (interface{}, error) { return s, nil }
+
+	events, err := defHistory(s, "r", u, "p", commitIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type change struct{ CommitID, Change, Signature, OldSignature string }
+	var got []change
+	for _, e := range events {
+		got = append(got, change{e.CommitID, e.Change, e.Signature, e.OldSignature})
+		if (e.Def != nil) != (e.Change != "removed") {
+			t.Errorf("%s: got def %v for %s change", e.CommitID, e.Def, e.Change)
+		}
+	}
+	want := []change{
+		{"c2", "added", "func p", ""},
+		{"c5", "changed", "var p", "func p"},
+		{"c6", "removed", "", "var p"},
+		{"c7", "added", "const p", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got changes\n%+v\nwant\n%+v", got, want)
+	}
+
+	if events, err := defHistory(s, "r", u, "x", commitIDs); err != nil || len(events) != 0 {
+		t.Errorf("nonexistent def: got %v, %v, want no changes", events, err)
+	}
+}
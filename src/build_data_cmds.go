@@ -1,9 +1,11 @@
 package src
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
@@ -17,7 +19,9 @@ import (
 	"sourcegraph.com/sourcegraph/go-sourcegraph/router"
 	"sourcegraph.com/sourcegraph/go-sourcegraph/sourcegraph"
 	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib"
 	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
 	"sourcegraph.com/sourcegraph/srclib/store"
 )
 
@@ -402,6 +406,9 @@ type BuildDataFetchCmd struct {
 var buildDataFetchCmd BuildDataFetchCmd
 
 func (c *BuildDataFetchCmd) Execute(args []string) error {
+	if err := srclib.CheckOnline("fetching build data"); err != nil {
+		return err
+	}
 	localFS, localRepoLabel, err := c.getLocalFileSystem()
 	if err != nil {
 		return err
@@ -500,11 +507,16 @@ type BuildDataUploadCmd struct {
 	buildDataSingleCommitCommonOpts
 
 	DryRun bool `short:"n" long:"dry-run" description:"don't do anything, just show what would be done"`
+
+	Redact string `long:"redact" description:"remove data matching the redaction rules in FILE (JSON) before uploading" value-name:"FILE"`
 }
 
 var buildDataUploadCmd BuildDataUploadCmd
 
 func (c *BuildDataUploadCmd) Execute(args []string) error {
+	if err := srclib.CheckOnline("uploading build data"); err != nil {
+		return err
+	}
 	localFS, localRepoLabel, err := c.getLocalFileSystem()
 	if err != nil {
 		return err
@@ -515,6 +527,11 @@ func (c *BuildDataUploadCmd) Execute(args []string) error {
 		return err
 	}
 
+	redaction, err := openRedaction(c.Redact)
+	if err != nil {
+		return err
+	}
+
 	if GlobalOpt.Verbose {
 		log.Printf("Uploading build files from %s to %s...", localRepoLabel, remoteRepoLabel)
 	}
@@ -536,13 +553,13 @@ func (c *BuildDataUploadCmd) Execute(args []string) error {
 		}
 		path := w.Path()
 		par.Do(func() error {
-			return uploadFile(localFS, remoteFS, path, fi, c.DryRun)
+			return uploadFile(localFS, remoteFS, path, fi, redaction, c.DryRun)
 		})
 	}
 	return par.Wait()
 }
 
-func uploadFile(local vfs.FileSystem, remote rwvfs.FileSystem, path string, fi os.FileInfo, dryRun bool) error {
+func uploadFile(local vfs.FileSystem, remote rwvfs.FileSystem, path string, fi os.FileInfo, redaction *grapher.Redaction, dryRun bool) error {
 	kb := float64(fi.Size()) / 1024
 	if GlobalOpt.Verbose || dryRun {
 		log.Printf("Uploading %s (%.1fkb)", path, kb)
@@ -551,10 +568,23 @@ func uploadFile(local vfs.FileSystem, remote rwvfs.FileSystem, path string, fi o
 		return nil
 	}
 
-	lf, err := local.Open(path)
+	f, err := local.Open(path)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+	var lf io.Reader = f
+	if redaction != nil {
+		data, err := ioutil.ReadAll(lf)
+		if err != nil {
+			return err
+		}
+		data, err = redactBuildData(redaction, path, data)
+		if err != nil {
+			return fmt.Errorf("redacting %s: %s", path, err)
+		}
+		lf = bytes.NewReader(data)
+	}
 
 	if err := rwvfs.MkdirAll(remote, filepath.Dir(path)); err != nil {
 		return err
@@ -0,0 +1,64 @@
+package src
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+)
+
+// readScanInput parses the args and reads the input (the tree's
+// config, which is ignored) of a built-in toolchain's scanner. It
+// returns the directory to scan.
+func readScanInput(args []string, stdin io.Reader) (string, error) {
+	var opt config.Options
+	if _, err := flags.ParseArgs(&opt, args); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(ioutil.Discard, stdin); err != nil {
+		return "", err
+	}
+	if opt.Subdir == "" {
+		return ".", nil
+	}
+	return opt.Subdir, nil
+}
+
+// scanFiles returns the paths (with slashes) of the regular files
+// under dir for which match returns true. Match is called with the
+// file's path relative to dir. Hidden (other than ".github"), "vendor",
+// and "node_modules" directories are skipped.
+func scanFiles(dir string, match func(rel string) bool) ([]string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if name := fi.Name(); path != dir && ((strings.HasPrefix(name, ".") && name != ".github") || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if rel, err := filepath.Rel(dir, path); err == nil && fi.Mode().IsRegular() && match(filepath.ToSlash(rel)) {
+			files = append(files, filepath.ToSlash(path))
+		}
+		return nil
+	})
+	return files, err
+}
+
+// noDepresolve is the dependency resolver of built-in toolchains whose
+// source units have no dependencies.
+func noDepresolve(args []string, stdin io.Reader, stdout io.Writer) error {
+	if _, err := io.Copy(ioutil.Discard, stdin); err != nil {
+		return err
+	}
+	_, err := io.WriteString(stdout, "[]\n")
+	return err
+}
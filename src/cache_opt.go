@@ -3,4 +3,10 @@ package src
 type BuildCacheOpt struct {
 	NoCacheRead  bool `long:"no-cache-read" description:"do not read from build cache"`
 	NoCacheWrite bool `long:"no-cache-write" description:"do not write results to build cache"`
+
+	VerifyDeterminism bool `long:"verify-determinism" description:"graph each source unit twice and fail if the normalized outputs differ (outputs of previous commits are not reused)"`
+
+	Strict bool `long:"strict" description:"fail (instead of recording a warning in the graph output) when a file that a grapher's output refers to is missing, unreadable, or doesn't match the output's offsets"`
+
+	ReuseCommit string `long:"reuse-commit" description:"reuse the build data at commit ID for source units that are unchanged since it (default: the latest of the last few commits with build data)" value-name:"ID"`
 }
@@ -0,0 +1,231 @@
+package src
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	_, err := CLI.AddCommand("check-arch",
+		"check refs against the Srcfile's architecture rules",
+		`The check-arch command checks that the dependencies between source units in the repository obey the ArchRules in the Srcfile, and exits with an error (listing the offending refs) if they don't. It is intended to be run in CI, after the repository is built.
+
+Each rule restricts the source units that the source units matching a pattern may refer to. For example, this Srcfile forbids refs from source units in the web dir tree to source units in the internal/db dir tree:
+
+    {
+      "ArchRules": [
+        {"Units": "web/**", "Deny": ["internal/db/**"], "Message": "web must go through the service layer"}
+      ]
+    }
+
+Patterns match the source units' dirs (relative to the repository root), and "**" matches zero or more path components. A rule may instead (or also) list the only source units that may be referred to in Allow. Refs to defs in the same source unit or in other repositories are not checked.
+
+With --format table (the default), violations are printed as FILE:LINE:COL: MESSAGE lines; with --format json, as a JSON array; with --format github, as GitHub Actions error annotations; and with --format quiet, not at all. The command exits with an error if there are any violations.`,
+		&checkArchCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type CheckArchCmd struct {
+	Format string `long:"format" description:"output format" default:"table" value-name:"json|table|github|quiet"`
+
+	Args struct {
+		Dir Directory `name:"DIR" default:"." description:"root directory of target project"`
+	} `positional-args:"yes"`
+}
+
+var checkArchCmd CheckArchCmd
+
+// An archViolation is a ref that violates an ArchRule.
+type archViolation struct {
+	File       string
+	Line, Col  int
+	Start, End uint32
+
+	Unit    unit.ID2 // the source unit containing the ref
+	DefUnit unit.ID2 // the source unit containing the referenced def
+	DefPath string
+
+	Rule *config.ArchRule
+}
+
+func (v *archViolation) message() string {
+	msg := fmt.Sprintf("%s must not refer to %s (ref to %s)", v.Unit.Name, v.DefUnit.Name, v.DefPath)
+	if v.Rule.Message != "" {
+		msg += ": " + v.Rule.Message
+	}
+	return msg
+}
+
+func (c *CheckArchCmd) Execute(args []string) error {
+	format, err := checkCIFormat(c.Format)
+	if err != nil {
+		return err
+	}
+
+	context, err := prepareCommandContext(c.Args.Dir.String())
+	if err != nil {
+		return err
+	}
+	cfg, err := config.ReadRepository(context.repo.RootDir, context.repo.URI())
+	if err != nil {
+		return fmt.Errorf("failed to read repository at %s: %s", context.repo.RootDir, err)
+	}
+	if len(cfg.ArchRules) == 0 {
+		log.Printf("No ArchRules in %s; nothing to check.", config.Filename)
+		return nil
+	}
+
+	unitFiles := getSourceUnits(context.commitFS, context.repo)
+	if len(unitFiles) == 0 {
+		return errors.New("No source units found. Try running `src config` first.")
+	}
+	units := make(map[unit.ID2]*unit.SourceUnit, len(unitFiles))
+	for _, unitFile := range unitFiles {
+		var u *unit.SourceUnit
+		if err := readJSONFileFS(context.commitFS, unitFile, &u); err != nil {
+			return err
+		}
+		units[u.ID2()] = u
+	}
+
+	var violations []*archViolation
+	for _, u := range units {
+		if !archRulesApply(cfg.ArchRules, u) {
+			continue
+		}
+		var g graph.Output
+		if err := readJSONFileFS(context.commitFS, plan.SourceUnitDataFilename("graph", u), &g); err != nil {
+			if os.IsNotExist(err) {
+				continue // unit wasn't graphed
+			}
+			return err
+		}
+		violations = append(violations, findArchViolations(cfg.ArchRules, context.repo.URI(), units, u, g.Refs)...)
+	}
+	sort.Sort(archViolations(violations))
+	if err := setArchViolationPositions(context.repo.RootDir, violations); err != nil {
+		return err
+	}
+
+	switch format {
+	case formatJSON:
+		if violations == nil {
+			violations = []*archViolation{}
+		}
+		PrintJSON(violations, "")
+	case formatTable:
+		for _, v := range violations {
+			fmt.Printf("%s:%d:%d: %s\n", v.File, v.Line, v.Col, v.message())
+		}
+	case formatGitHub:
+		for _, v := range violations {
+			fmt.Printf("::error file=%s,line=%d,col=%d::%s\n", v.File, v.Line, v.Col, v.message())
+		}
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("%d refs violate the architecture rules in %s", len(violations), config.Filename)
+	}
+	return nil
+}
+
+// archRulesApply returns whether any of the rules restrict the
+// dependencies of u.
+func archRulesApply(rules []*config.ArchRule, u *unit.SourceUnit) bool {
+	for _, r := range rules {
+		if r.Applies(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// findArchViolations returns the refs (of u's refs) that violate the
+// rules, given all of the repository's source units.
+func findArchViolations(rules []*config.ArchRule, repoURI string, units map[unit.ID2]*unit.SourceUnit, u *unit.SourceUnit, refs []*graph.Ref) []*archViolation {
+	var applicable []*config.ArchRule
+	for _, r := range rules {
+		if r.Applies(u) {
+			applicable = append(applicable, r)
+		}
+	}
+	if len(applicable) == 0 {
+		return nil
+	}
+
+	var violations []*archViolation
+	for _, ref := range refs {
+		if ref.Def || (ref.DefRepo != "" && !graph.URIEqual(ref.DefRepo, repoURI)) {
+			continue
+		}
+		defUnit, present := units[unit.ID2{Type: ref.DefUnitType, Name: ref.DefUnit}]
+		if !present || defUnit == u {
+			continue
+		}
+		for _, r := range applicable {
+			if !r.Allows(defUnit) {
+				violations = append(violations, &archViolation{
+					File:    ref.File,
+					Start:   ref.Start,
+					End:     ref.End,
+					Unit:    u.ID2(),
+					DefUnit: defUnit.ID2(),
+					DefPath: ref.DefPath,
+					Rule:    r,
+				})
+				break
+			}
+		}
+	}
+	return violations
+}
+
+// setArchViolationPositions sets the 1-based line and column of each
+// violation from its byte offset. Files that no longer exist (e.g.,
+// because the build data is stale) are skipped.
+func setArchViolationPositions(rootDir string, violations []*archViolation) error {
+	files := map[string][]byte{}
+	for _, v := range violations {
+		data, present := files[v.File]
+		if !present {
+			var err error
+			data, err = ioutil.ReadFile(filepath.Join(rootDir, v.File))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			files[v.File] = data
+		}
+		if int(v.Start) > len(data) {
+			continue
+		}
+		before := data[:v.Start]
+		v.Line = bytes.Count(before, []byte{'\n'}) + 1
+		v.Col = len(before) - bytes.LastIndexByte(before, '\n')
+	}
+	return nil
+}
+
+type archViolations []*archViolation
+
+func (v archViolations) Len() int      { return len(v) }
+func (v archViolations) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v archViolations) Less(i, j int) bool {
+	if v[i].File != v[j].File {
+		return v[i].File < v[j].File
+	}
+	return v[i].Start < v[j].Start
+}
@@ -0,0 +1,333 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	_, err := CLI.AddCommand("check",
+		"build the changed source units and enforce quality gates (for CI)",
+		`The check command is intended to be run in CI (or in a pre-commit hook) on a change from commit BASE to the working tree. It scans the repository and graphs only the source units that changed since BASE (reusing BASE's build data for the others, which must exist in the local build data, e.g., restored from a CI cache), and then enforces these quality gates on the changed source units:
+
+  dangling-refs  the changed source units have no new refs to nonexistent defs in the repository
+  coverage       the ref coverage of the changed source units (see "src coverage -h") didn't decrease
+  arch           no refs in the changed source units violate the Srcfile's ArchRules (see "src check-arch -h")
+
+Gates are configured in the Gates section of the Srcfile, which can disable gates and set a tolerance for decreases in coverage:
+
+    {
+      "Gates": {"NoArch": true, "MaxCoverageDecrease": 0.01}
+    }
+
+The report is printed as JSON (or, with --format table, for people; with --format github, as GitHub Actions annotations; and with --format quiet, not at all), and the command exits with an error if any gate failed.`,
+		&checkCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type CheckCmd struct {
+	config.Options
+
+	ToolchainExecOpt `group:"execution"`
+
+	Format string `long:"format" description:"output format" default:"json" value-name:"json|table|github|quiet"`
+
+	Args struct {
+		Base string `name:"BASE" description:"base commit (or other revision) of the change"`
+	} `positional-args:"yes"`
+}
+
+var checkCmd CheckCmd
+
+// A checkReport is the result of `src check`.
+type checkReport struct {
+	Repo         string `json:",omitempty"`
+	BaseCommitID string
+	CommitID     string
+
+	ChangedUnits []unit.ID2
+
+	Passed bool
+	Gates  []*checkGate
+}
+
+// A checkGate is the result of a quality gate.
+type checkGate struct {
+	Name    string
+	Passed  bool
+	Skipped bool `json:",omitempty"` // disabled in the Srcfile
+	Message string
+
+	DanglingRefs   []*danglingRefGroup `json:",omitempty"`
+	Coverage       *checkCoverage      `json:",omitempty"`
+	ArchViolations []*archViolation    `json:",omitempty"`
+}
+
+// checkCoverage is the ref coverage of the changed source units
+// before and after the change.
+type checkCoverage struct {
+	Base, Score float64
+}
+
+// checkGraphs is the build data of the repository at a commit.
+type checkGraphs struct {
+	units  map[unit.ID2]*unit.SourceUnit
+	graphs map[unit.ID2]*graph.Output
+	defs   []*graph.Def // the defs of all units
+}
+
+func (c *CheckCmd) Execute(args []string) error {
+	format, err := checkCIFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	if c.Args.Base == "" {
+		return errors.New("check: a BASE commit is required")
+	}
+
+	lrepo, err := openLocalRepo()
+	if err != nil {
+		return err
+	}
+	if lrepo.VCSType != "git" {
+		return fmt.Errorf("check: unsupported vcs type: %q", lrepo.VCSType)
+	}
+	if err := os.Chdir(lrepo.RootDir); err != nil {
+		return err
+	}
+	repoURI := c.Options.Repo
+	if repoURI == "" {
+		repoURI = lrepo.URI()
+		c.Options.Repo = repoURI
+	}
+	base, err := resolveGitRevision(lrepo.RootDir, c.Args.Base)
+	if err != nil {
+		return err
+	}
+	buildStore, err := buildstore.LocalRepo(lrepo.RootDir)
+	if err != nil {
+		return err
+	}
+	if exists, err := buildstore.BuildDataExistsForCommit(buildStore, base); err != nil {
+		return err
+	} else if !exists {
+		return fmt.Errorf("no build data for base commit %s (run `src make` at that commit, or restore its build data)", base)
+	}
+	cfg, err := config.ReadRepository(lrepo.RootDir, repoURI)
+	if err != nil {
+		return fmt.Errorf("failed to read repository at %s: %s", lrepo.RootDir, err)
+	}
+	gates := cfg.Gates
+	if gates == nil {
+		gates = &config.Gates{}
+	}
+
+	// Scan, and graph only the changed source units.
+	if c.Options.Subdir == "" {
+		c.Options.Subdir = "."
+	}
+	configCmd := &ConfigCmd{Options: c.Options, ToolchainExecOpt: c.ToolchainExecOpt, Quiet: true}
+	if err := configCmd.Execute(nil); err != nil {
+		return err
+	}
+	makeCmd := &MakeCmd{
+		Options:          c.Options,
+		ToolchainExecOpt: c.ToolchainExecOpt,
+		BuildCacheOpt:    BuildCacheOpt{ReuseCommit: base},
+		Quiet:            true,
+	}
+	if err := makeCmd.Execute(nil); err != nil {
+		return err
+	}
+
+	head, err := readCheckGraphs(buildStore.Commit(lrepo.CommitID), repoURI)
+	if err != nil {
+		return err
+	}
+	old, err := readCheckGraphs(buildStore.Commit(base), repoURI)
+	if err != nil {
+		return err
+	}
+	changedFiles, err := plan.FilesChangedFromRevToIndex(lrepo.VCSType, base)
+	if err != nil {
+		return err
+	}
+	var changed []*unit.SourceUnit
+	for _, u := range head.units {
+		if !plan.UnitUnchangedSince(buildStore, base, u, changedFiles) {
+			changed = append(changed, u)
+		}
+	}
+	sort.Sort(unit.SourceUnits(changed))
+
+	report := &checkReport{Repo: repoURI, BaseCommitID: base, CommitID: lrepo.CommitID, Passed: true}
+	for _, u := range changed {
+		report.ChangedUnits = append(report.ChangedUnits, u.ID2())
+	}
+
+	// refsIn returns the refs in the changed source units in g.
+	refsIn := func(g *checkGraphs) []*graph.Ref {
+		var refs []*graph.Ref
+		for _, u := range changed {
+			if o := g.graphs[u.ID2()]; o != nil {
+				refs = append(refs, o.Refs...)
+			}
+		}
+		return refs
+	}
+	headRefs, oldRefs := refsIn(head), refsIn(old)
+
+	danglingGate := &checkGate{Name: "dangling-refs", Skipped: gates.NoDanglingRefs}
+	if !danglingGate.Skipped {
+		wasDangling := grapher.UnresolvedInternalRefs(repoURI, oldRefs, old.defs)
+		var newDangling []*graph.Ref
+		for k, refs := range grapher.UnresolvedInternalRefs(repoURI, headRefs, head.defs) {
+			if _, was := wasDangling[k]; !was {
+				newDangling = append(newDangling, refs...)
+			}
+		}
+		danglingGate.DanglingRefs = groupRefsByDef(newDangling)
+		danglingGate.Passed = len(newDangling) == 0
+		danglingGate.Message = fmt.Sprintf("%d new dangling refs to %d nonexistent defs", len(newDangling), len(danglingGate.DanglingRefs))
+	}
+
+	coverageGate := &checkGate{Name: "coverage", Skipped: gates.NoCoverage}
+	if !coverageGate.Skipped {
+		cov := &checkCoverage{
+			Base:  refCoverageScore(repoURI, oldRefs, old.defs),
+			Score: refCoverageScore(repoURI, headRefs, head.defs),
+		}
+		coverageGate.Coverage = cov
+		coverageGate.Passed = cov.Base-cov.Score <= gates.MaxCoverageDecrease
+		coverageGate.Message = fmt.Sprintf("ref coverage of the changed source units went from %.1f%% to %.1f%%", cov.Base*100, cov.Score*100)
+	}
+
+	archGate := &checkGate{Name: "arch", Skipped: gates.NoArch}
+	if !archGate.Skipped {
+		var violations []*archViolation
+		for _, u := range changed {
+			if o := head.graphs[u.ID2()]; o != nil {
+				violations = append(violations, findArchViolations(cfg.ArchRules, repoURI, head.units, u, o.Refs)...)
+			}
+		}
+		sort.Sort(archViolations(violations))
+		if err := setArchViolationPositions(lrepo.RootDir, violations); err != nil {
+			return err
+		}
+		archGate.ArchViolations = violations
+		archGate.Passed = len(violations) == 0
+		archGate.Message = fmt.Sprintf("%d refs violate the architecture rules in %s", len(violations), config.Filename)
+	}
+
+	var failed []string
+	for _, g := range []*checkGate{danglingGate, coverageGate, archGate} {
+		if g.Skipped {
+			g.Passed = true
+			g.Message = "skipped (disabled in " + config.Filename + ")"
+		}
+		if !g.Passed {
+			report.Passed = false
+			failed = append(failed, g.Name)
+		}
+		report.Gates = append(report.Gates, g)
+	}
+
+	switch format {
+	case formatJSON:
+		PrintJSON(report, "")
+	case formatTable:
+		fmt.Printf("%d source units changed since %s.\n", len(changed), base)
+		for _, g := range report.Gates {
+			status := "PASS"
+			if !g.Passed {
+				status = "FAIL"
+			}
+			fmt.Printf("%s\t%s: %s\n", status, g.Name, g.Message)
+			for _, dg := range g.DanglingRefs {
+				for _, ref := range dg.Refs {
+					fmt.Printf("\t%s bytes %d-%d: ref to nonexistent def %s %s %s\n", ref.File, ref.Start, ref.End, dg.Def.UnitType, dg.Def.Unit, dg.Def.Path)
+				}
+			}
+			for _, v := range g.ArchViolations {
+				fmt.Printf("\t%s:%d:%d: %s\n", v.File, v.Line, v.Col, v.message())
+			}
+		}
+	case formatGitHub:
+		for _, g := range report.Gates {
+			if g.Passed {
+				continue
+			}
+			fmt.Printf("::error title=%s::%s\n", g.Name, g.Message)
+			for _, dg := range g.DanglingRefs {
+				for _, ref := range dg.Refs {
+					fmt.Printf("::error file=%s::ref to nonexistent def %s %s %s\n", ref.File, dg.Def.UnitType, dg.Def.Unit, dg.Def.Path)
+				}
+			}
+			for _, v := range g.ArchViolations {
+				fmt.Printf("::error file=%s,line=%d,col=%d::%s\n", v.File, v.Line, v.Col, v.message())
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("quality gates failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// readCheckGraphs reads the source units and graph outputs in the
+// build data of a commit.
+func readCheckGraphs(commitFS rwvfs.FileSystem, repoURI string) (*checkGraphs, error) {
+	treeConfig, err := config.ReadCached(commitFS)
+	if err != nil {
+		return nil, err
+	}
+	g := &checkGraphs{
+		units:  make(map[unit.ID2]*unit.SourceUnit, len(treeConfig.SourceUnits)),
+		graphs: make(map[unit.ID2]*graph.Output, len(treeConfig.SourceUnits)),
+	}
+	for _, u := range treeConfig.SourceUnits {
+		g.units[u.ID2()] = u
+		var o graph.Output
+		graphFile := plan.SourceUnitDataFilename(&graph.Output{}, u)
+		if err := readJSONFileFS(commitFS, graphFile, &o); err != nil {
+			if os.IsNotExist(err) {
+				continue // unit wasn't graphed
+			}
+			return nil, fmt.Errorf("%s: %s", graphFile, err)
+		}
+		grapher.PopulateImpliedFields(repoURI, "", u.Type, u.Name, &o)
+		g.graphs[u.ID2()] = &o
+		g.defs = append(g.defs, o.Defs...)
+	}
+	return g, nil
+}
+
+// refCoverageScore returns the fraction of refs to defs in the
+// repository that resolve (or 1 if there are none).
+func refCoverageScore(repoURI string, refs []*graph.Ref, defs []*graph.Def) float64 {
+	var resolved, checked int
+	for _, cov := range grapher.ComputeFileCoverage(repoURI, refs, defs) {
+		resolved += cov.ResolvedRefs
+		checked += cov.Refs - cov.UncheckedRefs
+	}
+	if checked == 0 {
+		return 1
+	}
+	return float64(resolved) / float64(checked)
+}
@@ -0,0 +1,134 @@
+package src
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"sourcegraph.com/sourcegraph/srclib/ci"
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// CIToolchain is the path of the built-in toolchain that graphs CI
+// configuration files: GitHub Actions workflows and actions, and
+// GitLab CI configs (see package ci). Jobs and steps are defs, and
+// dependencies between jobs, uses of actions and reusable workflows,
+// and the scripts in the repository that jobs run are refs.
+const CIToolchain = "sourcegraph.com/sourcegraph/srclib/ci"
+
+func init() {
+	unitTypes := []string{ci.GitHubWorkflowUnitType, ci.GitHubActionUnitType, ci.GitLabCIUnitType}
+	for _, t := range unitTypes {
+		grapher.RegisterByteOffsetUnitType(t)
+	}
+	toolchain.RegisterBuiltin(CIToolchain, &toolchain.Builtin{
+		Config: &toolchain.Config{
+			Tools: []*toolchain.ToolInfo{
+				{Subcmd: "scan", Op: "scan"},
+				{Subcmd: "depresolve", Op: "depresolve", SourceUnitTypes: unitTypes},
+				{Subcmd: "graph", Op: "graph", SourceUnitTypes: unitTypes},
+			},
+		},
+		Tools: map[string]toolchain.BuiltinTool{
+			"scan":       ciScan,
+			"depresolve": ciDepresolve,
+			"graph":      ciGraph,
+		},
+	})
+}
+
+// ciScan is the CI toolchain's scanner. Each CI configuration file is
+// a source unit, named by its path. The dependencies of GitHub Actions
+// workflows and actions are the remote actions and reusable workflows
+// they use.
+func ciScan(args []string, stdin io.Reader, stdout io.Writer) error {
+	dir, err := readScanInput(args, stdin)
+	if err != nil {
+		return err
+	}
+	files, err := scanFiles(dir, func(file string) bool { return ci.UnitType(file) != "" })
+	if err != nil {
+		return err
+	}
+
+	units := []*unit.SourceUnit{}
+	for _, file := range files {
+		u := &unit.SourceUnit{
+			Name:  file,
+			Type:  ci.UnitType(file),
+			Dir:   path.Dir(file),
+			Files: []string{file},
+		}
+		if u.Type != ci.GitLabCIUnitType {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			deps, err := ci.Dependencies(file, data)
+			if err != nil {
+				return err
+			}
+			for _, d := range deps {
+				u.Dependencies = append(u.Dependencies, d)
+			}
+		}
+		units = append(units, u)
+	}
+	return json.NewEncoder(stdout).Encode(units)
+}
+
+// ciDepresolve is the CI toolchain's dependency resolver. It resolves
+// each remote action or reusable workflow to its GitHub repository.
+func ciDepresolve(args []string, stdin io.Reader, stdout io.Writer) error {
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(stdin).Decode(&u); err != nil {
+		return err
+	}
+	res := []*dep.Resolution{}
+	for _, rawDep := range u.Dependencies {
+		r := &dep.Resolution{Raw: rawDep}
+		s, _ := rawDep.(string)
+		if uses, err := ci.ParseUses(s); err != nil {
+			r.Error = err.Error()
+		} else {
+			unitType, name := uses.Unit()
+			r.Target = &dep.ResolvedTarget{
+				ToRepoCloneURL:  "https://" + uses.RepoURI(),
+				ToUnit:          name,
+				ToUnitType:      unitType,
+				ToVersionString: uses.Ref,
+			}
+		}
+		res = append(res, r)
+	}
+	return json.NewEncoder(stdout).Encode(res)
+}
+
+// ciGraph is the CI toolchain's grapher.
+func ciGraph(args []string, stdin io.Reader, stdout io.Writer) error {
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(stdin).Decode(&u); err != nil {
+		return err
+	}
+
+	var o graph.Output
+	for _, file := range u.Files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fo, err := ci.Graph(file, data, os.Stat)
+		if err != nil {
+			return err
+		}
+		o.Defs = append(o.Defs, fo.Defs...)
+		o.Refs = append(o.Refs, fo.Refs...)
+	}
+	return json.NewEncoder(stdout).Encode(o)
+}
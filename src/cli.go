@@ -13,17 +13,32 @@ import (
 	"sourcegraph.com/sourcegraph/go-flags"
 	"sourcegraph.com/sourcegraph/go-sourcegraph/auth"
 	"sourcegraph.com/sourcegraph/go-sourcegraph/sourcegraph"
+	"sourcegraph.com/sourcegraph/srclib"
 )
 
-var CLI = flags.NewNamedParser("src", flags.Default)
+// CLI is the parser of src's commands. Main prints the errors that it
+// returns (see printError).
+var CLI = flags.NewNamedParser("src", flags.Default&^flags.PrintErrors)
 
 // GlobalOpt contains global options.
 var GlobalOpt struct {
 	Verbose bool `short:"v" description:"show verbose output"`
+
+	LogFormat string `long:"log-format" description:"format of structured log records (about source units and files) written to stderr" default:"text" value-name:"text|json"`
+	LogLevel  string `long:"log-level" description:"minimum level of structured log records to write (-v implies debug)" default:"info" value-name:"debug|info|warn|error"`
+
+	// PrintCommandsJSON is handled by Main before the args are parsed
+	// (since no command is given with it). It is declared here so that
+	// it is listed in the help.
+	PrintCommandsJSON bool `long:"print-commands-json" description:"print a JSON description of all commands and their options, and exit"`
+
+	// Offline is also handled by Main before the args are parsed, so
+	// that offline mode is enabled before any command runs.
+	Offline bool `long:"offline" description:"forbid all network access (use only local caches and installed toolchains; also enabled by SRCLIB_OFFLINE=1)"`
 }
 
 func init() {
-	CLI.LongDescription = "src builds projects, analyzes source code, and queries Sourcegraph."
+	CLI.LongDescription = "src builds projects, analyzes source code, and queries Sourcegraph.\n\nExit status: 0 on success, 1 on errors, 2 on bad command-line arguments, and 3 if a query succeeded but found nothing (e.g., \"src store defs\" matched no defs, or a def or file doesn't exist). The query commands' --format json output uses the same field names as the Go types (and the gRPC API), which are stable."
 	CLI.AddGroup("Global options", "", &GlobalOpt)
 }
 
@@ -120,6 +135,40 @@ func Main() error {
 	log.SetFlags(0)
 	log.SetPrefix("")
 
+	shutdownTracing := initTracing()
+	defer shutdownTracing()
+
+	initURIRules()
+
+	for _, arg := range os.Args[1:] {
+		if arg == "--" {
+			break
+		}
+		if arg == printCommandsJSONFlag {
+			return printCommandsJSON(os.Stdout)
+		}
+		if arg == offlineFlag {
+			enableOffline()
+		}
+	}
+	if srclib.Offline {
+		http.DefaultTransport = &srclib.OfflineTransport{Transport: http.DefaultTransport}
+	}
+
 	_, err := CLI.Parse()
+	printError(err)
 	return err
 }
+
+// offlineFlag is the global flag that enables offline mode (see
+// srclib.Offline).
+const offlineFlag = "--offline"
+
+// enableOffline enables offline mode in this process and in the
+// processes that it runs.
+func enableOffline() {
+	srclib.Offline = true
+	if err := os.Setenv(srclib.OfflineEnv, "1"); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,273 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+)
+
+// cloneCache is a managed cache of bare clones of remote repos, from
+// which build jobs (such as those of push webhooks; see
+// webhookHandler) check out the commits that they build. It fetches
+// only the requested commits (shallowly), removes clones that haven't
+// been used recently, and keeps its total size under a quota by
+// removing the least recently used clones.
+type cloneCache struct {
+	dir     string
+	maxSize uint64        // max total size in bytes (0 for no limit)
+	maxAge  time.Duration // max time since a clone was used (0 for no limit)
+
+	mu     sync.Mutex
+	clones map[string]*cachedClone // repo URI -> clone (while in use)
+}
+
+// A cachedClone is a clone in a cloneCache that is in use.
+type cachedClone struct {
+	mu    sync.Mutex // held while the clone is fetched, checked out, or removed
+	users int        // number of users (guarded by cloneCache.mu)
+}
+
+// cloneCachePruneInterval is how often a cloneCache removes old
+// clones (and enforces its quota, which is also enforced after each
+// checkout).
+const cloneCachePruneInterval = time.Hour
+
+func newCloneCache(dir string, maxSize uint64, maxAge time.Duration) *cloneCache {
+	return &cloneCache{dir: dir, maxSize: maxSize, maxAge: maxAge, clones: map[string]*cachedClone{}}
+}
+
+// clonePath returns the dir of the bare clone of repo.
+func (c *cloneCache) clonePath(repo string) string {
+	return filepath.Join(c.dir, filepath.FromSlash(repo)+".git")
+}
+
+func (c *cloneCache) acquire(repo string) *cachedClone {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cc := c.clones[repo]
+	if cc == nil {
+		cc = &cachedClone{}
+		c.clones[repo] = cc
+	}
+	cc.users++
+	return cc
+}
+
+// acquireIdle is like acquire, but returns nil if the clone is in use.
+func (c *cloneCache) acquireIdle(repo string) *cachedClone {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clones[repo] != nil {
+		return nil
+	}
+	cc := &cachedClone{users: 1}
+	c.clones[repo] = cc
+	return cc
+}
+
+func (c *cloneCache) release(repo string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cc := c.clones[repo]; cc != nil {
+		if cc.users--; cc.users <= 0 {
+			delete(c.clones, repo)
+		}
+	}
+}
+
+// checkout checks out the commit of repo (cloned from cloneURL) into a
+// new dir, which it returns with a func that removes the dir (and must
+// be called when the caller is done with it). If the commit isn't in
+// the repo's clone, it is fetched (with the given ref, if the server
+// doesn't allow fetching commits by ID).
+func (c *cloneCache) checkout(ctx context.Context, repo, cloneURL, commitID, ref string) (dir string, done func(), err error) {
+	cc := c.acquire(repo)
+	defer func() {
+		if err != nil {
+			c.release(repo)
+		}
+	}()
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	bare := c.clonePath(repo)
+	if err := c.fetch(ctx, bare, cloneURL, commitID, ref); err != nil {
+		return "", nil, err
+	}
+	tmpDir, err := ioutil.TempDir("", "srclib-build-")
+	if err != nil {
+		return "", nil, err
+	}
+	dir = filepath.Join(tmpDir, "src")
+	if err := runJobCmd(ctx, bare, "git", "worktree", "add", "--quiet", "--detach", "--force", dir, commitID); err != nil {
+		os.RemoveAll(tmpDir)
+		return "", nil, err
+	}
+	now := time.Now()
+	os.Chtimes(bare, now, now) // record when the clone was last used
+
+	done = func() {
+		cc.mu.Lock()
+		os.RemoveAll(tmpDir)
+		if err := runJobCmd(context.Background(), bare, "git", "worktree", "prune"); err != nil {
+			logutil.Default.Warn("Failed to prune worktrees of clone.", "repo", repo, "err", err)
+		}
+		cc.mu.Unlock()
+		c.release(repo)
+		if c.maxSize > 0 {
+			if err := c.prune(); err != nil {
+				log.Printf("Error pruning clone cache %s: %s.", c.dir, err)
+			}
+		}
+	}
+	return dir, done, nil
+}
+
+// fetch creates the bare clone (if it doesn't exist) and fetches the
+// commit into it (if it isn't there).
+func (c *cloneCache) fetch(ctx context.Context, bare, cloneURL, commitID, ref string) error {
+	if _, err := os.Stat(bare); os.IsNotExist(err) {
+		if err := os.MkdirAll(bare, 0755); err != nil {
+			return err
+		}
+		if err := runJobCmd(ctx, bare, "git", "init", "--quiet", "--bare"); err != nil {
+			os.RemoveAll(bare)
+			return err
+		}
+		if err := runJobCmd(ctx, bare, "git", "remote", "add", "origin", cloneURL); err != nil {
+			os.RemoveAll(bare)
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if err := runJobCmd(ctx, bare, "git", "remote", "set-url", "origin", cloneURL); err != nil {
+		return err
+	}
+
+	hasCommit := func() bool {
+		return runJobCmd(ctx, bare, "git", "cat-file", "-e", commitID+"^{commit}") == nil
+	}
+	if hasCommit() {
+		return nil
+	}
+	if err := srclib.CheckOnline("fetching commit " + commitID + " of " + cloneURL); err != nil {
+		return err
+	}
+	err := runJobCmd(ctx, bare, "git", "fetch", "--quiet", "--depth", "1", "origin", commitID)
+	if err != nil && ref != "" {
+		err = runJobCmd(ctx, bare, "git", "fetch", "--quiet", "--depth", "1", "origin", ref)
+	}
+	if err != nil {
+		return err
+	}
+	if !hasCommit() {
+		return fmt.Errorf("commit %s not found in %s (after fetching %s)", commitID, cloneURL, ref)
+	}
+	return nil
+}
+
+// A cloneInfo describes a clone in the cache (see listClones).
+type cloneInfo struct {
+	repo     string
+	lastUsed time.Time
+	size     uint64
+}
+
+// listClones returns the clones in the cache, least recently used
+// first.
+func (c *cloneCache) listClones() ([]*cloneInfo, error) {
+	var clones []*cloneInfo
+	err := filepath.Walk(c.dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == c.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !fi.IsDir() || !strings.HasSuffix(path, ".git") {
+			return nil
+		}
+		rel, err := filepath.Rel(c.dir, path)
+		if err != nil {
+			return err
+		}
+		ci := &cloneInfo{repo: filepath.ToSlash(strings.TrimSuffix(rel, ".git")), lastUsed: fi.ModTime()}
+		if err := filepath.Walk(path, func(_ string, fi os.FileInfo, err error) error {
+			if err == nil && !fi.IsDir() {
+				ci.size += uint64(fi.Size())
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		clones = append(clones, ci)
+		return filepath.SkipDir
+	})
+	sort.Slice(clones, func(i, j int) bool { return clones[i].lastUsed.Before(clones[j].lastUsed) })
+	return clones, err
+}
+
+// prune removes the clones that aren't in use and haven't been used
+// for maxAge, and then, while the cache is larger than maxSize, the
+// least recently used clones that aren't in use.
+func (c *cloneCache) prune() error {
+	clones, err := c.listClones()
+	if err != nil {
+		return err
+	}
+	var total uint64
+	for _, ci := range clones {
+		total += ci.size
+	}
+	for _, ci := range clones {
+		old := c.maxAge > 0 && time.Since(ci.lastUsed) > c.maxAge
+		if !old && (c.maxSize == 0 || total <= c.maxSize) {
+			continue
+		}
+		cc := c.acquireIdle(ci.repo)
+		if cc == nil {
+			continue
+		}
+		cc.mu.Lock()
+		err := os.RemoveAll(c.clonePath(ci.repo))
+		cc.mu.Unlock()
+		c.release(ci.repo)
+		if err != nil {
+			return err
+		}
+		total -= ci.size
+		if GlobalOpt.Verbose {
+			log.Printf("Removed clone of %s (%d bytes, last used %s) from clone cache.", ci.repo, ci.size, ci.lastUsed.Format(time.RFC3339))
+		}
+	}
+	if c.maxSize > 0 && total > c.maxSize {
+		logutil.Default.Warn("Clone cache is larger than its quota because its clones are in use.", "dir", c.dir, "bytes", total, "quota", c.maxSize)
+	}
+	return nil
+}
+
+// run prunes the cache periodically until ctx is done.
+func (c *cloneCache) run(ctx context.Context) error {
+	t := time.NewTicker(cloneCachePruneInterval)
+	defer t.Stop()
+	for {
+		if err := c.prune(); err != nil {
+			log.Printf("Error pruning clone cache %s: %s.", c.dir, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
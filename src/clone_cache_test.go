@@ -0,0 +1,35 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+)
+
+func TestCloneCache_fetchOffline(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git command")
+	}
+	dir, err := ioutil.TempDir("", "srclib-clone-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	origOffline := srclib.Offline
+	defer func() { srclib.Offline = origOffline }()
+	srclib.Offline = true
+
+	c := &cloneCache{dir: dir}
+	err = c.fetch(context.Background(), filepath.Join(dir, "r.git"), "https://example.com/r", "0123456789012345678901234567890123456789", "master")
+	var offlineErr *srclib.OfflineError
+	if !errors.As(err, &offlineErr) {
+		t.Errorf("got error %v, want *srclib.OfflineError", err)
+	}
+}
@@ -1,7 +1,11 @@
 package src
 
 import (
+	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"sourcegraph.com/sourcegraph/go-flags"
 )
@@ -15,3 +19,27 @@ func SetOptionDefaultValue(g *flags.Group, longName string, defaultVal ...string
 	}
 	log.Fatalf("Failed to set default value %v for option %q (not found).", defaultVal, longName)
 }
+
+// interruptContext returns a context that is cancelled when the
+// process receives an interrupt or termination signal (e.g., Ctrl-C),
+// so that long operations stop and the tools they run are killed
+// instead of being orphaned. The cancel func must be called to release
+// the signal handler.
+//
+// The context also carries the trace context passed by a parent src
+// process, if any (see withParentTrace).
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(withParentTrace(context.Background()))
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigc:
+			log.Printf("Received %s; cancelling.", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sigc)
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,113 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"sourcegraph.com/sourcegraph/srclib/flagutil"
+)
+
+func init() {
+	_, err := CLI.AddCommand("completion",
+		"print a shell completion script",
+		`The completion command prints a script that completes src's commands, options, and arguments in the shell (bash, zsh, or fish). The script asks src itself for the completions, so it never needs to be regenerated when src is updated. To enable completion:
+
+  bash  add 'source <(src completion bash)' to ~/.bashrc
+  zsh   add 'source <(src completion zsh)' to ~/.zshrc
+  fish  run 'src completion fish > ~/.config/fish/completions/src.fish'
+
+Programs that need to discover src's commands and options (such as wrappers and editor plugins) should instead run 'src --print-commands-json', which prints a JSON description of all commands and their options.`,
+		&completionCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type CompletionCmd struct {
+	Args struct {
+		Shell string `name:"SHELL" description:"shell (bash, zsh, or fish)"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var completionCmd CompletionCmd
+
+// completionScripts are the shell completion scripts. They run src
+// with GO_FLAGS_COMPLETION set, which makes it print the completions
+// of the given args (one per line) instead of running a command.
+var completionScripts = map[string]string{
+	"bash": `_src() {
+	args=("${COMP_WORDS[@]:1:$COMP_CWORD}")
+
+	local IFS=$'\n'
+	COMPREPLY=($(GO_FLAGS_COMPLETION=1 ${COMP_WORDS[0]} __complete -- "${args[@]}"))
+	return 1
+}
+
+complete -F _src src
+`,
+	"zsh": `#compdef src
+
+_src() {
+	local IFS=$'\n'
+	local -a completions
+	completions=($(GO_FLAGS_COMPLETION=1 ${words[1]} __complete -- "${(@)words[2,$CURRENT]}"))
+	compadd -Q -S '' -a completions
+}
+
+compdef _src src
+`,
+	"fish": `function __src_complete
+	set -l args (commandline -opc)[2..-1] (commandline -ct)
+	env GO_FLAGS_COMPLETION=1 src __complete -- $args
+end
+
+complete -c src -f -a '(__src_complete)'
+`,
+}
+
+func (c *CompletionCmd) Execute(args []string) error {
+	script, ok := completionScripts[c.Args.Shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q (supported shells are bash, zsh, and fish)", c.Args.Shell)
+	}
+	_, err := io.WriteString(os.Stdout, script)
+	return err
+}
+
+// printCommandsJSONFlag is the global flag that makes src print a
+// description of all commands and their options as JSON (see
+// printCommandsJSON) instead of running a command.
+const printCommandsJSONFlag = "--print-commands-json"
+
+// commandsJSON is the output of `src --print-commands-json`.
+type commandsJSON struct {
+	// Format is the version of this output format. It is incremented
+	// when fields are changed or removed (but not when they are
+	// added).
+	Format int
+
+	// Version is the version of src.
+	Version string
+
+	// Command describes src's global options and its commands.
+	Command *flagutil.CommandInfo
+}
+
+// printCommandsJSON writes a JSON description of all of src's
+// commands and options to w.
+func printCommandsJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(&commandsJSON{
+		Format:  1,
+		Version: Version,
+		Command: flagutil.DescribeCommand(CLI.Command),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -1,7 +1,7 @@
 package src
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -14,6 +14,7 @@ import (
 	"sourcegraph.com/sourcegraph/rwvfs"
 	"sourcegraph.com/sourcegraph/srclib/buildstore"
 	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/jsonutil"
 	"sourcegraph.com/sourcegraph/srclib/plan"
 	"sourcegraph.com/sourcegraph/srclib/toolchain"
 
@@ -34,6 +35,8 @@ The steps are:
 3. Scan for source units in the directory tree rooted at the current directory (or the root of the repository containing the current directory), using the scanners specified in either the user srclib config or the Srcfile (or otherwise the defaults).
 
 The default values for --repo and --subdir are determined by detecting the current repository and reading its Srcfile config (if any).
+
+To check Srcfiles for errors, run "src config lint".
 `,
 		&configCmd,
 	)
@@ -41,9 +44,12 @@ The default values for --repo and --subdir are determined by detecting the curre
 		log.Fatal(err)
 	}
 	c.Aliases = []string{"c"}
+	c.SubcommandsOptional = true
 
 	setDefaultRepoURIOpt(c)
 	setDefaultRepoSubdirOpt(c)
+
+	initConfigLintCmd(c)
 }
 
 // getInitialConfig gets the initial config (i.e., the config that comes solely
@@ -111,7 +117,9 @@ func (c *ConfigCmd) Execute(args []string) error {
 		}
 	}
 
-	if err := scanUnitsIntoConfig(cfg, c.Options, c.ToolchainExecOpt, c.Quiet); err != nil {
+	ctx, cancel := interruptContext()
+	defer cancel()
+	if _, err := scanUnitsIntoConfig(ctx, cfg, c.Options, c.ToolchainExecOpt, c.Quiet); err != nil {
 		return fmt.Errorf("failed to scan for source units: %s", err)
 	}
 
@@ -132,6 +140,19 @@ func (c *ConfigCmd) Execute(args []string) error {
 		}
 		for _, u := range cfg.SourceUnits {
 			unitFile := plan.SourceUnitDataFilename(unit.SourceUnit{}, u)
+			data, err := jsonutil.Marshal(u)
+			if err != nil {
+				return err
+			}
+			data = append(data, '\n')
+
+			// Don't rewrite unchanged source unit files, so that build
+			// data that depends on them (which is keyed on their
+			// fingerprints) is not needlessly rebuilt.
+			if unitFileUnchanged(commitFS, unitFile, data) {
+				continue
+			}
+
 			if err := rwvfs.MkdirAll(commitFS, filepath.Dir(unitFile)); err != nil {
 				return err
 			}
@@ -140,7 +161,7 @@ func (c *ConfigCmd) Execute(args []string) error {
 				return err
 			}
 			defer f.Close()
-			if err := json.NewEncoder(f).Encode(u); err != nil {
+			if _, err := f.Write(data); err != nil {
 				return err
 			}
 			if err := f.Close(); err != nil {
@@ -173,6 +194,18 @@ func (c *ConfigCmd) Execute(args []string) error {
 	return nil
 }
 
+// unitFileUnchanged returns whether the file at path in fs exists and
+// contains exactly data.
+func unitFileUnchanged(fs rwvfs.FileSystem, path string, data []byte) bool {
+	f, err := fs.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	old, err := ioutil.ReadAll(f)
+	return err == nil && bytes.Equal(old, data)
+}
+
 func sortedMap(m map[string]interface{}) [][2]interface{} {
 	keys := make([]string, len(m))
 	i := 0
@@ -0,0 +1,162 @@
+package src
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+func initConfigLintCmd(configC *flags.Command) {
+	_, err := configC.AddCommand("lint",
+		"check Srcfiles for errors",
+		`The lint command checks the Srcfile in the root directory of the repository containing DIR (or the current directory if not specified), and the Srcfiles in its subdirectories, against the Srcfile schema. It reports each problem with its line and column: unknown keys, values of the wrong type, malformed globs and paths, and references to toolchains or tools that are not installed. It exits with an error if there are any problems.
+
+The schema is derived from the Srcfile format as documented in package config. With --schema, it is printed as a JSON Schema (for use in editors) instead.
+
+With --format table (the default), it prints each problem on a line (as FILE:LINE:COL: MESSAGE) for people and editors; with --format json, a JSON array of problems; and with --format quiet, nothing.`,
+		&configLintCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type ConfigLintCmd struct {
+	Format string `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+	Schema bool   `long:"schema" description:"print the Srcfile JSON Schema and exit"`
+
+	Args struct {
+		Dir Directory `name:"DIR" default:"." description:"directory in the repository to check"`
+	} `positional-args:"yes"`
+}
+
+var configLintCmd ConfigLintCmd
+
+func (c *ConfigLintCmd) Execute(args []string) error {
+	if c.Schema {
+		PrintJSON(config.Schema(), "")
+		return nil
+	}
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+
+	r, err := OpenRepo(c.Args.Dir.String())
+	if err != nil {
+		return err
+	}
+	files, err := findSrcfiles(r.RootDir)
+	if err != nil {
+		return err
+	}
+
+	l := toolRefLinter{}
+	var errs []*config.LintError
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(r.RootDir, file))
+		if err != nil {
+			return err
+		}
+		var fileErrs []*config.LintError
+		if file == config.Filename {
+			fileErrs = config.LintRepository(data, l.check)
+		} else {
+			fileErrs = config.LintTree(data, l.check)
+		}
+		for _, e := range fileErrs {
+			e.File = file
+		}
+		errs = append(errs, fileErrs...)
+	}
+
+	switch format {
+	case formatJSON:
+		if errs == nil {
+			errs = []*config.LintError{}
+		}
+		PrintJSON(errs, "")
+	case formatTable:
+		for _, e := range errs {
+			fmt.Println(e)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("found %d problems in %d %s files", len(errs), len(files), config.Filename)
+	}
+	if GlobalOpt.Verbose {
+		log.Printf("Checked %d %s files; no problems found.", len(files), config.Filename)
+	}
+	return nil
+}
+
+// findSrcfiles returns the paths (relative to rootDir) of the Srcfiles
+// in the tree rooted at rootDir, skipping hidden dirs (such as .git
+// and .srclib-cache) and the dirs that config.DefaultSkipPatterns
+// match.
+func findSrcfiles(rootDir string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(rootDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			if rel != "." && strings.HasPrefix(fi.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if _, skip := config.MatchSkipPatterns(config.DefaultSkipPatterns, rel, true); skip {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.Name() == config.Filename && fi.Mode().IsRegular() {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// toolRefLinter checks that the tools that Srcfiles refer to are
+// installed, memoizing the toolchains' configs.
+type toolRefLinter map[string]*toolchain.Config
+
+func (l toolRefLinter) check(ref *srclib.ToolRef) error {
+	cfg, present := l[ref.Toolchain]
+	if !present {
+		tc, err := toolchain.Lookup(ref.Toolchain)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("toolchain %q is not installed (see `src toolchain list`)", ref.Toolchain)
+		} else if err != nil {
+			return fmt.Errorf("toolchain %q: %s", ref.Toolchain, err)
+		}
+		if tc != nil {
+			if cfg, err = tc.ReadConfig(); err != nil {
+				return fmt.Errorf("toolchain %q: %s", ref.Toolchain, err)
+			}
+		}
+		l[ref.Toolchain] = cfg
+	}
+	if cfg == nil || ref.Subcmd == "" {
+		return nil
+	}
+	for _, tool := range cfg.Tools {
+		if tool.Subcmd == ref.Subcmd {
+			return nil
+		}
+	}
+	return fmt.Errorf("toolchain %q has no tool %q", ref.Toolchain, ref.Subcmd)
+}
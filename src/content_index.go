@@ -0,0 +1,19 @@
+package src
+
+import (
+	"fmt"
+
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+// openContentIndex returns the content index for the commit (and, for
+// multi-repo stores, repo) from stor.
+func openContentIndex(stor interface{}, repo, commitID string) (*store.ContentIndex, error) {
+	switch s := stor.(type) {
+	case store.RepoContentIndexer:
+		return s.ContentIndex(commitID)
+	case store.MultiRepoContentIndexer:
+		return s.ContentIndex(repo, commitID)
+	}
+	return nil, fmt.Errorf("store (type %T) does not implement content indexing", stor)
+}
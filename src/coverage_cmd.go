@@ -0,0 +1,143 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/jsonutil"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+)
+
+func init() {
+	c, err := CLI.AddCommand("coverage",
+		"show per-file ref coverage",
+		`The coverage command computes the fraction of refs in each file that were successfully linked to defs, using the build data (in .srclib-cache) for the current repository. Refs to defs in other repositories can't be checked and are not counted toward a file's score.
+
+The per-file scores are saved to the build data directory (as coverage.json) so that they can be uploaded and tracked along with the other build data.
+
+Use --below to list only poorly indexed files (e.g., --below 0.5 lists files in which fewer than half of the refs were resolved).
+
+With --format table (the default), it prints aligned columns (with a header row) for people; with --format json, a JSON array of file scores; and with --format quiet, nothing (but the scores are still saved). It exits with status 3 if no files are listed, 1 if the coverage can't be computed, and 0 otherwise.
+`,
+		&coverageCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	setDefaultRepoURIOpt(c)
+	setDefaultCommitIDOpt(c)
+}
+
+type CoverageCmd struct {
+	Repo     string `long:"repo" description:"repository URI (defaults to VCS 'srclib' or 'origin' remote URL)"`
+	CommitID string `long:"commit" description:"commit ID of build data to compute coverage for"`
+
+	Below  float64 `long:"below" description:"only list files whose score (0-1) is below this value (0 to list all files)" value-name:"SCORE"`
+	NoSave bool    `long:"no-save" description:"don't save per-file scores to the build data directory"`
+	Format string  `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+}
+
+var coverageCmd CoverageCmd
+
+func (c *CoverageCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	bdfs, label, err := getLocalBuildDataFS(c.CommitID)
+	if err != nil {
+		return err
+	}
+	if bdfs == nil {
+		return fmt.Errorf("no local build data found for commit %q (run `src make` first)", c.CommitID)
+	}
+	if GlobalOpt.Verbose {
+		log.Printf("# Computing coverage for build data in %s", label)
+	}
+
+	treeConfig, err := config.ReadCached(bdfs)
+	if err != nil {
+		return err
+	}
+
+	var (
+		allDefs []*graph.Def
+		allRefs []*graph.Ref
+	)
+	for _, u := range treeConfig.SourceUnits {
+		var o graph.Output
+		graphFile := plan.SourceUnitDataFilename(&graph.Output{}, u)
+		if err := readJSONFileFS(bdfs, graphFile, &o); err != nil {
+			if os.IsNotExist(err) {
+				logutil.ForUnit(nil, c.Repo, u.Type, u.Name).Warn("No build data for source unit.")
+				continue
+			}
+			return fmt.Errorf("%s: %s", graphFile, err)
+		}
+		grapher.PopulateImpliedFields(c.Repo, "", u.Type, u.Name, &o)
+		allDefs = append(allDefs, o.Defs...)
+		allRefs = append(allRefs, o.Refs...)
+	}
+
+	covs := grapher.ComputeFileCoverage(c.Repo, allRefs, allDefs)
+
+	if !c.NoSave {
+		if err := writeCoverage(bdfs, covs); err != nil {
+			return err
+		}
+	}
+
+	var shown []*grapher.FileCoverage
+	for _, cov := range covs {
+		if c.Below == 0 || cov.Score < c.Below {
+			shown = append(shown, cov)
+		}
+	}
+
+	switch format {
+	case formatJSON:
+		if shown == nil {
+			shown = []*grapher.FileCoverage{}
+		}
+		PrintJSON(shown, "")
+	case formatTable:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "SCORE\tRESOLVED\tREFS\tFILE")
+		for _, cov := range shown {
+			fmt.Fprintf(tw, "%.2f\t%d\t%d\t%s\n", cov.Score, cov.ResolvedRefs, cov.Refs-cov.UncheckedRefs, cov.File)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(shown) == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// writeCoverage writes per-file coverage scores to the commit-level
+// coverage.json file in the build data directory.
+func writeCoverage(bdfs rwvfs.FileSystem, covs []*grapher.FileCoverage) error {
+	data, err := jsonutil.Marshal(covs)
+	if err != nil {
+		return err
+	}
+	f, err := bdfs.Create(plan.RepositoryCommitDataFilename([]*grapher.FileCoverage{}))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,470 @@
+package src
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/remap"
+)
+
+func init() {
+	_, err := CLI.AddCommand("daemon",
+		"run a local server for editor integrations",
+		`The daemon command runs a local HTTP server that editor integrations query for the def, refs, and docs at a position in a file. Answers come from the store (which must already contain the repository's build data) and are adjusted for unsaved editor buffers, which the editor sends to the daemon as overlays.
+
+Requests and responses are JSON. Positions are byte offsets. FILE is relative to the repository root (or absolute).
+
+  PUT    /overlay                   set a file's unsaved contents; the body is {"File": FILE, "Contents": TEXT}
+  DELETE /overlay?file=FILE         remove a file's overlay (e.g., after the file is saved)
+  GET    /def?file=FILE&offset=N    the ref at a position and its def
+  GET    /refs?file=FILE&offset=N   all refs to the def referenced at a position
+  GET    /hover?file=FILE&offset=N  the title and docs of the def referenced at a position
+  GET    /outline?file=FILE         the hierarchy of defs in a file (see "src api outline")
+
+Offsets in requests and responses are offsets in the current contents of files: the overlay contents for files with overlays, and the files on disk otherwise. Since the build data in the store was built from the files at the commit, offsets are mapped to and from the current contents by diffing the two. Positions in lines that were changed since the commit can't be mapped, so a query at such a position finds no ref (and refs in changed lines are omitted from results). Lines whose line endings changed (e.g., because a file was checked out on Windows with CRLF line endings) aren't considered changed unless --exact-line-endings is set.`,
+		&daemonCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type DaemonCmd struct {
+	Addr     string `long:"http" description:"HTTP listen address (must be a loopback address, since there is no authentication)" default:"127.0.0.1:3082"`
+	Repo     string `long:"repo" description:"repo URI of the build data in the store (if the store contains multiple repos)"`
+	CommitID string `long:"commit" description:"commit ID of the build data in the store (default: the repository's current commit)"`
+
+	ExactLineEndings bool `long:"exact-line-endings" description:"treat lines whose line endings changed since the commit (e.g., from LF to CRLF) as changed"`
+}
+
+var daemonCmd DaemonCmd
+
+func (c *DaemonCmd) Execute(args []string) error {
+	if host, _, err := net.SplitHostPort(c.Addr); err != nil {
+		return fmt.Errorf("invalid listen address %q: %s", c.Addr, err)
+	} else if !srclib.IsLocalHost(host) {
+		return fmt.Errorf("refusing to listen on non-loopback address %q (the daemon has no authentication)", c.Addr)
+	}
+
+	lrepo, err := openLocalRepo()
+	if err != nil {
+		return err
+	}
+	d := &daemon{
+		rootDir:  lrepo.RootDir,
+		repo:     c.Repo,
+		commitID: c.CommitID,
+		overlays: map[string][]byte{},
+	}
+	if d.commitID == "" {
+		d.commitID = lrepo.CommitID
+	}
+	d.tree = &remap.Tree{Base: d.readDisk, Current: d.readCurrent, IgnoreLineEndings: !c.ExactLineEndings}
+	if lrepo.VCSType != "" {
+		d.tree.Base = func(file string) ([]byte, error) {
+			return readFileAtRevision(lrepo.VCSType, d.rootDir, d.commitID, file)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/overlay", daemonHandler(d.serveOverlay))
+	mux.Handle("/def", daemonHandler(d.serveDef))
+	mux.Handle("/refs", daemonHandler(d.serveRefs))
+	mux.Handle("/hover", daemonHandler(d.serveHover))
+	mux.Handle("/outline", daemonHandler(d.serveOutline))
+	log.Printf("Listening on %s (repository %s at commit %s).", c.Addr, d.rootDir, d.commitID)
+	return http.ListenAndServe(c.Addr, loopbackHostOnly(mux))
+}
+
+// loopbackHostOnly returns an HTTP handler that rejects requests
+// whose Host header isn't a loopback name or address. Otherwise a web
+// page whose host name resolves (or is rebound) to a loopback address
+// could query the daemon (a DNS rebinding attack).
+func loopbackHostOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isLoopbackHost(r.Host) {
+			http.Error(w, fmt.Sprintf("invalid Host %q (only loopback hosts are allowed)", r.Host), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// isLoopbackHost returns whether the host (with an optional port) in
+// an HTTP request's Host header is a loopback name or address.
+func isLoopbackHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	} else if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	return srclib.IsLocalHost(host)
+}
+
+// daemon answers editor queries against the store, adjusting
+// positions for changes since the commit (including overlays).
+type daemon struct {
+	rootDir  string // repository root dir
+	repo     string // repo URI in the store (empty for the store's only repo)
+	commitID string
+
+	// tree maps spans in the files at the commit to their current
+	// contents.
+	tree *remap.Tree
+
+	mu       sync.Mutex
+	overlays map[string][]byte // repo-relative path -> unsaved contents
+}
+
+// errDaemonNotFound indicates that there is no ref at the queried
+// position.
+var errDaemonNotFound = errors.New("no ref found at position")
+
+// daemonHandler returns an HTTP handler that writes f's result as
+// JSON.
+func daemonHandler(f func(*http.Request) (interface{}, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, err := f(r)
+		if err != nil {
+			code := http.StatusInternalServerError
+			switch {
+			case err == errDaemonNotFound:
+				code = http.StatusNotFound
+			case os.IsNotExist(err):
+				code = http.StatusNotFound
+			case isDaemonBadRequest(err):
+				code = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			log.Printf("Error writing daemon response: %s.", err)
+		}
+	})
+}
+
+// daemonBadRequestError is an error in an HTTP request's parameters.
+type daemonBadRequestError struct{ msg string }
+
+func (e *daemonBadRequestError) Error() string { return e.msg }
+
+func isDaemonBadRequest(err error) bool {
+	_, ok := err.(*daemonBadRequestError)
+	return ok
+}
+
+func (d *daemon) serveOverlay(r *http.Request) (interface{}, error) {
+	switch r.Method {
+	case "PUT", "POST":
+		var o struct {
+			File     string
+			Contents string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+			return nil, &daemonBadRequestError{fmt.Sprintf("invalid overlay: %s", err)}
+		}
+		file, err := d.relPath(o.File)
+		if err != nil {
+			return nil, err
+		}
+		d.mu.Lock()
+		d.overlays[file] = []byte(o.Contents)
+		d.mu.Unlock()
+		return struct{}{}, nil
+	case "DELETE":
+		file, err := d.relPath(r.FormValue("file"))
+		if err != nil {
+			return nil, err
+		}
+		d.mu.Lock()
+		delete(d.overlays, file)
+		d.mu.Unlock()
+		return struct{}{}, nil
+	}
+	return nil, &daemonBadRequestError{fmt.Sprintf("unsupported method %s", r.Method)}
+}
+
+// readCurrent reads the current contents of file (which is relative
+// to the repository root): its overlay contents, if it has an overlay,
+// and otherwise the file on disk.
+func (d *daemon) readCurrent(file string) ([]byte, error) {
+	d.mu.Lock()
+	data, ok := d.overlays[file]
+	d.mu.Unlock()
+	if ok {
+		return data, nil
+	}
+	return d.readDisk(file)
+}
+
+func (d *daemon) readDisk(file string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(d.rootDir, filepath.FromSlash(file)))
+}
+
+// relPath returns file relative to the repository root, with forward
+// slashes (as in the store). Files outside of the repository (such as
+// "../x", which would otherwise be read from disk by readDisk) are
+// rejected.
+func (d *daemon) relPath(file string) (string, error) {
+	if file == "" {
+		return "", &daemonBadRequestError{"no file specified"}
+	}
+	if filepath.IsAbs(file) {
+		rel, err := filepath.Rel(d.rootDir, file)
+		if err != nil {
+			return "", &daemonBadRequestError{fmt.Sprintf("file %s is not in repository %s", file, d.rootDir)}
+		}
+		file = rel
+	}
+	rel := path.Clean(filepath.ToSlash(file))
+	if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", &daemonBadRequestError{fmt.Sprintf("file %s is not in repository %s", file, d.rootDir)}
+	}
+	return rel, nil
+}
+
+// position returns the file and offset (in the file at the commit) of
+// a query.
+func (d *daemon) position(r *http.Request) (file string, offset uint32, err error) {
+	file, err = d.relPath(r.FormValue("file"))
+	if err != nil {
+		return "", 0, err
+	}
+	off, err := strconv.ParseUint(r.FormValue("offset"), 10, 32)
+	if err != nil {
+		return "", 0, &daemonBadRequestError{fmt.Sprintf("invalid offset: %s", err)}
+	}
+	baseOff, ok, err := d.tree.BaseOffset(file, int(off))
+	if err != nil {
+		return "", 0, err
+	}
+	if !ok {
+		return "", 0, errDaemonNotFound // position was changed since the commit
+	}
+	return file, uint32(baseOff), nil
+}
+
+// span maps a span in file at the commit to the file's current
+// contents. If the span was changed since the commit, ok is false.
+func (d *daemon) span(file string, start, end uint32) (newStart, newEnd uint32, ok bool, err error) {
+	s, err := d.tree.Span(file, int(start), int(end))
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return uint32(s.Start), uint32(s.End), !s.Modified, nil
+}
+
+// refAt returns the innermost ref that contains the position (whose
+// offset is in the file at the commit).
+func (d *daemon) refAt(file string, offset uint32) (*graph.Ref, error) {
+	refs, err := (&StoreRefsCmd{Repo: d.repo, CommitID: d.commitID, File: file}).Get()
+	if err != nil {
+		return nil, err
+	}
+	var ref *graph.Ref
+	for _, ref2 := range refs {
+		if offset >= ref2.Start && offset <= ref2.End && (ref == nil || ref2.End-ref2.Start < ref.End-ref.Start) {
+			ref = ref2
+		}
+	}
+	if ref == nil {
+		return nil, errDaemonNotFound
+	}
+	if ref.DefRepo == "" {
+		ref.DefRepo = ref.Repo
+	}
+	if ref.DefUnitType == "" {
+		ref.DefUnitType = ref.UnitType
+	}
+	if ref.DefUnit == "" {
+		ref.DefUnit = ref.Unit
+	}
+	return ref, nil
+}
+
+// def returns the def that ref points to, or nil if it isn't in the
+// store.
+func (d *daemon) def(ref *graph.Ref) (*graph.Def, error) {
+	c := &StoreDefsCmd{Repo: ref.DefRepo, UnitType: ref.DefUnitType, Unit: ref.DefUnit, Path: ref.DefPath}
+	if ref.DefRepo == ref.Repo {
+		c.CommitID = d.commitID
+	}
+	defs, err := c.Get()
+	if err != nil || len(defs) == 0 {
+		return nil, err
+	}
+	return defs[0], nil
+}
+
+// daemonDef is the response to a /def query.
+type daemonDef struct {
+	Ref *graph.Ref
+	Def *graph.Def `json:",omitempty"` // nil if the def isn't in the store
+
+	// DefModified is whether the def is in a region of its file that
+	// was changed since the commit. If so, Def's position is in the
+	// file at the commit.
+	DefModified bool `json:",omitempty"`
+}
+
+func (d *daemon) serveDef(r *http.Request) (interface{}, error) {
+	file, offset, err := d.position(r)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := d.refAt(file, offset)
+	if err != nil {
+		return nil, err
+	}
+	def, err := d.def(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp daemonDef
+	resp.Ref = ref
+	var ok bool
+	if ref.Start, ref.End, ok, err = d.span(ref.File, ref.Start, ref.End); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, errDaemonNotFound // part of the ref was changed since the commit
+	}
+	if def != nil {
+		resp.Def = def
+		if def.Repo == ref.Repo {
+			start, end, ok, err := d.span(def.File, def.DefStart, def.DefEnd)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				def.DefStart, def.DefEnd = start, end
+			} else {
+				resp.DefModified = true
+			}
+		}
+	}
+	return resp, nil
+}
+
+func (d *daemon) serveRefs(r *http.Request) (interface{}, error) {
+	file, offset, err := d.position(r)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := d.refAt(file, offset)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := (&StoreRefsCmd{
+		Repo:        d.repo,
+		CommitID:    d.commitID,
+		DefRepo:     ref.DefRepo,
+		DefUnitType: ref.DefUnitType,
+		DefUnit:     ref.DefUnit,
+		DefPath:     ref.DefPath,
+	}).Get()
+	if err != nil {
+		return nil, err
+	}
+	keep := make([]*graph.Ref, 0, len(refs))
+	for _, ref2 := range refs {
+		start, end, ok, err := d.span(ref2.File, ref2.Start, ref2.End)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			ref2.Start, ref2.End = start, end
+			keep = append(keep, ref2)
+		}
+	}
+	return keep, nil
+}
+
+// daemonHover is the response to a /hover query.
+type daemonHover struct {
+	Title string         // the def's name and type (e.g., "func F(x int)")
+	Docs  []graph.DefDoc `json:",omitempty"`
+	Def   *graph.DefKey  `json:",omitempty"`
+}
+
+func (d *daemon) serveHover(r *http.Request) (interface{}, error) {
+	file, offset, err := d.position(r)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := d.refAt(file, offset)
+	if err != nil {
+		return nil, err
+	}
+	def, err := d.def(ref)
+	if err != nil {
+		return nil, err
+	}
+	if def == nil {
+		return daemonHover{Title: path.Base(ref.DefPath)}, nil
+	}
+	resp := daemonHover{Title: def.Name, Docs: def.Docs, Def: &def.DefKey}
+	if _, ok := graph.MakeDefFormatters[def.UnitType]; ok {
+		resp.Title = defSignature(def)
+	}
+	return resp, nil
+}
+
+// daemonOutlineNode is a def in the response to an /outline query.
+type daemonOutlineNode struct {
+	Def *graph.Def
+
+	// DefModified is whether the def is in a region of the file that
+	// was changed since the commit (as in daemonDef).
+	DefModified bool `json:",omitempty"`
+
+	Children []*daemonOutlineNode `json:",omitempty"`
+}
+
+func (d *daemon) serveOutline(r *http.Request) (interface{}, error) {
+	file, err := d.relPath(r.FormValue("file"))
+	if err != nil {
+		return nil, err
+	}
+	defs, err := (&StoreDefsCmd{Repo: d.repo, CommitID: d.commitID, File: file}).Get()
+	if err != nil {
+		return nil, err
+	}
+	var convert func([]*graph.DefNode) ([]*daemonOutlineNode, error)
+	convert = func(nodes []*graph.DefNode) ([]*daemonOutlineNode, error) {
+		out := make([]*daemonOutlineNode, len(nodes))
+		for i, n := range nodes {
+			out[i] = &daemonOutlineNode{Def: n.Def}
+			start, end, ok, err := d.span(file, n.Def.DefStart, n.Def.DefEnd)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				n.Def.DefStart, n.Def.DefEnd = start, end
+			} else {
+				out[i].DefModified = true
+			}
+			if out[i].Children, err = convert(n.Children); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	return convert(graph.Outline(defs))
+}
@@ -0,0 +1,80 @@
+package src
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestDaemon_relPath(t *testing.T) {
+	root, err := filepath.Abs("testdata/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &daemon{rootDir: root}
+
+	tests := []struct {
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{file: "a.go", want: "a.go"},
+		{file: "./dir/../a.go", want: "a.go"},
+		{file: "dir/b.go", want: "dir/b.go"},
+		{file: filepath.Join(root, "dir", "b.go"), want: "dir/b.go"},
+		{file: "..x/a.go", want: "..x/a.go"},
+
+		{file: "", wantErr: true},
+		{file: "..", wantErr: true},
+		{file: "../a.go", wantErr: true},
+		{file: "dir/../../a.go", wantErr: true},
+		{file: filepath.Join(root, "..", "a.go"), wantErr: true},
+		{file: filepath.Dir(root), wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := d.relPath(test.file)
+		if test.wantErr {
+			if _, ok := err.(*daemonBadRequestError); !ok {
+				t.Errorf("%q: got (%q, %v), want a bad request error", test.file, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", test.file, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: got %q, want %q", test.file, got, test.want)
+		}
+	}
+}
+
+func TestLoopbackHostOnly(t *testing.T) {
+	h := loopbackHostOnly(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := map[string]struct {
+		host     string
+		wantCode int
+	}{
+		"localhost":             {host: "localhost:3082", wantCode: http.StatusOK},
+		"localhost no port":     {host: "localhost", wantCode: http.StatusOK},
+		"localhost uppercase":   {host: "LOCALHOST:3082", wantCode: http.StatusOK},
+		"ipv4 loopback":         {host: "127.0.0.1:3082", wantCode: http.StatusOK},
+		"ipv6 loopback":         {host: "[::1]:3082", wantCode: http.StatusOK},
+		"ipv6 loopback no port": {host: "[::1]", wantCode: http.StatusOK},
+
+		"rebound name":     {host: "attacker.example.com:3082", wantCode: http.StatusForbidden},
+		"localhost suffix": {host: "localhost.example.com", wantCode: http.StatusForbidden},
+		"other address":    {host: "10.0.0.1:3082", wantCode: http.StatusForbidden},
+		"empty":            {host: "", wantCode: http.StatusForbidden},
+	}
+	for label, test := range tests {
+		req := httptest.NewRequest("GET", "/def", nil)
+		req.Host = test.host
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, req)
+		if rw.Code != test.wantCode {
+			t.Errorf("%s: got status %d, want %d", label, rw.Code, test.wantCode)
+		}
+	}
+}
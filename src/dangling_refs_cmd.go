@@ -0,0 +1,211 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+type StoreDanglingRefsCmd struct {
+	Repo     string `long:"repo" description:"only check refs in this repo"`
+	CommitID string `long:"commit" description:"only check refs at this commit ID"`
+	UnitType string `long:"unit-type" description:"only check refs in source units of this type"`
+	Unit     string `long:"unit" description:"only check refs in source units with this name"`
+
+	Format string `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+}
+
+var storeDanglingRefsCmd StoreDanglingRefsCmd
+
+// danglingRefGroup is a list of refs that all point to the same
+// nonexistent def.
+type danglingRefGroup struct {
+	Def  graph.DefKey
+	Refs []*graph.Ref
+}
+
+// unitFilters returns filters that select the source units whose
+// refs to check.
+func (c *StoreDanglingRefsCmd) unitFilters() []store.UnitFilter {
+	var fs []store.UnitFilter
+	if c.UnitType != "" && c.Unit != "" {
+		fs = append(fs, store.ByUnits(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+	}
+	if (c.UnitType != "" && c.Unit == "") || (c.UnitType == "" && c.Unit != "") {
+		log.Fatal("must specify either both or neither of --unit-type and --unit (to filter by source unit)")
+	}
+	if c.CommitID != "" {
+		fs = append(fs, store.ByCommitIDs(c.CommitID))
+	}
+	if c.Repo != "" {
+		fs = append(fs, store.ByRepos(c.Repo))
+	}
+	return fs
+}
+
+func (c *StoreDanglingRefsCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement checking ref resolution", s)
+	}
+
+	brokenRefs, checked, err := danglingRefs(rs, c.unitFilters()...)
+	if err != nil {
+		return err
+	}
+	groups := groupRefsByDef(brokenRefs)
+
+	printDanglingRefGroups(format, groups)
+	if format == formatTable {
+		log.Printf("# %d dangling refs to %d nonexistent defs (out of %d refs checked)", len(brokenRefs), len(groups), checked)
+	}
+	if len(groups) == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// danglingRefs returns the refs in the source units (matching
+// filters) that point to nonexistent defs, sorted, and the number of
+// refs checked. The refs are read one source unit at a time, so that
+// only the dangling refs are kept in memory.
+func danglingRefs(rs store.RepoStore, filters ...store.UnitFilter) (dangling []*graph.Ref, checked int, err error) {
+	units, err := rs.Units(filters...)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, u := range units {
+		fs := []store.RefFilter{store.ByUnits(u.ID2())}
+		if u.CommitID != "" {
+			fs = append(fs, store.ByCommitIDs(u.CommitID))
+		}
+		if u.Repo != "" {
+			fs = append(fs, store.ByRepos(u.Repo))
+		}
+		refs, err := rs.Refs(fs...)
+		if err != nil {
+			return nil, 0, err
+		}
+		broken, err := brokenRefsOnly(refs, rs)
+		if err != nil {
+			return nil, 0, err
+		}
+		dangling = append(dangling, broken...)
+		checked += len(refs)
+	}
+	sort.Sort(graph.Refs(dangling))
+	return dangling, checked, nil
+}
+
+type StoreQuarantinedRefsCmd struct {
+	Repo     string `long:"repo" description:"repo whose quarantined refs to list (required for MultiRepoStore)"`
+	CommitID string `long:"commit" description:"commit ID whose quarantined refs to list" required:"yes"`
+
+	Format string `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+}
+
+var storeQuarantinedRefsCmd StoreQuarantinedRefsCmd
+
+func (c *StoreQuarantinedRefsCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+
+	var refs []*graph.Ref
+	switch s := s.(type) {
+	case store.RepoRefQuarantiner:
+		refs, err = s.QuarantinedRefs(c.CommitID)
+	case store.MultiRepoRefQuarantiner:
+		if c.Repo == "" {
+			return errors.New("--repo is required for a MultiRepoStore")
+		}
+		refs, err = s.QuarantinedRefs(c.Repo, c.CommitID)
+	default:
+		return fmt.Errorf("store (type %T) does not implement quarantined refs", s)
+	}
+	if os.IsNotExist(err) {
+		return fmt.Errorf("commit %s has no quarantined refs recorded (it was imported without --quarantine-dangling-refs)", c.CommitID)
+	} else if err != nil {
+		return err
+	}
+	groups := groupRefsByDef(refs)
+
+	printDanglingRefGroups(format, groups)
+	if len(groups) == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// printDanglingRefGroups prints groups in format (json, table, or
+// quiet) to stdout.
+func printDanglingRefGroups(format string, groups []*danglingRefGroup) {
+	switch format {
+	case formatJSON:
+		PrintJSON(groups, "")
+	case formatTable:
+		for _, g := range groups {
+			fmt.Printf("%s %s %s (%d refs)\n", g.Def.UnitType, g.Def.Unit, g.Def.Path, len(g.Refs))
+			for _, ref := range g.Refs {
+				fmt.Printf("\t%s bytes %d-%d\n", ref.File, ref.Start, ref.End)
+			}
+		}
+	}
+}
+
+// groupRefsByDef groups refs by the def they point to. The groups
+// are sorted by def unit type, unit, and path.
+func groupRefsByDef(refs []*graph.Ref) []*danglingRefGroup {
+	groupsByDef := map[graph.DefKey]*danglingRefGroup{}
+	for _, ref := range refs {
+		k := ref.DefKey()
+		g, present := groupsByDef[k]
+		if !present {
+			g = &danglingRefGroup{Def: k}
+			groupsByDef[k] = g
+		}
+		g.Refs = append(g.Refs, ref)
+	}
+
+	groups := make([]*danglingRefGroup, 0, len(groupsByDef))
+	for _, g := range groupsByDef {
+		groups = append(groups, g)
+	}
+	sort.Sort(danglingRefGroups(groups))
+	return groups
+}
+
+type danglingRefGroups []*danglingRefGroup
+
+func (v danglingRefGroups) Len() int      { return len(v) }
+func (v danglingRefGroups) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v danglingRefGroups) Less(i, j int) bool {
+	a, b := v[i].Def, v[j].Def
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	if a.Unit != b.Unit {
+		return a.Unit < b.Unit
+	}
+	return a.Path < b.Path
+}
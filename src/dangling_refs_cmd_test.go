@@ -0,0 +1,70 @@
+package src
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestDanglingRefs(t *testing.T) {
+	s := store.NewFSMultiRepoStore(rwvfs.Walkable(rwvfs.Map(map[string]string{})), nil)
+	ref := func(defUnit, defPath string, start uint32) *graph.Ref {
+		return &graph.Ref{DefRepo: "r", DefUnitType: "t", DefUnit: defUnit, DefPath: defPath, File: "f", Start: start, End: start + 1}
+	}
+	data := map[string]graph.Output{
+		"u1": {
+			Defs: []*graph.Def{{DefKey: graph.DefKey{Path: "a"}, Name: "a", File: "f"}},
+			Refs: []*graph.Ref{ref("u1", "a", 1), ref("u1", "x", 2)},
+		},
+		"u2": {
+			Refs: []*graph.Ref{ref("u1", "a", 3), ref("u2", "y", 4), ref("u2", "y", 5)},
+		},
+	}
+	for name, o := range data {
+		if err := s.Import("r", "c", &unit.SourceUnit{Type: "t", Name: name}, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]struct {
+		filters     []store.UnitFilter
+		wantDefs    []string // the DefPath of each dangling ref
+		wantChecked int
+	}{
+		"all": {
+			wantDefs:    []string{"x", "y", "y"},
+			wantChecked: 5,
+		},
+		"unit": {
+			// u2's ref to u1's def resolves, even though u1 isn't
+			// checked.
+			filters:     []store.UnitFilter{store.ByUnits(unit.ID2{Type: "t", Name: "u2"})},
+			wantDefs:    []string{"y", "y"},
+			wantChecked: 3,
+		},
+		"other commit": {
+			filters: []store.UnitFilter{store.ByCommitIDs("c2")},
+		},
+	}
+	for label, test := range tests {
+		refs, checked, err := danglingRefs(s, test.filters...)
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		var defs []string
+		for _, ref := range refs {
+			defs = append(defs, ref.DefPath)
+		}
+		if !reflect.DeepEqual(defs, test.wantDefs) {
+			t.Errorf("%s: got dangling refs to %v, want %v", label, defs, test.wantDefs)
+		}
+		if checked != test.wantChecked {
+			t.Errorf("%s: got %d refs checked, want %d", label, checked, test.wantChecked)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"text/tabwriter"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+type StoreDeadCodeCmd struct {
+	Repo     string `long:"repo" description:"only check defs in this repo"`
+	CommitID string `long:"commit" description:"only check defs at this commit ID"`
+	UnitType string `long:"unit-type" description:"only check defs in source units of this type"`
+	Unit     string `long:"unit" description:"only check defs in source units with this name"`
+
+	UnexportedOnly bool     `long:"unexported-only" description:"only list unexported defs"`
+	ExcludeKinds   []string `long:"exclude-kind" description:"also exclude defs of this kind (in addition to the language policy's)" value-name:"KIND"`
+
+	Format string `long:"format" description:"output format" default:"json" value-name:"json|table|quiet"`
+}
+
+var storeDeadCodeCmd StoreDeadCodeCmd
+
+// A deadCodePolicy describes the defs of a language (i.e., a source
+// unit type) that are commonly used without any refs to them, such as
+// entry points that the runtime calls and defs that are typically
+// accessed via reflection. They are never reported as dead code
+// candidates.
+type deadCodePolicy struct {
+	Names []string // def name patterns (in path.Match syntax)
+	Kinds []string // def kinds
+}
+
+// deadCodePolicies are the dead code policies for each source unit
+// type. Tests (defs whose Test field is set) and local defs are
+// excluded for all unit types.
+var deadCodePolicies = map[string]deadCodePolicy{
+	"GoPackage": {
+		Names: []string{"main", "init", "Test*", "Benchmark*", "Example*"},
+		// Methods are often only called via interfaces, and fields
+		// are often only accessed via reflection (e.g., by
+		// encoding/json).
+		Kinds: []string{"package", "method", "field"},
+	},
+	"PipPackage": {
+		Names: []string{"__*__", "test*", "setUp*", "tearDown*"},
+		Kinds: []string{"module"},
+	},
+	"JavaArtifact": {
+		Names: []string{"main", "<init>", "<clinit>"},
+		Kinds: []string{"package"},
+	},
+	"CommonJSPackage": {
+		Kinds: []string{"module"},
+	},
+}
+
+// excluded returns whether p excludes def.
+func (p deadCodePolicy) excluded(def *graph.Def) bool {
+	for _, k := range p.Kinds {
+		if def.Kind == k {
+			return true
+		}
+	}
+	for _, pat := range p.Names {
+		if ok, _ := path.Match(pat, def.Name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// A deadCodeCandidate is a def with no incoming refs.
+type deadCodeCandidate struct {
+	Repo     string `json:",omitempty"`
+	CommitID string `json:",omitempty"`
+	UnitType string
+	Unit     string
+	Path     string
+
+	Name     string
+	Kind     string `json:",omitempty"`
+	Exported bool
+
+	File     string
+	DefStart uint32
+	DefEnd   uint32
+}
+
+func (c *StoreDeadCodeCmd) Execute(args []string) error {
+	if (c.UnitType != "" && c.Unit == "") || (c.UnitType == "" && c.Unit != "") {
+		return fmt.Errorf("must specify either both or neither of --unit-type and --unit (to filter by source unit)")
+	}
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+	us, ok := s.(store.UnitStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing defs and refs", s)
+	}
+
+	// Refs from all units (not just the --unit) count, so the unit
+	// filter only applies to defs.
+	var (
+		defFilters []store.DefFilter
+		refFilters []store.RefFilter
+	)
+	if c.CommitID != "" {
+		defFilters = append(defFilters, store.ByCommitIDs(c.CommitID))
+		refFilters = append(refFilters, store.ByCommitIDs(c.CommitID))
+	}
+	if c.Repo != "" {
+		defFilters = append(defFilters, store.ByRepos(c.Repo))
+		refFilters = append(refFilters, store.ByRepos(c.Repo))
+	}
+	if c.Unit != "" {
+		defFilters = append(defFilters, store.ByUnits(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+	}
+
+	defs, err := us.Defs(defFilters...)
+	if err != nil {
+		return err
+	}
+	refs, err := us.Refs(refFilters...)
+	if err != nil {
+		return err
+	}
+
+	candidates := findDeadCode(defs, refs, c.ExcludeKinds)
+	if c.UnexportedOnly {
+		keep := candidates[:0]
+		for _, cand := range candidates {
+			if !cand.Exported {
+				keep = append(keep, cand)
+			}
+		}
+		candidates = keep
+	}
+
+	switch format {
+	case formatJSON:
+		if candidates == nil {
+			candidates = []*deadCodeCandidate{}
+		}
+		PrintJSON(candidates, "")
+	case formatTable:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "LOCATION\tKIND\tPATH\tEXPORTED")
+		for _, cand := range candidates {
+			exported := "-"
+			if cand.Exported {
+				exported = "exported"
+			}
+			fmt.Fprintf(tw, "%s:%d-%d\t%s\t%s\t%s\n", cand.File, cand.DefStart, cand.DefEnd, orDash(cand.Kind), cand.Path, exported)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		log.Printf("# %d dead code candidates (out of %d defs checked)", len(candidates), len(defs))
+	}
+	if len(candidates) == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// findDeadCode returns the defs that have no incoming refs (other
+// than the refs at their own definitions), excluding tests, local
+// defs, defs excluded by their unit type's dead code policy, and defs
+// of the excludeKinds. Refs are only counted if they are in the same
+// repo and commit as the def, so exported defs that are only used by
+// other repos are also returned. Candidates are sorted by repo,
+// commit, unit, file, and position.
+func findDeadCode(defs []*graph.Def, refs []*graph.Ref, excludeKinds []string) []*deadCodeCandidate {
+	referenced := make(map[graph.DefKey]struct{}, len(refs))
+	for _, ref := range refs {
+		if ref.Def {
+			continue
+		}
+		if ref.DefRepo != "" && ref.DefRepo != ref.Repo {
+			continue
+		}
+		k := ref.DefKey()
+		k.Repo, k.CommitID = ref.Repo, ref.CommitID
+		if k.UnitType == "" && k.Unit == "" {
+			k.UnitType, k.Unit = ref.UnitType, ref.Unit
+		}
+		referenced[k] = struct{}{}
+	}
+
+	var candidates []*deadCodeCandidate
+	for _, def := range defs {
+		if def.Test || def.Local {
+			continue
+		}
+		if deadCodePolicies[def.UnitType].excluded(def) || (deadCodePolicy{Kinds: excludeKinds}).excluded(def) {
+			continue
+		}
+		if _, ok := referenced[def.DefKey]; ok {
+			continue
+		}
+		candidates = append(candidates, &deadCodeCandidate{
+			Repo:     def.Repo,
+			CommitID: def.CommitID,
+			UnitType: def.UnitType,
+			Unit:     def.Unit,
+			Path:     def.Path,
+			Name:     def.Name,
+			Kind:     def.Kind,
+			Exported: def.Exported,
+			File:     def.File,
+			DefStart: def.DefStart,
+			DefEnd:   def.DefEnd,
+		})
+	}
+	sort.Sort(deadCodeCandidates(candidates))
+	return candidates
+}
+
+type deadCodeCandidates []*deadCodeCandidate
+
+func (v deadCodeCandidates) Len() int      { return len(v) }
+func (v deadCodeCandidates) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v deadCodeCandidates) Less(i, j int) bool {
+	a, b := v[i], v[j]
+	if a.Repo != b.Repo {
+		return a.Repo < b.Repo
+	}
+	if a.CommitID != b.CommitID {
+		return a.CommitID < b.CommitID
+	}
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	if a.Unit != b.Unit {
+		return a.Unit < b.Unit
+	}
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	return a.DefStart < b.DefStart
+}
@@ -0,0 +1,120 @@
+package src
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestFindDeadCode(t *testing.T) {
+	// def returns a def in repo r at commit c.
+	def := func(unitType, unit, path, kind string) *graph.Def {
+		return &graph.Def{
+			DefKey: graph.DefKey{Repo: "r", CommitID: "c", UnitType: unitType, Unit: unit, Path: path},
+			Name:   path,
+			Kind:   kind,
+			File:   unit + "/" + path,
+		}
+	}
+	// ref returns a ref from unit u in repo r at commit c to the def
+	// with the given def key fields.
+	ref := func(u, defRepo, defUnitType, defUnit, defPath string) *graph.Ref {
+		return &graph.Ref{Repo: "r", CommitID: "c", UnitType: "GoPackage", Unit: u, DefRepo: defRepo, DefUnitType: defUnitType, DefUnit: defUnit, DefPath: defPath}
+	}
+
+	tests := map[string]struct {
+		defs         []*graph.Def
+		refs         []*graph.Ref
+		excludeKinds []string
+		want         []string // paths of the candidates
+	}{
+		"no refs": {
+			defs: []*graph.Def{def("GoPackage", "u", "B", "func"), def("GoPackage", "u", "A", "func")},
+			want: []string{"A", "B"},
+		},
+		"same-repo refs": {
+			defs: []*graph.Def{def("GoPackage", "u", "A", "func"), def("GoPackage", "u", "B", "func"), def("GoPackage", "u", "C", "func")},
+			refs: []*graph.Ref{
+				ref("v", "", "GoPackage", "u", "A"),  // empty DefRepo
+				ref("v", "r", "GoPackage", "u", "B"), // explicit DefRepo
+			},
+			want: []string{"C"},
+		},
+		"cross-repo refs": {
+			defs: []*graph.Def{def("GoPackage", "u", "A", "func")},
+			refs: []*graph.Ref{
+				ref("v", "other", "GoPackage", "u", "A"),
+				// A ref in another repo to the def.
+				{Repo: "r2", CommitID: "c", UnitType: "GoPackage", Unit: "w", DefRepo: "r", DefUnitType: "GoPackage", DefUnit: "u", DefPath: "A"},
+			},
+			want: []string{"A"},
+		},
+		"refs at other commits": {
+			defs: []*graph.Def{def("GoPackage", "u", "A", "func")},
+			refs: []*graph.Ref{func() *graph.Ref { r := ref("v", "", "GoPackage", "u", "A"); r.CommitID = "c2"; return r }()},
+			want: []string{"A"},
+		},
+		"empty DefUnit refers to the ref's unit": {
+			defs: []*graph.Def{def("GoPackage", "u", "A", "func"), def("GoPackage", "v", "A", "func")},
+			refs: []*graph.Ref{ref("u", "", "", "", "A")},
+			want: []string{"A"}, // in unit v
+		},
+		"def refs don't count": {
+			defs: []*graph.Def{def("GoPackage", "u", "A", "func")},
+			refs: []*graph.Ref{func() *graph.Ref { r := ref("u", "", "", "", "A"); r.Def = true; return r }()},
+			want: []string{"A"},
+		},
+		"tests and locals": {
+			defs: []*graph.Def{
+				func() *graph.Def { d := def("GoPackage", "u", "A", "func"); d.Test = true; return d }(),
+				func() *graph.Def { d := def("GoPackage", "u", "B", "var"); d.Local = true; return d }(),
+				def("GoPackage", "u", "C", "func"),
+			},
+			want: []string{"C"},
+		},
+		"Go policy": {
+			defs: []*graph.Def{
+				def("GoPackage", "u", "main", "func"),
+				def("GoPackage", "u", "init", "func"),
+				def("GoPackage", "u", "TestA", "func"),
+				def("GoPackage", "u", "ExampleA", "func"),
+				def("GoPackage", "u", "T/M", "method"),
+				def("GoPackage", "u", "T/F", "field"),
+				def("GoPackage", "u", "u", "package"),
+				def("GoPackage", "u", "T", "type"),
+			},
+			want: []string{"T"},
+		},
+		"Python policy": {
+			defs: []*graph.Def{
+				def("PipPackage", "p", "__init__", "function"),
+				def("PipPackage", "p", "test_a", "function"),
+				def("PipPackage", "p", "setUp", "function"),
+				def("PipPackage", "p", "m", "module"),
+				// Go's policy doesn't apply to Python.
+				def("PipPackage", "p", "main", "function"),
+				def("PipPackage", "p", "M", "method"),
+			},
+			want: []string{"M", "main"},
+		},
+		"no policy": {
+			defs: []*graph.Def{def("RubyGem", "g", "main", "method"), def("RubyGem", "g", "m", "module")},
+			want: []string{"m", "main"},
+		},
+		"excluded kinds": {
+			defs:         []*graph.Def{def("GoPackage", "u", "A", "func"), def("GoPackage", "u", "B", "const"), def("RubyGem", "g", "C", "const")},
+			excludeKinds: []string{"const"},
+			want:         []string{"A"},
+		},
+	}
+	for label, test := range tests {
+		var got []string
+		for _, cand := range findDeadCode(test.defs, test.refs, test.excludeKinds) {
+			got = append(got, cand.Path)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got candidates %v, want %v", label, got, test.want)
+		}
+	}
+}
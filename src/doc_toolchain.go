@@ -0,0 +1,248 @@
+package src
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/doc"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// DocToolchain is the path of the built-in toolchain that indexes
+// Markdown and reStructuredText documentation files. Each heading is a
+// def, and each code span that mentions an identifier (such as
+// `os.Open`) is a ref to the def in another source unit with that name,
+// if there is exactly one such def.
+const DocToolchain = "sourcegraph.com/sourcegraph/srclib/doc"
+
+// DocUnitType is the source unit type of documentation source units.
+const DocUnitType = "Docs"
+
+func init() {
+	grapher.RegisterByteOffsetUnitType(DocUnitType)
+	toolchain.RegisterBuiltin(DocToolchain, &toolchain.Builtin{
+		Config: &toolchain.Config{
+			Tools: []*toolchain.ToolInfo{
+				{Subcmd: "scan", Op: "scan"},
+				{Subcmd: "depresolve", Op: "depresolve", SourceUnitTypes: []string{DocUnitType}},
+				{Subcmd: "graph", Op: "graph", SourceUnitTypes: []string{DocUnitType}},
+			},
+		},
+		Tools: map[string]toolchain.BuiltinTool{
+			"scan":       docScan,
+			"depresolve": noDepresolve, // documentation has no dependencies
+			"graph":      docGraph,
+		},
+	})
+}
+
+// isDocFile returns whether file is a documentation file that the doc
+// toolchain indexes: a Markdown or reStructuredText file in a "doc"
+// or "docs" directory or at the top level of the tree.
+func isDocFile(file string) bool {
+	if f := doc.Format(file); f != doc.Markdown && f != doc.ReStructuredText {
+		return false
+	}
+	dir := path.Dir(file)
+	if dir == "." {
+		return true
+	}
+	for _, c := range strings.Split(dir, "/") {
+		if c == "doc" || c == "docs" {
+			return true
+		}
+	}
+	return false
+}
+
+// docScan is the doc toolchain's scanner. It emits a single source
+// unit containing all of the tree's documentation files (or none, if
+// there are no documentation files).
+func docScan(args []string, stdin io.Reader, stdout io.Writer) error {
+	dir, err := readScanInput(args, stdin)
+	if err != nil {
+		return err
+	}
+	files, err := scanFiles(dir, isDocFile)
+	if err != nil {
+		return err
+	}
+
+	units := []*unit.SourceUnit{}
+	if len(files) > 0 {
+		units = append(units, &unit.SourceUnit{
+			Name:   "docs",
+			Type:   DocUnitType,
+			Dir:    filepath.ToSlash(dir),
+			Files:  files,
+			Config: map[string]interface{}{grapher.GraphLastConfigKey: true},
+		})
+	}
+	return json.NewEncoder(stdout).Encode(units)
+}
+
+// docGraph is the doc toolchain's grapher. It reads the other source
+// units' graph output from the local build store (which the doc
+// source unit is graphed after; see grapher.GraphLastConfigKey) to
+// resolve mentions.
+func docGraph(args []string, stdin io.Reader, stdout io.Writer) error {
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(stdin).Decode(&u); err != nil {
+		return err
+	}
+
+	defs, err := readLocalDefs()
+	if err != nil {
+		return err
+	}
+	r := newMentionResolver(defs)
+
+	var o graph.Output
+	for _, file := range u.Files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		headings, mentions := doc.Index(file, data)
+		for _, h := range headings {
+			def := &graph.Def{
+				DefKey:   graph.DefKey{Path: file + "/" + h.Anchor},
+				Name:     h.Text,
+				Kind:     "heading",
+				File:     file,
+				DefStart: uint32(h.Start),
+				DefEnd:   uint32(h.End),
+				Exported: true,
+			}
+			o.Defs = append(o.Defs, def)
+			o.Refs = append(o.Refs, &graph.Ref{
+				DefPath: def.Path,
+				Def:     true,
+				File:    file,
+				Start:   def.DefStart,
+				End:     def.DefEnd,
+			})
+		}
+		for _, m := range mentions {
+			if def := r.resolve(m); def != nil {
+				o.Refs = append(o.Refs, &graph.Ref{
+					DefUnitType: def.UnitType,
+					DefUnit:     def.Unit,
+					DefPath:     def.Path,
+					File:        file,
+					Start:       uint32(m.Start),
+					End:         uint32(m.End),
+				})
+			}
+		}
+	}
+	return json.NewEncoder(stdout).Encode(o)
+}
+
+// readLocalDefs returns the defs in the graph output of the non-doc
+// source units in the local build store of the repository in the
+// current directory. If there is no build store (or no graph output),
+// it returns no defs.
+func readLocalDefs() ([]*graph.Def, error) {
+	context, err := prepareCommandContext(".")
+	if err != nil {
+		return nil, nil
+	}
+	var defs []*graph.Def
+	for _, unitFile := range getSourceUnits(context.commitFS, context.repo) {
+		var u *unit.SourceUnit
+		if err := readJSONFileFS(context.commitFS, unitFile, &u); err != nil {
+			return nil, err
+		}
+		if u.Type == DocUnitType {
+			continue
+		}
+		var g graph.Output
+		if err := readJSONFileFS(context.commitFS, plan.SourceUnitDataFilename("graph", u), &g); err != nil {
+			if os.IsNotExist(err) {
+				continue // unit wasn't graphed
+			}
+			return nil, err
+		}
+		for _, def := range g.Defs {
+			if def.UnitType == "" {
+				def.UnitType, def.Unit = u.Type, u.Name
+			}
+			defs = append(defs, def)
+		}
+	}
+	return defs, nil
+}
+
+// A mentionResolver resolves doc.Mentions to the defs they (probably)
+// refer to, by name.
+type mentionResolver struct {
+	byName map[string][]*graph.Def
+}
+
+func newMentionResolver(defs []*graph.Def) *mentionResolver {
+	r := &mentionResolver{byName: map[string][]*graph.Def{}}
+	for _, def := range defs {
+		if def.Local || def.Name == "" {
+			continue
+		}
+		r.byName[def.Name] = append(r.byName[def.Name], def)
+	}
+	return r
+}
+
+// resolve returns the def that m refers to, or nil if there is no
+// such def or if m is ambiguous. Defs whose unit or path don't contain
+// m's qualifiers (in order) are ruled out, and exported defs are
+// preferred to unexported ones.
+func (r *mentionResolver) resolve(m *doc.Mention) *graph.Def {
+	var matches, exported []*graph.Def
+	for _, def := range r.byName[m.Name] {
+		if !qualifiersMatch(m.Qualifiers, def) {
+			continue
+		}
+		matches = append(matches, def)
+		if def.Exported {
+			exported = append(exported, def)
+		}
+	}
+	if len(exported) > 0 {
+		matches = exported
+	}
+	if len(matches) != 1 {
+		return nil
+	}
+	return matches[0]
+}
+
+// qualifiersMatch returns whether the components of def's unit name
+// and path (excluding the last component of the path) contain
+// qualifiers as a subsequence.
+func qualifiersMatch(qualifiers []string, def *graph.Def) bool {
+	if len(qualifiers) == 0 {
+		return true
+	}
+	isSep := func(r rune) bool { return r == '/' || r == '.' }
+	components := strings.FieldsFunc(def.Unit, isSep)
+	if path := strings.FieldsFunc(def.Path, isSep); len(path) > 0 {
+		components = append(components, path[:len(path)-1]...)
+	}
+	for _, c := range components {
+		if c == qualifiers[0] {
+			qualifiers = qualifiers[1:]
+			if len(qualifiers) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
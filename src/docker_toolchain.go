@@ -0,0 +1,136 @@
+package src
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/docker"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// DockerToolchain is the path of the built-in toolchain that graphs
+// Dockerfiles and docker-compose files (see package docker). Images
+// are resolved to their registry repositories (such as
+// "docker.io/library/golang"), and COPY and ADD sources and
+// docker-compose build contexts are linked to the files and
+// Dockerfiles in the repository.
+const DockerToolchain = "sourcegraph.com/sourcegraph/srclib/docker"
+
+func init() {
+	unitTypes := []string{docker.DockerfileUnitType, docker.ComposeUnitType}
+	for _, t := range unitTypes {
+		grapher.RegisterByteOffsetUnitType(t)
+	}
+	toolchain.RegisterBuiltin(DockerToolchain, &toolchain.Builtin{
+		Config: &toolchain.Config{
+			Tools: []*toolchain.ToolInfo{
+				{Subcmd: "scan", Op: "scan"},
+				{Subcmd: "depresolve", Op: "depresolve", SourceUnitTypes: unitTypes},
+				{Subcmd: "graph", Op: "graph", SourceUnitTypes: unitTypes},
+			},
+		},
+		Tools: map[string]toolchain.BuiltinTool{
+			"scan":       dockerScan,
+			"depresolve": dockerDepresolve,
+			"graph":      dockerGraph,
+		},
+	})
+}
+
+// dockerScan is the docker toolchain's scanner. Each Dockerfile and
+// docker-compose file is a source unit, named by its path, whose
+// dependencies are the images it uses.
+func dockerScan(args []string, stdin io.Reader, stdout io.Writer) error {
+	dir, err := readScanInput(args, stdin)
+	if err != nil {
+		return err
+	}
+	files, err := scanFiles(dir, func(file string) bool {
+		return docker.IsDockerfile(file) || docker.IsComposeFile(file)
+	})
+	if err != nil {
+		return err
+	}
+
+	units := []*unit.SourceUnit{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		images, err := docker.Images(file, data)
+		if err != nil {
+			return err
+		}
+		u := &unit.SourceUnit{
+			Name:  file,
+			Type:  docker.DockerfileUnitType,
+			Dir:   path.Dir(file),
+			Files: []string{file},
+		}
+		if docker.IsComposeFile(file) {
+			u.Type = docker.ComposeUnitType
+		}
+		for _, image := range images {
+			u.Dependencies = append(u.Dependencies, image)
+		}
+		units = append(units, u)
+	}
+	return json.NewEncoder(stdout).Encode(units)
+}
+
+// dockerDepresolve is the docker toolchain's dependency resolver. It
+// resolves each image to its registry repository.
+func dockerDepresolve(args []string, stdin io.Reader, stdout io.Writer) error {
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(stdin).Decode(&u); err != nil {
+		return err
+	}
+	res := []*dep.Resolution{}
+	for _, rawDep := range u.Dependencies {
+		r := &dep.Resolution{Raw: rawDep}
+		ref, _ := rawDep.(string)
+		if img, err := docker.ParseImage(ref); err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Target = &dep.ResolvedTarget{
+				ToRepoCloneURL:  "https://" + img.RepoURI(),
+				ToUnit:          img.Repository,
+				ToUnitType:      docker.ImageUnitType,
+				ToVersionString: img.Version(),
+			}
+		}
+		res = append(res, r)
+	}
+	return json.NewEncoder(stdout).Encode(res)
+}
+
+// dockerGraph is the docker toolchain's grapher.
+func dockerGraph(args []string, stdin io.Reader, stdout io.Writer) error {
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(stdin).Decode(&u); err != nil {
+		return err
+	}
+
+	var o graph.Output
+	for _, file := range u.Files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fo, err := docker.Graph(file, data, os.Stat)
+		if err != nil {
+			return err
+		}
+		o.Defs = append(o.Defs, fo.Defs...)
+		o.Refs = append(o.Refs, fo.Refs...)
+	}
+	return json.NewEncoder(stdout).Encode(o)
+}
@@ -0,0 +1,335 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aybabtme/color/brush"
+	"github.com/inconshreveable/go-update/check"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+func init() {
+	_, err := CLI.AddCommand("doctor",
+		"diagnose problems with the srclib environment",
+		`The doctor command checks the environment that src runs in and prints the problems that it finds, along with how to fix them. It checks:
+
+  - that the SRCLIBPATH dirs exist and that the first one (where toolchains are installed) is writable
+  - that the toolchains in the SRCLIBPATH are valid and built, and that their programs can be executed
+  - that Docker is reachable (which is needed only for the Docker execution method, "-m docker", and for toolchains without programs)
+  - that the build data, store, and cache dirs are writable
+  - that src is up to date and that toolchains that are also in the GOPATH are the same version as those in the SRCLIBPATH
+
+It exits with an error if any check failed. Checks that only warn (such as an unreachable Docker when no toolchain needs it) don't cause an error.
+
+With --format table (the default), it prints each check's status and message for people; with --format json, a JSON array of checks; and with --format quiet, nothing (only the exit status).`,
+		&doctorCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type DoctorCmd struct {
+	Format  string `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+	NoCheck bool   `long:"no-check-update" description:"don't check for a newer version of src"`
+}
+
+var doctorCmd DoctorCmd
+
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+)
+
+// A doctorCheck is the result of a check performed by `src doctor`.
+type doctorCheck struct {
+	Name    string
+	Status  string // doctorOK, doctorWarn, or doctorFail
+	Message string
+	Fix     string `json:",omitempty"` // how to fix the problem
+}
+
+// doctorChecks accumulates the results of checks.
+type doctorChecks []*doctorCheck
+
+func (c *doctorChecks) ok(name, format string, args ...interface{}) {
+	*c = append(*c, &doctorCheck{Name: name, Status: doctorOK, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *doctorChecks) warn(name, fix, format string, args ...interface{}) {
+	*c = append(*c, &doctorCheck{Name: name, Status: doctorWarn, Message: fmt.Sprintf(format, args...), Fix: fix})
+}
+
+func (c *doctorChecks) fail(name, fix, format string, args ...interface{}) {
+	*c = append(*c, &doctorCheck{Name: name, Status: doctorFail, Message: fmt.Sprintf(format, args...), Fix: fix})
+}
+
+func (c *DoctorCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+
+	var checks doctorChecks
+	doctorSrclibPath(&checks)
+	needDocker := doctorToolchains(&checks)
+	doctorDocker(&checks, needDocker)
+	doctorDataDirs(&checks)
+	doctorVersions(&checks, !c.NoCheck)
+
+	var failed int
+	for _, ch := range checks {
+		if ch.Status == doctorFail {
+			failed++
+		}
+	}
+	switch format {
+	case formatJSON:
+		PrintJSON(checks, "")
+	case formatTable:
+		for _, ch := range checks {
+			var status string
+			switch ch.Status {
+			case doctorOK:
+				status = brush.Green("[ OK ]").String()
+			case doctorWarn:
+				status = brush.Yellow("[WARN]").String()
+			case doctorFail:
+				status = brush.Red("[FAIL]").String()
+			}
+			fmt.Printf("%s %s: %s\n", status, ch.Name, ch.Message)
+			if ch.Fix != "" {
+				fmt.Printf("       Fix: %s\n", ch.Fix)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// doctorSrclibPath checks the dirs in the SRCLIBPATH.
+func doctorSrclibPath(checks *doctorChecks) {
+	const name = "SRCLIBPATH"
+	dirs := strings.Split(srclib.Path, ":")
+	for i, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			checks.warn(name, "set SRCLIBPATH to absolute paths", "%q is a relative path (resolved against the current dir)", dir)
+		}
+		fi, err := os.Stat(dir)
+		if os.IsNotExist(err) {
+			if i == 0 {
+				checks.fail(name, fmt.Sprintf("run `mkdir -p %s`, then install toolchains with `src toolchain install-std`", dir), "%s does not exist", dir)
+			} else {
+				checks.warn(name, "create it or remove it from SRCLIBPATH", "%s does not exist", dir)
+			}
+			continue
+		} else if err != nil {
+			checks.fail(name, "fix the dir's permissions", "%s: %s", dir, err)
+			continue
+		} else if !fi.IsDir() {
+			checks.fail(name, "remove it from SRCLIBPATH (or replace it with a dir)", "%s is not a dir", dir)
+			continue
+		}
+		if i == 0 {
+			if err := checkDirWritable(dir); err != nil {
+				checks.fail(name, fmt.Sprintf("fix the dir's permissions (such as with `chown -R $USER %s`), since toolchains are installed in it", dir), "%s is not writable: %s", dir, err)
+				continue
+			}
+		}
+		checks.ok(name, "%s", dir)
+	}
+}
+
+// doctorToolchains checks the toolchains in the SRCLIBPATH, and
+// returns whether any of them can only be run in Docker.
+func doctorToolchains(checks *doctorChecks) (needDocker bool) {
+	tcs, err := toolchain.List()
+	if err != nil {
+		checks.fail("toolchains", "fix or remove the toolchain dir named in the error, then run `src toolchain list` to check", "listing toolchains failed: %s", err)
+		return false
+	}
+	var n int
+	for _, tc := range tcs {
+		if tc.Dir == "" {
+			continue // built-in toolchain
+		}
+		n++
+		name := "toolchain " + tc.Path
+		if _, err := tc.ReadConfig(); err != nil {
+			checks.fail(name, fmt.Sprintf("fix %s, or reinstall the toolchain with `src toolchain get -u %s`", filepath.Join(tc.Dir, tc.ConfigFile), tc.Path), "invalid %s: %s", tc.ConfigFile, err)
+			continue
+		}
+		if tc.Program == "" {
+			if tc.Dockerfile == "" {
+				checks.fail(name, fmt.Sprintf("build it with `make -C %s`", tc.Dir), "not built (no program in .bin and no Dockerfile)")
+				continue
+			}
+			needDocker = true
+			checks.ok(name, "no program (runs only in Docker)")
+			continue
+		}
+		prog := filepath.Join(tc.Dir, tc.Program)
+		if err := checkProgramRuns(prog); err != nil {
+			checks.fail(name, fmt.Sprintf("rebuild it with `make -C %s` (and check that the interpreter it needs, if any, is installed)", tc.Dir), "program %s can't be executed: %s", prog, err)
+			continue
+		}
+		checks.ok(name, "%s", prog)
+	}
+	if n == 0 {
+		checks.warn("toolchains", "install toolchains with `src toolchain install-std` (or `src init` in a repository)", "no toolchains are installed in the SRCLIBPATH (only the built-in toolchains are available)")
+	}
+	return needDocker
+}
+
+// checkProgramRuns returns an error if the program can't be started.
+// Its exit status is ignored.
+func checkProgramRuns(prog string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, prog, "--help")
+	if err := cmd.Run(); err != nil {
+		if _, exited := err.(*exec.ExitError); exited && ctx.Err() == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return errors.New("timed out")
+		}
+		return err
+	}
+	return nil
+}
+
+// doctorDocker checks that Docker is reachable. It is a failure only
+// if needDocker is set.
+func doctorDocker(checks *doctorChecks, needDocker bool) {
+	const name = "Docker"
+	report := checks.warn
+	if needDocker {
+		report = checks.fail
+	}
+	if _, err := exec.LookPath("docker"); err != nil && os.Getenv("DOCKER_HOST") == "" {
+		report(name, "install Docker (see https://docs.docker.com/engine/install/) if you use the Docker execution method (-m docker)", "`docker` is not in the PATH and DOCKER_HOST is not set")
+		return
+	}
+	if err := toolchain.PingDocker(); err != nil {
+		report(name, "start the Docker daemon, or set DOCKER_HOST to its address (and check that your user may access its socket)", "Docker is not reachable: %s", err)
+		return
+	}
+	checks.ok(name, "reachable")
+}
+
+// doctorDataDirs checks that the dirs that src writes data to are
+// writable.
+func doctorDataDirs(checks *doctorChecks) {
+	dirs := []struct{ name, dir string }{{"cache", srclib.CacheDir}}
+	if lrepo, err := openLocalRepo(); err == nil && lrepo.RootDir != "" {
+		dirs = append(dirs,
+			struct{ name, dir string }{"build data", filepath.Join(lrepo.RootDir, buildstore.BuildDataDirName)},
+			struct{ name, dir string }{"store", filepath.Join(lrepo.RootDir, store.SrclibStoreDir)},
+		)
+	}
+	for _, d := range dirs {
+		dir := d.dir
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			dir = filepath.Dir(dir) // it will be created
+		}
+		if err := checkDirWritable(dir); err != nil {
+			checks.fail(d.name, fmt.Sprintf("fix the dir's permissions (such as with `sudo chown -R $USER %s`, if it was created by another user or by Docker)", dir), "%s is not writable: %s", dir, err)
+			continue
+		}
+		checks.ok(d.name, "%s", d.dir)
+	}
+}
+
+// checkDirWritable returns an error if a file can't be created in dir.
+func checkDirWritable(dir string) error {
+	f, err := ioutil.TempFile(dir, ".srclib-doctor-")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// doctorVersions checks for a newer version of src (if checkUpdate)
+// and for toolchains whose copies in the GOPATH (which the Go and
+// Python toolchains need, see symlinkToGopath) differ from those in
+// the SRCLIBPATH.
+func doctorVersions(checks *doctorChecks, checkUpdate bool) {
+	const name = "version"
+	switch {
+	case Version == develVersion:
+		checks.ok(name, "src %s (development build; not checking for updates)", Version)
+	case !checkUpdate:
+		checks.ok(name, "src %s", Version)
+	case srclib.Offline:
+		checks.ok(name, "src %s (offline mode; not checking for updates)", Version)
+	default:
+		r, err := checkForUpdate()
+		if err == check.NoUpdateAvailable {
+			checks.ok(name, "src %s (latest)", Version)
+		} else if err != nil {
+			checks.warn(name, "check your network connection, or pass --no-check-update", "src %s; checking for updates failed: %s", Version, err)
+		} else if r != nil {
+			checks.warn(name, "run `src selfupdate`", "src %s is out of date (the latest version is %s)", Version, r.Version)
+		}
+	}
+
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		return
+	}
+	srcDir := filepath.Join(strings.Split(gopath, ":")[0], "src")
+	langs := make([]string, 0, len(stdToolchains))
+	for lang := range stdToolchains {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		installer := stdToolchains[lang]
+		tc, err := toolchain.Lookup(installer.toolchain)
+		if err != nil || tc == nil || tc.Dir == "" {
+			continue
+		}
+		gopathDir := filepath.Join(srcDir, installer.toolchain)
+		a, errA := filepath.EvalSymlinks(gopathDir)
+		b, errB := filepath.EvalSymlinks(tc.Dir)
+		if errA != nil || errB != nil || a == b {
+			continue
+		}
+		revA, errA := gitHead(a)
+		revB, errB := gitHead(b)
+		if errA != nil || errB != nil || revA == revB {
+			continue
+		}
+		checks.warn("toolchain "+installer.toolchain, fmt.Sprintf("remove %s and reinstall the toolchain with `src toolchain install %s`, which symlinks it into the GOPATH", gopathDir, lang), "the copy in the GOPATH (%s, at commit %s) differs from the one in the SRCLIBPATH (%s, at commit %s)", gopathDir, revA, tc.Dir, revB)
+	}
+}
+
+// gitHead returns the commit ID of HEAD in the git repository dir.
+func gitHead(dir string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
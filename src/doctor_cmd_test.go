@@ -0,0 +1,162 @@
+package src
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+)
+
+// checkStatuses returns "name: status" for each check.
+func checkStatuses(checks doctorChecks) []string {
+	var s []string
+	for _, ch := range checks {
+		s = append(s, ch.Name+": "+ch.Status)
+	}
+	return s
+}
+
+// writeDoctorTestFiles writes files (with the given contents and
+// modes) in dir.
+func writeDoctorTestFiles(t *testing.T, dir string, files map[string]string, modes map[string]os.FileMode) {
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		mode, ok := modes[name]
+		if !ok {
+			mode = 0600
+		}
+		if err := ioutil.WriteFile(path, []byte(data), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDoctorSrclibPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-doctor-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeDoctorTestFiles(t, dir, map[string]string{"file": ""}, nil)
+	defer func(orig string) { srclib.Path = orig }(srclib.Path)
+
+	tests := map[string]struct {
+		path string
+		want []string
+	}{
+		"dir":                  {path: dir, want: []string{"SRCLIBPATH: ok"}},
+		"first dir missing":    {path: filepath.Join(dir, "missing") + ":" + dir, want: []string{"SRCLIBPATH: fail", "SRCLIBPATH: ok"}},
+		"other dir missing":    {path: dir + ":" + filepath.Join(dir, "missing"), want: []string{"SRCLIBPATH: ok", "SRCLIBPATH: warn"}},
+		"not a dir":            {path: filepath.Join(dir, "file"), want: []string{"SRCLIBPATH: fail"}},
+		"relative missing dir": {path: dir + ":srclib-doctor-test-missing", want: []string{"SRCLIBPATH: ok", "SRCLIBPATH: warn", "SRCLIBPATH: warn"}},
+	}
+	for label, test := range tests {
+		srclib.Path = test.path
+		var checks doctorChecks
+		doctorSrclibPath(&checks)
+		if got := checkStatuses(checks); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got checks %v, want %v", label, got, test.want)
+		}
+	}
+}
+
+func TestDoctorToolchains(t *testing.T) {
+	tests := map[string]struct {
+		files          map[string]string
+		modes          map[string]os.FileMode
+		want           []string
+		wantNeedDocker bool
+	}{
+		"none": {
+			want: []string{"toolchains: warn"},
+		},
+		"program": {
+			files: map[string]string{"t/ok/Srclibtoolchain": "{}", "t/ok/.bin/ok": "#!/bin/sh\nexit 1\n"},
+			modes: map[string]os.FileMode{"t/ok/.bin/ok": 0700},
+			want:  []string{"toolchain t/ok: ok"},
+		},
+		"program can't be executed": {
+			files: map[string]string{"t/bad/Srclibtoolchain": "{}", "t/bad/.bin/bad": "#!/srclib-doctor-test/missing\n"},
+			modes: map[string]os.FileMode{"t/bad/.bin/bad": 0700},
+			want:  []string{"toolchain t/bad: fail"},
+		},
+		"Docker only": {
+			files:          map[string]string{"t/d/Srclibtoolchain": "{}", "t/d/Dockerfile": ""},
+			want:           []string{"toolchain t/d: ok"},
+			wantNeedDocker: true,
+		},
+		"not built": {
+			files: map[string]string{"t/u/Srclibtoolchain": "{}"},
+			want:  []string{"toolchain t/u: fail"},
+		},
+		"invalid config": {
+			files: map[string]string{"t/c/Srclibtoolchain": "{", "t/c/Dockerfile": ""},
+			want:  []string{"toolchain t/c: fail"},
+		},
+	}
+	defer func(orig string) { srclib.Path = orig }(srclib.Path)
+	for label, test := range tests {
+		dir, err := ioutil.TempDir("", "srclib-doctor-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeDoctorTestFiles(t, dir, test.files, test.modes)
+		srclib.Path = dir
+
+		var checks doctorChecks
+		needDocker := doctorToolchains(&checks)
+		os.RemoveAll(dir)
+		if got := checkStatuses(checks); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got checks %v, want %v", label, got, test.want)
+		}
+		if needDocker != test.wantNeedDocker {
+			t.Errorf("%s: got needDocker %v, want %v", label, needDocker, test.wantNeedDocker)
+		}
+	}
+}
+
+func TestDoctorDocker_notInstalled(t *testing.T) {
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+	os.Setenv("PATH", "")
+	os.Unsetenv("DOCKER_HOST")
+
+	tests := map[string]struct {
+		needDocker bool
+		want       []string
+	}{
+		"not needed": {want: []string{"Docker: warn"}},
+		"needed":     {needDocker: true, want: []string{"Docker: fail"}},
+	}
+	for label, test := range tests {
+		var checks doctorChecks
+		doctorDocker(&checks, test.needDocker)
+		if got := checkStatuses(checks); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got checks %v, want %v", label, got, test.want)
+		}
+	}
+}
+
+func TestCheckDirWritable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-doctor-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := checkDirWritable(dir); err != nil {
+		t.Errorf("got error %v, want nil", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("got %d files left in the dir, want none", len(files))
+	}
+	if err := checkDirWritable(filepath.Join(dir, "missing")); err == nil {
+		t.Error("missing dir: got no error")
+	}
+}
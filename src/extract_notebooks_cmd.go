@@ -0,0 +1,85 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/notebook"
+)
+
+func init() {
+	_, err := CLI.AddCommand("extract-notebooks",
+		"write the code cells of notebooks to virtual source files",
+		`The extract-notebooks command finds the Jupyter (IPython) notebooks (*.ipynb files) in DIR and writes the code cells of each to a virtual source file next to it (named by appending the extension of the notebook's language, e.g., analysis.ipynb.py), so that language toolchains can scan and graph the notebook's code.
+
+To graph the notebooks in a repository, run this command before scanning and map the graph output back to the notebook files with the "notebook" post-processor, by adding the following to the Srcfile:
+
+    {
+      "PreConfigCommands": ["src extract-notebooks"],
+      "PostProcessors": ["notebook"]
+    }
+
+Hidden directories (such as .ipynb_checkpoints) are skipped.`,
+		&extractNotebooksCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type ExtractNotebooksCmd struct {
+	Clean bool `long:"clean" description:"remove the virtual files instead of writing them"`
+
+	Args struct {
+		Dir Directory `name:"DIR" default:"." description:"directory to search for notebooks"`
+	} `positional-args:"yes"`
+}
+
+var extractNotebooksCmd ExtractNotebooksCmd
+
+func (c *ExtractNotebooksCmd) Execute(args []string) error {
+	root := c.Args.Dir.String()
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if path != root && strings.HasPrefix(fi.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !fi.Mode().IsRegular() || filepath.Ext(path) != notebook.Ext {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		nb, err := notebook.Parse(data)
+		if err != nil {
+			return fmt.Errorf("notebook %s: %s", path, err)
+		}
+		vfile := notebook.VirtualFilename(path, nb.Language)
+
+		if c.Clean {
+			if err := os.Remove(vfile); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		}
+		if old, err := ioutil.ReadFile(vfile); err == nil && bytes.Equal(old, nb.Code()) {
+			return nil // up to date
+		}
+		if GlobalOpt.Verbose {
+			log.Printf("Writing %s (%d code cells)", vfile, len(nb.Cells))
+		}
+		return ioutil.WriteFile(vfile, nb.Code(), 0644)
+	})
+}
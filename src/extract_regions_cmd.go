@@ -0,0 +1,90 @@
+package src
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/region"
+)
+
+func init() {
+	_, err := CLI.AddCommand("extract-regions",
+		"write code in embedded languages to virtual source files",
+		`The extract-regions command finds code in embedded languages in the files in DIR (such as JavaScript and CSS in HTML script and style elements, and SQL in string literals) and writes the code of each language in a file to a virtual source file next to it (named by appending the extension of the language, e.g., index.html.js). Virtual files have the same length and line numbers as their host file, with everything except the embedded code replaced by spaces.
+
+To graph the embedded code, run this command before scanning and map each embedded language to the source unit type that graphs it in the Srcfile's EmbeddedLanguages. Virtual sub-units are then created for the embedded code in each source unit, and their graph output is mapped back to the host files:
+
+    {
+      "PreConfigCommands": ["src extract-regions"],
+      "EmbeddedLanguages": {"sql": "SQLSchema"}
+    }
+
+Hidden directories are skipped.`,
+		&extractRegionsCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type ExtractRegionsCmd struct {
+	Clean bool `long:"clean" description:"remove the virtual files instead of writing them"`
+
+	Args struct {
+		Dir Directory `name:"DIR" default:"." description:"directory to search for host files"`
+	} `positional-args:"yes"`
+}
+
+var extractRegionsCmd ExtractRegionsCmd
+
+func (c *ExtractRegionsCmd) Execute(args []string) error {
+	root := c.Args.Dir.String()
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			if path != root && strings.HasPrefix(fi.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		file := filepath.ToSlash(path)
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		if region.HostFilename(file) != "" {
+			// A virtual file.
+			if c.Clean {
+				return os.Remove(path)
+			}
+			return nil
+		}
+		if c.Clean || !region.IsHost(file) {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for lang, rs := range region.Extract(file, data) {
+			vfile := region.VirtualFilename(path, lang)
+			v := region.VirtualFile(data, rs)
+			if old, err := ioutil.ReadFile(vfile); err == nil && bytes.Equal(old, v) {
+				continue // up to date
+			}
+			if GlobalOpt.Verbose {
+				log.Printf("Writing %s (%d %s regions)", vfile, len(rs), lang)
+			}
+			if err := ioutil.WriteFile(vfile, v, 0644); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,108 @@
+package src
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/store/storepb"
+)
+
+// federatedStore returns a store that answers queries from local and
+// then from each of the stores in federate (see StoreCmd.Federate and
+// store.NewFederatedStore).
+func federatedStore(local store.MultiRepoStore, federate []string) (store.MultiRepoStore, error) {
+	members := []store.MultiRepoStore{local}
+	for _, spec := range federate {
+		m, _, err := openFederatedMember(spec)
+		if err != nil {
+			return nil, fmt.Errorf("--federate %s: %s", spec, err)
+		}
+		members = append(members, m)
+	}
+	return store.NewFederatedStore(members...), nil
+}
+
+// openFederatedMember opens the store described by spec: a
+// grpc://[TOKEN@]HOST:PORT or (with TLS, such as through a
+// TLS-terminating proxy) grpcs://[TOKEN@]HOST:PORT URL of a Query
+// server (see ServeCmd), the URL of a multi-repo store of a registered
+// store backend (see store.RegisterBackend), or the root dir of a
+// MultiRepoStore. Stores are opened read-only. For a gRPC server, it
+// also returns the connection, which the caller may close when it no
+// longer uses the store.
+//
+// Tokens are only sent over plaintext (grpc://) connections to the
+// local host, and remote gRPC servers can't be used in offline mode.
+func openFederatedMember(spec string) (store.MultiRepoStore, io.Closer, error) {
+	isGRPC := strings.HasPrefix(spec, "grpc://") || strings.HasPrefix(spec, "grpcs://")
+	if !isGRPC && store.LookupBackend(spec) != nil {
+		s, caps, err := store.OpenURL(spec, store.BackendOptions{ReadOnly: true})
+		if err != nil {
+			return nil, nil, err
+		}
+		mrs, ok := s.(store.MultiRepoStore)
+		if !ok {
+			return nil, nil, fmt.Errorf("store backend's stores aren't MultiRepoStores (its capabilities are %s)", caps)
+		}
+		return mrs, nil, nil
+	}
+	if !isGRPC {
+		return store.NewFSMultiRepoStore(rwvfs.Walkable(rwvfs.ReadOnly(rwvfs.OS(spec))), nil), nil, nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return nil, nil, fmt.Errorf("invalid gRPC store URL (must be %s://[TOKEN@]HOST:PORT)", u.Scheme)
+	}
+	local := srclib.IsLocalHost(u.Hostname())
+	if !local {
+		if err := srclib.CheckOnline("querying the store at " + u.Host); err != nil {
+			return nil, nil, err
+		}
+	}
+	secure := u.Scheme == "grpcs"
+	if u.User != nil && !secure && !local {
+		return nil, nil, fmt.Errorf("refusing to send a token in plaintext to %s (use grpcs://, e.g., through a TLS-terminating proxy)", u.Host)
+	}
+	creds := insecure.NewCredentials()
+	if secure {
+		creds = credentials.NewTLS(&tls.Config{ServerName: u.Hostname()})
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if u.User != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerTokenCredentials{token: u.User.Username(), secure: secure}))
+	}
+	cc, err := grpc.Dial(u.Host, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store.NewGRPCStore(storepb.NewQueryClient(cc), u.Host), cc, nil
+}
+
+// bearerTokenCredentials sends a token as "authorization: Bearer
+// TOKEN" metadata, which the server's ACL checks (see serveACL).
+type bearerTokenCredentials struct {
+	token  string
+	secure bool // whether the connection uses TLS
+}
+
+func (c bearerTokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + c.token}, nil
+}
+
+// RequireTransportSecurity returns whether the connection uses TLS.
+// (openFederatedMember only sends tokens in plaintext to the local
+// host.)
+func (c bearerTokenCredentials) RequireTransportSecurity() bool { return c.secure }
@@ -0,0 +1,41 @@
+package src
+
+import (
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+)
+
+func TestOpenFederatedMember_grpc(t *testing.T) {
+	defer func(offline bool) { srclib.Offline = offline }(srclib.Offline)
+
+	tests := []struct {
+		spec    string
+		offline bool
+		wantErr string
+	}{
+		{spec: "grpc://localhost:3083"},
+		{spec: "grpc://t@localhost:3083"},
+		{spec: "grpc://t@127.0.0.1:3083"},
+		{spec: "grpc://example.com:3083"},
+		{spec: "grpcs://t@example.com:3083"},
+		{spec: "grpc://t@example.com:3083", wantErr: "refusing to send a token in plaintext"},
+		{spec: "grpc://t@localhost:3083", offline: true},
+		{spec: "grpcs://example.com:3083", offline: true, wantErr: "offline"},
+		{spec: "grpc://", wantErr: "invalid gRPC store URL"},
+		{spec: "grpc://localhost:3083/x", wantErr: "invalid gRPC store URL"},
+	}
+	for _, test := range tests {
+		srclib.Offline = test.offline
+		_, cc, err := openFederatedMember(test.spec)
+		if cc != nil {
+			cc.Close()
+		}
+		if test.wantErr == "" && err != nil {
+			t.Errorf("%s (offline %v): %s", test.spec, test.offline, err)
+		} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("%s (offline %v): got error %v, want %q", test.spec, test.offline, err, test.wantErr)
+		}
+	}
+}
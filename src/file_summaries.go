@@ -0,0 +1,20 @@
+package src
+
+import (
+	"fmt"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+// openFileSummaries returns the file summaries of the commit (and, for
+// multi-repo stores, repo) from stor.
+func openFileSummaries(stor interface{}, repo, commitID string) ([]*graph.FileSummary, error) {
+	switch s := stor.(type) {
+	case store.RepoFileSummarizer:
+		return s.FileSummaries(commitID)
+	case store.MultiRepoFileSummarizer:
+		return s.FileSummaries(repo, commitID)
+	}
+	return nil, fmt.Errorf("store (type %T) does not implement file summaries", stor)
+}
@@ -0,0 +1,233 @@
+package src
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+func init() {
+	_, err := CLI.AddCommand("init",
+		"detect languages and write a starter Srcfile",
+		`The init command sets up srclib for the repository containing DIR (or the current directory if not specified). It detects the languages of the files in the repository, suggests the standard toolchains for them (and offers to install those that aren't installed), and writes a starter Srcfile in the repository's root directory that uses the toolchains' scanners and skips common build output and third-party dirs.
+
+When run in a terminal, it asks before installing toolchains and before overwriting an existing Srcfile. To run it non-interactively (such as in a script), pass -y to answer yes to all questions, or --install to install the missing toolchains without asking.`,
+		&initCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type InitCmd struct {
+	Yes     bool `short:"y" long:"yes" description:"answer yes to all questions (install missing toolchains and overwrite any existing Srcfile)"`
+	Install bool `long:"install" description:"install the missing toolchains for the detected languages"`
+	Force   bool `short:"f" long:"force" description:"overwrite any existing Srcfile"`
+	DryRun  bool `short:"n" long:"dry-run" description:"print the Srcfile instead of writing it, and don't install toolchains"`
+
+	Args struct {
+		Dir Directory `name:"DIR" default:"." description:"directory in the repository"`
+	} `positional-args:"yes"`
+}
+
+var initCmd InitCmd
+
+// initSkipDirs are the names of dirs that usually contain build
+// output or third-party code. `src init` adds skip patterns for those
+// that exist in the repository (in addition to
+// config.DefaultSkipPatterns).
+var initSkipDirs = []string{"dist", "target", "coverage", "third_party", "__pycache__", "site-packages"}
+
+func (c *InitCmd) Execute(args []string) error {
+	rootDir, _, err := getRootDir(c.Args.Dir.String())
+	if err != nil {
+		return err
+	}
+	if rootDir == "" {
+		if rootDir, err = filepath.Abs(c.Args.Dir.String()); err != nil {
+			return err
+		}
+	}
+	stdin := bufio.NewReader(os.Stdin)
+	interactive := isTerminal(os.Stdin) && !c.Yes && !c.DryRun
+	confirm := func(question string, yes bool) bool {
+		if yes || c.Yes {
+			return true
+		}
+		if !interactive {
+			return false
+		}
+		fmt.Printf("%s [y/N] ", question)
+		answer, _ := stdin.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	}
+
+	langs, skipPatterns, err := detectInitLanguages(rootDir)
+	if err != nil {
+		return err
+	}
+	if len(langs) == 0 {
+		return fmt.Errorf("no source files in a known language found in %s", rootDir)
+	}
+
+	var cfg config.Repository
+	cfg.SkipPatterns = skipPatterns
+	var installers []toolchainInstaller
+	for _, lang := range sortedInitLanguages(langs) {
+		installer, ok := stdToolchains[lang]
+		if !ok {
+			fmt.Printf("Detected %s (%d files), which has no standard toolchain.\n", lang, langs[lang])
+			continue
+		}
+		tc, err := toolchain.Lookup(installer.toolchain)
+		installed := err == nil && tc != nil
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		status := "installed"
+		if !installed {
+			status = "not installed"
+		}
+		fmt.Printf("Detected %s (%d files): toolchain %s (%s).\n", lang, langs[lang], installer.toolchain, status)
+
+		if !installed && !c.DryRun && confirm(fmt.Sprintf("Install the %s toolchain?", installer.name), c.Install) {
+			installers = append(installers, installer)
+		}
+		cfg.Scanners = append(cfg.Scanners, &srclib.ToolRef{Toolchain: installer.toolchain, Subcmd: scanSubcmd(tc)})
+	}
+	if len(installers) > 0 {
+		if err := installToolchains(installers); err != nil {
+			return err
+		}
+	}
+
+	if len(cfg.Scanners) == 0 {
+		logutil.Default.Warn("No standard toolchains for the detected languages; add Scanners (or SourceUnits) to the " + config.Filename + ".")
+	}
+	data, err := json.MarshalIndent(&cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if c.DryRun {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	file := filepath.Join(rootDir, config.Filename)
+	if _, err := os.Stat(file); err == nil {
+		if !confirm(fmt.Sprintf("Overwrite the existing %s?", file), c.Force) {
+			return fmt.Errorf("%s already exists (use --force to overwrite it)", file)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := ioutil.WriteFile(file, data, 0666); err != nil {
+		return err
+	}
+	log.Printf("Wrote %s. Run `src config lint` to check it after editing, and `src make` to build.", file)
+	return nil
+}
+
+// detectInitLanguages walks the tree rooted at rootDir and returns the
+// number of files in each language (see grapher.FileLanguage), and skip
+// patterns for the initSkipDirs that it found. Dirs that the
+// DefaultSkipPatterns match and hidden dirs are not walked.
+func detectInitLanguages(rootDir string) (langs map[string]int, skipPatterns []string, err error) {
+	langs = map[string]int{}
+	skipDirs := map[string]bool{}
+	for _, name := range initSkipDirs {
+		skipDirs[name] = true
+	}
+	found := map[string]bool{}
+	err = filepath.Walk(rootDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			if strings.HasPrefix(fi.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if _, skip := config.MatchSkipPatterns(config.DefaultSkipPatterns, rel, true); skip {
+				return filepath.SkipDir
+			}
+			if skipDirs[fi.Name()] {
+				found[fi.Name()] = true
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if _, skip := config.MatchSkipPatterns(config.DefaultSkipPatterns, rel, false); skip {
+			return nil
+		}
+		if lang := grapher.FileLanguage(fi.Name()); lang != "" {
+			langs[lang]++
+		}
+		return nil
+	})
+	for _, name := range initSkipDirs {
+		if found[name] {
+			skipPatterns = append(skipPatterns, name+"/")
+		}
+	}
+	return langs, skipPatterns, err
+}
+
+// sortedInitLanguages returns the languages in langs, most files
+// first.
+func sortedInitLanguages(langs map[string]int) []string {
+	sorted := make([]string, 0, len(langs))
+	for lang := range langs {
+		sorted = append(sorted, lang)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if langs[sorted[i]] != langs[sorted[j]] {
+			return langs[sorted[i]] > langs[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
+// scanSubcmd returns the subcommand of the toolchain's scanner ("scan"
+// by convention, which is also assumed if the toolchain is not
+// installed).
+func scanSubcmd(tc *toolchain.Info) string {
+	if tc != nil {
+		if cfg, err := tc.ReadConfig(); err == nil {
+			for _, tool := range cfg.Tools {
+				if tool.Op == "scan" {
+					return tool.Subcmd
+				}
+			}
+		}
+	}
+	return "scan"
+}
+
+// isTerminal returns whether f is a terminal (character device).
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,145 @@
+package src
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+)
+
+// writeInitTestTree writes the named files (with empty contents) in a
+// new temp dir that is the root of a (fake) git repository, and
+// returns the dir.
+func writeInitTestTree(t *testing.T, files []string) string {
+	dir, err := ioutil.TempDir("", "srclib-init-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range append([]string{".git/HEAD"}, files...) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDetectInitLanguages(t *testing.T) {
+	tests := map[string]struct {
+		files            []string
+		wantLangs        map[string]int
+		wantSkipPatterns []string
+	}{
+		"empty": {
+			wantLangs: map[string]int{},
+		},
+		"languages": {
+			files:     []string{"a.go", "b/b.go", "b/c.py", "README.md", "Makefile"},
+			wantLangs: map[string]int{"go": 2, "python": 1},
+		},
+		"default skip patterns": {
+			files:     []string{"a.go", "vendor/x/x.go", "node_modules/m/m.js", "a.pb.go", "b.min.js"},
+			wantLangs: map[string]int{"go": 1},
+		},
+		"hidden dirs": {
+			files:     []string{"a.go", ".cache/x.go", "b/.hidden/y.go"},
+			wantLangs: map[string]int{"go": 1},
+		},
+		"skip dirs": {
+			files:            []string{"a.py", "target/x.java", "b/__pycache__/y.py", "dist/z.js", "distro/d.js"},
+			wantLangs:        map[string]int{"python": 1, "javascript": 1},
+			wantSkipPatterns: []string{"dist/", "target/", "__pycache__/"},
+		},
+	}
+	for label, test := range tests {
+		dir := writeInitTestTree(t, test.files)
+		langs, skipPatterns, err := detectInitLanguages(dir)
+		os.RemoveAll(dir)
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if !reflect.DeepEqual(langs, test.wantLangs) {
+			t.Errorf("%s: got langs %v, want %v", label, langs, test.wantLangs)
+		}
+		if !reflect.DeepEqual(skipPatterns, test.wantSkipPatterns) {
+			t.Errorf("%s: got skip patterns %q, want %q", label, skipPatterns, test.wantSkipPatterns)
+		}
+	}
+}
+
+func TestSortedInitLanguages(t *testing.T) {
+	tests := map[string]struct {
+		langs map[string]int
+		want  []string
+	}{
+		"none":          {langs: map[string]int{}, want: []string{}},
+		"by file count": {langs: map[string]int{"go": 1, "python": 3, "ruby": 2}, want: []string{"python", "ruby", "go"}},
+		"ties by name":  {langs: map[string]int{"ruby": 2, "go": 2, "c": 5}, want: []string{"c", "go", "ruby"}},
+	}
+	for label, test := range tests {
+		if got := sortedInitLanguages(test.langs); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", label, got, test.want)
+		}
+	}
+}
+
+func TestInitCmd_srcfile(t *testing.T) {
+	if isTerminal(os.Stdin) {
+		t.Skip("stdin is a terminal, so init would ask before overwriting")
+	}
+	// C has no standard toolchain, so no toolchains are looked up or
+	// installed.
+	dir := writeInitTestTree(t, []string{"a.c", "b/b.h", "target/t.c"})
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, config.Filename)
+
+	tests := []struct {
+		label   string
+		cmd     InitCmd
+		wantErr bool
+	}{
+		{label: "new Srcfile", cmd: InitCmd{}},
+		{label: "existing Srcfile", cmd: InitCmd{}, wantErr: true},
+		{label: "existing Srcfile with --force", cmd: InitCmd{Force: true}},
+	}
+	for _, test := range tests {
+		if _, err := os.Stat(file); err == nil {
+			if err := ioutil.WriteFile(file, []byte("{}"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		c := test.cmd
+		c.Args.Dir = Directory(filepath.Join(dir, "b"))
+		err := c.Execute(nil)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error %v", test.label, err, test.wantErr)
+			continue
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.wantErr {
+			if string(data) != "{}" {
+				t.Errorf("%s: got Srcfile %q, want it unchanged", test.label, data)
+			}
+			continue
+		}
+		var cfg config.Repository
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			t.Fatalf("%s: %s", test.label, err)
+		}
+		if want := []string{"target/"}; !reflect.DeepEqual(cfg.SkipPatterns, want) || len(cfg.Scanners) != 0 {
+			t.Errorf("%s: got Srcfile %s, want one with skip patterns %q and no scanners", test.label, data, want)
+		}
+	}
+}
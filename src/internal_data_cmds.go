@@ -1,12 +1,25 @@
 package src
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
+	"sourcegraph.com/sourcegraph/srclib/config"
 	"sourcegraph.com/sourcegraph/srclib/graph"
 	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/jsonutil"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/tracing"
+	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
 func init() {
@@ -19,15 +32,177 @@ func init() {
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	_, err = c.AddCommand("unit-variant", "", "", &unitVariantCmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = c.AddCommand("builtin-tool", "", "", &builtinToolCmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = c.AddCommand("verify-determinism", "", "", &verifyDeterminismCmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = c.AddCommand("canonicalize-json", "", "", &canonicalizeJSONCmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// CanonicalizeJSONCmd reads a JSON value (on stdin) and writes its
+// canonical encoding (see package jsonutil) on stdout. Build rules
+// whose tool output isn't normalized by srclib pipe it through this
+// command so that all build data files are canonical.
+type CanonicalizeJSONCmd struct{}
+
+var canonicalizeJSONCmd CanonicalizeJSONCmd
+
+func (c *CanonicalizeJSONCmd) Execute(args []string) error {
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	data, err = jsonutil.Canonicalize(data)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(data, '\n'))
+	return err
+}
+
+// VerifyDeterminismCmd compares the outputs of 2 runs of the same
+// graph rule (see plan.Options.VerifyDeterminism). If they're
+// identical, it removes the second; otherwise, it removes both (so
+// that the nondeterministic output isn't used or cached) and fails.
+type VerifyDeterminismCmd struct {
+	Args struct {
+		File  string `name:"FILE"`
+		Check string `name:"CHECK-FILE"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var verifyDeterminismCmd VerifyDeterminismCmd
+
+func (c *VerifyDeterminismCmd) Execute(args []string) error {
+	a, err := ioutil.ReadFile(c.Args.File)
+	if err != nil {
+		return err
+	}
+	b, err := ioutil.ReadFile(c.Args.Check)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(a, b) {
+		return os.Remove(c.Args.Check)
+	}
+
+	offset, contextA, contextB := firstDifference(a, b)
+	for _, file := range []string{c.Args.File, c.Args.Check} {
+		if err := os.Remove(file); err != nil {
+			logutil.Default.Warn("Failed to remove file.", "file", file, "err", err)
+		}
+	}
+	return fmt.Errorf("graph output %s is nondeterministic: 2 runs' normalized outputs first differ at byte %d:\n  run 1: %s\n  run 2: %s", c.Args.File, offset, contextA, contextB)
+}
+
+// differenceContext is the number of bytes of context around the
+// first difference that firstDifference returns. (Build data files
+// are canonical JSON on a single line, so a line of context could be
+// the entire file.)
+const differenceContext = 60
+
+// firstDifference returns the offset of the first byte that differs
+// between a and b, and the bytes around that offset in each.
+func firstDifference(a, b []byte) (offset int, contextA, contextB string) {
+	for offset < len(a) && offset < len(b) && a[offset] == b[offset] {
+		offset++
+	}
+	contextAt := func(data []byte) string {
+		if offset >= len(data) {
+			return "(end of output)"
+		}
+		start, end := offset-differenceContext/2, offset+differenceContext/2
+		if start < 0 {
+			start = 0
+		}
+		if end > len(data) {
+			end = len(data)
+		}
+		return strings.TrimSpace(string(data[start:end]))
+	}
+	return offset, contextAt(a), contextAt(b)
+}
+
+// UnitVariantCmd reads a source unit (on stdin) and writes the source
+// unit configured for one of its variants (on stdout), for tools to
+// read.
+type UnitVariantCmd struct {
+	Variant string `long:"variant" description:"name of source unit variant" required:"yes"`
+}
+
+var unitVariantCmd UnitVariantCmd
+
+func (c *UnitVariantCmd) Execute(args []string) error {
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(os.Stdin).Decode(&u); err != nil {
+		return err
+	}
+	for _, v := range u.Variants {
+		if v.Name == c.Variant {
+			return json.NewEncoder(os.Stdout).Encode(u.Variant(v, false))
+		}
+	}
+	return fmt.Errorf("source unit %s %s has no variant %q", u.Type, u.Name, c.Variant)
+}
+
+// BuiltinToolCmd runs a tool in a built-in toolchain (see
+// toolchain.BuiltinArgs).
+type BuiltinToolCmd struct {
+	Args struct {
+		Toolchain string   `name:"TOOLCHAIN"`
+		Tool      string   `name:"TOOL"`
+		ToolArgs  []string `name:"ARGS"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var builtinToolCmd BuiltinToolCmd
+
+func (c *BuiltinToolCmd) Execute(args []string) error {
+	return toolchain.RunBuiltinTool(c.Args.Toolchain, c.Args.Tool, c.Args.ToolArgs, os.Stdin, os.Stdout)
 }
 
 type NormalizeGraphDataCmd struct {
 	UnitType string `long:"unit-type" description:"source unit type (e.g., GoPackage)"`
+	Unit     string `long:"unit" description:"source unit name (used to identify the source unit in log records)"`
 	Dir      string `long:"dir" description:"directory of source unit (SourceUnit.Dir field)"`
+	FoldCase bool   `long:"fold-case" description:"lowercase all file paths (for repositories on case-insensitive filesystems)"`
+	Symlinks string `long:"symlinks" description:"how to treat symlinked files (follow within repo, ignore, or error)" value-name:"follow|ignore|error"`
+
+	Strict bool `long:"strict" description:"fail (instead of recording a warning in the output) when a file that the output refers to is missing, unreadable, or doesn't contain the output's offsets"`
+
+	ResolveVanityURIs bool `long:"resolve-vanity-uris" description:"resolve refs' repository URIs on vanity domains (e.g., gopkg.in) to the repositories that host them"`
+
+	PostProcess []string `long:"post-process" description:"run post-processor on the output after normalizing it (repeatable)" value-name:"exec:PROGRAM|plugin:PATH|NAME"`
 }
 
 var normalizeGraphDataCmd NormalizeGraphDataCmd
 
+// vanityCacheDir is the directory where resolved vanity URIs are
+// cached (see grapher.VanityResolver), which is shared by all
+// repositories' builds.
+func vanityCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "srclib", "vanity-uris")
+}
+
 func (c *NormalizeGraphDataCmd) Execute(args []string) error {
 	in := os.Stdin
 
@@ -40,14 +215,44 @@ func (c *NormalizeGraphDataCmd) Execute(args []string) error {
 	if err != nil {
 		return err
 	}
-	if err := grapher.NormalizeData(localRepo.URI(), c.UnitType, c.Dir, o); err != nil {
+	opt := grapher.NormalizeOptions{
+		FoldCase:      c.FoldCase,
+		SymlinkPolicy: config.SymlinkPolicy(c.Symlinks),
+		Strict:        c.Strict,
+		Logger:        logutil.ForUnit(nil, localRepo.URI(), c.UnitType, c.Unit),
+	}
+	if c.ResolveVanityURIs {
+		opt.Vanity = &grapher.VanityResolver{CacheDir: vanityCacheDir()}
+	}
+	_, span := tracing.Start(withParentTrace(context.Background()), "normalize", "unit_type", c.UnitType)
+	err = grapher.NormalizeDataWithOptions(localRepo.URI(), c.UnitType, c.Dir, o, opt)
+	span.End(err)
+	if err != nil {
+		var oe *grapher.OutputError
+		if errors.As(err, &oe) {
+			oe.Unit = c.Unit
+		}
 		return err
 	}
 
-	data, err := json.MarshalIndent(o, "", "  ")
+	if len(c.PostProcess) > 0 {
+		ps := make([]grapher.PostProcessor, len(c.PostProcess))
+		for i, spec := range c.PostProcess {
+			ps[i], err = grapher.OpenPostProcessor(spec)
+			if err != nil {
+				return err
+			}
+		}
+		if err := grapher.PostProcessData(withParentTrace(context.Background()), ps, c.UnitType, c.Unit, c.Dir, o); err != nil {
+			return err
+		}
+	}
+
+	data, err := jsonutil.Marshal(o)
 	if err != nil {
 		return err
 	}
+	data = append(data, '\n')
 
 	if _, err := os.Stdout.Write(data); err != nil {
 		return err
@@ -27,6 +27,8 @@ func init() {
 
 * Refs, defs, and source units whose 'Files' and/or 'Dir' fields do not exist in the repository
 
+* (With --check-spans) Defs whose name does not occur within (or adjacent to) their DefStart-DefEnd span in the file, which usually indicates that the grapher emitted off-by-one or stale offsets
+
 Note that the lint command operates on single files at a time, so it can't detect cross-source-unit or cross-repo ref resolution errors (only those on refs to defs in the same source unit).
 
 If no PATHs are specified, the current directory is used. If a PATH is a directory, it is traversed recursively for files named with any of the above suffixes.
@@ -47,6 +49,7 @@ type LintCmd struct {
 
 	NoCheckFiles   bool `long:"no-check-files" description:"don't check that file/dir fields refer to actual files"`
 	NoCheckResolve bool `long:"no-check-resolve" description:"don't check that internal refs resolve to existing defs"`
+	CheckSpans     bool `long:"check-spans" description:"check that each def's name occurs within (or adjacent to) its span in the file (requires the files to exist)"`
 
 	Args struct {
 		Paths []string `name:"PATH" description:"path to srclib JSON output file, or a directory tree of such"`
@@ -134,6 +137,7 @@ func (c *LintCmd) Execute(args []string) error {
 					}
 
 					checkFilesExist := !c.NoCheckFiles
+					checkSpans := c.CheckSpans && checkFilesExist
 
 					wg.Add(1)
 					go func(path string) {
@@ -145,7 +149,7 @@ func (c *LintCmd) Execute(args []string) error {
 						case unit.SourceUnit:
 							issues, err = lintSourceUnit(lrepo.RootDir, path, checkFilesExist)
 						case *graph.Output:
-							issues, err = lintGraphOutput(lrepo.RootDir, c.Repo, unitType, unitName, path, checkFilesExist)
+							issues, err = lintGraphOutput(lrepo.RootDir, c.Repo, unitType, unitName, path, checkFilesExist, checkSpans)
 						case []*dep.ResolvedDep:
 							issues, err = lintDepresolveOutput(lrepo.RootDir, path, checkFilesExist)
 						}
@@ -222,7 +226,7 @@ func lintSourceUnit(baseDir, path string, checkFilesExist bool) (issues []string
 	return issues, nil
 }
 
-func lintGraphOutput(baseDir, repoURI, unitType, unitName, path string, checkFilesExist bool) (issues []string, err error) {
+func lintGraphOutput(baseDir, repoURI, unitType, unitName, path string, checkFilesExist, checkSpans bool) (issues []string, err error) {
 	var o graph.Output
 	if err := readJSONFile(path, &o); err != nil {
 		return nil, err
@@ -299,6 +303,9 @@ func lintGraphOutput(baseDir, repoURI, unitType, unitName, path string, checkFil
 	addMultiErrorAsIssues(grapher.ValidateDefs(o.Defs))
 	addMultiErrorAsIssues(grapher.ValidateRefs(o.Refs))
 	addMultiErrorAsIssues(grapher.ValidateDocs(o.Docs))
+	if checkSpans {
+		addMultiErrorAsIssues(grapher.ValidateDefSpans(baseDir, o.Defs))
+	}
 
 	// TODO(sqs): check that docs point to valid defs in the same source unit
 
@@ -0,0 +1,70 @@
+package src
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+)
+
+func init() {
+	logutil.Default = slog.New(newCLILogHandler())
+}
+
+// cliLogHandler is a slog.Handler that writes to stderr in the format
+// and at the level given by the global --log-format, --log-level, and
+// -v flags. It consults the flags when each record is logged (not when
+// the handler is created), so it may be installed before the command
+// line is parsed.
+type cliLogHandler struct {
+	text, json slog.Handler
+}
+
+func newCLILogHandler() *cliLogHandler {
+	opt := &slog.HandlerOptions{Level: slog.LevelDebug}
+	return &cliLogHandler{
+		text: slog.NewTextHandler(os.Stderr, opt),
+		json: slog.NewJSONHandler(os.Stderr, opt),
+	}
+}
+
+func (h *cliLogHandler) handler() slog.Handler {
+	if GlobalOpt.LogFormat == "json" {
+		return h.json
+	}
+	return h.text
+}
+
+// logLevel returns the minimum level of records to log.
+func logLevel() slog.Level {
+	if GlobalOpt.Verbose {
+		return slog.LevelDebug
+	}
+	switch strings.ToLower(GlobalOpt.LogLevel) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+func (h *cliLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= logLevel()
+}
+
+func (h *cliLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.handler().Handle(ctx, r)
+}
+
+func (h *cliLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &cliLogHandler{text: h.text.WithAttrs(attrs), json: h.json.WithAttrs(attrs)}
+}
+
+func (h *cliLogHandler) WithGroup(name string) slog.Handler {
+	return &cliLogHandler{text: h.text.WithGroup(name), json: h.json.WithGroup(name)}
+}
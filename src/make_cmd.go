@@ -1,10 +1,14 @@
 package src
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"sourcegraph.com/sourcegraph/makex"
 
@@ -13,13 +17,18 @@ import (
 	"sourcegraph.com/sourcegraph/srclib/buildstore"
 	"sourcegraph.com/sourcegraph/srclib/config"
 	"sourcegraph.com/sourcegraph/srclib/flagutil"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/metrics"
 	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/tracing"
 )
 
 func init() {
 	c, err := CLI.AddCommand("make",
 		"plans and executes plan",
-		`Generates a plan (in Makefile form, in memory) for analyzing the tree and executes the plan. `,
+		`Generates a plan (in Makefile form, in memory) for analyzing the tree and executes the plan.
+
+With --workspace FILE, the local repository checkouts listed in the workspace config FILE (JSON; see config.Workspace) are configured and built in turn, and their build data is imported into one MultiRepoStore (the workspace's Store dir, default .srclib-store next to FILE), so that refs from one of the repositories to defs in another resolve among them. Refs to a repository's Aliases (such as the upstream repository of a fork) are imported as refs to the repository. Query the store with 'src store --type MultiRepoStore --root DIR ...'.`,
 		&makeCmd,
 	)
 	if err != nil {
@@ -41,6 +50,10 @@ type MakeCmd struct {
 
 	Dir Directory `short:"C" long:"directory" description:"change to DIR before doing anything" value-name:"DIR"`
 
+	Metrics string `long:"metrics" description:"write build metrics (in Prometheus text format), including the results of the tool runs of its recipes, to FILE after running" value-name:"FILE"`
+
+	Workspace string `long:"workspace" description:"build the local repos listed in the workspace config FILE (see Srcworkspace) together, and import them into the workspace's MultiRepoStore" value-name:"FILE"`
+
 	Args struct {
 		Goals []string `name:"GOALS..." description:"Makefile targets to build (default: all)"`
 	} `positional-args:"yes"`
@@ -48,14 +61,26 @@ type MakeCmd struct {
 
 var makeCmd MakeCmd
 
-func (c *MakeCmd) Execute(args []string) error {
+func (c *MakeCmd) Execute(args []string) (err error) {
 	if c.Dir != "" {
 		if err := os.Chdir(c.Dir.String()); err != nil {
 			return err
 		}
 	}
 
+	if c.Workspace != "" {
+		return c.makeWorkspace()
+	}
+
+	ctx, span := tracing.Start(withParentTrace(context.Background()), "make")
+	defer func() { span.End(err) }()
+
+	_, planSpan := tracing.Start(ctx, "plan")
 	mf, err := CreateMakefile(c.ToolchainExecOpt, c.BuildCacheOpt)
+	if err == nil {
+		planSpan.SetAttributes("rules", len(mf.Rules))
+	}
+	planSpan.End(err)
 	if err != nil {
 		return err
 	}
@@ -80,7 +105,105 @@ func (c *MakeCmd) Execute(args []string) error {
 	if c.DryRun {
 		return mk.DryRun(os.Stdout)
 	}
-	return mk.Run()
+
+	recordBuildCacheMetrics(mf)
+
+	// Make the recipes' src subprocesses record their spans as
+	// children of this one.
+	setTraceEnv(ctx)
+
+	// Make the recipes' "src tool" subprocesses write their metrics
+	// (such as toolchain failures) where this process can merge them.
+	var subprocessMetricsDir string
+	if c.Metrics != "" {
+		subprocessMetricsDir, err = ioutil.TempDir("", "srclib-metrics")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(subprocessMetricsDir)
+		os.Setenv(metricsDirEnv, subprocessMetricsDir)
+		defer os.Unsetenv(metricsDirEnv)
+	}
+
+	start := time.Now()
+	err = mk.Run()
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	metrics.Observe("srclib_make_duration_seconds", time.Since(start), "result", result)
+	if err == nil {
+		if err := writeBuildProvenance(mf); err != nil {
+			logutil.Default.Warn("Failed to write build provenance.", "err", err)
+		}
+	}
+	if !c.Quiet {
+		if warnings, err := makefileWarnings(mf); err != nil {
+			logutil.Default.Warn("Failed to read graph output warnings.", "err", err)
+		} else {
+			printWarnings(os.Stderr, warnings, GlobalOpt.Verbose)
+		}
+	}
+	if c.Metrics != "" {
+		if err := mergeSubprocessMetrics(subprocessMetricsDir); err != nil {
+			logutil.Default.Warn("Failed to read metrics of tool runs.", "err", err)
+		}
+		if err := metrics.WriteFile(c.Metrics); err != nil {
+			logutil.Default.Warn("Failed to write metrics.", "file", c.Metrics, "err", err)
+		}
+	}
+	return err
+}
+
+func init() {
+	metrics.Describe("srclib_build_cache_total", "Number of build targets that were up to date (hit) or needed to be built (miss).")
+	metrics.Describe("srclib_make_duration_seconds", "Duration of `src make` runs, in seconds.")
+}
+
+// metricsDirEnv is the environment variable that "src make --metrics"
+// sets to the directory in which its recipes' "src tool" subprocesses
+// write their metrics (see writeSubprocessMetrics).
+const metricsDirEnv = "SRCLIB_METRICS_DIR"
+
+// writeSubprocessMetrics writes this process's metrics to a file in
+// the directory named by $SRCLIB_METRICS_DIR (if set), for the "src
+// make" process that ran it to merge (see mergeSubprocessMetrics).
+func writeSubprocessMetrics() {
+	dir := os.Getenv(metricsDirEnv)
+	if dir == "" {
+		return
+	}
+	if err := metrics.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.prom", os.Getpid()))); err != nil {
+		logutil.Default.Warn("Failed to write metrics.", "dir", dir, "err", err)
+	}
+}
+
+// mergeSubprocessMetrics merges the metrics files that subprocesses
+// wrote in dir into the Default metrics registry.
+func mergeSubprocessMetrics(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.prom"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := metrics.MergeFile(file); err != nil {
+			return fmt.Errorf("%s: %s", filepath.Base(file), err)
+		}
+	}
+	return nil
+}
+
+// recordBuildCacheMetrics counts the targets in mf that are already
+// up to date (i.e., exist and are newer than all of their prereqs),
+// which are cache hits that will not be rebuilt.
+func recordBuildCacheMetrics(mf *makex.Makefile) {
+	for _, rule := range mf.Rules {
+		result := "miss"
+		if plan.TargetUpToDate(rule) {
+			result = "hit"
+		}
+		metrics.Inc("srclib_build_cache_total", "result", result)
+	}
 }
 
 // CreateMakefile creates a Makefile to build a tree. The cwd should
@@ -112,8 +235,11 @@ func CreateMakefile(execOpt ToolchainExecOpt, cacheOpt BuildCacheOpt) (*makex.Ma
 	// TODO(sqs): buildDataDir is hardcoded.
 	buildDataDir := filepath.Join(buildstore.BuildDataDirName, localRepo.CommitID)
 	mf, err := plan.CreateMakefile(buildDataDir, buildStore, localRepo.VCSType, treeConfig, plan.Options{
-		ToolchainExecOpt: strings.Join(toolchainExecOptArgs, " "),
-		NoCache:          cacheOpt.NoCacheWrite,
+		ToolchainExecOpt:  strings.Join(toolchainExecOptArgs, " "),
+		NoCache:           cacheOpt.NoCacheWrite || cacheOpt.VerifyDeterminism, // cached outputs aren't regraphed
+		VerifyDeterminism: cacheOpt.VerifyDeterminism,
+		ReuseCommitID:     cacheOpt.ReuseCommit,
+		Strict:            cacheOpt.Strict,
 	})
 	if err != nil {
 		return nil, err
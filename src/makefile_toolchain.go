@@ -0,0 +1,86 @@
+package src
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/makefile"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// MakefileToolchain is the path of the built-in toolchain that graphs
+// Makefiles (see package makefile). Targets and variables are defs,
+// and prerequisites, variable references, and the files in the
+// repository that recipes run are refs.
+const MakefileToolchain = "sourcegraph.com/sourcegraph/srclib/makefile"
+
+func init() {
+	grapher.RegisterByteOffsetUnitType(makefile.UnitType)
+	toolchain.RegisterBuiltin(MakefileToolchain, &toolchain.Builtin{
+		Config: &toolchain.Config{
+			Tools: []*toolchain.ToolInfo{
+				{Subcmd: "scan", Op: "scan"},
+				{Subcmd: "depresolve", Op: "depresolve", SourceUnitTypes: []string{makefile.UnitType}},
+				{Subcmd: "graph", Op: "graph", SourceUnitTypes: []string{makefile.UnitType}},
+			},
+		},
+		Tools: map[string]toolchain.BuiltinTool{
+			"scan":       makefileScan,
+			"depresolve": noDepresolve, // Makefiles have no external dependencies
+			"graph":      makefileGraph,
+		},
+	})
+}
+
+// makefileScan is the Makefile toolchain's scanner. Each Makefile is a
+// source unit, named by its path.
+func makefileScan(args []string, stdin io.Reader, stdout io.Writer) error {
+	dir, err := readScanInput(args, stdin)
+	if err != nil {
+		return err
+	}
+	files, err := scanFiles(dir, makefile.IsMakefile)
+	if err != nil {
+		return err
+	}
+
+	units := make([]*unit.SourceUnit, len(files))
+	for i, file := range files {
+		units[i] = &unit.SourceUnit{
+			Name:  file,
+			Type:  makefile.UnitType,
+			Dir:   path.Dir(file),
+			Files: []string{file},
+		}
+	}
+	return json.NewEncoder(stdout).Encode(units)
+}
+
+// makefileGraph is the Makefile toolchain's grapher.
+func makefileGraph(args []string, stdin io.Reader, stdout io.Writer) error {
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(stdin).Decode(&u); err != nil {
+		return err
+	}
+
+	var o graph.Output
+	for _, file := range u.Files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fo, err := makefile.Graph(file, data, os.Stat, ioutil.ReadFile)
+		if err != nil {
+			return err
+		}
+		o.Defs = append(o.Defs, fo.Defs...)
+		o.Refs = append(o.Refs, fo.Refs...)
+	}
+	return json.NewEncoder(stdout).Encode(o)
+}
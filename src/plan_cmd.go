@@ -0,0 +1,128 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+)
+
+func init() {
+	_, err := CLI.AddCommand("plan",
+		"inspects the plan that `src make` executes",
+		"The plan command describes the plan that `src make` will execute, without executing anything. With --explain, it prints which tools will run on which source units, why each tool was selected, and which cached build data will be reused (for people by default, or as JSON with --format json). With --format ninja or --format make, it prints the plan as a Ninja or Make build file, so that it can be executed by other build systems (run `src config` first to produce the source unit files that the plan depends on).",
+		&planCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type PlanCmd struct {
+	ToolchainExecOpt `group:"execution"`
+	BuildCacheOpt    `group:"build cache"`
+
+	Explain bool   `long:"explain" description:"explain which tools run on which source units and which cached build data is reused"`
+	Format  string `long:"format" description:"print the plan as a build file in this format (or, with --explain, the output format of the explanation)" value-name:"ninja|make|json|table|quiet"`
+}
+
+var planCmd PlanCmd
+
+func (c *PlanCmd) Execute(args []string) error {
+	if !c.Explain {
+		if c.Format == "" {
+			return fmt.Errorf("no action specified (use --explain or --format)")
+		}
+		return c.writeBuildFile()
+	}
+	format := formatTable
+	if c.Format != "" {
+		var err error
+		if format, err = checkFormat(c.Format); err != nil {
+			return err
+		}
+	}
+
+	localRepo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	buildStore, err := buildstore.LocalRepo(localRepo.RootDir)
+	if err != nil {
+		return err
+	}
+	treeConfig, err := config.ReadCached(buildStore.Commit(localRepo.CommitID))
+	if err != nil {
+		return err
+	}
+
+	// If the plan can't be created (e.g., because no tool could be
+	// chosen for a source unit), still explain tool selection so the
+	// user can see which source units are the problem.
+	mf, err := CreateMakefile(c.ToolchainExecOpt, c.BuildCacheOpt)
+	if err != nil {
+		logutil.Default.Warn("Could not create plan; only explaining tool selection.", "err", err)
+		mf = nil
+	}
+	exps := plan.Explain(treeConfig, mf)
+
+	switch format {
+	case formatJSON:
+		PrintJSON(exps, "")
+	case formatTable:
+		printExplanations(exps, mf)
+	}
+	return nil
+}
+
+func (c *PlanCmd) writeBuildFile() error {
+	mf, err := CreateMakefile(c.ToolchainExecOpt, c.BuildCacheOpt)
+	if err != nil {
+		return err
+	}
+
+	switch c.Format {
+	case "ninja":
+		return plan.WriteNinja(os.Stdout, mf)
+	case "make":
+		mfData, err := makex.Marshal(mf)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(mfData)
+		return err
+	default:
+		return fmt.Errorf("unexpected --format value: %q", c.Format)
+	}
+}
+
+func printExplanations(exps []*plan.Explanation, mf *makex.Makefile) {
+	for _, e := range exps {
+		fmt.Printf("%s %s: %s\n", e.UnitType, e.Unit, e.Op)
+		if e.Tool != nil {
+			fmt.Printf("\ttool:   %s %s (%s)\n", e.Tool.Toolchain, e.Tool.Subcmd, e.Reason)
+		} else {
+			fmt.Printf("\ttool:   none (%s)\n", e.Reason)
+		}
+		if e.Target == "" {
+			if mf != nil {
+				fmt.Printf("\ttarget: none (not in plan)\n")
+			}
+			continue
+		}
+		fmt.Printf("\ttarget: %s\n", e.Target)
+		switch {
+		case e.UpToDate:
+			fmt.Printf("\taction: none (up to date)\n")
+		case e.CachedFrom != "":
+			fmt.Printf("\taction: copy cached build data from %s (no files changed)\n", e.CachedFrom)
+		default:
+			fmt.Printf("\taction: run tool\n")
+		}
+	}
+}
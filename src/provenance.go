@@ -0,0 +1,132 @@
+package src
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/importer"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+)
+
+// newProcessProvenance describes the current src process.
+func newProcessProvenance() *store.ProcessProvenance {
+	return &store.ProcessProvenance{
+		SrcVersion: Version,
+		GoVersion:  runtime.Version(),
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Args:       os.Args[1:],
+		Time:       time.Now().UTC(),
+	}
+}
+
+// toolchainsProvenance describes the toolchains of tools, looking up
+// their versions and commits. Toolchains that aren't installed are
+// listed with only their path and tools.
+func toolchainsProvenance(tools []*srclib.ToolRef) []*store.ToolchainProvenance {
+	subcmds := map[string]map[string]struct{}{}
+	for _, t := range tools {
+		if t == nil {
+			continue
+		}
+		if subcmds[t.Toolchain] == nil {
+			subcmds[t.Toolchain] = map[string]struct{}{}
+		}
+		subcmds[t.Toolchain][t.Subcmd] = struct{}{}
+	}
+
+	tcs := make([]*store.ToolchainProvenance, 0, len(subcmds))
+	for path, subcmds := range subcmds {
+		tc := &store.ToolchainProvenance{Path: path}
+		for subcmd := range subcmds {
+			tc.Tools = append(tc.Tools, subcmd)
+		}
+		sort.Strings(tc.Tools)
+		if info, err := toolchain.Lookup(path); err == nil && info != nil {
+			if tc.Version, err = info.Version(); err != nil {
+				logutil.Default.Warn("Failed to determine version of toolchain.", "toolchain", path, "err", err)
+			}
+			if info.Dir != "" {
+				tc.Commit, _ = gitHead(info.Dir)
+			}
+		}
+		tcs = append(tcs, tc)
+	}
+	sort.Slice(tcs, func(i, j int) bool { return tcs[i].Path < tcs[j].Path })
+	return tcs
+}
+
+// makefileTools returns the tools that the rules in mf run.
+func makefileTools(mf *makex.Makefile) []*srclib.ToolRef {
+	var tools []*srclib.ToolRef
+	for _, rule := range mf.Rules {
+		switch rule := rule.(type) {
+		case *grapher.GraphUnitRule:
+			tools = append(tools, rule.Tool)
+		case *dep.ResolveDepsRule:
+			tools = append(tools, rule.Tool)
+		}
+	}
+	return tools
+}
+
+// writeBuildProvenance writes the provenance of a `src make` run of
+// mf (which built the local repository's current commit) to the
+// commit's build data dir.
+func writeBuildProvenance(mf *makex.Makefile) error {
+	localRepo, err := OpenRepo(".")
+	if err != nil {
+		return err
+	}
+	buildStore, err := buildstore.LocalRepo(localRepo.RootDir)
+	if err != nil {
+		return err
+	}
+
+	p := &store.Provenance{
+		Repo:       localRepo.URI(),
+		CommitID:   localRepo.CommitID,
+		Build:      newProcessProvenance(),
+		Toolchains: toolchainsProvenance(makefileTools(mf)),
+	}
+
+	fs := buildStore.Commit(localRepo.CommitID)
+	if err := rwvfs.MkdirAll(fs, "."); err != nil {
+		return err
+	}
+	f, err := fs.Create(importer.BuildProvenanceFilename)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(p); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// openProvenance returns the provenance manifest for the commit (and,
+// for multi-repo stores, repo) from stor.
+func openProvenance(stor interface{}, repo, commitID string) (*store.Provenance, error) {
+	switch s := stor.(type) {
+	case store.RepoProvenancer:
+		return s.Provenance(commitID)
+	case store.MultiRepoProvenancer:
+		return s.Provenance(repo, commitID)
+	}
+	return nil, fmt.Errorf("store (type %T) does not implement provenance manifests", stor)
+}
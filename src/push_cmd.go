@@ -1,15 +1,30 @@
 package src
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
 
 	"sourcegraph.com/sourcegraph/go-sourcegraph/sourcegraph"
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/lsif"
 )
 
 func init() {
 	_, err := CLI.AddCommand("push",
 		"upload and import the current commit (to a remote)",
-		"The push command uploads and imports the current repository commit's build data to a remote. It is a wrapper around `src build-data upload` and `src remote import-build`.",
+		`The push command uploads and imports the current repository commit's build data to a remote. It is a wrapper around `+"`src build-data upload` and `src remote import-build`"+`.
+
+With --lsif, the push command instead exports the current commit's defs and refs from the store as an LSIF dump and uploads it to a Sourcegraph instance, which uses it for code intelligence (go to definition, find references, and hovers). Refs to defs in other repositories are linked by monikers to the dumps of those repositories. The instance is the host of SRC_ENDPOINT unless --sourcegraph-url is given, and the upload is authenticated with --access-token (or SRC_ACCESS_TOKEN). Failed uploads are retried after network and server errors.
+
+Use --dump to write the LSIF dump to a file without uploading it, and --upload-file to upload an existing LSIF (or SCIP) dump.`,
 		&pushCmd,
 	)
 	if err != nil {
@@ -18,11 +33,29 @@ func init() {
 }
 
 type PushCmd struct {
+	Redact string `long:"redact" description:"remove data matching the redaction rules in FILE (JSON) before uploading" value-name:"FILE"`
+
+	LSIF           bool   `long:"lsif" description:"export the store's data for the current commit as LSIF and upload it to a Sourcegraph instance"`
+	SourcegraphURL string `long:"sourcegraph-url" description:"with --lsif, URL of the Sourcegraph instance (default: the host of SRC_ENDPOINT)" value-name:"URL"`
+	AccessToken    string `long:"access-token" description:"with --lsif, Sourcegraph access token (default: $SRC_ACCESS_TOKEN)" value-name:"TOKEN"`
+	Retries        int    `long:"retries" description:"with --lsif, max number of times to retry a failed upload" default:"3" value-name:"N"`
+	Dump           string `long:"dump" description:"with --lsif, write the LSIF dump to FILE instead of uploading it" value-name:"FILE"`
+	UploadFile     string `long:"upload-file" description:"with --lsif, upload the existing LSIF (or SCIP) dump in FILE instead of exporting the store's data" value-name:"FILE"`
 }
 
 var pushCmd PushCmd
 
 func (c *PushCmd) Execute(args []string) error {
+	if c.LSIF {
+		return c.pushLSIF()
+	}
+	if c.Dump != "" || c.UploadFile != "" {
+		return errors.New("--dump and --upload-file require --lsif")
+	}
+	if err := srclib.CheckOnline("pushing build data"); err != nil {
+		return err
+	}
+
 	cl := NewAPIClientWithAuthIfPresent()
 	rrepo, err := getRemoteRepo(cl)
 	if err != nil {
@@ -36,6 +69,7 @@ func (c *PushCmd) Execute(args []string) error {
 		return err
 	}
 
+	buildDataUploadCmd.Redact = c.Redact
 	if err := buildDataUploadCmd.Execute(nil); err != nil {
 		return err
 	}
@@ -44,3 +78,126 @@ func (c *PushCmd) Execute(args []string) error {
 	}
 	return nil
 }
+
+// pushLSIF exports the store's data for the current commit as an LSIF
+// dump and uploads it to a Sourcegraph instance.
+func (c *PushCmd) pushLSIF() error {
+	if c.Redact != "" {
+		return errors.New("--redact is not supported with --lsif")
+	}
+	if c.Dump == "" {
+		if err := srclib.CheckOnline("uploading LSIF (use --dump to only export it)"); err != nil {
+			return err
+		}
+	}
+	lrepo, err := openLocalRepo()
+	if err != nil {
+		return err
+	}
+	if lrepo.CommitID == "" {
+		return errors.New("--lsif requires a repository with a current commit")
+	}
+	repoURI := lrepo.URI()
+
+	dumpFile := c.UploadFile
+	if dumpFile == "" {
+		dumpFile = c.Dump
+		if dumpFile == "" {
+			f, err := ioutil.TempFile("", "srclib-lsif-")
+			if err != nil {
+				return err
+			}
+			f.Close()
+			dumpFile = f.Name()
+			defer os.Remove(dumpFile)
+		}
+		if err := c.exportLSIF(lrepo, dumpFile); err != nil {
+			return err
+		}
+		if c.Dump != "" {
+			return nil
+		}
+	}
+
+	endpoint := c.SourcegraphURL
+	if endpoint == "" {
+		u := getEndpointURL()
+		endpoint = (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+	}
+	token := c.AccessToken
+	if token == "" {
+		token = os.Getenv("SRC_ACCESS_TOKEN")
+	}
+	if token == "" {
+		return errors.New("--lsif requires a Sourcegraph access token (--access-token or SRC_ACCESS_TOKEN)")
+	}
+
+	u := &lsif.Uploader{
+		Endpoint:    endpoint,
+		AccessToken: token,
+		Retries:     c.Retries,
+		Progress: func(sent, total int64) {
+			log.Printf("Uploaded %s of %s (%.0f%%).", bytesString(uint64(sent)), bytesString(uint64(total)), percent(int(sent), int(total)))
+		},
+	}
+	log.Printf("Uploading LSIF dump for %s at commit %s to %s...", repoURI, lrepo.CommitID, endpoint)
+	start := time.Now()
+	id, err := u.Upload(context.Background(), dumpFile, lsif.UploadOptions{
+		Repo:           repoURI,
+		CommitID:       lrepo.CommitID,
+		Indexer:        "srclib",
+		IndexerVersion: Version,
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Uploaded LSIF dump in %s (upload ID %s).", time.Since(start)/time.Millisecond*time.Millisecond, id)
+	return nil
+}
+
+// exportLSIF writes an LSIF dump of the store's defs and refs at the
+// repository's current commit to file.
+func (c *PushCmd) exportLSIF(lrepo *Repo, file string) error {
+	repoURI := lrepo.URI()
+	defsCmd := &StoreDefsCmd{Repo: repoURI, CommitID: lrepo.CommitID}
+	refsCmd := &StoreRefsCmd{Repo: repoURI, CommitID: lrepo.CommitID}
+	defs, err := defsCmd.Get()
+	if err != nil {
+		return err
+	}
+	refs, err := refsCmd.Get()
+	if err != nil {
+		return err
+	}
+	if len(defs) == 0 && len(refs) == 0 {
+		return fmt.Errorf("no defs or refs in the store for %s at commit %s (run `src store import` first)", repoURI, lrepo.CommitID)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	e := &lsif.Exporter{
+		ProjectRoot: (&url.URL{Scheme: "file", Path: filepath.ToSlash(lrepo.RootDir)}).String(),
+		Repo:        repoURI,
+		ToolVersion: Version,
+		ReadFile: func(file string) ([]byte, error) {
+			return snippets.readFile(repoURI, lrepo.CommitID, file)
+		},
+	}
+	err = e.Export(f, defs, refs)
+	if skipped, ok := err.(*lsif.SkippedFilesError); ok {
+		for file, err := range skipped.Errs {
+			logutil.Default.Warn("Omitting file from the LSIF dump.", "file", file, "err", err)
+		}
+		err = nil
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Exported %d defs and %d refs to LSIF dump %s.", len(defs), len(refs), file)
+	return nil
+}
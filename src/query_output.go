@@ -0,0 +1,121 @@
+package src
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// Exit statuses of src, so that scripts can distinguish a query that
+// found nothing from one that failed.
+const (
+	ExitOK       = 0 // success
+	ExitError    = 1 // any other error
+	ExitUsage    = 2 // bad command-line arguments
+	ExitNotFound = 3 // the query succeeded but matched nothing
+)
+
+// errNoResults is returned by query commands (e.g., "src store defs")
+// whose query matched nothing. Main doesn't print it, so with --format
+// quiet only the exit status reports it.
+var errNoResults = errors.New("no results")
+
+// ExitCode returns the exit status of src after Main returns err.
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	if err, ok := err.(*flags.Error); ok {
+		if err.Type == flags.ErrHelp {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	// Only queries that found nothing exit with ExitNotFound; missing
+	// files (such as a missing store or config file) are errors.
+	if err == errNoResults || err == graph.ErrDefNotExist {
+		return ExitNotFound
+	}
+	return ExitError
+}
+
+// printError prints an error returned by CLI.Parse (as the parser's
+// flags.PrintErrors option would, except for errNoResults).
+func printError(err error) {
+	if err == nil || err == errNoResults {
+		return
+	}
+	if err, ok := err.(*flags.Error); ok && err.Type == flags.ErrHelp {
+		fmt.Fprintln(os.Stdout, err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, err)
+}
+
+// Output formats of the --format option of the store query commands.
+// JSON field names and table columns are stable, so that scripts and
+// editor plugins can rely on them.
+const (
+	formatJSON  = "json"  // JSON array of objects
+	formatTable = "table" // aligned columns with a header row, for people
+	formatQuiet = "quiet" // nothing (only the exit status)
+)
+
+// checkFormat returns an error unless format is one of the --format
+// values. ("none" is a deprecated alias of "quiet".)
+func checkFormat(format string) (string, error) {
+	switch format {
+	case formatJSON, formatTable, formatQuiet:
+		return format, nil
+	case "none":
+		return formatQuiet, nil
+	}
+	return "", fmt.Errorf("unexpected --format value: %q (must be json, table, or quiet)", format)
+}
+
+// formatGitHub is an additional --format value of the CI check
+// commands (e.g., "src check"), which prints problems as GitHub
+// Actions annotations.
+const formatGitHub = "github"
+
+// checkCIFormat is like checkFormat, but it also accepts
+// formatGitHub.
+func checkCIFormat(format string) (string, error) {
+	if format == formatGitHub {
+		return format, nil
+	}
+	if format, err := checkFormat(format); err == nil {
+		return format, nil
+	}
+	return "", fmt.Errorf("unexpected --format value: %q (must be json, table, github, or quiet)", format)
+}
+
+// formatText is an additional --format value of the commands whose
+// plain output predates --format (e.g., "src store versions"): that
+// output, unchanged (with no header row). It is those commands'
+// default, so that existing scripts that parse it keep working.
+const formatText = "text"
+
+// checkTextFormat is like checkFormat, but it also accepts
+// formatText.
+func checkTextFormat(format string) (string, error) {
+	if format == formatText {
+		return format, nil
+	}
+	if format, err := checkFormat(format); err == nil {
+		return format, nil
+	}
+	return "", fmt.Errorf("unexpected --format value: %q (must be text, json, table, or quiet)", format)
+}
+
+// orDash returns s, or "-" if s is empty, so that empty table cells
+// don't shift the columns (for tools such as awk).
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
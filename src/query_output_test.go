@@ -0,0 +1,45 @@
+package src
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/go-flags"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := map[string]struct {
+		err  error
+		want int
+	}{
+		"ok":            {nil, ExitOK},
+		"help":          {&flags.Error{Type: flags.ErrHelp}, ExitOK},
+		"usage":         {&flags.Error{Type: flags.ErrUnknownFlag}, ExitUsage},
+		"no results":    {errNoResults, ExitNotFound},
+		"def not exist": {graph.ErrDefNotExist, ExitNotFound},
+		"missing file":  {&os.PathError{Op: "open", Path: ".srclib-store", Err: os.ErrNotExist}, ExitError},
+		"other error":   {errors.New("x"), ExitError},
+		"not exist":     {os.ErrNotExist, ExitError},
+	}
+	for label, test := range tests {
+		if got := ExitCode(test.err); got != test.want {
+			t.Errorf("%s: got %d, want %d", label, got, test.want)
+		}
+	}
+}
+
+func TestCheckTextFormat(t *testing.T) {
+	for _, format := range []string{"text", "json", "table", "quiet"} {
+		if got, err := checkTextFormat(format); err != nil || got != format {
+			t.Errorf("%q: got %q, %v", format, got, err)
+		}
+	}
+	if got, err := checkTextFormat("none"); err != nil || got != formatQuiet {
+		t.Errorf("none: got %q, %v, want quiet", got, err)
+	}
+	if _, err := checkTextFormat("github"); err == nil {
+		t.Error("github: got no error")
+	}
+}
@@ -0,0 +1,55 @@
+package src
+
+import (
+	"encoding/json"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/jsonutil"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// openRedaction reads the redaction rules in filename (see
+// grapher.ReadRedaction). If filename is empty, it returns nil (which
+// is a valid *grapher.Redaction that redacts nothing).
+func openRedaction(filename string) (*grapher.Redaction, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	return grapher.ReadRedaction(filename)
+}
+
+// redactBuildData applies r to the contents of the build data file
+// named filename. Files of data types that can't contain redactable
+// data are returned unchanged.
+func redactBuildData(r *grapher.Redaction, filename string, data []byte) ([]byte, error) {
+	if r == nil {
+		return data, nil
+	}
+	switch name, _ := buildstore.DataType(filename); name {
+	case "graph":
+		var o graph.Output
+		if err := json.Unmarshal(data, &o); err != nil {
+			return nil, err
+		}
+		if err := r.Redact(&o); err != nil {
+			return nil, err
+		}
+		return jsonutil.Marshal(&o)
+	case "unit":
+		var u unit.SourceUnit
+		if err := json.Unmarshal(data, &u); err != nil {
+			return nil, err
+		}
+		r.RedactUnit(&u)
+		return jsonutil.Marshal(&u)
+	case "coverage":
+		var cov []*grapher.FileCoverage
+		if err := json.Unmarshal(data, &cov); err != nil {
+			return nil, err
+		}
+		return jsonutil.Marshal(r.RedactCoverage(cov))
+	}
+	return data, nil
+}
@@ -11,8 +11,10 @@ import (
 
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"sourcegraph.com/sourcegraph/srclib/graph"
 )
@@ -94,6 +96,104 @@ func resolveWorkingTreeRevision(vcsType string, dir string) (string, error) {
 	return strings.TrimSuffix(string(bytes.TrimSpace(out)), "+"), nil
 }
 
+// readFileAtRevision returns the contents of file (relative to the
+// repository root dir) at a commit. If the file doesn't exist at the
+// commit, an error satisfying os.IsNotExist is returned.
+func readFileAtRevision(vcsType, dir, commitID, file string) ([]byte, error) {
+	var cmd *exec.Cmd
+	var notExistMsgs []string // substrings of the error output if the file doesn't exist
+	switch vcsType {
+	case "git":
+		cmd = exec.Command("git", "show", commitID+":"+filepath.ToSlash(file))
+		notExistMsgs = []string{"does not exist in", "exists on disk, but not in"}
+	case "hg":
+		cmd = exec.Command("hg", "--config", "trusted.users=root", "cat", "-r", commitID, "--", file)
+		notExistMsgs = []string{"no such file in rev"}
+	default:
+		return nil, fmt.Errorf("unknown vcs type: %q", vcsType)
+	}
+	cmd.Dir = dir
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		for _, msg := range notExistMsgs {
+			if strings.Contains(stderr.String(), msg) {
+				return nil, &os.PathError{Op: "read", Path: file + "@" + commitID, Err: os.ErrNotExist}
+			}
+		}
+		return nil, fmt.Errorf("exec %v failed: %s. Output was:\n\n%s", cmd.Args, err, stderr.Bytes())
+	}
+	return out, nil
+}
+
+// A revision is a commit in a repository's history.
+type revision struct {
+	commitID string
+	time     time.Time // commit time
+}
+
+// logRevisions returns the commit rev and up to n-1 of its ancestors,
+// newest first.
+func logRevisions(vcsType, dir, rev string, n int) ([]revision, error) {
+	var cmd *exec.Cmd
+	switch vcsType {
+	case "git":
+		cmd = exec.Command("git", "log", "--format=%H %ct", "-n", strconv.Itoa(n), rev, "--")
+	case "hg":
+		cmd = exec.Command("hg", "--config", "trusted.users=root", "log", "-r", "reverse(ancestors("+rev+"))", "-l", strconv.Itoa(n), "--template", "{node} {date|hgdate}\n")
+	default:
+		return nil, fmt.Errorf("unknown vcs type: %q", vcsType)
+	}
+	cmd.Dir = dir
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("exec %v failed: %s. Output was:\n\n%s", cmd.Args, err, out)
+	}
+	var revs []revision
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.Fields(line)
+		if len(f) < 2 {
+			continue
+		}
+		sec, err := strconv.ParseInt(f[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("exec %v: bad commit time in %q", cmd.Args, line)
+		}
+		revs = append(revs, revision{commitID: f[0], time: time.Unix(sec, 0)})
+	}
+	return revs, nil
+}
+
+// listBranches returns the heads of the repository's (local)
+// branches, as a map of branch name to commit ID.
+func listBranches(vcsType, dir string) (map[string]string, error) {
+	var cmd *exec.Cmd
+	switch vcsType {
+	case "git":
+		cmd = exec.Command("git", "for-each-ref", "--format=%(refname:short) %(objectname)", "refs/heads")
+	case "hg":
+		cmd = exec.Command("hg", "--config", "trusted.users=root", "branches", "--template", "{branch} {node}\n")
+	default:
+		return nil, fmt.Errorf("unknown vcs type: %q", vcsType)
+	}
+	cmd.Dir = dir
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("exec %v failed: %s. Output was:\n\n%s", cmd.Args, err, out)
+	}
+	branches := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if i := strings.LastIndex(line, " "); i > 0 {
+			branches[line[:i]] = line[i+1:]
+		}
+	}
+	return branches, nil
+}
+
 func getRootDir(dir string) (rootDir string, vcsType string, err error) {
 	dir, err = filepath.Abs(dir)
 	if err != nil {
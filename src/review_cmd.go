@@ -0,0 +1,221 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/review"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+func init() {
+	_, err := CLI.AddCommand("review",
+		"report the defs that a change modifies and how widely they are used",
+		`The review command computes the defs that the changes from commit BASE to commit HEAD (such as a pull request's) modify, and counts the refs to each of them in the store, across all of the repositories in it. The store must contain the repository's build data at HEAD (and the build data of the repositories whose refs are counted).
+
+A def is modified if the diff changed any line of its definition. Local defs (such as local variables) are omitted.
+
+By default, the report is printed: with --format table (the default), as the report's title and aligned columns (with a header row) for people; with --format json, as a JSON array of modified defs; and with --format quiet, not at all. With --comment or --check (or both), it is posted to a pull request on a forge (with --forge; only "github" is currently supported) instead: --comment posts a review comment on each modified def with at least --min-refs refs, such as "This change modifies `+"`Foo`"+` (func), which has 1,243 references across 14 repos.", and --check posts an informational check run on HEAD that summarizes all of the modified defs.`,
+		&reviewCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type ReviewCmd struct {
+	Repo string `long:"repo" description:"repo URI of the build data in the store (default: the repository's URI)"`
+
+	MinRefs int    `long:"min-refs" description:"only comment on modified defs with at least N refs" default:"1" value-name:"N"`
+	Format  string `long:"format" description:"output format of the printed report" default:"table" value-name:"json|table|quiet"`
+
+	Comment   bool   `long:"comment" description:"post a review comment on each modified def to the pull request"`
+	Check     bool   `long:"check" description:"post a check run that summarizes the modified defs on the pull request's head commit"`
+	CheckName string `long:"check-name" description:"name of the posted check run" default:"srclib"`
+
+	Forge     string `long:"forge" description:"forge of the pull request" default:"github" value-name:"github"`
+	ForgeURL  string `long:"forge-url" description:"API URL of the forge (such as https://HOST/api/v3 for GitHub Enterprise; default: the public forge's)" value-name:"URL"`
+	ForgeRepo string `long:"forge-repo" description:"name of the repository on the forge (such as OWNER/NAME)" value-name:"NAME"`
+	PR        int    `long:"pr" description:"number of the pull request" value-name:"N"`
+	Token     string `long:"token" description:"forge access token (default: $GITHUB_TOKEN)" value-name:"TOKEN"`
+
+	Args struct {
+		Base string `name:"BASE" description:"base commit (or other revision)"`
+		Head string `name:"HEAD" description:"head commit (or other revision; default: the current commit)"`
+	} `positional-args:"yes"`
+}
+
+var reviewCmd ReviewCmd
+
+func (c *ReviewCmd) Execute(args []string) error {
+	if c.Args.Base == "" {
+		return errors.New("review: a BASE commit is required")
+	}
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	lrepo, err := openLocalRepo()
+	if err != nil {
+		return err
+	}
+	if lrepo.VCSType != "git" {
+		return fmt.Errorf("review: unsupported vcs type: %q", lrepo.VCSType)
+	}
+	var fg review.Forge
+	if c.Comment || c.Check {
+		if c.ForgeRepo == "" || c.PR == 0 {
+			return errors.New("--comment and --check require --forge-repo and --pr")
+		}
+		if err := srclib.CheckOnline("posting to the forge"); err != nil {
+			return err
+		}
+		if fg, err = c.forge(); err != nil {
+			return err
+		}
+	}
+
+	repoURI := c.Repo
+	if repoURI == "" {
+		repoURI = lrepo.URI()
+	}
+	base, err := resolveGitRevision(lrepo.RootDir, c.Args.Base)
+	if err != nil {
+		return err
+	}
+	head := lrepo.CommitID
+	if c.Args.Head != "" {
+		if head, err = resolveGitRevision(lrepo.RootDir, c.Args.Head); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command("git", "diff", "-U0", "--no-color", "--no-ext-diff", "-M", base, head, "--")
+	cmd.Dir = lrepo.RootDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("exec %v failed: %s. Output was:\n\n%s", cmd.Args, err, stderr.Bytes())
+	}
+	diffs, err := review.ParseDiff(bytes.NewReader(out))
+	if err != nil {
+		return err
+	}
+	changedFiles := map[string]struct{}{}
+	for _, d := range diffs {
+		if d.NewName != "" {
+			changedFiles[d.NewName] = struct{}{}
+		}
+	}
+
+	defs, err := (&StoreDefsCmd{
+		Repo:     repoURI,
+		CommitID: head,
+		Filter: store.DefFilterFunc(func(def *graph.Def) bool {
+			_, changed := changedFiles[def.File]
+			return changed && !def.Local
+		}),
+	}).Get()
+	if err != nil {
+		return err
+	}
+	changes, err := review.ChangedDefs(diffs, defs, func(file string) ([]byte, error) {
+		return readFileAtRevision(lrepo.VCSType, lrepo.RootDir, head, file)
+	})
+	if err != nil {
+		return err
+	}
+	for _, ch := range changes {
+		refs, err := (&StoreRefsCmd{
+			DefRepo:     repoURI,
+			DefUnitType: ch.Def.UnitType,
+			DefUnit:     ch.Def.Unit,
+			DefPath:     ch.Def.Path,
+		}).Get()
+		if err != nil {
+			return err
+		}
+		ch.SetRefs(refs)
+	}
+	if GlobalOpt.Verbose {
+		log.Printf("%d files changed from %s to %s; %d defs modified.", len(diffs), base, head, len(changes))
+	}
+
+	if fg == nil {
+		switch format {
+		case formatJSON:
+			if changes == nil {
+				changes = []*review.Change{}
+			}
+			PrintJSON(changes, "")
+		case formatTable:
+			fmt.Println(review.Title(changes))
+			tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(tw, "LOCATION\tPATH\tREFS\tREPOS")
+			for _, ch := range changes {
+				fmt.Fprintf(tw, "%s:%d\t%s\t%d\t%d\n", ch.Def.File, ch.Line, ch.Def.Path, ch.Refs, len(ch.Repos))
+			}
+			return tw.Flush()
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	pr := &review.PullRequest{Repo: c.ForgeRepo, Number: c.PR, HeadCommitID: head}
+	if c.Comment {
+		var commented []*review.Change
+		for _, ch := range changes {
+			if ch.Refs >= c.MinRefs {
+				commented = append(commented, ch)
+			}
+		}
+		if err := fg.Comment(ctx, pr, review.Comments(commented)); err != nil {
+			return err
+		}
+		log.Printf("Posted %d review comments on %s#%d.", len(commented), c.ForgeRepo, c.PR)
+	}
+	if c.Check {
+		check := &review.Check{Name: c.CheckName, Title: review.Title(changes), Summary: review.Summary(changes)}
+		if err := fg.Check(ctx, pr, check); err != nil {
+			return err
+		}
+		log.Printf("Posted check %q on %s commit %s.", c.CheckName, c.ForgeRepo, head)
+	}
+	return nil
+}
+
+// forge returns the forge that --forge names.
+func (c *ReviewCmd) forge() (review.Forge, error) {
+	switch c.Forge {
+	case "github":
+		token := c.Token
+		if token == "" {
+			token = os.Getenv("GITHUB_TOKEN")
+		}
+		return &review.GitHub{BaseURL: c.ForgeURL, Token: token}, nil
+	default:
+		return nil, fmt.Errorf("unsupported --forge value: %q", c.Forge)
+	}
+}
+
+// resolveGitRevision returns the full commit ID of rev in the git
+// repository in dir.
+func resolveGitRevision(dir, rev string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--verify", rev+"^{commit}")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("exec %v failed: %s. Output was:\n\n%s", cmd.Args, err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
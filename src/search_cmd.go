@@ -0,0 +1,161 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"text/tabwriter"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func init() {
+	_, err := CLI.AddCommand("search",
+		"search for defs by name",
+		`The search command lists defs in the store whose names match the query, with the highest-ranked defs (see Def.Rank) first.
+
+By default, the query must be a (case-insensitive) prefix of the def name. With --fuzzy, it may be any camelCase-aware subsequence of the name (e.g., "HtpSrv" matches "HTTPServer"), and better matches are listed first.
+
+With --regex, the query is a regular expression that is matched against the contents of source unit files instead. This requires a content index, which is built by running "src store import --index-content".
+
+With --format table (the default), it prints aligned columns (with a header row) of the matching defs for people, or grep-style FILE:LINE:TEXT lines of the matching file contents with --regex; with --format json, a JSON array of defs (or content matches); and with --format quiet, nothing. It exits with status 3 if nothing matches, 1 if the search fails, and 0 otherwise.`,
+		&searchCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type SearchCmd struct {
+	Repo     string `long:"repo" description:"only search defs in this repo"`
+	CommitID string `long:"commit" description:"only search defs at this commit ID"`
+	UnitType string `long:"unit-type" description:"only search in source units of this type"`
+	Unit     string `long:"unit" description:"only search in source units with this name"`
+	File     string `long:"file" description:"only search in this file (or dir)"`
+	Fuzzy    bool   `long:"fuzzy" description:"match the query as a camelCase-aware subsequence of def names"`
+	Regex    bool   `long:"regex" description:"match the query as a regexp against file contents (not def names)"`
+	Limit    int    `short:"n" long:"limit" description:"max results to return (0 for all)" default:"20"`
+
+	Format string `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+
+	Args struct {
+		Query string `name:"QUERY" description:"def name query"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var searchCmd SearchCmd
+
+func (c *SearchCmd) Execute(args []string) error {
+	if c.Args.Query == "" {
+		return fmt.Errorf("empty query")
+	}
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	if (c.UnitType != "" && c.Unit == "") || (c.UnitType == "" && c.Unit != "") {
+		return fmt.Errorf("must specify either both or neither of --unit-type and --unit (to filter by source unit)")
+	}
+	if c.Regex {
+		if c.Fuzzy {
+			return fmt.Errorf("--fuzzy and --regex are mutually exclusive")
+		}
+		return c.searchContent(format)
+	}
+
+	defs, err := (&StoreDefsCmd{
+		Repo:     c.Repo,
+		CommitID: c.CommitID,
+		UnitType: c.UnitType,
+		Unit:     c.Unit,
+		File:     c.File,
+		Query:    c.Args.Query,
+		Fuzzy:    c.Fuzzy,
+		Limit:    c.Limit,
+	}).Get()
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case formatJSON:
+		if defs == nil {
+			defs = []*graph.Def{}
+		}
+		PrintJSON(defs, "  ")
+	case formatTable:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tKIND\tUNIT\tPATH\tLOCATION")
+		for _, def := range defs {
+			fmt.Fprintf(tw, "%s\t%s\t%s %s\t%s\t%s:%d\n", def.Name, orDash(def.Kind), def.UnitType, def.Unit, def.Path, def.File, def.DefStart)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(defs) == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// searchContent searches the store's content index for matches of the
+// query regexp.
+func (c *SearchCmd) searchContent(format string) error {
+	re, err := regexp.Compile(c.Args.Query)
+	if err != nil {
+		return err
+	}
+
+	commitID := c.CommitID
+	if commitID == "" {
+		lrepo, err := openLocalRepo()
+		if err != nil || lrepo.CommitID == "" {
+			return fmt.Errorf("--regex requires --commit (outside of a repository)")
+		}
+		commitID = lrepo.CommitID
+	}
+
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+	x, err := openContentIndex(s, c.Repo, commitID)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no content index for commit %s (run 'src store import --index-content' to build one)", commitID)
+	} else if err != nil {
+		return err
+	}
+
+	opt := store.ContentSearchOptions{Limit: c.Limit}
+	if c.Unit != "" {
+		opt.Units = []unit.ID2{{Type: c.UnitType, Name: c.Unit}}
+	}
+	if c.File != "" {
+		opt.Files = []string{path.Clean(c.File)}
+	}
+	matches, err := x.Search(re, opt)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case formatJSON:
+		if matches == nil {
+			matches = []*store.ContentMatch{}
+		}
+		PrintJSON(matches, "  ")
+	case formatTable:
+		for _, m := range matches {
+			fmt.Printf("%s:%d:%s\n", m.File, m.Line, m.Text)
+		}
+	}
+	if len(matches) == 0 {
+		return errNoResults
+	}
+	return nil
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/inconshreveable/go-update"
 	"github.com/inconshreveable/go-update/check"
+
+	"sourcegraph.com/sourcegraph/srclib"
 )
 
 func init() {
@@ -39,6 +41,9 @@ var selfupdateCmd SelfupdateCmd
 
 func (c *SelfupdateCmd) Execute(args []string) error {
 	log.Printf("Current: src %s.", Version)
+	if err := srclib.CheckOnline("updating src"); err != nil {
+		return err
+	}
 
 	r, err := checkForUpdate()
 	if err == check.NoUpdateAvailable {
@@ -0,0 +1,249 @@
+package src
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+// serveACL is the contents of the "src serve --acl" file. It lists the
+// clients that may query the server and the repos that each may read.
+type serveACL struct {
+	Clients []*serveClient
+
+	mu      sync.RWMutex            // guards byToken (see replace)
+	byToken map[string]*serveClient // hex SHA-256 of token -> client
+}
+
+// A serveClient is a client of "src serve" that authenticates with a
+// bearer token.
+type serveClient struct {
+	// Name identifies the client (e.g., a team) in logs.
+	Name string
+
+	// TokenSHA256 is the hex-encoded SHA-256 hash of the client's
+	// token. (The ACL file doesn't contain the tokens themselves.)
+	TokenSHA256 string
+
+	// Repos are the repos that the client may read, as path.Match
+	// patterns (e.g., "github.com/org/*").
+	Repos []string
+
+	// ImportRepos are the repos that the client may upload build
+	// data for (with --imports), as path.Match patterns.
+	ImportRepos []string
+
+	// Admin is whether the client may reload the server's
+	// configuration (via the /reload endpoint).
+	Admin bool
+}
+
+// readServeACL reads and validates the ACL file.
+func readServeACL(file string) (*serveACL, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var acl serveACL
+	if err := json.NewDecoder(f).Decode(&acl); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	acl.byToken = make(map[string]*serveClient, len(acl.Clients))
+	for _, c := range acl.Clients {
+		if c.Name == "" {
+			return nil, fmt.Errorf("%s: client has no Name", file)
+		}
+		h := strings.ToLower(c.TokenSHA256)
+		if b, err := hex.DecodeString(h); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("%s: client %q: TokenSHA256 is not a hex-encoded SHA-256 hash", file, c.Name)
+		}
+		if _, dup := acl.byToken[h]; dup {
+			return nil, fmt.Errorf("%s: client %q: duplicate TokenSHA256", file, c.Name)
+		}
+		for _, pat := range append(c.Repos, c.ImportRepos...) {
+			if _, err := path.Match(pat, ""); err != nil {
+				return nil, fmt.Errorf("%s: client %q: bad repo pattern %q: %s", file, c.Name, pat, err)
+			}
+		}
+		acl.byToken[h] = c
+	}
+	return &acl, nil
+}
+
+// authenticate returns the client with the given token, or nil.
+func (a *serveACL) authenticate(token string) *serveClient {
+	if token == "" {
+		return nil
+	}
+	h := sha256.Sum256([]byte(token))
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.byToken[hex.EncodeToString(h[:])]
+}
+
+// replace makes a authenticate the clients of b (a newly read ACL)
+// instead of its own. Requests that were already authenticated keep
+// their clients (and the repos that those clients could read).
+func (a *serveACL) replace(b *serveACL) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Clients, a.byToken = b.Clients, b.byToken
+}
+
+// canRead returns whether the client may read repo.
+func (c *serveClient) canRead(repo string) bool {
+	return matchAny(c.Repos, repo)
+}
+
+// canImport returns whether the client may upload build data for repo.
+func (c *serveClient) canImport(repo string) bool {
+	return matchAny(c.ImportRepos, repo)
+}
+
+// matchAny returns whether name matches any of the path.Match
+// patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pat := range patterns {
+		if ok, _ := path.Match(pat, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// readableRepos returns the repos in the store that the client may
+// read.
+func (c *serveClient) readableRepos() ([]string, error) {
+	s, err := OpenStore()
+	if err != nil {
+		return nil, err
+	}
+	mrs, ok := s.(store.MultiRepoStore)
+	if !ok {
+		return nil, fmt.Errorf("store (type %T) does not implement listing repos", s)
+	}
+	repos, err := mrs.Repos()
+	if err != nil {
+		return nil, err
+	}
+	readable := repos[:0]
+	for _, repo := range repos {
+		if c.canRead(repo) {
+			readable = append(readable, repo)
+		}
+	}
+	return readable, nil
+}
+
+type serveClientKey struct{}
+
+// serveClientFromContext returns the authenticated client of the
+// request, or nil if the server has no ACL.
+func serveClientFromContext(ctx context.Context) *serveClient {
+	c, _ := ctx.Value(serveClientKey{}).(*serveClient)
+	return c
+}
+
+// bearerToken returns the token in an "Authorization: Bearer TOKEN"
+// header value, or "".
+func bearerToken(header string) string {
+	const prefix = "Bearer "
+	if len(header) > len(prefix) && strings.EqualFold(header[:len(prefix)], prefix) {
+		return header[len(prefix):]
+	}
+	return ""
+}
+
+// authenticateGRPC returns ctx with the client that sent the gRPC
+// request (which must have "authorization: Bearer TOKEN" metadata).
+func (a *serveACL) authenticateGRPC(ctx context.Context) (context.Context, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			token = bearerToken(v[0])
+		}
+	}
+	c := a.authenticate(token)
+	if c == nil {
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+	}
+	return context.WithValue(ctx, serveClientKey{}, c), nil
+}
+
+func (a *serveACL) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticateGRPC(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *serveACL) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticateGRPC(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, contextStream{ss, ctx})
+}
+
+// contextStream is a grpc.ServerStream with a different context (e.g.,
+// one with the authenticated client).
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextStream) Context() context.Context { return s.ctx }
+
+// authenticateHTTP returns the client that sent the HTTP request, with
+// an "Authorization: Bearer TOKEN" header or (for WebSocket clients
+// that can't set headers, such as browsers) a "token" query parameter.
+func (a *serveACL) authenticateHTTP(r *http.Request) *serveClient {
+	token := bearerToken(r.Header.Get("Authorization"))
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	return a.authenticate(token)
+}
+
+// repoScope returns a filter that restricts a query to the repos that
+// the request's client may read, or nil if the server has no ACL. If
+// the query is for a specific repo that the client may not read, it
+// returns a PermissionDenied error.
+func repoScope(ctx context.Context, repo string) (repoScopeFilter, error) {
+	c := serveClientFromContext(ctx)
+	if c == nil {
+		return nil, nil
+	}
+	if repo != "" && !c.canRead(repo) {
+		return nil, status.Errorf(codes.PermissionDenied, "client %q may not read repo %q", c.Name, repo)
+	}
+	repos, err := c.readableRepos()
+	if err != nil {
+		return nil, err
+	}
+	// The store intersects this with other repo filters (and opens no
+	// repo stores if it is empty).
+	return store.ByRepos(repos...), nil
+}
+
+// repoScopeFilter is the type of store.ByRepos filters.
+type repoScopeFilter interface {
+	store.DefFilter
+	store.RefFilter
+}
@@ -0,0 +1,168 @@
+package src
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func tokenSHA256(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// writeTestACL writes an ACL file with the given contents in a temp
+// dir, and returns its name and a func that removes it.
+func writeTestACL(t *testing.T, data string) (string, func()) {
+	dir, err := ioutil.TempDir("", "srclib-acl-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "acl.json")
+	if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file, func() { os.RemoveAll(dir) }
+}
+
+func TestReadServeACL(t *testing.T) {
+	h1, h2 := tokenSHA256("t1"), tokenSHA256("t2")
+	tests := map[string]struct {
+		acl     string
+		wantErr string
+	}{
+		"ok": {
+			acl: `{"Clients": [{"Name": "a", "TokenSHA256": "` + h1 + `", "Repos": ["r/*"]}, {"Name": "b", "TokenSHA256": "` + strings.ToUpper(h2) + `"}]}`,
+		},
+		"bad hash": {
+			acl:     `{"Clients": [{"Name": "a", "TokenSHA256": "t1"}]}`,
+			wantErr: "TokenSHA256 is not a hex-encoded SHA-256 hash",
+		},
+		"short hash": {
+			acl:     `{"Clients": [{"Name": "a", "TokenSHA256": "` + h1[:32] + `"}]}`,
+			wantErr: "TokenSHA256 is not a hex-encoded SHA-256 hash",
+		},
+		"duplicate token": {
+			acl:     `{"Clients": [{"Name": "a", "TokenSHA256": "` + h1 + `"}, {"Name": "b", "TokenSHA256": "` + strings.ToUpper(h1) + `"}]}`,
+			wantErr: `client "b": duplicate TokenSHA256`,
+		},
+		"no name": {
+			acl:     `{"Clients": [{"TokenSHA256": "` + h1 + `"}]}`,
+			wantErr: "client has no Name",
+		},
+		"bad repo pattern": {
+			acl:     `{"Clients": [{"Name": "a", "TokenSHA256": "` + h1 + `", "ImportRepos": ["r/["]}]}`,
+			wantErr: "bad repo pattern",
+		},
+		"bad JSON": {
+			acl:     `{"Clients": {}}`,
+			wantErr: "cannot unmarshal",
+		},
+	}
+	for label, test := range tests {
+		file, remove := writeTestACL(t, test.acl)
+		_, err := readServeACL(file)
+		remove()
+		if test.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %s", label, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s: got error %v, want it to contain %q", label, err, test.wantErr)
+		}
+	}
+}
+
+func TestServeACL_authenticate(t *testing.T) {
+	file, remove := writeTestACL(t, `{"Clients": [{"Name": "a", "TokenSHA256": "`+tokenSHA256("t1")+`"}, {"Name": "b", "TokenSHA256": "`+strings.ToUpper(tokenSHA256("t2"))+`"}]}`)
+	defer remove()
+	acl, err := readServeACL(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{"t1": "a", "t2": "b", "": "", "t3": "", tokenSHA256("t1"): ""}
+	for token, want := range tests {
+		var got string
+		if c := acl.authenticate(token); c != nil {
+			got = c.Name
+		}
+		if got != want {
+			t.Errorf("token %q: got client %q, want %q", token, got, want)
+		}
+	}
+
+	httpTests := []struct {
+		header, query string
+		want          string
+	}{
+		{"Bearer t1", "", "a"},
+		{"bearer t2", "", "b"},
+		{"", "token=t1", "a"},
+		{"Basic t1", "", ""},
+		{"Bearer t3", "token=t1", ""},
+	}
+	for _, test := range httpTests {
+		r, err := http.NewRequest("GET", "/defs?"+test.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.header != "" {
+			r.Header.Set("Authorization", test.header)
+		}
+		var got string
+		if c := acl.authenticateHTTP(r); c != nil {
+			got = c.Name
+		}
+		if got != test.want {
+			t.Errorf("Authorization %q, query %q: got client %q, want %q", test.header, test.query, got, test.want)
+		}
+	}
+}
+
+func TestRepoScope(t *testing.T) {
+	s := store.NewFSMultiRepoStore(rwvfs.Walkable(rwvfs.Map(map[string]string{})), nil)
+	for _, repo := range []string{"a/x", "a/y", "b/x"} {
+		if err := s.Import(repo, "c", &unit.SourceUnit{Type: "t", Name: "u"}, graph.Output{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	origOpenStore := OpenStore
+	defer func() { OpenStore = origOpenStore }()
+	OpenStore = func() (interface{}, error) { return s, nil }
+
+	if f, err := repoScope(context.Background(), "b/x"); f != nil || err != nil {
+		t.Errorf("without a client: got %v, %v, want no filter", f, err)
+	}
+
+	client := &serveClient{Name: "c", Repos: []string{"a/*"}}
+	ctx := context.WithValue(context.Background(), serveClientKey{}, client)
+	if _, err := repoScope(ctx, "b/x"); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("unreadable repo: got error %v, want PermissionDenied", err)
+	}
+	for _, repo := range []string{"a/x", ""} {
+		f, err := repoScope(ctx, repo)
+		if err != nil {
+			t.Fatalf("repo %q: %s", repo, err)
+		}
+		repos := append([]string{}, f.(store.ByReposFilter).ByRepos()...)
+		sort.Strings(repos)
+		if len(repos) != 2 || repos[0] != "a/x" || repos[1] != "a/y" {
+			t.Errorf("repo %q: got repos %v in scope, want [a/x a/y]", repo, repos)
+		}
+	}
+}
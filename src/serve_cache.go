@@ -0,0 +1,136 @@
+package src
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/metrics"
+)
+
+// queryCache is an LRU cache of the results of "src serve" queries.
+//
+// Entries are removed when the index watcher reports that a commit
+// finished importing (see invalidate). Since the watcher doesn't detect
+// when an existing commit is re-imported, entries also expire after the
+// TTL.
+type queryCache struct {
+	max int           // max number of entries
+	ttl time.Duration // max age of entries (0 for no limit)
+
+	mu      sync.Mutex
+	lru     *list.List // of *queryCacheEntry, most recently used first
+	entries map[queryCacheKey]*list.Element
+}
+
+type queryCacheKey struct {
+	// client is the client with --acl (since results are restricted
+	// to the repos that the client may read), or nil. Client names
+	// needn't be unique, and reloading the ACL replaces its clients
+	// (see serveACL.replace), so keying on the client itself means
+	// that results cached under a client's old grants are never
+	// returned to requests authenticated with the new ACL, even if
+	// an old request adds them after the reload resets the cache.
+	client *serveClient
+
+	// repo and commitID are the repo and commit that the query is
+	// for ("" for all).
+	repo, commitID string
+
+	// query is the method name and request.
+	query string
+}
+
+type queryCacheEntry struct {
+	key     queryCacheKey
+	results interface{}
+	added   time.Time
+}
+
+func newQueryCache(max int, ttl time.Duration) *queryCache {
+	return &queryCache{max: max, ttl: ttl, lru: list.New(), entries: map[queryCacheKey]*list.Element{}}
+}
+
+func (c *queryCache) get(key queryCacheKey) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*queryCacheEntry)
+	if c.ttl > 0 && time.Since(entry.added) > c.ttl {
+		c.remove(e)
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return entry.results, true
+}
+
+func (c *queryCache) add(key queryCacheKey, results interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	c.entries[key] = c.lru.PushFront(&queryCacheEntry{key: key, results: results, added: time.Now()})
+	for c.lru.Len() > c.max {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *queryCache) remove(e *list.Element) {
+	c.lru.Remove(e)
+	delete(c.entries, e.Value.(*queryCacheEntry).key)
+}
+
+// invalidate removes the entries whose results may include data from
+// the commit in u: those for queries of its repo (or of all repos) at
+// that commit (or at all commits).
+func (c *queryCache) invalidate(u indexUpdate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		key := e.Value.(*queryCacheEntry).key
+		if (key.repo == "" || u.Repo == "" || key.repo == u.Repo) && (key.commitID == "" || key.commitID == u.CommitID) {
+			c.remove(e)
+		}
+		e = next
+	}
+}
+
+// reset removes all entries (when the server's configuration is
+// reloaded, which may change the stores or the repos that clients may
+// read). It does nothing if c is nil.
+func (c *queryCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.entries = map[queryCacheKey]*list.Element{}
+}
+
+// cached returns the cached results of the query (the method with the
+// given name and request, for repo and commitID), or calls f to get
+// them and caches them if f succeeds. If c is nil, it just calls f.
+func (c *queryCache) cached(ctx context.Context, method string, req interface{ String() string }, repo, commitID string, f func() (interface{}, error)) (interface{}, error) {
+	if c == nil {
+		return f()
+	}
+	key := queryCacheKey{client: serveClientFromContext(ctx), repo: repo, commitID: commitID, query: method + " " + req.String()}
+	if results, ok := c.get(key); ok {
+		metrics.Inc(queryCacheMetric, "method", method, "result", "hit")
+		return results, nil
+	}
+	metrics.Inc(queryCacheMetric, "method", method, "result", "miss")
+	results, err := f()
+	if err != nil {
+		return nil, err
+	}
+	c.add(key, results)
+	return results, nil
+}
@@ -0,0 +1,131 @@
+package src
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type testQuery string
+
+func (q testQuery) String() string { return string(q) }
+
+func TestQueryCache_clients(t *testing.T) {
+	c := newQueryCache(10, 0)
+	calls := 0
+	query := func(ctx context.Context) interface{} {
+		v, err := c.cached(ctx, "Defs", testQuery("q"), "r", "c", func() (interface{}, error) {
+			calls++
+			return calls, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	ctxA := context.WithValue(context.Background(), serveClientKey{}, &serveClient{Name: "a", TokenSHA256: tokenSHA256("ta")})
+	ctxB := context.WithValue(context.Background(), serveClientKey{}, &serveClient{Name: "b", TokenSHA256: tokenSHA256("tb")})
+
+	if v := query(ctxA); v != 1 {
+		t.Errorf("client a: got %v, want 1", v)
+	}
+	// Client b may read different repos, so it must not get client a's
+	// cached results.
+	if v := query(ctxB); v != 2 {
+		t.Errorf("client b: got %v, want 2 (not client a's cached results)", v)
+	}
+	if v := query(ctxA); v != 1 {
+		t.Errorf("client a again: got %v, want cached 1", v)
+	}
+	if v := query(context.Background()); v != 3 {
+		t.Errorf("no client: got %v, want 3", v)
+	}
+	if calls != 3 {
+		t.Errorf("got %d calls, want 3", calls)
+	}
+}
+
+func TestQueryCache_sameNamedClients(t *testing.T) {
+	c := newQueryCache(10, 0)
+
+	// Two clients with the same name but different tokens and repos.
+	a := &serveClient{Name: "team", TokenSHA256: tokenSHA256("t1"), Repos: []string{"r1", "r2"}}
+	b := &serveClient{Name: "team", TokenSHA256: tokenSHA256("t2"), Repos: []string{"r1"}}
+	query := func(client *serveClient) interface{} {
+		ctx := context.WithValue(context.Background(), serveClientKey{}, client)
+		v, err := c.cached(ctx, "Defs", testQuery("q"), "", "", func() (interface{}, error) {
+			var readable []string
+			for _, repo := range []string{"r1", "r2"} {
+				if client.canRead(repo) {
+					readable = append(readable, repo)
+				}
+			}
+			return strings.Join(readable, ","), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	if v := query(a); v != "r1,r2" {
+		t.Errorf("client a: got %v, want r1,r2", v)
+	}
+	if v := query(b); v != "r1" {
+		t.Errorf("client b: got %v, want r1 (not client a's cached results)", v)
+	}
+	if v := query(a); v != "r1,r2" {
+		t.Errorf("client a again: got %v, want cached r1,r2", v)
+	}
+}
+
+func TestQueryCache_invalidate(t *testing.T) {
+	c := newQueryCache(10, 0)
+	keys := []queryCacheKey{
+		{repo: "r1", commitID: "c1", query: "a"},
+		{repo: "r1", commitID: "c2", query: "b"},
+		{repo: "r1", query: "c"},
+		{query: "d"},
+		{repo: "r2", commitID: "c1", query: "e"},
+	}
+	for _, key := range keys {
+		c.add(key, key.query)
+	}
+	c.invalidate(indexUpdate{Repo: "r1", CommitID: "c1"})
+
+	var remaining []string
+	for key := range c.entries {
+		remaining = append(remaining, key.query)
+	}
+	sort.Strings(remaining)
+	if want := []string{"b", "e"}; len(remaining) != len(want) || remaining[0] != want[0] || remaining[1] != want[1] {
+		t.Errorf("got remaining queries %v, want %v", remaining, want)
+	}
+
+	// An update of a RepoStore (with no repo) affects all repos.
+	c.invalidate(indexUpdate{CommitID: "c1"})
+	if _, ok := c.get(keys[4]); ok {
+		t.Error("got cached results for r2 c1 after invalidating c1 of all repos")
+	}
+	if _, ok := c.get(keys[1]); !ok {
+		t.Error("got no cached results for r1 c2, which wasn't invalidated")
+	}
+}
+
+func TestQueryCache_maxAndNil(t *testing.T) {
+	c := newQueryCache(2, 0)
+	for _, q := range []string{"a", "b", "c"} {
+		c.add(queryCacheKey{query: q}, q)
+	}
+	if _, ok := c.get(queryCacheKey{query: "a"}); ok {
+		t.Error("got least recently used entry beyond max")
+	}
+
+	var nilCache *queryCache
+	v, err := nilCache.cached(context.Background(), "Defs", testQuery("q"), "", "", func() (interface{}, error) { return 1, nil })
+	if v != 1 || err != nil {
+		t.Errorf("nil cache: got %v, %v", v, err)
+	}
+	nilCache.reset()
+}
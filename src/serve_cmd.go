@@ -0,0 +1,546 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"sourcegraph.com/sourcegraph/srclib/flagutil"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/metrics"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/store/storepb"
+)
+
+func init() {
+	_, err := CLI.AddCommand("serve",
+		"serve the store query API",
+		`The serve command runs a server that answers def, ref, doc, and search queries against the build data in the store.
+
+With --grpc, it serves the Query gRPC service (defined in store/storepb/query.proto), which returns the same results as "src store defs", "src store refs", and "src search" as typed, streamed messages. With --http, it serves the /subscribe WebSocket endpoint (which notifies clients of newly imported commits), health checks (/healthz and /readyz), Prometheus metrics (/metrics), def queries as JSON (/defs), and the freshness of each repository's index (/freshness).
+
+Without --acl, there is no authentication, so use a loopback address unless the store's data is public. With --acl FILE, clients must send a bearer token, and every query is restricted to the repos that the client may read. Queries are limited by --max-results, --max-query-time, and --max-concurrent-queries, and their results are cached (see --cache-size and --cache-ttl). With --config FILE, a JSON file overrides the limits, preloaded versions, and clones, and lists other stores to federate with. On SIGHUP (or a POST to /reload), the server reloads the --config, --acl, and --webhooks files without restarting.
+
+Without --imports, the server opens the store read-only, so that any number of servers can serve a store while a single process imports into it. With --imports (and --http), it queues and runs imports of build data uploaded to /imports; with --webhooks FILE, it also clones, builds, and imports the commits of the Git host push webhooks that it receives at /webhooks.
+
+The endpoints and the formats of the ACL, config, and webhooks files are documented in docs/sources/api/serve.md.
+
+(For queries at positions in files being edited, see "src daemon".)`,
+		&serveCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type ServeCmd struct {
+	GRPC string `long:"grpc" description:"gRPC listen address (e.g., localhost:3083)" value-name:"ADDR"`
+	HTTP string `long:"http" description:"HTTP listen address for the /subscribe WebSocket endpoint and health checks (e.g., localhost:3084)" value-name:"ADDR"`
+
+	PollInterval time.Duration `long:"poll-interval" description:"how often to check the store for newly imported commits" default:"5s"`
+
+	ACL string `long:"acl" description:"JSON file listing the clients' tokens and the repos that each may read (see docs/sources/api/serve.md)" value-name:"FILE"`
+
+	Config string `long:"config" description:"JSON file of settings that override the flags and are reloaded on SIGHUP or POST /reload (see docs/sources/api/serve.md)" value-name:"FILE"`
+
+	MaxResults           int           `long:"max-results" description:"max defs or refs returned by a query (0 for no limit)" default:"10000"`
+	MaxQueryTime         time.Duration `long:"max-query-time" description:"max wall time of a query (0 for no limit)" default:"30s"`
+	MaxConcurrentQueries int           `long:"max-concurrent-queries" description:"max concurrent queries per client (0 for no limit)" default:"4"`
+
+	CacheSize int           `long:"cache-size" description:"max number of query results to cache (0 to disable caching)" default:"1000"`
+	CacheTTL  time.Duration `long:"cache-ttl" description:"max age of cached query results (0 for no limit)" default:"1m"`
+
+	Preload []string `long:"preload" description:"read the indexes of REPO@COMMIT into memory at startup and keep them there (may be repeated)" value-name:"REPO@COMMIT"`
+
+	Clones             []string `long:"clone" description:"read snippets of REPO's defs and refs from the local clone in DIR (may be repeated)" value-name:"REPO=DIR"`
+	NoAncestorFallback bool     `long:"no-ancestor-fallback" description:"don't query the newest indexed ancestor (in the repo's local clone) of a queried commit that isn't indexed"`
+	SnippetCacheSize   int      `long:"snippet-cache-size" description:"max number of files to cache for snippets (0 to disable caching)" default:"1000"`
+
+	Imports         bool   `long:"imports" description:"accept uploads of build data at /imports and import them into the store in the background (opens the store read-write; requires --http)"`
+	ImportQueueSize int    `long:"import-queue-size" description:"max number of queued imports" default:"100"`
+	ImportWorkers   int    `long:"import-workers" description:"max number of import jobs to run (build) at once" default:"1"`
+	ImportRepoLimit int    `long:"import-repo-concurrency" description:"max number of import jobs of each repo to run at once (0 for no limit)" default:"1"`
+	MaxUploadSize   string `long:"max-upload-size" description:"max size of an uploaded build data archive, and of its extracted files (e.g., 512MB; 0 for no limit)" default:"1GB"`
+
+	Webhooks string `long:"webhooks" description:"JSON file listing the repos to clone, build, and import when their Git host's push webhooks are received at /webhooks (see docs/sources/api/serve.md; requires --imports)" value-name:"FILE"`
+
+	CloneCache       string        `long:"clone-cache" description:"dir of the bare clones that webhook builds check out commits from" default:"srclib-clones" value-name:"DIR"`
+	CloneCacheSize   string        `long:"clone-cache-size" description:"max total size of the clone cache (e.g., 20GB; 0 for no limit)" default:"20GB"`
+	CloneCacheMaxAge time.Duration `long:"clone-cache-max-age" description:"remove clones that haven't been used for this long (0 for no limit)" default:"168h"`
+}
+
+var serveCmd ServeCmd
+
+func (c *ServeCmd) Execute(args []string) error {
+	if c.GRPC == "" && c.HTTP == "" {
+		return errors.New("no server to run (specify --grpc or --http)")
+	}
+
+	if c.Imports && c.HTTP == "" {
+		return errors.New("--imports requires --http")
+	}
+	if c.Webhooks != "" && !c.Imports {
+		return errors.New("--webhooks requires --imports")
+	}
+	var maxUploadSize uint64
+	if c.Imports {
+		var err error
+		if maxUploadSize, err = flagutil.ParseByteSize(c.MaxUploadSize); err != nil {
+			return fmt.Errorf("--max-upload-size: %s", err)
+		}
+		if c.ImportWorkers < 1 {
+			return errors.New("--import-workers must be at least 1")
+		}
+	}
+	var clones *cloneCache
+	if c.Webhooks != "" {
+		maxSize, err := flagutil.ParseByteSize(c.CloneCacheSize)
+		if err != nil {
+			return fmt.Errorf("--clone-cache-size: %s", err)
+		}
+		dir, err := filepath.Abs(c.CloneCache)
+		if err != nil {
+			return err
+		}
+		clones = newCloneCache(dir, maxSize, c.CloneCacheMaxAge)
+	}
+
+	// The server only writes to the store if it imports. It opens the
+	// store once, so that preloaded indexes are kept for all queries.
+	storeCmd.ReadOnly = !c.Imports
+	stor, err := OpenStore()
+	if err != nil {
+		return err
+	}
+	var cache *queryCache
+	if c.GRPC != "" && c.CacheSize > 0 {
+		cache = newQueryCache(c.CacheSize, c.CacheTTL)
+	}
+	var imports *importQueue
+	if c.Imports {
+		imports = newImportQueue(stor, c.ImportQueueSize, c.ImportWorkers, c.ImportRepoLimit)
+	}
+	snippets = newSnippetReader(c.SnippetCacheSize)
+	r := newServeReloader(c, stor, cache)
+	if c.Webhooks != "" {
+		src, err := srcExecutable()
+		if err != nil {
+			return fmt.Errorf("--webhooks: %s", err)
+		}
+		r.webhooks = newWebhookHandler(imports, clones, src)
+	}
+	OpenStore = r.store
+	if err := r.load(); err != nil {
+		return err
+	}
+	acl := r.acl
+	if acl != nil {
+		if _, ok := stor.(store.MultiRepoStore); !ok {
+			return fmt.Errorf("--acl requires a MultiRepoStore (the store has type %T)", stor)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 4)
+	go r.reloadOnSIGHUP(ctx)
+
+	if imports != nil {
+		go func() { errc <- imports.run(ctx) }()
+	}
+	if clones != nil {
+		go clones.run(ctx)
+	}
+
+	// The watcher invalidates the cache and notifies subscribers.
+	var w *indexWatcher
+	if c.HTTP != "" || cache != nil {
+		w = newIndexWatcher(c.PollInterval)
+		w.imports = imports
+		if cache != nil {
+			w.onUpdate = cache.invalidate
+		}
+		go func() { errc <- w.run(ctx) }()
+	}
+
+	qs := queryServer{cache: cache, fallback: !c.NoAncestorFallback}
+	if c.GRPC != "" {
+		l, err := net.Listen("tcp", c.GRPC)
+		if err != nil {
+			return err
+		}
+		// Authenticate before applying the limits, which are per
+		// client.
+		unary := []grpc.UnaryServerInterceptor{metricsUnaryInterceptor}
+		stream := []grpc.StreamServerInterceptor{metricsStreamInterceptor}
+		if acl != nil {
+			unary = append(unary, acl.unaryInterceptor)
+			stream = append(stream, acl.streamInterceptor)
+		}
+		unary = append(unary, r.limiter.unaryInterceptor)
+		stream = append(stream, r.limiter.streamInterceptor)
+		s := grpc.NewServer(grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
+		storepb.RegisterQueryServer(s, qs)
+		log.Printf("Serving gRPC on %s.", l.Addr())
+		go func() { errc <- s.Serve(l) }()
+	}
+	if c.HTTP != "" {
+		log.Printf("Serving HTTP on %s.", c.HTTP)
+		mux := w.httpHandler(acl, r.serveReload)
+		mux.HandleFunc("/defs", func(rw http.ResponseWriter, req *http.Request) { qs.serveDefs(rw, req, acl, r.limiter) })
+		mux.Handle("/metrics", metrics.Handler())
+		if imports != nil {
+			handleImports := func(rw http.ResponseWriter, r *http.Request) { imports.serveImports(rw, r, acl, int64(maxUploadSize)) }
+			mux.HandleFunc("/imports", handleImports)
+			mux.HandleFunc("/imports/", handleImports)
+		}
+		if r.webhooks != nil {
+			mux.Handle("/webhooks", r.webhooks)
+		}
+		go func() { errc <- http.ListenAndServe(c.HTTP, mux) }()
+	}
+	return <-errc
+}
+
+// queryServer implements storepb.QueryServer using the same store
+// queries as the "src store" and "src search" commands.
+type queryServer struct {
+	cache    *queryCache // nil if caching is disabled
+	fallback bool        // query indexed ancestors of commits that aren't indexed
+}
+
+var _ storepb.QueryServer = queryServer{}
+
+// queryError converts an error from a store query to a gRPC error.
+func queryError(err error) error {
+	switch {
+	case os.IsNotExist(err):
+		return status.Error(codes.NotFound, err.Error())
+	case store.IsCorrupt(err):
+		return status.Error(codes.DataLoss, err.Error())
+	}
+	return err
+}
+
+// checkUnit returns an error unless both or neither of unitType and
+// unit are set. (The store commands exit if they aren't.)
+func checkUnit(unitType, unit string) error {
+	if (unitType == "") != (unit == "") {
+		return status.Error(codes.InvalidArgument, "must specify either both or neither of UnitType and Unit")
+	}
+	return nil
+}
+
+func (s queryServer) Def(ctx context.Context, key *graph.DefKey) (*graph.Def, error) {
+	if key.UnitType == "" || key.Unit == "" || key.Path == "" {
+		return nil, status.Error(codes.InvalidArgument, "UnitType, Unit, and Path are required")
+	}
+	commitID, err := s.resolveCommit(ctx, key.Repo, key.CommitID)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	if commitID != key.CommitID {
+		k := *key
+		k.CommitID = commitID
+		key = &k
+	}
+	v, err := s.cache.cached(ctx, "Def", key, key.Repo, key.CommitID, func() (interface{}, error) {
+		scope, err := repoScope(ctx, key.Repo)
+		if err != nil {
+			return nil, err
+		}
+		var defs []*graph.Def
+		err = budgetFromContext(ctx).run(ctx, func() (err error) {
+			defs, err = (&StoreDefsCmd{
+				Repo:     key.Repo,
+				CommitID: key.CommitID,
+				UnitType: key.UnitType,
+				Unit:     key.Unit,
+				Path:     key.Path,
+				Filter:   scope,
+				ctx:      ctx,
+			}).Get()
+			return err
+		})
+		return defs, err
+	})
+	if err != nil {
+		return nil, queryError(err)
+	}
+	defs := v.([]*graph.Def)
+	if len(defs) == 0 {
+		return nil, status.Errorf(codes.NotFound, "def not found: %s %s %s", key.UnitType, key.Unit, key.Path)
+	}
+	return defs[0], nil
+}
+
+func (s queryServer) Defs(opt *storepb.DefsOptions, stream storepb.Query_DefsServer) error {
+	if err := checkUnit(opt.UnitType, opt.Unit); err != nil {
+		return err
+	}
+	if opt.Where != "" {
+		if _, err := store.ParseDefExpr(opt.Where); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	ctx := stream.Context()
+	budget := budgetFromContext(ctx)
+	commitID, err := s.resolveCommit(ctx, opt.Repo, opt.CommitID)
+	if err != nil {
+		return queryError(err)
+	}
+	if commitID != opt.CommitID {
+		o := *opt
+		o.CommitID = commitID
+		opt = &o
+	}
+	v, err := s.cache.cached(ctx, "Defs", opt, opt.Repo, opt.CommitID, func() (interface{}, error) {
+		scope, err := repoScope(ctx, opt.Repo)
+		if err != nil {
+			return nil, err
+		}
+		var defs []*graph.Def
+		err = budget.run(ctx, func() (err error) {
+			defs, err = (&StoreDefsCmd{
+				Repo:     opt.Repo,
+				CommitID: opt.CommitID,
+				UnitType: opt.UnitType,
+				Unit:     opt.Unit,
+				File:     opt.File,
+				Path:     opt.Path,
+				Query:    opt.Query,
+				Fuzzy:    opt.Fuzzy,
+				Where:    opt.Where,
+				Limit:    budget.limit(opt.Limit),
+				Offset:   opt.Offset,
+				Filter:   scope,
+				ctx:      ctx,
+
+				FollowAliases: opt.FollowAliases,
+				Snippets:      opt.Snippets,
+				ContextLines:  opt.ContextLines,
+			}).Get()
+			return err
+		})
+		return defs, err
+	})
+	if err != nil {
+		return queryError(err)
+	}
+	defs := v.([]*graph.Def)
+	budget.setTruncated(stream, opt.Limit, len(defs))
+	for _, def := range defs {
+		if err := stream.Send(def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s queryServer) Refs(opt *storepb.RefsOptions, stream storepb.Query_RefsServer) error {
+	if err := checkUnit(opt.UnitType, opt.Unit); err != nil {
+		return err
+	}
+	if opt.Linked && opt.Def.DefPath == "" {
+		return status.Error(codes.InvalidArgument, "Linked requires Def.DefPath")
+	}
+	if opt.FollowAliases && opt.Def.DefPath == "" {
+		return status.Error(codes.InvalidArgument, "FollowAliases requires Def.DefPath")
+	}
+	if !graph.ValidConfidence(opt.MinConfidence) {
+		return status.Error(codes.InvalidArgument, "MinConfidence must be between 0 and 1")
+	}
+	ctx := stream.Context()
+	budget := budgetFromContext(ctx)
+	commitID, err := s.resolveCommit(ctx, opt.Repo, opt.CommitID)
+	if err != nil {
+		return queryError(err)
+	}
+	if commitID != opt.CommitID {
+		o := *opt
+		o.CommitID = commitID
+		opt = &o
+	}
+	v, err := s.cache.cached(ctx, "Refs", opt, opt.Repo, opt.CommitID, func() (interface{}, error) {
+		scope, err := repoScope(ctx, opt.Repo)
+		if err != nil {
+			return nil, err
+		}
+		var refs []*graph.Ref
+		err = budget.run(ctx, func() (err error) {
+			refs, err = (&StoreRefsCmd{
+				Repo:        opt.Repo,
+				CommitID:    opt.CommitID,
+				UnitType:    opt.UnitType,
+				Unit:        opt.Unit,
+				File:        opt.File,
+				Start:       opt.Start,
+				End:         opt.End,
+				DefRepo:     opt.Def.DefRepo,
+				DefUnitType: opt.Def.DefUnitType,
+				DefUnit:     opt.Def.DefUnit,
+				DefPath:     opt.Def.DefPath,
+				Linked:      opt.Linked,
+				Limit:       budget.limit(opt.Limit),
+				Offset:      opt.Offset,
+				Filter:      scope,
+				ctx:         ctx,
+
+				FollowAliases:    opt.FollowAliases,
+				MinConfidence:    opt.MinConfidence,
+				SortByConfidence: opt.SortByConfidence,
+				Snippets:         opt.Snippets,
+				ContextLines:     opt.ContextLines,
+			}).Get()
+			return err
+		})
+		return refs, err
+	})
+	if err != nil {
+		return queryError(err)
+	}
+	refs := v.([]*graph.Ref)
+	if n := budget.limit(opt.Limit); n > 0 && len(refs) > n {
+		refs = refs[:n] // linked defs' and aliases' refs are limited separately
+	}
+	budget.setTruncated(stream, opt.Limit, len(refs))
+	for _, ref := range refs {
+		if err := stream.Send(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s queryServer) Docs(key *graph.DefKey, stream storepb.Query_DocsServer) error {
+	def, err := s.Def(stream.Context(), key)
+	if err != nil {
+		return err
+	}
+	for i := range def.Docs {
+		if err := stream.Send(&def.Docs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s queryServer) Search(opt *storepb.SearchOptions, stream storepb.Query_SearchServer) error {
+	if opt.Query == "" {
+		return status.Error(codes.InvalidArgument, "empty query")
+	}
+	if err := checkUnit(opt.UnitType, opt.Unit); err != nil {
+		return err
+	}
+	ctx := stream.Context()
+	budget := budgetFromContext(ctx)
+	commitID, err := s.resolveCommit(ctx, opt.Repo, opt.CommitID)
+	if err != nil {
+		return queryError(err)
+	}
+	if commitID != opt.CommitID {
+		o := *opt
+		o.CommitID = commitID
+		opt = &o
+	}
+	v, err := s.cache.cached(ctx, "Search", opt, opt.Repo, opt.CommitID, func() (interface{}, error) {
+		scope, err := repoScope(ctx, opt.Repo)
+		if err != nil {
+			return nil, err
+		}
+		var defs []*graph.Def
+		err = budget.run(ctx, func() (err error) {
+			defs, err = (&StoreDefsCmd{
+				Repo:     opt.Repo,
+				CommitID: opt.CommitID,
+				UnitType: opt.UnitType,
+				Unit:     opt.Unit,
+				File:     opt.File,
+				Query:    opt.Query,
+				Fuzzy:    opt.Fuzzy,
+				Limit:    budget.limit(opt.Limit),
+				Filter:   scope,
+				ctx:      ctx,
+
+				Snippets:     opt.Snippets,
+				ContextLines: opt.ContextLines,
+			}).Get()
+			return err
+		})
+		return defs, err
+	})
+	if err != nil {
+		return queryError(err)
+	}
+	defs := v.([]*graph.Def)
+	budget.setTruncated(stream, opt.Limit, len(defs))
+	for _, def := range defs {
+		if err := stream.Send(def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s queryServer) Warnings(opt *storepb.WarningsOptions, stream storepb.Query_WarningsServer) error {
+	if opt.CommitID == "" {
+		return status.Error(codes.InvalidArgument, "CommitID is required")
+	}
+	if err := checkUnit(opt.UnitType, opt.Unit); err != nil {
+		return err
+	}
+	if !graph.ValidSeverity(opt.Severity) {
+		return status.Errorf(codes.InvalidArgument, "invalid Severity %q", opt.Severity)
+	}
+	ctx := stream.Context()
+	budget := budgetFromContext(ctx)
+	commitID, err := s.resolveCommit(ctx, opt.Repo, opt.CommitID)
+	if err != nil {
+		return queryError(err)
+	}
+	if commitID != opt.CommitID {
+		o := *opt
+		o.CommitID = commitID
+		opt = &o
+	}
+	v, err := s.cache.cached(ctx, "Warnings", opt, opt.Repo, opt.CommitID, func() (interface{}, error) {
+		if _, err := repoScope(ctx, opt.Repo); err != nil {
+			return nil, err
+		}
+		stor, err := OpenStore()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := stor.(store.MultiRepoWarner); ok && opt.Repo == "" {
+			return nil, status.Error(codes.InvalidArgument, "Repo is required (the store is a MultiRepoStore)")
+		}
+		var warnings []*graph.Warning
+		err = budget.run(ctx, func() (err error) {
+			warnings, err = openWarnings(stor, opt.Repo, opt.CommitID)
+			return err
+		})
+		return warnings, err
+	})
+	if err != nil {
+		return queryError(err)
+	}
+	for _, w := range v.([]*graph.Warning) {
+		if (opt.UnitType != "" && (w.UnitType != opt.UnitType || w.Unit != opt.Unit)) || (opt.File != "" && w.File != opt.File) || (opt.Severity != "" && w.Severity != opt.Severity) {
+			continue
+		}
+		if err := stream.Send(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package src
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store/storepb"
+)
+
+// testStream records the trailer of a server stream.
+type testStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	trailer metadata.MD
+}
+
+func (s *testStream) Context() context.Context     { return s.ctx }
+func (s *testStream) SetTrailer(md metadata.MD)    { s.trailer = metadata.Join(s.trailer, md) }
+func (s *testStream) SetHeader(metadata.MD) error  { return nil }
+func (s *testStream) SendHeader(metadata.MD) error { return nil }
+
+type testDefsStream struct {
+	testStream
+	defs []*graph.Def
+}
+
+func (s *testDefsStream) Send(def *graph.Def) error {
+	s.defs = append(s.defs, def)
+	return nil
+}
+
+type testRefsStream struct {
+	testStream
+	refs []*graph.Ref
+}
+
+func (s *testRefsStream) Send(ref *graph.Ref) error {
+	s.refs = append(s.refs, ref)
+	return nil
+}
+
+func TestQueryServer_invalidArgument(t *testing.T) {
+	defer openStreamTestStore(t, nil)()
+	s := queryServer{}
+	ctx := context.Background()
+	defs := func() *testDefsStream { return &testDefsStream{testStream: testStream{ctx: ctx}} }
+	refs := func() *testRefsStream { return &testRefsStream{testStream: testStream{ctx: ctx}} }
+
+	tests := map[string]func() error{
+		"Def without path": func() error {
+			_, err := s.Def(ctx, &graph.DefKey{UnitType: "t", Unit: "u1"})
+			return err
+		},
+		"Defs with unit type only": func() error {
+			return s.Defs(&storepb.DefsOptions{UnitType: "t"}, defs())
+		},
+		"Defs with invalid Where": func() error {
+			return s.Defs(&storepb.DefsOptions{Where: "(kind:func"}, defs())
+		},
+		"Refs with unit only": func() error {
+			return s.Refs(&storepb.RefsOptions{Unit: "u1"}, refs())
+		},
+		"Refs Linked without def": func() error {
+			return s.Refs(&storepb.RefsOptions{Linked: true}, refs())
+		},
+		"Refs FollowAliases without def": func() error {
+			return s.Refs(&storepb.RefsOptions{FollowAliases: true}, refs())
+		},
+		"Refs with invalid MinConfidence": func() error {
+			return s.Refs(&storepb.RefsOptions{MinConfidence: 2}, refs())
+		},
+		"Search without query": func() error {
+			return s.Search(&storepb.SearchOptions{}, defs())
+		},
+		"Warnings without commit": func() error {
+			return s.Warnings(&storepb.WarningsOptions{}, nil)
+		},
+	}
+	for label, call := range tests {
+		if err := call(); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: got error %v, want InvalidArgument", label, err)
+		}
+	}
+}
+
+func TestQueryServer_Def(t *testing.T) {
+	defer openStreamTestStore(t, nil)()
+	s := queryServer{}
+
+	def, err := s.Def(context.Background(), &graph.DefKey{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u1", Path: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if def.Unit != "u1" || def.Path != "b" {
+		t.Errorf("got def %+v, want u1's def b", def)
+	}
+
+	_, err = s.Def(context.Background(), &graph.DefKey{Repo: "r", CommitID: "c", UnitType: "t", Unit: "u1", Path: "c"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("got error %v for nonexistent def, want NotFound", err)
+	}
+}
+
+func TestQueryServer_Defs(t *testing.T) {
+	defer openStreamTestStore(t, nil)()
+	s := queryServer{}
+
+	tests := map[string]struct {
+		opt  storepb.DefsOptions
+		want []string
+	}{
+		"all":   {want: []string{"u1.a", "u1.b", "u2.c"}},
+		"unit":  {opt: storepb.DefsOptions{UnitType: "t", Unit: "u2"}, want: []string{"u2.c"}},
+		"path":  {opt: storepb.DefsOptions{Path: "b"}, want: []string{"u1.b"}},
+		"query": {opt: storepb.DefsOptions{Query: "b"}, want: []string{"u1.b"}},
+	}
+	for label, test := range tests {
+		stream := &testDefsStream{testStream: testStream{ctx: context.Background()}}
+		opt := test.opt
+		if err := s.Defs(&opt, stream); err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		var got []string
+		for _, def := range stream.defs {
+			got = append(got, def.Unit+"."+def.Path)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got defs %v, want %v", label, got, test.want)
+		}
+	}
+}
+
+func TestQueryServer_Defs_maxResults(t *testing.T) {
+	defer openStreamTestStore(t, nil)()
+	s := queryServer{}
+
+	tests := map[string]struct {
+		limit         int
+		want          int
+		wantTruncated bool
+	}{
+		"no limit":    {want: 2, wantTruncated: true},
+		"over max":    {limit: 3, want: 2, wantTruncated: true},
+		"under max":   {limit: 1, want: 1},
+		"exactly max": {limit: 2, want: 2},
+	}
+	for label, test := range tests {
+		ctx, end, err := newQueryLimiter(queryLimits{maxResults: 2}).begin(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream := &testDefsStream{testStream: testStream{ctx: ctx}}
+		err = s.Defs(&storepb.DefsOptions{Limit: test.limit}, stream)
+		end()
+		if err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		if len(stream.defs) != test.want {
+			t.Errorf("%s: got %d defs, want %d", label, len(stream.defs), test.want)
+		}
+		if truncated := len(stream.trailer.Get("srclib-truncated")) > 0; truncated != test.wantTruncated {
+			t.Errorf("%s: got truncated %v, want %v", label, truncated, test.wantTruncated)
+		}
+	}
+}
+
+func TestQueryServer_Refs(t *testing.T) {
+	defer openStreamTestStore(t, nil)()
+	s := queryServer{}
+
+	tests := map[string]struct {
+		opt  storepb.RefsOptions
+		want []string // the refs' defs
+	}{
+		"all":          {want: []string{"u1.a", "u1.b", "u2.c"}},
+		"def":          {opt: storepb.RefsOptions{Def: graph.RefDefKey{DefRepo: "r", DefUnitType: "t", DefUnit: "u1", DefPath: "a"}}, want: []string{"u1.a"}},
+		"no refs":      {opt: storepb.RefsOptions{UnitType: "t", Unit: "u1"}},
+		"other commit": {opt: storepb.RefsOptions{CommitID: "c2"}},
+	}
+	for label, test := range tests {
+		stream := &testRefsStream{testStream: testStream{ctx: context.Background()}}
+		opt := test.opt
+		if err := s.Refs(&opt, stream); err != nil {
+			t.Errorf("%s: %s", label, err)
+			continue
+		}
+		var got []string
+		for _, ref := range stream.refs {
+			got = append(got, ref.DefUnit+"."+ref.DefPath)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got refs to %v, want refs to %v", label, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package src
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store/storepb"
+)
+
+// serveDefs handles GET /defs, which queries defs as the gRPC
+// Query.Defs method does, for clients that don't speak gRPC. The query
+// parameters are the DefsOptions fields, named like the "src store
+// defs" flags (e.g., "/defs?repo=R&commit=C&where=kind:func+exported:true").
+// It responds with a JSON array of the defs, and sets the "Srclib-*"
+// headers that correspond to the gRPC trailers (e.g.,
+// "Srclib-Truncated: true"). Queries are authenticated and limited as
+// gRPC queries are.
+func (s queryServer) serveDefs(rw http.ResponseWriter, r *http.Request, acl *serveACL, limiter *queryLimiter) {
+	if r.Method != "GET" {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+	if acl != nil {
+		client := acl.authenticateHTTP(r)
+		if client == nil {
+			http.Error(rw, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		ctx = context.WithValue(ctx, serveClientKey{}, client)
+	}
+	opt, err := defsOptionsFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, end, err := limiter.begin(ctx)
+	if err != nil {
+		httpQueryError(rw, err)
+		return
+	}
+	defer end()
+	stream := &httpDefsStream{}
+	stream.ctx = grpc.NewContextWithServerTransportStream(ctx, httpTransportStream{stream})
+	start := time.Now()
+	err = s.Defs(opt, stream)
+	observeQuery("Defs", start, err)
+	if err != nil {
+		httpQueryError(rw, err)
+		return
+	}
+	for k, v := range stream.trailer {
+		rw.Header()[http.CanonicalHeaderKey(k)] = v
+	}
+	if stream.defs == nil {
+		stream.defs = []*graph.Def{}
+	}
+	writeJSON(rw, http.StatusOK, stream.defs)
+}
+
+// defsOptionsFromQuery returns the DefsOptions in the query parameters
+// of a /defs request.
+func defsOptionsFromQuery(q url.Values) (*storepb.DefsOptions, error) {
+	opt := &storepb.DefsOptions{
+		Repo:     q.Get("repo"),
+		CommitID: q.Get("commit"),
+		UnitType: q.Get("unit-type"),
+		Unit:     q.Get("unit"),
+		File:     q.Get("file"),
+		Path:     q.Get("path"),
+		Query:    q.Get("query"),
+		Where:    q.Get("where"),
+	}
+	for name, p := range map[string]*bool{"fuzzy": &opt.Fuzzy, "snippets": &opt.Snippets, "follow-aliases": &opt.FollowAliases} {
+		if v := q.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "%s must be true or false", name)
+			}
+			*p = b
+		}
+	}
+	for name, p := range map[string]*int{"limit": &opt.Limit, "offset": &opt.Offset, "context-lines": &opt.ContextLines} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, status.Errorf(codes.InvalidArgument, "%s must be a non-negative integer", name)
+			}
+			*p = n
+		}
+	}
+	return opt, nil
+}
+
+// httpQueryError writes the error from a query to an HTTP client, with
+// the HTTP status that corresponds to its gRPC code.
+func httpQueryError(rw http.ResponseWriter, err error) {
+	st := status.Convert(queryError(err))
+	code := http.StatusInternalServerError
+	switch st.Code() {
+	case codes.InvalidArgument:
+		code = http.StatusBadRequest
+	case codes.Unauthenticated:
+		code = http.StatusUnauthorized
+	case codes.PermissionDenied:
+		code = http.StatusForbidden
+	case codes.NotFound:
+		code = http.StatusNotFound
+	case codes.ResourceExhausted:
+		code = http.StatusTooManyRequests
+	case codes.DeadlineExceeded:
+		code = http.StatusGatewayTimeout
+	}
+	http.Error(rw, st.Message(), code)
+}
+
+// httpDefsStream is a storepb.Query_DefsServer that collects the defs
+// and trailers of a query for an HTTP response.
+type httpDefsStream struct {
+	ctx     context.Context
+	defs    []*graph.Def
+	trailer metadata.MD
+}
+
+func (s *httpDefsStream) Send(def *graph.Def) error {
+	s.defs = append(s.defs, def)
+	return nil
+}
+
+func (s *httpDefsStream) SetHeader(metadata.MD) error  { return nil }
+func (s *httpDefsStream) SendHeader(metadata.MD) error { return nil }
+func (s *httpDefsStream) SetTrailer(md metadata.MD)    { s.trailer = metadata.Join(s.trailer, md) }
+func (s *httpDefsStream) Context() context.Context     { return s.ctx }
+func (s *httpDefsStream) SendMsg(m interface{}) error  { return s.Send(m.(*graph.Def)) }
+func (s *httpDefsStream) RecvMsg(m interface{}) error  { return nil }
+
+// httpTransportStream records the trailers that are set with
+// grpc.SetTrailer (e.g., by resolveCommit) in an httpDefsStream.
+type httpTransportStream struct{ s *httpDefsStream }
+
+func (t httpTransportStream) Method() string               { return "/storepb.Query/Defs" }
+func (t httpTransportStream) SetHeader(metadata.MD) error  { return nil }
+func (t httpTransportStream) SendHeader(metadata.MD) error { return nil }
+func (t httpTransportStream) SetTrailer(md metadata.MD) error {
+	t.s.SetTrailer(md)
+	return nil
+}
+
+var _ storepb.Query_DefsServer = (*httpDefsStream)(nil)
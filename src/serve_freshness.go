@@ -0,0 +1,268 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+// maxFallbackAncestors is the number of ancestors of a commit that the
+// server searches for the newest indexed commit (for queries of
+// commits that aren't indexed, and for /freshness).
+const maxFallbackAncestors = 1000
+
+// indexedCommits returns the commits of repo ("" for a RepoStore) that
+// are in the store.
+func indexedCommits(stor interface{}, repo string) (map[string]bool, error) {
+	rs, ok := stor.(store.RepoStore)
+	if !ok {
+		return nil, fmt.Errorf("store (type %T) does not implement listing versions", stor)
+	}
+	var fs []store.VersionFilter
+	if repo != "" {
+		fs = append(fs, store.ByRepos(repo))
+	}
+	versions, err := rs.Versions(fs...)
+	if err != nil {
+		return nil, err
+	}
+	indexed := make(map[string]bool, len(versions))
+	for _, v := range versions {
+		indexed[v.CommitID] = true
+	}
+	return indexed, nil
+}
+
+// newestIndexed returns the index of the first (newest) of revs that
+// is indexed, or -1 if none are.
+func newestIndexed(revs []revision, indexed map[string]bool) int {
+	for i, r := range revs {
+		if indexed[r.commitID] {
+			return i
+		}
+	}
+	return -1
+}
+
+// isFullCommitID returns whether s is a full (40- or 64-digit hex)
+// commit ID, as opposed to a branch or an abbreviated ID.
+func isFullCommitID(s string) bool {
+	if len(s) != 40 && len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveCommit returns the commit to query for a query of repo at
+// commitID. That is commitID, unless it isn't indexed and the server
+// has a local clone of repo (see --clone) in which one of its
+// ancestors is: then it is that (newest indexed) ancestor, and the
+// response's "srclib-stale" trailer is "true" and its
+// "srclib-commit-id" trailer is the ancestor.
+//
+// The store's version list doesn't include the commits of federated
+// gRPC stores, so commits that only they have are never resolved
+// (queries of them fall back to no ancestor or to a local one).
+func (s queryServer) resolveCommit(ctx context.Context, repo, commitID string) (string, error) {
+	if !s.fallback || !isFullCommitID(commitID) {
+		return commitID, nil
+	}
+	if _, err := repoScope(ctx, repo); err != nil {
+		return "", err
+	}
+	c := snippets.localClone(repo)
+	if c == nil {
+		return commitID, nil
+	}
+	stor, err := OpenStore()
+	if err != nil {
+		return "", err
+	}
+	indexed, err := indexedCommits(stor, repo)
+	if err != nil || indexed[commitID] {
+		return commitID, nil
+	}
+	revs, err := logRevisions(c.vcsType, c.dir, commitID, maxFallbackAncestors)
+	if err != nil {
+		// The commit may not have been fetched into the clone yet.
+		logutil.Default.Debug("Failed to find an indexed ancestor.", "repo", repo, "commit", commitID, "err", err)
+		return commitID, nil
+	}
+	i := newestIndexed(revs, indexed)
+	if i == -1 {
+		return commitID, nil
+	}
+	ancestor := revs[i].commitID
+	grpc.SetTrailer(ctx, metadata.Pairs("srclib-stale", "true", "srclib-commit-id", ancestor))
+	if GlobalOpt.Verbose {
+		log.Printf("Commit %s of %s isn't indexed; querying its ancestor %s (%d commits behind).", commitID, repo, ancestor, i)
+	}
+	return ancestor, nil
+}
+
+// importTime returns when the commit was imported, or nil if the store
+// doesn't record import times (see store.RepoImportTimer).
+func importTime(s interface{}, repo, commitID string) (*time.Time, error) {
+	var t time.Time
+	var err error
+	switch s := s.(type) {
+	case store.MultiRepoImportTimer:
+		t, err = s.ImportTime(repo, commitID)
+	case store.RepoImportTimer:
+		t, err = s.ImportTime(commitID)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// branchFreshness is the freshness of a repo's index on one of its
+// branches (of the repo's local clone; see --clone), or of a repo
+// without a local clone, in the response of /freshness.
+type branchFreshness struct {
+	Repo   string `json:",omitempty"` // empty for a RepoStore
+	Branch string `json:",omitempty"` // empty for a repo without a local clone
+	Head   string `json:",omitempty"` // the branch's head commit
+
+	// CommitID is the newest indexed commit of the branch (or, without
+	// a local clone, the most recently imported commit of the repo).
+	// It is empty if none of the branch's last maxFallbackAncestors
+	// commits are indexed.
+	CommitID  string     `json:",omitempty"`
+	Committed *time.Time `json:",omitempty"` // when CommitID was committed
+	Imported  *time.Time `json:",omitempty"` // when CommitID was imported
+
+	// Age is the time since CommitID was imported (e.g., "26h0m5s").
+	Age string `json:",omitempty"`
+
+	// Behind is the number of the branch's commits after CommitID
+	// (which, if CommitID is empty, is the number of commits that were
+	// searched). Stale is whether Head isn't indexed.
+	Behind int  `json:",omitempty"`
+	Stale  bool `json:",omitempty"`
+
+	// Error is why the freshness of the branches of the repo's local
+	// clone couldn't be determined.
+	Error string `json:",omitempty"`
+}
+
+// freshness returns the freshness of the indexes of the repos that
+// client (nil if the server has no ACL) may read, for each branch of
+// the repos that have local clones.
+func (w *indexWatcher) freshness(client *serveClient) ([]*branchFreshness, error) {
+	stor, err := OpenStore()
+	if err != nil {
+		return nil, err
+	}
+	repos, err := w.repoHealth(client)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var fs []*branchFreshness
+	for _, r := range repos {
+		c := snippets.localClone(r.Repo)
+		if c == nil {
+			f := &branchFreshness{Repo: r.Repo, CommitID: r.LatestCommitID, Imported: r.Imported}
+			f.setAge(now)
+			fs = append(fs, f)
+			continue
+		}
+		repoFs, err := repoFreshness(stor, r.Repo, c)
+		if err != nil {
+			fs = append(fs, &branchFreshness{Repo: r.Repo, Error: err.Error()})
+			continue
+		}
+		for _, f := range repoFs {
+			f.setAge(now)
+		}
+		fs = append(fs, repoFs...)
+	}
+	return fs, nil
+}
+
+// repoFreshness returns the freshness of the index of each branch of
+// repo's local clone.
+func repoFreshness(stor interface{}, repo string, c *repoClone) ([]*branchFreshness, error) {
+	branches, err := listBranches(c.vcsType, c.dir)
+	if err != nil {
+		return nil, err
+	}
+	indexed, err := indexedCommits(stor, repo)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(branches))
+	for name := range branches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fs := make([]*branchFreshness, 0, len(names))
+	for _, name := range names {
+		f := &branchFreshness{Repo: repo, Branch: name, Head: branches[name]}
+		revs, err := logRevisions(c.vcsType, c.dir, f.Head, maxFallbackAncestors)
+		if err != nil {
+			return nil, err
+		}
+		i := newestIndexed(revs, indexed)
+		if i == -1 {
+			f.Behind, f.Stale = len(revs), true
+		} else {
+			f.CommitID, f.Committed = revs[i].commitID, &revs[i].time
+			f.Behind, f.Stale = i, i > 0
+			if f.Imported, err = importTime(stor, repo, f.CommitID); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+func (f *branchFreshness) setAge(now time.Time) {
+	if f.Imported != nil {
+		f.Age = now.Sub(*f.Imported).Round(time.Second).String()
+	}
+}
+
+// serveFreshness handles requests to /freshness, which list the
+// freshness of each repo's index (see branchFreshness). With an ACL,
+// clients must authenticate, and only see the repos that they may
+// read.
+func (w *indexWatcher) serveFreshness(rw http.ResponseWriter, r *http.Request, acl *serveACL) {
+	var client *serveClient
+	if acl != nil {
+		if client = acl.authenticateHTTP(r); client == nil {
+			http.Error(rw, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+	}
+	fs, err := w.freshness(client)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if fs == nil {
+		fs = []*branchFreshness{}
+	}
+	writeJSON(rw, http.StatusOK, fs)
+}
@@ -0,0 +1,125 @@
+package src
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestIsFullCommitID(t *testing.T) {
+	tests := map[string]bool{
+		strings.Repeat("a", 40):       true,
+		strings.Repeat("F", 40):       true,
+		strings.Repeat("0", 64):       true,
+		strings.Repeat("a", 39):       false,
+		strings.Repeat("a", 41):       false,
+		strings.Repeat("g", 40):       false,
+		"master":                      false,
+		"abc123":                      false,
+		"":                            false,
+		strings.Repeat("a", 39) + "/": false,
+	}
+	for s, want := range tests {
+		if got := isFullCommitID(s); got != want {
+			t.Errorf("%q: got %v, want %v", s, got, want)
+		}
+	}
+}
+
+func TestNewestIndexed(t *testing.T) {
+	revs := []revision{{commitID: "c3"}, {commitID: "c2"}, {commitID: "c1"}}
+	tests := map[string]struct {
+		indexed map[string]bool
+		want    int
+	}{
+		"head":       {indexed: map[string]bool{"c3": true, "c1": true}, want: 0},
+		"ancestor":   {indexed: map[string]bool{"c2": true, "c1": true}, want: 1},
+		"oldest":     {indexed: map[string]bool{"c1": true}, want: 2},
+		"none":       {indexed: map[string]bool{"x": true}, want: -1},
+		"none empty": {want: -1},
+	}
+	for label, test := range tests {
+		if got := newestIndexed(revs, test.indexed); got != test.want {
+			t.Errorf("%s: got %d, want %d", label, got, test.want)
+		}
+	}
+}
+
+// gitTestRepo creates a git repo in a temp dir, and returns the dir
+// and a func that runs git in it and returns its trimmed output.
+func gitTestRepo(t *testing.T) (dir string, git func(args ...string) string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("no git command")
+	}
+	dir, err := ioutil.TempDir("", "srclib-git-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	git = func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=a", "GIT_AUTHOR_EMAIL=a@example.com", "GIT_COMMITTER_NAME=a", "GIT_COMMITTER_EMAIL=a@example.com")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %s\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q")
+	git("symbolic-ref", "HEAD", "refs/heads/master")
+	return dir, git
+}
+
+func TestRepoFreshness(t *testing.T) {
+	dir, git := gitTestRepo(t)
+	defer os.RemoveAll(dir)
+	commit := func(msg string) string {
+		git("commit", "-q", "--allow-empty", "-m", msg)
+		return git("rev-parse", "HEAD")
+	}
+	c1 := commit("c1")
+	c2 := commit("c2")
+	c3 := commit("c3")
+	git("branch", "indexed", c2)
+	git("checkout", "-q", "-b", "new", c1)
+	c4 := commit("c4")
+	git("checkout", "-q", "--orphan", "unindexed")
+	c5 := commit("c5")
+
+	s := store.NewFSMultiRepoStore(rwvfs.Walkable(rwvfs.Map(map[string]string{})), nil)
+	for _, commitID := range []string{c1, c2} {
+		if err := s.Import("r", commitID, &unit.SourceUnit{Type: "t", Name: "u"}, graph.Output{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := repoFreshness(s, "r", &repoClone{dir: dir, vcsType: "git"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []branchFreshness{
+		{Branch: "indexed", Head: c2, CommitID: c2},
+		{Branch: "master", Head: c3, CommitID: c2, Behind: 1, Stale: true},
+		{Branch: "new", Head: c4, CommitID: c1, Behind: 1, Stale: true},
+		{Branch: "unindexed", Head: c5, Behind: 1, Stale: true},
+	}
+	if len(fs) != len(want) {
+		t.Fatalf("got %d branches, want %d", len(fs), len(want))
+	}
+	for i, f := range fs {
+		w := want[i]
+		if f.Repo != "r" || f.Branch != w.Branch || f.Head != w.Head || f.CommitID != w.CommitID || f.Behind != w.Behind || f.Stale != w.Stale {
+			t.Errorf("branch %d: got %+v, want %+v", i, *f, w)
+		}
+		if (f.Committed != nil) != (w.CommitID != "") {
+			t.Errorf("branch %q: got commit time %v, want one only if a commit is indexed", f.Branch, f.Committed)
+		}
+	}
+}
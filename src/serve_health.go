@@ -0,0 +1,158 @@
+package src
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// serveHealth is the JSON response of /healthz and /readyz.
+type serveHealth struct {
+	// OK is whether the check passed (and the response status is
+	// 200).
+	OK bool
+
+	// Errors are the reasons that the check failed.
+	Errors []string `json:",omitempty"`
+
+	// LastPoll is when the server last listed the store's commits
+	// to detect imports (see --poll-interval).
+	LastPoll *time.Time `json:",omitempty"`
+
+	// Imports is the number of jobs in the server's import queue (with
+	// --imports) in each state.
+	Imports *importQueueStatus `json:",omitempty"`
+
+	// The fields below are only set for requests with "verbose" set
+	// (e.g., /readyz?verbose=1), and only list the repos that the
+	// client may read.
+
+	// Importing are the commits that are in the store but may still
+	// be importing.
+	Importing []indexUpdate `json:",omitempty"`
+
+	// Repos is the freshness of each repo's data.
+	Repos []*repoHealth `json:",omitempty"`
+}
+
+// repoHealth is the freshness of a repo's data in the store.
+type repoHealth struct {
+	Repo     string `json:",omitempty"` // empty for a RepoStore
+	Versions int    // number of commits
+
+	// LatestCommitID is the most recently imported commit, and
+	// Imported is when it was imported, if the store records import
+	// times (see store.RepoImportTimer).
+	LatestCommitID string     `json:",omitempty"`
+	Imported       *time.Time `json:",omitempty"`
+}
+
+// maxMissedPolls is the number of poll intervals after which the
+// server isn't ready if it hasn't listed the store's commits, since it
+// isn't detecting imports.
+const maxMissedPolls = 3
+
+// health returns the server's health. If ready, it also checks that
+// the server can list the store's commits (and has done so recently).
+// If verbose, it also reports the freshness of the repos that client
+// (nil if the server has no ACL) may read.
+func (w *indexWatcher) health(ready, verbose bool, client *serveClient) *serveHealth {
+	h := &serveHealth{}
+	if _, err := OpenStore(); err != nil {
+		h.Errors = append(h.Errors, fmt.Sprintf("opening store: %s", err))
+	}
+	st := w.importStatus()
+	if !st.polled.IsZero() {
+		h.LastPoll = &st.polled
+	}
+	if w.imports != nil {
+		is := w.imports.status()
+		h.Imports = &is
+	}
+	if ready {
+		switch {
+		case st.err != nil:
+			h.Errors = append(h.Errors, fmt.Sprintf("listing store commits: %s", st.err))
+		case st.polled.IsZero():
+			h.Errors = append(h.Errors, "store commits haven't been listed yet")
+		case time.Since(st.polled) > maxMissedPolls*w.interval:
+			h.Errors = append(h.Errors, fmt.Sprintf("store commits haven't been listed since %s", st.polled.Format(time.RFC3339)))
+		}
+	}
+	if verbose {
+		for _, u := range st.importing {
+			if client == nil || client.canRead(u.Repo) {
+				h.Importing = append(h.Importing, u)
+			}
+		}
+		repos, err := w.repoHealth(client)
+		if err != nil {
+			h.Errors = append(h.Errors, fmt.Sprintf("listing store commits: %s", err))
+		}
+		h.Repos = repos
+	}
+	h.OK = len(h.Errors) == 0
+	return h
+}
+
+// repoHealth returns the freshness of each repo in the store that
+// client (nil if the server has no ACL) may read.
+func (w *indexWatcher) repoHealth(client *serveClient) ([]*repoHealth, error) {
+	s, err := OpenStore()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := w.versions()
+	if err != nil {
+		return nil, err
+	}
+	byRepo := map[string]*repoHealth{}
+	var repos []*repoHealth
+	for _, v := range versions {
+		if client != nil && !client.canRead(v.Repo) {
+			continue
+		}
+		r := byRepo[v.Repo]
+		if r == nil {
+			r = &repoHealth{Repo: v.Repo}
+			byRepo[v.Repo] = r
+			repos = append(repos, r)
+		}
+		r.Versions++
+
+		imported, err := importTime(s, v.Repo, v.CommitID)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue // removed since it was listed
+			}
+			return nil, err
+		}
+		if imported != nil && (r.Imported == nil || imported.After(*r.Imported)) {
+			r.LatestCommitID, r.Imported = v.CommitID, imported
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Repo < repos[j].Repo })
+	return repos, nil
+}
+
+// serveHealth handles requests to /healthz (ready is false) and
+// /readyz. They don't require authentication (so that load balancers
+// can check them), except for verbose requests with an ACL.
+func (w *indexWatcher) serveHealth(rw http.ResponseWriter, r *http.Request, acl *serveACL, ready bool) {
+	verbose := r.URL.Query().Get("verbose") != ""
+	var client *serveClient
+	if verbose && acl != nil {
+		if client = acl.authenticateHTTP(r); client == nil {
+			http.Error(rw, "missing or invalid bearer token (required with verbose)", http.StatusUnauthorized)
+			return
+		}
+	}
+	h := w.health(ready, verbose, client)
+	status := http.StatusOK
+	if !h.OK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(rw, status, h)
+}
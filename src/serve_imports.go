@@ -0,0 +1,588 @@
+package src
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/godoc/vfs"
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/importer"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+// importQueue runs import jobs in the background and keeps the status
+// of recent jobs. Jobs may build concurrently (on up to workers
+// goroutines, with at most maxPerRepo jobs per repo), but only one at a
+// time imports into the store, since a store may only have a single
+// importer.
+//
+// Head jobs (of branch heads and uploads) run before history jobs (of
+// older commits, such as a backfill's), in the order that they were
+// queued. History jobs run newest first, so that recently pushed
+// commits are indexed before older history.
+type importQueue struct {
+	stor       interface{} // the (writable) store to import into
+	size       int         // max number of queued jobs
+	workers    int
+	maxPerRepo int           // 0 for no limit
+	wake       chan struct{} // signaled when a job may be runnable
+
+	importMu sync.Mutex // held while importing into stor
+
+	mu      sync.Mutex
+	pending []*importJob   // queued jobs, oldest first
+	running map[string]int // repo -> number of running jobs
+	jobs    []*importJob   // recent jobs, oldest first
+	byID    map[string]*importJob
+	lastID  int
+}
+
+// An importJob is a job in the import queue.
+type importJob struct {
+	ID       string
+	Repo     string `json:",omitempty"` // empty for a RepoStore
+	CommitID string
+	Ref      string `json:",omitempty"` // the pushed branch (of a head job from a push)
+
+	// Source describes what queued the job (e.g., an upload by a
+	// client).
+	Source string
+
+	Priority importPriority
+	State    importJobState
+	Error    string `json:",omitempty"` // if State is "failed"
+
+	Queued   time.Time
+	Started  *time.Time `json:",omitempty"`
+	Finished *time.Time `json:",omitempty"`
+
+	// run does the job's work, importing build data with imp.
+	run func(ctx context.Context, imp importFunc) error
+}
+
+// importFunc imports build data into the store (see Import).
+type importFunc func(ctx context.Context, buildDataFS vfs.FileSystem, opt importer.Options) error
+
+type importJobState string
+
+const (
+	importJobQueued    importJobState = "queued"
+	importJobRunning   importJobState = "running"
+	importJobSucceeded importJobState = "succeeded"
+	importJobFailed    importJobState = "failed"
+)
+
+func (j *importJob) finished() bool {
+	return j.State == importJobSucceeded || j.State == importJobFailed
+}
+
+type importPriority string
+
+const (
+	importPriorityHead    importPriority = "head"
+	importPriorityHistory importPriority = "history"
+)
+
+// maxImportJobHistory is the number of finished jobs whose status the
+// import queue keeps.
+const maxImportJobHistory = 1000
+
+// errImportQueueFull is returned when a job is added to a full import
+// queue.
+var errImportQueueFull = errors.New("import queue is full")
+
+func newImportQueue(stor interface{}, size, workers, maxPerRepo int) *importQueue {
+	return &importQueue{
+		stor:       stor,
+		size:       size,
+		workers:    workers,
+		maxPerRepo: maxPerRepo,
+		wake:       make(chan struct{}, 1),
+		running:    map[string]int{},
+		byID:       map[string]*importJob{},
+	}
+}
+
+// add queues a job that calls run to import build data for the repo
+// and commit, and returns the job's status. A head job of a pushed ref
+// makes the queued head jobs of the same repo and ref history jobs,
+// since they are no longer the ref's head. If the queue is full, a head
+// job replaces the oldest queued history job (which fails).
+func (q *importQueue) add(repo, commitID, ref string, priority importPriority, source string, run func(ctx context.Context, imp importFunc) error) (importJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) >= q.size {
+		if priority != importPriorityHead || !q.dropHistory() {
+			return importJob{}, errImportQueueFull
+		}
+	}
+	q.lastID++
+	j := &importJob{
+		ID:       strconv.Itoa(q.lastID),
+		Repo:     repo,
+		CommitID: commitID,
+		Ref:      ref,
+		Source:   source,
+		Priority: priority,
+		State:    importJobQueued,
+		Queued:   time.Now(),
+		run:      run,
+	}
+	if priority == importPriorityHead {
+		q.demoteHeads(repo, ref)
+	}
+	q.pending = append(q.pending, j)
+	q.jobs = append(q.jobs, j)
+	q.byID[j.ID] = j
+	q.trim()
+	q.signal()
+	return *j, nil
+}
+
+// dropHistory fails and dequeues the oldest queued history job, and
+// returns whether there was one.
+func (q *importQueue) dropHistory() bool {
+	for i, j := range q.pending {
+		if j.Priority == importPriorityHistory {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			now := time.Now()
+			j.State, j.Finished = importJobFailed, &now
+			j.Error = "dropped from the full import queue for a head job"
+			log.Printf("Import job %s: dropped %s (commit %s) from the full import queue.", j.ID, j.Repo, j.CommitID)
+			return true
+		}
+	}
+	return false
+}
+
+// demoteHeads makes the queued head jobs of the repo's ref (if ref
+// isn't empty) history jobs.
+func (q *importQueue) demoteHeads(repo, ref string) {
+	if ref == "" {
+		return
+	}
+	for _, j := range q.pending {
+		if j.Priority == importPriorityHead && j.Repo == repo && j.Ref == ref {
+			j.Priority = importPriorityHistory
+		}
+	}
+}
+
+// promote returns the status of a queued (not yet running) job for the
+// repo and commit, if there is one, after making it a head job of ref.
+func (q *importQueue) promote(repo, commitID, ref string) (importJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.pending {
+		if j.Repo == repo && j.CommitID == commitID {
+			q.demoteHeads(repo, ref)
+			j.Priority, j.Ref = importPriorityHead, ref
+			return *j, true
+		}
+	}
+	return importJob{}, false
+}
+
+// trim forgets the oldest finished jobs beyond maxImportJobHistory.
+func (q *importQueue) trim() {
+	n := len(q.jobs) - maxImportJobHistory
+	if n <= 0 {
+		return
+	}
+	jobs := q.jobs[:0]
+	for _, j := range q.jobs {
+		if n > 0 && j.finished() {
+			delete(q.byID, j.ID)
+			n--
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	q.jobs = jobs
+}
+
+// job returns the status of the job with the given ID.
+func (q *importQueue) job(id string) (importJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.byID[id]
+	if !ok {
+		return importJob{}, false
+	}
+	return *j, true
+}
+
+// list returns the status of the recent jobs for the repos that client
+// (nil if the server has no ACL) may read, newest first.
+func (q *importQueue) list(client *serveClient) []importJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := []importJob{}
+	for i := len(q.jobs) - 1; i >= 0; i-- {
+		if j := q.jobs[i]; client == nil || client.canRead(j.Repo) {
+			jobs = append(jobs, *j)
+		}
+	}
+	return jobs
+}
+
+// importQueueStatus is the number of jobs in an import queue in each
+// state (of those whose status is kept).
+type importQueueStatus struct {
+	Queued, Running, Succeeded, Failed int
+
+	// QueuedHistory is the number of queued jobs that are history
+	// jobs.
+	QueuedHistory int
+}
+
+func (q *importQueue) status() importQueueStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var st importQueueStatus
+	for _, j := range q.jobs {
+		switch j.State {
+		case importJobQueued:
+			st.Queued++
+			if j.Priority == importPriorityHistory {
+				st.QueuedHistory++
+			}
+		case importJobRunning:
+			st.Running++
+		case importJobSucceeded:
+			st.Succeeded++
+		case importJobFailed:
+			st.Failed++
+		}
+	}
+	return st
+}
+
+// signal wakes a worker, if one is waiting.
+func (q *importQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run runs the queued jobs (on q.workers goroutines) until ctx is
+// done.
+func (q *importQueue) run(ctx context.Context) error {
+	errc := make(chan error, q.workers)
+	for i := 0; i < q.workers; i++ {
+		go func() { errc <- q.work(ctx) }()
+	}
+	for i := 0; i < q.workers; i++ {
+		<-errc
+	}
+	return ctx.Err()
+}
+
+func (q *importQueue) work(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		j := q.next()
+		if j == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-q.wake:
+			}
+			continue
+		}
+		q.runJob(ctx, j)
+		q.mu.Lock()
+		if q.running[j.Repo]--; q.running[j.Repo] <= 0 {
+			delete(q.running, j.Repo)
+		}
+		q.mu.Unlock()
+		q.signal() // a job of the repo may be runnable now
+	}
+}
+
+// next dequeues the next job to run (and marks it as running), or
+// returns nil if no queued job may run now.
+func (q *importQueue) next() *importJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	best := -1
+	for i, j := range q.pending {
+		if q.maxPerRepo > 0 && q.running[j.Repo] >= q.maxPerRepo {
+			continue
+		}
+		if best == -1 || runsBefore(j, q.pending[best]) {
+			best = i
+		}
+	}
+	if best == -1 {
+		return nil
+	}
+	j := q.pending[best]
+	q.pending = append(q.pending[:best], q.pending[best+1:]...)
+	q.running[j.Repo]++
+	now := time.Now()
+	j.State, j.Started = importJobRunning, &now
+	q.signal() // another worker may run the next job
+	return j
+}
+
+// runsBefore returns whether queued job a runs before b (which was
+// queued before a).
+func runsBefore(a, b *importJob) bool {
+	if a.Priority != b.Priority {
+		return a.Priority == importPriorityHead
+	}
+	return a.Priority == importPriorityHistory
+}
+
+func (q *importQueue) runJob(ctx context.Context, j *importJob) {
+	log.Printf("Import job %s: importing %s (commit %s, %s priority) from %s.", j.ID, j.Repo, j.CommitID, j.Priority, j.Source)
+	start := time.Now()
+	if err := j.run(ctx, q.importData); err != nil {
+		log.Printf("Import job %s failed after %s: %s.", j.ID, time.Since(start), err)
+		q.setState(j, importJobFailed, err)
+		return
+	}
+	log.Printf("Import job %s: imported %s (commit %s) in %s.", j.ID, j.Repo, j.CommitID, time.Since(start))
+	q.setState(j, importJobSucceeded, nil)
+}
+
+// importData imports build data into the store, after the running
+// import of another job (if any) finishes.
+func (q *importQueue) importData(ctx context.Context, buildDataFS vfs.FileSystem, opt importer.Options) error {
+	q.importMu.Lock()
+	defer q.importMu.Unlock()
+	return importBuildData(ctx, buildDataFS, q.stor, opt)
+}
+
+func (q *importQueue) setState(j *importJob, state importJobState, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	j.State, j.Finished = state, &now
+	if err != nil {
+		j.Error = err.Error()
+	}
+}
+
+// checkImportVersion returns the normalized repo URI of an import, or
+// an error if repo or commitID (which name dirs in the store) are
+// invalid.
+func checkImportVersion(stor interface{}, repo, commitID string) (string, error) {
+	if _, ok := stor.(store.MultiRepoStore); ok {
+		if repo == "" {
+			return "", errors.New("repo is required (the store is a MultiRepoStore)")
+		}
+		var err error
+		if repo, err = graph.TryMakeURI(repo); err != nil {
+			return "", err
+		}
+		for _, c := range strings.Split(repo, "/") {
+			if c == "" || c == "." || c == ".." {
+				return "", fmt.Errorf("invalid repo %q", repo)
+			}
+		}
+	}
+	if commitID == "" || commitID == "." || commitID == ".." || strings.ContainsAny(commitID, `/\`) {
+		return "", fmt.Errorf("invalid commit ID %q", commitID)
+	}
+	return repo, nil
+}
+
+// maxBuildDataEntries is the max number of files and dirs in an
+// uploaded build data archive.
+const maxBuildDataEntries = 100000
+
+// extractBuildData extracts the build data in a tar archive (which may
+// be gzipped) into dir. Only regular files and dirs are extracted, and
+// no file may be outside of dir. If maxSize is nonzero, it fails if
+// the extracted files' total size exceeds maxSize (so that a small
+// gzipped archive can't fill the disk). It also fails if the archive
+// has more than maxBuildDataEntries entries.
+func extractBuildData(r io.Reader, dir string, maxSize int64) error {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	} else {
+		r = br
+	}
+	tr := tar.NewReader(r)
+	var size int64 // of the files extracted so far
+	for entries := 0; ; entries++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if entries == maxBuildDataEntries {
+			return fmt.Errorf("archive has more than %d entries", maxBuildDataEntries)
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "." {
+			continue
+		}
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("archive entry %q is outside of the build data dir", hdr.Name)
+		}
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(file, 0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+			if err != nil {
+				return err
+			}
+			var src io.Reader = tr
+			if maxSize > 0 {
+				// Read one more byte than the remaining size, to
+				// detect files that exceed it.
+				src = io.LimitReader(tr, maxSize-size+1)
+			}
+			n, err := io.Copy(f, src)
+			size += n
+			if err == nil && maxSize > 0 && size > maxSize {
+				err = fmt.Errorf("extracted build data is larger than %d bytes", maxSize)
+			}
+			if err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("archive entry %q is not a regular file or dir", hdr.Name)
+		}
+	}
+}
+
+// serveImports handles requests to /imports and /imports/ID. With an
+// ACL, clients must authenticate, may only upload build data for the
+// repos that they may import, and may only see the jobs of the repos
+// that they may read.
+func (q *importQueue) serveImports(rw http.ResponseWriter, r *http.Request, acl *serveACL, maxUploadSize int64) {
+	var client *serveClient
+	if acl != nil {
+		if client = acl.authenticateHTTP(r); client == nil {
+			http.Error(rw, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if id := strings.TrimPrefix(r.URL.Path, "/imports/"); id != r.URL.Path {
+		j, ok := q.job(id)
+		if !ok || (client != nil && !client.canRead(j.Repo)) {
+			http.Error(rw, "import job not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(rw, http.StatusOK, j)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeJSON(rw, http.StatusOK, q.list(client))
+	case "POST":
+		q.serveUpload(rw, r, client, maxUploadSize)
+	default:
+		rw.Header().Set("Allow", "GET, POST")
+		http.Error(rw, "method not allowed (use GET or POST)", http.StatusMethodNotAllowed)
+	}
+}
+
+// serveUpload handles uploads of build data (as a tar archive of a
+// commit's build data dir) to /imports?repo=REPO&commit=COMMIT (and
+// optionally &priority=history), and queues the import.
+func (q *importQueue) serveUpload(rw http.ResponseWriter, r *http.Request, client *serveClient, maxUploadSize int64) {
+	repo, err := checkImportVersion(q.stor, r.URL.Query().Get("repo"), r.URL.Query().Get("commit"))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	commitID := r.URL.Query().Get("commit")
+	priority := importPriorityHead
+	switch p := importPriority(r.URL.Query().Get("priority")); p {
+	case "", importPriorityHead:
+	case importPriorityHistory:
+		priority = p
+	default:
+		http.Error(rw, fmt.Sprintf("invalid priority %q (must be %q or %q)", p, importPriorityHead, importPriorityHistory), http.StatusBadRequest)
+		return
+	}
+	source := "upload"
+	if client != nil {
+		if !client.canImport(repo) {
+			http.Error(rw, fmt.Sprintf("client %q may not import repo %q", client.Name, repo), http.StatusForbidden)
+			return
+		}
+		source += fmt.Sprintf(" by client %q", client.Name)
+	}
+
+	// Extract the build data before queueing the import, so that
+	// invalid uploads are rejected right away.
+	dir, err := ioutil.TempDir("", "srclib-upload-")
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body := r.Body
+	if maxUploadSize > 0 {
+		body = http.MaxBytesReader(rw, body, maxUploadSize)
+	}
+	if err := extractBuildData(body, dir, maxUploadSize); err != nil {
+		os.RemoveAll(dir)
+		http.Error(rw, fmt.Sprintf("reading build data archive: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	j, err := q.add(repo, commitID, "", priority, source, func(ctx context.Context, imp importFunc) error {
+		defer os.RemoveAll(dir)
+		return imp(ctx, rwvfs.OS(dir), importer.Options{Repo: repo, CommitID: commitID})
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	rw.Header().Set("Location", "/imports/"+j.ID)
+	writeJSON(rw, http.StatusAccepted, j)
+}
+
+// writeJSON writes v as the JSON response body, with the given status.
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(v)
+}
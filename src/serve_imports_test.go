@@ -0,0 +1,312 @@
+package src
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// buildDataArchive returns a gzipped tar archive with the given
+// entries.
+func buildDataArchive(t *testing.T, entries ...*tar.Header) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for _, hdr := range entries {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write(make([]byte, hdr.Size)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractBuildData_maxSize(t *testing.T) {
+	// The archive is much smaller than its 1 MB file.
+	data := buildDataArchive(t,
+		&tar.Header{Name: "a", Typeflag: tar.TypeReg, Size: 1000, Mode: 0600},
+		&tar.Header{Name: "b", Typeflag: tar.TypeReg, Size: 1 << 20, Mode: 0600},
+	)
+	tests := []struct {
+		maxSize int64
+		wantErr bool
+	}{
+		{0, false},
+		{1000 + 1<<20, false},
+		{1000 + 1<<20 - 1, true},
+		{1000, true},
+		{999, true},
+	}
+	for _, test := range tests {
+		dir, err := ioutil.TempDir("", "srclib-extract-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = extractBuildData(bytes.NewReader(data), dir, test.maxSize)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("maxSize %d: got error %v, want error: %v", test.maxSize, err, test.wantErr)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExtractBuildData(t *testing.T) {
+	tests := map[string]struct {
+		entries []*tar.Header
+		wantErr string
+		want    []string // extracted files
+	}{
+		"ok": {
+			entries: []*tar.Header{
+				{Name: "./", Typeflag: tar.TypeDir, Mode: 0700},
+				{Name: "./a/", Typeflag: tar.TypeDir, Mode: 0700},
+				{Name: "./a/b.json", Typeflag: tar.TypeReg, Size: 1, Mode: 0600},
+				{Name: "c/d.json", Typeflag: tar.TypeReg, Size: 1, Mode: 0600},
+			},
+			want: []string{"a/b.json", "c/d.json"},
+		},
+		"parent dir": {
+			entries: []*tar.Header{{Name: "../x", Typeflag: tar.TypeReg, Size: 1, Mode: 0600}},
+			wantErr: "outside of the build data dir",
+		},
+		"parent dir after clean": {
+			entries: []*tar.Header{{Name: "a/../../x", Typeflag: tar.TypeReg, Size: 1, Mode: 0600}},
+			wantErr: "outside of the build data dir",
+		},
+		"dotdot": {
+			entries: []*tar.Header{{Name: "..", Typeflag: tar.TypeDir, Mode: 0700}},
+			wantErr: "outside of the build data dir",
+		},
+		"absolute path": {
+			entries: []*tar.Header{{Name: "/etc/x", Typeflag: tar.TypeReg, Size: 1, Mode: 0600}},
+			wantErr: "outside of the build data dir",
+		},
+		"symlink": {
+			entries: []*tar.Header{{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd", Mode: 0777}},
+			wantErr: "not a regular file or dir",
+		},
+		"hard link": {
+			entries: []*tar.Header{{Name: "a", Typeflag: tar.TypeLink, Linkname: "b", Mode: 0600}},
+			wantErr: "not a regular file or dir",
+		},
+	}
+	for label, test := range tests {
+		dir, err := ioutil.TempDir("", "srclib-extract-test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = extractBuildData(bytes.NewReader(buildDataArchive(t, test.entries...)), dir, 0)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: got error %v, want it to contain %q", label, err, test.wantErr)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %s", label, err)
+		}
+		for _, f := range test.want {
+			if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(f))); err != nil {
+				t.Errorf("%s: %s", label, err)
+			}
+		}
+		os.RemoveAll(dir)
+	}
+
+	// Uncompressed archives are also accepted.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "a.json", Typeflag: tar.TypeReg, Size: 2, Mode: 0600})
+	tw.Write([]byte("{}"))
+	tw.Close()
+	dir, err := ioutil.TempDir("", "srclib-extract-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := extractBuildData(&buf, dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "a.json")); err != nil || string(data) != "{}" {
+		t.Errorf("uncompressed archive: got %q, %v", data, err)
+	}
+}
+
+func TestImportQueue_next(t *testing.T) {
+	q := newImportQueue(nil, 10, 1, 1)
+	add := func(repo, commitID, ref string, priority importPriority) {
+		if _, err := q.add(repo, commitID, ref, priority, "test", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("r1", "h1", "", importPriorityHistory)
+	add("r1", "h2", "", importPriorityHistory)
+	add("r2", "u1", "", importPriorityHead)
+	add("r1", "u2", "", importPriorityHead)
+	add("r3", "h3", "", importPriorityHistory)
+
+	// Head jobs run first, oldest first; then history jobs, newest
+	// first. With maxPerRepo 1, a repo's jobs wait for its running
+	// job.
+	var got []string
+	for j := q.next(); j != nil; j = q.next() {
+		got = append(got, j.CommitID)
+	}
+	if want := "u1 u2 h3"; strings.Join(got, " ") != want {
+		t.Errorf("got jobs %q while r1's job is running, want %q", strings.Join(got, " "), want)
+	}
+	q.running = map[string]int{}
+	got = nil
+	for j := q.next(); j != nil; j = q.next() {
+		got = append(got, j.CommitID)
+		delete(q.running, j.Repo)
+	}
+	if want := "h2 h1"; strings.Join(got, " ") != want {
+		t.Errorf("got jobs %q, want %q", strings.Join(got, " "), want)
+	}
+}
+
+func TestImportQueue_add(t *testing.T) {
+	q := newImportQueue(nil, 2, 1, 0)
+	if _, err := q.add("r", "h1", "", importPriorityHistory, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.add("r", "a", "refs/heads/master", importPriorityHead, "test", nil); err != nil {
+		t.Fatal(err)
+	}
+	// A newer push of the same ref demotes the older head job, and
+	// since the queue is full, it replaces the oldest history job.
+	j, err := q.add("r", "b", "refs/heads/master", importPriorityHead, "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j1, _ := q.job("1"); j1.State != importJobFailed {
+		t.Errorf("got dropped history job state %q, want failed", j1.State)
+	}
+	if j2, _ := q.job("2"); j2.Priority != importPriorityHistory {
+		t.Errorf("got demoted head job priority %q, want history", j2.Priority)
+	}
+	if next := q.next(); next == nil || next.ID != j.ID {
+		t.Errorf("got next job %v, want the newest head job", next)
+	}
+	// The queue is full of history jobs, so no more history jobs fit.
+	q.add("r", "h2", "", importPriorityHistory, "test", nil)
+	if _, err := q.add("r", "h3", "", importPriorityHistory, "test", nil); err != errImportQueueFull {
+		t.Errorf("got error %v, want errImportQueueFull", err)
+	}
+}
+
+func TestRunsBefore(t *testing.T) {
+	head, history := importPriorityHead, importPriorityHistory
+	tests := map[string]struct {
+		a, b importPriority // b was queued before a
+		want bool
+	}{
+		"head before history":  {a: head, b: history, want: true},
+		"history after head":   {a: history, b: head, want: false},
+		"heads oldest first":   {a: head, b: head, want: false},
+		"history newest first": {a: history, b: history, want: true},
+	}
+	for label, test := range tests {
+		if got := runsBefore(&importJob{Priority: test.a}, &importJob{Priority: test.b}); got != test.want {
+			t.Errorf("%s: got %v, want %v", label, got, test.want)
+		}
+	}
+}
+
+func TestImportQueue_promote(t *testing.T) {
+	q := newImportQueue(nil, 10, 1, 0)
+	q.add("r", "a", "refs/heads/master", importPriorityHead, "test", nil)
+	q.add("r", "h", "", importPriorityHistory, "test", nil)
+
+	if _, ok := q.promote("r", "x", "refs/heads/master"); ok {
+		t.Error("promoted a job that isn't queued")
+	}
+	j, ok := q.promote("r", "h", "refs/heads/master")
+	if !ok || j.Priority != importPriorityHead || j.Ref != "refs/heads/master" {
+		t.Errorf("got promoted job %+v (%v), want a head job of the ref", j, ok)
+	}
+	// The ref's older head job is no longer the ref's head.
+	if j1, _ := q.job("1"); j1.Priority != importPriorityHistory {
+		t.Errorf("got old head job priority %q, want history", j1.Priority)
+	}
+	if next := q.next(); next == nil || next.CommitID != "h" {
+		t.Errorf("got next job %v, want the promoted job", next)
+	}
+}
+
+func TestImportQueue_run(t *testing.T) {
+	const workers, maxPerRepo = 4, 2
+	q := newImportQueue(nil, 100, workers, maxPerRepo)
+
+	var (
+		mu      sync.Mutex
+		running = map[string]int{} // repo -> number of running jobs
+		maxSeen = map[string]int{} // repo -> max number of concurrent jobs
+		done    sync.WaitGroup
+	)
+	errJob := errors.New("job failed")
+	add := func(repo, commitID string, err error) {
+		done.Add(1)
+		_, addErr := q.add(repo, commitID, "", importPriorityHistory, "test", func(ctx context.Context, imp importFunc) error {
+			defer done.Done()
+			mu.Lock()
+			running[repo]++
+			if running[repo] > maxSeen[repo] {
+				maxSeen[repo] = running[repo]
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			running[repo]--
+			mu.Unlock()
+			return err
+		})
+		if addErr != nil {
+			t.Fatal(addErr)
+		}
+	}
+	for i := 0; i < 6; i++ {
+		add("r1", strconv.Itoa(i), nil)
+	}
+	add("r2", "c", errJob)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- q.run(ctx) }()
+	done.Wait()
+	cancel()
+	if err := <-runErr; err != context.Canceled {
+		t.Errorf("got run error %v, want context.Canceled", err)
+	}
+
+	if maxSeen["r1"] > maxPerRepo {
+		t.Errorf("got %d concurrent jobs of a repo, want at most %d", maxSeen["r1"], maxPerRepo)
+	}
+	if st := q.status(); st.Succeeded != 6 || st.Failed != 1 || st.Queued != 0 {
+		t.Errorf("got queue status %+v, want 6 succeeded and 1 failed", st)
+	}
+	for _, j := range q.list(nil) {
+		if j.Repo == "r2" && j.Error != errJob.Error() {
+			t.Errorf("got failed job error %q, want %q", j.Error, errJob)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package src
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// queryLimiter enforces the "src serve" limits on the queries (RPCs)
+// of each client, so that a few expensive queries can't starve other
+// clients.
+type queryLimiter struct {
+	mu     sync.Mutex
+	limits queryLimits
+	active map[string]int // client -> number of running queries
+}
+
+// queryLimits are the limits on queries (see ServeCmd).
+type queryLimits struct {
+	maxResults    int           // max results per query (0 for no limit)
+	maxTime       time.Duration // max wall time per query (0 for no limit)
+	maxConcurrent int           // max concurrent queries per client (0 for no limit)
+}
+
+func newQueryLimiter(limits queryLimits) *queryLimiter {
+	return &queryLimiter{limits: limits, active: map[string]int{}}
+}
+
+// setLimits changes the limits of queries that begin after it
+// returns. Running queries keep their limits (but count against the
+// new concurrent query cap).
+func (l *queryLimiter) setLimits(limits queryLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+}
+
+// clientKey identifies the client of a request for the concurrent
+// query cap: by name if the server has an ACL, and by host otherwise.
+func clientKey(ctx context.Context) string {
+	if c := serveClientFromContext(ctx); c != nil {
+		return "client:" + c.Name
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return "host:" + host
+	}
+	return ""
+}
+
+// acquire counts a query against the client's cap, unless the client
+// is at its cap. It returns the limits of the query.
+func (l *queryLimiter) acquire(key string) (queryLimits, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits.maxConcurrent > 0 && l.active[key] >= l.limits.maxConcurrent {
+		return l.limits, false
+	}
+	l.active[key]++
+	return l.limits, true
+}
+
+func (l *queryLimiter) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[key]--; l.active[key] <= 0 {
+		delete(l.active, key)
+	}
+}
+
+// begin starts a query. It returns the query's context (which has the
+// query's budget and deadline) and a func that must be called when the
+// query's handler returns.
+func (l *queryLimiter) begin(ctx context.Context) (context.Context, func(), error) {
+	key := clientKey(ctx)
+	limits, ok := l.acquire(key)
+	if !ok {
+		return nil, nil, status.Errorf(codes.ResourceExhausted, "too many concurrent queries (max %d per client)", limits.maxConcurrent)
+	}
+	b := &queryBudget{maxResults: limits.maxResults}
+	ctx = context.WithValue(ctx, queryBudgetKey{}, b)
+	cancel := func() {}
+	if limits.maxTime > 0 {
+		ctx, cancel = context.WithTimeout(ctx, limits.maxTime)
+	}
+	end := func() {
+		cancel()
+		// Store lookups stop only between source units (see
+		// store.WithContext), so a query that timed out counts
+		// against the client's cap until its lookups finish.
+		go func() {
+			b.running.Wait()
+			l.release(key)
+		}()
+	}
+	return ctx, end, nil
+}
+
+func (l *queryLimiter) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, end, err := l.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	return handler(ctx, req)
+}
+
+func (l *queryLimiter) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, end, err := l.begin(ss.Context())
+	if err != nil {
+		return err
+	}
+	defer end()
+	return handler(srv, contextStream{ss, ctx})
+}
+
+// A queryBudget is the resources that a query may use.
+type queryBudget struct {
+	maxResults int
+
+	running sync.WaitGroup // store lookups that are running
+}
+
+type queryBudgetKey struct{}
+
+// budgetFromContext returns the query's budget, or nil if the query has
+// no limits.
+func budgetFromContext(ctx context.Context) *queryBudget {
+	b, _ := ctx.Value(queryBudgetKey{}).(*queryBudget)
+	return b
+}
+
+// run calls f (a store lookup) and returns its error, or an error for
+// ctx if ctx is done first (e.g., because the query took more than the
+// max wall time). In that case, f keeps running in the background
+// until its lookup stops, which store lookups that are passed
+// store.WithContext(ctx) do before reading another source unit's data.
+func (b *queryBudget) run(ctx context.Context, f func() error) error {
+	if b == nil {
+		return f()
+	}
+	b.running.Add(1)
+	done := make(chan error, 1)
+	go func() {
+		defer b.running.Done()
+		done <- f()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// limit returns the max number of results for a query that requested
+// at most n results (0 for all).
+func (b *queryBudget) limit(n int) int {
+	if b == nil || b.maxResults == 0 {
+		return n
+	}
+	if n == 0 || n > b.maxResults {
+		return b.maxResults
+	}
+	return n
+}
+
+// setTruncated sets the "srclib-truncated" trailer of the stream if a
+// query that requested at most requested results (0 for all) returned
+// n results and may have had more than the max.
+func (b *queryBudget) setTruncated(stream grpc.ServerStream, requested, n int) {
+	if b == nil || b.maxResults == 0 || n < b.maxResults || (requested != 0 && requested <= b.maxResults) {
+		return
+	}
+	stream.SetTrailer(metadata.Pairs("srclib-truncated", "true"))
+}
@@ -0,0 +1,118 @@
+package src
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestQueryLimiter_maxConcurrent(t *testing.T) {
+	l := newQueryLimiter(queryLimits{maxConcurrent: 2})
+	ctxA := context.WithValue(context.Background(), serveClientKey{}, &serveClient{Name: "a"})
+	ctxB := context.WithValue(context.Background(), serveClientKey{}, &serveClient{Name: "b"})
+
+	var ends []func()
+	for i := 0; i < 2; i++ {
+		_, end, err := l.begin(ctxA)
+		if err != nil {
+			t.Fatalf("query %d of client a: %s", i, err)
+		}
+		ends = append(ends, end)
+	}
+	if _, _, err := l.begin(ctxA); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("got error %v for query over client a's cap, want ResourceExhausted", err)
+	}
+
+	// Other clients have their own caps.
+	_, endB, err := l.begin(ctxB)
+	if err != nil {
+		t.Fatalf("query of client b: %s", err)
+	}
+	endB()
+
+	// Ending a query frees a slot (asynchronously; see begin).
+	ends[0]()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, end, err := l.begin(ctxA)
+		if err == nil {
+			end()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("query of client a after another query ended: %s", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ends[1]()
+}
+
+func TestQueryLimiter_unaryInterceptor(t *testing.T) {
+	l := newQueryLimiter(queryLimits{maxConcurrent: 1})
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1234}})
+	ctx2 := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5678}})
+
+	// While a query of the host runs, another query of the same host
+	// (even from another port) is rejected without calling its handler.
+	info := &grpc.UnaryServerInfo{FullMethod: "/srclib.Defs/List"}
+	_, err := l.unaryInterceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		_, err := l.unaryInterceptor(ctx2, nil, info, func(context.Context, interface{}) (interface{}, error) {
+			t.Error("handler called for query over the cap")
+			return nil, nil
+		})
+		return nil, err
+	})
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("got error %v, want ResourceExhausted", err)
+	}
+}
+
+func TestQueryLimiter_maxTime(t *testing.T) {
+	l := newQueryLimiter(queryLimits{maxTime: 10 * time.Millisecond})
+	ctx, end, err := l.begin(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer end()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	err = budgetFromContext(ctx).run(ctx, func() error {
+		<-stop
+		return errors.New("lookup finished")
+	})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("got error %v for query over the max time, want DeadlineExceeded", err)
+	}
+}
+
+func TestQueryBudget_limit(t *testing.T) {
+	tests := map[string]struct {
+		maxResults int
+		n          int
+		want       int
+	}{
+		"no max":         {n: 5, want: 5},
+		"no max all":     {want: 0},
+		"all":            {maxResults: 10, want: 10},
+		"under max":      {maxResults: 10, n: 5, want: 5},
+		"over max":       {maxResults: 10, n: 50, want: 10},
+		"exactly at max": {maxResults: 10, n: 10, want: 10},
+	}
+	for label, test := range tests {
+		b := &queryBudget{maxResults: test.maxResults}
+		if got := b.limit(test.n); got != test.want {
+			t.Errorf("%s: got limit %d, want %d", label, got, test.want)
+		}
+	}
+	if got := (*queryBudget)(nil).limit(5); got != 5 {
+		t.Errorf("nil budget: got limit %d, want 5", got)
+	}
+}
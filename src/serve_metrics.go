@@ -0,0 +1,50 @@
+package src
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"sourcegraph.com/sourcegraph/srclib/metrics"
+)
+
+const (
+	// queryDurationMetric is the name of the summary of "src serve"
+	// query latencies, labeled by method and gRPC status code.
+	queryDurationMetric = "srclib_query_duration_seconds"
+
+	// queryCacheMetric is the name of the counter of query cache
+	// lookups, labeled by method and result (hit or miss).
+	queryCacheMetric = "srclib_query_cache_total"
+)
+
+func init() {
+	metrics.Describe(queryDurationMetric, "Duration of `src serve` queries, in seconds, by method and status code.")
+	metrics.Describe(queryCacheMetric, "Number of `src serve` query cache lookups that found cached results (hit) or not (miss), by method.")
+}
+
+// observeQuery records the latency of a query (of the named method,
+// such as "Defs") that began at start and returned err.
+func observeQuery(method string, start time.Time, err error) {
+	metrics.Since(queryDurationMetric, start, "method", method, "code", status.Code(err).String())
+}
+
+// metricsUnaryInterceptor records the latency of unary RPCs. It is
+// the first interceptor, so that the latency includes the time spent
+// waiting for the client's limits.
+func metricsUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeQuery(path.Base(info.FullMethod), start, err)
+	return resp, err
+}
+
+// metricsStreamInterceptor records the latency of streaming RPCs.
+func metricsStreamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeQuery(path.Base(info.FullMethod), start, err)
+	return err
+}
@@ -0,0 +1,356 @@
+package src
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+// serveConfig is the contents of the "src serve --config" file. Its
+// settings override the corresponding flags of ServeCmd, and (unlike
+// the flags) they are read again when the server reloads its
+// configuration (see serveReloader).
+type serveConfig struct {
+	MaxResults           *int
+	MaxQueryTime         string // e.g., "30s"
+	MaxConcurrentQueries *int
+
+	Preload  []string // REPO@COMMIT
+	Clones   []string // REPO=DIR
+	Federate []string // as in "src store --federate"
+}
+
+// serveSettings are the settings of the server that can be reloaded.
+type serveSettings struct {
+	limits   queryLimits
+	preload  []string
+	clones   []string
+	federate []string
+}
+
+// readServeConfig reads and validates the config file.
+func readServeConfig(file string) (*serveConfig, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cfg serveConfig
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	if cfg.MaxQueryTime != "" {
+		if _, err := time.ParseDuration(cfg.MaxQueryTime); err != nil {
+			return nil, fmt.Errorf("%s: MaxQueryTime: %s", file, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// settings returns the server's settings: those of the flags,
+// overridden by those in the config file (if any).
+func (c *ServeCmd) settings() (*serveSettings, error) {
+	s := &serveSettings{
+		limits:  queryLimits{maxResults: c.MaxResults, maxTime: c.MaxQueryTime, maxConcurrent: c.MaxConcurrentQueries},
+		preload: c.Preload,
+		clones:  c.Clones,
+	}
+	if c.Config == "" {
+		return s, nil
+	}
+	cfg, err := readServeConfig(c.Config)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxResults != nil {
+		s.limits.maxResults = *cfg.MaxResults
+	}
+	if cfg.MaxQueryTime != "" {
+		s.limits.maxTime, _ = time.ParseDuration(cfg.MaxQueryTime)
+	}
+	if cfg.MaxConcurrentQueries != nil {
+		s.limits.maxConcurrent = *cfg.MaxConcurrentQueries
+	}
+	if cfg.Preload != nil {
+		s.preload = cfg.Preload
+	}
+	if cfg.Clones != nil {
+		s.clones = cfg.Clones
+	}
+	s.federate = cfg.Federate
+	return s, nil
+}
+
+// serveReloader applies the server's settings when it starts and
+// whenever they are reloaded (on SIGHUP, or a POST to /reload), so that
+// the ACL, limits, preloaded versions, clones, federated stores, and
+// webhook repos can change without restarting the server (which would drop its
+// caches and running queries).
+type serveReloader struct {
+	c       *ServeCmd
+	local   interface{} // the store opened at startup
+	limiter *queryLimiter
+	cache   *queryCache // nil if caching is disabled
+
+	// acl is nil if the server has no ACL. It is set by the first
+	// load, and later loads replace its clients.
+	acl *serveACL
+
+	// webhooks is nil unless the server has --webhooks. Loads set
+	// its config.
+	webhooks *webhookHandler
+
+	mu        sync.Mutex                  // serializes loads
+	preloaded map[string]bool             // preloaded versions (REPO@COMMIT)
+	members   map[string]*federatedMember // federated store spec -> member
+
+	storeMu sync.RWMutex
+	stor    interface{} // the store that queries use
+}
+
+// A federatedMember is a store that the server's store is federated
+// with (see openFederatedMember).
+type federatedMember struct {
+	store store.MultiRepoStore
+	conn  io.Closer // nil unless the store is a gRPC server
+}
+
+// closeFederatedMemberDelay is how long a federated store that was
+// removed from the configuration stays open for the queries that are
+// still using it, if queries have no max wall time.
+const closeFederatedMemberDelay = 10 * time.Minute
+
+func newServeReloader(c *ServeCmd, local interface{}, cache *queryCache) *serveReloader {
+	return &serveReloader{
+		c:         c,
+		local:     local,
+		limiter:   newQueryLimiter(queryLimits{}),
+		cache:     cache,
+		preloaded: map[string]bool{},
+		stor:      local,
+	}
+}
+
+// store returns the store that queries use (and is the server's
+// OpenStore).
+func (r *serveReloader) store() (interface{}, error) {
+	r.storeMu.RLock()
+	defer r.storeMu.RUnlock()
+	return r.stor, nil
+}
+
+// load reads the server's settings and applies them. If any of the
+// settings are invalid, it returns an error and leaves the previous
+// settings in place.
+func (r *serveReloader) load() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, err := r.c.settings()
+	if err != nil {
+		return err
+	}
+
+	var acl *serveACL
+	if r.c.ACL != "" {
+		if acl, err = readServeACL(r.c.ACL); err != nil {
+			return err
+		}
+	}
+
+	var webhooks *webhookConfig
+	if r.webhooks != nil {
+		if webhooks, err = readWebhookConfig(r.c.Webhooks); err != nil {
+			return err
+		}
+	}
+
+	clones := make(map[string]*repoClone, len(s.clones))
+	for _, clone := range s.clones {
+		i := strings.Index(clone, "=")
+		if i == -1 {
+			return fmt.Errorf("invalid clone %q (must be REPO=DIR)", clone)
+		}
+		uri, rc, err := openRepoClone(clone[:i], clone[i+1:])
+		if err != nil {
+			return fmt.Errorf("clone %s: %s", clone, err)
+		}
+		clones[uri] = rc
+	}
+
+	// Preload the versions that aren't preloaded yet. (Federated
+	// stores can't preload, so preload into the local store.)
+	preloaded := make(map[string]bool, len(s.preload))
+	defer func() {
+		if err != nil {
+			for v := range preloaded {
+				if !r.preloaded[v] {
+					unpreloadVersion(r.local, v)
+				}
+			}
+		}
+	}()
+	for _, v := range s.preload {
+		if !r.preloaded[v] {
+			start := time.Now()
+			n, err := preloadVersion(r.local, v)
+			if err != nil {
+				return err
+			}
+			log.Printf("Preloaded %d indexes of %s in %s.", n, v, time.Since(start))
+		}
+		preloaded[v] = true
+	}
+
+	stor, members, err := r.openStore(s.federate)
+	if err != nil {
+		return err
+	}
+
+	// Nothing below fails, so the new settings are applied entirely
+	// or not at all.
+	if acl != nil {
+		if r.acl == nil {
+			r.acl = acl
+		} else {
+			r.acl.replace(acl)
+		}
+		log.Printf("Authenticating %d clients (from %s).", len(acl.Clients), r.c.ACL)
+	}
+	if webhooks != nil {
+		r.webhooks.setConfig(webhooks)
+		log.Printf("Indexing %d repos on push webhooks (from %s).", len(webhooks.Repos), r.c.Webhooks)
+	}
+	r.limiter.setLimits(s.limits)
+	snippets.setClones(clones)
+	r.storeMu.Lock()
+	r.stor = stor
+	r.storeMu.Unlock()
+	for v := range r.preloaded {
+		if !preloaded[v] {
+			unpreloadVersion(r.local, v)
+		}
+	}
+	r.preloaded = preloaded
+	r.closeFederatedMembers(members, s.limits.maxTime)
+	r.members = members
+	r.cache.reset()
+	return nil
+}
+
+// openStore returns the store that queries use: the local store,
+// federated with the stores in federate (if any), and the federated
+// members. It reuses the members that are already open.
+func (r *serveReloader) openStore(federate []string) (interface{}, map[string]*federatedMember, error) {
+	if len(federate) == 0 {
+		return r.local, nil, nil
+	}
+	local, ok := r.local.(store.MultiRepoStore)
+	if !ok {
+		return nil, nil, fmt.Errorf("Federate requires a MultiRepoStore (the store has type %T)", r.local)
+	}
+	members := make(map[string]*federatedMember, len(federate))
+	stores := []store.MultiRepoStore{local}
+	for _, spec := range federate {
+		m := r.members[spec]
+		if m == nil {
+			s, conn, err := openFederatedMember(spec)
+			if err != nil {
+				for k, m := range members {
+					if r.members[k] != m && m.conn != nil {
+						m.conn.Close()
+					}
+				}
+				return nil, nil, fmt.Errorf("Federate %s: %s", spec, err)
+			}
+			m = &federatedMember{store: s, conn: conn}
+		}
+		members[spec] = m
+		stores = append(stores, m.store)
+	}
+	return store.NewFederatedStore(stores...), members, nil
+}
+
+// closeFederatedMembers closes the connections of the current
+// federated members that aren't in keep, once the queries that are
+// using them have finished (or, with a max wall time per query, have
+// timed out).
+func (r *serveReloader) closeFederatedMembers(keep map[string]*federatedMember, maxTime time.Duration) {
+	delay := maxTime
+	if delay == 0 {
+		delay = closeFederatedMemberDelay
+	}
+	for spec, m := range r.members {
+		if keep[spec] != m && m.conn != nil {
+			conn := m.conn
+			time.AfterFunc(delay, func() { conn.Close() })
+		}
+	}
+}
+
+// reload reloads the server's settings (as requested by source, which
+// describes the request in logs).
+func (r *serveReloader) reload(source string) error {
+	log.Printf("Reloading configuration (requested by %s).", source)
+	if err := r.load(); err != nil {
+		log.Printf("Error reloading configuration (keeping the previous configuration): %s.", err)
+		return err
+	}
+	log.Printf("Reloaded configuration.")
+	return nil
+}
+
+// reloadOnSIGHUP reloads the server's settings whenever the process
+// receives SIGHUP, until ctx is done.
+func (r *serveReloader) reloadOnSIGHUP(ctx context.Context) {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGHUP)
+	defer signal.Stop(sigc)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigc:
+			r.reload("SIGHUP")
+		}
+	}
+}
+
+// serveReload handles POST requests to /reload, which reload the
+// server's settings. With an ACL, only admin clients may reload.
+func (r *serveReloader) serveReload(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != "POST" {
+		rw.Header().Set("Allow", "POST")
+		http.Error(rw, "method not allowed (use POST)", http.StatusMethodNotAllowed)
+		return
+	}
+	source := "POST /reload"
+	if r.acl != nil {
+		client := r.acl.authenticateHTTP(req)
+		if client == nil {
+			http.Error(rw, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		if !client.Admin {
+			http.Error(rw, fmt.Sprintf("client %q may not reload the server's configuration", client.Name), http.StatusForbidden)
+			return
+		}
+		source += fmt.Sprintf(" from client %q", client.Name)
+	}
+	if err := r.reload(source); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintln(rw, "Reloaded configuration.")
+}
@@ -0,0 +1,64 @@
+package src
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestServeReloader_narrowACL(t *testing.T) {
+	h := tokenSHA256("t")
+	file, remove := writeTestACL(t, `{"Clients": [{"Name": "a", "TokenSHA256": "`+h+`", "Repos": ["r1", "r2"]}]}`)
+	defer remove()
+
+	cache := newQueryCache(10, 0)
+	r := newServeReloader(&ServeCmd{ACL: file}, nil, cache)
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// query returns the repos that the client may read, cached.
+	query := func(client *serveClient) interface{} {
+		ctx := context.WithValue(context.Background(), serveClientKey{}, client)
+		v, err := cache.cached(ctx, "Defs", testQuery("q"), "", "", func() (interface{}, error) {
+			var readable []string
+			for _, repo := range []string{"r1", "r2"} {
+				if client.canRead(repo) {
+					readable = append(readable, repo)
+				}
+			}
+			return strings.Join(readable, ","), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	before := r.acl.authenticate("t")
+	if v := query(before); v != "r1,r2" {
+		t.Fatalf("before reload: got %v, want r1,r2", v)
+	}
+
+	// Narrow the client's grants.
+	if err := ioutil.WriteFile(file, []byte(`{"Clients": [{"Name": "a", "TokenSHA256": "`+h+`", "Repos": ["r1"]}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.reload("test"); err != nil {
+		t.Fatal(err)
+	}
+	after := r.acl.authenticate("t")
+	if after == nil || after == before {
+		t.Fatalf("got client %+v after reload, want a new client", after)
+	}
+
+	// A query that was authenticated before the reload (and so still
+	// has the old grants) caches its results after the reload.
+	if v := query(before); v != "r1,r2" {
+		t.Fatalf("query authenticated before reload: got %v, want r1,r2", v)
+	}
+	if v := query(after); v != "r1" {
+		t.Errorf("after reload: got %v, want r1 (not results cached under the old grants)", v)
+	}
+}
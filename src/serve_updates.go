@@ -0,0 +1,290 @@
+package src
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+// An indexUpdate is sent to subscribers when a commit finishes
+// importing into the store.
+type indexUpdate struct {
+	Repo     string `json:",omitempty"` // empty for a RepoStore
+	CommitID string
+}
+
+// indexWatcher polls the store for commits that finish importing and
+// notifies the subscribers that watch their repos.
+//
+// A commit is considered to be imported when it's in the store and its
+// source units didn't change since the previous poll. (Staged imports
+// only add a commit to the store when it is complete, but other
+// imports add it when they start, and imports are usually run by other
+// processes.) Commits that are in the store when the watcher starts
+// aren't reported.
+type indexWatcher struct {
+	interval time.Duration
+
+	// onUpdate, if set, is called with each update before it is sent
+	// to subscribers.
+	onUpdate func(indexUpdate)
+
+	// imports, if set, is the server's import queue, whose status is
+	// reported by health checks.
+	imports *importQueue
+
+	mu   sync.Mutex
+	subs map[*indexSubscriber]struct{}
+
+	// status is the result of the last poll (see importStatus).
+	status indexWatcherStatus
+}
+
+// indexWatcherStatus is the result of an indexWatcher's last poll of
+// the store.
+type indexWatcherStatus struct {
+	polled    time.Time     // when the last successful poll finished
+	err       error         // error of the last poll (if it failed)
+	importing []indexUpdate // commits that may still be importing
+}
+
+// An indexSubscriber receives the updates for the repos it watches.
+type indexSubscriber struct {
+	repos   map[string]bool // nil to watch all repos
+	client  *serveClient    // nil if the server has no ACL
+	updates chan indexUpdate
+}
+
+func newIndexWatcher(interval time.Duration) *indexWatcher {
+	return &indexWatcher{interval: interval, subs: map[*indexSubscriber]struct{}{}}
+}
+
+func (w *indexWatcher) subscribe(repos []string, client *serveClient) *indexSubscriber {
+	s := &indexSubscriber{client: client, updates: make(chan indexUpdate, 16)}
+	if len(repos) > 0 {
+		s.repos = make(map[string]bool, len(repos))
+		for _, repo := range repos {
+			s.repos[repo] = true
+		}
+	}
+	w.mu.Lock()
+	w.subs[s] = struct{}{}
+	w.mu.Unlock()
+	return s
+}
+
+func (w *indexWatcher) unsubscribe(s *indexSubscriber) {
+	w.mu.Lock()
+	delete(w.subs, s)
+	w.mu.Unlock()
+}
+
+// publish sends u to the subscribers that watch its repo (and may
+// read it). Updates for a RepoStore (which have no repo) are sent to
+// all subscribers. Subscribers that aren't keeping up miss the update.
+func (w *indexWatcher) publish(u indexUpdate) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for s := range w.subs {
+		if s.repos != nil && u.Repo != "" && !s.repos[u.Repo] {
+			continue
+		}
+		if s.client != nil && !s.client.canRead(u.Repo) {
+			continue
+		}
+		select {
+		case s.updates <- u:
+		default:
+			log.Printf("Dropped index update for %s (commit %s) for a slow subscriber.", u.Repo, u.CommitID)
+		}
+	}
+}
+
+// run polls the store until ctx is done.
+func (w *indexWatcher) run(ctx context.Context) error {
+	known := map[indexUpdate]bool{}
+	versions, err := w.versions()
+	if err != nil {
+		return err
+	}
+	for _, u := range versions {
+		known[u] = true
+	}
+	w.setStatus(nil, nil)
+
+	// pending holds the source units of commits that are in the store
+	// but may still be importing.
+	pending := map[indexUpdate]int{}
+
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		versions, err := w.versions()
+		if err != nil {
+			log.Printf("Error listing store versions: %s.", err)
+			w.setStatus(err, nil)
+			continue
+		}
+		for _, u := range versions {
+			if known[u] {
+				continue
+			}
+			n, err := w.numUnits(u)
+			if err != nil {
+				log.Printf("Error listing source units of %s (commit %s): %s.", u.Repo, u.CommitID, err)
+				continue
+			}
+			if prev, seen := pending[u]; seen && prev == n && n > 0 {
+				known[u] = true
+				delete(pending, u)
+				if w.onUpdate != nil {
+					w.onUpdate(u)
+				}
+				w.publish(u)
+			} else {
+				pending[u] = n
+			}
+		}
+		w.setStatus(nil, pending)
+	}
+}
+
+func (w *indexWatcher) setStatus(err error, pending map[indexUpdate]int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.err = err
+	if err != nil {
+		return
+	}
+	w.status.polled = time.Now()
+	w.status.importing = w.status.importing[:0]
+	for u := range pending {
+		w.status.importing = append(w.status.importing, u)
+	}
+}
+
+// importStatus returns the result of the last poll of the store.
+func (w *indexWatcher) importStatus() indexWatcherStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	st := w.status
+	st.importing = append([]indexUpdate(nil), st.importing...)
+	return st
+}
+
+func (w *indexWatcher) repoStore() (store.RepoStore, error) {
+	s, err := OpenStore()
+	if err != nil {
+		return nil, err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return nil, fmt.Errorf("store (type %T) does not implement listing versions", s)
+	}
+	return rs, nil
+}
+
+func (w *indexWatcher) versions() ([]indexUpdate, error) {
+	rs, err := w.repoStore()
+	if err != nil {
+		return nil, err
+	}
+	versions, err := rs.Versions()
+	if err != nil {
+		return nil, err
+	}
+	us := make([]indexUpdate, len(versions))
+	for i, v := range versions {
+		us[i] = indexUpdate{Repo: v.Repo, CommitID: v.CommitID}
+	}
+	return us, nil
+}
+
+func (w *indexWatcher) numUnits(u indexUpdate) (int, error) {
+	rs, err := w.repoStore()
+	if err != nil {
+		return 0, err
+	}
+	fs := []store.UnitFilter{store.ByCommitIDs(u.CommitID)}
+	if u.Repo != "" {
+		fs = append(fs, store.ByRepos(u.Repo))
+	}
+	units, err := rs.Units(fs...)
+	return len(units), err
+}
+
+// serveSubscribe handles WebSocket connections to /subscribe. The
+// "repo" query parameters (which may be repeated) are the repos to
+// watch (all repos if there are none). Each update is sent as a JSON
+// message.
+func (w *indexWatcher) serveSubscribe(ws *websocket.Conn, client *serveClient) {
+	defer ws.Close()
+	s := w.subscribe(ws.Request().URL.Query()["repo"], client)
+	defer w.unsubscribe(s)
+
+	// Clients don't send messages; reading detects when they
+	// disconnect.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var msg []byte
+		for websocket.Message.Receive(ws, &msg) == nil {
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case u := <-s.updates:
+			if err := websocket.JSON.Send(ws, u); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// httpHandler returns the handler for the server's HTTP endpoints. If
+// acl is non-nil, clients must authenticate, and they may only watch
+// the repos that they may read. Requests to /reload are handled by
+// reload.
+func (w *indexWatcher) httpHandler(acl *serveACL, reload http.HandlerFunc) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/reload", reload)
+	mux.HandleFunc("/healthz", func(rw http.ResponseWriter, r *http.Request) { w.serveHealth(rw, r, acl, false) })
+	mux.HandleFunc("/readyz", func(rw http.ResponseWriter, r *http.Request) { w.serveHealth(rw, r, acl, true) })
+	mux.HandleFunc("/freshness", func(rw http.ResponseWriter, r *http.Request) { w.serveFreshness(rw, r, acl) })
+	mux.HandleFunc("/subscribe", func(rw http.ResponseWriter, r *http.Request) {
+		var client *serveClient
+		if acl != nil {
+			if client = acl.authenticateHTTP(r); client == nil {
+				http.Error(rw, "missing or invalid bearer token", http.StatusUnauthorized)
+				return
+			}
+			for _, repo := range r.URL.Query()["repo"] {
+				if !client.canRead(repo) {
+					http.Error(rw, fmt.Sprintf("client %q may not read repo %q", client.Name, repo), http.StatusForbidden)
+					return
+				}
+			}
+		}
+		// Use a websocket.Server (not a websocket.Handler, which
+		// requires an Origin header) so that non-browser clients can
+		// subscribe.
+		websocket.Server{Handler: func(ws *websocket.Conn) { w.serveSubscribe(ws, client) }}.ServeHTTP(rw, r)
+	})
+	return mux
+}
@@ -0,0 +1,194 @@
+package src
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// receivedUpdates returns the updates that s has received (without
+// waiting for more).
+func receivedUpdates(s *indexSubscriber) []indexUpdate {
+	var us []indexUpdate
+	for {
+		select {
+		case u := <-s.updates:
+			us = append(us, u)
+		default:
+			return us
+		}
+	}
+}
+
+func TestIndexWatcher_publish(t *testing.T) {
+	a1, a2, b1 := indexUpdate{Repo: "a/1", CommitID: "c"}, indexUpdate{Repo: "a/2", CommitID: "c"}, indexUpdate{Repo: "b/1", CommitID: "c"}
+	noRepo := indexUpdate{CommitID: "c"} // of a RepoStore
+
+	tests := map[string]struct {
+		repos  []string
+		client *serveClient
+		want   []indexUpdate
+	}{
+		"all repos": {
+			want: []indexUpdate{a1, a2, b1, noRepo},
+		},
+		"watched repos": {
+			repos: []string{"a/2", "b/1"},
+			want:  []indexUpdate{a2, b1, noRepo},
+		},
+		"readable repos": {
+			client: &serveClient{Name: "c", Repos: []string{"a/*"}},
+			want:   []indexUpdate{a1, a2},
+		},
+		"watched and readable repos": {
+			repos:  []string{"a/1", "b/1"},
+			client: &serveClient{Name: "c", Repos: []string{"a/*"}},
+			want:   []indexUpdate{a1},
+		},
+	}
+	w := newIndexWatcher(time.Hour)
+	subs := map[string]*indexSubscriber{}
+	for label, test := range tests {
+		subs[label] = w.subscribe(test.repos, test.client)
+	}
+	for _, u := range []indexUpdate{a1, a2, b1, noRepo} {
+		w.publish(u)
+	}
+	for label, test := range tests {
+		if got := receivedUpdates(subs[label]); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got updates %v, want %v", label, got, test.want)
+		}
+	}
+
+	// Unsubscribed subscribers get no more updates.
+	for _, s := range subs {
+		w.unsubscribe(s)
+	}
+	w.publish(a1)
+	for label, s := range subs {
+		if got := receivedUpdates(s); len(got) != 0 {
+			t.Errorf("%s: got updates %v after unsubscribing, want none", label, got)
+		}
+	}
+}
+
+func TestIndexWatcher_publish_slowSubscriber(t *testing.T) {
+	w := newIndexWatcher(time.Hour)
+	s := w.subscribe(nil, nil)
+	n := cap(s.updates) + 5
+	for i := 0; i < n; i++ {
+		w.publish(indexUpdate{Repo: "r", CommitID: strings.Repeat("c", i+1)})
+	}
+	// Updates beyond the subscriber's buffer are dropped instead of
+	// blocking the watcher.
+	if got := len(receivedUpdates(s)); got != cap(s.updates) {
+		t.Errorf("got %d updates, want %d", got, cap(s.updates))
+	}
+}
+
+func TestIndexWatcher_run(t *testing.T) {
+	// The store is read by the watcher while commits are imported, so
+	// it can't be in a (non-thread-safe) rwvfs.Map.
+	dir, err := ioutil.TempDir("", "srclib-index-watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := store.NewFSMultiRepoStore(rwvfs.Walkable(rwvfs.OS(dir)), nil)
+	importCommit := func(repo, commitID string) {
+		if err := s.Import(repo, commitID, &unit.SourceUnit{Type: "t", Name: "u"}, graph.Output{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	importCommit("r", "old")
+	origOpenStore := OpenStore
+	defer func() { OpenStore = origOpenStore }()
+	OpenStore = func() (interface{}, error) { return s, nil }
+
+	w := newIndexWatcher(time.Millisecond)
+	sub := w.subscribe(nil, nil)
+	var onUpdate []indexUpdate
+	w.onUpdate = func(u indexUpdate) { onUpdate = append(onUpdate, u) }
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.run(ctx) }()
+
+	// Wait for the first poll, so that the old commit is known.
+	deadline := time.Now().Add(5 * time.Second)
+	for w.importStatus().polled.IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("watcher didn't poll the store")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	importCommit("r", "new")
+
+	select {
+	case u := <-sub.updates:
+		if want := (indexUpdate{Repo: "r", CommitID: "new"}); u != want {
+			t.Errorf("got update %v, want %v", u, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("got no update for the imported commit")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("got run error %v, want context.Canceled", err)
+	}
+	if want := []indexUpdate{{Repo: "r", CommitID: "new"}}; !reflect.DeepEqual(onUpdate, want) {
+		t.Errorf("got onUpdate calls %v, want %v", onUpdate, want)
+	}
+	if got := receivedUpdates(sub); len(got) != 0 {
+		t.Errorf("got more updates %v, want none", got)
+	}
+}
+
+func TestIndexWatcher_serveSubscribe(t *testing.T) {
+	w := newIndexWatcher(time.Hour)
+	srv := httptest.NewServer(w.httpHandler(nil, func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/subscribe?repo=r1", "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	// Wait for the server to subscribe.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.mu.Lock()
+		n := len(w.subs)
+		w.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server didn't subscribe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	w.publish(indexUpdate{Repo: "r2", CommitID: "c1"})
+	w.publish(indexUpdate{Repo: "r1", CommitID: "c2"})
+
+	var u indexUpdate
+	ws.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := websocket.JSON.Receive(ws, &u); err != nil {
+		t.Fatal(err)
+	}
+	if want := (indexUpdate{Repo: "r1", CommitID: "c2"}); u != want {
+		t.Errorf("got update %v, want %v (of the watched repo)", u, want)
+	}
+}
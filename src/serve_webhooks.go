@@ -0,0 +1,318 @@
+package src
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/importer"
+)
+
+// webhookConfig is the contents of the "src serve --webhooks" file. It
+// lists the repos that the server clones, builds, and imports when
+// their Git host sends a push webhook.
+type webhookConfig struct {
+	// Repos are the repos to index.
+	Repos []*webhookRepo
+
+	byURI map[string]*webhookRepo
+}
+
+// A webhookRepo is a repo that is indexed when it is pushed to.
+type webhookRepo struct {
+	// Repo is the repo's URI (e.g., "github.com/org/a"), which must
+	// match the URI of the URL in the webhooks' payloads.
+	Repo string
+
+	// CloneURL is the URL to clone the repo from (default:
+	// "https://" + Repo + ".git"). It may contain credentials for
+	// private repos, so protect the file.
+	CloneURL string `json:",omitempty"`
+
+	// Secret is the webhook's secret: the key that GitHub signs the
+	// payloads with (in the X-Hub-Signature-256 header), or the token
+	// that GitLab sends (in the X-Gitlab-Token header).
+	Secret string
+
+	// Branches are the branches whose pushes are indexed, as
+	// path.Match patterns (default: the repo's default branch, as
+	// given in the payload, or all branches if it isn't given).
+	Branches []string `json:",omitempty"`
+}
+
+// readWebhookConfig reads and validates the webhooks file.
+func readWebhookConfig(file string) (*webhookConfig, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cfg webhookConfig
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	if len(cfg.Repos) == 0 {
+		return nil, fmt.Errorf("%s: no Repos", file)
+	}
+	cfg.byURI = make(map[string]*webhookRepo, len(cfg.Repos))
+	for _, r := range cfg.Repos {
+		uri, err := graph.TryMakeURI(r.Repo)
+		if err != nil {
+			return nil, fmt.Errorf("%s: repo %q: %s", file, r.Repo, err)
+		}
+		for _, c := range strings.Split(uri, "/") {
+			if c == "" || c == "." || c == ".." {
+				return nil, fmt.Errorf("%s: invalid repo %q", file, r.Repo)
+			}
+		}
+		if _, dup := cfg.byURI[uri]; dup {
+			return nil, fmt.Errorf("%s: duplicate repo %q", file, uri)
+		}
+		if r.Secret == "" {
+			return nil, fmt.Errorf("%s: repo %q has no Secret", file, uri)
+		}
+		for _, pat := range r.Branches {
+			if _, err := path.Match(pat, ""); err != nil {
+				return nil, fmt.Errorf("%s: repo %q: bad branch pattern %q: %s", file, uri, pat, err)
+			}
+		}
+		r.Repo = uri
+		if r.CloneURL == "" {
+			r.CloneURL = "https://" + uri + ".git"
+		}
+		cfg.byURI[uri] = r
+	}
+	return &cfg, nil
+}
+
+// webhookHandler handles push webhooks (at /webhooks) by queueing
+// jobs that check out the pushed commit (from the clone cache), build
+// it with "src config" and "src make", and import its build data.
+type webhookHandler struct {
+	imports *importQueue
+	clones  *cloneCache
+
+	// src is the absolute path of the src program that builds
+	// pushed commits (in their checkouts, so it mustn't be relative).
+	src string
+
+	mu  sync.Mutex
+	cfg *webhookConfig
+}
+
+func newWebhookHandler(imports *importQueue, clones *cloneCache, src string) *webhookHandler {
+	return &webhookHandler{imports: imports, clones: clones, src: src}
+}
+
+// setConfig makes h use cfg for the webhooks it receives after it
+// returns (see serveReloader).
+func (h *webhookHandler) setConfig(cfg *webhookConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cfg = cfg
+}
+
+func (h *webhookHandler) config() *webhookConfig {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.cfg
+}
+
+// pushEvent is the part of a GitHub or GitLab push webhook payload
+// that the server uses.
+type pushEvent struct {
+	Ref   string `json:"ref"`   // e.g., "refs/heads/master"
+	After string `json:"after"` // the pushed commit (all zeros if deleted)
+
+	Repository struct {
+		HTMLURL       string `json:"html_url"` // GitHub
+		Homepage      string `json:"homepage"` // GitLab
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+
+	Project struct { // GitLab
+		WebURL        string `json:"web_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"project"`
+}
+
+// repoURL returns the URL of the pushed repo.
+func (e *pushEvent) repoURL() string {
+	for _, u := range []string{e.Repository.HTMLURL, e.Project.WebURL, e.Repository.Homepage} {
+		if u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+func (e *pushEvent) defaultBranch() string {
+	if e.Repository.DefaultBranch != "" {
+		return e.Repository.DefaultBranch
+	}
+	return e.Project.DefaultBranch
+}
+
+// maxWebhookPayloadSize is the max size of a webhook payload that the
+// server reads. (GitHub caps payloads at 25 MB.)
+const maxWebhookPayloadSize = 25 << 20
+
+// verifyWebhook returns whether the request was sent by the Git host
+// with the repo's secret.
+func verifyWebhook(r *http.Request, body []byte, secret string) bool {
+	if sig := r.Header.Get("X-Hub-Signature-256"); sig != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(sig), []byte(want))
+	}
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+	}
+	return false
+}
+
+func (h *webhookHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		rw.Header().Set("Allow", "POST")
+		http.Error(rw, "method not allowed (use POST)", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxWebhookPayloadSize))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var e pushEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		http.Error(rw, fmt.Sprintf("invalid payload: %s", err), http.StatusBadRequest)
+		return
+	}
+	uri, err := graph.TryMakeURI(e.repoURL())
+	if err != nil {
+		http.Error(rw, "payload has no repository URL", http.StatusBadRequest)
+		return
+	}
+	cfg := h.config()
+	repo := cfg.byURI[uri]
+	if repo == nil {
+		http.Error(rw, fmt.Sprintf("repo %q is not configured for webhooks", uri), http.StatusNotFound)
+		return
+	}
+	if !verifyWebhook(r, body, repo.Secret) {
+		http.Error(rw, "missing or invalid webhook signature or token", http.StatusUnauthorized)
+		return
+	}
+
+	event := r.Header.Get("X-GitHub-Event")
+	if event == "" {
+		event = r.Header.Get("X-Gitlab-Event")
+	}
+	if event == "ping" {
+		fmt.Fprintln(rw, "pong")
+		return
+	}
+	if event != "push" && event != "Push Hook" {
+		fmt.Fprintf(rw, "Ignored %q event.\n", event)
+		return
+	}
+	if reason := repo.ignorePush(&e); reason != "" {
+		fmt.Fprintf(rw, "Ignored push: %s.\n", reason)
+		return
+	}
+
+	if j, ok := h.imports.promote(repo.Repo, e.After, e.Ref); ok {
+		writeJSON(rw, http.StatusAccepted, j)
+		return
+	}
+	j, err := h.imports.add(repo.Repo, e.After, e.Ref, importPriorityHead, fmt.Sprintf("push webhook (%s)", e.Ref), h.indexJob(repo, e.After, e.Ref))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	rw.Header().Set("Location", "/imports/"+j.ID)
+	writeJSON(rw, http.StatusAccepted, j)
+}
+
+// ignorePush returns why the push isn't indexed, or "" if it is.
+func (r *webhookRepo) ignorePush(e *pushEvent) string {
+	if !strings.HasPrefix(e.Ref, "refs/heads/") {
+		return fmt.Sprintf("%s is not a branch", e.Ref)
+	}
+	if strings.Trim(e.After, "0") == "" {
+		return fmt.Sprintf("%s was deleted", e.Ref)
+	}
+	if _, err := checkImportVersion(nil, "", e.After); err != nil {
+		return err.Error()
+	}
+	branch := strings.TrimPrefix(e.Ref, "refs/heads/")
+	if len(r.Branches) == 0 {
+		if def := e.defaultBranch(); def != "" && branch != def {
+			return fmt.Sprintf("branch %s is not the default branch", branch)
+		}
+		return ""
+	}
+	if !matchAny(r.Branches, branch) {
+		return fmt.Sprintf("branch %s doesn't match Branches", branch)
+	}
+	return ""
+}
+
+// indexJob returns the import job that builds and imports the commit
+// of the repo (pushed to ref).
+func (h *webhookHandler) indexJob(r *webhookRepo, commitID, ref string) func(context.Context, importFunc) error {
+	return func(ctx context.Context, imp importFunc) error {
+		dir, done, err := h.clones.checkout(ctx, r.Repo, r.CloneURL, commitID, ref)
+		if err != nil {
+			return err
+		}
+		defer done()
+		if err := runJobCmd(ctx, dir, h.src, "config", "--repo", r.Repo); err != nil {
+			return err
+		}
+		if err := runJobCmd(ctx, dir, h.src, "make", "--repo", r.Repo); err != nil {
+			return err
+		}
+		localStore, err := buildstore.LocalRepo(dir)
+		if err != nil {
+			return err
+		}
+		return imp(ctx, localStore.Commit(commitID), importer.Options{Repo: r.Repo, CommitID: commitID})
+	}
+}
+
+// runJobCmd runs a command of an import job in dir. If it fails, the
+// error includes the end of its output.
+func runJobCmd(ctx context.Context, dir, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if GlobalOpt.Verbose {
+		log.Printf("Running %v in %s.", cmd.Args, dir)
+	}
+	if err := cmd.Run(); err != nil {
+		const maxOutput = 4096
+		b := out.Bytes()
+		if len(b) > maxOutput {
+			b = b[len(b)-maxOutput:]
+		}
+		return fmt.Errorf("command %v failed: %s\n\noutput was:\n%s", cmd.Args, err, b)
+	}
+	return nil
+}
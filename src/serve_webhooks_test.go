@@ -0,0 +1,61 @@
+package src
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"ref": "refs/heads/master"}`)
+	sign := func(secret string, body []byte) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	tests := map[string]struct {
+		header map[string]string
+		want   bool
+	}{
+		"GitHub signature":          {map[string]string{"X-Hub-Signature-256": sign("s", body)}, true},
+		"GitHub wrong secret":       {map[string]string{"X-Hub-Signature-256": sign("t", body)}, false},
+		"GitHub other body":         {map[string]string{"X-Hub-Signature-256": sign("s", []byte("{}"))}, false},
+		"GitHub unprefixed":         {map[string]string{"X-Hub-Signature-256": sign("s", body)[len("sha256="):]}, false},
+		"GitLab token":              {map[string]string{"X-Gitlab-Token": "s"}, true},
+		"GitLab wrong token":        {map[string]string{"X-Gitlab-Token": "t"}, false},
+		"bad signature, good token": {map[string]string{"X-Hub-Signature-256": sign("t", body), "X-Gitlab-Token": "s"}, false},
+		"no signature or token":     {nil, false},
+		"empty token":               {map[string]string{"X-Gitlab-Token": ""}, false},
+	}
+	for label, test := range tests {
+		r, err := http.NewRequest("POST", "/webhooks", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range test.header {
+			r.Header.Set(k, v)
+		}
+		if got := verifyWebhook(r, body, "s"); got != test.want {
+			t.Errorf("%s: got %v, want %v", label, got, test.want)
+		}
+	}
+}
+
+func TestSrcExecutable(t *testing.T) {
+	// Run from another dir, as webhook builds are, the program must
+	// still be found by its path.
+	src, err := srcExecutable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(src) {
+		t.Errorf("got %q, want an absolute path", src)
+	}
+	if fi, err := os.Stat(src); err != nil || fi.IsDir() {
+		t.Errorf("got %q (stat error %v), want the test program", src, err)
+	}
+}
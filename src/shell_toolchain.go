@@ -0,0 +1,114 @@
+package src
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/shell"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// ShellToolchain is the path of the built-in toolchain that graphs
+// shell scripts (see package shell). Functions and variables are defs,
+// and calls, expansions, and the scripts and programs in the
+// repository that scripts run or source are refs.
+const ShellToolchain = "sourcegraph.com/sourcegraph/srclib/shell"
+
+func init() {
+	grapher.RegisterByteOffsetUnitType(shell.UnitType)
+	toolchain.RegisterBuiltin(ShellToolchain, &toolchain.Builtin{
+		Config: &toolchain.Config{
+			Tools: []*toolchain.ToolInfo{
+				{Subcmd: "scan", Op: "scan"},
+				{Subcmd: "depresolve", Op: "depresolve", SourceUnitTypes: []string{shell.UnitType}},
+				{Subcmd: "graph", Op: "graph", SourceUnitTypes: []string{shell.UnitType}},
+			},
+		},
+		Tools: map[string]toolchain.BuiltinTool{
+			"scan":       shellScan,
+			"depresolve": noDepresolve, // scripts' dependencies aren't resolved
+			"graph":      shellGraph,
+		},
+	})
+}
+
+// readHead returns the first bytes of the file (enough for a shebang
+// line).
+func readHead(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, 128)
+	n, err := io.ReadFull(f, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return head[:n], err
+}
+
+// shellScan is the shell toolchain's scanner. Each shell script is a
+// source unit, named by its path.
+func shellScan(args []string, stdin io.Reader, stdout io.Writer) error {
+	dir, err := readScanInput(args, stdin)
+	if err != nil {
+		return err
+	}
+	files, err := scanFiles(dir, func(file string) bool {
+		ext := path.Ext(file)
+		return ext == ".sh" || ext == ".bash" || ext == ""
+	})
+	if err != nil {
+		return err
+	}
+
+	units := []*unit.SourceUnit{}
+	for _, file := range files {
+		var head []byte
+		if path.Ext(file) == "" {
+			if head, err = readHead(file); err != nil {
+				return err
+			}
+		}
+		if !shell.IsScript(file, head) {
+			continue
+		}
+		units = append(units, &unit.SourceUnit{
+			Name:  file,
+			Type:  shell.UnitType,
+			Dir:   path.Dir(file),
+			Files: []string{file},
+		})
+	}
+	return json.NewEncoder(stdout).Encode(units)
+}
+
+// shellGraph is the shell toolchain's grapher.
+func shellGraph(args []string, stdin io.Reader, stdout io.Writer) error {
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(stdin).Decode(&u); err != nil {
+		return err
+	}
+
+	var o graph.Output
+	for _, file := range u.Files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fo, err := shell.Graph(file, data, os.Stat, ioutil.ReadFile)
+		if err != nil {
+			return err
+		}
+		o.Defs = append(o.Defs, fo.Defs...)
+		o.Refs = append(o.Refs, fo.Refs...)
+	}
+	return json.NewEncoder(stdout).Encode(o)
+}
@@ -0,0 +1,87 @@
+package src
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// skipReport lists the scanned source units and files that were
+// skipped because they match the tree's skip patterns (see
+// config.Tree.SkipPatterns) or contain the config.IgnoreFilePragma.
+type skipReport struct {
+	Units []*skippedUnit `json:",omitempty"`
+	Files []*skippedFile `json:",omitempty"`
+}
+
+// skippedUnit is a scanned source unit that was skipped because its
+// dir (or each of its files) matches a skip pattern.
+type skippedUnit struct {
+	Name, Type string
+	Dir        string `json:",omitempty"`
+	Pattern    string // the pattern that skipped the dir or the first file
+}
+
+// skippedFile is a file that was removed from a scanned source unit
+// because it matches a skip pattern or contains the
+// config.IgnoreFilePragma.
+type skippedFile struct {
+	UnitName, UnitType string
+	File               string
+	Pattern            string // the pattern or config.IgnoreFilePragma
+}
+
+// skipUnit applies the skip patterns and the ignore-file pragma to the
+// scanned source unit u (whose dir is dir), recording what it skips in
+// r. It returns true if all of u is skipped, and otherwise removes the
+// skipped files from u.Files. The cwd must be the tree root.
+func (r *skipReport) skipUnit(u *unit.SourceUnit, dir string, patterns []string) bool {
+	if pat, skip := config.MatchSkipPatterns(patterns, dir, true); skip {
+		r.Units = append(r.Units, &skippedUnit{Name: u.Name, Type: u.Type, Dir: dir, Pattern: pat})
+		return true
+	}
+
+	var files []string
+	var skippedFiles []*skippedFile
+	for _, f := range u.Files {
+		if pat, skip := config.MatchSkipPatterns(patterns, f, false); skip {
+			skippedFiles = append(skippedFiles, &skippedFile{UnitName: u.Name, UnitType: u.Type, File: f, Pattern: pat})
+			continue
+		}
+		if config.HasIgnoreFilePragma(f) {
+			skippedFiles = append(skippedFiles, &skippedFile{UnitName: u.Name, UnitType: u.Type, File: f, Pattern: config.IgnoreFilePragma})
+			continue
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 && len(skippedFiles) > 0 {
+		r.Units = append(r.Units, &skippedUnit{Name: u.Name, Type: u.Type, Dir: dir, Pattern: skippedFiles[0].Pattern})
+		return true
+	}
+	if len(skippedFiles) > 0 {
+		u.Files = files
+		r.Files = append(r.Files, skippedFiles...)
+	}
+	return false
+}
+
+// print writes the report as text to w.
+func (r *skipReport) print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if len(r.Units) > 0 {
+		fmt.Fprintln(tw, "Skipped source units:")
+		for _, u := range r.Units {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t(%s)\n", u.Name, u.Type, u.Dir, u.Pattern)
+		}
+	}
+	if len(r.Files) > 0 {
+		fmt.Fprintln(tw, "Skipped files in source units:")
+		for _, f := range r.Files {
+			fmt.Fprintf(tw, "  %s\t%s %s\t(%s)\n", f.File, f.UnitName, f.UnitType, f.Pattern)
+		}
+	}
+	return tw.Flush()
+}
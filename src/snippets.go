@@ -0,0 +1,195 @@
+package src
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+)
+
+// snippetReader sets the snippets of query results (see
+// graph.Snippet) from the files that contain them, read from local
+// clones of their repositories at the results' commits. It caches the
+// files that it reads, since a query's results are usually in a few
+// files.
+type snippetReader struct {
+	max int // max number of cached files
+
+	mu         sync.Mutex
+	clones     map[string]*repoClone // repo URI -> local clone
+	current    *repoClone            // clone in the current dir (or nil)
+	currentURI string                // URI of current (or "")
+	warned     map[string]bool       // repos that have no clone
+	lru        *list.List            // of *snippetFile, most recently used first
+	files      map[snippetFileKey]*list.Element
+	initOnce   sync.Once
+}
+
+// A repoClone is a local clone of a repository.
+type repoClone struct {
+	dir, vcsType string
+}
+
+type snippetFileKey struct {
+	dir, commitID, file string
+}
+
+type snippetFile struct {
+	key      snippetFileKey
+	contents []byte
+}
+
+// defaultSnippetCacheSize is the number of files that the snippet
+// reader of the "src store" commands caches.
+const defaultSnippetCacheSize = 100
+
+// snippets sets the snippets of "src store" and "src serve" query
+// results.
+var snippets = newSnippetReader(defaultSnippetCacheSize)
+
+func newSnippetReader(max int) *snippetReader {
+	return &snippetReader{
+		max:    max,
+		clones: map[string]*repoClone{},
+		warned: map[string]bool{},
+		lru:    list.New(),
+		files:  map[snippetFileKey]*list.Element{},
+	}
+}
+
+// openRepoClone returns the URI of repo and its local clone in dir.
+func openRepoClone(repo, dir string) (string, *repoClone, error) {
+	rootDir, vcsType, err := getRootDir(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	if rootDir == "" {
+		return "", nil, fmt.Errorf("no git or hg repository in %s", dir)
+	}
+	uri, err := graph.TryMakeURI(repo)
+	if err != nil {
+		return "", nil, err
+	}
+	return uri, &repoClone{dir: rootDir, vcsType: vcsType}, nil
+}
+
+// setClones makes r read the files of the repos in clones (repo URI ->
+// local clone, from openRepoClone) from their clones, replacing the
+// clones that were set before. The repository in the current dir is
+// still used for its own URI unless clones has another clone of it.
+func (r *snippetReader) setClones(clones map[string]*repoClone) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clones = make(map[string]*repoClone, len(clones)+1)
+	for uri, c := range clones {
+		r.clones[uri] = c
+		delete(r.warned, uri)
+	}
+	if r.currentURI != "" {
+		if _, present := r.clones[r.currentURI]; !present {
+			r.clones[r.currentURI] = r.current
+		}
+	}
+}
+
+// clone returns the local clone of repo. The repository in the
+// current dir is used for its own URI and for results with no repo
+// (as in single-repo stores).
+func (r *snippetReader) clone(repo string) *repoClone {
+	if c := r.localClone(repo); c != nil {
+		return c
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if repo != "" && !r.warned[repo] {
+		r.warned[repo] = true
+		logutil.Default.Warn("No local clone of repository to read snippets from.", "repo", repo)
+	}
+	return nil
+}
+
+// localClone is like clone, but it doesn't warn if there is no clone
+// of repo.
+func (r *snippetReader) localClone(repo string) *repoClone {
+	r.initOnce.Do(func() {
+		rootDir, vcsType, err := getRootDir(".")
+		if err != nil || rootDir == "" {
+			return
+		}
+		r.current = &repoClone{dir: rootDir, vcsType: vcsType}
+		if uri, err := graph.TryMakeURI(getVCSCloneURL(vcsType, rootDir)); err == nil {
+			r.mu.Lock()
+			r.currentURI = uri
+			if _, present := r.clones[uri]; !present {
+				r.clones[uri] = r.current
+			}
+			r.mu.Unlock()
+		}
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if repo == "" {
+		return r.current
+	}
+	return r.clones[repo]
+}
+
+// errNoClone means that there is no local clone of a repository
+// (which clone warns about once per repository).
+var errNoClone = errors.New("no local clone of repository")
+
+// readFile returns the contents of file in repo at commitID (or in
+// the working tree if commitID is empty).
+func (r *snippetReader) readFile(repo, commitID, file string) ([]byte, error) {
+	c := r.clone(repo)
+	if c == nil {
+		return nil, errNoClone
+	}
+	if commitID == "" {
+		// Working tree files change, so they aren't cached.
+		return ioutil.ReadFile(filepath.Join(c.dir, filepath.FromSlash(file)))
+	}
+
+	// Files at a commit never change, so cached files never expire.
+	key := snippetFileKey{dir: c.dir, commitID: commitID, file: file}
+	r.mu.Lock()
+	if e, ok := r.files[key]; ok {
+		r.lru.MoveToFront(e)
+		r.mu.Unlock()
+		return e.Value.(*snippetFile).contents, nil
+	}
+	r.mu.Unlock()
+
+	contents, err := readFileAtRevision(c.vcsType, c.dir, commitID, file)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.files[key]; !ok && r.max > 0 {
+		r.files[key] = r.lru.PushFront(&snippetFile{key: key, contents: contents})
+		for r.lru.Len() > r.max {
+			e := r.lru.Back()
+			r.lru.Remove(e)
+			delete(r.files, e.Value.(*snippetFile).key)
+		}
+	}
+	return contents, nil
+}
+
+// readSnippetFile is like readFile, but it logs failures to read
+// files (other than for missing clones, which clone warns about). It
+// reads the files of snippets (see query.SetDefSnippets).
+func (r *snippetReader) readSnippetFile(repo, commitID, file string) ([]byte, error) {
+	contents, err := r.readFile(repo, commitID, file)
+	if err != nil && err != errNoClone {
+		logutil.Default.Debug("Failed to read snippet.", "repo", repo, "commit", commitID, "file", file, "err", err)
+	}
+	return contents, err
+}
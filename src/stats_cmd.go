@@ -0,0 +1,263 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+type StoreStatsCmd struct {
+	Repo     string `long:"repo" description:"only compute stats for this repo"`
+	CommitID string `long:"commit" description:"only compute stats for this commit ID"`
+	UnitType string `long:"unit-type" description:"only compute stats for source units of this type"`
+	Unit     string `long:"unit" description:"only compute stats for source units with this name"`
+
+	NoUnits bool   `long:"no-units" description:"only print per-repo stats (omit the per-unit breakdown)"`
+	Format  string `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+}
+
+var storeStatsCmd StoreStatsCmd
+
+// graphStats holds summary statistics about the graph data of a
+// source unit or an entire repository (at a specific commit).
+type graphStats struct {
+	Repo     string `json:",omitempty"`
+	CommitID string `json:",omitempty"`
+	UnitType string `json:",omitempty"`
+	Unit     string `json:",omitempty"`
+
+	Defs int
+	Refs int
+	Docs int
+
+	// BrokenRefs is the number of refs that point to nonexistent
+	// defs. Only refs to defs in the same repository are checked.
+	BrokenRefs       int
+	BrokenRefPercent float64
+
+	// DocumentedExportedDefs is the number of exported defs that
+	// have at least 1 doc. DocCoverage is the percentage of exported
+	// defs that are documented.
+	ExportedDefs           int
+	DocumentedExportedDefs int
+	DocCoverage            float64
+
+	// DefKinds is the number of defs of each kind.
+	DefKinds map[string]int `json:",omitempty"`
+}
+
+// storeStatsOutput is the JSON output of the `src store stats`
+// command.
+type storeStatsOutput struct {
+	Repos []*graphStats
+	Units []*graphStats `json:",omitempty"`
+}
+
+func (c *StoreStatsCmd) filters() []interface {
+	store.DefFilter
+	store.RefFilter
+} {
+	var fs []interface {
+		store.DefFilter
+		store.RefFilter
+	}
+	if c.UnitType != "" && c.Unit != "" {
+		fs = append(fs, store.ByUnits(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+	}
+	if (c.UnitType != "" && c.Unit == "") || (c.UnitType == "" && c.Unit != "") {
+		log.Fatal("must specify either both or neither of --unit-type and --unit (to filter by source unit)")
+	}
+	if c.CommitID != "" {
+		fs = append(fs, store.ByCommitIDs(c.CommitID))
+	}
+	if c.Repo != "" {
+		fs = append(fs, store.ByRepos(c.Repo))
+	}
+	return fs
+}
+
+func (c *StoreStatsCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+
+	us, ok := s.(store.UnitStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing defs and refs", s)
+	}
+
+	var (
+		defFilters []store.DefFilter
+		refFilters []store.RefFilter
+	)
+	for _, f := range c.filters() {
+		defFilters = append(defFilters, f)
+		refFilters = append(refFilters, f)
+	}
+
+	defs, err := us.Defs(defFilters...)
+	if err != nil {
+		return err
+	}
+	refs, err := us.Refs(refFilters...)
+	if err != nil {
+		return err
+	}
+
+	var brokenRefs []*graph.Ref
+	if _, ok := s.(store.RepoStore); ok {
+		brokenRefs, err = brokenRefsOnly(refs, s)
+		if err != nil {
+			return err
+		}
+	}
+
+	unitStats := computeGraphStats(defs, refs, brokenRefs, true)
+	repoStats := computeGraphStats(defs, refs, brokenRefs, false)
+
+	out := storeStatsOutput{Repos: repoStats}
+	if !c.NoUnits {
+		out.Units = unitStats
+	}
+
+	switch format {
+	case formatJSON:
+		PrintJSON(out, "")
+	case formatTable:
+		printGraphStatsTable(out)
+	}
+	if len(repoStats) == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// computeGraphStats computes stats for defs and refs. If perUnit is
+// true, stats are computed for each source unit; otherwise they are
+// computed for each repository (and commit). The returned stats are
+// sorted by repo, commit ID, unit type, and unit name.
+func computeGraphStats(defs []*graph.Def, refs, brokenRefs []*graph.Ref, perUnit bool) []*graphStats {
+	statsByKey := map[unit.Key]*graphStats{}
+	get := func(repo, commitID, unitType, unitName string) *graphStats {
+		k := unit.Key{Repo: repo, CommitID: commitID}
+		if perUnit {
+			k.UnitType, k.Unit = unitType, unitName
+		}
+		st, present := statsByKey[k]
+		if !present {
+			st = &graphStats{Repo: k.Repo, CommitID: k.CommitID, UnitType: k.UnitType, Unit: k.Unit, DefKinds: map[string]int{}}
+			statsByKey[k] = st
+		}
+		return st
+	}
+
+	for _, def := range defs {
+		st := get(def.Repo, def.CommitID, def.UnitType, def.Unit)
+		st.Defs++
+		st.Docs += len(def.Docs)
+		if def.Kind != "" {
+			st.DefKinds[def.Kind]++
+		}
+		if def.Exported {
+			st.ExportedDefs++
+			if len(def.Docs) > 0 {
+				st.DocumentedExportedDefs++
+			}
+		}
+	}
+	for _, ref := range refs {
+		get(ref.Repo, ref.CommitID, ref.UnitType, ref.Unit).Refs++
+	}
+	for _, ref := range brokenRefs {
+		get(ref.Repo, ref.CommitID, ref.UnitType, ref.Unit).BrokenRefs++
+	}
+
+	stats := make([]*graphStats, 0, len(statsByKey))
+	for _, st := range statsByKey {
+		if st.Refs > 0 {
+			st.BrokenRefPercent = percent(st.BrokenRefs, st.Refs)
+		}
+		if st.ExportedDefs > 0 {
+			st.DocCoverage = percent(st.DocumentedExportedDefs, st.ExportedDefs)
+		}
+		if len(st.DefKinds) == 0 {
+			st.DefKinds = nil
+		}
+		stats = append(stats, st)
+	}
+	sort.Sort(graphStatsSorter(stats))
+	return stats
+}
+
+type graphStatsSorter []*graphStats
+
+func (v graphStatsSorter) Len() int      { return len(v) }
+func (v graphStatsSorter) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v graphStatsSorter) Less(i, j int) bool {
+	a, b := v[i], v[j]
+	if a.Repo != b.Repo {
+		return a.Repo < b.Repo
+	}
+	if a.CommitID != b.CommitID {
+		return a.CommitID < b.CommitID
+	}
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	return a.Unit < b.Unit
+}
+
+func printGraphStatsTable(out storeStatsOutput) {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	printRows := func(stats []*graphStats, perUnit bool) {
+		if perUnit {
+			fmt.Fprint(tw, "UNIT TYPE\tUNIT\t")
+		} else {
+			fmt.Fprint(tw, "REPO\tCOMMIT\t")
+		}
+		fmt.Fprintln(tw, "DEFS\tREFS\tDOCS\tBROKEN REFS\tDOC COVERAGE\tKINDS")
+		for _, st := range stats {
+			if perUnit {
+				fmt.Fprintf(tw, "%s\t%s\t", st.UnitType, st.Unit)
+			} else {
+				fmt.Fprintf(tw, "%s\t%s\t", st.Repo, st.CommitID)
+			}
+			fmt.Fprintf(tw, "%d\t%d\t%d\t%d (%.1f%%)\t%d/%d (%.1f%%)\t%s\n", st.Defs, st.Refs, st.Docs, st.BrokenRefs, st.BrokenRefPercent, st.DocumentedExportedDefs, st.ExportedDefs, st.DocCoverage, formatDefKinds(st.DefKinds))
+		}
+	}
+
+	printRows(out.Repos, false)
+	if len(out.Units) > 0 {
+		fmt.Fprintln(tw)
+		printRows(out.Units, true)
+	}
+	tw.Flush()
+}
+
+// formatDefKinds returns a string like "func=3 type=2" (sorted by
+// kind name).
+func formatDefKinds(kinds map[string]int) string {
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Strings(names)
+
+	strs := make([]string, len(names))
+	for i, kind := range names {
+		strs[i] = fmt.Sprintf("%s=%d", kind, kinds[kind])
+	}
+	return strings.Join(strs, " ")
+}
@@ -0,0 +1,101 @@
+package src
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestComputeGraphStats(t *testing.T) {
+	def := func(repo, unit, path, kind string, exported bool, docs int) *graph.Def {
+		d := &graph.Def{DefKey: graph.DefKey{Repo: repo, CommitID: "c", UnitType: "t", Unit: unit, Path: path}, Kind: kind, Exported: exported}
+		for i := 0; i < docs; i++ {
+			d.Docs = append(d.Docs, graph.DefDoc{Format: "text/plain", Data: "doc"})
+		}
+		return d
+	}
+	ref := func(repo, unit string) *graph.Ref {
+		return &graph.Ref{Repo: repo, CommitID: "c", UnitType: "t", Unit: unit}
+	}
+	defs := []*graph.Def{
+		def("r1", "u1", "a", "func", true, 1),
+		def("r1", "u1", "b", "func", true, 0),
+		def("r1", "u2", "c", "type", false, 2),
+		def("r1", "u2", "d", "", true, 1),
+		def("r2", "u1", "e", "func", false, 0),
+	}
+	broken := ref("r1", "u1")
+	refs := []*graph.Ref{broken, ref("r1", "u1"), ref("r1", "u2"), ref("r1", "u2")}
+	brokenRefs := []*graph.Ref{broken}
+
+	tests := map[string]struct {
+		perUnit bool
+		want    []*graphStats
+	}{
+		"per repo": {
+			want: []*graphStats{
+				{
+					Repo: "r1", CommitID: "c",
+					Defs: 4, Refs: 4, Docs: 4,
+					BrokenRefs: 1, BrokenRefPercent: 25,
+					ExportedDefs: 3, DocumentedExportedDefs: 2, DocCoverage: percent(2, 3),
+					DefKinds: map[string]int{"func": 2, "type": 1},
+				},
+				{Repo: "r2", CommitID: "c", Defs: 1, DefKinds: map[string]int{"func": 1}},
+			},
+		},
+		"per unit": {
+			perUnit: true,
+			want: []*graphStats{
+				{
+					Repo: "r1", CommitID: "c", UnitType: "t", Unit: "u1",
+					Defs: 2, Refs: 2, Docs: 1,
+					BrokenRefs: 1, BrokenRefPercent: 50,
+					ExportedDefs: 2, DocumentedExportedDefs: 1, DocCoverage: 50,
+					DefKinds: map[string]int{"func": 2},
+				},
+				{
+					Repo: "r1", CommitID: "c", UnitType: "t", Unit: "u2",
+					Defs: 2, Refs: 2, Docs: 3,
+					ExportedDefs: 1, DocumentedExportedDefs: 1, DocCoverage: 100,
+					DefKinds: map[string]int{"type": 1},
+				},
+				{Repo: "r2", CommitID: "c", UnitType: "t", Unit: "u1", Defs: 1, DefKinds: map[string]int{"func": 1}},
+			},
+		},
+	}
+	for label, test := range tests {
+		got := computeGraphStats(defs, refs, brokenRefs, test.perUnit)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got", label)
+			for _, st := range got {
+				t.Errorf("  %+v", *st)
+			}
+			t.Errorf("want")
+			for _, st := range test.want {
+				t.Errorf("  %+v", *st)
+			}
+		}
+	}
+
+	if got := computeGraphStats(nil, nil, nil, false); len(got) != 0 {
+		t.Errorf("no data: got %v, want no stats", got)
+	}
+}
+
+func TestFormatDefKinds(t *testing.T) {
+	tests := map[string]struct {
+		kinds map[string]int
+		want  string
+	}{
+		"none":   {want: ""},
+		"one":    {kinds: map[string]int{"func": 3}, want: "func=3"},
+		"sorted": {kinds: map[string]int{"type": 2, "func": 3, "var": 1}, want: "func=3 type=2 var=1"},
+	}
+	for label, test := range tests {
+		if got := formatDefKinds(test.kinds); got != test.want {
+			t.Errorf("%s: got %q, want %q", label, got, test.want)
+		}
+	}
+}
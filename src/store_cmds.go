@@ -2,6 +2,7 @@ package src
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"text/tabwriter"
 	"time"
 
 	"code.google.com/p/rog-go/parallel"
@@ -25,10 +27,11 @@ import (
 	"sourcegraph.com/sourcegraph/go-flags"
 	"sourcegraph.com/sourcegraph/go-sourcegraph/sourcegraph"
 	"sourcegraph.com/sourcegraph/rwvfs"
-	"sourcegraph.com/sourcegraph/srclib/config"
 	"sourcegraph.com/sourcegraph/srclib/graph"
-	"sourcegraph.com/sourcegraph/srclib/grapher"
-	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/importer"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/metrics"
+	"sourcegraph.com/sourcegraph/srclib/query"
 	"sourcegraph.com/sourcegraph/srclib/store"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
@@ -71,7 +74,7 @@ func InitStoreCmds(c *flags.Command) {
 
 	_, err = c.AddCommand("indexes",
 		"list indexes",
-		"The indexes command lists all of a store's indexes that match the specified criteria.",
+		"The indexes command lists all of a store's indexes that match the specified criteria. With --format text (the default), it prints them grouped by repo, commit, and source unit for people; with --format json, a JSON object per index; and with --format quiet, nothing.",
 		&storeIndexesCmd,
 	)
 	if err != nil {
@@ -89,7 +92,7 @@ func InitStoreCmds(c *flags.Command) {
 
 	_, err = c.AddCommand("repos",
 		"list repos",
-		"The repos command lists all repos that match a filter.",
+		"The repos command lists all repos that match a filter. With --format text (the default), it prints one repo per line; with --format table, aligned columns (with a header row) for people; with --format json, a JSON array of repos; and with --format quiet, nothing. It exits with status 3 if no repos match, 1 if the query fails, and 0 otherwise.",
 		&storeReposCmd,
 	)
 	if err != nil {
@@ -98,7 +101,7 @@ func InitStoreCmds(c *flags.Command) {
 
 	_, err = c.AddCommand("versions",
 		"list versions",
-		"The versions command lists all versions that match a filter.",
+		"The versions command lists all versions that match a filter. With --format text (the default), it prints each version's repo (if any) and commit ID, separated by a tab, one per line; with --format table, aligned columns (with a header row) for people; with --format json, a JSON array of versions; and with --format quiet, nothing. It exits with status 3 if no versions match, 1 if the query fails, and 0 otherwise.",
 		&storeVersionsCmd,
 	)
 	if err != nil {
@@ -107,7 +110,7 @@ func InitStoreCmds(c *flags.Command) {
 
 	_, err = c.AddCommand("units",
 		"list units",
-		"The units command lists all units that match a filter.",
+		"The units command lists all units that match a filter. With --format json (the default), it prints a JSON array of units; with --format table, aligned columns (with a header row) for people; and with --format quiet, nothing. It exits with status 3 if no units match, 1 if the query fails, and 0 otherwise.",
 		&storeUnitsCmd,
 	)
 	if err != nil {
@@ -116,7 +119,7 @@ func InitStoreCmds(c *flags.Command) {
 
 	defsC, err := c.AddCommand("defs",
 		"list defs",
-		"The defs command lists all defs that match a filter.",
+		"The defs command lists all defs that match a filter. With --format json (the default), it prints a JSON array of defs; with --format table, aligned columns (with a header row) for people; and with --format quiet, nothing. It exits with status 3 if no defs match, 1 if the query fails, and 0 otherwise.\n\nWith --stream, it prints the defs as newline-delimited JSON (one def per line) as it reads each source unit's defs, so that a large result set can be piped into another tool (such as jq) without either process holding all of it in memory.",
 		&storeDefsCmd,
 	)
 	if err != nil {
@@ -126,12 +129,88 @@ func InitStoreCmds(c *flags.Command) {
 
 	_, err = c.AddCommand("refs",
 		"list refs",
-		"The refs command lists all refs that match a filter.",
+		"The refs command lists all refs that match a filter. With --format json (the default), it prints a JSON array of refs; with --format table, aligned columns (with a header row) for people; and with --format quiet, nothing. It exits with status 3 if no refs match, 1 if the query fails, and 0 otherwise.\n\nWith --stream, it prints the refs as newline-delimited JSON (one ref per line) as the store reads them, so that a large result set can be piped into another tool (such as jq) without either process holding all of it in memory. Streamed refs are in no particular order.\n\nGraphers for dynamic languages may set a ref's Confidence (from 0 to 1) when they resolve it heuristically; refs without one are certain (confidence 1). Use --min-confidence to omit probable refs, and --sort-by-confidence to list certain refs first.",
 		&storeRefsCmd,
 	)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	_, err = c.AddCommand("dangling-refs",
+		"list refs to nonexistent defs",
+		"The dangling-refs command lists refs whose target def does not exist in the store, grouped by target def. Only refs to defs in the same repo are checked. To keep dangling refs out of the imported data, use 'src store import --quarantine-dangling-refs' (and list them with 'src store quarantined-refs').\n\nWith --format table (the default), it prints each nonexistent def and the refs to it for people; with --format json, a JSON array of defs and their refs; and with --format quiet, nothing. It exits with status 3 if there are no dangling refs, 1 if the query fails, and 0 otherwise.",
+		&storeDanglingRefsCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = c.AddCommand("quarantined-refs",
+		"list refs quarantined by import",
+		"The quarantined-refs command lists the refs of a commit that 'src store import --quarantine-dangling-refs' kept out of the imported data (because they refer to nonexistent defs in the same repo), grouped by target def. The refs are stored with the commit, so they are replaced when the commit is re-imported (and, with --unit or --unit-type, only those of the re-imported source units are replaced).\n\nWith --format table (the default), it prints each nonexistent def and the refs to it for people; with --format json, a JSON array of defs and their refs; and with --format quiet, nothing. It exits with status 3 if there are no quarantined refs, 1 if the query fails (or the commit was imported without quarantining), and 0 otherwise.",
+		&storeQuarantinedRefsCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = c.AddCommand("stats",
+		"show graph stats",
+		"The stats command shows def, ref, and doc counts, the percentage of broken refs (refs to nonexistent defs), doc coverage (the percentage of exported defs that are documented), and def kind breakdowns for each repo and source unit in the store.\n\nWith --format table (the default), it prints aligned columns (with a header row) for people; with --format json, a JSON object with the stats of each repo and source unit; and with --format quiet, nothing. It exits with status 3 if the store has no matching data, 1 if the query fails, and 0 otherwise.",
+		&storeStatsCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = c.AddCommand("dead-code",
+		"list defs with no refs (dead code candidates)",
+		"The dead-code command lists defs that have no incoming refs, excluding tests, local defs, and defs that are commonly used without refs in their language (such as entry points and, for some languages, methods and fields, which are often used via interfaces and reflection). Only refs from the same repo are counted, so exported defs that are only used by other repos are listed too (and marked as exported).\n\nWith --format json (the default), it prints a JSON array of candidates; with --format table, aligned columns (with a header row) for people; and with --format quiet, nothing. It exits with status 3 if there are no candidates, 1 if the query fails, and 0 otherwise.",
+		&storeDeadCodeCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = c.AddCommand("cycles",
+		"list dependency cycles among source units",
+		"The cycles command finds dependency cycles among source units, where a unit depends on another if it refers to defs in the other unit (in the same repo and commit). For each unit in a cycle, the shortest cycle through it is listed, along with the refs that create each dependency in the cycle. Breaking one of the dependencies in each listed cycle (e.g., by moving the referenced defs) untangles the units.\n\nWith --format table (the default), it prints each cycle and its dependencies for people; with --format json, a JSON array of cycles; and with --format quiet, nothing. It exits with status 3 if there are no cycles, 1 if the query fails, and 0 otherwise.",
+		&storeCyclesCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	infoC, err := c.AddCommand("info",
+		"show the provenance of a version's data",
+		"The info command shows the provenance manifest of a version's data: the src version, OS/arch, and command-line arguments of the build that produced it and of the import that stored it, and the versions and commits of the toolchains that the build used. The manifest is written by 'src make' and stored by 'src store import', so that indexes can be audited and reproduced later.\n\nWith --format table (the default), it prints the manifest for people; with --format json, the manifest as a JSON object; and with --format quiet, nothing. It exits with status 1 if the version has no manifest, and 0 otherwise.",
+		&storeInfoCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	setDefaultRepoURIOpt(infoC)
+	setDefaultCommitIDOpt(infoC)
+
+	filesC, err := c.AddCommand("files",
+		"list a version's files (with their languages, SLOC, and defs)",
+		"The files command lists the file summaries of a version: the language, number of non-blank lines (SLOC), number of defs, and top-level defs of each file in each source unit. Summaries are computed when the graph output is normalized and stored by 'src store import', so that directory and file browsers can show them without reading all of the version's defs.\n\nWith --format table (the default), it prints aligned columns (with a header row) for people; with --format json, a JSON array of file summaries; and with --format quiet, nothing. It exits with status 3 if no files match, 1 if the query fails, and 0 otherwise.",
+		&storeFilesCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+	setDefaultRepoURIOpt(filesC)
+	setDefaultCommitIDOpt(filesC)
+
+	_, err = c.AddCommand("warm",
+		"read a version's indexes (to warm caches)",
+		"The warm command reads the tree-level indexes (of def names, files, and source units) of each REPO@COMMIT, so that the OS has them cached in memory and the first queries of the version after a restart (e.g., of 'src serve') don't wait for them to be read from disk. (To keep the indexes in the memory of a server process, use 'src serve --preload'.)",
+		&storeWarmCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
 // OpenStore is called by all of the store subcommands to open the
@@ -140,8 +219,12 @@ var OpenStore func() (interface{}, error) = storeCmd.store
 
 type StoreCmd struct {
 	Type   string `short:"t" long:"type" description:"the (multi-)repo store type to use (RepoStore, MultiRepoStore, etc.)" default:"RepoStore"`
-	Root   string `short:"r" long:"root" description:"the root of the store (repo clone dir for RepoStore, global path for MultiRepoStore, etc.)" default:".srclib-store"`
+	Root   string `short:"r" long:"root" description:"the root of the store (repo clone dir for RepoStore, global path for MultiRepoStore, etc.), or the URL of a store of a registered store backend (e.g., dynamodb://TABLE)" default:".srclib-store"`
 	Config string `long:"config" description:"(rarely used) JSON-encoded config for extra config, specific to each store type"`
+
+	ReadOnly bool `long:"read-only" description:"open the store read-only (e.g., to query a store that another process or host imports into)"`
+
+	Federate []string `long:"federate" description:"also answer queries from this store: a MultiRepoStore dir, or grpc://[TOKEN@]HOST:PORT of a 'src serve --grpc' server (grpcs:// for TLS, which is required to send a token to a remote host; may be repeated; requires --type MultiRepoStore)" value-name:"STORE"`
 }
 
 var storeCmd StoreCmd
@@ -150,28 +233,70 @@ func (c *StoreCmd) Execute(args []string) error { return nil }
 
 // store returns the store specified by StoreCmd's Type and Root
 // options.
+//
+// Imports into a writable store are staged (see store.RepoStager), so
+// read-only stores opened by other processes never see partially
+// imported commits.
 func (c *StoreCmd) store() (interface{}, error) {
-	fs := rwvfs.OS(c.Root)
-
-	type createParents interface {
-		CreateParentDirs(bool)
+	if store.LookupBackend(c.Root) != nil {
+		return c.backendStore()
 	}
-	if fs, ok := fs.(createParents); ok {
-		fs.CreateParentDirs(true)
+
+	var fs rwvfs.WalkableFileSystem
+	if c.ReadOnly {
+		fs = rwvfs.Walkable(rwvfs.ReadOnly(rwvfs.OS(c.Root)))
+	} else {
+		osFS := rwvfs.OS(c.Root)
+		type createParents interface {
+			CreateParentDirs(bool)
+		}
+		if osFS, ok := osFS.(createParents); ok {
+			osFS.CreateParentDirs(true)
+		}
+		fs = store.WithOSRename(rwvfs.Walkable(osFS), c.Root)
 	}
 
 	switch c.Type {
 	case "RepoStore":
+		if len(c.Federate) > 0 {
+			return nil, fmt.Errorf("--federate requires --type MultiRepoStore")
+		}
 		return store.NewFSRepoStore(fs), nil
 	case "MultiRepoStore":
-		return store.NewFSMultiRepoStore(rwvfs.Walkable(fs), nil), nil
+		s := store.NewFSMultiRepoStore(fs, nil)
+		if len(c.Federate) > 0 {
+			return federatedStore(s, c.Federate)
+		}
+		return s, nil
 	default:
 		return nil, fmt.Errorf("unrecognized store --type value: %q (valid values are RepoStore, MultiRepoStore)", c.Type)
 	}
 }
 
+// backendStore opens the store at the URL --root with the store
+// backend registered for its scheme (see store.RegisterBackend). The
+// store's type is determined by the backend's capabilities, so --type
+// is only checked against them.
+func (c *StoreCmd) backendStore() (interface{}, error) {
+	s, caps, err := store.OpenURL(c.Root, store.BackendOptions{ReadOnly: c.ReadOnly, Config: []byte(c.Config)})
+	if err != nil {
+		return nil, err
+	}
+	if c.Type == "MultiRepoStore" && !caps.Has(store.CapMultiRepo) {
+		return nil, fmt.Errorf("store backend for %s does not support --type MultiRepoStore (its capabilities are %s)", c.Root, caps)
+	}
+	if len(c.Federate) > 0 {
+		mrs, ok := s.(store.MultiRepoStore)
+		if !ok {
+			return nil, fmt.Errorf("--federate requires a MultiRepoStore (the store backend for %s has capabilities %s)", c.Root, caps)
+		}
+		return federatedStore(mrs, c.Federate)
+	}
+	return s, nil
+}
+
 type StoreImportCmd struct {
-	ImportOpt
+	importer.Options
 
 	Quiet bool `short:"q" long:"quiet" description:"silence all output"`
 
@@ -181,6 +306,8 @@ type StoreImportCmd struct {
 	SampleImportOnly bool `long:"sample-import-only" description:"(sample data) only import, don't demonstrate listing data"`
 
 	RemoteBuildData bool `long:"remote-build-data" description:"import remote build data (not the local .srclib-cache build data)"`
+
+	Metrics string `long:"metrics" description:"write import metrics (in Prometheus text format) to FILE after importing" value-name:"FILE"`
 }
 
 var storeImportCmd StoreImportCmd
@@ -205,138 +332,38 @@ func (c *StoreImportCmd) Execute(args []string) error {
 		log.Printf("# Importing build data for %s (commit %s) from %s", c.Repo, c.CommitID, label)
 	}
 
-	if err := Import(bdfs, s, c.ImportOpt); err != nil {
-		return err
-	}
-	if !c.Quiet {
-		log.Printf("# Import completed in %s.", time.Since(start))
-	}
-	return nil
-}
-
-type ImportOpt struct {
-	DryRun  bool `short:"n" long:"dry-run" description:"print what would be done but don't do anything"`
-	NoIndex bool `long:"no-index" description:"don't build indexes (indexes inside a single source unit are always built)"`
-
-	Repo     string `long:"repo" description:"only import for this repo"`
-	Unit     string `long:"unit" description:"only import source units with this name"`
-	UnitType string `long:"unit-type" description:"only import source units with this type"`
-	CommitID string `long:"commit" description:"commit ID of commit whose data to import"`
-
-	Verbose bool
-}
-
-// Import imports build data into a RepoStore or MultiRepoStore.
-func Import(buildDataFS vfs.FileSystem, stor interface{}, opt ImportOpt) error {
-	// Traverse the build data directory for this repo and commit to
-	// create the makefile that lists the targets (which are the data
-	// files we will import).
-	treeConfig, err := config.ReadCached(buildDataFS)
-	if err != nil {
-		return err
-	}
-	mf, err := plan.CreateMakefile(".", nil, "", treeConfig, plan.Options{NoCache: true})
-	if err != nil {
-		return err
+	if c.IndexContent && c.ContentDir == "" {
+		if lrepo, err := openLocalRepo(); err == nil && lrepo.RootDir != "" {
+			c.ContentDir = lrepo.RootDir
+		}
 	}
 
-	var (
-		mu               sync.Mutex
-		hasIndexableData bool
-	)
-
-	par := parallel.NewRun(10)
-	for _, rule_ := range mf.Rules {
-		rule := rule_
-
-		if opt.Unit != "" || opt.UnitType != "" {
-			type ruleForSourceUnit interface {
-				SourceUnit() *unit.SourceUnit
-			}
-			if rule, ok := rule.(ruleForSourceUnit); ok {
-				u := rule.SourceUnit()
-				if (opt.Unit != "" && u.Name != opt.Unit) || (opt.UnitType != "" && u.Type != opt.UnitType) {
-					continue
-				}
-			} else {
-				// Skip all non-source-unit rules if --unit or
-				// --unit-type are specified.
-				continue
-			}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	err = importBuildData(ctx, bdfs, s, c.Options)
+	if c.Metrics != "" {
+		if err := metrics.WriteFile(c.Metrics); err != nil {
+			logutil.Default.Warn("Failed to write metrics.", "file", c.Metrics, "err", err)
 		}
-
-		par.Do(func() error {
-			switch rule := rule.(type) {
-			case *grapher.GraphUnitRule:
-				var data graph.Output
-				if err := readJSONFileFS(buildDataFS, rule.Target(), &data); err != nil {
-					if os.IsNotExist(err) {
-						log.Printf("Warning: no build data for unit %s %s.", rule.Unit.Type, rule.Unit.Name)
-						return nil
-					}
-					return err
-				}
-				if opt.DryRun || GlobalOpt.Verbose {
-					log.Printf("# Importing graph data (%d defs, %d refs, %d docs, %d anns) for unit %s %s", len(data.Defs), len(data.Refs), len(data.Docs), len(data.Anns), rule.Unit.Type, rule.Unit.Name)
-					if opt.DryRun {
-						return nil
-					}
-				}
-
-				// HACK: Transfer docs to [def].Docs.
-				docsByPath := make(map[string]*graph.Doc, len(data.Docs))
-				for _, doc := range data.Docs {
-					docsByPath[doc.Path] = doc
-				}
-				for _, def := range data.Defs {
-					if doc, present := docsByPath[def.Path]; present {
-						def.Docs = append(def.Docs, graph.DefDoc{Format: doc.Format, Data: doc.Data})
-					}
-				}
-
-				switch imp := stor.(type) {
-				case store.RepoImporter:
-					if err := imp.Import(opt.CommitID, rule.Unit, data); err != nil {
-						return err
-					}
-				case store.MultiRepoImporter:
-					if err := imp.Import(opt.Repo, opt.CommitID, rule.Unit, data); err != nil {
-						return err
-					}
-				default:
-					return fmt.Errorf("store (type %T) does not implement importing", stor)
-				}
-
-				mu.Lock()
-				hasIndexableData = true
-				mu.Unlock()
-			}
-			return nil
-		})
 	}
-	if err := par.Wait(); err != nil {
+	if err != nil {
 		return err
 	}
-
-	if hasIndexableData && !opt.NoIndex {
-		if GlobalOpt.Verbose {
-			log.Printf("# Building indexes")
-		}
-		switch s := stor.(type) {
-		case store.RepoIndexer:
-			if err := s.Index(opt.CommitID); err != nil {
-				return err
-			}
-		case store.MultiRepoIndexer:
-			if err := s.Index(opt.Repo, opt.CommitID); err != nil {
-				return err
-			}
-		}
+	if !c.Quiet {
+		log.Printf("# Import completed in %s.", time.Since(start))
 	}
-
 	return nil
 }
 
+// importBuildData imports build data into stor (see
+// importer.Import), recording this src process in the imported
+// commit's provenance manifest.
+func importBuildData(ctx context.Context, buildDataFS vfs.FileSystem, stor interface{}, opt importer.Options) error {
+	opt.Process = newProcessProvenance()
+	opt.Verbose = opt.Verbose || GlobalOpt.Verbose
+	return importer.Import(ctx, buildDataFS, stor, opt)
+}
+
 // sample imports sample data (when the --sample option is given).
 func (c *StoreImportCmd) sample(s interface{}) error {
 	dataString := []byte(`"abcdabcdabcdabcdabcdcdabcdabcdabcdabcdabcdabcdabcdabcdcdabcdabcdabcdabcdabcdabcdabcdabcdcdabcdabcdabcdabcdabcdabcdabcdabcdcdabcdabcdabcdabcdabcdabcdabcdabcdcdabcdabcdabcdabcdabcdabcdabcdabcdcdabcdabcdabcdabcdabcdabcdabcdabcdcdabcdabcdabcd"`)
@@ -620,6 +647,17 @@ func (c storeIndexCriteria) IndexCriteria() store.IndexCriteria {
 // doStoreIndexesCmd is invoked by both StoreIndexesCmd.Execute and
 // StoreBuildIndexesCmd.Execute.
 func doStoreIndexesCmd(crit store.IndexCriteria, opt storeIndexOptions, f func(interface{}, store.IndexCriteria, chan<- store.IndexStatus) ([]store.IndexStatus, error)) error {
+	if opt.Output != "" {
+		opt.Format = opt.Output
+	}
+	format, err := checkTextFormat(opt.Format)
+	if err != nil {
+		return err
+	}
+	if format == formatTable {
+		return errors.New("--format table is not supported (use text, json, or quiet)")
+	}
+
 	if opt.Parallel != 1 {
 		log.Printf("NOTE: Index parallelism is %d. Output will printed as it is available, not necessarily ordered and grouped by repo, source unit, etc.", opt.Parallel)
 	}
@@ -640,8 +678,20 @@ func doStoreIndexesCmd(crit store.IndexCriteria, opt storeIndexOptions, f func(i
 	hasError := false
 	done := make(chan struct{})
 	indexChan := make(chan store.IndexStatus)
-	switch opt.Output {
-	case "json":
+	switch format {
+	case formatQuiet:
+		go func() {
+			for x := range indexChan {
+				if x.Error != "" || x.BuildError != "" {
+					hasError = true
+				}
+				if err := printIndex(x); err != nil {
+					log.Fatal(err)
+				}
+			}
+			done <- struct{}{}
+		}()
+	case formatJSON:
 		go func() {
 			for x := range indexChan {
 				PrintJSON(x, "")
@@ -651,7 +701,7 @@ func doStoreIndexesCmd(crit store.IndexCriteria, opt storeIndexOptions, f func(i
 			}
 			done <- struct{}{}
 		}()
-	case "text":
+	case formatText:
 		_, isMultiRepo := s.(store.MultiRepoStore)
 		var repoTab string
 		if isMultiRepo {
@@ -715,8 +765,6 @@ func doStoreIndexesCmd(crit store.IndexCriteria, opt storeIndexOptions, f func(i
 			}
 			done <- struct{}{}
 		}()
-	default:
-		return fmt.Errorf("unexpected --output value: %q", opt.Output)
 	}
 
 	_, err = f(s, crit, indexChan)
@@ -734,7 +782,8 @@ func doStoreIndexesCmd(crit store.IndexCriteria, opt storeIndexOptions, f func(i
 }
 
 type storeIndexOptions struct {
-	Output   string `short:"o" long:"output" description:"output format (text|json)" default:"text"`
+	Format   string `long:"format" description:"output format" default:"text" value-name:"text|json|quiet"`
+	Output   string `short:"o" long:"output" description:"(deprecated) alias of --format" value-name:"text|json"`
 	Parallel int    `short:"p" long:"parallel" description:"parallelism (may produce out-of-order output)" default:"1"`
 
 	Print bool `long:"print" description:"(debug) print representation of index"`
@@ -764,6 +813,8 @@ func (c *StoreIndexCmd) Execute(args []string) error {
 
 type StoreReposCmd struct {
 	IDContains string `short:"i" long:"id-contains" description:"filter to repos whose ID contains this substring"`
+
+	Format string `long:"format" description:"output format" default:"text" value-name:"text|json|table|quiet"`
 }
 
 func (c *StoreReposCmd) filters() []store.RepoFilter {
@@ -777,6 +828,10 @@ func (c *StoreReposCmd) filters() []store.RepoFilter {
 var storeReposCmd StoreReposCmd
 
 func (c *StoreReposCmd) Execute(args []string) error {
+	format, err := checkTextFormat(c.Format)
+	if err != nil {
+		return err
+	}
 	s, err := OpenStore()
 	if err != nil {
 		return err
@@ -791,8 +846,22 @@ func (c *StoreReposCmd) Execute(args []string) error {
 	if err != nil {
 		return err
 	}
-	for _, repo := range repos {
-		fmt.Println(repo)
+	switch format {
+	case formatJSON:
+		if repos == nil {
+			repos = []string{}
+		}
+		PrintJSON(repos, "")
+	case formatText, formatTable:
+		if format == formatTable {
+			fmt.Println("REPO")
+		}
+		for _, repo := range repos {
+			fmt.Println(repo)
+		}
+	}
+	if len(repos) == 0 {
+		return errNoResults
 	}
 	return nil
 }
@@ -802,6 +871,8 @@ type StoreVersionsCmd struct {
 	CommitIDPrefix string `long:"commit" description:"commit ID prefix"`
 
 	RepoCommitIDs string `long:"repo-commits" description:"comma-separated list of repo@commitID specifiers"`
+
+	Format string `long:"format" description:"output format" default:"text" value-name:"text|json|table|quiet"`
 }
 
 func (c *StoreVersionsCmd) filters() []store.VersionFilter {
@@ -823,6 +894,10 @@ func (c *StoreVersionsCmd) filters() []store.VersionFilter {
 var storeVersionsCmd StoreVersionsCmd
 
 func (c *StoreVersionsCmd) Execute(args []string) error {
+	format, err := checkTextFormat(c.Format)
+	if err != nil {
+		return err
+	}
 	s, err := OpenStore()
 	if err != nil {
 		return err
@@ -837,11 +912,31 @@ func (c *StoreVersionsCmd) Execute(args []string) error {
 	if err != nil {
 		return err
 	}
-	for _, version := range versions {
-		if version.Repo != "" {
-			fmt.Print(version.Repo, "\t")
+	switch format {
+	case formatJSON:
+		if versions == nil {
+			versions = []*store.Version{}
+		}
+		PrintJSON(versions, "  ")
+	case formatText:
+		for _, version := range versions {
+			if version.Repo != "" {
+				fmt.Print(version.Repo, "\t")
+			}
+			fmt.Println(version.CommitID)
+		}
+	case formatTable:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "REPO\tCOMMITID")
+		for _, version := range versions {
+			fmt.Fprintf(tw, "%s\t%s\n", orDash(version.Repo), version.CommitID)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
 		}
-		fmt.Println(version.CommitID)
+	}
+	if len(versions) == 0 {
+		return errNoResults
 	}
 	return nil
 }
@@ -855,6 +950,8 @@ type StoreUnitsCmd struct {
 	RepoCommitIDs string `long:"repo-commits" description:"comma-separated list of repo@commitID specifiers"`
 
 	File string `long:"file" description:"filter by units whose Files list contains this file"`
+
+	Format string `long:"format" description:"output format" default:"json" value-name:"json|table|quiet"`
 }
 
 func (c *StoreUnitsCmd) filters() []store.UnitFilter {
@@ -883,6 +980,10 @@ func (c *StoreUnitsCmd) filters() []store.UnitFilter {
 var storeUnitsCmd StoreUnitsCmd
 
 func (c *StoreUnitsCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
 	s, err := OpenStore()
 	if err != nil {
 		return err
@@ -897,7 +998,22 @@ func (c *StoreUnitsCmd) Execute(args []string) error {
 	if err != nil {
 		return err
 	}
-	PrintJSON(units, "  ")
+	switch format {
+	case formatJSON:
+		PrintJSON(units, "  ")
+	case formatTable:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "REPO\tCOMMITID\tTYPE\tNAME\tDIR\tFILES")
+		for _, u := range units {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n", orDash(u.Repo), orDash(u.CommitID), u.Type, u.Name, orDash(u.Dir), len(u.Files))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(units) == 0 {
+		return errNoResults
+	}
 	return nil
 }
 
@@ -906,29 +1022,54 @@ type StoreDefsCmd struct {
 	Path     string `long:"path"`
 	UnitType string `long:"unit-type" `
 	Unit     string `long:"unit"`
+	Variant  string `long:"variant" description:"with --unit, only show defs graphed under this build configuration of the source unit ('*' to merge defs from all build configurations)" value-name:"NAME"`
 	File     string `long:"file"`
 	CommitID string `long:"commit"`
 
 	RepoCommitIDs string `long:"repo-commits" description:"comma-separated list of repo@commitID specifiers"`
 
-	Query string `long:"query"`
+	Query string `long:"query" description:"only show defs whose names start with QUERY (ordered by rank)"`
+	Fuzzy bool   `long:"fuzzy" description:"match --query as a camelCase-aware subsequence of def names (e.g., HtpSrv matches HTTPServer)"`
+	Where string `long:"where" description:"only show defs that the def query EXPR is true for (e.g., 'kind:func and exported:true and not file:*_test.go'; fields are kind, unit, unittype, file (glob), name (regexp), and exported)" value-name:"EXPR"`
+
+	FollowAliases bool `long:"follow-aliases" description:"show the defs that matching aliases (such as re-exported names) are aliases of, instead of the aliases"`
 
 	Limit  int `short:"n" long:"limit" description:"max results to return (0 for all)"`
 	Offset int `long:"offset" description:"results offset (0 to start with first results)"`
 
+	Snippets     bool `long:"snippets" description:"include each def's first line of source code (read from a local clone of its repository at its commit)"`
+	ContextLines int  `long:"context-lines" description:"with --snippets, include N lines of source code before and after each def's first line" value-name:"N"`
+
+	Format string `long:"format" description:"output format" default:"json" value-name:"json|table|quiet"`
+	Stream bool   `long:"stream" description:"print defs as newline-delimited JSON as they are read (one source unit at a time), instead of a JSON array of all defs"`
+
 	// If Filter is non-nil, it is applied along with the above
 	// filters.
 	Filter store.DefFilter
+
+	// ctx, if set, makes the query stop when it is done (see
+	// store.WithContext).
+	ctx context.Context
 }
 
-func (c *StoreDefsCmd) filters() []store.DefFilter {
+func (c *StoreDefsCmd) filters(where store.DefExpr) []store.DefFilter {
 	var fs []store.DefFilter
 	if c.UnitType != "" && c.Unit != "" {
-		fs = append(fs, store.ByUnits(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+		switch c.Variant {
+		case "":
+			fs = append(fs, store.ByUnits(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+		case allVariants:
+			fs = append(fs, store.ByUnitVariants(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+		default:
+			fs = append(fs, store.ByUnits(unit.ID2{Type: c.UnitType, Name: unit.VariantName(c.Unit, c.Variant)}))
+		}
 	}
 	if (c.UnitType != "" && c.Unit == "") || (c.UnitType == "" && c.Unit != "") {
 		log.Fatal("must specify either both or neither of --unit-type and --unit (to filter by source unit)")
 	}
+	if c.Variant != "" && c.Unit == "" {
+		log.Fatal("--variant requires --unit-type and --unit")
+	}
 	if c.CommitID != "" {
 		fs = append(fs, store.ByCommitIDs(c.CommitID))
 	}
@@ -945,12 +1086,24 @@ func (c *StoreDefsCmd) filters() []store.DefFilter {
 		fs = append(fs, store.ByFiles(path.Clean(c.File)))
 	}
 	if c.Query != "" {
-		fs = append(fs, store.ByDefQuery(c.Query))
+		if c.Fuzzy {
+			fs = append(fs, store.ByDefFuzzyQuery(c.Query))
+		} else {
+			fs = append(fs, store.ByDefQuery(c.Query))
+		}
+	}
+	if where != nil {
+		fs = append(fs, store.DefExprFilters(where)...)
 	}
 	if c.Filter != nil {
 		fs = append(fs, c.Filter)
 	}
-	if c.Limit != 0 || c.Offset != 0 {
+	if c.ctx != nil {
+		fs = append(fs, store.WithContext(c.ctx))
+	}
+	if (c.Limit != 0 || c.Offset != 0) && c.Query == "" {
+		// Query results are ordered by rank (in Get), so they
+		// must be limited after sorting.
 		fs = append(fs, store.Limit(c.Limit, c.Offset))
 	}
 	return fs
@@ -959,11 +1112,36 @@ func (c *StoreDefsCmd) filters() []store.DefFilter {
 var storeDefsCmd StoreDefsCmd
 
 func (c *StoreDefsCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	if c.Stream {
+		if format != formatJSON {
+			return errors.New("--stream prints JSON, so it can't be used with --format table or quiet")
+		}
+		return c.stream(newJSONLineWriter(os.Stdout))
+	}
 	defs, err := c.Get()
 	if err != nil {
 		return err
 	}
-	PrintJSON(defs, "  ")
+	switch format {
+	case formatJSON:
+		PrintJSON(defs, "  ")
+	case formatTable:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "REPO\tCOMMITID\tUNITTYPE\tUNIT\tPATH\tKIND\tNAME\tFILE\tDEFSTART\tDEFEND\tEXPORTED")
+		for _, def := range defs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%v\n", orDash(def.Repo), orDash(def.CommitID), def.UnitType, def.Unit, def.Path, orDash(def.Kind), def.Name, orDash(def.File), def.DefStart, def.DefEnd, def.Exported)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(defs) == 0 {
+		return errNoResults
+	}
 	return nil
 }
 
@@ -978,17 +1156,145 @@ func (c *StoreDefsCmd) Get() ([]*graph.Def, error) {
 		return nil, fmt.Errorf("store (type %T) does not implement listing defs", s)
 	}
 
-	defs, err := us.Defs(c.filters()...)
+	var where store.DefExpr
+	if c.Where != "" {
+		if where, err = store.ParseDefExpr(c.Where); err != nil {
+			return nil, err
+		}
+	}
+	defs, err := us.Defs(c.filters(where)...)
 	if err != nil {
 		return nil, err
 	}
+	if c.Variant == allVariants {
+		defs = store.MergeVariantDefs(defs)
+	}
+	if c.FollowAliases {
+		if defs, err = store.ResolveAliases(us, defs, c.aliasFilters()...); err != nil {
+			return nil, err
+		}
+	}
+	if c.Query != "" {
+		graph.SortDefsByRank(defs)
+		if c.Fuzzy {
+			query.SortDefsByFuzzyScore(defs, c.Query)
+		}
+		defs = query.LimitDefs(defs, c.Limit, c.Offset)
+	}
+	if c.Snippets {
+		query.SetDefSnippets(defs, c.ContextLines, snippets.readSnippetFile)
+	}
 	return defs, nil
 }
 
+// stream writes the defs that match c's filters to w, one source unit
+// at a time, so that only one unit's defs are in memory at once. (Def
+// filters aren't told which repo and unit a def is in, so unlike
+// refs, defs can't be written as the store reads them.)
+func (c *StoreDefsCmd) stream(w *jsonLineWriter) error {
+	switch {
+	case c.Query != "":
+		return errors.New("--stream can't be used with --query (which sorts all results by rank)")
+	case c.Variant == allVariants:
+		return errors.New("--stream can't be used with --variant '*' (which merges the defs of all variants)")
+	case len(storeCmd.Federate) > 0:
+		return errors.New("--stream can't be used with --federate (whose stores' results are merged after they are read)")
+	}
+
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+	rs, ok := s.(store.RepoStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing source units", s)
+	}
+
+	var where store.DefExpr
+	if c.Where != "" {
+		if where, err = store.ParseDefExpr(c.Where); err != nil {
+			return err
+		}
+	}
+	fs := c.filters(where)
+	var ufs []store.UnitFilter
+	for _, f := range fs {
+		if f, ok := f.(store.UnitFilter); ok {
+			ufs = append(ufs, f)
+		}
+	}
+	units, err := rs.Units(ufs...)
+	if err != nil {
+		return err
+	}
+	sort.Slice(units, func(i, j int) bool {
+		a, b := units[i], units[j]
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		if a.CommitID != b.CommitID {
+			return a.CommitID < b.CommitID
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
+
+	for _, u := range units {
+		// The Limit filter (if any) is shared by all units' queries,
+		// so it counts the defs of all units.
+		if _, more := store.LimitRemaining(fs); !more || w.Err() != nil {
+			break
+		}
+		dfs := append(fs[:len(fs):len(fs)], store.ByCommitIDs(u.CommitID), store.ByUnits(u.ID2()))
+		if u.Repo != "" {
+			dfs = append(dfs, store.ByRepos(u.Repo))
+		}
+		defs, err := rs.Defs(dfs...)
+		if err != nil {
+			return err
+		}
+		if c.FollowAliases {
+			// Duplicates are only removed within each unit.
+			if defs, err = store.ResolveAliases(rs, defs, c.aliasFilters()...); err != nil {
+				return err
+			}
+		}
+		if c.Snippets {
+			query.SetDefSnippets(defs, c.ContextLines, snippets.readSnippetFile)
+		}
+		for _, def := range defs {
+			w.write(def)
+		}
+	}
+	if err := w.Err(); err != nil {
+		return err
+	}
+	if w.n == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// aliasFilters returns the filters of the defs that aliases may
+// resolve to (see store.ResolveAliases).
+func (c *StoreDefsCmd) aliasFilters() []store.DefFilter {
+	if c.Filter != nil {
+		return []store.DefFilter{c.Filter}
+	}
+	return nil
+}
+
+// allVariants is the --variant value that selects (and merges) data
+// from all build configurations of a source unit (see unit.Variant).
+const allVariants = "*"
+
 type StoreRefsCmd struct {
 	Repo     string `long:"repo"`
 	UnitType string `long:"unit-type" `
 	Unit     string `long:"unit"`
+	Variant  string `long:"variant" description:"with --unit, only show refs graphed under this build configuration of the source unit ('*' to merge refs from all build configurations)" value-name:"NAME"`
 	File     string `long:"file"`
 	CommitID string `long:"commit"`
 
@@ -1002,23 +1308,57 @@ type StoreRefsCmd struct {
 	DefUnit     string `long:"def-unit"`
 	DefPath     string `long:"def-path"`
 
+	Linked bool `long:"linked" description:"with --def-path, also show refs to the defs linked to the def by a shared moniker (such as code in other languages generated from the same .proto definition)"`
+
+	FollowAliases bool `long:"follow-aliases" description:"with --def-path, also show refs to the defs that are aliases of the def (such as re-exports of it), so that refs to an alias count as refs to the original def"`
+
 	Broken   bool `long:"broken" description:"only show refs that point to nonexistent defs"`
 	Coverage bool `long:"coverage" description:"print a coverage summary (resolved refs, broken refs, total refs)"`
 
-	Format string `long:"format" description:"output format ('json' or 'none')" default:"json"`
+	MinConfidence    float32 `long:"min-confidence" description:"only show refs whose confidence (how likely it is, from 0 to 1, that the ref refers to its def) is at least C; refs that the grapher resolved with certainty have confidence 1" value-name:"C"`
+	SortByConfidence bool    `long:"sort-by-confidence" description:"sort refs by descending confidence, so that certain refs come before probable ones (--limit and --offset apply after sorting)"`
+
+	Format string `long:"format" description:"output format ('none' is a deprecated alias of 'quiet')" default:"json" value-name:"json|table|quiet"`
 
 	Limit  int `short:"n" long:"limit" description:"max results to return (0 for all)"`
 	Offset int `long:"offset" description:"results offset (0 to start with first results)"`
+
+	Snippets     bool `long:"snippets" description:"include the lines of source code that contain each ref (read from a local clone of its repository at its commit)"`
+	ContextLines int  `long:"context-lines" description:"with --snippets, include N lines of source code before and after each ref's lines" value-name:"N"`
+
+	Stream bool `long:"stream" description:"print refs as newline-delimited JSON as they are read (in no particular order), instead of a JSON array of all refs"`
+
+	// If Filter is non-nil, it is applied along with the above
+	// filters.
+	Filter store.RefFilter
+
+	// ctx, if set, makes the query stop when it is done (see
+	// store.WithContext).
+	ctx context.Context
+
+	// emit, if set, is called with each ref that matches the
+	// filters, instead of returning the refs (see stream).
+	emit func(*graph.Ref)
 }
 
 func (c *StoreRefsCmd) filters() []store.RefFilter {
 	var fs []store.RefFilter
 	if c.UnitType != "" && c.Unit != "" {
-		fs = append(fs, store.ByUnits(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+		switch c.Variant {
+		case "":
+			fs = append(fs, store.ByUnits(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+		case allVariants:
+			fs = append(fs, store.ByUnitVariants(unit.ID2{Type: c.UnitType, Name: c.Unit}))
+		default:
+			fs = append(fs, store.ByUnits(unit.ID2{Type: c.UnitType, Name: unit.VariantName(c.Unit, c.Variant)}))
+		}
 	}
 	if (c.UnitType != "" && c.Unit == "") || (c.UnitType == "" && c.Unit != "") {
 		log.Fatal("must specify either both or neither of --unit-type and --unit (to filter by source unit)")
 	}
+	if c.Variant != "" && c.Unit == "" {
+		log.Fatal("--variant requires --unit-type and --unit")
+	}
 	if c.CommitID != "" {
 		fs = append(fs, store.ByCommitIDs(c.CommitID))
 	}
@@ -1066,22 +1406,65 @@ func (c *StoreRefsCmd) filters() []store.RefFilter {
 			})))
 		}
 	}
-	if c.Limit != 0 || c.Offset != 0 {
+	if c.MinConfidence != 0 {
+		fs = append(fs, store.RefFilterFunc(func(ref *graph.Ref) bool {
+			return ref.EffectiveConfidence() >= c.MinConfidence
+		}))
+	}
+	if c.Filter != nil {
+		fs = append(fs, c.Filter)
+	}
+	if c.ctx != nil {
+		fs = append(fs, store.WithContext(c.ctx))
+	}
+	if (c.Limit != 0 || c.Offset != 0) && !c.SortByConfidence {
+		// Refs sorted by confidence (in Get) must be limited after
+		// sorting.
 		fs = append(fs, store.Limit(c.Limit, c.Offset))
 	}
+	if c.emit != nil {
+		// This must be the last filter, so that it only sees the refs
+		// that the others select (and that are within the limit).
+		fs = append(fs, store.AbsRefFilterFunc(func(ref *graph.Ref) bool {
+			c.emit(ref)
+			return false
+		}))
+	}
 	return fs
 }
 
 var storeRefsCmd StoreRefsCmd
 
 func (c *StoreRefsCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	if c.Stream {
+		if format != formatJSON {
+			return errors.New("--stream prints JSON, so it can't be used with --format table or quiet")
+		}
+		return c.stream(newJSONLineWriter(os.Stdout))
+	}
 	refs, err := c.Get()
 	if err != nil {
 		return err
 	}
-	switch c.Format {
-	case "json":
+	switch format {
+	case formatJSON:
 		PrintJSON(refs, "  ")
+	case formatTable:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "REPO\tCOMMITID\tUNITTYPE\tUNIT\tFILE\tSTART\tEND\tDEFREPO\tDEFUNITTYPE\tDEFUNIT\tDEFPATH\tDEF\tCONFIDENCE")
+		for _, ref := range refs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\t%v\t%g\n", orDash(ref.Repo), orDash(ref.CommitID), ref.UnitType, ref.Unit, ref.File, ref.Start, ref.End, orDash(ref.DefRepo), ref.DefUnitType, ref.DefUnit, ref.DefPath, ref.Def, ref.EffectiveConfidence())
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(refs) == 0 {
+		return errNoResults
 	}
 	return nil
 }
@@ -1096,11 +1479,37 @@ func (c *StoreRefsCmd) Get() ([]*graph.Ref, error) {
 	if !ok {
 		return nil, fmt.Errorf("store (type %T) does not implement listing refs", s)
 	}
+	if !graph.ValidConfidence(c.MinConfidence) {
+		return nil, fmt.Errorf("--min-confidence %v is not between 0 and 1", c.MinConfidence)
+	}
 
 	refs, err := us.Refs(c.filters()...)
 	if err != nil {
 		return nil, err
 	}
+	if c.Linked {
+		if c.DefPath == "" {
+			return nil, errors.New("--linked requires --def-path")
+		}
+		linked, err := c.linkedRefs(us)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, linked...)
+	}
+	if c.FollowAliases {
+		if c.DefPath == "" {
+			return nil, errors.New("--follow-aliases requires --def-path")
+		}
+		aliased, err := c.aliasRefs(us)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, aliased...)
+	}
+	if c.Variant == allVariants {
+		refs = store.MergeVariantRefs(refs)
+	}
 
 	allRefs := refs
 	var brokenRefs []*graph.Ref
@@ -1121,6 +1530,92 @@ func (c *StoreRefsCmd) Get() ([]*graph.Ref, error) {
 		log.Printf("#  - %d broken refs (%.1f)", len(brokenRefs), percent(len(brokenRefs), len(allRefs)))
 	}
 
+	if c.SortByConfidence {
+		sort.Stable(graph.RefsByConfidence(refs))
+		refs = query.LimitRefs(refs, c.Limit, c.Offset)
+	}
+	if c.Snippets {
+		query.SetRefSnippets(refs, c.ContextLines, snippets.readSnippetFile)
+	}
+	return refs, nil
+}
+
+// stream writes the refs that match c's filters to w as the store
+// reads them, without keeping them in memory.
+func (c *StoreRefsCmd) stream(w *jsonLineWriter) error {
+	switch {
+	case c.Broken || c.Coverage:
+		return errors.New("--stream can't be used with --broken or --coverage (which check all refs' defs)")
+	case c.Variant == allVariants:
+		return errors.New("--stream can't be used with --variant '*' (which merges the refs of all variants)")
+	case c.SortByConfidence:
+		return errors.New("--stream can't be used with --sort-by-confidence (which sorts all refs)")
+	case len(storeCmd.Federate) > 0:
+		return errors.New("--stream can't be used with --federate (whose stores' results are merged after they are read)")
+	}
+	c2 := *c
+	c2.emit = func(ref *graph.Ref) {
+		if c.Snippets {
+			query.SetRefSnippets([]*graph.Ref{ref}, c.ContextLines, snippets.readSnippetFile)
+		}
+		w.write(ref)
+	}
+	if _, err := c2.Get(); err != nil {
+		return err
+	}
+	if err := w.Err(); err != nil {
+		return err
+	}
+	if w.n == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// linkedRefs returns the refs to the defs that are linked to the def
+// specified by c's --def-* flags (see store.LinkedDefs), filtered by
+// c's other filters.
+func (c *StoreRefsCmd) linkedRefs(us store.UnitStore) ([]*graph.Ref, error) {
+	linked, err := store.LinkedDefs(us, c.refDefKey())
+	if err != nil {
+		return nil, err
+	}
+	return c.refsToDefs(us, linked)
+}
+
+// aliasRefs returns the refs to the defs that are aliases of the def
+// specified by c's --def-* flags (see store.AliasDefs), filtered by
+// c's other filters.
+func (c *StoreRefsCmd) aliasRefs(us store.UnitStore) ([]*graph.Ref, error) {
+	aliases, err := store.AliasDefs(us, c.refDefKey())
+	if err != nil {
+		return nil, err
+	}
+	return c.refsToDefs(us, aliases)
+}
+
+func (c *StoreRefsCmd) refDefKey() graph.RefDefKey {
+	return graph.RefDefKey{
+		DefRepo:     c.DefRepo,
+		DefUnitType: c.DefUnitType,
+		DefUnit:     c.DefUnit,
+		DefPath:     c.DefPath,
+	}
+}
+
+// refsToDefs returns the refs to defs, filtered by c's filters other
+// than its --def-* flags.
+func (c *StoreRefsCmd) refsToDefs(us store.UnitStore, defs []*graph.Def) ([]*graph.Ref, error) {
+	var refs []*graph.Ref
+	for _, def := range defs {
+		c2 := *c
+		c2.DefRepo, c2.DefUnitType, c2.DefUnit, c2.DefPath = def.Repo, def.UnitType, def.Unit, def.Path
+		defRefs, err := us.Refs(c2.filters()...)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, defRefs...)
+	}
 	return refs, nil
 }
 
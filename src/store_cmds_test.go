@@ -0,0 +1,216 @@
+package src
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// openStreamTestStore makes OpenStore return a store with 2 source
+// units (u1 with defs a and b, and u2 with def c and refs to each
+// def), and returns a func that restores OpenStore.
+func openStreamTestStore(t *testing.T, wrap func(store.RepoStore) store.RepoStore) func() {
+	s := store.NewFSMultiRepoStore(rwvfs.Walkable(rwvfs.Map(map[string]string{})), nil)
+	def := func(path string) *graph.Def {
+		return &graph.Def{DefKey: graph.DefKey{Path: path}, Name: path, File: "f"}
+	}
+	ref := func(defUnit, defPath string, start uint32) *graph.Ref {
+		return &graph.Ref{DefRepo: "r", DefUnitType: "t", DefUnit: defUnit, DefPath: defPath, File: "f", Start: start, End: start + 1}
+	}
+	data := map[string]graph.Output{
+		"u1": {Defs: []*graph.Def{def("a"), def("b")}},
+		"u2": {
+			Defs: []*graph.Def{def("c")},
+			Refs: []*graph.Ref{ref("u1", "a", 1), ref("u1", "b", 2), ref("u2", "c", 3)},
+		},
+	}
+	for name, o := range data {
+		if err := s.Import("r", "c", &unit.SourceUnit{Type: "t", Name: name}, o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rs store.RepoStore = s
+	if wrap != nil {
+		rs = wrap(rs)
+	}
+	origOpenStore := OpenStore
+	OpenStore = func() (interface{}, error) { return rs, nil }
+	return func() { OpenStore = origOpenStore }
+}
+
+// failingDefsStore fails listing defs after the first n lookups.
+type failingDefsStore struct {
+	store.RepoStore
+	n int
+}
+
+var errDefs = errors.New("reading defs failed")
+
+func (s *failingDefsStore) Defs(fs ...store.DefFilter) ([]*graph.Def, error) {
+	if s.n == 0 {
+		return nil, errDefs
+	}
+	s.n--
+	return s.RepoStore.Defs(fs...)
+}
+
+// streamedLines returns the string that f decodes from each line of a
+// stream's newline-delimited JSON output. It reports lines that f
+// can't decode and a partial last line.
+func streamedLines(t *testing.T, label, out string, f func(line []byte) (string, error)) []string {
+	var got []string
+	sc := bufio.NewScanner(strings.NewReader(out))
+	for sc.Scan() {
+		s, err := f(sc.Bytes())
+		if err != nil {
+			t.Errorf("%s: bad line %q: %s", label, sc.Text(), err)
+			continue
+		}
+		got = append(got, s)
+	}
+	if out != "" && !strings.HasSuffix(out, "\n") {
+		t.Errorf("%s: output %q has a partial line", label, out)
+	}
+	return got
+}
+
+func defPathLine(line []byte) (string, error) {
+	var def graph.Def
+	err := json.Unmarshal(line, &def)
+	return def.Unit + "." + def.Path, err
+}
+
+func refDefPathLine(line []byte) (string, error) {
+	var ref graph.Ref
+	err := json.Unmarshal(line, &ref)
+	return ref.DefUnit + "." + ref.DefPath, err
+}
+
+func TestStoreDefsCmd_stream(t *testing.T) {
+	tests := map[string]struct {
+		cmd     StoreDefsCmd
+		wrap    func(store.RepoStore) store.RepoStore
+		writes  int // number of writes that succeed (-1 for all)
+		want    []string
+		wantErr error
+	}{
+		"all": {
+			writes: -1,
+			want:   []string{"u1.a", "u1.b", "u2.c"},
+		},
+		"limit across units": {
+			cmd:    StoreDefsCmd{Limit: 2},
+			writes: -1,
+			want:   []string{"u1.a", "u1.b"},
+		},
+		"unit": {
+			cmd:    StoreDefsCmd{UnitType: "t", Unit: "u2"},
+			writes: -1,
+			want:   []string{"u2.c"},
+		},
+		"no results": {
+			cmd:     StoreDefsCmd{UnitType: "t", Unit: "x"},
+			writes:  -1,
+			wantErr: errNoResults,
+		},
+		"store error mid-stream": {
+			// The first unit's defs are written before the error.
+			wrap:    func(rs store.RepoStore) store.RepoStore { return &failingDefsStore{RepoStore: rs, n: 1} },
+			writes:  -1,
+			want:    []string{"u1.a", "u1.b"},
+			wantErr: errDefs,
+		},
+		"write error mid-stream": {
+			writes:  1,
+			want:    []string{"u1.a"},
+			wantErr: errWrite,
+		},
+	}
+	for label, test := range tests {
+		restore := openStreamTestStore(t, test.wrap)
+		out := &failingWriter{n: test.writes}
+		err := test.cmd.stream(newJSONLineWriter(out))
+		restore()
+		if err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", label, err, test.wantErr)
+		}
+		if got := streamedLines(t, label, out.String(), defPathLine); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got defs %v, want %v", label, got, test.want)
+		}
+	}
+}
+
+func TestStoreRefsCmd_stream(t *testing.T) {
+	tests := map[string]struct {
+		cmd     StoreRefsCmd
+		writes  int      // number of writes that succeed (-1 for all)
+		want    []string // the refs' defs (sorted, since streamed refs are unordered)
+		wantErr error
+	}{
+		"all": {
+			writes: -1,
+			want:   []string{"u1.a", "u1.b", "u2.c"},
+		},
+		"def": {
+			cmd:    StoreRefsCmd{DefRepo: "r", DefUnitType: "t", DefUnit: "u1", DefPath: "b"},
+			writes: -1,
+			want:   []string{"u1.b"},
+		},
+		"no results": {
+			cmd:     StoreRefsCmd{UnitType: "t", Unit: "u1"},
+			writes:  -1,
+			wantErr: errNoResults,
+		},
+	}
+	for label, test := range tests {
+		restore := openStreamTestStore(t, nil)
+		out := &failingWriter{n: test.writes}
+		err := test.cmd.stream(newJSONLineWriter(out))
+		restore()
+		if err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", label, err, test.wantErr)
+		}
+		got := streamedLines(t, label, out.String(), refDefPathLine)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got refs to %v, want refs to %v", label, got, test.want)
+		}
+	}
+
+	// The limit and write errors stop the stream after some (unordered)
+	// refs are written.
+	for label, test := range map[string]struct {
+		cmd     StoreRefsCmd
+		writes  int
+		wantErr error
+	}{
+		"limit":                  {cmd: StoreRefsCmd{Limit: 2}, writes: -1},
+		"write error mid-stream": {writes: 2, wantErr: errWrite},
+	} {
+		restore := openStreamTestStore(t, nil)
+		out := &failingWriter{n: test.writes}
+		err := test.cmd.stream(newJSONLineWriter(out))
+		restore()
+		if err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", label, err, test.wantErr)
+		}
+		if got := streamedLines(t, label, out.String(), refDefPathLine); len(got) != 2 {
+			t.Errorf("%s: got refs to %v, want 2 refs", label, got)
+		}
+	}
+
+	c := StoreRefsCmd{SortByConfidence: true}
+	if err := c.stream(newJSONLineWriter(&failingWriter{n: -1})); err == nil {
+		t.Error("got no error for --stream with --sort-by-confidence")
+	}
+}
@@ -0,0 +1,74 @@
+package src
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+type StoreFilesCmd struct {
+	Repo     string `long:"repo" description:"repo whose files to list (for a MultiRepoStore)"`
+	CommitID string `long:"commit" description:"commit ID of the version whose files to list"`
+	UnitType string `long:"unit-type" description:"only list files in source units of this type"`
+	Unit     string `long:"unit" description:"only list files in source units with this name"`
+	Dir      string `long:"dir" description:"only list files in this directory (and its subdirectories)"`
+	File     string `long:"file" description:"only list this file"`
+	Format   string `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+}
+
+var storeFilesCmd StoreFilesCmd
+
+func (c *StoreFilesCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	if c.CommitID == "" {
+		return fmt.Errorf("no commit ID specified (use --commit)")
+	}
+
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+	summaries, err := openFileSummaries(s, c.Repo, c.CommitID)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no file summaries for commit %s (its data was imported by a version of src that didn't record them; reimport it to record them)", c.CommitID)
+	} else if err != nil {
+		return err
+	}
+
+	dir := path.Clean(c.Dir)
+	matched := []*graph.FileSummary{}
+	for _, s := range summaries {
+		if (c.UnitType != "" && s.UnitType != c.UnitType) || (c.Unit != "" && s.Unit != c.Unit) || (c.File != "" && s.File != c.File) {
+			continue
+		}
+		if c.Dir != "" && dir != "." && !strings.HasPrefix(s.File, dir+"/") {
+			continue
+		}
+		matched = append(matched, s)
+	}
+
+	switch format {
+	case formatJSON:
+		PrintJSON(matched, "  ")
+	case formatTable:
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tLANGUAGE\tSLOC\tDEFS\tUNIT\tTOP-LEVEL DEFS")
+		for _, s := range matched {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s %s\t%s\n", s.File, orDash(s.Language), s.SLOC, s.DefCount, s.UnitType, s.Unit, orDash(strings.Join(s.TopLevelDefs, ", ")))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(matched) == 0 {
+		return errNoResults
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package src
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+type StoreInfoCmd struct {
+	Repo     string `long:"repo" description:"repo whose version to show (for a MultiRepoStore)"`
+	CommitID string `long:"commit" description:"commit ID of the version to show"`
+	Format   string `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+}
+
+var storeInfoCmd StoreInfoCmd
+
+func (c *StoreInfoCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	if c.CommitID == "" {
+		return fmt.Errorf("no commit ID specified (use --commit)")
+	}
+
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+	p, err := openProvenance(s, c.Repo, c.CommitID)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no provenance manifest for commit %s (its data was imported by a version of src that didn't record provenance; reimport it to record it)", c.CommitID)
+	} else if err != nil {
+		return err
+	}
+
+	switch format {
+	case formatJSON:
+		PrintJSON(p, "  ")
+	case formatTable:
+		printProvenance(p)
+	}
+	return nil
+}
+
+// printProvenance prints the provenance manifest p in a human-readable
+// format.
+func printProvenance(p *store.Provenance) {
+	if p.Repo != "" {
+		fmt.Println("Repo:   ", p.Repo)
+	}
+	fmt.Println("Commit: ", p.CommitID)
+	printProcess := func(label string, pp *store.ProcessProvenance) {
+		if pp == nil {
+			fmt.Printf("%s unknown\n", label)
+			return
+		}
+		fmt.Printf("%s src %s (%s, %s/%s) at %s\n", label, pp.SrcVersion, pp.GoVersion, pp.OS, pp.Arch, pp.Time.Format(time.RFC3339))
+		fmt.Printf("         $ src %s\n", strings.Join(pp.Args, " "))
+	}
+	printProcess("Build:  ", p.Build)
+	printProcess("Import: ", p.Import)
+	if len(p.Toolchains) > 0 {
+		fmt.Println("Toolchains:")
+		for _, tc := range p.Toolchains {
+			fmt.Printf("  %s\n", tc.Path)
+			if tc.Version != "" {
+				fmt.Printf("    version: %s\n", tc.Version)
+			}
+			if tc.Commit != "" {
+				fmt.Printf("    commit:  %s\n", tc.Commit)
+			}
+			if len(tc.Tools) > 0 {
+				fmt.Printf("    tools:   %s\n", strings.Join(tc.Tools, ", "))
+			}
+		}
+	}
+}
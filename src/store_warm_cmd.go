@@ -0,0 +1,69 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"sourcegraph.com/sourcegraph/go-sourcegraph/sourcegraph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+type StoreWarmCmd struct {
+	Args struct {
+		Versions []string `name:"REPO@COMMIT" description:"versions whose indexes to read (COMMIT for a RepoStore)"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var storeWarmCmd StoreWarmCmd
+
+func (c *StoreWarmCmd) Execute(args []string) error {
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+	for _, v := range c.Args.Versions {
+		start := time.Now()
+		n, err := preloadVersion(s, v)
+		if err != nil {
+			return err
+		}
+		log.Printf("# Read %d indexes of %s in %s.", n, v, time.Since(start))
+	}
+	return nil
+}
+
+// preloadVersion reads the indexes of the version (REPO@COMMIT for a
+// MultiRepoStore, and COMMIT for a RepoStore) into memory (see
+// store.RepoPreloader). It returns the number of indexes read.
+func preloadVersion(s interface{}, version string) (int, error) {
+	repo, commitID := sourcegraph.ParseRepoAndCommitID(version)
+	switch s := s.(type) {
+	case store.MultiRepoPreloader:
+		if commitID == "" {
+			return 0, fmt.Errorf("version %q has no commit ID (expected REPO@COMMIT)", version)
+		}
+		return s.Preload(repo, commitID)
+	case store.RepoPreloader:
+		if commitID == "" {
+			commitID = repo // just COMMIT
+		}
+		return s.Preload(commitID)
+	}
+	return 0, fmt.Errorf("store (type %T) does not implement preloading indexes", s)
+}
+
+// unpreloadVersion discards the preloaded indexes of the version (as
+// given to preloadVersion).
+func unpreloadVersion(s interface{}, version string) {
+	repo, commitID := sourcegraph.ParseRepoAndCommitID(version)
+	switch s := s.(type) {
+	case store.MultiRepoPreloader:
+		s.Unpreload(repo, commitID)
+	case store.RepoPreloader:
+		if commitID == "" {
+			commitID = repo
+		}
+		s.Unpreload(commitID)
+	}
+}
@@ -0,0 +1,146 @@
+package src
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/dep"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/terraform"
+	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// TerraformToolchain is the path of the built-in toolchain that graphs
+// Terraform configurations (see package terraform). Resources,
+// variables, outputs, locals, and module calls are defs, and the
+// references between them (and to the variables and outputs of the
+// modules that are called) are refs.
+const TerraformToolchain = "sourcegraph.com/sourcegraph/srclib/terraform"
+
+func init() {
+	grapher.RegisterByteOffsetUnitType(terraform.UnitType)
+	toolchain.RegisterBuiltin(TerraformToolchain, &toolchain.Builtin{
+		Config: &toolchain.Config{
+			Tools: []*toolchain.ToolInfo{
+				{Subcmd: "scan", Op: "scan"},
+				{Subcmd: "depresolve", Op: "depresolve", SourceUnitTypes: []string{terraform.UnitType}},
+				{Subcmd: "graph", Op: "graph", SourceUnitTypes: []string{terraform.UnitType}},
+			},
+		},
+		Tools: map[string]toolchain.BuiltinTool{
+			"scan":       terraformScan,
+			"depresolve": terraformDepresolve,
+			"graph":      terraformGraph,
+		},
+	})
+}
+
+// readTerraformFiles reads the files of a Terraform source unit.
+func readTerraformFiles(files []string) (map[string][]byte, error) {
+	contents := make(map[string][]byte, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		contents[file] = data
+	}
+	return contents, nil
+}
+
+// terraformScan is the Terraform toolchain's scanner. Each directory
+// containing Terraform configuration files is a source unit (a
+// module), named by its path, whose dependencies are the sources of
+// the non-local modules it calls.
+func terraformScan(args []string, stdin io.Reader, stdout io.Writer) error {
+	dir, err := readScanInput(args, stdin)
+	if err != nil {
+		return err
+	}
+	files, err := scanFiles(dir, terraform.IsConfigFile)
+	if err != nil {
+		return err
+	}
+
+	byDir := map[string][]string{}
+	var dirs []string
+	for _, file := range files {
+		d := path.Dir(file)
+		if _, present := byDir[d]; !present {
+			dirs = append(dirs, d)
+		}
+		byDir[d] = append(byDir[d], file)
+	}
+	sort.Strings(dirs)
+
+	units := []*unit.SourceUnit{}
+	for _, d := range dirs {
+		contents, err := readTerraformFiles(byDir[d])
+		if err != nil {
+			return err
+		}
+		sources, err := terraform.ModuleSources(contents)
+		if err != nil {
+			return err
+		}
+		u := &unit.SourceUnit{
+			Name:  d,
+			Type:  terraform.UnitType,
+			Dir:   d,
+			Files: byDir[d],
+		}
+		for _, s := range sources {
+			u.Dependencies = append(u.Dependencies, s)
+		}
+		units = append(units, u)
+	}
+	return json.NewEncoder(stdout).Encode(units)
+}
+
+// terraformDepresolve is the Terraform toolchain's dependency
+// resolver. It resolves each module source to the repository and
+// directory of the module.
+func terraformDepresolve(args []string, stdin io.Reader, stdout io.Writer) error {
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(stdin).Decode(&u); err != nil {
+		return err
+	}
+	res := []*dep.Resolution{}
+	for _, rawDep := range u.Dependencies {
+		r := &dep.Resolution{Raw: rawDep}
+		source, _ := rawDep.(string)
+		if s, err := terraform.ParseSource(source); err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Target = &dep.ResolvedTarget{
+				ToRepoCloneURL:  s.CloneURL,
+				ToUnit:          s.Dir,
+				ToUnitType:      terraform.UnitType,
+				ToVersionString: s.Ref,
+			}
+		}
+		res = append(res, r)
+	}
+	return json.NewEncoder(stdout).Encode(res)
+}
+
+// terraformGraph is the Terraform toolchain's grapher.
+func terraformGraph(args []string, stdin io.Reader, stdout io.Writer) error {
+	var u *unit.SourceUnit
+	if err := json.NewDecoder(stdin).Decode(&u); err != nil {
+		return err
+	}
+	contents, err := readTerraformFiles(u.Files)
+	if err != nil {
+		return err
+	}
+	o, err := terraform.Graph(u.Dir, contents)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(stdout).Encode(o)
+}
@@ -0,0 +1,312 @@
+package src
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/aybabtme/color/brush"
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+)
+
+func init() {
+	_, err := CLI.AddCommand("test-corpus",
+		"run a toolchain on a corpus of real repositories and compare stats against baselines",
+		`The test-corpus command catches silent regressions in toolchains (such as a grapher that stops emitting some refs, or stops resolving them) that the small test cases run by "src test" don't exercise. It clones each repository listed in the corpus config at its pinned commit, runs "src do-all" in it, and compares summary statistics of the resulting build data (the number of source units, defs, and refs, and the fraction of checked refs that were resolved) against the repository's stored baseline. A repository fails if a stat differs from the baseline by more than the configured tolerance.
+
+The corpus config (--config) is a JSON file of the form:
+
+  {
+    "Repos": [
+      {"Name": "mux", "URL": "https://github.com/gorilla/mux", "CommitID": "<commit ID>"}
+    ],
+    "Tolerance": {"Defs": 0.01, "Refs": 0.01, "Coverage": 0.005}
+  }
+
+Defs and Refs tolerances are fractions of the baseline count, and the Coverage tolerance is an absolute difference in the coverage ratio (between 0 and 1). A zero tolerance requires an exact match. Each repo may also have its own "Tolerance", which overrides the corpus-wide one. The number of source units must always match exactly.
+
+Baselines are stored as JSON files named NAME.json in the --baselines directory. Use --update to (re)write the baselines from the current toolchain's output; be sure to check the changes before committing them.
+
+Clones are kept in --work-dir between runs, so only the first run needs to clone each repository.
+`,
+		&testCorpusCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type TestCorpusCmd struct {
+	Config    string   `long:"config" description:"corpus config file" default:"testdata/corpus.json" value-name:"FILE"`
+	Baselines string   `long:"baselines" description:"dir containing baseline stats (NAME.json)" default:"testdata/corpus-baselines" value-name:"DIR"`
+	WorkDir   string   `long:"work-dir" description:"dir to clone repositories into (default: $TMPDIR/srclib-corpus)" value-name:"DIR"`
+	Repos     []string `long:"repo" description:"only test the corpus repo with this name (can be repeated)" value-name:"NAME"`
+	Method    string   `short:"m" long:"method" description:"toolchain execution method" default:"program" value-name:"METHOD"`
+	Update    bool     `long:"update" description:"(re)write baselines from the current output instead of comparing against them"`
+}
+
+var testCorpusCmd TestCorpusCmd
+
+// corpusConfig is the configuration of the repositories tested by
+// `src test-corpus`.
+type corpusConfig struct {
+	Repos     []*corpusRepo
+	Tolerance corpusTolerance
+}
+
+// corpusRepo is a repository in the test corpus.
+type corpusRepo struct {
+	Name     string // name of the baseline file and --repo value
+	URL      string // clone URL
+	CommitID string // pinned commit to build
+
+	// Tolerance, if set, overrides the corpus-wide tolerance.
+	Tolerance *corpusTolerance `json:",omitempty"`
+}
+
+// corpusTolerance is the maximum allowed difference between a
+// corpusStats value and its baseline.
+type corpusTolerance struct {
+	Defs     float64 // fraction of the baseline Defs count
+	Refs     float64 // fraction of the baseline Refs count
+	Coverage float64 // absolute difference in Coverage
+}
+
+// corpusStats are the summary statistics of a repository's build
+// data that are compared against its baseline.
+type corpusStats struct {
+	Units int
+	Defs  int
+	Refs  int
+
+	// Coverage is the fraction of refs to defs in the same repository
+	// that were resolved (1 if there are no such refs).
+	Coverage float64
+}
+
+// diff returns descriptions of each of s's stats that differs from
+// base's by more than the tolerance.
+func (s *corpusStats) diff(base *corpusStats, tol corpusTolerance) []string {
+	var diffs []string
+	if s.Units != base.Units {
+		diffs = append(diffs, fmt.Sprintf("Units: got %d, baseline %d", s.Units, base.Units))
+	}
+	checkCount := func(name string, got, want int, tol float64) {
+		if math.Abs(float64(got-want)) > tol*float64(want) {
+			diffs = append(diffs, fmt.Sprintf("%s: got %d, baseline %d (%+.2f%%, tolerance %.2f%%)", name, got, want, percentChange(got, want), tol*100))
+		}
+	}
+	checkCount("Defs", s.Defs, base.Defs, tol.Defs)
+	checkCount("Refs", s.Refs, base.Refs, tol.Refs)
+	if d := s.Coverage - base.Coverage; math.Abs(d) > tol.Coverage {
+		diffs = append(diffs, fmt.Sprintf("Coverage: got %.4f, baseline %.4f (%+.4f, tolerance %.4f)", s.Coverage, base.Coverage, d, tol.Coverage))
+	}
+	return diffs
+}
+
+func percentChange(got, want int) float64 {
+	if want == 0 {
+		return math.Inf(1)
+	}
+	return 100 * float64(got-want) / float64(want)
+}
+
+func (c *TestCorpusCmd) Execute(args []string) error {
+	var cfg corpusConfig
+	if err := readJSONFile(c.Config, &cfg); err != nil {
+		return fmt.Errorf("reading corpus config: %s", err)
+	}
+
+	repos := cfg.Repos
+	if len(c.Repos) > 0 {
+		byName := make(map[string]*corpusRepo, len(cfg.Repos))
+		for _, r := range cfg.Repos {
+			byName[r.Name] = r
+		}
+		repos = nil
+		for _, name := range c.Repos {
+			r, present := byName[name]
+			if !present {
+				return fmt.Errorf("no repo named %q in corpus config %s", name, c.Config)
+			}
+			repos = append(repos, r)
+		}
+	}
+
+	workDir := c.WorkDir
+	if workDir == "" {
+		workDir = filepath.Join(os.TempDir(), "srclib-corpus")
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return err
+	}
+	if c.Update {
+		if err := os.MkdirAll(c.Baselines, 0755); err != nil {
+			return err
+		}
+	}
+
+	var failed int
+	for _, r := range repos {
+		if r.Name == "" || r.URL == "" || r.CommitID == "" {
+			return fmt.Errorf("corpus repo %+v must have a Name, URL, and CommitID", r)
+		}
+		dir := filepath.Join(workDir, r.Name)
+		stats, err := c.buildCorpusRepo(r, dir)
+		if err != nil {
+			return fmt.Errorf("corpus repo %s: %s", r.Name, err)
+		}
+
+		baselineFile := filepath.Join(c.Baselines, r.Name+".json")
+		if c.Update {
+			if err := writeJSONFile(baselineFile, stats); err != nil {
+				return err
+			}
+			log.Printf("Wrote baseline for %s to %s.", r.Name, baselineFile)
+			continue
+		}
+
+		var base corpusStats
+		if err := readJSONFile(baselineFile, &base); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("no baseline for corpus repo %s (run with --update to create %s)", r.Name, baselineFile)
+			}
+			return err
+		}
+		tol := cfg.Tolerance
+		if r.Tolerance != nil {
+			tol = *r.Tolerance
+		}
+		if diffs := stats.diff(&base, tol); len(diffs) > 0 {
+			failed++
+			fmt.Printf("%s %s\n", brush.Red("FAIL"), r.Name)
+			for _, d := range diffs {
+				fmt.Printf("\t%s\n", d)
+			}
+		} else {
+			fmt.Printf("%s %s\n", brush.Green("PASS"), r.Name)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d corpus repos differ from their baselines", failed, len(repos))
+	}
+	return nil
+}
+
+// buildCorpusRepo checks out r's pinned commit in dir (cloning it if
+// necessary), runs `src do-all` in it, and returns the stats of the
+// resulting build data.
+func (c *TestCorpusCmd) buildCorpusRepo(r *corpusRepo, dir string) (*corpusStats, error) {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := srclib.CheckOnline("cloning " + r.URL); err != nil {
+			return nil, err
+		}
+		if GlobalOpt.Verbose {
+			log.Printf("Cloning %s to %s...", r.URL, dir)
+		}
+		if err := runCorpusCmd("", "git", "clone", "--no-checkout", r.URL, dir); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Fetch only if the pinned commit isn't already in the clone (so
+	// that runs after the first one don't need network access).
+	if err := runCorpusCmd(dir, "git", "cat-file", "-e", r.CommitID+"^{commit}"); err != nil {
+		if err := srclib.CheckOnline("fetching commit " + r.CommitID + " of " + r.URL); err != nil {
+			return nil, err
+		}
+		if err := runCorpusCmd(dir, "git", "fetch", "origin"); err != nil {
+			return nil, err
+		}
+	}
+	if err := runCorpusCmd(dir, "git", "checkout", "--force", "--detach", r.CommitID); err != nil {
+		return nil, err
+	}
+	// Remove build data and other files left over from previous runs.
+	if err := runCorpusCmd(dir, "git", "clean", "-ffdx"); err != nil {
+		return nil, err
+	}
+
+	if GlobalOpt.Verbose {
+		log.Printf("Building %s at %s...", r.Name, r.CommitID)
+	}
+	src, err := srcExecutable()
+	if err != nil {
+		return nil, err
+	}
+	if err := runCorpusCmd(dir, src, "-v", "do-all", "-m", c.Method); err != nil {
+		return nil, err
+	}
+
+	bdfs := rwvfs.OS(filepath.Join(dir, buildstore.BuildDataDirName, r.CommitID))
+	return readCorpusStats(bdfs, graph.MakeURI(r.URL))
+}
+
+// readCorpusStats computes the stats of the build data in bdfs for
+// the repository with the given URI.
+func readCorpusStats(bdfs rwvfs.FileSystem, repoURI string) (*corpusStats, error) {
+	treeConfig, err := config.ReadCached(bdfs)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		stats   corpusStats
+		allDefs []*graph.Def
+		allRefs []*graph.Ref
+	)
+	for _, u := range treeConfig.SourceUnits {
+		var o graph.Output
+		graphFile := plan.SourceUnitDataFilename(&graph.Output{}, u)
+		if err := readJSONFileFS(bdfs, graphFile, &o); err != nil {
+			return nil, fmt.Errorf("%s: %s", graphFile, err)
+		}
+		grapher.PopulateImpliedFields(repoURI, "", u.Type, u.Name, &o)
+		stats.Units++
+		allDefs = append(allDefs, o.Defs...)
+		allRefs = append(allRefs, o.Refs...)
+	}
+	stats.Defs, stats.Refs = len(allDefs), len(allRefs)
+
+	var resolved, checked int
+	for _, cov := range grapher.ComputeFileCoverage(repoURI, allRefs, allDefs) {
+		resolved += cov.ResolvedRefs
+		checked += cov.Refs - cov.UncheckedRefs
+	}
+	stats.Coverage = 1
+	if checked > 0 {
+		stats.Coverage = float64(resolved) / float64(checked)
+	}
+	return &stats, nil
+}
+
+// runCorpusCmd runs a command in dir, including its output in the
+// returned error if it fails.
+func runCorpusCmd(dir, name string, args ...string) error {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	if GlobalOpt.Verbose {
+		w = io.MultiWriter(&buf, os.Stderr)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Stdout, cmd.Stderr = w, w
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("command %v failed: %s\n\nOutput was:\n%s", cmd.Args, err, buf.String())
+	}
+	return nil
+}
@@ -2,7 +2,10 @@ package src
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
@@ -11,6 +14,7 @@ import (
 	"sourcegraph.com/sourcegraph/go-flags"
 
 	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/tracing"
 )
 
 func init() {
@@ -52,25 +56,66 @@ func (c *ToolCmd) Execute(args []string) error {
 		cmder = tc
 	}
 
+	policy, err := c.runPolicy(toolOp(string(c.Args.Toolchain), string(c.Args.Tool)))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Buffer stdin so that it can be sent again if the tool is
+	// retried.
+	var stdinData []byte
+	if policy.Retries > 0 {
+		stdinData, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+
 	// HACK: Buffer stdout to work around
 	// https://github.com/docker/docker/issues/3631. Otherwise, lots
 	// of builds fail. Also, if a lot of data is printed, the return
 	// code is 0, but JSON parsing fails, retry it up to 4 times until
 	// JSON parsing succeeds.
 	for tries := 4; ; tries-- {
-		cmd, err := cmder.Command()
-		if err != nil {
-			log.Fatal(err)
-		}
-		cmd.Args = append(cmd.Args, c.Args.ToolArgs...)
-		cmd.Stderr = os.Stderr
 		var out bytes.Buffer
-		cmd.Stdout = &out
-		cmd.Stdin = os.Stdin
-		if GlobalOpt.Verbose {
-			log.Printf("Running tool: %v", cmd.Args)
-		}
-		if err := cmd.Run(); err != nil {
+		var args []string
+		err := policy.Do(ctx, log.New(os.Stderr, "", log.LstdFlags), func(ctx context.Context) (err error) {
+			ctx, span := tracing.Start(ctx, fmt.Sprintf("tool %s %s", c.Args.Toolchain, c.Args.Tool))
+			defer func() { toolchain.EndToolSpan(span, err) }()
+
+			cmd, err := cmder.Command()
+			if err != nil {
+				return err
+			}
+			cmd.Args = append(cmd.Args, c.Args.ToolArgs...)
+			cmd.Stderr = os.Stderr
+			out.Reset()
+			cmd.Stdout = &out
+			if stdinData != nil {
+				cmd.Stdin = bytes.NewReader(stdinData)
+			} else {
+				cmd.Stdin = os.Stdin
+			}
+			args = cmd.Args
+			if GlobalOpt.Verbose {
+				log.Printf("Running tool: %v", cmd.Args)
+			}
+			err = toolchain.RunCmd(ctx, cmd)
+			toolchain.SetToolSpanResult(span, cmd, int64(out.Len()))
+			if err != nil {
+				if err == ctx.Err() {
+					return err
+				}
+				return &toolchain.RunError{Tool: fmt.Sprintf("%s %s", c.Args.Toolchain, c.Args.Tool), Args: cmd.Args, Err: err}
+			}
+			return nil
+		})
+		toolchain.RecordRun(fmt.Sprintf("%s %s", c.Args.Toolchain, c.Args.Tool), err)
+		writeSubprocessMetrics()
+		if err != nil {
 			log.Fatal(err)
 		}
 
@@ -81,7 +126,7 @@ func (c *ToolCmd) Execute(args []string) error {
 			if len(b) > 2000 {
 				var o interface{}
 				if err := json.Unmarshal(b, &o); err != nil {
-					log.Printf("Suspect JSON output by %v (%d bytes, parse error %q); retrying %d more times. (This is a workaround for https://github.com/docker/docker/issues/3631.)", cmd.Args, len(b), err, tries)
+					log.Printf("Suspect JSON output by %v (%d bytes, parse error %q); retrying %d more times. (This is a workaround for https://github.com/docker/docker/issues/3631.)", args, len(b), err, tries)
 					continue // retry
 				}
 			}
@@ -92,6 +137,28 @@ func (c *ToolCmd) Execute(args []string) error {
 	}
 }
 
+// toolOp returns the operation (e.g., "graph") performed by the named
+// tool in the toolchain, or "" if it can't be determined.
+func toolOp(toolchainPath, subcmd string) string {
+	if subcmd == "" {
+		return ""
+	}
+	tc, err := toolchain.Lookup(toolchainPath)
+	if err != nil || tc == nil {
+		return ""
+	}
+	c, err := tc.ReadConfig()
+	if err != nil {
+		return ""
+	}
+	for _, t := range c.Tools {
+		if t.Subcmd == subcmd {
+			return t.Op
+		}
+	}
+	return ""
+}
+
 type ToolName string
 
 func (t ToolName) Complete(match string) []flags.Completion {
@@ -120,6 +120,23 @@ func (t ToolchainPath) Complete(match string) []flags.Completion {
 
 type ToolchainExecOpt struct {
 	ExeMethods string `short:"m" long:"methods" default:"program,docker" description:"toolchain execution methods" value-name:"METHODS"`
+
+	ToolTimeouts []string `long:"tool-timeout" description:"timeout for each run of a tool, either for all operations (e.g., 30m) or for a single operation (e.g., depresolve=10m); may be repeated" value-name:"[OP=]DURATION"`
+	ToolRetries  int      `long:"tool-retries" description:"number of times to retry a tool run that times out, exits with status 75 (EX_TEMPFAIL), or is killed by a signal (with exponential backoff)" value-name:"N"`
+}
+
+// runPolicy returns the timeout and retry policy for running tools
+// that perform op.
+func (o *ToolchainExecOpt) runPolicy(op string) (toolchain.RunPolicy, error) {
+	timeouts, err := toolchain.ParseOpTimeouts(o.ToolTimeouts)
+	if err != nil {
+		return toolchain.RunPolicy{}, err
+	}
+	timeout, present := timeouts[op]
+	if !present {
+		timeout = timeouts[""]
+	}
+	return toolchain.RunPolicy{Timeout: timeout, Retries: o.ToolRetries}, nil
 }
 
 func (o *ToolchainExecOpt) ToolchainMode() toolchain.Mode {
@@ -310,17 +327,18 @@ func (c *ToolchainTempDirCmd) Execute(args []string) error {
 }
 
 type toolchainInstaller struct {
-	name string
-	fn   func() error
+	name      string
+	toolchain string // toolchain path
+	fn        func() error
 }
 
 type toolchainMap map[string]toolchainInstaller
 
 var stdToolchains = toolchainMap{
-	"go":         toolchainInstaller{"Go (sourcegraph.com/sourcegraph/srclib-go)", installGoToolchain},
-	"python":     toolchainInstaller{"Python (sourcegraph.com/sourcegraph/srclib-python)", installPythonToolchain},
-	"ruby":       toolchainInstaller{"Ruby (sourcegraph.com/sourcegraph/srclib-ruby)", installRubyToolchain},
-	"javascript": toolchainInstaller{"JavaScript (sourcegraph.com/sourcegraph/srclib-javascript)", installJavaScriptToolchain},
+	"go":         toolchainInstaller{"Go (sourcegraph.com/sourcegraph/srclib-go)", "sourcegraph.com/sourcegraph/srclib-go", installGoToolchain},
+	"python":     toolchainInstaller{"Python (sourcegraph.com/sourcegraph/srclib-python)", "sourcegraph.com/sourcegraph/srclib-python", installPythonToolchain},
+	"ruby":       toolchainInstaller{"Ruby (sourcegraph.com/sourcegraph/srclib-ruby)", "sourcegraph.com/sourcegraph/srclib-ruby", installRubyToolchain},
+	"javascript": toolchainInstaller{"JavaScript (sourcegraph.com/sourcegraph/srclib-javascript)", "sourcegraph.com/sourcegraph/srclib-javascript", installJavaScriptToolchain},
 }
 
 func (m toolchainMap) listKeys() string {
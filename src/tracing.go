@@ -0,0 +1,33 @@
+package src
+
+import (
+	"context"
+	"os"
+
+	"sourcegraph.com/sourcegraph/srclib/tracing"
+)
+
+// traceparentEnv is the environment variable that carries the W3C
+// trace context to src subprocesses (such as the `src tool` recipes
+// run by `src make`), so that their spans join the parent's trace.
+const traceparentEnv = "TRACEPARENT"
+
+// initTracing enables recording spans (see package tracing), if src
+// was built with a tracer (see tracing_otel.go). The returned func
+// flushes pending spans and must be called before exiting.
+var initTracing = func() (shutdown func()) { return func() {} }
+
+// withParentTrace returns a copy of ctx that carries the trace
+// context (if any) passed to this process by a parent src process.
+func withParentTrace(ctx context.Context) context.Context {
+	return tracing.WithTraceParent(ctx, os.Getenv(traceparentEnv))
+}
+
+// setTraceEnv sets the traceparent environment variable to ctx's
+// trace context, so that src subprocesses started after this call
+// record their spans as children of ctx's span.
+func setTraceEnv(ctx context.Context) {
+	if tp := tracing.TraceParent(ctx); tp != "" {
+		os.Setenv(traceparentEnv, tp)
+	}
+}
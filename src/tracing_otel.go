@@ -0,0 +1,111 @@
+//go:build otel
+// +build otel
+
+package src
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+	"sourcegraph.com/sourcegraph/srclib/tracing"
+)
+
+// This file is only built with the "otel" build tag, so that src's
+// dependencies don't include OpenTelemetry unless tracing is wanted.
+
+func init() {
+	initTracing = initOTelTracing
+}
+
+// initOTelTracing enables exporting spans via OTLP/HTTP if the
+// OTEL_EXPORTER_OTLP_ENDPOINT (or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT)
+// environment variable is set. The exporter is configured using the
+// standard OTEL_* environment variables. Trace contexts are passed to
+// subprocesses even if spans aren't exported.
+func initOTelTracing() (shutdown func()) {
+	propagator := propagation.TraceContext{}
+	tracing.SetTracer(otelTracer{tracer: otel.Tracer("sourcegraph.com/sourcegraph/srclib"), propagator: propagator})
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func() {}
+	}
+	exp, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		logutil.Default.Warn("Failed to create OpenTelemetry trace exporter; tracing is disabled.", "err", err)
+		return func() {}
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp))
+	otel.SetTracerProvider(tp)
+	return func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			logutil.Default.Warn("Failed to flush OpenTelemetry spans.", "err", err)
+		}
+	}
+}
+
+// otelTracer implements tracing.Tracer with OpenTelemetry.
+type otelTracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+func (t otelTracer) Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, tracing.Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(otelAttributes(attrs)...))
+	return ctx, otelSpan{span}
+}
+
+func (t otelTracer) TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	t.propagator.Inject(ctx, carrier)
+	return carrier["traceparent"]
+}
+
+func (t otelTracer) WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	return t.propagator.Extract(ctx, propagation.MapCarrier{"traceparent": traceparent})
+}
+
+type otelSpan struct{ span trace.Span }
+
+func (s otelSpan) SetAttributes(attrs ...interface{}) {
+	s.span.SetAttributes(otelAttributes(attrs)...)
+}
+
+func (s otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+// otelAttributes converts alternating attribute names and values (see
+// tracing.Tracer) to OpenTelemetry attributes.
+func otelAttributes(attrs []interface{}) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs)/2)
+	for i := 0; i+1 < len(attrs); i += 2 {
+		key := fmt.Sprint(attrs[i])
+		switch v := attrs[i+1].(type) {
+		case string:
+			kvs = append(kvs, attribute.String(key, v))
+		case int:
+			kvs = append(kvs, attribute.Int(key, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(key, v))
+		case []string:
+			kvs = append(kvs, attribute.StringSlice(key, v))
+		default:
+			kvs = append(kvs, attribute.String(key, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,340 @@
+package src
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+type StoreCyclesCmd struct {
+	Repo     string `long:"repo" description:"only check source units in this repo"`
+	CommitID string `long:"commit" description:"only check source units at this commit ID"`
+	MaxRefs  int    `long:"max-refs" description:"max number of refs to list for each dependency in a cycle (0 for all)" default:"5"`
+
+	Format string `long:"format" description:"output format" default:"table" value-name:"json|table|quiet"`
+}
+
+var storeCyclesCmd StoreCyclesCmd
+
+// A unitCycle is a cycle of dependencies among source units: each unit
+// in Units refers to the next one, and the last unit refers to the
+// first.
+type unitCycle struct {
+	Units []unit.Key
+
+	// Deps are the dependencies that create the cycle. Deps[i] is the
+	// dependency of Units[i] on the next unit in the cycle.
+	Deps []*unitDep
+}
+
+// A unitDep is a dependency of one source unit on another, created by
+// the refs in From to defs in To.
+type unitDep struct {
+	From, To unit.Key
+	NumRefs  int
+	Refs     []*graph.Ref // sorted by file and position (and possibly truncated)
+}
+
+func (c *StoreCyclesCmd) Execute(args []string) error {
+	format, err := checkFormat(c.Format)
+	if err != nil {
+		return err
+	}
+	s, err := OpenStore()
+	if err != nil {
+		return err
+	}
+	us, ok := s.(store.UnitStore)
+	if !ok {
+		return fmt.Errorf("store (type %T) does not implement listing refs", s)
+	}
+
+	var filters []store.RefFilter
+	if c.CommitID != "" {
+		filters = append(filters, store.ByCommitIDs(c.CommitID))
+	}
+	if c.Repo != "" {
+		filters = append(filters, store.ByRepos(c.Repo))
+	}
+	refs, err := us.Refs(filters...)
+	if err != nil {
+		return err
+	}
+
+	cycles := findUnitCycles(refs)
+	if c.MaxRefs > 0 {
+		for _, cyc := range cycles {
+			for _, dep := range cyc.Deps {
+				if len(dep.Refs) > c.MaxRefs {
+					dep.Refs = dep.Refs[:c.MaxRefs]
+				}
+			}
+		}
+	}
+
+	switch format {
+	case formatJSON:
+		if cycles == nil {
+			cycles = []*unitCycle{}
+		}
+		PrintJSON(cycles, "")
+	case formatTable:
+		for i, cyc := range cycles {
+			if i > 0 {
+				fmt.Println()
+			}
+			names := make([]string, len(cyc.Units)+1)
+			for j, u := range cyc.Units {
+				names[j] = u.Unit
+			}
+			names[len(cyc.Units)] = cyc.Units[0].Unit
+			fmt.Printf("Cycle of %d units: %s\n", len(cyc.Units), strings.Join(names, " -> "))
+			for _, dep := range cyc.Deps {
+				fmt.Printf("\t%s -> %s (%d refs)\n", dep.From.Unit, dep.To.Unit, dep.NumRefs)
+				for _, ref := range dep.Refs {
+					fmt.Printf("\t\t%s:%d-%d\t%s\n", ref.File, ref.Start, ref.End, ref.DefPath)
+				}
+			}
+		}
+		if len(cycles) == 0 {
+			fmt.Println("No cycles found.")
+		}
+	}
+	if len(cycles) == 0 {
+		return errNoResults
+	}
+	return nil
+}
+
+// findUnitCycles returns the minimal dependency cycles among source
+// units, where a unit depends on another if it contains refs to defs
+// in the other unit (in the same repo and commit). For each unit that
+// is part of a cycle, the shortest cycle through that unit is
+// returned, so a tangle of many units is reported as a few short
+// cycles instead of every possible cycle. Cycles are sorted by length
+// and then by units; each cycle starts with its least unit.
+func findUnitCycles(refs []*graph.Ref) []*unitCycle {
+	deps := map[unit.Key]map[unit.Key]*unitDep{}
+	for _, ref := range refs {
+		if ref.Def {
+			continue
+		}
+		if ref.DefRepo != "" && ref.DefRepo != ref.Repo {
+			continue
+		}
+		if ref.DefUnitType == "" && ref.DefUnit == "" {
+			continue // ref to a def in the same unit
+		}
+		from := unit.Key{Repo: ref.Repo, CommitID: ref.CommitID, UnitType: ref.UnitType, Unit: ref.Unit}
+		to := unit.Key{Repo: ref.Repo, CommitID: ref.CommitID, UnitType: ref.DefUnitType, Unit: ref.DefUnit}
+		if from == to {
+			continue
+		}
+		if deps[from] == nil {
+			deps[from] = map[unit.Key]*unitDep{}
+		}
+		dep, present := deps[from][to]
+		if !present {
+			dep = &unitDep{From: from, To: to}
+			deps[from][to] = dep
+		}
+		dep.NumRefs++
+		dep.Refs = append(dep.Refs, ref)
+	}
+
+	seen := map[string]struct{}{}
+	var cycles []*unitCycle
+	for _, scc := range unitSCCs(deps) {
+		if len(scc) < 2 {
+			continue
+		}
+		inSCC := make(map[unit.Key]struct{}, len(scc))
+		for _, u := range scc {
+			inSCC[u] = struct{}{}
+		}
+		for _, u := range scc {
+			units := shortestUnitCycle(deps, inSCC, u)
+			units = rotateUnitCycle(units)
+			k := fmt.Sprint(units)
+			if _, dup := seen[k]; dup {
+				continue
+			}
+			seen[k] = struct{}{}
+
+			cyc := &unitCycle{Units: units}
+			for i, from := range units {
+				dep := deps[from][units[(i+1)%len(units)]]
+				sort.Sort(refsByFilePosition(dep.Refs))
+				cyc.Deps = append(cyc.Deps, dep)
+			}
+			cycles = append(cycles, cyc)
+		}
+	}
+	sort.Sort(unitCycles(cycles))
+	return cycles
+}
+
+// unitSCCs returns the strongly connected components of the unit
+// dependency graph (using Tarjan's algorithm). The units in each
+// component are sorted.
+func unitSCCs(deps map[unit.Key]map[unit.Key]*unitDep) [][]unit.Key {
+	var (
+		index   = map[unit.Key]int{}
+		lowlink = map[unit.Key]int{}
+		onStack = map[unit.Key]bool{}
+		stack   []unit.Key
+		sccs    [][]unit.Key
+	)
+	var strongConnect func(u unit.Key)
+	strongConnect = func(u unit.Key) {
+		index[u] = len(index)
+		lowlink[u] = index[u]
+		stack = append(stack, u)
+		onStack[u] = true
+
+		for _, v := range sortedUnitDeps(deps[u]) {
+			if _, visited := index[v]; !visited {
+				strongConnect(v)
+				if lowlink[v] < lowlink[u] {
+					lowlink[u] = lowlink[v]
+				}
+			} else if onStack[v] && index[v] < lowlink[u] {
+				lowlink[u] = index[v]
+			}
+		}
+
+		if lowlink[u] == index[u] {
+			var scc []unit.Key
+			for {
+				v := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[v] = false
+				scc = append(scc, v)
+				if v == u {
+					break
+				}
+			}
+			sort.Sort(unitKeys(scc))
+			sccs = append(sccs, scc)
+		}
+	}
+
+	froms := make([]unit.Key, 0, len(deps))
+	for u := range deps {
+		froms = append(froms, u)
+	}
+	sort.Sort(unitKeys(froms))
+	for _, u := range froms {
+		if _, visited := index[u]; !visited {
+			strongConnect(u)
+		}
+	}
+	return sccs
+}
+
+// shortestUnitCycle returns the units on a shortest cycle from start
+// back to itself (beginning with start), only passing through units
+// in inSCC. Because start is in the strongly connected component
+// inSCC, such a cycle exists.
+func shortestUnitCycle(deps map[unit.Key]map[unit.Key]*unitDep, inSCC map[unit.Key]struct{}, start unit.Key) []unit.Key {
+	prev := map[unit.Key]unit.Key{}
+	queue := []unit.Key{start}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, v := range sortedUnitDeps(deps[u]) {
+			if _, ok := inSCC[v]; !ok {
+				continue
+			}
+			if v == start {
+				var units []unit.Key
+				for w := u; w != start; w = prev[w] {
+					units = append(units, w)
+				}
+				units = append(units, start)
+				for i, j := 0, len(units)-1; i < j; i, j = i+1, j-1 {
+					units[i], units[j] = units[j], units[i]
+				}
+				return units
+			}
+			if _, visited := prev[v]; !visited {
+				prev[v] = u
+				queue = append(queue, v)
+			}
+		}
+	}
+	return nil
+}
+
+// rotateUnitCycle rotates units so that the least unit is first.
+func rotateUnitCycle(units []unit.Key) []unit.Key {
+	min := 0
+	for i, u := range units {
+		if unitKeyLess(u, units[min]) {
+			min = i
+		}
+	}
+	return append(append([]unit.Key{}, units[min:]...), units[:min]...)
+}
+
+// sortedUnitDeps returns the units that a unit depends on, sorted (so
+// that the results of findUnitCycles are deterministic).
+func sortedUnitDeps(deps map[unit.Key]*unitDep) []unit.Key {
+	tos := make([]unit.Key, 0, len(deps))
+	for to := range deps {
+		tos = append(tos, to)
+	}
+	sort.Sort(unitKeys(tos))
+	return tos
+}
+
+func unitKeyLess(a, b unit.Key) bool {
+	if a.Repo != b.Repo {
+		return a.Repo < b.Repo
+	}
+	if a.CommitID != b.CommitID {
+		return a.CommitID < b.CommitID
+	}
+	if a.UnitType != b.UnitType {
+		return a.UnitType < b.UnitType
+	}
+	return a.Unit < b.Unit
+}
+
+type unitKeys []unit.Key
+
+func (v unitKeys) Len() int           { return len(v) }
+func (v unitKeys) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v unitKeys) Less(i, j int) bool { return unitKeyLess(v[i], v[j]) }
+
+type unitCycles []*unitCycle
+
+func (v unitCycles) Len() int      { return len(v) }
+func (v unitCycles) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v unitCycles) Less(i, j int) bool {
+	a, b := v[i].Units, v[j].Units
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return unitKeyLess(a[k], b[k])
+		}
+	}
+	return false
+}
+
+type refsByFilePosition []*graph.Ref
+
+func (v refsByFilePosition) Len() int      { return len(v) }
+func (v refsByFilePosition) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v refsByFilePosition) Less(i, j int) bool {
+	if v[i].File != v[j].File {
+		return v[i].File < v[j].File
+	}
+	return v[i].Start < v[j].Start
+}
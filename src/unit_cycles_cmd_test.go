@@ -0,0 +1,73 @@
+package src
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestFindUnitCycles(t *testing.T) {
+	// dep returns a ref from unit "from" to a def in unit "to".
+	dep := func(from, to string) *graph.Ref {
+		return &graph.Ref{Repo: "r", CommitID: "c", UnitType: "t", Unit: from, DefUnitType: "t", DefUnit: to, DefPath: to + "/x", File: from + ".go"}
+	}
+
+	tests := map[string]struct {
+		refs []*graph.Ref
+		want [][]string // the units of each cycle
+	}{
+		"no refs": {},
+		"no cycle": {
+			refs: []*graph.Ref{dep("a", "b"), dep("b", "c"), dep("a", "c")},
+		},
+		"2-cycle": {
+			refs: []*graph.Ref{dep("a", "b"), dep("b", "a")},
+			want: [][]string{{"a", "b"}},
+		},
+		"3-cycle sharing a node with a 2-cycle": {
+			refs: []*graph.Ref{dep("a", "b"), dep("b", "a"), dep("b", "c"), dep("c", "a")},
+			want: [][]string{{"a", "b"}, {"a", "b", "c"}},
+		},
+		"3-cycle starting with its least unit": {
+			refs: []*graph.Ref{dep("c", "a"), dep("b", "c"), dep("a", "b")},
+			want: [][]string{{"a", "b", "c"}},
+		},
+		"self-ref": {
+			refs: []*graph.Ref{dep("a", "a"), {Repo: "r", CommitID: "c", UnitType: "t", Unit: "a", DefPath: "y"}},
+		},
+		"def refs": {
+			refs: []*graph.Ref{dep("a", "b"), func() *graph.Ref { r := dep("b", "a"); r.Def = true; return r }()},
+		},
+		"cross-repo ref": {
+			refs: []*graph.Ref{dep("a", "b"), func() *graph.Ref { r := dep("b", "a"); r.DefRepo = "other"; return r }()},
+		},
+		"different commits": {
+			refs: []*graph.Ref{dep("a", "b"), func() *graph.Ref { r := dep("b", "a"); r.CommitID = "c2"; return r }()},
+		},
+	}
+	for label, test := range tests {
+		cycles := findUnitCycles(test.refs)
+		var got [][]string
+		for _, cyc := range cycles {
+			var units []string
+			for _, u := range cyc.Units {
+				units = append(units, u.Unit)
+			}
+			got = append(got, units)
+
+			if len(cyc.Deps) != len(cyc.Units) {
+				t.Errorf("%s: cycle %v: got %d deps, want %d", label, units, len(cyc.Deps), len(cyc.Units))
+				continue
+			}
+			for i, d := range cyc.Deps {
+				if from, to := cyc.Units[i], cyc.Units[(i+1)%len(cyc.Units)]; d.From != from || d.To != to || d.NumRefs != 1 {
+					t.Errorf("%s: cycle %v: dep %d is %s -> %s (%d refs), want %s -> %s (1 ref)", label, units, i, d.From.Unit, d.To.Unit, d.NumRefs, from.Unit, to.Unit)
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got cycles %v, want %v", label, got, test.want)
+		}
+	}
+}
@@ -1,15 +1,23 @@
 package src
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
+	"sort"
 
 	"strings"
 
+	"sourcegraph.com/sourcegraph/srclib"
 	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/license"
+	"sourcegraph.com/sourcegraph/srclib/plan"
+	"sourcegraph.com/sourcegraph/srclib/region"
 	"sourcegraph.com/sourcegraph/srclib/scan"
 	"sourcegraph.com/sourcegraph/srclib/toolchain"
+	"sourcegraph.com/sourcegraph/srclib/tracing"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
@@ -29,20 +37,42 @@ func init() {
 
 // scanUnitsIntoConfig uses cfg to scan for source units. It modifies
 // cfg.SourceUnits, merging the scanned source units with those already present
-// in cfg.
-func scanUnitsIntoConfig(cfg *config.Repository, configOpt config.Options, execOpt ToolchainExecOpt, quiet bool) error {
+// in cfg. It returns the scanned source units and files that were
+// skipped because they matched the tree's skip patterns.
+func scanUnitsIntoConfig(ctx context.Context, cfg *config.Repository, configOpt config.Options, execOpt ToolchainExecOpt, quiet bool) (skipped *skipReport, err error) {
+	ctx, span := tracing.Start(ctx, "scan")
+	defer func() {
+		span.SetAttributes("units", len(cfg.SourceUnits))
+		span.End(err)
+	}()
+
 	scanners := make([]toolchain.Tool, len(cfg.Scanners))
 	for i, scannerRef := range cfg.Scanners {
 		scanner, err := toolchain.OpenTool(scannerRef.Toolchain, scannerRef.Subcmd, execOpt.ToolchainMode())
 		if err != nil {
-			return err
+			return nil, err
 		}
 		scanners[i] = scanner
 	}
 
-	units, err := scan.ScanMulti(scanners, scan.Options{Options: configOpt, Quiet: quiet}, cfg.Config)
+	priorities := make([]int, len(cfg.Scanners))
+	for i, scannerRef := range cfg.Scanners {
+		for j, p := range cfg.ScannerPriority {
+			if *p == *scannerRef {
+				priorities[i] = len(cfg.ScannerPriority) - j
+				break
+			}
+		}
+	}
+
+	units, conflicts, err := scan.ScanMulti(ctx, scanners, scan.Options{Options: configOpt, Quiet: quiet, Priorities: priorities}, cfg.Config)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !quiet {
+		for _, c := range conflicts {
+			log.Printf("Scanner conflict between %s and %s: %s.", cfg.Scanners[c.WinnerScanner], cfg.Scanners[c.LoserScanner], c)
+		}
 	}
 
 	// Merge the repo/tree config with each source unit's config.
@@ -62,18 +92,34 @@ func scanUnitsIntoConfig(cfg *config.Repository, configOpt config.Options, execO
 		}
 	}
 
-	// collect manually specified source units by ID
+	// collect manually specified source units by ID, and fill in the
+	// fields that scanning would fill in for them
 	manualUnits := make(map[unit.ID]*unit.SourceUnit, len(cfg.SourceUnits))
+	numManual := len(cfg.SourceUnits)
 	for _, u := range cfg.SourceUnits {
 		manualUnits[u.ID()] = u
 
 		xf, err := unit.ExpandPaths(".", u.Files)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		u.Files = xf
+
+		if u.Repo == "" {
+			u.Repo = configOpt.Repo
+		}
+		for k, v := range cfg.Config {
+			if _, present := u.Config[k]; !present {
+				if u.Config == nil {
+					u.Config = map[string]interface{}{}
+				}
+				u.Config[k] = v
+			}
+		}
 	}
 
+	skipPatterns := cfg.EffectiveSkipPatterns()
+	skipped = &skipReport{}
 	for _, u := range units {
 		if mu, present := manualUnits[u.ID()]; present {
 			log.Printf("Found manually specified source unit %q with same ID as scanned source unit. Using manually specified unit, ignoring scanned source unit.", mu.ID())
@@ -102,12 +148,268 @@ func scanUnitsIntoConfig(cfg *config.Repository, configOpt config.Options, execO
 			continue
 		}
 
+		if skipped.skipUnit(u, unitDir, skipPatterns) {
+			continue
+		}
+
 		cfg.SourceUnits = append(cfg.SourceUnits, u)
 	}
 
+	// Manually specified source units take precedence over scanned
+	// source units that claim the same files.
+	var manualConflicts []*scan.Conflict
+	cfg.SourceUnits, manualConflicts = scan.MergeUnits([][]*unit.SourceUnit{cfg.SourceUnits[:numManual], cfg.SourceUnits[numManual:]}, []int{1, 0})
+	if !quiet {
+		for _, c := range manualConflicts {
+			log.Printf("Conflict between manually specified and scanned source units: %s.", c)
+		}
+	}
+
+	// Apply the Srcfile's per-unit Config properties, which take
+	// precedence over those from the tree Config and the scanners.
+	for _, u := range cfg.SourceUnits {
+		config.ApplyUnitConfigs(cfg.UnitConfigs, u)
+	}
+
+	// Apply the symlink policy to source unit files, and record it (and
+	// the post-processors) in each source unit so that later build
+	// steps (which don't read the Srcfile) use them too.
+	for _, u := range cfg.SourceUnits {
+		files, err := cfg.SymlinkPolicy.FilterSymlinks(".", u.Files)
+		if err != nil {
+			return nil, fmt.Errorf("source unit %q: %s", u.ID(), err)
+		}
+		u.Files = files
+		if cfg.SymlinkPolicy != "" {
+			if u.Config == nil {
+				u.Config = map[string]interface{}{}
+			}
+			u.Config[config.SymlinkPolicyConfigKey] = string(cfg.SymlinkPolicy)
+		}
+		if len(cfg.PostProcessors) > 0 {
+			if u.Config == nil {
+				u.Config = map[string]interface{}{}
+			}
+			u.Config[config.PostProcessorsConfigKey] = cfg.PostProcessors
+		}
+		if cfg.ResolveVanityURIs {
+			if u.Config == nil {
+				u.Config = map[string]interface{}{}
+			}
+			u.Config[config.ResolveVanityURIsConfigKey] = true
+		}
+	}
+
+	// Add the virtual sub-units for the code in embedded languages in
+	// the source units' files (see package region). Their graph
+	// output is mapped back to the host files by the "regions"
+	// post-processor, which runs before the tree's post-processors.
+	if len(cfg.EmbeddedLanguages) > 0 {
+		var subs []*unit.SourceUnit
+		for _, u := range cfg.SourceUnits {
+			for _, sub := range region.SubUnits(u, cfg.EmbeddedLanguages, isFile) {
+				sub.Config = map[string]interface{}{
+					config.PostProcessorsConfigKey: append([]string{"regions"}, cfg.PostProcessors...),
+				}
+				if cfg.SymlinkPolicy != "" {
+					sub.Config[config.SymlinkPolicyConfigKey] = string(cfg.SymlinkPolicy)
+				}
+				if cfg.ResolveVanityURIs {
+					sub.Config[config.ResolveVanityURIsConfigKey] = true
+				}
+				config.ApplyUnitConfigs(cfg.UnitConfigs, sub)
+				subs = append(subs, sub)
+			}
+		}
+		cfg.SourceUnits = append(cfg.SourceUnits, subs...)
+	}
+
+	if err := detectUnitLicenses(cfg.SourceUnits); err != nil {
+		return nil, err
+	}
+
+	tools := newUnitTools()
+	if err := validateUnitConfigs(cfg.SourceUnits, tools); err != nil {
+		return nil, err
+	}
+	if err := computeFingerprints(cfg.SourceUnits, tools); err != nil {
+		return nil, err
+	}
+	if !quiet && (len(skipped.Units) > 0 || len(skipped.Files) > 0) {
+		log.Printf("Skipped %d source units and %d files in other source units that match skip patterns (vendored or generated code) or contain the %s pragma. Run `src units --skipped` to list them.", len(skipped.Units), len(skipped.Files), config.IgnoreFilePragma)
+	}
+	return skipped, nil
+}
+
+// computeFingerprints sets the Fingerprint of each source unit (see
+// (*unit.SourceUnit).ComputeFingerprint), using the versions of the
+// tools that will perform each build op on the source unit. The cwd
+// must be the tree root.
+func computeFingerprints(units []*unit.SourceUnit, tools *unitTools) error {
+	for _, u := range units {
+		toolVersions := map[string]string{}
+		for op, tool := range tools.tools(u) {
+			v, err := tools.version(tool.Toolchain)
+			if err != nil {
+				return fmt.Errorf("version of toolchain %s: %s", tool.Toolchain, err)
+			}
+			toolVersions[op] = fmt.Sprintf("%s %s %s", tool.Toolchain, tool.Subcmd, v)
+		}
+
+		fp, err := u.ComputeFingerprint(".", toolVersions)
+		if err != nil {
+			return fmt.Errorf("fingerprint of source unit %q: %s", u.ID(), err)
+		}
+		u.Fingerprint = fp
+	}
+	return nil
+}
+
+// detectUnitLicenses sets the License of each source unit whose
+// scanner didn't set it, from the nearest license file in the unit's
+// dir or its parent dirs (see license.DetectDir). The cwd must be the
+// tree root.
+func detectUnitLicenses(units []*unit.SourceUnit) error {
+	licensesByDir := map[string]string{}
+	var detect func(dir string) (string, error)
+	detect = func(dir string) (string, error) {
+		if id, present := licensesByDir[dir]; present {
+			return id, nil
+		}
+		id, err := license.DetectDir(dir)
+		if err != nil {
+			return "", err
+		}
+		if id == "" && dir != "." {
+			if id, err = detect(filepath.Dir(dir)); err != nil {
+				return "", err
+			}
+		}
+		licensesByDir[dir] = id
+		return id, nil
+	}
+
+	for _, u := range units {
+		if u.License != "" {
+			continue
+		}
+		dir := u.Dir
+		if dir == "" && len(u.Files) > 0 {
+			dir = filepath.Dir(u.Files[0])
+		}
+		dir = filepath.Clean(dir)
+		if filepath.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+			dir = "."
+		}
+		id, err := detect(dir)
+		if err != nil {
+			return fmt.Errorf("license of source unit %q: %s", u.ID(), err)
+		}
+		u.License = id
+	}
+	return nil
+}
+
+// validateUnitConfigs checks each source unit's Config against the
+// UnitConfigSchema of each toolchain that will perform a build op on
+// the source unit.
+func validateUnitConfigs(units []*unit.SourceUnit, tools *unitTools) error {
+	for _, u := range units {
+		for _, tool := range tools.tools(u) {
+			tc, err := tools.config(tool.Toolchain)
+			if err != nil {
+				return fmt.Errorf("config of toolchain %s: %s", tool.Toolchain, err)
+			}
+			if tc == nil {
+				continue
+			}
+			if err := tc.ValidateUnitConfig(u.Config); err != nil {
+				return fmt.Errorf("source unit %q Config is invalid for toolchain %s: %s", u.ID(), tool.Toolchain, err)
+			}
+		}
+	}
 	return nil
 }
 
+// unitTools determines which tools perform the build ops on source
+// units. It caches tool choices and toolchain lookups, which are
+// expensive.
+type unitTools struct {
+	ops      []string
+	chosen   map[unitToolKey]*srclib.ToolRef
+	versions map[string]string            // toolchain path -> version
+	configs  map[string]*toolchain.Config // toolchain path -> config
+}
+
+type unitToolKey struct{ op, unitType string }
+
+func newUnitTools() *unitTools {
+	t := &unitTools{
+		chosen:   map[unitToolKey]*srclib.ToolRef{},
+		versions: map[string]string{},
+		configs:  map[string]*toolchain.Config{},
+	}
+	for op := range plan.RuleMakers {
+		t.ops = append(t.ops, op)
+	}
+	sort.Strings(t.ops)
+	return t
+}
+
+// tools returns a map of op name to the tool that performs the op on
+// u. Ops for which no tool can be chosen are omitted (the plan will
+// report the error).
+func (t *unitTools) tools(u *unit.SourceUnit) map[string]*srclib.ToolRef {
+	tools := make(map[string]*srclib.ToolRef, len(t.ops))
+	for _, op := range t.ops {
+		tool := u.Ops[op]
+		if tool == nil {
+			k := unitToolKey{op, u.Type}
+			if _, present := t.chosen[k]; !present {
+				t.chosen[k], _ = toolchain.ChooseTool(op, u.Type)
+			}
+			if tool = t.chosen[k]; tool == nil {
+				continue
+			}
+		}
+		tools[op] = tool
+	}
+	return tools
+}
+
+func (t *unitTools) version(toolchainPath string) (string, error) {
+	if v, present := t.versions[toolchainPath]; present {
+		return v, nil
+	}
+	v, err := toolchain.LookupVersion(toolchainPath)
+	if err != nil {
+		return "", err
+	}
+	t.versions[toolchainPath] = v
+	return v, nil
+}
+
+// config returns the Srclibtoolchain config of the toolchain at
+// toolchainPath, or nil if toolchains are not used (see
+// SRCLIB_NO_TOOLCHAINS).
+func (t *unitTools) config(toolchainPath string) (*toolchain.Config, error) {
+	if c, present := t.configs[toolchainPath]; present {
+		return c, nil
+	}
+	info, err := toolchain.Lookup(toolchainPath)
+	if err != nil {
+		return nil, err
+	}
+	var c *toolchain.Config
+	if info != nil {
+		if c, err = info.ReadConfig(); err != nil {
+			return nil, err
+		}
+	}
+	t.configs[toolchainPath] = c
+	return c, nil
+}
+
 type UnitsCmd struct {
 	config.Options
 
@@ -117,6 +419,8 @@ type UnitsCmd struct {
 		Output string `short:"o" long:"output" description:"output format" default:"text" value-name:"text|json"`
 	} `group:"output"`
 
+	Skipped bool `long:"skipped" description:"list the source units and files that were skipped because they match skip patterns (vendored or generated code) or contain the srclib:ignore-file pragma, instead of the source units"`
+
 	Args struct {
 		Dir Directory `name:"DIR" default:"." description:"root directory of tree to list units in"`
 	} `positional-args:"yes"`
@@ -130,10 +434,21 @@ func (c *UnitsCmd) Execute(args []string) error {
 		return err
 	}
 
-	if err := scanUnitsIntoConfig(cfg, c.Options, c.ToolchainExecOpt, false); err != nil {
+	ctx, cancel := interruptContext()
+	defer cancel()
+	skipped, err := scanUnitsIntoConfig(ctx, cfg, c.Options, c.ToolchainExecOpt, c.Skipped)
+	if err != nil {
 		return err
 	}
 
+	if c.Skipped {
+		if c.Output.Output == "json" {
+			PrintJSON(skipped, "")
+			return nil
+		}
+		return skipped.print(os.Stdout)
+	}
+
 	if c.Output.Output == "json" {
 		PrintJSON(cfg.SourceUnits, "")
 	} else {
@@ -0,0 +1,28 @@
+package src
+
+import (
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/logutil"
+)
+
+// initURIRules sets the URI rules (see graph.SetURIRules) from the
+// srclib configuration and the Srcfile in the current directory, so
+// that every repository URI that this process computes (the current
+// repository's, and those of refs' DefRepos and resolved
+// dependencies' ToRepos) is rewritten in the same way. The build
+// steps that `src make` runs are run in the repository's top-level
+// directory, so they read the same Srcfile.
+//
+// Invalid rules are logged and ignored, since they shouldn't prevent
+// running commands that don't use URIs.
+func initURIRules() {
+	rules, err := config.URIRules(".")
+	if err != nil {
+		logutil.Default.Warn("Unable to read URI rules; continuing without them.", "err", err)
+		return
+	}
+	if err := graph.SetURIRules(rules); err != nil {
+		logutil.Default.Warn("Invalid URI rules; continuing without them.", "err", err)
+	}
+}
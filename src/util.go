@@ -10,7 +10,9 @@ import (
 	"net/http/httputil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"golang.org/x/tools/godoc/vfs"
 
@@ -66,6 +68,17 @@ func execCmd(prog string, arg ...string) error {
 	return nil
 }
 
+// srcExecutable returns the absolute path of the running src
+// program, for running src subcommands in other dirs (where a relative
+// os.Args[0] would name another program, or none).
+func srcExecutable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(exe)
+}
+
 func SourceUnitMatchesArgs(specified []string, u *unit.SourceUnit) bool {
 	var match bool
 	if len(specified) == 0 {
@@ -90,6 +103,38 @@ func PrintJSON(v interface{}, prefix string) {
 	fmt.Println(string(data))
 }
 
+// A jsonLineWriter writes values as newline-delimited JSON (one
+// compact JSON value per line), so that the --stream output of a query
+// can be read (e.g., by jq) as it is written. It is safe for
+// concurrent use. After a write fails, it discards later values.
+type jsonLineWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	n   int   // the number of values written
+	err error // the first write error
+}
+
+func newJSONLineWriter(w io.Writer) *jsonLineWriter {
+	return &jsonLineWriter{enc: json.NewEncoder(w)}
+}
+
+func (w *jsonLineWriter) write(v interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		if w.err = w.enc.Encode(v); w.err == nil {
+			w.n++
+		}
+	}
+}
+
+// Err returns the first error that occurred while writing.
+func (w *jsonLineWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
 func OpenInputFiles(extraArgs []string) map[string]io.ReadCloser {
 	inputs := make(map[string]io.ReadCloser)
 	if len(extraArgs) == 0 {
@@ -121,6 +166,18 @@ func readJSONFile(file string, v interface{}) error {
 	return json.NewDecoder(f).Decode(v)
 }
 
+func writeJSONFile(file string, v interface{}) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(v); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
 func readJSONFileFS(fs vfs.FileSystem, file string, v interface{}) (err error) {
 	f, err := fs.Open(file)
 	if err != nil {
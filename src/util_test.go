@@ -0,0 +1,64 @@
+package src
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// failingWriter fails every write after the first n writes.
+type failingWriter struct {
+	bytes.Buffer
+	n int
+}
+
+var errWrite = errors.New("write failed")
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errWrite
+	}
+	w.n--
+	return w.Buffer.Write(p)
+}
+
+func TestJSONLineWriter(t *testing.T) {
+	tests := map[string]struct {
+		writes  int // number of writes that succeed (-1 for all)
+		wantOut string
+		wantN   int
+		wantErr error
+	}{
+		"ok": {
+			writes:  -1,
+			wantOut: "{\"A\":1}\n\"x\"\n[1,2]\n",
+			wantN:   3,
+		},
+		"fails mid-stream": {
+			writes:  1,
+			wantOut: "{\"A\":1}\n",
+			wantN:   1,
+			wantErr: errWrite,
+		},
+		"fails at start": {
+			writes:  0,
+			wantErr: errWrite,
+		},
+	}
+	for label, test := range tests {
+		out := &failingWriter{n: test.writes}
+		w := newJSONLineWriter(out)
+		for _, v := range []interface{}{struct{ A int }{1}, "x", []int{1, 2}} {
+			w.write(v)
+		}
+		if got := out.String(); got != test.wantOut {
+			t.Errorf("%s: got output %q, want %q", label, got, test.wantOut)
+		}
+		if w.n != test.wantN {
+			t.Errorf("%s: got %d values written, want %d", label, w.n, test.wantN)
+		}
+		if err := w.Err(); err != test.wantErr {
+			t.Errorf("%s: got error %v, want %v", label, err, test.wantErr)
+		}
+	}
+}
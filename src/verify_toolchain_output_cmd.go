@@ -0,0 +1,117 @@
+package src
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"sourcegraph.com/sourcegraph/srclib/grapher"
+)
+
+func init() {
+	_, err := CLI.AddCommand("verify-toolchain-output",
+		"validate a grapher's output file",
+		`The verify-toolchain-output command checks graph output JSON files (as written by a toolchain's "graph" subcommand) for the problems that would cause srclib to reject the output or import incorrect data, and exits with an error (listing each problem with its line and column in the file) if there are any. It is intended to be run in toolchains' CI, and it doesn't need a repository, build data, or installed toolchains.
+
+The checks are:
+
+* The file is a JSON object with only Defs, Refs, Docs, Anns, and Warnings fields, whose elements have no unknown fields or values of the wrong type
+
+* Defs have nonempty paths that are unique in the file, and valid monikers
+
+* Defs' ParentPaths (if any) are the paths of other defs in the file, with no cycles
+
+* Defs' AliasPaths (if any) that are in the same source unit are the paths of other defs in the file, with no cycles
+
+* Offsets aren't reversed and (unless --no-check-files) are within the bounds of their files, which are relative to --dir
+
+* Defs, refs, docs, and anns are sorted (as srclib sorts them)
+
+* Refs and docs for defs in the same source unit (with no DefRepo, DefUnitType, or DefUnit) refer to defs in the file
+
+* Refs' Confidences (if any) are between 0 and 1
+
+* Warnings have messages and valid severities ("info", "warning", or "error")
+
+Offsets are byte offsets, or character offsets if the grapher for --unit-type emits character offsets (or --char-offsets is given).
+
+With --format table (the default), problems are printed as FILE:LINE:COL lines; with --format json, as a JSON array; with --format github, as GitHub Actions error annotations; and with --format quiet, not at all. The command exits with an error if there are any problems.`,
+		&verifyToolchainOutputCmd,
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type VerifyToolchainOutputCmd struct {
+	Dir          string `long:"dir" description:"dir that the output's file paths are relative to (the repository root)" default:"." value-name:"DIR"`
+	NoCheckFiles bool   `long:"no-check-files" description:"don't check offsets against the sizes of the output's files"`
+	UnitType     string `long:"unit-type" description:"source unit type of the output (to determine whether offsets are byte or character offsets)"`
+	CharOffsets  bool   `long:"char-offsets" description:"offsets are character offsets (not byte offsets)"`
+
+	Format string `long:"format" description:"output format" default:"table" value-name:"json|table|github|quiet"`
+
+	Args struct {
+		Files []string `name:"FILE" description:"graph output JSON file"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var verifyToolchainOutputCmd VerifyToolchainOutputCmd
+
+// A verifyIssue is a problem in a graph output file.
+type verifyIssue struct {
+	File string
+	*grapher.OutputIssue
+}
+
+func (c *VerifyToolchainOutputCmd) Execute(args []string) error {
+	format, err := checkCIFormat(c.Format)
+	if err != nil {
+		return err
+	}
+
+	opt := grapher.VerifyOptions{CharOffsets: c.CharOffsets}
+	if c.UnitType != "" && !grapher.EmitsByteOffsets(c.UnitType) {
+		opt.CharOffsets = true
+	}
+	if !c.NoCheckFiles {
+		opt.Dir = c.Dir
+	}
+
+	issues := []*verifyIssue{}
+	for _, file := range c.Args.Files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		fileIssues, err := grapher.VerifyOutput(data, opt)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+		for _, issue := range fileIssues {
+			issues = append(issues, &verifyIssue{File: file, OutputIssue: issue})
+		}
+	}
+
+	switch format {
+	case formatJSON:
+		PrintJSON(issues, "")
+	case formatTable:
+		for _, issue := range issues {
+			fmt.Printf("%s:%s\n", issue.File, issue)
+		}
+	case formatGitHub:
+		for _, issue := range issues {
+			msg := issue.Message
+			if issue.Path != "" {
+				msg = issue.Path + ": " + msg
+			}
+			fmt.Printf("::error file=%s,line=%d,col=%d::%s\n", issue.File, issue.Line, issue.Column, msg)
+		}
+	}
+
+	if len(issues) > 0 {
+		return fmt.Errorf("%d problems in graph output", len(issues))
+	}
+	return nil
+}
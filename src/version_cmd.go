@@ -5,6 +5,8 @@ import (
 	"log"
 
 	"github.com/inconshreveable/go-update/check"
+
+	"sourcegraph.com/sourcegraph/srclib"
 )
 
 // Version of src.
@@ -42,7 +44,7 @@ func (c *VersionCmd) Execute(args []string) error {
 	fmt.Printf("srclib %s\n", Version)
 
 	// Only check for an update if we're running a released version.
-	if Version != develVersion && !c.NoCheck {
+	if Version != develVersion && !c.NoCheck && !srclib.Offline {
 		r, err := checkForUpdate()
 		if err == check.NoUpdateAvailable {
 			log.Println("\nYou are on the latest version of src.")
@@ -0,0 +1,80 @@
+package src
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"sourcegraph.com/sourcegraph/makex"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+// openWarnings returns the warnings of the commit (and, for
+// multi-repo stores, repo) from stor.
+func openWarnings(stor interface{}, repo, commitID string) ([]*graph.Warning, error) {
+	switch s := stor.(type) {
+	case store.RepoWarner:
+		return s.Warnings(commitID)
+	case store.MultiRepoWarner:
+		return s.Warnings(repo, commitID)
+	}
+	return nil, fmt.Errorf("store (type %T) does not implement warnings", stor)
+}
+
+// makefileWarnings returns the warnings in the graph output of the
+// source units in mf that have been built.
+func makefileWarnings(mf *makex.Makefile) ([]*graph.Warning, error) {
+	var warnings []*graph.Warning
+	for _, rule := range mf.Rules {
+		rule, ok := rule.(*grapher.GraphUnitRule)
+		if !ok {
+			continue
+		}
+		data, err := ioutil.ReadFile(rule.Target())
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		ws, err := graph.DecodeOutputWarnings(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", rule.Target(), err)
+		}
+		for _, w := range ws {
+			w.UnitType, w.Unit = rule.Unit.Type, rule.Unit.Name
+		}
+		warnings = append(warnings, ws...)
+	}
+	sort.Sort(graph.Warnings(warnings))
+	return warnings, nil
+}
+
+// printWarnings writes a summary of warnings to w: the number of each
+// severity, and each warning (except SeverityInfo warnings, unless
+// verbose).
+func printWarnings(w io.Writer, warnings []*graph.Warning, verbose bool) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+	counts := map[string]int{}
+	for _, wa := range warnings {
+		counts[wa.Severity]++
+	}
+	fmt.Fprintf(w, "# Graph output has %d warnings (%d errors, %d warnings, %d info).\n", len(warnings), counts[graph.SeverityError], counts[graph.SeverityWarning], counts[graph.SeverityInfo])
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, wa := range warnings {
+		if wa.Severity == graph.SeverityInfo && !verbose {
+			continue
+		}
+		file := wa.File
+		if file == "" {
+			file = "-"
+		}
+		fmt.Fprintf(tw, "  %s\t%s %s\t%s\t%s\t%s\n", wa.Severity, wa.UnitType, wa.Unit, file, wa.Phase, wa.Message)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,199 @@
+package src
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"sourcegraph.com/sourcegraph/srclib/buildstore"
+	"sourcegraph.com/sourcegraph/srclib/config"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/importer"
+	"sourcegraph.com/sourcegraph/srclib/store"
+)
+
+// A workspaceRepo is a repository in a workspace (see
+// config.Workspace), with its URI and commit resolved.
+type workspaceRepo struct {
+	*config.WorkspaceRepo
+	uri      string
+	aliases  []string // normalized Aliases
+	commitID string
+	rootDir  string
+}
+
+// openWorkspaceRepos resolves the URIs (and aliases) and commits of
+// the repositories in w. Each repository must have a URI, and no two
+// repositories (or aliases) may have the same URI.
+func openWorkspaceRepos(w *config.Workspace) ([]*workspaceRepo, error) {
+	repos := make([]*workspaceRepo, 0, len(w.Repos))
+	uris := map[string]string{} // URI (or alias) -> dir
+	for _, r := range w.Repos {
+		lrepo, err := OpenRepo(r.Dir)
+		if err != nil {
+			return nil, err
+		}
+		if lrepo.VCSType == "" {
+			return nil, fmt.Errorf("workspace repo %s is not a git or hg checkout", r.Dir)
+		}
+		uri := r.URI
+		if uri == "" {
+			uri = lrepo.URI()
+		}
+		if uri == "" {
+			return nil, fmt.Errorf("workspace repo %s has no URI (set its URI in the workspace file, or add a git remote)", r.Dir)
+		}
+		if uri, err = graph.TryMakeURI(uri); err != nil {
+			return nil, fmt.Errorf("workspace repo %s: %s", r.Dir, err)
+		}
+		aliases := make([]string, len(r.Aliases))
+		for i, alias := range r.Aliases {
+			if aliases[i], err = graph.TryMakeURI(alias); err != nil {
+				return nil, fmt.Errorf("workspace repo %s: alias %q: %s", r.Dir, alias, err)
+			}
+		}
+		for _, u := range append([]string{uri}, aliases...) {
+			if dir, dup := uris[u]; dup {
+				return nil, fmt.Errorf("workspace repos %s and %s have the same URI %q", dir, r.Dir, u)
+			}
+			uris[u] = r.Dir
+		}
+		repos = append(repos, &workspaceRepo{WorkspaceRepo: r, uri: uri, aliases: aliases, commitID: lrepo.CommitID, rootDir: lrepo.RootDir})
+	}
+	return repos, nil
+}
+
+// workspaceDefRepos returns the map from the aliases of repos to their
+// URIs (see importer.Options.DefRepos).
+func workspaceDefRepos(repos []*workspaceRepo) map[string]string {
+	defRepos := map[string]string{}
+	for _, r := range repos {
+		for _, alias := range r.aliases {
+			defRepos[alias] = r.uri
+		}
+	}
+	return defRepos
+}
+
+// makeWorkspace configures and builds each repository in the
+// workspace file c.Workspace, and imports their build data into the
+// workspace's multi-repository store.
+func (c *MakeCmd) makeWorkspace() error {
+	if len(c.Args.Goals) > 0 {
+		return fmt.Errorf("GOALS may not be specified with --workspace (all of each repository's targets are built)")
+	}
+	w, err := config.ReadWorkspace(c.Workspace)
+	if err != nil {
+		return err
+	}
+	repos, err := openWorkspaceRepos(w)
+	if err != nil {
+		return err
+	}
+	defRepos := workspaceDefRepos(repos)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	defer os.Chdir(wd)
+	for _, r := range repos {
+		if !c.Quiet {
+			log.Printf("# Building %s (commit %s) in %s", r.uri, r.commitID, r.Dir)
+		}
+		if err := os.Chdir(r.Dir); err != nil {
+			return err
+		}
+		configCmd := &ConfigCmd{
+			Options:          config.Options{Repo: r.uri},
+			ToolchainExecOpt: c.ToolchainExecOpt,
+			BuildCacheOpt:    c.BuildCacheOpt,
+			Quiet:            c.Quiet,
+		}
+		configCmd.Args.Dir = "."
+		if err := configCmd.Execute(nil); err != nil {
+			return fmt.Errorf("%s: %s", r.uri, err)
+		}
+		makeCmd := &MakeCmd{
+			Options:          config.Options{Repo: r.uri},
+			ToolchainExecOpt: c.ToolchainExecOpt,
+			BuildCacheOpt:    c.BuildCacheOpt,
+			Quiet:            c.Quiet,
+			DryRun:           c.DryRun,
+		}
+		if err := makeCmd.Execute(nil); err != nil {
+			return fmt.Errorf("%s: %s", r.uri, err)
+		}
+	}
+	if c.DryRun {
+		return nil
+	}
+
+	stor, err := (&StoreCmd{Type: "MultiRepoStore", Root: w.Store}).store()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := interruptContext()
+	defer cancel()
+	for _, r := range repos {
+		localStore, err := buildstore.LocalRepo(r.rootDir)
+		if err != nil {
+			return err
+		}
+		if !c.Quiet {
+			log.Printf("# Importing %s (commit %s) into %s", r.uri, r.commitID, w.Store)
+		}
+		opt := importer.Options{Repo: r.uri, CommitID: r.commitID, DefRepos: defRepos}
+		if err := importBuildData(ctx, localStore.Commit(r.commitID), stor, opt); err != nil {
+			return fmt.Errorf("%s: %s", r.uri, err)
+		}
+	}
+
+	if !c.Quiet {
+		n, unresolved, err := checkWorkspaceRefs(stor.(store.RepoStore), repos)
+		if err != nil {
+			return err
+		}
+		log.Printf("# Workspace has %d refs between its repos (%d to nonexistent defs).", n, unresolved)
+	}
+	return nil
+}
+
+// checkWorkspaceRefs returns the number of refs in the store from each
+// repo to defs in the other repos, and the number of those refs whose
+// defs don't exist (at the other repo's workspace commit).
+func checkWorkspaceRefs(s store.RepoStore, repos []*workspaceRepo) (n, unresolved int, err error) {
+	commitIDs := make(map[string]string, len(repos))
+	for _, r := range repos {
+		commitIDs[r.uri] = r.commitID
+	}
+	exists := map[graph.DefKey]bool{}
+	for _, r := range repos {
+		refs, err := s.Refs(store.ByRepoCommitIDs(store.Version{Repo: r.uri, CommitID: r.commitID}))
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, ref := range refs {
+			defCommitID, ok := commitIDs[ref.DefRepo]
+			if !ok || ref.DefRepo == r.uri {
+				continue
+			}
+			n++
+			key := ref.DefKey()
+			key.CommitID = defCommitID
+			found, checked := exists[key]
+			if !checked {
+				defs, err := s.Defs(store.ByDefKey(key))
+				if err != nil {
+					return 0, 0, err
+				}
+				found = len(defs) > 0
+				exists[key] = found
+			}
+			if !found {
+				unresolved++
+			}
+		}
+	}
+	return n, unresolved, nil
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// maxAliasDepth is the max number of aliases that ResolveAliases
+// follows from a def (so that it stops at cycles of aliases).
+const maxAliasDepth = 10
+
+// AliasDefs returns the defs in s that are aliases (see
+// graph.Def.AliasOf) of the def identified by def, directly or through
+// other aliases. For example, the def of a name that a Python module
+// re-exports with "from x import y" is an alias of y's def in x. If
+// def's DefRepo, DefUnitType, or DefUnit are empty, they match any
+// value.
+//
+// Aliases aren't indexed, so AliasDefs reads all defs in s.
+func AliasDefs(s UnitStore, def graph.RefDefKey) ([]*graph.Def, error) {
+	candidates, err := s.Defs(DefFilterFunc(func(d *graph.Def) bool { return d.AliasPath != "" }))
+	if err != nil {
+		return nil, err
+	}
+
+	// Each round adds the aliases of the defs added in the previous
+	// round, until there are no more.
+	targets := []graph.RefDefKey{def}
+	selected := make([]bool, len(candidates))
+	for i, d := range candidates {
+		// A def in a cycle of aliases isn't an alias of itself.
+		selected[i] = aliasMatches(def, d.DefKey)
+	}
+	var aliases []*graph.Def
+	for len(targets) > 0 {
+		var next []graph.RefDefKey
+		for i, d := range candidates {
+			if selected[i] {
+				continue
+			}
+			key, _ := d.AliasOf()
+			for _, t := range targets {
+				if aliasMatches(t, key) {
+					selected[i] = true
+					aliases = append(aliases, d)
+					next = append(next, graph.RefDefKey{DefRepo: d.Repo, DefUnitType: d.UnitType, DefUnit: d.Unit, DefPath: d.Path})
+					break
+				}
+			}
+		}
+		targets = next
+	}
+	return aliases, nil
+}
+
+// aliasMatches reports whether the key of an alias's original def is
+// the def identified by def (whose empty fields match any value).
+func aliasMatches(def graph.RefDefKey, key graph.DefKey) bool {
+	return key.Path == def.DefPath &&
+		(def.DefRepo == "" || key.Repo == def.DefRepo) &&
+		(def.DefUnitType == "" || key.UnitType == def.DefUnitType) &&
+		(def.DefUnit == "" || key.Unit == def.DefUnit)
+}
+
+// ResolveAliases returns defs with each alias (see graph.Def.AliasOf)
+// replaced by the def in s that it is an alias of, following chains of
+// aliases. Aliases whose original defs aren't in s (such as those of
+// defs in dependencies that aren't indexed) are resolved as far as
+// possible. Duplicates (such as a def and its alias) are removed. An
+// alias of a def in another repository resolves to the def in any of
+// that repository's indexed commits.
+//
+// Aliases only resolve to defs that fs select (e.g., to limit them to
+// the repositories that a client may read).
+func ResolveAliases(s UnitStore, defs []*graph.Def, fs ...DefFilter) ([]*graph.Def, error) {
+	type defKey struct{ repo, commitID, unitType, unit, path string }
+	seen := make(map[defKey]struct{}, len(defs))
+	resolved := make([]*graph.Def, 0, len(defs))
+	for _, def := range defs {
+		for i := 0; i < maxAliasDepth; i++ {
+			key, ok := def.AliasOf()
+			if !ok {
+				break
+			}
+			orig, err := lookupAliasOf(s, key, fs)
+			if err != nil {
+				return nil, err
+			}
+			if orig == nil {
+				break
+			}
+			def = orig
+		}
+		k := defKey{def.Repo, def.CommitID, def.UnitType, def.Unit, def.Path}
+		if _, dup := seen[k]; !dup {
+			seen[k] = struct{}{}
+			resolved = append(resolved, def)
+		}
+	}
+	return resolved, nil
+}
+
+// lookupAliasOf returns the def in s with the given key (whose empty
+// Repo and CommitID fields match any value) that fs select, or nil if
+// there is none.
+func lookupAliasOf(s UnitStore, key graph.DefKey, fs []DefFilter) (*graph.Def, error) {
+	fs = append(fs[:len(fs):len(fs)], ByDefPath(key.Path))
+	if key.UnitType != "" && key.Unit != "" {
+		fs = append(fs, ByUnits(unit.ID2{Type: key.UnitType, Name: key.Unit}))
+	}
+	if key.Repo != "" {
+		fs = append(fs, ByRepos(key.Repo))
+	}
+	if key.CommitID != "" {
+		fs = append(fs, ByCommitIDs(key.CommitID))
+	}
+	defs, err := s.Defs(fs...)
+	if err != nil || len(defs) == 0 {
+		return nil, err
+	}
+	return defs[0], nil
+}
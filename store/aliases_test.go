@@ -0,0 +1,75 @@
+package store
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestAliases(t *testing.T) {
+	s := newMemoryMultiRepoStore()
+	imports := []struct {
+		repo string
+		unit *unit.SourceUnit
+		defs []*graph.Def
+	}{
+		{"r1", &unit.SourceUnit{Type: "PipPackage", Name: "x"}, []*graph.Def{
+			{DefKey: graph.DefKey{Path: "x/y"}},
+			{DefKey: graph.DefKey{Path: "x/z"}, AliasPath: "x/y"},
+			{DefKey: graph.DefKey{Path: "x/c1"}, AliasPath: "x/c2"},
+			{DefKey: graph.DefKey{Path: "x/c2"}, AliasPath: "x/c1"},
+		}},
+		{"r1", &unit.SourceUnit{Type: "PipPackage", Name: "w"}, []*graph.Def{
+			{DefKey: graph.DefKey{Path: "w/y"}, AliasUnitType: "PipPackage", AliasUnit: "x", AliasPath: "x/z"},
+		}},
+		{"r2", &unit.SourceUnit{Type: "PipPackage", Name: "v"}, []*graph.Def{
+			{DefKey: graph.DefKey{Path: "v/y"}, AliasRepo: "r1", AliasUnitType: "PipPackage", AliasUnit: "x", AliasPath: "x/y"},
+			{DefKey: graph.DefKey{Path: "v/dep"}, AliasRepo: "r3", AliasUnitType: "PipPackage", AliasUnit: "d", AliasPath: "d/f"},
+		}},
+	}
+	for _, imp := range imports {
+		if err := s.Import(imp.repo, "c", imp.unit, graph.Output{Defs: imp.defs}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := func(defs []*graph.Def) []string {
+		var ks []string
+		for _, d := range defs {
+			ks = append(ks, d.Repo+" "+d.Unit+" "+d.Path)
+		}
+		sort.Strings(ks)
+		return ks
+	}
+
+	aliases, err := AliasDefs(s, graph.RefDefKey{DefRepo: "r1", DefUnitType: "PipPackage", DefUnit: "x", DefPath: "x/y"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(aliases), []string{"r1 w w/y", "r1 x x/z", "r2 v v/y"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got aliases %v, want %v", got, want)
+	}
+	aliases, err = AliasDefs(s, graph.RefDefKey{DefPath: "x/c1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := keys(aliases), []string{"r1 x x/c2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got aliases in cycle %v, want %v", got, want)
+	}
+
+	defs, err := s.Defs(ByUnits(unit.ID2{Type: "PipPackage", Name: "w"}, unit.ID2{Type: "PipPackage", Name: "v"}, unit.ID2{Type: "PipPackage", Name: "x"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := ResolveAliases(s, defs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// x/c1 and x/c2 are a cycle, so each resolves to one of them. The
+	// alias of a def in r3 (which isn't in the store) isn't resolved.
+	if got, want := keys(resolved), []string{"r1 x x/c1", "r1 x x/c2", "r1 x x/y", "r2 v v/dep"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got resolved defs %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,192 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// A Backend opens stores that are implemented outside of this package
+// (such as stores in DynamoDB or FoundationDB), so that programs can
+// use them without forking srclib. A backend is selected by the scheme
+// of a store URL (e.g., "dynamodb://table"; see OpenURL), and is
+// usually registered (see RegisterBackend) in the init func of the
+// package that implements it, which programs import for its side
+// effect:
+//
+//	import _ "example.com/srclib-dynamodb"
+type Backend interface {
+	// Capabilities returns what the backend's stores support. OpenURL
+	// checks that the stores implement the corresponding interfaces.
+	Capabilities() Capabilities
+
+	// Open opens the store at u (whose scheme is the backend's).
+	Open(u *url.URL, opt BackendOptions) (interface{}, error)
+}
+
+// BackendOptions configures how a Backend opens a store.
+type BackendOptions struct {
+	// ReadOnly opens the store for querying only (as "src store
+	// --read-only" does).
+	ReadOnly bool
+
+	// Config is backend-specific configuration (e.g., JSON; as in
+	// "src store --config"), or nil.
+	Config []byte
+}
+
+// Capabilities is a set of capability flags of a Backend's stores.
+type Capabilities uint
+
+const (
+	// CapQuery stores implement RepoStore.
+	CapQuery Capabilities = 1 << iota
+
+	// CapMultiRepo stores hold many repositories: they implement
+	// MultiRepoStore (with CapQuery) and the MultiRepo variants of
+	// the interfaces of their other capabilities.
+	CapMultiRepo
+
+	// CapImport stores implement RepoImporter (or MultiRepoImporter).
+	CapImport
+
+	// CapIndex stores implement RepoIndexer (or MultiRepoIndexer).
+	CapIndex
+
+	// CapStaging stores implement RepoStager (or MultiRepoStager), so
+	// that queries never see partially imported commits.
+	CapStaging
+)
+
+var capabilityNames = []struct {
+	c    Capabilities
+	name string
+}{
+	{CapQuery, "query"},
+	{CapMultiRepo, "multi-repo"},
+	{CapImport, "import"},
+	{CapIndex, "index"},
+	{CapStaging, "staging"},
+}
+
+// Has returns whether c has all of the capabilities in want.
+func (c Capabilities) Has(want Capabilities) bool { return c&want == want }
+
+func (c Capabilities) String() string {
+	var names []string
+	for _, n := range capabilityNames {
+		if c.Has(n.c) {
+			names = append(names, n.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ",")
+}
+
+// backends holds the registered backends, keyed by URL scheme.
+var backends = map[string]Backend{}
+
+// RegisterBackend makes a backend available for store URLs with the
+// given scheme. It is meant to be called from init funcs (it isn't
+// safe to call concurrently with OpenURL). If RegisterBackend is
+// called twice with the same scheme, if scheme is empty, or if b is
+// nil, it panics.
+func RegisterBackend(scheme string, b Backend) {
+	if scheme == "" {
+		panic("store: RegisterBackend scheme is empty")
+	}
+	if _, dup := backends[scheme]; dup {
+		panic("store: RegisterBackend called twice for scheme " + scheme)
+	}
+	if b == nil {
+		panic("store: RegisterBackend backend is nil")
+	}
+	backends[scheme] = b
+}
+
+// Backends returns the URL schemes of the registered backends, sorted.
+func Backends() []string {
+	schemes := make([]string, 0, len(backends))
+	for scheme := range backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// LookupBackend returns the backend registered for the scheme of the
+// store URL rawurl, or nil if rawurl isn't a URL or no backend is
+// registered for its scheme.
+func LookupBackend(rawurl string) Backend {
+	i := strings.Index(rawurl, "://")
+	if i <= 0 {
+		return nil
+	}
+	return backends[rawurl[:i]]
+}
+
+// ErrNoBackend is returned by OpenURL when no backend is registered
+// for the store URL's scheme.
+var ErrNoBackend = errors.New("no store backend is registered for the URL scheme")
+
+// OpenURL opens the store at rawurl with the backend registered for
+// its scheme, and returns it with the backend's capabilities. It
+// returns an error if the store doesn't implement the interfaces of
+// the backend's capabilities.
+func OpenURL(rawurl string, opt BackendOptions) (interface{}, Capabilities, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, 0, err
+	}
+	b := LookupBackend(rawurl)
+	if b == nil {
+		return nil, 0, fmt.Errorf("%s: %s (registered schemes: %s)", rawurl, ErrNoBackend, strings.Join(Backends(), ", "))
+	}
+	caps := b.Capabilities()
+	s, err := b.Open(u, opt)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkCapabilities(s, caps); err != nil {
+		return nil, 0, fmt.Errorf("%s: store backend %q: %s", rawurl, u.Scheme, err)
+	}
+	return s, caps, nil
+}
+
+// checkCapabilities returns an error if s doesn't implement the
+// interfaces of caps.
+func checkCapabilities(s interface{}, caps Capabilities) error {
+	multi := caps.Has(CapMultiRepo)
+	var missing []string
+	check := func(c Capabilities, ok, multiOK bool, name string) {
+		if !caps.Has(c) {
+			return
+		}
+		if multi {
+			ok, name = multiOK, "MultiRepo"+strings.TrimPrefix(name, "Repo")
+		}
+		if !ok {
+			missing = append(missing, name)
+		}
+	}
+	_, rs := s.(RepoStore)
+	_, mrs := s.(MultiRepoStore)
+	check(CapQuery, rs, mrs, "RepoStore")
+	_, ri := s.(RepoImporter)
+	_, mri := s.(MultiRepoImporter)
+	check(CapImport, ri, mri, "RepoImporter")
+	_, rx := s.(RepoIndexer)
+	_, mrx := s.(MultiRepoIndexer)
+	check(CapIndex, rx, mrx, "RepoIndexer")
+	_, rst := s.(RepoStager)
+	_, mrst := s.(MultiRepoStager)
+	check(CapStaging, rst, mrst, "RepoStager")
+	if len(missing) > 0 {
+		return fmt.Errorf("store (type %T) has capabilities %s but does not implement %s", s, caps, strings.Join(missing, ", "))
+	}
+	return nil
+}
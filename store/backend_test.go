@@ -0,0 +1,79 @@
+package store
+
+import (
+	"net/url"
+	"testing"
+)
+
+// testBackend opens in-memory multi-repo stores, recording the URL and
+// options that it was called with.
+type testBackend struct {
+	caps Capabilities
+	u    *url.URL
+	opt  BackendOptions
+}
+
+func (b *testBackend) Capabilities() Capabilities { return b.caps }
+
+func (b *testBackend) Open(u *url.URL, opt BackendOptions) (interface{}, error) {
+	b.u, b.opt = u, opt
+	return newMemoryMultiRepoStore(), nil
+}
+
+func TestOpenURL(t *testing.T) {
+	b := &testBackend{caps: CapQuery | CapMultiRepo | CapImport}
+	RegisterBackend("testmem", b)
+	defer delete(backends, "testmem")
+
+	s, caps, err := OpenURL("testmem://host/db?x=1", BackendOptions{ReadOnly: true, Config: []byte("{}")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.(MultiRepoStoreImporter); !ok {
+		t.Errorf("got store of type %T, want a MultiRepoStoreImporter", s)
+	}
+	if caps != b.caps {
+		t.Errorf("got capabilities %s, want %s", caps, b.caps)
+	}
+	if b.u.Host != "host" || b.u.Path != "/db" || !b.opt.ReadOnly || string(b.opt.Config) != "{}" {
+		t.Errorf("backend opened %v with %+v", b.u, b.opt)
+	}
+
+	if LookupBackend("testmem://x") != b {
+		t.Error("LookupBackend didn't return the registered backend")
+	}
+	for _, s := range []string{"testmem", "/testmem://x", "other://x"} {
+		if LookupBackend(s) != nil {
+			t.Errorf("LookupBackend(%q) returned a backend", s)
+		}
+	}
+	if _, _, err := OpenURL("other://x", BackendOptions{}); err == nil {
+		t.Error("got no error for a scheme with no backend")
+	}
+
+	// The memory store isn't staged or indexed.
+	b.caps |= CapStaging | CapIndex
+	if _, _, err := OpenURL("testmem://x", BackendOptions{}); err == nil {
+		t.Error("got no error for a store that lacks its backend's capabilities")
+	}
+}
+
+func TestRegisterBackend_dup(t *testing.T) {
+	RegisterBackend("testdup", &testBackend{})
+	defer delete(backends, "testdup")
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterBackend didn't panic for a duplicate scheme")
+		}
+	}()
+	RegisterBackend("testdup", &testBackend{})
+}
+
+func TestCapabilities_String(t *testing.T) {
+	if s := (CapQuery | CapImport).String(); s != "query,import" {
+		t.Errorf("got %q, want %q", s, "query,import")
+	}
+	if s := Capabilities(0).String(); s != "none" {
+		t.Errorf("got %q, want %q", s, "none")
+	}
+}
@@ -0,0 +1,358 @@
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// A RepoContentIndexer stores a content index (see ContentIndex) for
+// each commit of a repository.
+type RepoContentIndexer interface {
+	// ImportContentIndex stores x as the content index for the
+	// commit, replacing any existing content index.
+	ImportContentIndex(commitID string, x *ContentIndex) error
+
+	// ContentIndex returns the content index for the commit. If
+	// there is none, an error satisfying os.IsNotExist is returned.
+	ContentIndex(commitID string) (*ContentIndex, error)
+}
+
+// A MultiRepoContentIndexer stores a content index (see
+// ContentIndex) for each commit of each repository.
+type MultiRepoContentIndexer interface {
+	ImportContentIndex(repo, commitID string, x *ContentIndex) error
+	ContentIndex(repo, commitID string) (*ContentIndex, error)
+}
+
+// contentIndexFilename is the name of the file (in a commit's tree
+// store dir) that holds the commit's content index.
+const contentIndexFilename = "content.idx"
+
+// MaxContentFileSize is the size of the largest file that
+// NewContentIndex indexes. Larger files are skipped.
+const MaxContentFileSize = 1 << 20
+
+// A ContentIndex is a trigram index of the contents of the files in a
+// commit's source units, which allows for regexp search over their
+// contents (see Search).
+//
+// Unlike the other indexes, the content index is optional (because it
+// holds a copy of every file) and is built from file contents, not
+// from build data.
+type ContentIndex struct {
+	// Files are the indexed files, sorted by path.
+	Files []*ContentFile
+
+	// Trigrams are the distinct (lowercased) trigrams in the indexed
+	// files, sorted. Postings[i] holds the (sorted) indexes in Files
+	// of the files that contain Trigrams[i].
+	Trigrams []uint32
+	Postings [][]uint32
+}
+
+// A ContentFile is a file in a ContentIndex.
+type ContentFile struct {
+	Path  string     // path relative to the repository root
+	Units []unit.ID2 // source units that contain the file
+	Data  []byte     // file contents
+}
+
+// NewContentIndex builds a content index of files. Binary files (that
+// contain a NUL byte) and files larger than MaxContentFileSize are
+// skipped.
+func NewContentIndex(files []*ContentFile) *ContentIndex {
+	x := &ContentIndex{}
+	for _, f := range files {
+		if len(f.Data) > MaxContentFileSize || bytes.IndexByte(f.Data, 0) != -1 {
+			continue
+		}
+		x.Files = append(x.Files, f)
+	}
+	sort.Sort(contentFilesByPath(x.Files))
+
+	postings := map[uint32][]uint32{}
+	for i, f := range x.Files {
+		for t := range trigramSet(bytes.ToLower(f.Data)) {
+			postings[t] = append(postings[t], uint32(i))
+		}
+	}
+	x.Trigrams = make([]uint32, 0, len(postings))
+	for t := range postings {
+		x.Trigrams = append(x.Trigrams, t)
+	}
+	sort.Sort(uint32s(x.Trigrams))
+	x.Postings = make([][]uint32, len(x.Trigrams))
+	for i, t := range x.Trigrams {
+		x.Postings[i] = postings[t] // already sorted, since files are added in order
+	}
+	return x
+}
+
+// ContentSearchOptions restricts a content search.
+type ContentSearchOptions struct {
+	// Units, if set, restricts the search to files in any of these
+	// source units.
+	Units []unit.ID2
+
+	// Files, if set, restricts the search to these files (or files
+	// beneath these dirs).
+	Files []string
+
+	// Limit is the max number of matches to return (0 for all).
+	Limit int
+}
+
+// A ContentMatch is a regexp match in an indexed file.
+type ContentMatch struct {
+	File  string
+	Units []unit.ID2
+
+	// Line is the 1-indexed line number of the line that contains
+	// the start of the match.
+	Line int
+
+	// Start and End are the byte offsets of the match in the file.
+	Start, End int
+
+	// Text is the line that contains the start of the match.
+	Text string
+}
+
+// Search returns the matches of re in the indexed files that satisfy
+// opt. Matches are ordered by file path and offset.
+//
+// The index is used to skip files that can't contain a match (because
+// they lack a trigram of a literal string that every match must
+// contain); the remaining files are searched with re.
+func (x *ContentIndex) Search(re *regexp.Regexp, opt ContentSearchOptions) ([]*ContentMatch, error) {
+	syn, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*ContentMatch
+	for _, i := range x.candidates(requiredLiterals(syn.Simplify())) {
+		f := x.Files[i]
+		if !f.selected(opt) {
+			continue
+		}
+		for _, loc := range re.FindAllIndex(f.Data, -1) {
+			if loc[0] == loc[1] {
+				continue // skip empty matches
+			}
+			lineStart := bytes.LastIndexByte(f.Data[:loc[0]], '\n') + 1
+			lineEnd := bytes.IndexByte(f.Data[loc[0]:], '\n')
+			if lineEnd == -1 {
+				lineEnd = len(f.Data)
+			} else {
+				lineEnd += loc[0]
+			}
+			matches = append(matches, &ContentMatch{
+				File:  f.Path,
+				Units: f.Units,
+				Line:  bytes.Count(f.Data[:loc[0]], []byte{'\n'}) + 1,
+				Start: loc[0],
+				End:   loc[1],
+				Text:  string(f.Data[lineStart:lineEnd]),
+			})
+			if opt.Limit > 0 && len(matches) == opt.Limit {
+				return matches, nil
+			}
+		}
+	}
+	return matches, nil
+}
+
+// candidates returns the indexes (in x.Files, in ascending order) of
+// the files that contain all trigrams of all of the literals.
+func (x *ContentIndex) candidates(literals []string) []uint32 {
+	var cands []uint32
+	all := true // whether cands is (implicitly) all files
+	for _, lit := range literals {
+		for t := range trigramSet([]byte(strings.ToLower(lit))) {
+			i := sort.Search(len(x.Trigrams), func(i int) bool { return x.Trigrams[i] >= t })
+			if i == len(x.Trigrams) || x.Trigrams[i] != t {
+				return nil
+			}
+			if all {
+				cands = x.Postings[i]
+				all = false
+			} else {
+				cands = intersectSorted(cands, x.Postings[i])
+			}
+		}
+	}
+	if all {
+		cands = make([]uint32, len(x.Files))
+		for i := range cands {
+			cands[i] = uint32(i)
+		}
+	}
+	return cands
+}
+
+func (f *ContentFile) selected(opt ContentSearchOptions) bool {
+	if len(opt.Units) > 0 {
+		found := false
+		for _, u := range f.Units {
+			for _, u2 := range opt.Units {
+				if u == u2 {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(opt.Files) > 0 {
+		found := false
+		for _, file := range opt.Files {
+			if f.Path == file || strings.HasPrefix(f.Path, strings.TrimSuffix(file, "/")+"/") {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// requiredLiterals returns literal strings that every match of re
+// must contain. It is conservative: it may omit some (or all) of them.
+func requiredLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return requiredLiterals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		var lits []string
+		for _, sub := range re.Sub {
+			lits = append(lits, requiredLiterals(sub)...)
+		}
+		return lits
+	}
+	return nil
+}
+
+// trigramSet returns the set of trigrams in data, each packed into
+// the low 24 bits of a uint32.
+func trigramSet(data []byte) map[uint32]struct{} {
+	ts := map[uint32]struct{}{}
+	for i := 0; i+3 <= len(data); i++ {
+		ts[uint32(data[i])<<16|uint32(data[i+1])<<8|uint32(data[i+2])] = struct{}{}
+	}
+	return ts
+}
+
+func intersectSorted(a, b []uint32) []uint32 {
+	var c []uint32
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			c = append(c, a[i])
+			i++
+			j++
+		}
+	}
+	return c
+}
+
+// Write writes the content index to w.
+func (x *ContentIndex) Write(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(x)
+}
+
+// ReadContentIndex reads a content index (previously written with
+// (*ContentIndex).Write) from r.
+func ReadContentIndex(r io.Reader) (*ContentIndex, error) {
+	var x ContentIndex
+	if err := gob.NewDecoder(r).Decode(&x); err != nil {
+		return nil, err
+	}
+	if len(x.Trigrams) != len(x.Postings) {
+		return nil, fmt.Errorf("corrupt content index: %d trigrams but %d posting lists", len(x.Trigrams), len(x.Postings))
+	}
+	return &x, nil
+}
+
+// ImportContentIndex implements RepoContentIndexer.
+func (s *fsRepoStore) ImportContentIndex(commitID string, x *ContentIndex) error {
+	fs := s.treeStoreFS(commitID)
+	if err := rwvfs.MkdirAll(fs, "."); err != nil {
+		return err
+	}
+	f, err := fs.Create(contentIndexFilename)
+	if err != nil {
+		return err
+	}
+	if err := x.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ContentIndex implements RepoContentIndexer.
+func (s *fsRepoStore) ContentIndex(commitID string) (*ContentIndex, error) {
+	f, err := s.treeStoreFS(commitID).Open(contentIndexFilename)
+	if err != nil {
+		if isOSOrVFSNotExist(err) {
+			return nil, &os.PathError{Op: "open", Path: contentIndexFilename, Err: os.ErrNotExist}
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return ReadContentIndex(f)
+}
+
+// ImportContentIndex implements MultiRepoContentIndexer.
+func (s *fsMultiRepoStore) ImportContentIndex(repo, commitID string, x *ContentIndex) error {
+	subpath := s.fs.Join(s.RepoToPath(repo)...)
+	if err := rwvfs.MkdirAll(s.fs, subpath); err != nil {
+		return err
+	}
+	return s.openRepoStore(repo).(RepoContentIndexer).ImportContentIndex(commitID, x)
+}
+
+// ContentIndex implements MultiRepoContentIndexer.
+func (s *fsMultiRepoStore) ContentIndex(repo, commitID string) (*ContentIndex, error) {
+	return s.openRepoStore(repo).(RepoContentIndexer).ContentIndex(commitID)
+}
+
+var (
+	_ RepoContentIndexer      = (*fsRepoStore)(nil)
+	_ MultiRepoContentIndexer = (*fsMultiRepoStore)(nil)
+)
+
+type contentFilesByPath []*ContentFile
+
+func (v contentFilesByPath) Len() int           { return len(v) }
+func (v contentFilesByPath) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v contentFilesByPath) Less(i, j int) bool { return v[i].Path < v[j].Path }
+
+type uint32s []uint32
+
+func (v uint32s) Len() int           { return len(v) }
+func (v uint32s) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
+func (v uint32s) Less(i, j int) bool { return v[i] < v[j] }
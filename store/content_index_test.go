@@ -0,0 +1,69 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestContentIndex_Search(t *testing.T) {
+	u1 := unit.ID2{Type: "t", Name: "u1"}
+	u2 := unit.ID2{Type: "t", Name: "u2"}
+	x := NewContentIndex([]*ContentFile{
+		{Path: "b/b.go", Units: []unit.ID2{u2}, Data: []byte("package b\n\nfunc NewServer() {}\n")},
+		{Path: "a.go", Units: []unit.ID2{u1}, Data: []byte("package a\n\ntype HTTPServer struct{}\n")},
+		{Path: "bin", Units: []unit.ID2{u1}, Data: []byte("Server\x00")},
+	})
+	if len(x.Files) != 2 {
+		t.Fatalf("got %d indexed files, want 2 (binary file skipped)", len(x.Files))
+	}
+
+	tests := []struct {
+		re   string
+		opt  ContentSearchOptions
+		want []string // "file:line"
+	}{
+		{`Server`, ContentSearchOptions{}, []string{"a.go:3", "b/b.go:3"}},
+		{`(?i)httpserver`, ContentSearchOptions{}, []string{"a.go:3"}},
+		{`func \w+Server`, ContentSearchOptions{}, []string{"b/b.go:3"}},
+		{`package [ab]`, ContentSearchOptions{}, []string{"a.go:1", "b/b.go:1"}},
+		{`Server|Client`, ContentSearchOptions{}, []string{"a.go:3", "b/b.go:3"}},
+		{`Server`, ContentSearchOptions{Units: []unit.ID2{u2}}, []string{"b/b.go:3"}},
+		{`Server`, ContentSearchOptions{Files: []string{"b"}}, []string{"b/b.go:3"}},
+		{`Server`, ContentSearchOptions{Limit: 1}, []string{"a.go:3"}},
+		{`NoSuchThing`, ContentSearchOptions{}, nil},
+	}
+	for _, test := range tests {
+		matches, err := x.Search(regexp.MustCompile(test.re), test.opt)
+		if err != nil {
+			t.Errorf("%q: %s", test.re, err)
+			continue
+		}
+		var got []string
+		for _, m := range matches {
+			got = append(got, fmt.Sprintf("%s:%d", m.File, m.Line))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q %+v: got %v, want %v", test.re, test.opt, got, test.want)
+		}
+	}
+}
+
+func TestContentIndex_WriteRead(t *testing.T) {
+	x := NewContentIndex([]*ContentFile{{Path: "a.go", Units: []unit.ID2{{Type: "t", Name: "u"}}, Data: []byte("abcd")}})
+	var buf bytes.Buffer
+	if err := x.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	x2, err := ReadContentIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(x2, x) {
+		t.Errorf("got %+v, want %+v", x2, x)
+	}
+}
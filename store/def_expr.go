@@ -0,0 +1,576 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// A DefExpr is a boolean expression of def properties (kind, source
+// unit, file, name, and whether the def is exported), which selects the
+// defs that it is true for. DefExprs are built with the Expr* funcs or
+// parsed from the query language of ParseDefExpr, and are queried with
+// the filters of DefExprFilters.
+//
+// A DefExpr's String method returns it in the query language.
+type DefExpr interface {
+	DefFilter
+	String() string
+
+	// selectUnit returns whether the expression is true for all,
+	// some, or none of the defs in u.
+	selectUnit(u *unit.SourceUnit) exprMatch
+}
+
+// exprMatch is whether an expression is true for all, some, or none
+// of the defs in a source unit.
+type exprMatch int
+
+const (
+	matchNone exprMatch = iota
+	matchSome
+	matchAll
+)
+
+func (m exprMatch) not() exprMatch { return matchAll - m }
+
+type kindExpr string
+
+// ExprKind returns an expression that is true for defs of the kind
+// (e.g., "func").
+func ExprKind(kind string) DefExpr { return kindExpr(kind) }
+
+func (e kindExpr) SelectDef(def *graph.Def) bool         { return def.Kind == string(e) }
+func (e kindExpr) selectUnit(*unit.SourceUnit) exprMatch { return matchSome }
+func (e kindExpr) String() string                        { return "kind:" + quoteExprValue(string(e)) }
+
+type unitNameExpr string
+
+// ExprUnit returns an expression that is true for defs in source units
+// with the name (of any type; see also ExprUnitType).
+func ExprUnit(name string) DefExpr { return unitNameExpr(name) }
+
+func (e unitNameExpr) SelectDef(def *graph.Def) bool { return def.Unit == string(e) }
+func (e unitNameExpr) selectUnit(u *unit.SourceUnit) exprMatch {
+	return matchIf(u.Name == string(e))
+}
+func (e unitNameExpr) String() string { return "unit:" + quoteExprValue(string(e)) }
+
+type unitTypeExpr string
+
+// ExprUnitType returns an expression that is true for defs in source
+// units of the type (e.g., "GoPackage").
+func ExprUnitType(unitType string) DefExpr { return unitTypeExpr(unitType) }
+
+func (e unitTypeExpr) SelectDef(def *graph.Def) bool { return def.UnitType == string(e) }
+func (e unitTypeExpr) selectUnit(u *unit.SourceUnit) exprMatch {
+	return matchIf(u.Type == string(e))
+}
+func (e unitTypeExpr) String() string { return "unittype:" + quoteExprValue(string(e)) }
+
+func matchIf(b bool) exprMatch {
+	if b {
+		return matchAll
+	}
+	return matchNone
+}
+
+type fileExpr string
+
+// ExprFile returns an expression that is true for defs in files whose
+// paths match the glob pattern (in path.Match syntax). A pattern
+// without a "/" is matched against the files' base names, so "*.go"
+// matches Go files in all dirs.
+func ExprFile(pattern string) (DefExpr, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("bad file pattern %q: %s", pattern, err)
+	}
+	return fileExpr(pattern), nil
+}
+
+func (e fileExpr) match(file string) bool {
+	if !strings.Contains(string(e), "/") {
+		file = path.Base(file)
+	}
+	ok, _ := path.Match(string(e), file)
+	return ok
+}
+
+func (e fileExpr) SelectDef(def *graph.Def) bool { return e.match(def.File) }
+func (e fileExpr) selectUnit(u *unit.SourceUnit) exprMatch {
+	for _, f := range u.Files {
+		if e.match(f) {
+			return matchSome
+		}
+	}
+	return matchNone
+}
+func (e fileExpr) String() string { return "file:" + quoteExprValue(string(e)) }
+
+type nameExpr struct{ re *regexp.Regexp }
+
+// ExprName returns an expression that is true for defs whose names
+// contain a match of re (which is not anchored unless it begins with
+// "^").
+func ExprName(re *regexp.Regexp) DefExpr { return nameExpr{re} }
+
+func (e nameExpr) SelectDef(def *graph.Def) bool         { return e.re.MatchString(def.Name) }
+func (e nameExpr) selectUnit(*unit.SourceUnit) exprMatch { return matchSome }
+func (e nameExpr) String() string                        { return "name:" + quoteExprValue(e.re.String()) }
+
+type exportedExpr bool
+
+// ExprExported returns an expression that is true for exported defs
+// (or, if exported is false, for unexported defs).
+func ExprExported(exported bool) DefExpr { return exportedExpr(exported) }
+
+func (e exportedExpr) SelectDef(def *graph.Def) bool         { return def.Exported == bool(e) }
+func (e exportedExpr) selectUnit(*unit.SourceUnit) exprMatch { return matchSome }
+func (e exportedExpr) String() string                        { return "exported:" + strconv.FormatBool(bool(e)) }
+
+type andExpr []DefExpr
+
+// ExprAnd returns an expression that is true if all of es are true (or,
+// if es is empty, always).
+func ExprAnd(es ...DefExpr) DefExpr {
+	if len(es) == 1 {
+		return es[0]
+	}
+	return andExpr(es)
+}
+
+func (e andExpr) SelectDef(def *graph.Def) bool {
+	for _, e := range e {
+		if !e.SelectDef(def) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e andExpr) selectUnit(u *unit.SourceUnit) exprMatch {
+	m := matchAll
+	for _, e := range e {
+		switch e.selectUnit(u) {
+		case matchNone:
+			return matchNone
+		case matchSome:
+			m = matchSome
+		}
+	}
+	return m
+}
+
+func (e andExpr) String() string { return joinExprs(e, " and ") }
+
+type orExpr []DefExpr
+
+// ExprOr returns an expression that is true if any of es are true (or,
+// if es is empty, never).
+func ExprOr(es ...DefExpr) DefExpr {
+	if len(es) == 1 {
+		return es[0]
+	}
+	return orExpr(es)
+}
+
+func (e orExpr) SelectDef(def *graph.Def) bool {
+	for _, e := range e {
+		if e.SelectDef(def) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e orExpr) selectUnit(u *unit.SourceUnit) exprMatch {
+	m := matchNone
+	for _, e := range e {
+		switch e.selectUnit(u) {
+		case matchAll:
+			return matchAll
+		case matchSome:
+			m = matchSome
+		}
+	}
+	return m
+}
+
+func (e orExpr) String() string { return joinExprs(e, " or ") }
+
+type notExpr struct{ e DefExpr }
+
+// ExprNot returns an expression that is true if e is false.
+func ExprNot(e DefExpr) DefExpr { return notExpr{e} }
+
+func (e notExpr) SelectDef(def *graph.Def) bool           { return !e.e.SelectDef(def) }
+func (e notExpr) selectUnit(u *unit.SourceUnit) exprMatch { return e.e.selectUnit(u).not() }
+func (e notExpr) String() string                          { return "not " + parenExpr(e.e) }
+
+func joinExprs(es []DefExpr, op string) string {
+	if len(es) == 0 {
+		if op == " and " {
+			return "()"
+		}
+		return "not ()"
+	}
+	s := make([]string, len(es))
+	for i, e := range es {
+		s[i] = parenExpr(e)
+	}
+	return strings.Join(s, op)
+}
+
+// parenExpr returns e's String, parenthesized if it has operators.
+func parenExpr(e DefExpr) string {
+	switch e := e.(type) {
+	case andExpr, orExpr:
+		if s := e.String(); s != "()" {
+			return "(" + s + ")"
+		}
+	}
+	return e.String()
+}
+
+// quoteExprValue returns v as a value in the query language (quoted
+// if necessary).
+func quoteExprValue(v string) string {
+	if v == "" || strings.ContainsAny(v, "()\"") || strings.IndexFunc(v, unicode.IsSpace) != -1 {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// A ByDefExprFilter is a filter (returned by DefExprFilters) that
+// selects the defs that an expression is true for, so that stores
+// that query other stores (such as a gRPC store) can pass the
+// expression on.
+type ByDefExprFilter interface {
+	ByDefExpr() DefExpr
+}
+
+// DefExprFilters returns the filters that select the defs that e is
+// true for. Besides selecting defs, they limit queries to the source
+// units that may have such defs: the units that e requires (e.g.,
+// with "unittype:GoPackage and unit:fmt"), which are opened directly,
+// and the units whose types, names, and files don't rule out a match,
+// which are found with the stores' unit indexes.
+func DefExprFilters(e DefExpr) []DefFilter {
+	fs := []DefFilter{defExprFilter{e}}
+	if units, ok := impliedUnits(e); ok && len(units) > 0 {
+		fs = append(fs, ByUnits(units...))
+	}
+	return fs
+}
+
+type defExprFilter struct{ e DefExpr }
+
+func (f defExprFilter) String() string                { return fmt.Sprintf("ByDefExpr(%s)", f.e) }
+func (f defExprFilter) ByDefExpr() DefExpr            { return f.e }
+func (f defExprFilter) SelectDef(def *graph.Def) bool { return f.e.SelectDef(def) }
+func (f defExprFilter) SelectUnit(u *unit.SourceUnit) bool {
+	return f.e.selectUnit(u) != matchNone
+}
+
+// impliedUnits returns the source units that e is false outside of,
+// sorted, or false if it isn't limited to a set of units.
+func impliedUnits(e DefExpr) ([]unit.ID2, bool) {
+	switch e := e.(type) {
+	case andExpr:
+		var types, names []string
+		var set map[unit.ID2]bool
+		intersect := func(units []unit.ID2) {
+			s := make(map[unit.ID2]bool, len(units))
+			for _, u := range units {
+				if set == nil || set[u] {
+					s[u] = true
+				}
+			}
+			set = s
+		}
+		for _, e := range e {
+			switch e := e.(type) {
+			case unitTypeExpr:
+				types = appendUniq(types, string(e))
+			case unitNameExpr:
+				names = appendUniq(names, string(e))
+			default:
+				if units, ok := impliedUnits(e); ok {
+					intersect(units)
+				}
+			}
+		}
+		if len(types) > 0 && len(names) > 0 {
+			var units []unit.ID2
+			if len(types) == 1 && len(names) == 1 {
+				units = []unit.ID2{{Type: types[0], Name: names[0]}}
+			}
+			intersect(units)
+		}
+		if set == nil {
+			return nil, false
+		}
+		return sortedUnits(set), true
+	case orExpr:
+		set := map[unit.ID2]bool{}
+		for _, e := range e {
+			units, ok := impliedUnits(e)
+			if !ok {
+				return nil, false
+			}
+			for _, u := range units {
+				set[u] = true
+			}
+		}
+		return sortedUnits(set), true
+	}
+	return nil, false
+}
+
+func appendUniq(s []string, v string) []string {
+	for _, w := range s {
+		if w == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
+
+func sortedUnits(set map[unit.ID2]bool) []unit.ID2 {
+	units := make([]unit.ID2, 0, len(set))
+	for u := range set {
+		units = append(units, u)
+	}
+	sort.Slice(units, func(i, j int) bool {
+		if units[i].Type != units[j].Type {
+			return units[i].Type < units[j].Type
+		}
+		return units[i].Name < units[j].Name
+	})
+	return units
+}
+
+// ParseDefExpr parses an expression in the def query language:
+//
+//	kind:func and exported:true and not file:*_test.go
+//	unittype:GoPackage unit:net/http (name:^Serve or name:Handler$)
+//	-kind:var name:"^(Get|Set)[A-Z]"
+//
+// Terms are FIELD:VALUE, where FIELD is one of:
+//
+//	kind      the def's kind
+//	unit      the name of the def's source unit
+//	unittype  the type of the def's source unit
+//	file      a glob pattern of the def's file (see ExprFile)
+//	name      a regexp of the def's name (see ExprName)
+//	exported  true or false
+//
+// VALUE may be quoted (as a Go string literal) if it contains spaces,
+// parentheses, or quotes. Terms are combined with "and", "or", "not"
+// (or "-"), and parentheses. "and" binds more tightly than "or", and
+// is implied between adjacent terms.
+func ParseDefExpr(s string) (DefExpr, error) {
+	p := &exprParser{s: s}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return e, nil
+}
+
+type exprParser struct {
+	s   string
+	pos int
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("def query %q: at offset %d: %s", p.s, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// keyword consumes and returns true if the next word is the keyword
+// kw (in any case).
+func (p *exprParser) keyword(kw string) bool {
+	p.skipSpace()
+	end := p.pos + len(kw)
+	if end > len(p.s) || !strings.EqualFold(p.s[p.pos:end], kw) {
+		return false
+	}
+	if end < len(p.s) && !unicode.IsSpace(rune(p.s[end])) && p.s[end] != '(' && p.s[end] != '-' {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *exprParser) parseOr() (DefExpr, error) {
+	var es []DefExpr
+	for {
+		e, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+		if !p.keyword("or") {
+			return ExprOr(es...), nil
+		}
+	}
+}
+
+func (p *exprParser) parseAnd() (DefExpr, error) {
+	var es []DefExpr
+	for {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+		if p.keyword("and") {
+			continue
+		}
+		p.skipSpace()
+		if save := p.pos; p.pos == len(p.s) || p.s[p.pos] == ')' || p.keyword("or") {
+			p.pos = save
+			return ExprAnd(es...), nil
+		}
+	}
+}
+
+func (p *exprParser) parseUnary() (DefExpr, error) {
+	p.skipSpace()
+	if p.pos == len(p.s) {
+		return nil, p.errorf("expected a term")
+	}
+	if p.s[p.pos] == '-' {
+		p.pos++
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return ExprNot(e), nil
+	}
+	if p.keyword("not") {
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return ExprNot(e), nil
+	}
+	if p.s[p.pos] == '(' {
+		p.pos++
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos == len(p.s) || p.s[p.pos] != ')' {
+			return nil, p.errorf("expected )")
+		}
+		p.pos++
+		return e, nil
+	}
+	return p.parseTerm()
+}
+
+func (p *exprParser) parseTerm() (DefExpr, error) {
+	start := p.pos
+	for p.pos < len(p.s) && (p.s[p.pos] == '_' || unicode.IsLetter(rune(p.s[p.pos]))) {
+		p.pos++
+	}
+	field := strings.ToLower(p.s[start:p.pos])
+	if field == "" || p.pos == len(p.s) || p.s[p.pos] != ':' {
+		p.pos = start
+		return nil, p.errorf("expected FIELD:VALUE")
+	}
+	p.pos++
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	switch field {
+	case "kind":
+		return ExprKind(value), nil
+	case "unit":
+		return ExprUnit(value), nil
+	case "unittype", "unit_type":
+		return ExprUnitType(value), nil
+	case "file":
+		e, err := ExprFile(value)
+		if err != nil {
+			return nil, p.errorf("%s", err)
+		}
+		return e, nil
+	case "name":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, p.errorf("bad name regexp: %s", err)
+		}
+		return ExprName(re), nil
+	case "exported":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, p.errorf("exported must be true or false")
+		}
+		return ExprExported(b), nil
+	}
+	return nil, p.errorf("unknown field %q (valid fields are kind, unit, unittype, file, name, exported)", field)
+}
+
+// parseValue parses a quoted value, or a bare value, which ends at a
+// space or at a ")" that closes a parenthesis before the value.
+func (p *exprParser) parseValue() (string, error) {
+	if p.pos < len(p.s) && p.s[p.pos] == '"' {
+		end := p.pos + 1
+		for ; end < len(p.s) && p.s[end] != '"'; end++ {
+			if p.s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(p.s) {
+			return "", p.errorf("unterminated quoted value")
+		}
+		v, err := strconv.Unquote(p.s[p.pos : end+1])
+		if err != nil {
+			return "", p.errorf("bad quoted value: %s", err)
+		}
+		p.pos = end + 1
+		return v, nil
+	}
+	start, depth := p.pos, 0
+loop:
+	for ; p.pos < len(p.s); p.pos++ {
+		switch c := p.s[p.pos]; {
+		case unicode.IsSpace(rune(c)):
+			break loop
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				break loop
+			}
+			depth--
+		}
+	}
+	if p.pos == start {
+		return "", errors.New("empty value (use \"\" for an empty value)")
+	}
+	return p.s[start:p.pos], nil
+}
@@ -0,0 +1,192 @@
+package store
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestParseDefExpr(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{"kind:func", "kind:func"},
+		{"kind:func exported:true", "kind:func and exported:true"},
+		{"KIND:func AND not file:*_test.go", "kind:func and not file:*_test.go"},
+		{"-kind:var or name:^F", "not kind:var or name:^F"},
+		{"unittype:GoPackage unit:a (name:x or name:y)", "unittype:GoPackage and unit:a and (name:x or name:y)"},
+		{"(kind:func)", "kind:func"},
+		{`name:"a b" file:"(x)"`, `name:"a b" and file:"(x)"`},
+		{"(name:(a|b))", `name:"(a|b)"`},
+		{"not (kind:a or kind:b)", "not (kind:a or kind:b)"},
+		{"unit_type:GoPackage", "unittype:GoPackage"},
+	}
+	for _, test := range tests {
+		e, err := ParseDefExpr(test.expr)
+		if err != nil {
+			t.Errorf("%q: %s", test.expr, err)
+			continue
+		}
+		if s := e.String(); s != test.want {
+			t.Errorf("%q: got String %q, want %q", test.expr, s, test.want)
+		}
+		if e2, err := ParseDefExpr(e.String()); err != nil || e2.String() != e.String() {
+			t.Errorf("%q: String %q didn't round-trip (got %v, err %v)", test.expr, e, e2, err)
+		}
+	}
+
+	for _, expr := range []string{
+		"", "func", "kind:", "color:red", "exported:maybe", "name:(", "file:[", "(kind:func", "kind:func)", `name:"x`, "kind:a or", "not",
+	} {
+		if _, err := ParseDefExpr(expr); err == nil {
+			t.Errorf("%q: got no error", expr)
+		}
+	}
+}
+
+func TestDefExpr_SelectDef(t *testing.T) {
+	def := &graph.Def{
+		DefKey:   graph.DefKey{UnitType: "GoPackage", Unit: "a/b", Path: "T/F"},
+		Name:     "F",
+		Kind:     "func",
+		File:     "a/b/f.go",
+		Exported: true,
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"kind:func", true},
+		{"kind:var", false},
+		{"unit:a/b unittype:GoPackage", true},
+		{"unit:a", false},
+		{"file:*.go", true},
+		{"file:*_test.go", false},
+		{"file:a/*/f.go", true},
+		{"file:b/*.go", false},
+		{"name:^F$", true},
+		{"name:G", false},
+		{"exported:true", true},
+		{"exported:false", false},
+		{"kind:var or name:F", true},
+		{"kind:func -exported:true", false},
+		{"not (kind:var or exported:false)", true},
+	}
+	for _, test := range tests {
+		e, err := ParseDefExpr(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := e.SelectDef(def); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestDefExpr_selectUnit(t *testing.T) {
+	u := &unit.SourceUnit{Type: "GoPackage", Name: "a", Files: []string{"a/a.go"}}
+	tests := []struct {
+		expr string
+		want exprMatch
+	}{
+		{"unit:a", matchAll},
+		{"unit:b", matchNone},
+		{"not unit:b", matchAll},
+		{"kind:func", matchSome},
+		{"unit:a kind:func", matchSome},
+		{"unit:b kind:func", matchNone},
+		{"unit:b or kind:func", matchSome},
+		{"unit:a or kind:func", matchAll},
+		{"file:*.go", matchSome},
+		{"file:*.py", matchNone},
+		{"not (unittype:GoPackage unit:a)", matchNone},
+	}
+	for _, test := range tests {
+		e, err := ParseDefExpr(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := e.selectUnit(u); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestImpliedUnits(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []unit.ID2 // nil means not limited to a set of units
+	}{
+		{"unit:a", nil},
+		{"unittype:T unit:a", []unit.ID2{{Type: "T", Name: "a"}}},
+		{"unittype:T unit:a kind:func", []unit.ID2{{Type: "T", Name: "a"}}},
+		{"unittype:T unit:a unit:b", []unit.ID2{}},
+		{"(unittype:T unit:b) or (unittype:T unit:a)", []unit.ID2{{Type: "T", Name: "a"}, {Type: "T", Name: "b"}}},
+		{"(unittype:T unit:a) or kind:func", nil},
+		{"((unittype:T unit:a) or (unittype:T unit:b)) (unittype:T unit:b)", []unit.ID2{{Type: "T", Name: "b"}}},
+		{"not (unittype:T unit:a)", nil},
+	}
+	for _, test := range tests {
+		e, err := ParseDefExpr(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		units, ok := impliedUnits(e)
+		if ok != (test.want != nil) || (ok && !reflect.DeepEqual(units, test.want)) {
+			t.Errorf("%q: got units %v (%v), want %v", test.expr, units, ok, test.want)
+		}
+	}
+}
+
+func TestDefExprFilters(t *testing.T) {
+	useIndexedStore = true
+	s := NewFSMultiRepoStore(newTestFS(), nil)
+	for _, name := range []string{"a", "b"} {
+		u := &unit.SourceUnit{Type: "t", Name: name, Files: []string{name + ".go", name + "_test.go"}}
+		data := graph.Output{Defs: []*graph.Def{
+			{DefKey: graph.DefKey{Path: "F"}, Name: "F", Kind: "func", File: name + ".go", Exported: true},
+			{DefKey: graph.DefKey{Path: "g"}, Name: "g", Kind: "func", File: name + ".go"},
+			{DefKey: graph.DefKey{Path: "V"}, Name: "V", Kind: "var", File: name + "_test.go", Exported: true},
+		}}
+		if err := s.Import("r", "c", u, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		e    DefExpr
+		want []string
+	}{
+		{ExprAnd(ExprKind("func"), ExprExported(true)), []string{"a/F", "b/F"}},
+		{ExprAnd(ExprUnitType("t"), ExprUnit("b"), ExprNot(ExprKind("func"))), []string{"b/V"}},
+		{ExprOr(ExprAnd(ExprUnitType("t"), ExprUnit("a"), ExprName(regexp.MustCompile("^g$"))), ExprAnd(ExprUnitType("t"), ExprUnit("b"), ExprKind("var"))), []string{"a/g", "b/V"}},
+		{ExprAnd(ExprUnit("c"), ExprKind("func")), nil},
+	}
+	for _, test := range tests {
+		defs, err := s.Defs(DefExprFilters(test.e)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, def := range defs {
+			got = append(got, def.Unit+"/"+def.Path)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got defs %v, want %v", test.e, got, test.want)
+		}
+	}
+
+	e, _ := ExprFile("*_test.go")
+	defs, err := s.Defs(DefExprFilters(e)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 2 {
+		t.Errorf("%s: got %d defs, want 2", e, len(defs))
+	}
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/alecthomas/binary"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// defFuzzyIndex makes it fast to find defs whose names fuzzily match
+// a query (see FuzzyMatch). It stores each distinct def name once
+// (with the byte offsets of the defs with that name), so a query only
+// needs to match against names, not decode defs.
+type defFuzzyIndex struct {
+	f     DefFilter
+	names *fuzzyNameTable
+	ready bool
+}
+
+// fuzzyNameTable is the persisted form of a defFuzzyIndex.
+type fuzzyNameTable struct {
+	Names  []string      // sorted distinct def names
+	Values []byteOffsets // offsets of defs named Names[i]
+}
+
+var _ interface {
+	Index
+	persistedIndex
+	defIndexBuilder
+	defIndex
+} = (*defFuzzyIndex)(nil)
+
+var c_defFuzzyIndex_getByQuery = 0 // counter
+
+func (x *defFuzzyIndex) String() string { return fmt.Sprintf("defFuzzyIndex(ready=%v)", x.ready) }
+
+func (x *defFuzzyIndex) getByQuery(q string) byteOffsets {
+	vlog.Printf("defFuzzyIndex.getByQuery(%q)", q)
+	c_defFuzzyIndex_getByQuery++
+
+	if x.names == nil {
+		panic("fuzzyNameTable not built/read")
+	}
+
+	var ofs byteOffsets
+	for i, name := range x.names.Names {
+		if _, ok := FuzzyMatch(q, name); ok {
+			ofs = append(ofs, x.names.Values[i]...)
+		}
+	}
+	vlog.Printf("defFuzzyIndex.getByQuery(%q): found %d defs.", q, len(ofs))
+	return ofs
+}
+
+// Covers implements defIndex.
+func (x *defFuzzyIndex) Covers(filters interface{}) int {
+	cov := 0
+	for _, f := range storeFilters(filters) {
+		if _, ok := f.(ByDefFuzzyQueryFilter); ok {
+			cov++
+		}
+	}
+	return cov
+}
+
+// Defs implements defIndex.
+func (x *defFuzzyIndex) Defs(f ...DefFilter) (byteOffsets, error) {
+	for _, ff := range f {
+		if pf, ok := ff.(ByDefFuzzyQueryFilter); ok {
+			return x.getByQuery(pf.ByDefFuzzyQuery()), nil
+		}
+	}
+	return nil, nil
+}
+
+// Build implements defIndexBuilder.
+func (x *defFuzzyIndex) Build(defs []*graph.Def, ofs byteOffsets) error {
+	vlog.Printf("defFuzzyIndex: building index... (%d defs)", len(defs))
+	byName := map[string]byteOffsets{}
+	for i, def := range defs {
+		if x.f.SelectDef(def) {
+			byName[def.Name] = append(byName[def.Name], ofs[i])
+		}
+	}
+
+	t := &fuzzyNameTable{
+		Names:  make([]string, 0, len(byName)),
+		Values: make([]byteOffsets, 0, len(byName)),
+	}
+	for name := range byName {
+		t.Names = append(t.Names, name)
+	}
+	sort.Strings(t.Names)
+	for _, name := range t.Names {
+		t.Values = append(t.Values, byName[name])
+	}
+	x.names = t
+	x.ready = true
+	vlog.Printf("defFuzzyIndex: done building index (%d defs, %d distinct names).", len(defs), len(t.Names))
+	return nil
+}
+
+// Write implements persistedIndex.
+func (x *defFuzzyIndex) Write(w io.Writer) error {
+	if x.names == nil {
+		panic("no fuzzyNameTable to write")
+	}
+	b, err := binary.Marshal(x.names)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Read implements persistedIndex.
+func (x *defFuzzyIndex) Read(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var t fuzzyNameTable
+	err = binary.Unmarshal(b, &t)
+	x.names = &t
+	x.ready = (err == nil)
+	return err
+}
+
+// Ready implements persistedIndex.
+func (x *defFuzzyIndex) Ready() bool { return x.ready }
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A CorruptError reports that data or index files in a store could
+// not be decoded. It indicates that the store must be rebuilt (e.g.,
+// by re-importing the affected source units); it is not caused by the
+// query.
+type CorruptError struct {
+	// Store is a description of the store (its String method's
+	// output) that contains the corrupt file.
+	Store string
+
+	// File is the name of the corrupt file, relative to the store's
+	// root.
+	File string
+
+	// Err is the underlying decoding error.
+	Err error
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("%s: corrupt data in %s: %s", e.Store, e.File, e.Err)
+}
+
+func (e *CorruptError) Unwrap() error { return e.Err }
+
+// IsCorrupt returns a boolean indicating whether err is (or wraps) a
+// *CorruptError.
+func IsCorrupt(err error) bool {
+	var ce *CorruptError
+	return errors.As(err, &ce)
+}
@@ -0,0 +1,29 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIsCorrupt(t *testing.T) {
+	decErr := errors.New("unexpected EOF")
+	err := &CorruptError{Store: "s", File: "f", Err: decErr}
+	tests := map[string]struct {
+		err  error
+		want bool
+	}{
+		"corrupt":         {err, true},
+		"wrapped corrupt": {fmt.Errorf("query: %w", err), true},
+		"other":           {decErr, false},
+		"nil":             {nil, false},
+	}
+	for label, test := range tests {
+		if got := IsCorrupt(test.err); got != test.want {
+			t.Errorf("%s: got %v, want %v", label, got, test.want)
+		}
+	}
+	if !errors.Is(err, decErr) {
+		t.Error("got CorruptError not wrapping its Err")
+	}
+}
@@ -0,0 +1,223 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"code.google.com/p/rog-go/parallel"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// errNotSupported is returned by member stores of a federatedStore
+// (such as remote stores) that can't answer a kind of query. The
+// federatedStore skips them for that kind of query.
+var errNotSupported = errors.New("query not supported by store")
+
+// NewFederatedStore returns a MultiRepoStore whose queries are
+// answered by querying each of the members (in parallel) and merging
+// their results. It lets a fresh local index of some repositories be
+// combined with a central, prebuilt index of many others.
+//
+// The data for each repository comes only from the first member (in
+// the order given) that has the repository, so that a local index of
+// a repository shadows an older index of the same repository in a
+// later member. Members that can't answer a kind of query (e.g., a
+// remote store, which can only answer def and ref queries; see
+// NewGRPCStore) are skipped for it, and can't shadow repositories in
+// later members.
+//
+// The returned store does not support importing; import into one of
+// its members instead.
+func NewFederatedStore(members ...MultiRepoStore) MultiRepoStore {
+	return &federatedStore{members: members}
+}
+
+type federatedStore struct {
+	members []MultiRepoStore
+}
+
+func (s *federatedStore) String() string {
+	names := make([]string, len(s.members))
+	for i, m := range s.members {
+		names[i] = fmt.Sprint(m)
+	}
+	return fmt.Sprintf("federatedStore(%s)", strings.Join(names, ", "))
+}
+
+// query calls q for each member in parallel, and returns, for each
+// member, the repos (of those that filters may match) that the
+// member's results must not be in because an earlier member has them.
+func (s *federatedStore) query(filters interface{}, q func(i int, m MultiRepoStore) error) (shadowed []map[string]bool, err error) {
+	if shadowed, err = s.shadowedRepos(filters); err != nil {
+		return nil, err
+	}
+	if err := s.fanOut(s.members, q); err != nil {
+		return nil, err
+	}
+	return shadowed, nil
+}
+
+// fanOut calls q for each of members in parallel. Members for which q
+// returns errNotSupported (or an error satisfying isStoreNotExist)
+// are skipped.
+func (s *federatedStore) fanOut(members []MultiRepoStore, q func(i int, m MultiRepoStore) error) error {
+	par := parallel.NewRun(len(members))
+	for i_, m_ := range members {
+		i, m := i_, m_
+		par.Do(func() error {
+			if err := q(i, m); err != nil && err != errNotSupported && !isStoreNotExist(err) {
+				return err
+			}
+			return nil
+		})
+	}
+	return par.Wait()
+}
+
+// shadowedRepos returns, for each member, the repos (of those that
+// filters may match) that earlier members have.
+func (s *federatedStore) shadowedRepos(filters interface{}) ([]map[string]bool, error) {
+	var repoFilters []RepoFilter
+	if repos, err := scopeRepos(storeFilters(filters)); err != nil {
+		return nil, err
+	} else if repos != nil {
+		if len(repos) == 0 {
+			return make([]map[string]bool, len(s.members)), nil
+		}
+		repoFilters = append(repoFilters, ByRepos(repos...))
+	}
+
+	// The last member's repos don't shadow any member's.
+	memberRepos := make([][]string, len(s.members))
+	if len(s.members) > 1 {
+		if err := s.fanOut(s.members[:len(s.members)-1], func(i int, m MultiRepoStore) (err error) {
+			memberRepos[i], err = m.Repos(repoFilters...)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	shadowed := make([]map[string]bool, len(s.members))
+	seen := map[string]bool{}
+	for i, repos := range memberRepos {
+		if len(seen) > 0 {
+			shadowed[i] = make(map[string]bool, len(seen))
+			for repo := range seen {
+				shadowed[i][repo] = true
+			}
+		}
+		for _, repo := range repos {
+			seen[repo] = true
+		}
+	}
+	return shadowed, nil
+}
+
+func (s *federatedStore) Repos(f ...RepoFilter) ([]string, error) {
+	results := make([][]string, len(s.members))
+	if err := s.fanOut(s.members, func(i int, m MultiRepoStore) (err error) {
+		results[i], err = m.Repos(f...)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	var repos []string
+	seen := map[string]bool{}
+	for _, rs := range results {
+		for _, repo := range rs {
+			if !seen[repo] {
+				seen[repo] = true
+				repos = append(repos, repo)
+			}
+		}
+	}
+	return repos, nil
+}
+
+func (s *federatedStore) Versions(f ...VersionFilter) ([]*Version, error) {
+	results := make([][]*Version, len(s.members))
+	shadowed, err := s.query(f, func(i int, m MultiRepoStore) (err error) {
+		results[i], err = m.Versions(f...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var versions []*Version
+	for i, vs := range results {
+		for _, v := range vs {
+			if !shadowed[i][v.Repo] {
+				versions = append(versions, v)
+			}
+		}
+	}
+	return versions, nil
+}
+
+func (s *federatedStore) Units(f ...UnitFilter) ([]*unit.SourceUnit, error) {
+	results := make([][]*unit.SourceUnit, len(s.members))
+	shadowed, err := s.query(f, func(i int, m MultiRepoStore) (err error) {
+		results[i], err = m.Units(f...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var units []*unit.SourceUnit
+	for i, us := range results {
+		for _, u := range us {
+			if !shadowed[i][u.Repo] {
+				units = append(units, u)
+			}
+		}
+	}
+	return units, nil
+}
+
+func (s *federatedStore) Defs(f ...DefFilter) ([]*graph.Def, error) {
+	results := make([][]*graph.Def, len(s.members))
+	shadowed, err := s.query(f, func(i int, m MultiRepoStore) (err error) {
+		results[i], err = m.Defs(f...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var defs []*graph.Def
+	for i, ds := range results {
+		for _, def := range ds {
+			if !shadowed[i][def.Repo] {
+				defs = append(defs, def)
+			}
+		}
+	}
+	return defs, nil
+}
+
+func (s *federatedStore) Refs(f ...RefFilter) ([]*graph.Ref, error) {
+	shadowed, err := s.shadowedRepos(f)
+	if err != nil {
+		return nil, err
+	}
+	// Some ref filters hold the repo and unit that they are being
+	// applied to (see setImpliedRepo), so the members can't apply
+	// them concurrently.
+	var refs []*graph.Ref
+	for i, m := range s.members {
+		rs, err := m.Refs(f...)
+		if err != nil && err != errNotSupported && !isStoreNotExist(err) {
+			return nil, err
+		}
+		for _, ref := range rs {
+			if !shadowed[i][ref.Repo] {
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs, nil
+}
+
+var _ MultiRepoStore = (*federatedStore)(nil)
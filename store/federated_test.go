@@ -0,0 +1,177 @@
+package store
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+
+	"google.golang.org/grpc"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store/storepb"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// newFederatedTestMember returns a MultiRepoStore with a def named
+// "label" in each of repos.
+func newFederatedTestMember(t *testing.T, label string, repos ...string) MultiRepoStore {
+	s := NewFSMultiRepoStore(newTestFS(), nil)
+	for _, repo := range repos {
+		u := &unit.SourceUnit{Type: "t", Name: "u", Files: []string{"f"}}
+		data := graph.Output{
+			Defs: []*graph.Def{{DefKey: graph.DefKey{Path: "p"}, Name: label, File: "f"}},
+			Refs: []*graph.Ref{{DefPath: "p", File: "f", Start: 1, End: 2}},
+		}
+		if err := s.Import(repo, "c", u, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestFederatedStore(t *testing.T) {
+	s := NewFederatedStore(
+		newFederatedTestMember(t, "local", "r1"),
+		newFederatedTestMember(t, "central", "r1", "r2"),
+	)
+
+	repos, err := s.Repos()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(repos)
+	if want := []string{"r1", "r2"}; !reflect.DeepEqual(repos, want) {
+		t.Errorf("got repos %v, want %v", repos, want)
+	}
+
+	// r1's data comes only from the first member.
+	defs, err := s.Defs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, def := range defs {
+		got[def.Repo] = def.Name
+	}
+	if want := map[string]string{"r1": "local", "r2": "central"}; len(defs) != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("got defs %v, want %v", defs, want)
+	}
+
+	defs, err = s.Defs(ByRepos("r2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || defs[0].Name != "central" {
+		t.Errorf("got defs %v for r2, want the central def", defs)
+	}
+
+	refs, err := s.Refs(ByRefDef(graph.RefDefKey{DefRepo: "r1", DefUnitType: "t", DefUnit: "u", DefPath: "p"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].Repo != "r1" {
+		t.Errorf("got refs %v, want 1 ref in r1", refs)
+	}
+
+	versions, err := s.Versions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Errorf("got versions %v, want 2", versions)
+	}
+}
+
+// fakeQueryClient is a storepb.QueryClient that answers Defs and Refs
+// queries from a MultiRepoStore, and records their options.
+type fakeQueryClient struct {
+	storepb.QueryClient
+	s       MultiRepoStore
+	defsOpt *storepb.DefsOptions
+	refsOpt *storepb.RefsOptions
+}
+
+func (c *fakeQueryClient) Defs(ctx context.Context, opt *storepb.DefsOptions, _ ...grpc.CallOption) (storepb.Query_DefsClient, error) {
+	c.defsOpt = opt
+	defs, err := c.s.Defs()
+	if err != nil {
+		return nil, err
+	}
+	return &fakeDefsClient{defs: defs}, nil
+}
+
+func (c *fakeQueryClient) Refs(ctx context.Context, opt *storepb.RefsOptions, _ ...grpc.CallOption) (storepb.Query_RefsClient, error) {
+	c.refsOpt = opt
+	refs, err := c.s.Refs()
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRefsClient{refs: refs}, nil
+}
+
+type fakeDefsClient struct {
+	grpc.ClientStream
+	defs []*graph.Def
+}
+
+func (c *fakeDefsClient) Recv() (*graph.Def, error) {
+	if len(c.defs) == 0 {
+		return nil, io.EOF
+	}
+	def := c.defs[0]
+	c.defs = c.defs[1:]
+	return def, nil
+}
+
+type fakeRefsClient struct {
+	grpc.ClientStream
+	refs []*graph.Ref
+}
+
+func (c *fakeRefsClient) Recv() (*graph.Ref, error) {
+	if len(c.refs) == 0 {
+		return nil, io.EOF
+	}
+	ref := c.refs[0]
+	c.refs = c.refs[1:]
+	return ref, nil
+}
+
+func TestFederatedStore_grpc(t *testing.T) {
+	c := &fakeQueryClient{s: newFederatedTestMember(t, "remote", "r1", "r2")}
+	s := NewFederatedStore(newFederatedTestMember(t, "local", "r1"), NewGRPCStore(c, "test"))
+
+	// The remote store returns all defs (as a server that doesn't
+	// filter would), so the filters must be applied to its results.
+	defs, err := s.Defs(ByUnits(unit.ID2{Type: "t", Name: "u"}), ByDefPath("p"), ByRepos("r2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || defs[0].Repo != "r2" || defs[0].Name != "remote" {
+		t.Errorf("got defs %v, want the remote def in r2", defs)
+	}
+	if want := (storepb.DefsOptions{Repo: "r2", UnitType: "t", Unit: "u", Path: "p"}); *c.defsOpt != want {
+		t.Errorf("got DefsOptions %+v, want %+v", *c.defsOpt, want)
+	}
+
+	refs, err := s.Refs(ByRefDef(graph.RefDefKey{DefRepo: "r2", DefUnitType: "t", DefUnit: "u", DefPath: "p"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0].Repo != "r2" {
+		t.Errorf("got refs %v, want 1 ref in r2", refs)
+	}
+	if want := (graph.RefDefKey{DefRepo: "r2", DefUnitType: "t", DefUnit: "u", DefPath: "p"}); c.refsOpt.Def != want {
+		t.Errorf("got RefsOptions.Def %+v, want %+v", c.refsOpt.Def, want)
+	}
+
+	// Units are only listed by the local store.
+	units, err := s.Units()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 1 || units[0].Repo != "r1" {
+		t.Errorf("got units %v, want 1 unit in r1", units)
+	}
+}
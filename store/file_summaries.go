@@ -0,0 +1,92 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// A RepoFileSummarizer stores the file summaries (see
+// graph.FileSummary) in the graph output of each commit of a
+// repository, so that the files of a commit can be listed without
+// reading all of its defs.
+type RepoFileSummarizer interface {
+	// ImportFileSummaries stores summaries as the commit's file
+	// summaries, replacing any existing summaries.
+	ImportFileSummaries(commitID string, summaries []*graph.FileSummary) error
+
+	// FileSummaries returns the commit's file summaries. If the
+	// commit has none recorded (e.g., because its data was imported
+	// by an older version of src), an error satisfying os.IsNotExist
+	// is returned.
+	FileSummaries(commitID string) ([]*graph.FileSummary, error)
+}
+
+// A MultiRepoFileSummarizer stores the file summaries in the graph
+// output of each commit of each repository.
+type MultiRepoFileSummarizer interface {
+	ImportFileSummaries(repo, commitID string, summaries []*graph.FileSummary) error
+	FileSummaries(repo, commitID string) ([]*graph.FileSummary, error)
+}
+
+// fileSummariesFilename is the name of the file (in a commit's tree
+// store dir) that holds the commit's file summaries.
+const fileSummariesFilename = "files.json"
+
+// ImportFileSummaries implements RepoFileSummarizer.
+func (s *fsRepoStore) ImportFileSummaries(commitID string, summaries []*graph.FileSummary) error {
+	fs := s.treeStoreFS(commitID)
+	if err := rwvfs.MkdirAll(fs, "."); err != nil {
+		return err
+	}
+	f, err := fs.Create(fileSummariesFilename)
+	if err != nil {
+		return err
+	}
+	if summaries == nil {
+		summaries = []*graph.FileSummary{}
+	}
+	if err := json.NewEncoder(f).Encode(summaries); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// FileSummaries implements RepoFileSummarizer.
+func (s *fsRepoStore) FileSummaries(commitID string) ([]*graph.FileSummary, error) {
+	f, err := s.treeStoreFS(commitID).Open(fileSummariesFilename)
+	if err != nil {
+		if isOSOrVFSNotExist(err) {
+			return nil, &os.PathError{Op: "open", Path: fileSummariesFilename, Err: os.ErrNotExist}
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var summaries []*graph.FileSummary
+	if err := json.NewDecoder(f).Decode(&summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// ImportFileSummaries implements MultiRepoFileSummarizer.
+func (s *fsMultiRepoStore) ImportFileSummaries(repo, commitID string, summaries []*graph.FileSummary) error {
+	subpath := s.fs.Join(s.RepoToPath(repo)...)
+	if err := rwvfs.MkdirAll(s.fs, subpath); err != nil {
+		return err
+	}
+	return s.openRepoStore(repo).(RepoFileSummarizer).ImportFileSummaries(commitID, summaries)
+}
+
+// FileSummaries implements MultiRepoFileSummarizer.
+func (s *fsMultiRepoStore) FileSummaries(repo, commitID string) ([]*graph.FileSummary, error) {
+	return s.openRepoStore(repo).(RepoFileSummarizer).FileSummaries(commitID)
+}
+
+var (
+	_ RepoFileSummarizer      = (*fsRepoStore)(nil)
+	_ MultiRepoFileSummarizer = (*fsMultiRepoStore)(nil)
+)
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestFSMultiRepoStore_FileSummaries(t *testing.T) {
+	s := NewFSMultiRepoStore(newTestFS(), nil).(MultiRepoFileSummarizer)
+
+	if _, err := s.FileSummaries("r", "c"); !os.IsNotExist(err) {
+		t.Fatalf("got error %v, want os.IsNotExist", err)
+	}
+
+	fs := []*graph.FileSummary{
+		{File: "a.go", Language: "go", SLOC: 10, DefCount: 3, TopLevelDefs: []string{"A", "B"}, UnitType: "t", Unit: "u"},
+		{File: "b.txt", UnitType: "t", Unit: "u"},
+	}
+	if err := s.ImportFileSummaries("r", "c", fs); err != nil {
+		t.Fatal(err)
+	}
+	fs2, err := s.FileSummaries("r", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fs2, fs) {
+		t.Errorf("got %+v, want %+v", fs2, fs)
+	}
+
+	if err := s.ImportFileSummaries("r", "c2", nil); err != nil {
+		t.Fatal(err)
+	}
+	if fs, err := s.FileSummaries("r", "c2"); err != nil || len(fs) != 0 {
+		t.Errorf("got %v (error %v) for commit with no files, want none", fs, err)
+	}
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"path"
@@ -682,6 +683,56 @@ func (f byDefQueryFilter) SelectDef(def *graph.Def) bool {
 	return strings.HasPrefix(strings.ToLower(def.Name), strings.ToLower(string(f)))
 }
 
+// ByDefFuzzyQueryFilter is implemented by filters that restrict
+// their selection to defs whose names fuzzily match the query (see
+// FuzzyMatch).
+type ByDefFuzzyQueryFilter interface {
+	ByDefFuzzyQuery() string
+}
+
+// ByDefFuzzyQuery returns a filter by fuzzy def query (see
+// FuzzyMatch). It panics if q is empty.
+func ByDefFuzzyQuery(q string) interface {
+	DefFilter
+	ByDefFuzzyQueryFilter
+} {
+	if q == "" {
+		panic("ByDefFuzzyQuery: empty")
+	}
+	return byDefFuzzyQueryFilter(q)
+}
+
+type byDefFuzzyQueryFilter string
+
+func (f byDefFuzzyQueryFilter) String() string          { return fmt.Sprintf("ByDefFuzzyQuery(%q)", string(f)) }
+func (f byDefFuzzyQueryFilter) ByDefFuzzyQuery() string { return string(f) }
+func (f byDefFuzzyQueryFilter) SelectDef(def *graph.Def) bool {
+	_, ok := FuzzyMatch(string(f), def.Name)
+	return ok
+}
+
+// ByMonikers returns a filter that selects defs that have any of the
+// given monikers (see graph.Def.Monikers). It panics if no monikers
+// are given.
+func ByMonikers(monikers ...string) DefFilter {
+	if len(monikers) == 0 {
+		panic("ByMonikers: no monikers")
+	}
+	return byMonikersFilter(monikers)
+}
+
+type byMonikersFilter []string
+
+func (f byMonikersFilter) String() string { return fmt.Sprintf("ByMonikers(%v)", []string(f)) }
+func (f byMonikersFilter) SelectDef(def *graph.Def) bool {
+	for _, m := range f {
+		if def.HasMoniker(m) {
+			return true
+		}
+	}
+	return false
+}
+
 // ByFilesFilter is implemented by filters that restrict their
 // selection to defs, refs, etc., that exist in any file in a set, or
 // source units that contain any of the files in the set.
@@ -816,6 +867,43 @@ func LimitRemaining(filters interface{}) (remaining int, moreOK bool) {
 	return 0, true
 }
 
+// WithContext returns a filter that selects everything and makes a
+// query that is passed it stop (and return ctx.Err()) when ctx is
+// done, before it reads the data of another repo, version, or source
+// unit. Remote stores (see NewGRPCStore) cancel their requests. A
+// query that is already reading a source unit's data finishes reading
+// it.
+//
+// It isn't a UnitFilter, because indexed stores use UnitFilters to
+// narrow the source units that a query reads.
+func WithContext(ctx context.Context) interface {
+	DefFilter
+	RefFilter
+	VersionFilter
+	RepoFilter
+} {
+	return contextFilter{ctx}
+}
+
+type contextFilter struct{ ctx context.Context }
+
+func (f contextFilter) String() string              { return "WithContext" }
+func (f contextFilter) SelectDef(*graph.Def) bool   { return true }
+func (f contextFilter) SelectRef(*graph.Ref) bool   { return true }
+func (f contextFilter) SelectVersion(*Version) bool { return true }
+func (f contextFilter) SelectRepo(string) bool      { return true }
+
+// filtersContext returns the context of the first WithContext filter
+// in filters, or context.Background() if there is none.
+func filtersContext(filters interface{}) context.Context {
+	for _, f := range storeFilters(filters) {
+		if f, ok := f.(contextFilter); ok {
+			return f.ctx
+		}
+	}
+	return context.Background()
+}
+
 // storeFilters converts from slice-of-filter-type (e.g., []DefFilter,
 // []UnitFilter) to []interface{}. It enables us to write generic
 // functions that operate on any type of filter list without having
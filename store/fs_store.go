@@ -36,6 +36,9 @@ type fsMultiRepoStore struct {
 	fs rwvfs.WalkableFileSystem
 	FSMultiRepoStoreConf
 	repoStores
+
+	preloadMu sync.Mutex
+	preloaded map[string]*fsRepoStore // repo -> store with preloaded commits
 }
 
 var _ MultiRepoStoreImporter = (*fsMultiRepoStore)(nil)
@@ -147,8 +150,18 @@ func (s *fsMultiRepoStore) Repos(f ...RepoFilter) ([]string, error) {
 }
 
 func (s *fsMultiRepoStore) openRepoStore(repo string) RepoStore {
+	s.preloadMu.Lock()
+	rs := s.preloaded[repo]
+	s.preloadMu.Unlock()
+	if rs != nil {
+		return rs
+	}
+	return s.newRepoStore(repo)
+}
+
+func (s *fsMultiRepoStore) newRepoStore(repo string) *fsRepoStore {
 	subpath := s.fs.Join(s.RepoToPath(repo)...)
-	return NewFSRepoStore(rwvfs.Sub(s.fs, subpath))
+	return NewFSRepoStore(subFS(s.fs, subpath)).(*fsRepoStore)
 }
 
 func (s *fsMultiRepoStore) openAllRepoStores() (map[string]RepoStore, error) {
@@ -168,7 +181,9 @@ var _ repoStoreOpener = (*fsMultiRepoStore)(nil)
 
 func (s *fsMultiRepoStore) Import(repo, commitID string, unit *unit.SourceUnit, data graph.Output) error {
 	if unit != nil {
-		cleanForImport(&data, repo, unit.Type, unit.Name)
+		if err := cleanForImport(&data, repo, unit.Type, unit.Name); err != nil {
+			return err
+		}
 	}
 	subpath := s.fs.Join(s.RepoToPath(repo)...)
 	if err := rwvfs.MkdirAll(s.fs, subpath); err != nil {
@@ -191,6 +206,9 @@ func (s *fsMultiRepoStore) String() string { return "fsMultiRepoStore" }
 type fsRepoStore struct {
 	fs rwvfs.FileSystem
 	treeStores
+
+	preloadMu sync.Mutex
+	preloaded map[string]*preloadedTreeStore // commit ID -> tree store
 }
 
 // SrclibStoreDir is the name of the directory under which a RepoStore's data is stored.
@@ -226,16 +244,22 @@ func (s *fsRepoStore) versionDirs() ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	dirs := make([]string, len(entries))
-	for i, e := range entries {
-		dirs[i] = e.Name()
+	dirs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		// Skip staged and replaced commits (see RepoStager).
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		dirs = append(dirs, e.Name())
 	}
 	return dirs, nil
 }
 
 func (s *fsRepoStore) Import(commitID string, unit *unit.SourceUnit, data graph.Output) error {
 	if unit != nil {
-		cleanForImport(&data, "", unit.Type, unit.Name)
+		if err := cleanForImport(&data, "", unit.Type, unit.Name); err != nil {
+			return err
+		}
 	}
 	ts := s.newTreeStore(commitID)
 	return ts.Import(unit, data)
@@ -261,6 +285,9 @@ func (s *fsRepoStore) newTreeStore(commitID string) TreeStoreImporter {
 }
 
 func (s *fsRepoStore) openTreeStore(commitID string) TreeStore {
+	if ts := s.preloadedTreeStore(commitID); ts != nil {
+		return ts
+	}
 	return s.newTreeStore(commitID)
 }
 
@@ -346,8 +373,10 @@ func (s *fsTreeStore) openUnitFile(filename string) (u *unit.SourceUnit, err err
 	}()
 
 	var unit unit.SourceUnit
-	_, err = Codec.NewDecoder(f).Decode(&unit)
-	return &unit, err
+	if _, err := Codec.NewDecoder(f).Decode(&unit); err != nil {
+		return nil, &CorruptError{Store: s.String(), File: filename, Err: err}
+	}
+	return &unit, nil
 }
 
 func (s *fsTreeStore) unitFilenames() ([]string, error) {
@@ -375,6 +404,9 @@ func (s *fsTreeStore) Import(u *unit.SourceUnit, data graph.Output) (err error)
 	if u == nil {
 		return rwvfs.MkdirAll(s.fs, ".")
 	}
+	if err := cleanForImport(&data, "", u.Type, u.Name); err != nil {
+		return err
+	}
 
 	unitFilename := s.unitFilename(u.Type, u.Name)
 	if err := rwvfs.MkdirAll(s.fs, path.Dir(unitFilename)); err != nil {
@@ -398,7 +430,6 @@ func (s *fsTreeStore) Import(u *unit.SourceUnit, data graph.Output) (err error)
 	if err := rwvfs.MkdirAll(s.fs, dir); err != nil {
 		return err
 	}
-	cleanForImport(&data, "", u.Type, u.Name)
 	return s.openUnitStore(unit.ID2{Type: u.Type, Name: u.Name}).(UnitStoreImporter).Import(data)
 }
 
@@ -445,6 +476,38 @@ type fsUnitStore struct {
 	fs rwvfs.FileSystem
 
 	label string // a human-readable label (included in String() output)
+
+	strsMu     sync.Mutex
+	strs       stringDict // the string dictionary (see stringDict)
+	strsLoaded bool       // whether strs has been read
+}
+
+// stringDict returns the unit's string dictionary, reading it if it
+// hasn't been read yet.
+func (s *fsUnitStore) stringDict() (stringDict, error) {
+	s.strsMu.Lock()
+	defer s.strsMu.Unlock()
+	if !s.strsLoaded {
+		strs, err := readStringDict(s.fs)
+		if err != nil {
+			return nil, &CorruptError{Store: s.String(), File: unitStringsFilename, Err: err}
+		}
+		s.strs, s.strsLoaded = strs, true
+	}
+	return s.strs, nil
+}
+
+// writeStringDict creates and writes the string dictionary for defs
+// and refs, and returns an encoder for writing them with it.
+func (s *fsUnitStore) writeStringDict(defs []*graph.Def, refs []*graph.Ref) (stringDictEncoder, error) {
+	strs := newStringDict(defs, refs)
+	if err := writeStringDict(s.fs, strs); err != nil {
+		return nil, err
+	}
+	s.strsMu.Lock()
+	s.strs, s.strsLoaded = strs, true
+	s.strsMu.Unlock()
+	return strs.encoder(), nil
 }
 
 const (
@@ -469,13 +532,20 @@ func (s *fsUnitStore) Defs(fs ...DefFilter) (defs []*graph.Def, err error) {
 		}
 	}()
 
+	strs, err := s.stringDict()
+	if err != nil {
+		return nil, err
+	}
 	dec := Codec.NewDecoder(f)
 	for {
 		def := &graph.Def{}
 		if _, err := dec.Decode(def); err == io.EOF {
 			break
 		} else if err != nil {
-			return nil, err
+			return nil, &CorruptError{Store: s.String(), File: unitDefsFilename, Err: err}
+		}
+		if err := strs.decodeDef(def); err != nil {
+			return nil, &CorruptError{Store: s.String(), File: unitDefsFilename, Err: err}
 		}
 		if DefFilters(fs).SelectDef(def) {
 			defs = append(defs, def)
@@ -508,6 +578,11 @@ func (s *fsUnitStore) defsAtOffsets(ofs byteOffsets, fs []DefFilter) (defs []*gr
 
 	ffs := DefFilters(fs)
 
+	strs, err := s.stringDict()
+	if err != nil {
+		return nil, err
+	}
+
 	p := parFetches(s.fs, fs)
 	if p == 0 {
 		return nil, nil
@@ -532,7 +607,10 @@ func (s *fsUnitStore) defsAtOffsets(ofs byteOffsets, fs []DefFilter) (defs []*gr
 			dec := Codec.NewDecoder(r)
 			var def graph.Def
 			if _, err := dec.Decode(&def); err != nil {
-				return err
+				return &CorruptError{Store: s.String(), File: unitDefsFilename, Err: err}
+			}
+			if err := strs.decodeDef(&def); err != nil {
+				return &CorruptError{Store: s.String(), File: unitDefsFilename, Err: err}
 			}
 			if ffs.SelectDef(&def) {
 				defsLock.Lock()
@@ -565,6 +643,10 @@ func (s *fsUnitStore) readDefs() (defs []*graph.Def, ofs byteOffsets, err error)
 		}
 	}()
 
+	strs, err := s.stringDict()
+	if err != nil {
+		return nil, nil, err
+	}
 	n := uint64(0)
 	dec := Codec.NewDecoder(f)
 	for {
@@ -573,7 +655,10 @@ func (s *fsUnitStore) readDefs() (defs []*graph.Def, ofs byteOffsets, err error)
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return nil, nil, err
+			return nil, nil, &CorruptError{Store: s.String(), File: unitDefsFilename, Err: err}
+		}
+		if err := strs.decodeDef(&def); err != nil {
+			return nil, nil, &CorruptError{Store: s.String(), File: unitDefsFilename, Err: err}
 		}
 
 		ofs = append(ofs, int64(n))
@@ -587,6 +672,24 @@ func (s *fsUnitStore) readDefs() (defs []*graph.Def, ofs byteOffsets, err error)
 
 func (s *fsUnitStore) Refs(fs ...RefFilter) (refs []*graph.Ref, err error) {
 	vlog.Printf("%s: reading refs with filters %v...", s, fs)
+	if cf, err := s.openRefColumns(); err != nil {
+		return nil, err
+	} else if cf != nil {
+		defer cf.Close()
+		err := s.readRefColumns(cf, func(blockRefs []*graph.Ref) {
+			for _, ref := range blockRefs {
+				if refFilters(fs).SelectRef(ref) {
+					refs = append(refs, ref)
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		vlog.Printf("%s: read %d refs with filters %v.", s, len(refs), fs)
+		return refs, nil
+	}
+
 	f, err := s.fs.Open(unitRefsFilename)
 	if err != nil {
 		return nil, err
@@ -598,13 +701,20 @@ func (s *fsUnitStore) Refs(fs ...RefFilter) (refs []*graph.Ref, err error) {
 		}
 	}()
 
+	strs, err := s.stringDict()
+	if err != nil {
+		return nil, err
+	}
 	dec := Codec.NewDecoder(f)
 	for {
 		var ref graph.Ref
 		if _, err := dec.Decode(&ref); err == io.EOF {
 			break
 		} else if err != nil {
-			return nil, err
+			return nil, &CorruptError{Store: s.String(), File: unitRefsFilename, Err: err}
+		}
+		if err := strs.decodeRef(&ref); err != nil {
+			return nil, &CorruptError{Store: s.String(), File: unitRefsFilename, Err: err}
 		}
 		if refFilters(fs).SelectRef(&ref) {
 			refs = append(refs, &ref)
@@ -618,6 +728,20 @@ func (s *fsUnitStore) Refs(fs ...RefFilter) (refs []*graph.Ref, err error) {
 // from the ref data file and returns them in arbitrary order.
 func (s *fsUnitStore) refsAtByteRanges(brs []byteRanges, fs []RefFilter) (refs []*graph.Ref, err error) {
 	vlog.Printf("%s: reading refs at %d byte ranges with filters %v...", s, len(brs), fs)
+	if cf, err := s.openRefColumns(); err != nil {
+		return nil, err
+	} else if cf != nil {
+		defer cf.Close()
+		ranges := make([]refRange, len(brs))
+		for i, br := range brs {
+			ranges[i] = refRange{br.start(), br.start()}
+			for _, n := range br[1:] {
+				ranges[i][1] += n
+			}
+		}
+		return s.refColumnsInRanges(cf, ranges, fs)
+	}
+
 	f, err := openFetcherOrOpen(s.fs, unitRefsFilename)
 	if err != nil {
 		return nil, err
@@ -631,6 +755,11 @@ func (s *fsUnitStore) refsAtByteRanges(brs []byteRanges, fs []RefFilter) (refs [
 
 	ffs := refFilters(fs)
 
+	strs, err := s.stringDict()
+	if err != nil {
+		return nil, err
+	}
+
 	p := parFetches(s.fs, fs)
 	if p == 0 {
 		return nil, nil
@@ -666,7 +795,10 @@ func (s *fsUnitStore) refsAtByteRanges(brs []byteRanges, fs []RefFilter) (refs [
 			for range br[1:] {
 				var ref graph.Ref
 				if _, err := dec.Decode(&ref); err != nil {
-					return err
+					return &CorruptError{Store: s.String(), File: unitRefsFilename, Err: err}
+				}
+				if err := strs.decodeRef(&ref); err != nil {
+					return &CorruptError{Store: s.String(), File: unitRefsFilename, Err: err}
 				}
 				if ffs.SelectRef(&ref) {
 					refsLock.Lock()
@@ -689,6 +821,17 @@ func (s *fsUnitStore) refsAtByteRanges(brs []byteRanges, fs []RefFilter) (refs [
 // from the ref data file and returns them in arbitrary order.
 func (s *fsUnitStore) refsAtOffsets(ofs byteOffsets, fs []RefFilter) (refs []*graph.Ref, err error) {
 	vlog.Printf("%s: reading refs at %d offsets with filters %v...", s, len(ofs), fs)
+	if cf, err := s.openRefColumns(); err != nil {
+		return nil, err
+	} else if cf != nil {
+		defer cf.Close()
+		ranges := make([]refRange, len(ofs))
+		for i, o := range ofs {
+			ranges[i] = refRange{o, o + 1}
+		}
+		return s.refColumnsInRanges(cf, ranges, fs)
+	}
+
 	f, err := openFetcherOrOpen(s.fs, unitRefsFilename)
 	if err != nil {
 		return nil, err
@@ -702,6 +845,11 @@ func (s *fsUnitStore) refsAtOffsets(ofs byteOffsets, fs []RefFilter) (refs []*gr
 
 	ffs := refFilters(fs)
 
+	strs, err := s.stringDict()
+	if err != nil {
+		return nil, err
+	}
+
 	p := parFetches(s.fs, fs)
 	if p == 0 {
 		return nil, nil
@@ -726,7 +874,10 @@ func (s *fsUnitStore) refsAtOffsets(ofs byteOffsets, fs []RefFilter) (refs []*gr
 			dec := Codec.NewDecoder(r)
 			var ref graph.Ref
 			if _, err := dec.Decode(&ref); err != nil {
-				return err
+				return &CorruptError{Store: s.String(), File: unitRefsFilename, Err: err}
+			}
+			if err := strs.decodeRef(&ref); err != nil {
+				return &CorruptError{Store: s.String(), File: unitRefsFilename, Err: err}
 			}
 			if ffs.SelectRef(&ref) {
 				refsLock.Lock()
@@ -794,10 +945,22 @@ func rangeReader(fs rwvfs.FileSystem, name string, f io.ReadSeeker, start, n int
 	return f, nil
 }
 
-// readDefs reads all defs from the def data file and returns them
-// along with their serialized byte offsets.
+// readRefs reads all refs from the ref data file and returns them
+// along with their positions in it.
 func (s *fsUnitStore) readRefs() (refs []*graph.Ref, fbrs fileByteRanges, ofs byteOffsets, err error) {
 	vlog.Println("fsUnitStore: reading all refs and byte ranges...")
+	if cf, err := s.openRefColumns(); err != nil {
+		return nil, nil, nil, err
+	} else if cf != nil {
+		defer cf.Close()
+		if err := s.readRefColumns(cf, func(blockRefs []*graph.Ref) { refs = append(refs, blockRefs...) }); err != nil {
+			return nil, nil, nil, err
+		}
+		fbrs, ofs = refColumnsPositions(refs)
+		vlog.Printf("%s: read %d refs and positions.", s, len(refs))
+		return refs, fbrs, ofs, nil
+	}
+
 	f, err := s.fs.Open(unitRefsFilename)
 	if err != nil {
 		return nil, nil, nil, err
@@ -809,6 +972,10 @@ func (s *fsUnitStore) readRefs() (refs []*graph.Ref, fbrs fileByteRanges, ofs by
 		}
 	}()
 
+	strs, err := s.stringDict()
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	o := int64(0)
 	dec := Codec.NewDecoder(f)
 	fbrs = fileByteRanges{}
@@ -819,7 +986,10 @@ func (s *fsUnitStore) readRefs() (refs []*graph.Ref, fbrs fileByteRanges, ofs by
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return nil, nil, nil, err
+			return nil, nil, nil, &CorruptError{Store: s.String(), File: unitRefsFilename, Err: err}
+		}
+		if err := strs.decodeRef(&ref); err != nil {
+			return nil, nil, nil, &CorruptError{Store: s.String(), File: unitRefsFilename, Err: err}
 		}
 
 		ofs = append(ofs, o)
@@ -850,20 +1020,27 @@ func (s *fsUnitStore) readRefs() (refs []*graph.Ref, fbrs fileByteRanges, ofs by
 }
 
 func (s *fsUnitStore) Import(data graph.Output) error {
-	cleanForImport(&data, "", "", "")
-	if _, err := s.writeDefs(data.Defs); err != nil {
+	if err := cleanForImport(&data, "", "", ""); err != nil {
 		return err
 	}
-	if _, _, err := s.writeRefs(data.Refs); err != nil {
+	strs, err := s.writeStringDict(data.Defs, data.Refs)
+	if err != nil {
+		return err
+	}
+	if _, err := s.writeDefs(data.Defs, strs); err != nil {
+		return err
+	}
+	if _, _, err := s.writeRefs(data.Refs, strs); err != nil {
 		return err
 	}
 	return nil
 }
 
-// writeDefs writes the def data file. It also tracks (in ofs) the
-// serialized byte offset where each def's serialized representation
-// begins (which is used during index construction).
-func (s *fsUnitStore) writeDefs(defs []*graph.Def) (ofs byteOffsets, err error) {
+// writeDefs writes the def data file, with strings encoded using
+// strs. It also tracks (in ofs) the serialized byte offset where each
+// def's serialized representation begins (which is used during index
+// construction).
+func (s *fsUnitStore) writeDefs(defs []*graph.Def, strs stringDictEncoder) (ofs byteOffsets, err error) {
 	vlog.Printf("%s: writing %d defs...", s, len(defs))
 	f, err := s.fs.Create(unitDefsFilename)
 	if err != nil {
@@ -882,7 +1059,7 @@ func (s *fsUnitStore) writeDefs(defs []*graph.Def) (ofs byteOffsets, err error)
 	var o uint64 // number of bytes read
 	for i, def := range defs {
 		ofs[i] = int64(o)
-		n, err := enc.Encode(def)
+		n, err := enc.Encode(strs.def(def))
 		if err != nil {
 			return nil, err
 		}
@@ -895,10 +1072,12 @@ func (s *fsUnitStore) writeDefs(defs []*graph.Def) (ofs byteOffsets, err error)
 	return ofs, nil
 }
 
-// writeDefs writes the ref data file.
-func (s *fsUnitStore) writeRefs(refs []*graph.Ref) (fbr fileByteRanges, ofs byteOffsets, err error) {
+// writeRefs writes the columnar ref data file (see
+// writeRefColumns), with strings encoded using strs. It returns the
+// refs' positions in it, for building indexes.
+func (s *fsUnitStore) writeRefs(refs []*graph.Ref, strs stringDictEncoder) (fbr fileByteRanges, ofs byteOffsets, err error) {
 	vlog.Printf("%s: writing %d refs...", s, len(refs))
-	f, err := s.fs.Create(unitRefsFilename)
+	f, err := s.fs.Create(unitRefColumnsFilename)
 	if err != nil {
 		return nil, ofs, err
 	}
@@ -909,48 +1088,33 @@ func (s *fsUnitStore) writeRefs(refs []*graph.Ref) (fbr fileByteRanges, ofs byte
 		}
 	}()
 
-	// Sort refs by file and start byte so that we can use streaming
-	// reads to efficiently read in all of the refs that exist in a
-	// file.
+	// Sort refs by file and start byte so that all of the refs in a
+	// file are stored together (and can be read together).
 	t0 := time.Now()
 	sort.Sort(refsByFileStartEnd(refs))
 	if d := time.Since(t0); d > time.Millisecond*200 {
 		vlog.Printf("%s: sorting %d refs took %s.", s, len(refs), d)
 	}
 
-	bw := bufio.NewWriter(f)
-	enc := Codec.NewEncoder(bw)
-	var o uint64
-	fbr = fileByteRanges{}
-	ofs = make(byteOffsets, len(refs))
-	lastFile := ""
-	lastFileByteRanges := byteRanges{}
+	encoded := make([]*graph.Ref, len(refs))
 	for i, ref := range refs {
-		ofs[i] = int64(o)
-
-		if lastFile != ref.File {
-			if lastFile != "" {
-				fbr[lastFile] = lastFileByteRanges
-			}
-			lastFile = ref.File
-			lastFileByteRanges = byteRanges{int64(o)}
-		}
-		before := o
-		n, err := enc.Encode(ref)
-		if err != nil {
-			return nil, ofs, err
-		}
-		o += n
-
-		// Record the byte length of this encoded ref.
-		lastFileByteRanges = append(lastFileByteRanges, int64(o-before))
+		encoded[i] = strs.ref(ref)
 	}
-	if lastFile != "" {
-		fbr[lastFile] = lastFileByteRanges
+	bw := bufio.NewWriter(f)
+	if err := writeRefColumns(bw, encoded); err != nil {
+		return nil, ofs, err
 	}
 	if err := bw.Flush(); err != nil {
 		return nil, ofs, err
 	}
+
+	// Remove the per-record ref data file written by older versions
+	// of src, which would otherwise be stale.
+	if err := s.fs.Remove(unitRefsFilename); err != nil && !isOSOrVFSNotExist(err) {
+		return nil, ofs, err
+	}
+
+	fbr, ofs = refColumnsPositions(refs)
 	vlog.Printf("%s: done writing %d refs.", s, len(refs))
 	return fbr, ofs, nil
 }
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// maxFuzzInputSize is the size of the largest input that fuzzImport
+// accepts (to bound its memory usage).
+const maxFuzzInputSize = 1 << 20
+
+// maxFuzzQueries is the maximum number of queries of each kind that
+// fuzzImport runs against the imported data.
+const maxFuzzQueries = 10
+
+// fuzzImport imports data (as graph output for a single source unit)
+// into an in-memory indexed RepoStore and queries it using the
+// indexes. Import must not panic, and if it succeeds, Index and the
+// queries must succeed. It returns 1 if data was imported (which
+// go-fuzz should prioritize when mutating inputs) and 0 otherwise.
+func fuzzImport(data []byte) int {
+	if len(data) > maxFuzzInputSize {
+		return 0
+	}
+	var o graph.Output
+	if err := json.Unmarshal(data, &o); err != nil {
+		return 0
+	}
+
+	useIndexedStore = true
+	rs := NewFSRepoStore(rwvfs.Walkable(rwvfs.Sub(rwvfs.Map(map[string]string{}), "/fuzz")))
+	u := &unit.SourceUnit{Type: "t", Name: "u"}
+	for _, def := range o.Defs {
+		if def != nil && def.File != "" {
+			u.Files = append(u.Files, def.File)
+		}
+	}
+	numDefs, numRefs := len(o.Defs), len(o.Refs)
+	if err := rs.Import("c", u, o); err != nil {
+		return 0
+	}
+	if err := rs.(RepoIndexer).Index("c"); err != nil {
+		panic(fmt.Sprintf("Index after successful Import: %s", err))
+	}
+
+	check := func(label string, err error) {
+		if err != nil {
+			panic(fmt.Sprintf("%s: %s", label, err))
+		}
+	}
+	defs, err := rs.Defs()
+	check("Defs", err)
+	if len(defs) != numDefs {
+		panic(fmt.Sprintf("imported %d defs, but Defs returned %d", numDefs, len(defs)))
+	}
+	refs, err := rs.Refs()
+	check("Refs", err)
+	if len(refs) != numRefs {
+		panic(fmt.Sprintf("imported %d refs, but Refs returned %d", numRefs, len(refs)))
+	}
+	_, err = rs.Units()
+	check("Units", err)
+
+	for i, def := range defs {
+		if i == maxFuzzQueries {
+			break
+		}
+		if def.Path != "" {
+			_, err := rs.Defs(ByDefPath(def.Path))
+			check("Defs(ByDefPath)", err)
+		}
+		if def.Name != "" {
+			_, err := rs.Defs(ByDefQuery(def.Name))
+			check("Defs(ByDefQuery)", err)
+			_, err = rs.Defs(ByDefFuzzyQuery(def.Name))
+			check("Defs(ByDefFuzzyQuery)", err)
+		}
+		if def.File != "" && def.File == path.Clean(def.File) {
+			_, err := rs.Defs(ByFiles(def.File))
+			check("Defs(ByFiles)", err)
+		}
+	}
+	for i, ref := range refs {
+		if i == maxFuzzQueries {
+			break
+		}
+		if ref.DefPath != "" {
+			_, err := rs.Refs(ByRefDef(ref.RefDefKey()))
+			check("Refs(ByRefDef)", err)
+		}
+		if ref.File != "" && ref.File == path.Clean(ref.File) {
+			_, err := rs.Refs(ByFiles(ref.File))
+			check("Refs(ByFiles)", err)
+		}
+	}
+	return 1
+}
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// TestFuzzCorpus runs the fuzz corpus (see Fuzz) through fuzzImport,
+// which panics on failure.
+func TestFuzzCorpus(t *testing.T) {
+	files, err := filepath.Glob("testdata/fuzz/corpus/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no fuzz corpus files")
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fuzzImport(data)
+	}
+}
+
+func TestFSRepoStore_Import_null(t *testing.T) {
+	useIndexedStore = true
+	rs := NewFSRepoStore(newTestFS())
+	u := &unit.SourceUnit{Type: "t", Name: "u"}
+	tests := map[string]graph.Output{
+		"null def": {Defs: []*graph.Def{nil}},
+		"null ref": {Refs: []*graph.Ref{{DefPath: "a"}, nil}},
+		"null doc": {Docs: []*graph.Doc{nil}},
+	}
+	for label, data := range tests {
+		if err := rs.Import("c", u, data); err == nil {
+			t.Errorf("%s: got no error", label)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package store
+
+import "unicode"
+
+// Scores used by FuzzyMatch.
+const (
+	fuzzyMatchScore       = 1  // each matched char
+	fuzzyBoundaryBonus    = 6  // matched char starts a word (see isWordStart)
+	fuzzyConsecutiveBonus = 6  // matched char follows the previous matched char
+	fuzzyFirstCharBonus   = 2  // matched char is the name's first char
+	fuzzyGapPenalty       = 2  // each unmatched char before or between matched chars
+	fuzzyMaxGapPenalty    = 10 // max penalty for a single gap
+)
+
+// FuzzyMatch reports whether query is a case-insensitive subsequence
+// of name (as in editors' "go to symbol" pickers) and, if so, returns a
+// score for the match (higher is better). Matches on word starts in
+// name score higher, where a word starts after a separator (such as
+// '_' or '.') or at a camelCase hump. For example, "HtpSrv" and
+// "hs" both match "HTTPServer", and "hs" matches it better than it
+// matches "hashes".
+func FuzzyMatch(query, name string) (score int, ok bool) {
+	q := []rune(query)
+	if len(q) == 0 {
+		return 0, true
+	}
+	n := []rune(name)
+	if len(q) > len(n) || !isSubsequence(q, n) {
+		return 0, false
+	}
+
+	// best[j] is the best score of matching q[:i+1] with q[i]
+	// matched at n[j] (or noMatch if there is no such match).
+	const noMatch = -1 << 31
+	best := make([]int, len(n))
+	prev := make([]int, len(n))
+	for i := range q {
+		for j := range n {
+			best[j] = noMatch
+			if !runeEqualFold(q[i], n[j]) {
+				continue
+			}
+			s := fuzzyMatchScore
+			if isWordStart(n, j) {
+				s += fuzzyBoundaryBonus
+			}
+			if j == 0 {
+				s += fuzzyFirstCharBonus
+			}
+			if i == 0 {
+				best[j] = s - gapPenalty(j)
+				continue
+			}
+			for k := i - 1; k < j; k++ {
+				if prev[k] == noMatch {
+					continue
+				}
+				t := prev[k] + s
+				if k == j-1 {
+					t += fuzzyConsecutiveBonus
+				} else {
+					t -= gapPenalty(j - k - 1)
+				}
+				if t > best[j] {
+					best[j] = t
+				}
+			}
+		}
+		best, prev = prev, best
+	}
+
+	score = noMatch
+	for _, s := range prev {
+		if s > score {
+			score = s
+		}
+	}
+	return score, score != noMatch
+}
+
+func gapPenalty(gap int) int { return min(gap*fuzzyGapPenalty, fuzzyMaxGapPenalty) }
+
+func isSubsequence(q, n []rune) bool {
+	i := 0
+	for _, c := range n {
+		if i < len(q) && runeEqualFold(q[i], c) {
+			i++
+		}
+	}
+	return i == len(q)
+}
+
+func runeEqualFold(a, b rune) bool {
+	return a == b || unicode.ToLower(a) == unicode.ToLower(b)
+}
+
+// isWordStart returns whether n[j] starts a word: it is the first
+// char, follows a non-alphanumeric char, is an uppercase char after a
+// lowercase char or digit ("fooBar"), or is the last uppercase char of
+// an acronym that is followed by a lowercase char ("HTTPServer").
+func isWordStart(n []rune, j int) bool {
+	if j == 0 {
+		return true
+	}
+	c, p := n[j], n[j-1]
+	switch {
+	case !isAlnum(p):
+		return isAlnum(c)
+	case unicode.IsUpper(c) && !unicode.IsUpper(p):
+		return true
+	case unicode.IsUpper(c) && unicode.IsUpper(p) && j+1 < len(n) && unicode.IsLower(n[j+1]):
+		return true
+	case unicode.IsDigit(c) && !unicode.IsDigit(p):
+		return true
+	}
+	return false
+}
+
+func isAlnum(c rune) bool { return unicode.IsLetter(c) || unicode.IsDigit(c) }
@@ -0,0 +1,44 @@
+package store
+
+import "testing"
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		query, name string
+		want        bool
+	}{
+		{"", "a", true},
+		{"HtpSrv", "HTTPServer", true},
+		{"htpsrv", "HTTPServer", true},
+		{"hs", "HTTPServer", true},
+		{"nbr", "newBufferedReader", true},
+		{"fb", "foo_bar", true},
+		{"sv", "HTTPServer", true},
+		{"srvh", "HTTPServer", false},
+		{"abcd", "abc", false},
+	}
+	for _, test := range tests {
+		if _, ok := FuzzyMatch(test.query, test.name); ok != test.want {
+			t.Errorf("FuzzyMatch(%q, %q): got match %v, want %v", test.query, test.name, ok, test.want)
+		}
+	}
+}
+
+func TestFuzzyMatch_score(t *testing.T) {
+	tests := []struct {
+		query, better, worse string
+	}{
+		{"hs", "HTTPServer", "hashes"},
+		{"fb", "foo_bar", "fabric"},
+		{"srv", "Server", "someRevolver"},
+		{"nbr", "newBufferedReader", "newbier"},
+		{"ab", "ab", "a_b"},
+	}
+	for _, test := range tests {
+		better, _ := FuzzyMatch(test.query, test.better)
+		worse, _ := FuzzyMatch(test.query, test.worse)
+		if better <= worse {
+			t.Errorf("query %q: got score %d for %q <= score %d for %q", test.query, better, test.better, worse, test.worse)
+		}
+	}
+}
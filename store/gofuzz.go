@@ -0,0 +1,12 @@
+//go:build gofuzz
+// +build gofuzz
+
+package store
+
+// Fuzz is the entry point for go-fuzz
+// (https://github.com/dvyukov/go-fuzz), which feeds it mutations of
+// the graph data in testdata/fuzz/corpus. To run it:
+//
+//	go-fuzz-build sourcegraph.com/sourcegraph/srclib/store
+//	go-fuzz -bin=store-fuzz.zip -workdir=testdata/fuzz
+func Fuzz(data []byte) int { return fuzzImport(data) }
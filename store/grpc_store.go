@@ -0,0 +1,157 @@
+package store
+
+import (
+	"fmt"
+	"io"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/store/storepb"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// NewGRPCStore returns a MultiRepoStore that answers def and ref
+// queries by calling a Query service (see storepb.QueryServer, which
+// `src serve --grpc` implements). Its other queries return
+// errNotSupported, so it is typically used as a member of a federated
+// store (see NewFederatedStore).
+//
+// The filters that the Query service's options can express (such as
+// ByRepos with one repo, ByUnits with one unit, ByDefPath, and
+// ByRefDef) are sent to the server, and all filters are applied to
+// the results. Results are limited by the server's max number of
+// results per query. Requests are canceled when the context of a
+// WithContext filter is done.
+func NewGRPCStore(c storepb.QueryClient, label string) MultiRepoStore {
+	return &grpcStore{c: c, label: label}
+}
+
+type grpcStore struct {
+	c     storepb.QueryClient
+	label string // e.g., the server's address
+}
+
+func (s *grpcStore) String() string { return fmt.Sprintf("grpcStore(%s)", s.label) }
+
+func (s *grpcStore) Repos(...RepoFilter) ([]string, error)           { return nil, errNotSupported }
+func (s *grpcStore) Versions(...VersionFilter) ([]*Version, error)   { return nil, errNotSupported }
+func (s *grpcStore) Units(...UnitFilter) ([]*unit.SourceUnit, error) { return nil, errNotSupported }
+
+func (s *grpcStore) Defs(fs ...DefFilter) ([]*graph.Def, error) {
+	var opt storepb.DefsOptions
+	for _, f := range fs {
+		opt.Repo, opt.CommitID = grpcRepoCommitID(f, opt.Repo, opt.CommitID)
+		opt.UnitType, opt.Unit = grpcUnit(f, opt.UnitType, opt.Unit)
+		opt.File = grpcFile(f, opt.File)
+		switch f := f.(type) {
+		case ByDefPathFilter:
+			opt.Path = f.ByDefPath()
+		case ByDefQueryFilter:
+			opt.Query = f.ByDefQuery()
+		case ByDefFuzzyQueryFilter:
+			opt.Query, opt.Fuzzy = f.ByDefFuzzyQuery(), true
+		case ByDefExprFilter:
+			opt.Where = f.ByDefExpr().String()
+		}
+	}
+
+	stream, err := s.c.Defs(filtersContext(fs), &opt)
+	if err != nil {
+		return nil, err
+	}
+	var defs []*graph.Def
+	for {
+		def, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if DefFilters(fs).SelectDef(def) {
+			defs = append(defs, def)
+		}
+	}
+	return defs, nil
+}
+
+func (s *grpcStore) Refs(fs ...RefFilter) ([]*graph.Ref, error) {
+	var opt storepb.RefsOptions
+	for _, f := range fs {
+		opt.Repo, opt.CommitID = grpcRepoCommitID(f, opt.Repo, opt.CommitID)
+		opt.UnitType, opt.Unit = grpcUnit(f, opt.UnitType, opt.Unit)
+		opt.File = grpcFile(f, opt.File)
+		if f, ok := f.(ByRefDefFilter); ok {
+			opt.Def = graph.RefDefKey{DefRepo: f.ByDefRepo(), DefUnitType: f.ByDefUnitType(), DefUnit: f.ByDefUnit(), DefPath: f.ByDefPath()}
+		}
+	}
+
+	stream, err := s.c.Refs(filtersContext(fs), &opt)
+	if err != nil {
+		return nil, err
+	}
+	var refs []*graph.Ref
+	for {
+		ref, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		// The server returns refs with all of their fields set, which
+		// are the values that the filters' implied fields refer to.
+		setImpliedRepo(fs, ref.Repo)
+		setImpliedCommitID(fs, ref.CommitID)
+		setImpliedUnit(fs, unit.ID2{Type: ref.UnitType, Name: ref.Unit})
+		if refFilters(fs).SelectRef(ref) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs, nil
+}
+
+// grpcRepoCommitID returns the Repo and CommitID query options that
+// express f (if it selects a single repo or version), or repo and
+// commitID otherwise.
+func grpcRepoCommitID(f interface{}, repo, commitID string) (string, string) {
+	if f, ok := f.(ByRepoCommitIDsFilter); ok {
+		if vs := f.ByRepoCommitIDs(); len(vs) == 1 {
+			return vs[0].Repo, vs[0].CommitID
+		}
+		return repo, commitID
+	}
+	if f, ok := f.(ByReposFilter); ok {
+		if repos := f.ByRepos(); len(repos) == 1 {
+			repo = repos[0]
+		}
+	}
+	if f, ok := f.(ByCommitIDsFilter); ok {
+		if commitIDs := f.ByCommitIDs(); len(commitIDs) == 1 {
+			commitID = commitIDs[0]
+		}
+	}
+	return repo, commitID
+}
+
+// grpcUnit returns the UnitType and Unit query options that express f
+// (if it selects a single source unit), or unitType and unit
+// otherwise.
+func grpcUnit(f interface{}, unitType, name string) (string, string) {
+	if f, ok := f.(ByUnitsFilter); ok {
+		if units := f.ByUnits(); len(units) == 1 {
+			return units[0].Type, units[0].Name
+		}
+	}
+	return unitType, name
+}
+
+// grpcFile returns the File query option that expresses f (if it
+// selects a single file or dir), or file otherwise.
+func grpcFile(f interface{}, file string) string {
+	if f, ok := f.(ByFilesFilter); ok {
+		if files := f.ByFiles(); len(files) == 1 {
+			return files[0]
+		}
+	}
+	return file
+}
+
+var _ MultiRepoStore = (*grpcStore)(nil)
@@ -0,0 +1,45 @@
+package store
+
+import (
+	"os"
+	"time"
+)
+
+// A RepoImportTimer is a RepoStore that can report when each commit
+// was imported, so that the freshness of a repository's data can be
+// checked.
+type RepoImportTimer interface {
+	// ImportTime returns the time when the commit's data was last
+	// imported (or re-imported). If the commit isn't in the store,
+	// an error satisfying os.IsNotExist is returned.
+	ImportTime(commitID string) (time.Time, error)
+}
+
+// A MultiRepoImportTimer is like a RepoImportTimer, but for a
+// repository in a MultiRepoStore.
+type MultiRepoImportTimer interface {
+	ImportTime(repo, commitID string) (time.Time, error)
+}
+
+// ImportTime implements RepoImportTimer. It is the mtime of the
+// commit's dir, which changes when the commit is (re-)imported.
+func (s *fsRepoStore) ImportTime(commitID string) (time.Time, error) {
+	fi, err := s.fs.Stat(commitID)
+	if err != nil {
+		if isOSOrVFSNotExist(err) {
+			return time.Time{}, &os.PathError{Op: "stat", Path: commitID, Err: os.ErrNotExist}
+		}
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// ImportTime implements MultiRepoImportTimer.
+func (s *fsMultiRepoStore) ImportTime(repo, commitID string) (time.Time, error) {
+	return s.openRepoStore(repo).(RepoImportTimer).ImportTime(commitID)
+}
+
+var (
+	_ RepoImportTimer      = (*fsRepoStore)(nil)
+	_ MultiRepoImportTimer = (*fsMultiRepoStore)(nil)
+)
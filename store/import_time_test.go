@@ -0,0 +1,37 @@
+package store
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestFSMultiRepoStore_ImportTime(t *testing.T) {
+	fs, cleanup := newTestOSRenameFS(t)
+	defer cleanup()
+	s := NewFSMultiRepoStore(fs, nil)
+	timer := s.(MultiRepoImportTimer)
+
+	if _, err := timer.ImportTime("r", "c"); !os.IsNotExist(err) {
+		t.Fatalf("got error %v, want os.IsNotExist", err)
+	}
+
+	start := time.Now().Add(-time.Second) // allow for coarse mtimes
+	if err := s.Import("r", "c", &unit.SourceUnit{Type: "t", Name: "u"}, graph.Output{}); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := timer.ImportTime("r", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported.Before(start) || imported.After(time.Now()) {
+		t.Errorf("got import time %s, want a time since %s", imported, start)
+	}
+
+	if _, err := timer.ImportTime("r", "c2"); !os.IsNotExist(err) {
+		t.Errorf("got error %v for other commit, want os.IsNotExist", err)
+	}
+}
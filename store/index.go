@@ -182,6 +182,10 @@ type fileByteRanges map[string]byteRanges
 // byteRanges' encodes the byte offsets of multiple objects. The first
 // element is the byte offset within a file. Subsequent elements are
 // the byte length of each object in the file.
+//
+// In a columnar ref data file, refs are addressed by position instead
+// of byte offset (see refColumnsPositions), so the first element is
+// the position of the first ref and the second is the number of refs.
 type byteRanges []int64
 
 // UnmarshalBinary implements encoding.BinaryUnmarshaler.
@@ -16,9 +16,11 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"sourcegraph.com/sourcegraph/rwvfs"
 	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/metrics"
 	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
@@ -132,6 +134,7 @@ func (s *indexedTreeStore) unitIDs(indexOnly bool, fs ...UnitFilter) ([]unit.ID2
 var maxIndividualFetches = 5
 
 func (s *indexedTreeStore) Units(fs ...UnitFilter) ([]*unit.SourceUnit, error) {
+	defer metrics.Since(queryDurationMetric, time.Now(), "query", "units")
 	// Attempt to use the index.
 	scopedUnits, err := s.unitIDs(true, fs...)
 	if err != nil && err != errNotIndexed {
@@ -156,6 +159,7 @@ func (s *indexedTreeStore) unitsUsingFullIndex(fs ...UnitFilter) ([]*unit.Source
 }
 
 func (s *indexedTreeStore) Defs(fs ...DefFilter) ([]*graph.Def, error) {
+	defer metrics.Since(queryDurationMetric, time.Now(), "query", "defs")
 	vlog.Printf("indexedTreeStore.Defs(%v)", fs)
 
 	// First, check if any defs indexes at the tree level cover this
@@ -212,6 +216,7 @@ func (s *indexedTreeStore) Defs(fs ...DefFilter) ([]*graph.Def, error) {
 }
 
 func (s *indexedTreeStore) Refs(fs ...RefFilter) ([]*graph.Ref, error) {
+	defer metrics.Since(queryDurationMetric, time.Now(), "query", "refs")
 	// We have File->Unit index (that tells us which source units
 	// include a given file). If there's a ByFiles RefFilter, then we
 	// can convert that filter into a ByUnits scope filter (which is
@@ -257,10 +262,10 @@ func (s *indexedTreeStore) Refs(fs ...RefFilter) ([]*graph.Ref, error) {
 }
 
 func (s *indexedTreeStore) Import(u *unit.SourceUnit, data graph.Output) error {
-	s.checkSourceUnitFiles(u, data)
 	if err := s.fsTreeStore.Import(u, data); err != nil {
 		return err
 	}
+	s.checkSourceUnitFiles(u, data)
 	return nil
 }
 
@@ -524,6 +529,7 @@ func newIndexedUnitStore(fs rwvfs.FileSystem, label string) UnitStoreImporter {
 			},
 			defToRefsIndexName: &defRefsIndex{},
 			defQueryIndexName:  &defQueryIndex{f: defQueryFilter},
+			defFuzzyIndexName:  &defFuzzyIndex{f: defQueryFilter},
 		},
 		fsUnitStore: &fsUnitStore{fs: fs, label: label},
 	}
@@ -532,6 +538,7 @@ func newIndexedUnitStore(fs rwvfs.FileSystem, label string) UnitStoreImporter {
 const (
 	defToRefsIndexName = "def_to_refs"
 	defQueryIndexName  = "def_query"
+	defFuzzyIndexName  = "def_fuzzy"
 	indexFilename      = "%s.idx"
 )
 
@@ -589,18 +596,25 @@ func (s *indexedUnitStore) Refs(fs ...RefFilter) ([]*graph.Ref, error) {
 // Import calls to the underlying fsUnitStore to write the def
 // and ref data files. It also builds and writes the indexes.
 func (s *indexedUnitStore) Import(data graph.Output) error {
-	cleanForImport(&data, "", "", "")
+	if err := cleanForImport(&data, "", "", ""); err != nil {
+		return err
+	}
+
+	strs, err := s.fsUnitStore.writeStringDict(data.Defs, data.Refs)
+	if err != nil {
+		return err
+	}
 
 	var defOfs, refOfs byteOffsets
 	var refFBRs fileByteRanges
 
 	par := parallel.NewRun(2)
 	par.Do(func() (err error) {
-		defOfs, err = s.fsUnitStore.writeDefs(data.Defs)
+		defOfs, err = s.fsUnitStore.writeDefs(data.Defs, strs)
 		return err
 	})
 	par.Do(func() (err error) {
-		refFBRs, refOfs, err = s.fsUnitStore.writeRefs(data.Refs)
+		refFBRs, refOfs, err = s.fsUnitStore.writeRefs(data.Refs, strs)
 		return err
 	})
 	if err := par.Wait(); err != nil {
@@ -790,11 +804,11 @@ func readIndex(fs rwvfs.FileSystem, name string, x persistedIndex) (err error) {
 
 	r, err := gzip.NewReader(f)
 	if err != nil {
-		return err
+		return &CorruptError{Store: fs.String(), File: fmt.Sprintf(indexFilename, name), Err: err}
 	}
 
 	if err := x.Read(r); err != nil {
-		return err
+		return &CorruptError{Store: fs.String(), File: fmt.Sprintf(indexFilename, name), Err: err}
 	}
 	if err := r.Close(); err != nil {
 		return err
@@ -66,7 +66,9 @@ func (s *memoryMultiRepoStore) Import(repo, commitID string, unit *unit.SourceUn
 		s.repos[repo] = newMemoryRepoStore()
 	}
 	if unit != nil {
-		cleanForImport(&data, repo, unit.Type, unit.Name)
+		if err := cleanForImport(&data, repo, unit.Type, unit.Name); err != nil {
+			return err
+		}
 	}
 	return s.repos[repo].Import(commitID, unit, data)
 }
@@ -112,7 +114,9 @@ func (s *memoryRepoStore) Import(commitID string, unit *unit.SourceUnit, data gr
 		s.trees[commitID] = newMemoryTreeStore()
 	}
 	if unit != nil {
-		cleanForImport(&data, "", unit.Type, unit.Name)
+		if err := cleanForImport(&data, "", unit.Type, unit.Name); err != nil {
+			return err
+		}
 	}
 	return s.trees[commitID].Import(unit, data)
 }
@@ -181,7 +185,9 @@ func (s *memoryTreeStore) Import(u *unit.SourceUnit, data graph.Output) error {
 		return nil
 	}
 
-	cleanForImport(&data, "", u.Type, u.Name)
+	if err := cleanForImport(&data, "", u.Type, u.Name); err != nil {
+		return err
+	}
 
 	s.units = append(s.units, u)
 	unitID := unit.ID2{Type: u.Type, Name: u.Name}
@@ -254,7 +260,9 @@ func (s *memoryUnitStore) Refs(f ...RefFilter) ([]*graph.Ref, error) {
 }
 
 func (s *memoryUnitStore) Import(data graph.Output) error {
-	cleanForImport(&data, "", "", "")
+	if err := cleanForImport(&data, "", "", ""); err != nil {
+		return err
+	}
 	s.data = &data
 	return nil
 }
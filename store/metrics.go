@@ -0,0 +1,11 @@
+package store
+
+import "sourcegraph.com/sourcegraph/srclib/metrics"
+
+// queryDurationMetric is the name of the metric that records the
+// durations of (indexed) tree store queries, labeled by query type.
+const queryDurationMetric = "srclib_store_query_duration_seconds"
+
+func init() {
+	metrics.Describe(queryDurationMetric, "Duration of tree store queries (units, defs, or refs), in seconds.")
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// LinkedDefs returns the defs in s that share a moniker (see
+// graph.Def.Monikers) with the def identified by def, excluding that
+// def itself. For example, the def of a Protocol Buffers message is
+// linked to the defs of the Go, Java, and Python code generated from
+// it. If def's DefRepo, DefUnitType, or DefUnit are empty, they match
+// any value.
+//
+// Monikers aren't indexed, so LinkedDefs reads all defs in s.
+func LinkedDefs(s UnitStore, def graph.RefDefKey) ([]*graph.Def, error) {
+	fs := []DefFilter{ByDefPath(def.DefPath)}
+	if def.DefRepo != "" {
+		fs = append(fs, ByRepos(def.DefRepo))
+	}
+	if def.DefUnitType != "" && def.DefUnit != "" {
+		fs = append(fs, ByUnits(unit.ID2{Type: def.DefUnitType, Name: def.DefUnit}))
+	}
+	defs, err := s.Defs(fs...)
+	if err != nil {
+		return nil, err
+	}
+
+	type defKey struct{ repo, unitType, unit, path string }
+	self := make(map[defKey]struct{}, len(defs))
+	var monikers []string
+	for _, d := range defs {
+		self[defKey{d.Repo, d.UnitType, d.Unit, d.Path}] = struct{}{}
+		monikers = append(monikers, d.Monikers...)
+	}
+	if len(monikers) == 0 {
+		return nil, nil
+	}
+
+	candidates, err := s.Defs(ByMonikers(monikers...))
+	if err != nil {
+		return nil, err
+	}
+	var linked []*graph.Def
+	for _, d := range candidates {
+		if _, isSelf := self[defKey{d.Repo, d.UnitType, d.Unit, d.Path}]; !isSelf {
+			linked = append(linked, d)
+		}
+	}
+	return linked, nil
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"sort"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestLinkedDefs(t *testing.T) {
+	const moniker = "proto:acme.Widget"
+	s := newMemoryMultiRepoStore()
+	imports := []struct {
+		repo string
+		unit *unit.SourceUnit
+		defs []*graph.Def
+	}{
+		{"r1", &unit.SourceUnit{Type: "ProtoPackage", Name: "acme"}, []*graph.Def{
+			{DefKey: graph.DefKey{Path: "Widget"}, Monikers: []string{moniker}},
+			{DefKey: graph.DefKey{Path: "Gadget"}, Monikers: []string{"proto:acme.Gadget"}},
+		}},
+		{"r1", &unit.SourceUnit{Type: "GoPackage", Name: "acme/acmepb"}, []*graph.Def{
+			{DefKey: graph.DefKey{Path: "Widget"}, Monikers: []string{moniker}},
+			{DefKey: graph.DefKey{Path: "Other"}},
+		}},
+		{"r2", &unit.SourceUnit{Type: "PipPackage", Name: "acme"}, []*graph.Def{
+			{DefKey: graph.DefKey{Path: "acme_pb2/Widget"}, Monikers: []string{moniker}},
+		}},
+	}
+	for _, imp := range imports {
+		if err := s.Import(imp.repo, "c", imp.unit, graph.Output{Defs: imp.defs}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	linked, err := LinkedDefs(s, graph.RefDefKey{DefRepo: "r1", DefUnitType: "ProtoPackage", DefUnit: "acme", DefPath: "Widget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range linked {
+		got = append(got, d.Repo+" "+d.UnitType+" "+d.Path)
+	}
+	sort.Strings(got)
+	want := []string{"r1 GoPackage Widget", "r2 PipPackage acme_pb2/Widget"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got linked defs %v, want %v", got, want)
+	}
+
+	linked, err = LinkedDefs(s, graph.RefDefKey{DefRepo: "r1", DefUnitType: "GoPackage", DefUnit: "acme/acmepb", DefPath: "Other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(linked) != 0 {
+		t.Errorf("got linked defs %v for def with no monikers, want none", linked)
+	}
+}
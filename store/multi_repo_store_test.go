@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
@@ -31,6 +32,7 @@ func testMultiRepoStore(t *testing.T, newFn func() MultiRepoStoreImporter) {
 	testMultiRepoStore_Def(t, newFn())
 	testMultiRepoStore_Defs(t, newFn())
 	testMultiRepoStore_Defs_filter(t, newFn())
+	testMultiRepoStore_WithContext(t, newFn())
 	testMultiRepoStore_Defs_ByRepos(t, newFn())
 	testMultiRepoStore_Defs_ByRepos_ByDefQuery(t, newFn())
 	testMultiRepoStore_Defs_ByRepoCommitIDs(t, newFn())
@@ -371,6 +373,36 @@ func testMultiRepoStore_Defs_filter(t *testing.T, mrs MultiRepoStoreImporter) {
 	}
 }
 
+func testMultiRepoStore_WithContext(t *testing.T, mrs MultiRepoStoreImporter) {
+	u := &unit.SourceUnit{Type: "t", Name: "u"}
+	if err := mrs.Import("r", "c", u, graph.Output{
+		Defs: []*graph.Def{{DefKey: graph.DefKey{Path: "p"}}},
+		Refs: []*graph.Ref{{DefPath: "p", File: "f"}},
+	}); err != nil {
+		t.Errorf("%s: Import: %s", mrs, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defs, err := mrs.Defs(WithContext(ctx))
+	if err != nil {
+		t.Errorf("%s: Defs(WithContext): %s", mrs, err)
+	}
+	if len(defs) != 1 {
+		t.Errorf("%s: Defs(WithContext): got %d defs, want 1", mrs, len(defs))
+	}
+
+	cancel()
+	if defs, err := mrs.Defs(WithContext(ctx)); err != context.Canceled {
+		t.Errorf("%s: Defs(WithContext) after cancel: got defs %v and error %v, want %v", mrs, defs, err, context.Canceled)
+	}
+	if refs, err := mrs.Refs(WithContext(ctx)); err != context.Canceled {
+		t.Errorf("%s: Refs(WithContext) after cancel: got refs %v and error %v, want %v", mrs, refs, err, context.Canceled)
+	}
+	if versions, err := mrs.Versions(WithContext(ctx)); err != context.Canceled {
+		t.Errorf("%s: Versions(WithContext) after cancel: got versions %v and error %v, want %v", mrs, versions, err, context.Canceled)
+	}
+}
+
 func testMultiRepoStore_Defs_ByRepos(t *testing.T, mrs MultiRepoStoreImporter) {
 	repos := []string{"r1", "r2", "r3"}
 	for _, repo := range repos {
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// A RepoPreloader is a RepoStore that can read a commit's tree-level
+// indexes (of def names and queries, files, source units, and refs'
+// source units) into memory ahead of time, so that queries of the
+// commit don't wait for them to be read from disk.
+type RepoPreloader interface {
+	// Preload reads the commit's indexes and keeps them in memory
+	// for later queries via this store. It returns the number of
+	// indexes read.
+	//
+	// If the commit is re-imported, its preloaded indexes are
+	// discarded (and read from disk again by each query, until the
+	// commit is preloaded again).
+	Preload(commitID string) (int, error)
+
+	// Unpreload discards the commit's preloaded indexes (if any), so
+	// that queries read them from disk.
+	Unpreload(commitID string)
+}
+
+// A MultiRepoPreloader is like a RepoPreloader, but for a repository
+// in a MultiRepoStore.
+type MultiRepoPreloader interface {
+	Preload(repo, commitID string) (int, error)
+	Unpreload(repo, commitID string)
+}
+
+// A preloadedTreeStore is a tree store whose indexes are in memory.
+type preloadedTreeStore struct {
+	*indexedTreeStore
+
+	// modTime is the commit dir's mtime when the tree store was
+	// loaded. It changes when the commit is re-imported.
+	modTime time.Time
+}
+
+// Preload implements RepoPreloader.
+func (s *fsRepoStore) Preload(commitID string) (int, error) {
+	fi, err := s.fs.Stat(commitID)
+	if err != nil {
+		return 0, err
+	}
+	ts, ok := s.newTreeStore(commitID).(*indexedTreeStore)
+	if !ok {
+		return 0, fmt.Errorf("%s: can't preload indexes of commit %s (indexes are disabled)", s, commitID)
+	}
+	var n int
+	for name, x := range ts.indexes {
+		if err := prepareIndex(ts.fs, name, x); err != nil {
+			if _, ok := err.(*errIndexNotExist); ok {
+				continue // queries fall back to full scans
+			}
+			return 0, err
+		}
+		n++
+	}
+
+	s.preloadMu.Lock()
+	defer s.preloadMu.Unlock()
+	if s.preloaded == nil {
+		s.preloaded = map[string]*preloadedTreeStore{}
+	}
+	s.preloaded[commitID] = &preloadedTreeStore{indexedTreeStore: ts, modTime: fi.ModTime()}
+	return n, nil
+}
+
+// Unpreload implements RepoPreloader.
+func (s *fsRepoStore) Unpreload(commitID string) {
+	s.preloadMu.Lock()
+	defer s.preloadMu.Unlock()
+	delete(s.preloaded, commitID)
+}
+
+// preloadedTreeStore returns the commit's preloaded tree store, or nil
+// if it wasn't preloaded (or was re-imported since).
+func (s *fsRepoStore) preloadedTreeStore(commitID string) TreeStore {
+	s.preloadMu.Lock()
+	p := s.preloaded[commitID]
+	s.preloadMu.Unlock()
+	if p == nil {
+		return nil
+	}
+	if fi, err := s.fs.Stat(commitID); err != nil || !fi.ModTime().Equal(p.modTime) {
+		s.preloadMu.Lock()
+		if s.preloaded[commitID] == p {
+			delete(s.preloaded, commitID)
+		}
+		s.preloadMu.Unlock()
+		return nil
+	}
+	return p.indexedTreeStore
+}
+
+// Preload implements MultiRepoPreloader.
+func (s *fsMultiRepoStore) Preload(repo, commitID string) (int, error) {
+	s.preloadMu.Lock()
+	rs := s.preloaded[repo]
+	if rs == nil {
+		if s.preloaded == nil {
+			s.preloaded = map[string]*fsRepoStore{}
+		}
+		rs = s.newRepoStore(repo)
+		s.preloaded[repo] = rs
+	}
+	s.preloadMu.Unlock()
+	return rs.Preload(commitID)
+}
+
+// Unpreload implements MultiRepoPreloader.
+func (s *fsMultiRepoStore) Unpreload(repo, commitID string) {
+	s.preloadMu.Lock()
+	rs := s.preloaded[repo]
+	s.preloadMu.Unlock()
+	if rs != nil {
+		rs.Unpreload(commitID)
+	}
+}
+
+var (
+	_ RepoPreloader      = (*fsRepoStore)(nil)
+	_ MultiRepoPreloader = (*fsMultiRepoStore)(nil)
+)
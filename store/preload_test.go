@@ -0,0 +1,78 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestFSRepoStore_Preload(t *testing.T) {
+	useIndexedStore = true
+	fs, cleanup := newTestOSRenameFS(t)
+	defer cleanup()
+	rs := NewFSRepoStore(fs).(*fsRepoStore)
+
+	importCommit := func(unitName string) {
+		stagingID, err := rs.Stage("c")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rs.Import(stagingID, &unit.SourceUnit{Type: "t", Name: unitName, Files: []string{"f"}}, graph.Output{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := rs.Index(stagingID); err != nil {
+			t.Fatal(err)
+		}
+		if err := rs.Publish(stagingID, "c"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkUnits := func(label string, want ...string) {
+		units, err := rs.Units(ByFiles("f"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, u := range units {
+			names = append(names, u.Name)
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("%s: got units %v, want %v", label, names, want)
+		}
+	}
+
+	importCommit("u1")
+	n, err := rs.Preload("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(newIndexedTreeStore(nil).(*indexedTreeStore).indexes); n != want {
+		t.Errorf("got %d indexes preloaded, want %d", n, want)
+	}
+	if rs.preloadedTreeStore("c") == nil {
+		t.Fatal("commit c was not preloaded")
+	}
+	checkUnits("preloaded", "u1")
+
+	// Re-importing the commit discards its preloaded indexes.
+	importCommit("u2")
+	if rs.preloadedTreeStore("c") != nil {
+		t.Error("preloaded indexes of re-imported commit c were not discarded")
+	}
+	checkUnits("re-imported", "u2")
+
+	if _, err := rs.Preload("c"); err != nil {
+		t.Fatal(err)
+	}
+	rs.Unpreload("c")
+	if rs.preloadedTreeStore("c") != nil {
+		t.Error("indexes of commit c were not discarded by Unpreload")
+	}
+	checkUnits("unpreloaded", "u2")
+
+	if _, err := rs.Preload("nonexistent"); err == nil {
+		t.Error("Preload(nonexistent): got no error")
+	}
+}
@@ -0,0 +1,138 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// A RepoProvenancer stores a provenance manifest (see Provenance) for
+// each commit of a repository.
+type RepoProvenancer interface {
+	// ImportProvenance stores p as the provenance manifest for the
+	// commit, replacing any existing manifest.
+	ImportProvenance(commitID string, p *Provenance) error
+
+	// Provenance returns the provenance manifest for the commit. If
+	// there is none (e.g., because the commit's data was imported by
+	// an older version of src), an error satisfying os.IsNotExist is
+	// returned.
+	Provenance(commitID string) (*Provenance, error)
+}
+
+// A MultiRepoProvenancer stores a provenance manifest (see
+// Provenance) for each commit of each repository.
+type MultiRepoProvenancer interface {
+	ImportProvenance(repo, commitID string, p *Provenance) error
+	Provenance(repo, commitID string) (*Provenance, error)
+}
+
+// provenanceFilename is the name of the file (in a commit's tree
+// store dir) that holds the commit's provenance manifest.
+const provenanceFilename = "provenance.json"
+
+// A Provenance manifest records the environment that a commit's data
+// was built and imported in, so that the data can be audited and the
+// build reproduced later.
+type Provenance struct {
+	Repo     string `json:",omitempty"`
+	CommitID string `json:",omitempty"`
+
+	// Build describes the `src make` run that produced the build
+	// data. It is nil if the build data has no provenance (e.g.,
+	// because it was produced by an older version of src).
+	Build *ProcessProvenance `json:",omitempty"`
+
+	// Import describes the `src store import` run that imported the
+	// build data.
+	Import *ProcessProvenance `json:",omitempty"`
+
+	// Toolchains are the toolchains that the build used, sorted by
+	// path.
+	Toolchains []*ToolchainProvenance `json:",omitempty"`
+}
+
+// A ProcessProvenance describes a src process (and the environment it
+// ran in).
+type ProcessProvenance struct {
+	SrcVersion string    // version of src
+	GoVersion  string    // Go version that src was built with
+	OS         string    // operating system (GOOS)
+	Arch       string    // architecture (GOARCH)
+	Args       []string  // command-line arguments (excluding the program name)
+	Time       time.Time // time that the process finished
+}
+
+// A ToolchainProvenance describes a toolchain that a build used.
+type ToolchainProvenance struct {
+	Path string // toolchain path (e.g., "sourcegraph.com/sourcegraph/srclib-go")
+
+	// Version is the toolchain's version (a hash of its config file,
+	// program, and Dockerfile; see toolchain.(*Info).Version).
+	Version string `json:",omitempty"`
+
+	// Commit is the commit ID of the toolchain's git repository, if
+	// it is in one.
+	Commit string `json:",omitempty"`
+
+	// Tools are the subcommands of the toolchain's tools that the
+	// build used, sorted.
+	Tools []string `json:",omitempty"`
+}
+
+// ImportProvenance implements RepoProvenancer.
+func (s *fsRepoStore) ImportProvenance(commitID string, p *Provenance) error {
+	fs := s.treeStoreFS(commitID)
+	if err := rwvfs.MkdirAll(fs, "."); err != nil {
+		return err
+	}
+	f, err := fs.Create(provenanceFilename)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(p); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Provenance implements RepoProvenancer.
+func (s *fsRepoStore) Provenance(commitID string) (*Provenance, error) {
+	f, err := s.treeStoreFS(commitID).Open(provenanceFilename)
+	if err != nil {
+		if isOSOrVFSNotExist(err) {
+			return nil, &os.PathError{Op: "open", Path: provenanceFilename, Err: os.ErrNotExist}
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var p Provenance
+	if err := json.NewDecoder(f).Decode(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ImportProvenance implements MultiRepoProvenancer.
+func (s *fsMultiRepoStore) ImportProvenance(repo, commitID string, p *Provenance) error {
+	subpath := s.fs.Join(s.RepoToPath(repo)...)
+	if err := rwvfs.MkdirAll(s.fs, subpath); err != nil {
+		return err
+	}
+	return s.openRepoStore(repo).(RepoProvenancer).ImportProvenance(commitID, p)
+}
+
+// Provenance implements MultiRepoProvenancer.
+func (s *fsMultiRepoStore) Provenance(repo, commitID string) (*Provenance, error) {
+	return s.openRepoStore(repo).(RepoProvenancer).Provenance(commitID)
+}
+
+var (
+	_ RepoProvenancer      = (*fsRepoStore)(nil)
+	_ MultiRepoProvenancer = (*fsMultiRepoStore)(nil)
+)
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFSMultiRepoStore_Provenance(t *testing.T) {
+	s := NewFSMultiRepoStore(newTestFS(), nil).(MultiRepoProvenancer)
+
+	if _, err := s.Provenance("r", "c"); !os.IsNotExist(err) {
+		t.Fatalf("got error %v, want os.IsNotExist", err)
+	}
+
+	p := &Provenance{
+		Repo:     "r",
+		CommitID: "c",
+		Build: &ProcessProvenance{
+			SrcVersion: "0.1",
+			GoVersion:  "go1.x",
+			OS:         "linux",
+			Arch:       "amd64",
+			Args:       []string{"make", "--no-cache-write"},
+			Time:       time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		Toolchains: []*ToolchainProvenance{{Path: "example.com/tc", Version: "v", Commit: "abc", Tools: []string{"graph"}}},
+	}
+	if err := s.ImportProvenance("r", "c", p); err != nil {
+		t.Fatal(err)
+	}
+	p2, err := s.Provenance("r", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p2, p) {
+		t.Errorf("got %+v, want %+v", p2, p)
+	}
+
+	if _, err := s.Provenance("r", "c2"); !os.IsNotExist(err) {
+		t.Errorf("got error %v for other commit, want os.IsNotExist", err)
+	}
+}
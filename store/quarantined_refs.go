@@ -0,0 +1,92 @@
+package store
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// A RepoRefQuarantiner stores the refs that were quarantined (kept
+// out of the imported graph data because they refer to nonexistent
+// defs; see "src store import --quarantine-dangling-refs") when each
+// commit of a repository was imported.
+type RepoRefQuarantiner interface {
+	// ImportQuarantinedRefs stores the refs read from r (a JSON
+	// array) as the commit's quarantined refs, replacing any
+	// existing quarantined refs. The refs are copied as they are
+	// read, so that they needn't all be in memory at once.
+	ImportQuarantinedRefs(commitID string, r io.Reader) error
+
+	// QuarantinedRefs returns the commit's quarantined refs. If the
+	// commit has none recorded (e.g., because it was imported
+	// without quarantining), an error satisfying os.IsNotExist is
+	// returned.
+	QuarantinedRefs(commitID string) ([]*graph.Ref, error)
+}
+
+// A MultiRepoRefQuarantiner stores the refs that were quarantined
+// when each commit of each repository was imported.
+type MultiRepoRefQuarantiner interface {
+	ImportQuarantinedRefs(repo, commitID string, r io.Reader) error
+	QuarantinedRefs(repo, commitID string) ([]*graph.Ref, error)
+}
+
+// quarantinedRefsFilename is the name of the file (in a commit's tree
+// store dir) that holds the commit's quarantined refs.
+const quarantinedRefsFilename = "quarantined_refs.json"
+
+// ImportQuarantinedRefs implements RepoRefQuarantiner.
+func (s *fsRepoStore) ImportQuarantinedRefs(commitID string, r io.Reader) error {
+	fs := s.treeStoreFS(commitID)
+	if err := rwvfs.MkdirAll(fs, "."); err != nil {
+		return err
+	}
+	f, err := fs.Create(quarantinedRefsFilename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// QuarantinedRefs implements RepoRefQuarantiner.
+func (s *fsRepoStore) QuarantinedRefs(commitID string) ([]*graph.Ref, error) {
+	f, err := s.treeStoreFS(commitID).Open(quarantinedRefsFilename)
+	if err != nil {
+		if isOSOrVFSNotExist(err) {
+			return nil, &os.PathError{Op: "open", Path: quarantinedRefsFilename, Err: os.ErrNotExist}
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var refs []*graph.Ref
+	if err := json.NewDecoder(f).Decode(&refs); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// ImportQuarantinedRefs implements MultiRepoRefQuarantiner.
+func (s *fsMultiRepoStore) ImportQuarantinedRefs(repo, commitID string, r io.Reader) error {
+	subpath := s.fs.Join(s.RepoToPath(repo)...)
+	if err := rwvfs.MkdirAll(s.fs, subpath); err != nil {
+		return err
+	}
+	return s.openRepoStore(repo).(RepoRefQuarantiner).ImportQuarantinedRefs(commitID, r)
+}
+
+// QuarantinedRefs implements MultiRepoRefQuarantiner.
+func (s *fsMultiRepoStore) QuarantinedRefs(repo, commitID string) ([]*graph.Ref, error) {
+	return s.openRepoStore(repo).(RepoRefQuarantiner).QuarantinedRefs(commitID)
+}
+
+var (
+	_ RepoRefQuarantiner      = (*fsRepoStore)(nil)
+	_ MultiRepoRefQuarantiner = (*fsMultiRepoStore)(nil)
+)
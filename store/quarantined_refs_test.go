@@ -0,0 +1,43 @@
+package store
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestFSMultiRepoStore_QuarantinedRefs(t *testing.T) {
+	s := NewFSMultiRepoStore(newTestFS(), nil).(MultiRepoRefQuarantiner)
+
+	if _, err := s.QuarantinedRefs("r", "c"); !os.IsNotExist(err) {
+		t.Fatalf("got error %v, want os.IsNotExist", err)
+	}
+
+	const data = `[{"DefRepo":"r","DefUnitType":"t","DefUnit":"u","DefPath":"p","Repo":"r","CommitID":"c","UnitType":"t","Unit":"u","File":"f","Start":1,"End":2}]`
+	if err := s.ImportQuarantinedRefs("r", "c", strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	refs, err := s.QuarantinedRefs("r", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*graph.Ref{{DefRepo: "r", DefUnitType: "t", DefUnit: "u", DefPath: "p", Repo: "r", CommitID: "c", UnitType: "t", Unit: "u", File: "f", Start: 1, End: 2}}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("got %+v, want %+v", refs, want)
+	}
+
+	// A commit with no quarantined refs is distinguished from one
+	// that was imported without quarantining.
+	if err := s.ImportQuarantinedRefs("r", "c2", strings.NewReader("[]\n")); err != nil {
+		t.Fatal(err)
+	}
+	if refs, err := s.QuarantinedRefs("r", "c2"); err != nil || len(refs) != 0 {
+		t.Errorf("got %v (error %v) for commit with no quarantined refs, want none", refs, err)
+	}
+	if _, err := s.QuarantinedRefs("r", "c3"); !os.IsNotExist(err) {
+		t.Errorf("got error %v for other commit, want os.IsNotExist", err)
+	}
+}
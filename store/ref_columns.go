@@ -0,0 +1,585 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	"code.google.com/p/rog-go/parallel"
+	"github.com/gogo/protobuf/proto"
+	"golang.org/x/tools/godoc/vfs"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// unitRefColumnsFilename is the name of the file (in a unit store's
+// dir) that holds the unit's refs in a columnar format (see
+// writeRefColumns). Unit stores written by older versions of src have
+// a ref data file with one record per ref (unitRefsFilename) instead.
+const unitRefColumnsFilename = "ref.col"
+
+// refColumnsMagic begins a columnar ref data file.
+const refColumnsMagic = "srcrefs\x02"
+
+// refColumnsMagicV1 begins a columnar ref data file written by an
+// older version of src, whose blocks have no Confidence column.
+const refColumnsMagicV1 = "srcrefs\x01"
+
+// refColumnsBlockSize is the number of refs in each block of a
+// columnar ref data file. Reading any ref in a block requires decoding
+// the whole block.
+const refColumnsBlockSize = 1024
+
+// maxRefColumnsBlockSize is the largest block size that is read (to
+// avoid huge allocations when reading corrupt data).
+const maxRefColumnsBlockSize = 1 << 16
+
+// refStringColumns returns pointers to ref's string fields, in the
+// order that their columns are stored.
+func refStringColumns(ref *graph.Ref) [10]*string {
+	return [...]*string{&ref.DefRepo, &ref.DefUnitType, &ref.DefUnit, &ref.DefPath, &ref.Repo, &ref.CommitID, &ref.UnitType, &ref.Unit, &ref.File, &ref.EnclosingDef}
+}
+
+// writeRefColumns writes refs (which must be sorted by file and start
+// offset) to w in the columnar format. Refs are stored in blocks of
+// refColumnsBlockSize, and each block stores each field of its refs
+// together: string fields as run-length encoded indexes into a table
+// of the block's distinct values, Start as deltas from the previous
+// ref's Start, and End as the difference from Start. Because refs are
+// sorted, runs are long and deltas are small, so the file is much
+// smaller than one that stores each ref separately. Confidence is
+// run-length encoded too, since most refs have none.
+//
+// The file begins with a header that lists the byte length of each
+// block, so that the refs in a range of positions (such as a file's
+// refs) can be read without reading the blocks before them.
+func writeRefColumns(w io.Writer, refs []*graph.Ref) error {
+	var blocks [][]byte
+	for i := 0; i < len(refs); i += refColumnsBlockSize {
+		end := i + refColumnsBlockSize
+		if end > len(refs) {
+			end = len(refs)
+		}
+		blocks = append(blocks, encodeRefBlock(refs[i:end]))
+	}
+
+	var hdr colWriter
+	hdr.buf = append(hdr.buf, refColumnsMagic...)
+	hdr.uvarint(uint64(len(refs)))
+	hdr.uvarint(refColumnsBlockSize)
+	hdr.uvarint(uint64(len(blocks)))
+	for _, b := range blocks {
+		hdr.uvarint(uint64(len(b)))
+	}
+	if _, err := w.Write(hdr.buf); err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeRefBlock encodes a block of refs (see writeRefColumns).
+func encodeRefBlock(refs []*graph.Ref) []byte {
+	var w colWriter
+	for col := range refStringColumns(&graph.Ref{}) {
+		// Table of distinct values, in order of first appearance.
+		index := map[string]int{}
+		var table []string
+		for _, ref := range refs {
+			s := *refStringColumns(ref)[col]
+			if _, present := index[s]; !present {
+				index[s] = len(table)
+				table = append(table, s)
+			}
+		}
+		w.uvarint(uint64(len(table)))
+		for _, s := range table {
+			w.str(s)
+		}
+
+		// Runs of (length, table index).
+		for i := 0; i < len(refs); {
+			j := i + 1
+			for j < len(refs) && *refStringColumns(refs[j])[col] == *refStringColumns(refs[i])[col] {
+				j++
+			}
+			w.uvarint(uint64(j - i))
+			w.uvarint(uint64(index[*refStringColumns(refs[i])[col]]))
+			i = j
+		}
+	}
+
+	// Def: lengths of alternating runs of false and true.
+	def := false
+	for i := 0; i < len(refs); {
+		j := i
+		for j < len(refs) && refs[j].Def == def {
+			j++
+		}
+		w.uvarint(uint64(j - i))
+		i, def = j, !def
+	}
+
+	var start uint32
+	for _, ref := range refs {
+		w.varint(int64(ref.Start) - int64(start))
+		start = ref.Start
+	}
+	for _, ref := range refs {
+		w.varint(int64(ref.End) - int64(ref.Start))
+	}
+
+	for _, ref := range refs {
+		if ref.Snippet == nil {
+			w.uvarint(0)
+			continue
+		}
+		b, err := proto.Marshal(ref.Snippet)
+		if err != nil {
+			panic(err) // Snippet has no fields that can fail to marshal
+		}
+		w.uvarint(uint64(len(b)) + 1)
+		w.buf = append(w.buf, b...)
+	}
+
+	// Confidence: runs of (length, float32 bits).
+	for i := 0; i < len(refs); {
+		j := i + 1
+		for j < len(refs) && refs[j].Confidence == refs[i].Confidence {
+			j++
+		}
+		w.uvarint(uint64(j - i))
+		w.uvarint(uint64(math.Float32bits(refs[i].Confidence)))
+		i = j
+	}
+	return w.buf
+}
+
+var errCorruptRefColumns = errors.New("corrupt columnar ref data")
+
+// decodeRefBlock decodes a block of n refs (see writeRefColumns). If
+// confidence is false, the block has no Confidence column (see
+// refColumnsMagicV1).
+func decodeRefBlock(data []byte, n int, confidence bool) ([]*graph.Ref, error) {
+	refs := make([]graph.Ref, n)
+	r := colReader{data: data}
+	for col := range refStringColumns(&graph.Ref{}) {
+		table := make([]string, r.count(len(data)))
+		for i := range table {
+			table[i] = r.str()
+		}
+		for i := 0; i < n && r.err == nil; {
+			l, v := r.count(n-i), r.count(len(table)-1)
+			if r.err == nil && l == 0 {
+				r.err = errCorruptRefColumns
+			}
+			if r.err != nil {
+				break
+			}
+			for j := i; j < i+l; j++ {
+				*refStringColumns(&refs[j])[col] = table[v]
+			}
+			i += l
+		}
+	}
+
+	def := false
+	for i := 0; i < n && r.err == nil; {
+		l := r.count(n - i)
+		if l == 0 && (i > 0 || def) {
+			r.err = errCorruptRefColumns // only the first run may be empty
+		}
+		for j := i; j < i+l; j++ {
+			refs[j].Def = def
+		}
+		i, def = i+l, !def
+	}
+
+	var start int64
+	for i := range refs {
+		start += r.varint()
+		refs[i].Start = uint32(start)
+	}
+	for i := range refs {
+		refs[i].End = uint32(int64(refs[i].Start) + r.varint())
+	}
+
+	for i := range refs {
+		if l := r.count(len(data)); l > 0 {
+			refs[i].Snippet = &graph.Snippet{}
+			if b := r.bytes(l - 1); r.err == nil {
+				r.err = proto.Unmarshal(b, refs[i].Snippet)
+			}
+		}
+	}
+
+	for i := 0; confidence && i < n && r.err == nil; {
+		l, v := r.count(n-i), r.uvarint()
+		if r.err == nil && (l == 0 || v > math.MaxUint32) {
+			r.err = errCorruptRefColumns
+		}
+		for j := i; j < i+l; j++ {
+			refs[j].Confidence = math.Float32frombits(uint32(v))
+		}
+		i += l
+	}
+
+	if r.err == nil && len(r.data) != 0 {
+		r.err = errCorruptRefColumns
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	ptrs := make([]*graph.Ref, n)
+	for i := range refs {
+		ptrs[i] = &refs[i]
+	}
+	return ptrs, nil
+}
+
+// refColumnsHeader is the header of a columnar ref data file.
+type refColumnsHeader struct {
+	n          int     // number of refs
+	blockSize  int     // number of refs per block
+	blockOfs   []int64 // byte offset of each block, plus the end of the last
+	confidence bool    // whether blocks have a Confidence column
+}
+
+// readRefColumnsHeader reads the header of a columnar ref data file.
+func readRefColumnsHeader(r *bufio.Reader) (*refColumnsHeader, error) {
+	magic := make([]byte, len(refColumnsMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != refColumnsMagic && string(magic) != refColumnsMagicV1 {
+		return nil, fmt.Errorf("columnar ref data has unknown format %q (written by a newer version of src?)", magic)
+	}
+
+	cr := &countingByteReader{ByteReader: r, n: int64(len(magic))}
+	var vs [3]uint64
+	for i := range vs {
+		v, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return nil, err
+		}
+		vs[i] = v
+	}
+	n, blockSize, nblocks := vs[0], vs[1], vs[2]
+	if blockSize == 0 || blockSize > maxRefColumnsBlockSize || nblocks != (n+blockSize-1)/blockSize {
+		return nil, errCorruptRefColumns
+	}
+	h := &refColumnsHeader{n: int(n), blockSize: int(blockSize), confidence: string(magic) != refColumnsMagicV1}
+	for i := uint64(0); i < nblocks; i++ {
+		l, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return nil, err
+		}
+		if l > 1<<31 {
+			return nil, errCorruptRefColumns
+		}
+		h.blockOfs = append(h.blockOfs, int64(l))
+	}
+	// Convert the block lengths to offsets.
+	h.blockOfs = append(h.blockOfs, 0)
+	o := cr.n
+	for i, l := range h.blockOfs {
+		h.blockOfs[i] = o
+		o += l
+	}
+	return h, nil
+}
+
+// blockLen returns the number of refs in block i.
+func (h *refColumnsHeader) blockLen(i int) int {
+	if end := (i + 1) * h.blockSize; end < h.n {
+		return h.blockSize
+	}
+	return h.n - i*h.blockSize
+}
+
+// numBlocks returns the number of blocks.
+func (h *refColumnsHeader) numBlocks() int { return len(h.blockOfs) - 1 }
+
+// readBlocks reads and decodes blocks [start, end) from r, which must
+// be positioned at the beginning of block start.
+func (h *refColumnsHeader) readBlocks(r io.Reader, start, end int) ([]*graph.Ref, error) {
+	data := make([]byte, h.blockOfs[end]-h.blockOfs[start])
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	var refs []*graph.Ref
+	for i := start; i < end; i++ {
+		blockRefs, err := decodeRefBlock(data[h.blockOfs[i]-h.blockOfs[start]:h.blockOfs[i+1]-h.blockOfs[start]], h.blockLen(i), h.confidence)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, blockRefs...)
+	}
+	return refs, nil
+}
+
+// countingByteReader wraps an io.ByteReader, counting the number of
+// bytes read.
+type countingByteReader struct {
+	io.ByteReader
+	n int64
+}
+
+func (r *countingByteReader) ReadByte() (byte, error) {
+	c, err := r.ByteReader.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return c, err
+}
+
+// colWriter encodes the values in a columnar ref data file.
+type colWriter struct {
+	buf []byte
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (w *colWriter) uvarint(v uint64) {
+	w.buf = append(w.buf, w.tmp[:binary.PutUvarint(w.tmp[:], v)]...)
+}
+
+func (w *colWriter) varint(v int64) {
+	w.buf = append(w.buf, w.tmp[:binary.PutVarint(w.tmp[:], v)]...)
+}
+
+func (w *colWriter) str(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// colReader decodes the values written by colWriter. After the first
+// error (which is kept in err), its methods return zero values.
+type colReader struct {
+	data []byte
+	err  error
+}
+
+func (r *colReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errCorruptRefColumns
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *colReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errCorruptRefColumns
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// count reads a uvarint that must be no greater than max.
+func (r *colReader) count(max int) int {
+	v := r.uvarint()
+	if max < 0 || v > uint64(max) {
+		if r.err == nil {
+			r.err = errCorruptRefColumns
+		}
+		return 0
+	}
+	return int(v)
+}
+
+func (r *colReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.err = errCorruptRefColumns
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *colReader) str() string { return string(r.bytes(r.count(len(r.data)))) }
+
+// A refColumnsFile is an open columnar ref data file.
+type refColumnsFile struct {
+	vfs.ReadSeekCloser
+	*refColumnsHeader
+}
+
+// openRefColumns opens the unit's columnar ref data file and reads its
+// header. If the unit store has a per-record ref data file instead
+// (because it was written by an older version of src), it returns nil.
+func (s *fsUnitStore) openRefColumns() (*refColumnsFile, error) {
+	f, err := openFetcherOrOpen(s.fs, unitRefColumnsFilename)
+	if isOSOrVFSNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	h, err := readRefColumnsHeader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, &CorruptError{Store: s.String(), File: unitRefColumnsFilename, Err: err}
+	}
+	return &refColumnsFile{f, h}, nil
+}
+
+// readRefColumns reads all refs from the columnar ref data file f,
+// calling fn with the refs in each block.
+func (s *fsUnitStore) readRefColumns(f *refColumnsFile, fn func([]*graph.Ref)) error {
+	strs, err := s.stringDict()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(f.blockOfs[0], 0); err != nil {
+		return err
+	}
+	for i := 0; i < f.numBlocks(); i++ {
+		refs, err := f.readBlocks(f, i, i+1)
+		if err == nil {
+			err = decodeRefsStrings(strs, refs)
+		}
+		if err != nil {
+			return &CorruptError{Store: s.String(), File: unitRefColumnsFilename, Err: err}
+		}
+		fn(refs)
+	}
+	return nil
+}
+
+// A refRange is a range [start, end) of positions of refs in a
+// columnar ref data file.
+type refRange [2]int64
+
+// refColumnsInRanges reads the refs in the given ranges from the
+// columnar ref data file f. Each block that holds refs in the ranges
+// is only read once.
+func (s *fsUnitStore) refColumnsInRanges(f *refColumnsFile, ranges []refRange, fs []RefFilter) (refs []*graph.Ref, err error) {
+	strs, err := s.stringDict()
+	if err != nil {
+		return nil, err
+	}
+
+	p := parFetches(s.fs, fs)
+	if p == 0 {
+		return nil, nil
+	}
+
+	// Group the ranges into spans of blocks [start, end), so that
+	// ranges in the same block share a span.
+	type blockSpan struct {
+		start, end int
+		ranges     []refRange
+	}
+	var spans []*blockSpan
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	for _, r := range ranges {
+		if r[0] < 0 || r[0] > r[1] || r[1] > int64(f.n) {
+			return nil, &CorruptError{Store: s.String(), File: unitRefColumnsFilename, Err: fmt.Errorf("ref positions [%d, %d) are out of range (%d refs)", r[0], r[1], f.n)}
+		}
+		if r[0] == r[1] {
+			continue
+		}
+		start, end := int(r[0])/f.blockSize, int(r[1]-1)/f.blockSize+1
+		if len(spans) > 0 && start < spans[len(spans)-1].end {
+			sp := spans[len(spans)-1]
+			if end > sp.end {
+				sp.end = end
+			}
+			sp.ranges = append(sp.ranges, r)
+		} else {
+			spans = append(spans, &blockSpan{start: start, end: end, ranges: []refRange{r}})
+		}
+	}
+
+	ffs := refFilters(fs)
+	var refsLock sync.Mutex
+	par := parallel.NewRun(p)
+	for _, sp_ := range spans {
+		sp := sp_
+		par.Do(func() error {
+			if _, moreOK := LimitRemaining(fs); !moreOK {
+				return nil
+			}
+
+			r, err := rangeReader(s.fs, unitRefColumnsFilename, f, f.blockOfs[sp.start], f.blockOfs[sp.end]-f.blockOfs[sp.start])
+			if err != nil {
+				return err
+			}
+			blockRefs, err := f.readBlocks(r, sp.start, sp.end)
+			if err == nil {
+				err = decodeRefsStrings(strs, blockRefs)
+			}
+			if err != nil {
+				return &CorruptError{Store: s.String(), File: unitRefColumnsFilename, Err: err}
+			}
+			first := int64(sp.start * f.blockSize)
+			for _, r := range sp.ranges {
+				for _, ref := range blockRefs[r[0]-first : r[1]-first] {
+					if ffs.SelectRef(ref) {
+						refsLock.Lock()
+						refs = append(refs, ref)
+						refsLock.Unlock()
+					}
+				}
+			}
+			return nil
+		})
+	}
+	if err := par.Wait(); err != nil {
+		return refs, err
+	}
+	sort.Sort(refsByFileStartEnd(refs))
+	return refs, nil
+}
+
+// decodeRefsStrings replaces the references to the string dictionary
+// in refs with the strings they refer to.
+func decodeRefsStrings(strs stringDict, refs []*graph.Ref) error {
+	for _, ref := range refs {
+		if err := strs.decodeRef(ref); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refColumnsPositions returns the positions of refs (sorted by file and
+// start offset, as written by writeRefColumns) in the form that ref
+// indexes use. In a columnar ref data file, a ref's offset is its
+// position (its index in refs), and each file's byteRanges is the
+// position of its first ref followed by its number of refs.
+func refColumnsPositions(refs []*graph.Ref) (fileByteRanges, byteOffsets) {
+	fbr := fileByteRanges{}
+	ofs := make(byteOffsets, len(refs))
+	for i, ref := range refs {
+		ofs[i] = int64(i)
+		if br, present := fbr[ref.File]; present {
+			br[1]++
+		} else {
+			fbr[ref.File] = byteRanges{int64(i), 1}
+		}
+	}
+	return fbr, ofs
+}
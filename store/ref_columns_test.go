@@ -0,0 +1,97 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestRefColumns(t *testing.T) {
+	for _, n := range []int{0, 1, 7, refColumnsBlockSize, 2*refColumnsBlockSize + 3} {
+		var refs []*graph.Ref
+		for i := 0; i < n; i++ {
+			ref := &graph.Ref{
+				DefPath: fmt.Sprintf("p%d", i%13),
+				File:    fmt.Sprintf("f%d", i/100),
+				Start:   uint32(i%100) * 10,
+				End:     uint32(i%100)*10 + uint32(i%7),
+				Def:     i%5 == 0,
+			}
+			if i%3 == 0 {
+				ref.DefRepo = "r"
+			}
+			if i%17 == 0 {
+				ref.Confidence = 0.5
+			}
+			if i%11 == 0 {
+				ref.Snippet = &graph.Snippet{StartLine: 1, Start: ref.Start, Text: "t"}
+			}
+			refs = append(refs, ref)
+		}
+		sort.Sort(refsByFileStartEnd(refs))
+
+		var buf bytes.Buffer
+		if err := writeRefColumns(&buf, refs); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		h, err := readRefColumnsHeader(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.n != n {
+			t.Errorf("n=%d: got %d refs in header", n, h.n)
+		}
+		if end := h.blockOfs[h.numBlocks()]; end != int64(len(data)) {
+			t.Errorf("n=%d: got end offset %d, want %d", n, end, len(data))
+		}
+		got, err := h.readBlocks(bytes.NewReader(data[h.blockOfs[0]:]), 0, h.numBlocks())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(refs) || (n > 0 && !reflect.DeepEqual(got, refs)) {
+			t.Errorf("n=%d: refs differ after round trip", n)
+		}
+
+		// Check that the positions of each file's refs are correct.
+		fbr, ofs := refColumnsPositions(refs)
+		for i, ref := range refs {
+			br := fbr[ref.File]
+			if int64(i) < br.start() || int64(i) >= br.start()+br[1] {
+				t.Errorf("n=%d: ref %d not in its file's range %v", n, i, br)
+			}
+			if ofs[i] != int64(i) {
+				t.Errorf("n=%d: got offset %d for ref %d", n, ofs[i], i)
+			}
+		}
+	}
+}
+
+func TestReadRefColumnsHeader_corrupt(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeRefColumns(&buf, []*graph.Ref{{DefPath: "p", File: "f"}}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if _, err := readRefColumnsHeader(bufio.NewReader(bytes.NewReader(data[:len(refColumnsMagic)+1]))); err == nil {
+		t.Error("got no error for truncated header")
+	}
+	bad := append([]byte("srcrefs\x03"), data[len(refColumnsMagic):]...)
+	if _, err := readRefColumnsHeader(bufio.NewReader(bytes.NewReader(bad))); err == nil {
+		t.Error("got no error for unknown format")
+	}
+	h, err := readRefColumnsHeader(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := data[h.blockOfs[0]:]
+	if _, err := decodeRefBlock(block[:len(block)-1], 1, h.confidence); err == nil {
+		t.Error("got no error for truncated block")
+	}
+}
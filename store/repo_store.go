@@ -85,11 +85,15 @@ func (s repoStores) Versions(f ...VersionFilter) ([]*Version, error) {
 		return nil, err
 	}
 
+	ctx := filtersContext(f)
 	var allVersions []*Version
 	for repo, rs := range rss {
 		if rs == nil {
 			continue
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
 		versions, err := rs.Versions(filtersForRepo(repo, f).([]VersionFilter)...)
 		if err != nil && !isStoreNotExist(err) {
@@ -144,6 +148,7 @@ func (s repoStores) Defs(f ...DefFilter) ([]*graph.Def, error) {
 		return nil, err
 	}
 
+	ctx := filtersContext(f)
 	var (
 		allDefs   []*graph.Def
 		allDefsMu sync.Mutex
@@ -156,6 +161,9 @@ func (s repoStores) Defs(f ...DefFilter) ([]*graph.Def, error) {
 		}
 
 		par.Do(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			defs, err := rs.Defs(filtersForRepo(repo, f).([]DefFilter)...)
 			if err != nil && !isStoreNotExist(err) {
 				return err
@@ -170,6 +178,9 @@ func (s repoStores) Defs(f ...DefFilter) ([]*graph.Def, error) {
 		})
 	}
 	err = par.Wait()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	return allDefs, err
 }
 
@@ -179,11 +190,15 @@ func (s repoStores) Refs(f ...RefFilter) ([]*graph.Ref, error) {
 		return nil, err
 	}
 
+	ctx := filtersContext(f)
 	var allRefs []*graph.Ref
 	for repo, rs := range rss {
 		if rs == nil {
 			continue
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
 		setImpliedRepo(f, repo)
 		refs, err := rs.Refs(filtersForRepo(repo, f).([]RefFilter)...)
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+)
+
+// A RepoStager imports commits into a RepoStore with snapshot
+// semantics: readers (including readers in other processes or on
+// other hosts that share the store's filesystem) see a commit's data
+// either as it was before an import or as it is after the import
+// completes, never partially imported.
+//
+// To stage an import, call Stage, import (and index) the data using
+// the returned staging ID in place of the commit ID, and then call
+// Publish (or Discard, if the import failed).
+type RepoStager interface {
+	// Stage returns a new staging ID for importing commitID. Data
+	// imported for the staging ID isn't visible to readers until it
+	// is published. If the store can't stage imports, Stage returns
+	// ErrStagingUnsupported.
+	Stage(commitID string) (stagingID string, err error)
+
+	// Publish makes the data imported for stagingID visible to
+	// readers as the data of commitID, replacing commitID's existing
+	// data (if any).
+	Publish(stagingID, commitID string) error
+
+	// Discard removes the data imported for stagingID.
+	Discard(stagingID string) error
+}
+
+// A MultiRepoStager is like a RepoStager, but for a repository in a
+// MultiRepoStore.
+type MultiRepoStager interface {
+	Stage(repo, commitID string) (stagingID string, err error)
+	Publish(repo, stagingID, commitID string) error
+	Discard(repo, stagingID string) error
+}
+
+// ErrStagingUnsupported is returned by Stage when the store's
+// filesystem can't rename directories (see Renamer).
+var ErrStagingUnsupported = errors.New("store filesystem does not support staged imports")
+
+// A Renamer is a filesystem that can rename files and directories
+// atomically. The FS-backed stores can stage imports only if their
+// filesystem implements Renamer.
+type Renamer interface {
+	Rename(oldpath, newpath string) error
+}
+
+// WithOSRename returns fs with a Rename method that renames files in
+// the OS filesystem. The root of fs must be the OS directory root
+// (e.g., fs is rwvfs.OS(root)).
+func WithOSRename(fs rwvfs.WalkableFileSystem, root string) rwvfs.WalkableFileSystem {
+	return osRenameFS{fs, root}
+}
+
+type osRenameFS struct {
+	rwvfs.WalkableFileSystem
+	root string
+}
+
+func (fs osRenameFS) Rename(oldpath, newpath string) error {
+	return os.Rename(filepath.Join(fs.root, filepath.FromSlash(oldpath)), filepath.Join(fs.root, filepath.FromSlash(newpath)))
+}
+
+// subFS is like rwvfs.Sub, but it keeps fs's Rename method (if any).
+func subFS(fs rwvfs.FileSystem, prefix string) rwvfs.FileSystem {
+	sub := rwvfs.Sub(fs, prefix)
+	if r, ok := fs.(Renamer); ok {
+		return renameSubFS{sub, r, prefix}
+	}
+	return sub
+}
+
+type renameSubFS struct {
+	rwvfs.FileSystem
+	parent Renamer
+	prefix string
+}
+
+func (fs renameSubFS) Rename(oldpath, newpath string) error {
+	return fs.parent.Rename(path.Join(fs.prefix, oldpath), path.Join(fs.prefix, newpath))
+}
+
+// Staged and replaced commit data are stored in the repo store's dir
+// alongside the commit dirs, under names that begin with "." (which
+// versionDirs skips; commit IDs never begin with ".").
+const (
+	stagingDirPrefix  = ".staging-"
+	replacedDirPrefix = ".replaced-"
+)
+
+func randomSuffix() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Stage implements RepoStager.
+func (s *fsRepoStore) Stage(commitID string) (string, error) {
+	if _, ok := s.fs.(Renamer); !ok {
+		return "", ErrStagingUnsupported
+	}
+	suffix, err := randomSuffix()
+	if err != nil {
+		return "", err
+	}
+	return stagingDirPrefix + commitID + "-" + suffix, nil
+}
+
+// Publish implements RepoStager. It renames the staging dir to the
+// commit dir, which is atomic on the OS filesystem. If the commit was
+// already imported, its dir is first renamed out of the way, so in
+// the brief interval between the two renames, readers don't see the
+// commit at all. (A query that is already reading the commit when it
+// is replaced may read files of both the old and the new data, so
+// readers should retry a query that returns a CorruptError.)
+func (s *fsRepoStore) Publish(stagingID, commitID string) error {
+	if !strings.HasPrefix(stagingID, stagingDirPrefix) {
+		return fmt.Errorf("%s: invalid staging ID %q", s, stagingID)
+	}
+	r, ok := s.fs.(Renamer)
+	if !ok {
+		return ErrStagingUnsupported
+	}
+	if _, err := s.fs.Stat(stagingID); err != nil {
+		if isOSOrVFSNotExist(err) {
+			return nil // nothing was imported
+		}
+		return err
+	}
+
+	var replaced string
+	if _, err := s.fs.Stat(commitID); err == nil {
+		suffix, err := randomSuffix()
+		if err != nil {
+			return err
+		}
+		replaced = replacedDirPrefix + commitID + "-" + suffix
+		if err := r.Rename(commitID, replaced); err != nil {
+			return err
+		}
+	} else if !isOSOrVFSNotExist(err) {
+		return err
+	}
+	if err := r.Rename(stagingID, commitID); err != nil {
+		if replaced != "" {
+			r.Rename(replaced, commitID)
+		}
+		return err
+	}
+	if replaced != "" {
+		return removeAll(s.fs, replaced)
+	}
+	return nil
+}
+
+// Discard implements RepoStager.
+func (s *fsRepoStore) Discard(stagingID string) error {
+	if !strings.HasPrefix(stagingID, stagingDirPrefix) {
+		return fmt.Errorf("%s: invalid staging ID %q", s, stagingID)
+	}
+	if err := removeAll(s.fs, stagingID); err != nil && !isOSOrVFSNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Stage implements MultiRepoStager.
+func (s *fsMultiRepoStore) Stage(repo, commitID string) (string, error) {
+	return s.openRepoStore(repo).(RepoStager).Stage(commitID)
+}
+
+// Publish implements MultiRepoStager.
+func (s *fsMultiRepoStore) Publish(repo, stagingID, commitID string) error {
+	return s.openRepoStore(repo).(RepoStager).Publish(stagingID, commitID)
+}
+
+// Discard implements MultiRepoStager.
+func (s *fsMultiRepoStore) Discard(repo, stagingID string) error {
+	return s.openRepoStore(repo).(RepoStager).Discard(stagingID)
+}
+
+var (
+	_ RepoStager      = (*fsRepoStore)(nil)
+	_ MultiRepoStager = (*fsMultiRepoStore)(nil)
+)
+
+// removeAll removes name and (if it is a dir) everything it contains.
+func removeAll(fs rwvfs.FileSystem, name string) error {
+	fi, err := fs.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if fi.Mode().IsDir() {
+		entries, err := fs.ReadDir(name)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := removeAll(fs, path.Join(name, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return fs.Remove(name)
+}
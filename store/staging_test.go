@@ -0,0 +1,139 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func newTestOSRenameFS(t *testing.T) (rwvfs.WalkableFileSystem, func()) {
+	tmpDir, err := ioutil.TempDir("", "srclib-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := rwvfs.OS(tmpDir)
+	setCreateParentDirs(fs)
+	return WithOSRename(rwvfs.Walkable(fs), tmpDir), func() { os.RemoveAll(tmpDir) }
+}
+
+func TestFSRepoStore_staging(t *testing.T) {
+	useIndexedStore = true
+	fs, cleanup := newTestOSRenameFS(t)
+	defer cleanup()
+	rs := NewFSRepoStore(fs)
+	stager := rs.(RepoStager)
+
+	importUnits := func(commitID string, unitNames ...string) {
+		for _, name := range unitNames {
+			if err := rs.Import(commitID, &unit.SourceUnit{Type: "t", Name: name}, graph.Output{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := rs.(RepoIndexer).Index(commitID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkUnits := func(label string, want ...string) {
+		units, err := rs.Units()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, u := range units {
+			names = append(names, u.Name)
+		}
+		if !reflect.DeepEqual(names, want) {
+			t.Errorf("%s: got units %v, want %v", label, names, want)
+		}
+	}
+
+	stagingID, err := stager.Stage("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	importUnits(stagingID, "u1")
+	if versions, _ := rs.Versions(); len(versions) != 0 {
+		t.Errorf("before Publish: got versions %v, want none", versions)
+	}
+	checkUnits("before Publish")
+
+	if err := stager.Publish(stagingID, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := rs.Versions(); !reflect.DeepEqual(versions, []*Version{{CommitID: "c"}}) {
+		t.Errorf("after Publish: got versions %v, want [c]", versions)
+	}
+	checkUnits("after Publish", "u1")
+
+	// Re-importing replaces the commit's data.
+	stagingID, err = stager.Stage("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	importUnits(stagingID, "u2")
+	checkUnits("before re-import Publish", "u1")
+	if err := stager.Publish(stagingID, "c"); err != nil {
+		t.Fatal(err)
+	}
+	checkUnits("after re-import Publish", "u2")
+
+	// Discarded data is never visible.
+	stagingID, err = stager.Stage("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	importUnits(stagingID, "u3")
+	if err := stager.Discard(stagingID); err != nil {
+		t.Fatal(err)
+	}
+	checkUnits("after Discard", "u2")
+
+	entries, err := fs.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "c" {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("got store dir entries %v, want only [c]", names)
+	}
+}
+
+func TestFSMultiRepoStore_staging(t *testing.T) {
+	useIndexedStore = true
+	fs, cleanup := newTestOSRenameFS(t)
+	defer cleanup()
+	mrs := NewFSMultiRepoStore(fs, nil)
+	stager := mrs.(MultiRepoStager)
+
+	stagingID, err := stager.Stage("r", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mrs.Import("r", stagingID, &unit.SourceUnit{Type: "t", Name: "u"}, graph.Output{}); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := mrs.Versions(); len(versions) != 0 {
+		t.Errorf("before Publish: got versions %v, want none", versions)
+	}
+	if err := stager.Publish("r", stagingID, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := mrs.Versions(); !reflect.DeepEqual(versions, []*Version{{Repo: "r", CommitID: "c"}}) {
+		t.Errorf("after Publish: got versions %v, want [r@c]", versions)
+	}
+}
+
+func TestFSRepoStore_stagingUnsupported(t *testing.T) {
+	rs := NewFSRepoStore(rwvfs.Map(map[string]string{}))
+	if _, err := rs.(RepoStager).Stage("c"); err != ErrStagingUnsupported {
+		t.Errorf("got error %v, want ErrStagingUnsupported", err)
+	}
+}
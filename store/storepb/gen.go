@@ -0,0 +1,4 @@
+package storepb
+
+//go:generate protoc --proto_path=/usr/include:$HOME/src:$HOME/src/github.com/gogo/protobuf/protobuf/google/protobuf:../../graph:. --gogo_out=plugins=grpc:. query.proto
+//go:generate sed -i "s/^import graph .*$/import graph \"sourcegraph.com\\/sourcegraph\\/srclib\\/graph\"/" query.pb.go
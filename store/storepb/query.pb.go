@@ -0,0 +1,543 @@
+// Code generated by protoc-gen-gogo.
+// source: query.proto
+// DO NOT EDIT!
+
+/*
+	Package storepb is a generated protocol buffer package.
+
+	It is generated from these files:
+		query.proto
+
+	It has these top-level messages:
+		DefsOptions
+		RefsOptions
+		SearchOptions
+		WarningsOptions
+*/
+package storepb
+
+import proto "github.com/gogo/protobuf/proto"
+import math "math"
+
+// discarding unused import gogoproto "github.com/gogo/protobuf/gogoproto/gogo.pb"
+import graph "sourcegraph.com/sourcegraph/srclib/graph"
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+// DefsOptions filters the results of Query.Defs. Empty fields match
+// all defs. UnitType and Unit must both be set or both be empty.
+type DefsOptions struct {
+	Repo     string `protobuf:"bytes,1,opt,name=repo" json:"Repo,omitempty"`
+	CommitID string `protobuf:"bytes,2,opt,name=commit_id" json:"CommitID,omitempty"`
+	UnitType string `protobuf:"bytes,3,opt,name=unit_type" json:"UnitType,omitempty"`
+	Unit     string `protobuf:"bytes,4,opt,name=unit" json:"Unit,omitempty"`
+	File     string `protobuf:"bytes,5,opt,name=file" json:"File,omitempty"`
+	Path     string `protobuf:"bytes,6,opt,name=path" json:"Path,omitempty"`
+	// Query, if set, selects only defs whose names start with it (or,
+	// with Fuzzy, contain it as a camelCase-aware subsequence), ordered
+	// by rank.
+	Query string `protobuf:"bytes,7,opt,name=query" json:"Query,omitempty"`
+	Fuzzy bool   `protobuf:"varint,8,opt,name=fuzzy" json:"Fuzzy,omitempty"`
+	// Limit is the max number of results (0 for all), and Offset is
+	// the number of results to skip.
+	Limit  int `protobuf:"varint,9,opt,name=limit,casttype=int" json:"Limit,omitempty"`
+	Offset int `protobuf:"varint,10,opt,name=offset,casttype=int" json:"Offset,omitempty"`
+	// Snippets sets each def's Snippet to its first line of source
+	// code, with ContextLines lines before and after, so that clients
+	// can display results without fetching files. The server reads
+	// snippets from local clones of the repositories (see "src serve
+	// --clone"); defs in other repositories have no snippet.
+	Snippets     bool `protobuf:"varint,11,opt,name=snippets" json:"Snippets,omitempty"`
+	ContextLines int  `protobuf:"varint,12,opt,name=context_lines,casttype=int" json:"ContextLines,omitempty"`
+	// Where, if set, selects only defs that the def query expression
+	// is true for (e.g., "kind:func and not file:*_test.go"; see
+	// store.ParseDefExpr).
+	Where string `protobuf:"bytes,13,opt,name=where" json:"Where,omitempty"`
+	// FollowAliases replaces each def that is an alias (such as a
+	// re-exported name) with the def that it is an alias of (see
+	// store.ResolveAliases).
+	FollowAliases bool `protobuf:"varint,14,opt,name=follow_aliases" json:"FollowAliases,omitempty"`
+}
+
+func (m *DefsOptions) Reset()         { *m = DefsOptions{} }
+func (m *DefsOptions) String() string { return proto.CompactTextString(m) }
+func (*DefsOptions) ProtoMessage()    {}
+
+// RefsOptions filters the results of Query.Refs. Empty fields match
+// all refs. UnitType and Unit must both be set or both be empty.
+type RefsOptions struct {
+	Repo     string `protobuf:"bytes,1,opt,name=repo" json:"Repo,omitempty"`
+	CommitID string `protobuf:"bytes,2,opt,name=commit_id" json:"CommitID,omitempty"`
+	UnitType string `protobuf:"bytes,3,opt,name=unit_type" json:"UnitType,omitempty"`
+	Unit     string `protobuf:"bytes,4,opt,name=unit" json:"Unit,omitempty"`
+	File     string `protobuf:"bytes,5,opt,name=file" json:"File,omitempty"`
+	// Start and End, if nonzero, select only refs within the byte
+	// offsets [Start, End) of File.
+	Start uint32 `protobuf:"varint,6,opt,name=start" json:"Start,omitempty"`
+	End   uint32 `protobuf:"varint,7,opt,name=end" json:"End,omitempty"`
+	// Def selects only refs to the def with this key.
+	Def graph.RefDefKey `protobuf:"bytes,8,opt,name=def" json:"Def"`
+	// Linked also selects refs to the defs linked to Def by a shared
+	// moniker (see store.LinkedDefs). It requires Def.DefPath.
+	Linked bool `protobuf:"varint,9,opt,name=linked" json:"Linked,omitempty"`
+	Limit  int  `protobuf:"varint,10,opt,name=limit,casttype=int" json:"Limit,omitempty"`
+	Offset int  `protobuf:"varint,11,opt,name=offset,casttype=int" json:"Offset,omitempty"`
+	// Snippets sets each ref's Snippet to the lines of source code that
+	// contain it, with ContextLines lines before and after (as in
+	// DefsOptions).
+	Snippets     bool `protobuf:"varint,12,opt,name=snippets" json:"Snippets,omitempty"`
+	ContextLines int  `protobuf:"varint,13,opt,name=context_lines,casttype=int" json:"ContextLines,omitempty"`
+	// FollowAliases also selects refs to the defs that are aliases of
+	// Def, such as re-exports of it (see store.AliasDefs). It requires
+	// Def.DefPath.
+	FollowAliases bool `protobuf:"varint,14,opt,name=follow_aliases" json:"FollowAliases,omitempty"`
+	// MinConfidence selects only refs whose effective confidence (see
+	// graph.Ref.EffectiveConfidence) is at least MinConfidence.
+	MinConfidence float32 `protobuf:"fixed32,15,opt,name=min_confidence" json:"MinConfidence,omitempty"`
+	// SortByConfidence sorts refs by descending confidence (before
+	// applying Limit and Offset), so that certain refs come first.
+	SortByConfidence bool `protobuf:"varint,16,opt,name=sort_by_confidence" json:"SortByConfidence,omitempty"`
+}
+
+func (m *RefsOptions) Reset()         { *m = RefsOptions{} }
+func (m *RefsOptions) String() string { return proto.CompactTextString(m) }
+func (*RefsOptions) ProtoMessage()    {}
+
+// SearchOptions are the query and filters of Query.Search.
+type SearchOptions struct {
+	// Query must be a (case-insensitive) prefix of def names, or, with
+	// Fuzzy, a camelCase-aware subsequence of them.
+	Query    string `protobuf:"bytes,1,req,name=query" json:"Query"`
+	Fuzzy    bool   `protobuf:"varint,2,opt,name=fuzzy" json:"Fuzzy,omitempty"`
+	Repo     string `protobuf:"bytes,3,opt,name=repo" json:"Repo,omitempty"`
+	CommitID string `protobuf:"bytes,4,opt,name=commit_id" json:"CommitID,omitempty"`
+	UnitType string `protobuf:"bytes,5,opt,name=unit_type" json:"UnitType,omitempty"`
+	Unit     string `protobuf:"bytes,6,opt,name=unit" json:"Unit,omitempty"`
+	File     string `protobuf:"bytes,7,opt,name=file" json:"File,omitempty"`
+	Limit    int    `protobuf:"varint,8,opt,name=limit,casttype=int" json:"Limit,omitempty"`
+	// Snippets and ContextLines are as in DefsOptions.
+	Snippets     bool `protobuf:"varint,9,opt,name=snippets" json:"Snippets,omitempty"`
+	ContextLines int  `protobuf:"varint,10,opt,name=context_lines,casttype=int" json:"ContextLines,omitempty"`
+}
+
+func (m *SearchOptions) Reset()         { *m = SearchOptions{} }
+func (m *SearchOptions) String() string { return proto.CompactTextString(m) }
+func (*SearchOptions) ProtoMessage()    {}
+
+// WarningsOptions selects the commit and filters the results of
+// Query.Warnings. Empty fields (except CommitID and, for multi-repo
+// stores, Repo, which are required) match all warnings.
+type WarningsOptions struct {
+	Repo     string `protobuf:"bytes,1,opt,name=repo" json:"Repo,omitempty"`
+	CommitID string `protobuf:"bytes,2,opt,name=commit_id" json:"CommitID,omitempty"`
+	UnitType string `protobuf:"bytes,3,opt,name=unit_type" json:"UnitType,omitempty"`
+	Unit     string `protobuf:"bytes,4,opt,name=unit" json:"Unit,omitempty"`
+	File     string `protobuf:"bytes,5,opt,name=file" json:"File,omitempty"`
+	// Severity, if set, selects only warnings with this severity.
+	Severity string `protobuf:"bytes,6,opt,name=severity" json:"Severity,omitempty"`
+}
+
+func (m *WarningsOptions) Reset()         { *m = WarningsOptions{} }
+func (m *WarningsOptions) String() string { return proto.CompactTextString(m) }
+func (*WarningsOptions) ProtoMessage()    {}
+
+func init() {
+	proto.RegisterType((*DefsOptions)(nil), "storepb.DefsOptions")
+	proto.RegisterType((*RefsOptions)(nil), "storepb.RefsOptions")
+	proto.RegisterType((*SearchOptions)(nil), "storepb.SearchOptions")
+	proto.RegisterType((*WarningsOptions)(nil), "storepb.WarningsOptions")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// Client API for Query service
+
+type QueryClient interface {
+	// Def returns the def with the given key. If the key's CommitID is
+	// empty, the def is looked up in any commit in the store.
+	Def(ctx context.Context, in *graph.DefKey, opts ...grpc.CallOption) (*graph.Def, error)
+	// Defs lists the defs that match the options.
+	Defs(ctx context.Context, in *DefsOptions, opts ...grpc.CallOption) (Query_DefsClient, error)
+	// Refs lists the refs that match the options.
+	Refs(ctx context.Context, in *RefsOptions, opts ...grpc.CallOption) (Query_RefsClient, error)
+	// Docs lists the docs of the def with the given key.
+	Docs(ctx context.Context, in *graph.DefKey, opts ...grpc.CallOption) (Query_DocsClient, error)
+	// Search lists the defs whose names match the query, with the
+	// highest-ranked defs first.
+	Search(ctx context.Context, in *SearchOptions, opts ...grpc.CallOption) (Query_SearchClient, error)
+	// Warnings lists the warnings in the graph output of a commit's
+	// source units that match the options (see graph.Warning).
+	Warnings(ctx context.Context, in *WarningsOptions, opts ...grpc.CallOption) (Query_WarningsClient, error)
+}
+
+type queryClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewQueryClient(cc *grpc.ClientConn) QueryClient {
+	return &queryClient{cc}
+}
+
+func (c *queryClient) Def(ctx context.Context, in *graph.DefKey, opts ...grpc.CallOption) (*graph.Def, error) {
+	out := new(graph.Def)
+	err := grpc.Invoke(ctx, "/storepb.Query/Def", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *queryClient) Defs(ctx context.Context, in *DefsOptions, opts ...grpc.CallOption) (Query_DefsClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Query_serviceDesc.Streams[0], c.cc, "/storepb.Query/Defs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &queryDefsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Query_DefsClient interface {
+	Recv() (*graph.Def, error)
+	grpc.ClientStream
+}
+
+type queryDefsClient struct {
+	grpc.ClientStream
+}
+
+func (x *queryDefsClient) Recv() (*graph.Def, error) {
+	m := new(graph.Def)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *queryClient) Refs(ctx context.Context, in *RefsOptions, opts ...grpc.CallOption) (Query_RefsClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Query_serviceDesc.Streams[1], c.cc, "/storepb.Query/Refs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &queryRefsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Query_RefsClient interface {
+	Recv() (*graph.Ref, error)
+	grpc.ClientStream
+}
+
+type queryRefsClient struct {
+	grpc.ClientStream
+}
+
+func (x *queryRefsClient) Recv() (*graph.Ref, error) {
+	m := new(graph.Ref)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *queryClient) Docs(ctx context.Context, in *graph.DefKey, opts ...grpc.CallOption) (Query_DocsClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Query_serviceDesc.Streams[2], c.cc, "/storepb.Query/Docs", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &queryDocsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Query_DocsClient interface {
+	Recv() (*graph.DefDoc, error)
+	grpc.ClientStream
+}
+
+type queryDocsClient struct {
+	grpc.ClientStream
+}
+
+func (x *queryDocsClient) Recv() (*graph.DefDoc, error) {
+	m := new(graph.DefDoc)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *queryClient) Search(ctx context.Context, in *SearchOptions, opts ...grpc.CallOption) (Query_SearchClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Query_serviceDesc.Streams[3], c.cc, "/storepb.Query/Search", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &querySearchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Query_SearchClient interface {
+	Recv() (*graph.Def, error)
+	grpc.ClientStream
+}
+
+type querySearchClient struct {
+	grpc.ClientStream
+}
+
+func (x *querySearchClient) Recv() (*graph.Def, error) {
+	m := new(graph.Def)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *queryClient) Warnings(ctx context.Context, in *WarningsOptions, opts ...grpc.CallOption) (Query_WarningsClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Query_serviceDesc.Streams[4], c.cc, "/storepb.Query/Warnings", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &queryWarningsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Query_WarningsClient interface {
+	Recv() (*graph.Warning, error)
+	grpc.ClientStream
+}
+
+type queryWarningsClient struct {
+	grpc.ClientStream
+}
+
+func (x *queryWarningsClient) Recv() (*graph.Warning, error) {
+	m := new(graph.Warning)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for Query service
+
+type QueryServer interface {
+	// Def returns the def with the given key. If the key's CommitID is
+	// empty, the def is looked up in any commit in the store.
+	Def(context.Context, *graph.DefKey) (*graph.Def, error)
+	// Defs lists the defs that match the options.
+	Defs(*DefsOptions, Query_DefsServer) error
+	// Refs lists the refs that match the options.
+	Refs(*RefsOptions, Query_RefsServer) error
+	// Docs lists the docs of the def with the given key.
+	Docs(*graph.DefKey, Query_DocsServer) error
+	// Search lists the defs whose names match the query, with the
+	// highest-ranked defs first.
+	Search(*SearchOptions, Query_SearchServer) error
+	// Warnings lists the warnings in the graph output of a commit's
+	// source units that match the options (see graph.Warning).
+	Warnings(*WarningsOptions, Query_WarningsServer) error
+}
+
+func RegisterQueryServer(s *grpc.Server, srv QueryServer) {
+	s.RegisterService(&_Query_serviceDesc, srv)
+}
+
+func _Query_Def_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(graph.DefKey)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(QueryServer).Def(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/storepb.Query/Def",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(QueryServer).Def(ctx, req.(*graph.DefKey))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Query_Defs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DefsOptions)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QueryServer).Defs(m, &queryDefsServer{stream})
+}
+
+type Query_DefsServer interface {
+	Send(*graph.Def) error
+	grpc.ServerStream
+}
+
+type queryDefsServer struct {
+	grpc.ServerStream
+}
+
+func (x *queryDefsServer) Send(m *graph.Def) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Query_Refs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RefsOptions)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QueryServer).Refs(m, &queryRefsServer{stream})
+}
+
+type Query_RefsServer interface {
+	Send(*graph.Ref) error
+	grpc.ServerStream
+}
+
+type queryRefsServer struct {
+	grpc.ServerStream
+}
+
+func (x *queryRefsServer) Send(m *graph.Ref) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Query_Docs_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(graph.DefKey)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QueryServer).Docs(m, &queryDocsServer{stream})
+}
+
+type Query_DocsServer interface {
+	Send(*graph.DefDoc) error
+	grpc.ServerStream
+}
+
+type queryDocsServer struct {
+	grpc.ServerStream
+}
+
+func (x *queryDocsServer) Send(m *graph.DefDoc) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Query_Search_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SearchOptions)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QueryServer).Search(m, &querySearchServer{stream})
+}
+
+type Query_SearchServer interface {
+	Send(*graph.Def) error
+	grpc.ServerStream
+}
+
+type querySearchServer struct {
+	grpc.ServerStream
+}
+
+func (x *querySearchServer) Send(m *graph.Def) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Query_Warnings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WarningsOptions)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QueryServer).Warnings(m, &queryWarningsServer{stream})
+}
+
+type Query_WarningsServer interface {
+	Send(*graph.Warning) error
+	grpc.ServerStream
+}
+
+type queryWarningsServer struct {
+	grpc.ServerStream
+}
+
+func (x *queryWarningsServer) Send(m *graph.Warning) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Query_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "storepb.Query",
+	HandlerType: (*QueryServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Def",
+			Handler:    _Query_Def_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Defs",
+			Handler:       _Query_Defs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Refs",
+			Handler:       _Query_Refs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Docs",
+			Handler:       _Query_Docs_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Search",
+			Handler:       _Query_Search_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Warnings",
+			Handler:       _Query_Warnings_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "query.proto",
+}
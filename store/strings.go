@@ -0,0 +1,238 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// unitStringsFilename is the name of the file (in a unit store's dir)
+// that holds the unit's string dictionary (see stringDict).
+const unitStringsFilename = "strings.dat"
+
+// A stringDict is a dictionary of the strings that are repeated in a
+// source unit's defs and refs (such as file names and the paths of
+// referenced defs). The def and ref data files store a reference to
+// the dictionary (dictRefPrefix followed by the string's index in
+// decimal) in place of each such string, which makes them much
+// smaller. When defs and refs are read, the references are replaced
+// by the dictionary's strings, so each repeated string is only held in
+// memory once.
+//
+// Unit stores written by older versions of src have no string
+// dictionary; their data files contain no references.
+type stringDict []string
+
+// dictRefPrefix begins a reference to a string in the string
+// dictionary. Strings that begin with it are always stored in the
+// dictionary, so that they aren't mistaken for references.
+const dictRefPrefix = "\x00"
+
+// dictRefMinLen is the length of the shortest string that is stored
+// in the dictionary (unless it begins with dictRefPrefix). Shorter
+// strings are not much longer than references to them.
+const dictRefMinLen = 4
+
+// dictDefStrings and dictRefStrings return pointers to the fields of
+// defs and refs that are dictionary-encoded.
+func dictDefStrings(def *graph.Def) [2]*string { return [...]*string{&def.File, &def.Kind} }
+func dictRefStrings(ref *graph.Ref) [6]*string {
+	return [...]*string{&ref.DefRepo, &ref.DefUnitType, &ref.DefUnit, &ref.DefPath, &ref.File, &ref.EnclosingDef}
+}
+
+// newStringDict creates the string dictionary for defs and refs. It
+// contains the strings (of the dictionary-encoded fields) that occur
+// more than once, most frequent first.
+func newStringDict(defs []*graph.Def, refs []*graph.Ref) stringDict {
+	counts := map[string]int{}
+	count := func(s string) {
+		if len(s) >= dictRefMinLen || strings.HasPrefix(s, dictRefPrefix) {
+			counts[s]++
+		}
+	}
+	for _, def := range defs {
+		for _, s := range dictDefStrings(def) {
+			count(*s)
+		}
+	}
+	for _, ref := range refs {
+		for _, s := range dictRefStrings(ref) {
+			count(*s)
+		}
+	}
+
+	var dict stringDict
+	for s, n := range counts {
+		if n > 1 || strings.HasPrefix(s, dictRefPrefix) {
+			dict = append(dict, s)
+		}
+	}
+	sort.Slice(dict, func(i, j int) bool {
+		if ni, nj := counts[dict[i]], counts[dict[j]]; ni != nj {
+			return ni > nj
+		}
+		return dict[i] < dict[j]
+	})
+	return dict
+}
+
+// A stringDictEncoder replaces strings with references to a string
+// dictionary.
+type stringDictEncoder map[string]string // string -> reference
+
+func (d stringDict) encoder() stringDictEncoder {
+	e := make(stringDictEncoder, len(d))
+	for i, s := range d {
+		e[s] = dictRefPrefix + strconv.Itoa(i)
+	}
+	return e
+}
+
+// def returns def with its strings replaced by references to the
+// dictionary (as a copy, so that def is not modified).
+func (e stringDictEncoder) def(def *graph.Def) *graph.Def {
+	var c *graph.Def
+	for i, s := range dictDefStrings(def) {
+		if ref, present := e[*s]; present {
+			if c == nil {
+				cp := *def
+				c = &cp
+			}
+			*dictDefStrings(c)[i] = ref
+		}
+	}
+	if c == nil {
+		return def
+	}
+	return c
+}
+
+// ref returns ref with its strings replaced by references to the
+// dictionary (as a copy, so that ref is not modified).
+func (e stringDictEncoder) ref(ref *graph.Ref) *graph.Ref {
+	var c *graph.Ref
+	for i, s := range dictRefStrings(ref) {
+		if r, present := e[*s]; present {
+			if c == nil {
+				cp := *ref
+				c = &cp
+			}
+			*dictRefStrings(c)[i] = r
+		}
+	}
+	if c == nil {
+		return ref
+	}
+	return c
+}
+
+// lookup replaces the reference in *s (if any) with the string it
+// refers to.
+func (d stringDict) lookup(s *string) error {
+	if !strings.HasPrefix(*s, dictRefPrefix) {
+		return nil
+	}
+	i, err := strconv.Atoi((*s)[len(dictRefPrefix):])
+	if err != nil || i < 0 || i >= len(d) {
+		return fmt.Errorf("invalid string dictionary reference %q (dictionary has %d strings)", *s, len(d))
+	}
+	*s = d[i]
+	return nil
+}
+
+// decodeDef replaces the references to the dictionary in def with the
+// strings they refer to.
+func (d stringDict) decodeDef(def *graph.Def) error {
+	for _, s := range dictDefStrings(def) {
+		if err := d.lookup(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeRef replaces the references to the dictionary in ref with the
+// strings they refer to.
+func (d stringDict) decodeRef(ref *graph.Ref) error {
+	for _, s := range dictRefStrings(ref) {
+		if err := d.lookup(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStringDict writes the string dictionary to fs.
+func writeStringDict(fs rwvfs.FileSystem, d stringDict) (err error) {
+	f, err := fs.Create(unitStringsFilename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err2 := f.Close()
+		if err == nil {
+			err = err2
+		}
+	}()
+
+	bw := bufio.NewWriter(f)
+	buf := make([]byte, binary.MaxVarintLen64)
+	if _, err := bw.Write(buf[:binary.PutUvarint(buf, uint64(len(d)))]); err != nil {
+		return err
+	}
+	for _, s := range d {
+		if _, err := bw.Write(buf[:binary.PutUvarint(buf, uint64(len(s)))]); err != nil {
+			return err
+		}
+		if _, err := bw.WriteString(s); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+var errCorruptStringDict = errors.New("corrupt string dictionary")
+
+// readStringDict reads the string dictionary from fs. If there is
+// none (because the unit store was written by an older version of
+// src), it returns an empty dictionary.
+func readStringDict(fs rwvfs.FileSystem) (stringDict, error) {
+	f, err := fs.Open(unitStringsFilename)
+	if isOSOrVFSNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	n, w := binary.Uvarint(data)
+	if w <= 0 || n > uint64(len(data)) {
+		return nil, errCorruptStringDict
+	}
+	data = data[w:]
+	d := make(stringDict, 0, n)
+	for i := uint64(0); i < n; i++ {
+		l, w := binary.Uvarint(data)
+		if w <= 0 || l > uint64(len(data)-w) {
+			return nil, errCorruptStringDict
+		}
+		d = append(d, string(data[w:w+int(l)]))
+		data = data[w+int(l):]
+	}
+	if len(data) != 0 {
+		return nil, errCorruptStringDict
+	}
+	return d, nil
+}
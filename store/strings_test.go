@@ -0,0 +1,83 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestStringDict(t *testing.T) {
+	defs := []*graph.Def{
+		{DefKey: graph.DefKey{Path: "p1"}, Kind: "func", File: "dir/f.go"},
+		{DefKey: graph.DefKey{Path: "p2"}, Kind: "func", File: "dir/f.go"},
+		{DefKey: graph.DefKey{Path: "p3"}, Kind: "type", File: "dir/g.go"},
+	}
+	refs := []*graph.Ref{
+		{DefPath: "p1", File: "dir/f.go", Start: 1, End: 2},
+		{DefPath: "p1", File: "dir/g.go", Start: 3, End: 4},
+		{DefPath: "\x00not a reference", File: "x.go"},
+	}
+
+	strs := newStringDict(defs, refs)
+	enc := strs.encoder()
+	if _, present := enc["dir/f.go"]; !present {
+		t.Errorf("repeated string %q not in dictionary %q", "dir/f.go", strs)
+	}
+	if _, present := enc["dir/h.go"]; present {
+		t.Errorf("unrepeated string %q in dictionary %q", "dir/h.go", strs)
+	}
+	if _, present := enc["\x00not a reference"]; !present {
+		t.Errorf("string with dictRefPrefix not in dictionary %q", strs)
+	}
+
+	fs := newTestFS()
+	if err := writeStringDict(fs, strs); err != nil {
+		t.Fatal(err)
+	}
+	strs2, err := readStringDict(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(strs2, strs) {
+		t.Errorf("got dictionary %q, want %q", strs2, strs)
+	}
+
+	for _, def := range defs {
+		want := *def
+		encoded := *enc.def(def)
+		if !reflect.DeepEqual(*def, want) {
+			t.Errorf("encoding modified def %+v", def)
+		}
+		if err := strs2.decodeDef(&encoded); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(encoded, want) {
+			t.Errorf("got def %+v, want %+v", encoded, want)
+		}
+	}
+	for _, ref := range refs {
+		want := *ref
+		encoded := *enc.ref(ref)
+		if err := strs2.decodeRef(&encoded); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(encoded, want) {
+			t.Errorf("got ref %+v, want %+v", encoded, want)
+		}
+	}
+
+	if err := strs.decodeRef(&graph.Ref{File: dictRefPrefix + "999"}); err == nil {
+		t.Error("got no error for out-of-range reference")
+	}
+}
+
+func TestReadStringDict_missing(t *testing.T) {
+	strs, err := readStringDict(newTestFS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strs != nil {
+		t.Errorf("got dictionary %q, want none", strs)
+	}
+}
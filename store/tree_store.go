@@ -80,11 +80,15 @@ func (s treeStores) Defs(f ...DefFilter) ([]*graph.Def, error) {
 		return nil, err
 	}
 
+	ctx := filtersContext(f)
 	var allDefs []*graph.Def
 	for commitID, ts := range tss {
 		if ts == nil {
 			continue
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
 		defs, err := ts.Defs(f...)
 		if err != nil && !isStoreNotExist(err) {
@@ -104,11 +108,15 @@ func (s treeStores) Refs(f ...RefFilter) ([]*graph.Ref, error) {
 		return nil, err
 	}
 
+	ctx := filtersContext(f)
 	var allRefs []*graph.Ref
 	for commitID, ts := range tss {
 		if ts == nil {
 			continue
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
 		setImpliedCommitID(f, commitID)
 		refs, err := ts.Refs(f...)
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"fmt"
 	"sync"
 
 	"code.google.com/p/rog-go/parallel"
@@ -50,6 +51,7 @@ func (s unitStores) Defs(fs ...DefFilter) ([]*graph.Def, error) {
 		return nil, err
 	}
 
+	ctx := filtersContext(fs)
 	var (
 		allDefs   []*graph.Def
 		allDefsMu sync.Mutex
@@ -62,6 +64,9 @@ func (s unitStores) Defs(fs ...DefFilter) ([]*graph.Def, error) {
 		}
 
 		par.Do(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			defs, err := us.Defs(filtersForUnit(u, fs).([]DefFilter)...)
 			if err != nil && !isStoreNotExist(err) {
 				return err
@@ -77,6 +82,9 @@ func (s unitStores) Defs(fs ...DefFilter) ([]*graph.Def, error) {
 		})
 	}
 	err = par.Wait()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	return allDefs, err
 }
 
@@ -88,12 +96,16 @@ func (s unitStores) Refs(f ...RefFilter) ([]*graph.Ref, error) {
 		return nil, err
 	}
 
+	ctx := filtersContext(f)
 	c_unitStores_Refs_last_numUnitsQueried = 0
 	var allRefs []*graph.Ref
 	for u, us := range uss {
 		if us == nil {
 			continue
 		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 
 		c_unitStores_Refs_last_numUnitsQueried++
 		setImpliedUnit(f, u)
@@ -116,14 +128,24 @@ func (s unitStores) Refs(f ...RefFilter) ([]*graph.Ref, error) {
 	return allRefs, nil
 }
 
-func cleanForImport(data *graph.Output, repo, unitType, unit string) {
-	for _, def := range data.Defs {
+// cleanForImport removes fields from data that are implied by the
+// store it is being imported into, and sets the refs' EnclosingDefs
+// (see graph.SetEnclosingDefs). It returns an error if any of the
+// defs, refs, docs, or anns in data are null.
+func cleanForImport(data *graph.Output, repo, unitType, unit string) error {
+	for i, def := range data.Defs {
+		if def == nil {
+			return fmt.Errorf("import: Defs[%d] is null", i)
+		}
 		def.Unit = ""
 		def.UnitType = ""
 		def.Repo = ""
 		def.CommitID = ""
 	}
-	for _, ref := range data.Refs {
+	for i, ref := range data.Refs {
+		if ref == nil {
+			return fmt.Errorf("import: Refs[%d] is null", i)
+		}
 		ref.Unit = ""
 		ref.UnitType = ""
 		ref.Repo = ""
@@ -138,16 +160,24 @@ func cleanForImport(data *graph.Output, repo, unitType, unit string) {
 			ref.DefUnit = ""
 		}
 	}
-	for _, doc := range data.Docs {
+	for i, doc := range data.Docs {
+		if doc == nil {
+			return fmt.Errorf("import: Docs[%d] is null", i)
+		}
 		doc.Unit = ""
 		doc.UnitType = ""
 		doc.Repo = ""
 		doc.CommitID = ""
 	}
-	for _, ann := range data.Anns {
+	for i, ann := range data.Anns {
+		if ann == nil {
+			return fmt.Errorf("import: Anns[%d] is null", i)
+		}
 		ann.Unit = ""
 		ann.UnitType = ""
 		ann.Repo = ""
 		ann.CommitID = ""
 	}
+	graph.SetEnclosingDefs(data.Defs, data.Refs)
+	return nil
 }
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"fmt"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// ByUnitVariants returns a filter that selects defs or refs in the
+// source unit u and in all of u's variant source units (see
+// unit.Variant). Use MergeVariantDefs or MergeVariantRefs to merge the
+// results.
+func ByUnitVariants(u unit.ID2) interface {
+	DefFilter
+	RefFilter
+} {
+	return byUnitVariantsFilter(u)
+}
+
+type byUnitVariantsFilter unit.ID2
+
+func (f byUnitVariantsFilter) String() string { return fmt.Sprintf("ByUnitVariants(%v)", unit.ID2(f)) }
+func (f byUnitVariantsFilter) selectUnit(unitType, unitName string) bool {
+	name, _ := unit.SplitVariantName(unitName)
+	return unitType == f.Type && (unitName == f.Name || name == f.Name)
+}
+func (f byUnitVariantsFilter) SelectDef(def *graph.Def) bool {
+	return f.selectUnit(def.UnitType, def.Unit)
+}
+func (f byUnitVariantsFilter) SelectRef(ref *graph.Ref) bool {
+	return f.selectUnit(ref.UnitType, ref.Unit)
+}
+
+// MergeVariantDefs merges defs from source units and their variant
+// source units (see unit.Variant), so that each def that exists in
+// multiple build configurations is only returned once. The Unit of
+// defs in variant source units is set to the name of the source unit
+// that they are a variant of. The defs are modified in place.
+func MergeVariantDefs(defs []*graph.Def) []*graph.Def {
+	merged := make([]*graph.Def, 0, len(defs))
+	seen := make(map[graph.DefKey]int, len(defs)) // def key -> index in merged
+	for _, def := range defs {
+		name, variant := unit.SplitVariantName(def.Unit)
+		def.Unit = name
+		if i, present := seen[def.DefKey]; present {
+			// Prefer the def from the source unit's own build
+			// configuration.
+			if variant == "" {
+				merged[i] = def
+			}
+			continue
+		}
+		seen[def.DefKey] = len(merged)
+		merged = append(merged, def)
+	}
+	return merged
+}
+
+// MergeVariantRefs merges refs from source units and their variant
+// source units (see unit.Variant), so that each ref that exists in
+// multiple build configurations is only returned once. The Unit (and
+// DefUnit) of refs in (and to defs in) variant source units is set to
+// the name of the source unit that they are a variant of. The refs are
+// modified in place.
+func MergeVariantRefs(refs []*graph.Ref) []*graph.Ref {
+	merged := make([]*graph.Ref, 0, len(refs))
+	seen := make(map[graph.Ref]struct{}, len(refs))
+	for _, ref := range refs {
+		ref.Unit, _ = unit.SplitVariantName(ref.Unit)
+		ref.DefUnit, _ = unit.SplitVariantName(ref.DefUnit)
+		if _, present := seen[*ref]; present {
+			continue
+		}
+		seen[*ref] = struct{}{}
+		merged = append(merged, ref)
+	}
+	return merged
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+func TestMergeVariantDefs(t *testing.T) {
+	defs := []*graph.Def{
+		{DefKey: graph.DefKey{UnitType: "t", Unit: "u~windows", Path: "a"}, Name: "windows"},
+		{DefKey: graph.DefKey{UnitType: "t", Unit: "u", Path: "a"}, Name: "default"},
+		{DefKey: graph.DefKey{UnitType: "t", Unit: "u~windows", Path: "b"}},
+	}
+
+	f := ByUnitVariants(unit.ID2{Type: "t", Name: "u"})
+	for _, def := range defs {
+		if !f.SelectDef(def) {
+			t.Errorf("def %v not selected by %s", def.DefKey, f)
+		}
+	}
+
+	merged := MergeVariantDefs(defs)
+	if len(merged) != 2 {
+		t.Fatalf("got %d defs, want 2", len(merged))
+	}
+	if merged[0].Name != "default" || merged[0].Unit != "u" {
+		t.Errorf("got def %v (%q), want default configuration's def in unit u", merged[0].DefKey, merged[0].Name)
+	}
+	if merged[1].Path != "b" || merged[1].Unit != "u" {
+		t.Errorf("got def %v, want variant-only def b in unit u", merged[1].DefKey)
+	}
+}
+
+func TestMergeVariantRefs(t *testing.T) {
+	refs := []*graph.Ref{
+		{UnitType: "t", Unit: "u", DefUnitType: "t", DefUnit: "u", DefPath: "a", File: "f", Start: 1, End: 2},
+		{UnitType: "t", Unit: "u~windows", DefUnitType: "t", DefUnit: "u~windows", DefPath: "a", File: "f", Start: 1, End: 2},
+		{UnitType: "t", Unit: "u~windows", DefUnitType: "t", DefUnit: "u~windows", DefPath: "b", File: "f", Start: 3, End: 4},
+	}
+	merged := MergeVariantRefs(refs)
+	if len(merged) != 2 {
+		t.Fatalf("got %d refs, want 2", len(merged))
+	}
+	if merged[1].Unit != "u" || merged[1].DefUnit != "u" {
+		t.Errorf("got ref in unit %q to def unit %q, want u", merged[1].Unit, merged[1].DefUnit)
+	}
+}
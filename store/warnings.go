@@ -0,0 +1,89 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+
+	"sourcegraph.com/sourcegraph/rwvfs"
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// A RepoWarner stores the warnings (see graph.Warning) in the graph
+// output of each commit of a repository.
+type RepoWarner interface {
+	// ImportWarnings stores warnings as the commit's warnings,
+	// replacing any existing warnings.
+	ImportWarnings(commitID string, warnings []*graph.Warning) error
+
+	// Warnings returns the commit's warnings. If the commit has none
+	// recorded (e.g., because its data was imported by an older
+	// version of src), an error satisfying os.IsNotExist is returned.
+	Warnings(commitID string) ([]*graph.Warning, error)
+}
+
+// A MultiRepoWarner stores the warnings in the graph output of each
+// commit of each repository.
+type MultiRepoWarner interface {
+	ImportWarnings(repo, commitID string, warnings []*graph.Warning) error
+	Warnings(repo, commitID string) ([]*graph.Warning, error)
+}
+
+// warningsFilename is the name of the file (in a commit's tree store
+// dir) that holds the commit's warnings.
+const warningsFilename = "warnings.json"
+
+// ImportWarnings implements RepoWarner.
+func (s *fsRepoStore) ImportWarnings(commitID string, warnings []*graph.Warning) error {
+	fs := s.treeStoreFS(commitID)
+	if err := rwvfs.MkdirAll(fs, "."); err != nil {
+		return err
+	}
+	f, err := fs.Create(warningsFilename)
+	if err != nil {
+		return err
+	}
+	if warnings == nil {
+		warnings = []*graph.Warning{}
+	}
+	if err := json.NewEncoder(f).Encode(warnings); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Warnings implements RepoWarner.
+func (s *fsRepoStore) Warnings(commitID string) ([]*graph.Warning, error) {
+	f, err := s.treeStoreFS(commitID).Open(warningsFilename)
+	if err != nil {
+		if isOSOrVFSNotExist(err) {
+			return nil, &os.PathError{Op: "open", Path: warningsFilename, Err: os.ErrNotExist}
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var warnings []*graph.Warning
+	if err := json.NewDecoder(f).Decode(&warnings); err != nil {
+		return nil, err
+	}
+	return warnings, nil
+}
+
+// ImportWarnings implements MultiRepoWarner.
+func (s *fsMultiRepoStore) ImportWarnings(repo, commitID string, warnings []*graph.Warning) error {
+	subpath := s.fs.Join(s.RepoToPath(repo)...)
+	if err := rwvfs.MkdirAll(s.fs, subpath); err != nil {
+		return err
+	}
+	return s.openRepoStore(repo).(RepoWarner).ImportWarnings(commitID, warnings)
+}
+
+// Warnings implements MultiRepoWarner.
+func (s *fsMultiRepoStore) Warnings(repo, commitID string) ([]*graph.Warning, error) {
+	return s.openRepoStore(repo).(RepoWarner).Warnings(commitID)
+}
+
+var (
+	_ RepoWarner      = (*fsRepoStore)(nil)
+	_ MultiRepoWarner = (*fsMultiRepoStore)(nil)
+)
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+func TestFSMultiRepoStore_Warnings(t *testing.T) {
+	s := NewFSMultiRepoStore(newTestFS(), nil).(MultiRepoWarner)
+
+	if _, err := s.Warnings("r", "c"); !os.IsNotExist(err) {
+		t.Fatalf("got error %v, want os.IsNotExist", err)
+	}
+
+	ws := []*graph.Warning{
+		{UnitType: "t", Unit: "u", File: "f", Phase: "offsets", Severity: graph.SeverityWarning, Message: "m"},
+		{UnitType: "t", Unit: "u", Phase: graph.WarningPhaseGraph, Severity: graph.SeverityError, Message: "m2"},
+	}
+	if err := s.ImportWarnings("r", "c", ws); err != nil {
+		t.Fatal(err)
+	}
+	ws2, err := s.Warnings("r", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ws2, ws) {
+		t.Errorf("got %+v, want %+v", ws2, ws)
+	}
+
+	// A commit with no warnings is distinguished from one whose
+	// warnings weren't recorded.
+	if err := s.ImportWarnings("r", "c2", nil); err != nil {
+		t.Fatal(err)
+	}
+	if ws, err := s.Warnings("r", "c2"); err != nil || len(ws) != 0 {
+		t.Errorf("got %v (error %v) for commit with no warnings, want none", ws, err)
+	}
+	if _, err := s.Warnings("r", "c3"); !os.IsNotExist(err) {
+		t.Errorf("got error %v for other commit, want os.IsNotExist", err)
+	}
+}
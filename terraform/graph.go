@@ -0,0 +1,286 @@
+// Package terraform graphs Terraform configurations (written in HCL's
+// native syntax).
+package terraform
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"sourcegraph.com/sourcegraph/srclib/graph"
+)
+
+// UnitType is the source unit type of Terraform modules. Each directory
+// containing Terraform configuration files is a module (and a source
+// unit, named by the directory's path).
+const UnitType = "TerraformModule"
+
+// IsConfigFile returns whether file is a Terraform configuration file.
+func IsConfigFile(file string) bool {
+	return path.Ext(file) == ".tf"
+}
+
+// Def kinds, which are also the prefixes of def paths (e.g.,
+// "resource/aws_instance.web" or "var/region").
+const (
+	ResourceKind = "resource"
+	DataKind     = "data"
+	VariableKind = "var"
+	OutputKind   = "output"
+	LocalKind    = "local"
+	ModuleKind   = "module"
+	ProviderKind = "provider"
+)
+
+// moduleMetaArgs are the arguments of module blocks that aren't the
+// module's input variables.
+var moduleMetaArgs = map[string]bool{
+	"source":     true,
+	"version":    true,
+	"count":      true,
+	"for_each":   true,
+	"providers":  true,
+	"depends_on": true,
+}
+
+// Graph returns the defs and refs in the Terraform module in dir, whose
+// configuration files' paths and contents are given.
+//
+// The module itself (path "."), and its resources, data sources,
+// variables, outputs, locals, module calls, and provider
+// configurations are defs. Refs are emitted for the references in
+// expressions (such as "var.region" or "aws_instance.web.id"), for
+// module sources, and for the input variables and outputs of called
+// modules (which are in other source units, or in other repositories
+// for modules whose sources can be resolved; see ParseSource).
+func Graph(dir string, files map[string][]byte) (*graph.Output, error) {
+	g := &grapher{dir: dir, o: &graph.Output{}, defs: map[string]bool{}, modules: map[string]*Source{}}
+	g.o.Defs = append(g.o.Defs, &graph.Def{
+		DefKey:   graph.DefKey{Path: "."},
+		Name:     path.Base(dir),
+		Kind:     ModuleKind,
+		Exported: true,
+	})
+
+	// Parse the files in order, so that the same parse error is
+	// reported each time.
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bodies := map[string]*Body{}
+	for _, name := range names {
+		body, err := Parse(files[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		bodies[name] = body
+	}
+
+	for _, name := range names {
+		g.file = name
+		g.defineBlocks(bodies[name])
+	}
+	for _, name := range names {
+		g.file = name
+		g.refBlocks(bodies[name])
+	}
+	return g.o, nil
+}
+
+// ModuleSources returns the sources of the non-local modules that the
+// Terraform configuration files call.
+func ModuleSources(files map[string][]byte) ([]string, error) {
+	seen := map[string]struct{}{}
+	var sources []string
+	for name, data := range files {
+		body, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		for _, b := range body.Blocks {
+			if b.Type.Text != "module" || len(b.Labels) != 1 {
+				continue
+			}
+			src := b.Body.Attribute("source")
+			if src == nil || src.Literal == nil {
+				continue
+			}
+			if s, err := ParseSource(src.Literal.Text); err == nil && s.Local {
+				continue
+			}
+			if _, present := seen[src.Literal.Text]; !present {
+				seen[src.Literal.Text] = struct{}{}
+				sources = append(sources, src.Literal.Text)
+			}
+		}
+	}
+	sort.Strings(sources)
+	return sources, nil
+}
+
+type grapher struct {
+	dir, file string
+	o         *graph.Output
+	defs      map[string]bool    // paths of emitted defs
+	modules   map[string]*Source // resolvable module calls' sources
+}
+
+func (g *grapher) def(kind, name string, tok *Token) {
+	defPath := kind + "/" + name
+	if g.defs[defPath] {
+		return
+	}
+	g.defs[defPath] = true
+	g.o.Defs = append(g.o.Defs, &graph.Def{
+		DefKey:   graph.DefKey{Path: defPath},
+		Name:     name,
+		Kind:     kind,
+		File:     g.file,
+		DefStart: uint32(tok.Start),
+		DefEnd:   uint32(tok.End),
+		Exported: kind == VariableKind || kind == OutputKind,
+	})
+	g.o.Refs = append(g.o.Refs, &graph.Ref{DefPath: defPath, Def: true, File: g.file, Start: uint32(tok.Start), End: uint32(tok.End)})
+}
+
+// ref emits a ref to the def in the same module with the given path,
+// if it exists.
+func (g *grapher) ref(defPath string, start, end int) bool {
+	if !g.defs[defPath] {
+		return false
+	}
+	g.o.Refs = append(g.o.Refs, &graph.Ref{DefPath: defPath, File: g.file, Start: uint32(start), End: uint32(end)})
+	return true
+}
+
+// moduleRef emits a ref to the def with the given path in the module
+// with the given source.
+func (g *grapher) moduleRef(src *Source, defPath string, tok *Token) {
+	ref := &graph.Ref{
+		DefRepo:     src.RepoURI,
+		DefUnitType: UnitType,
+		DefUnit:     src.Dir,
+		DefPath:     defPath,
+		File:        g.file,
+		Start:       uint32(tok.Start),
+		End:         uint32(tok.End),
+	}
+	if src.Local {
+		ref.DefUnit = path.Clean(path.Join(g.dir, src.Dir))
+	}
+	g.o.Refs = append(g.o.Refs, ref)
+}
+
+// defineBlocks emits defs for the top-level blocks of body.
+func (g *grapher) defineBlocks(body *Body) {
+	for _, b := range body.Blocks {
+		switch n := len(b.Labels); {
+		case (b.Type.Text == "resource" || b.Type.Text == "data") && n == 2:
+			kind := ResourceKind
+			if b.Type.Text == "data" {
+				kind = DataKind
+			}
+			g.def(kind, b.Labels[0].Text+"."+b.Labels[1].Text, b.Labels[1])
+		case b.Type.Text == "variable" && n == 1:
+			g.def(VariableKind, b.Labels[0].Text, b.Labels[0])
+		case b.Type.Text == "output" && n == 1:
+			g.def(OutputKind, b.Labels[0].Text, b.Labels[0])
+		case b.Type.Text == "module" && n == 1:
+			g.def(ModuleKind, b.Labels[0].Text, b.Labels[0])
+			if src := b.Body.Attribute("source"); src != nil && src.Literal != nil {
+				if s, err := ParseSource(src.Literal.Text); err == nil {
+					g.modules[b.Labels[0].Text] = s
+				}
+			}
+		case b.Type.Text == "provider" && n == 1:
+			name := b.Labels[0].Text
+			if alias := b.Body.Attribute("alias"); alias != nil && alias.Literal != nil {
+				name += "." + alias.Literal.Text
+			}
+			g.def(ProviderKind, name, b.Labels[0])
+		case b.Type.Text == "locals" && n == 0:
+			for _, a := range b.Body.Attributes {
+				g.def(LocalKind, a.Name.Text, a.Name)
+			}
+		}
+	}
+}
+
+// refBlocks emits refs for the references in body's blocks and
+// attributes.
+func (g *grapher) refBlocks(body *Body) {
+	for _, a := range body.Attributes {
+		switch a.Name.Text {
+		case "provider", "providers":
+			for _, tr := range a.Traversals {
+				g.providerRef(tr)
+			}
+		default:
+			for _, tr := range a.Traversals {
+				g.traversalRef(tr)
+			}
+		}
+	}
+	for _, b := range body.Blocks {
+		if b.Type.Text == "module" && len(b.Labels) == 1 {
+			g.moduleCallRefs(b)
+		}
+		g.refBlocks(b.Body)
+	}
+}
+
+// moduleCallRefs emits refs for a module block's source and for its
+// arguments (to the called module's input variables).
+func (g *grapher) moduleCallRefs(b *Block) {
+	src := g.modules[b.Labels[0].Text]
+	if src == nil {
+		return
+	}
+	if a := b.Body.Attribute("source"); a != nil {
+		g.moduleRef(src, ".", a.Literal)
+	}
+	for _, a := range b.Body.Attributes {
+		if !moduleMetaArgs[a.Name.Text] {
+			g.moduleRef(src, VariableKind+"/"+a.Name.Text, a.Name)
+		}
+	}
+}
+
+// traversalRef emits refs for the defs that the traversal refers to.
+func (g *grapher) traversalRef(tr Traversal) {
+	if len(tr) < 2 {
+		return
+	}
+	switch root := tr[0].Text; root {
+	case "var", "local":
+		kind := VariableKind
+		if root == "local" {
+			kind = LocalKind
+		}
+		g.ref(kind+"/"+tr[1].Text, tr[0].Start, tr[1].End)
+	case "module":
+		g.ref(ModuleKind+"/"+tr[1].Text, tr[0].Start, tr[1].End)
+		if src := g.modules[tr[1].Text]; src != nil && len(tr) >= 3 {
+			g.moduleRef(src, OutputKind+"/"+tr[2].Text, tr[2])
+		}
+	case "data":
+		if len(tr) >= 3 {
+			g.ref(DataKind+"/"+tr[1].Text+"."+tr[2].Text, tr[0].Start, tr[2].End)
+		}
+	case "count", "each", "path", "self", "terraform":
+		// not references to defs
+	default:
+		g.ref(ResourceKind+"/"+root+"."+tr[1].Text, tr[0].Start, tr[1].End)
+	}
+}
+
+// providerRef emits a ref to the provider configuration (such as "aws"
+// or "aws.west") that the traversal refers to.
+func (g *grapher) providerRef(tr Traversal) {
+	if len(tr) >= 2 && g.ref(ProviderKind+"/"+tr[0].Text+"."+tr[1].Text, tr[0].Start, tr[1].End) {
+		return
+	}
+	g.ref(ProviderKind+"/"+tr[0].Text, tr[0].Start, tr[0].End)
+}
@@ -0,0 +1,544 @@
+package terraform
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// This file contains a parser for the subset of HCL's native syntax
+// that is needed to find the blocks, attributes, and references in
+// Terraform configurations. Expressions aren't parsed; only the
+// traversals (such as "var.region" or "aws_instance.web.id") in them
+// are recorded.
+
+// A Body is the contents of a configuration file or a block.
+type Body struct {
+	Attributes []*Attribute
+	Blocks     []*Block
+}
+
+// Attribute returns the attribute with the given name, or nil if
+// there is none.
+func (b *Body) Attribute(name string) *Attribute {
+	for _, a := range b.Attributes {
+		if a.Name.Text == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// A Block is a block (such as `resource "aws_instance" "web" {...}`).
+type Block struct {
+	Type   *Token
+	Labels []*Token
+	Body   *Body
+}
+
+// An Attribute is an attribute definition (such as `ami = var.ami`).
+type Attribute struct {
+	Name *Token
+
+	// Literal is the value of the attribute if it is a string literal
+	// without interpolations, or nil otherwise.
+	Literal *Token
+
+	// Traversals are the traversals in the attribute's value.
+	Traversals []Traversal
+}
+
+// A Traversal is a reference to a named value, such as "var.region" or
+// "module.vpc.outputs". Only attribute accesses are recorded; index
+// and splat operations are skipped.
+type Traversal []*Token
+
+// A Token is an identifier, or the contents of a string literal (with
+// escapes processed), at the given byte offsets.
+type Token struct {
+	Text       string
+	Start, End int
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNewline
+	tokIdent
+	tokNumber
+	tokPunct
+	tokOQuote        // opening quote of a string (or start of a heredoc)
+	tokCQuote        // closing quote of a string (or end of a heredoc)
+	tokStringLit     // literal part of a string
+	tokTemplateStart // "${" or "%{"
+	tokTemplateEnd   // "}" closing a template interpolation or directive
+)
+
+type token struct {
+	kind tokKind
+	Token
+}
+
+// lexer modes.
+const (
+	modeBrace    = iota // inside "{" in an expression or body
+	modeTemplate        // inside "${" or "%{"
+	modeQuoted          // inside a quoted string
+	modeHeredoc         // inside a heredoc
+)
+
+type mode struct {
+	kind int
+	term string // heredoc terminator
+}
+
+type lexer struct {
+	data  []byte
+	pos   int
+	modes []mode
+	err   error
+}
+
+func (l *lexer) top() int {
+	if len(l.modes) == 0 {
+		return modeBrace
+	}
+	return l.modes[len(l.modes)-1].kind
+}
+
+func (l *lexer) errorf(format string, args ...interface{}) {
+	if l.err == nil {
+		line := 1 + strings.Count(string(l.data[:l.pos]), "\n")
+		l.err = fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c == '-' || '0' <= c && c <= '9'
+}
+
+// multiCharPuncts are the operators that are lexed as single tokens, so
+// that (e.g.) "a == b" isn't mistaken for an attribute definition.
+var multiCharPuncts = []string{"==", "!=", "<=", ">=", "=>", "&&", "||", "..."}
+
+func (l *lexer) next() token {
+	switch l.top() {
+	case modeQuoted:
+		return l.nextQuoted()
+	case modeHeredoc:
+		return l.nextHeredoc()
+	}
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			l.pos++
+		case c == '#' || c == '/' && l.peek(1) == '/':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '/' && l.peek(1) == '*':
+			end := bytes.Index(l.data[l.pos+2:], []byte("*/"))
+			if end == -1 {
+				l.errorf("unterminated comment")
+				l.pos = len(l.data)
+			} else {
+				l.pos += 2 + end + 2
+			}
+		default:
+			return l.nextToken()
+		}
+	}
+	return token{kind: tokEOF, Token: Token{Start: l.pos, End: l.pos}}
+}
+
+func (l *lexer) peek(n int) byte {
+	if l.pos+n < len(l.data) {
+		return l.data[l.pos+n]
+	}
+	return 0
+}
+
+func (l *lexer) tok(kind tokKind, start int) token {
+	return token{kind: kind, Token: Token{Text: string(l.data[start:l.pos]), Start: start, End: l.pos}}
+}
+
+func (l *lexer) nextToken() token {
+	start := l.pos
+	c := l.data[l.pos]
+	switch {
+	case c == '\n':
+		l.pos++
+		return l.tok(tokNewline, start)
+	case c == '"':
+		l.pos++
+		l.modes = append(l.modes, mode{kind: modeQuoted})
+		return l.tok(tokOQuote, start)
+	case c == '<' && l.peek(1) == '<' && (isIdentStart(l.peek(2)) || l.peek(2) == '-' && isIdentStart(l.peek(3))):
+		l.pos += 2
+		if l.data[l.pos] == '-' {
+			l.pos++
+		}
+		termStart := l.pos
+		for l.pos < len(l.data) && isIdentChar(l.data[l.pos]) {
+			l.pos++
+		}
+		term := string(l.data[termStart:l.pos])
+		for l.pos < len(l.data) && l.data[l.pos] != '\n' {
+			l.pos++
+		}
+		if l.pos < len(l.data) {
+			l.pos++
+		}
+		l.modes = append(l.modes, mode{kind: modeHeredoc, term: term})
+		return l.tok(tokOQuote, start)
+	case isIdentStart(c):
+		for l.pos < len(l.data) && isIdentChar(l.data[l.pos]) {
+			l.pos++
+		}
+		return l.tok(tokIdent, start)
+	case '0' <= c && c <= '9':
+		for l.pos < len(l.data) && (isIdentChar(l.data[l.pos]) || l.data[l.pos] == '.' && '0' <= l.peek(1) && l.peek(1) <= '9') {
+			l.pos++
+		}
+		return l.tok(tokNumber, start)
+	case c == '{':
+		l.pos++
+		l.modes = append(l.modes, mode{kind: modeBrace})
+		return l.tok(tokPunct, start)
+	case c == '}':
+		l.pos++
+		if len(l.modes) == 0 {
+			return l.tok(tokPunct, start)
+		}
+		m := l.modes[len(l.modes)-1]
+		l.modes = l.modes[:len(l.modes)-1]
+		if m.kind == modeTemplate {
+			return l.tok(tokTemplateEnd, start)
+		}
+		return l.tok(tokPunct, start)
+	}
+	for _, p := range multiCharPuncts {
+		if bytes.HasPrefix(l.data[l.pos:], []byte(p)) {
+			l.pos += len(p)
+			return l.tok(tokPunct, start)
+		}
+	}
+	l.pos++
+	return l.tok(tokPunct, start)
+}
+
+// templateStart lexes a "${" or "%{" at the current position (in a
+// string), if there is one (and it isn't escaped as "$${" or "%%{").
+func (l *lexer) templateStart() (token, bool) {
+	if c := l.data[l.pos]; (c == '$' || c == '%') && l.peek(1) == '{' {
+		start := l.pos
+		l.pos += 2
+		l.modes = append(l.modes, mode{kind: modeTemplate})
+		return l.tok(tokTemplateStart, start), true
+	}
+	return token{}, false
+}
+
+func (l *lexer) nextQuoted() token {
+	if l.pos >= len(l.data) || l.data[l.pos] == '\n' {
+		l.errorf("unterminated string")
+		l.modes = l.modes[:len(l.modes)-1]
+		return l.next()
+	}
+	if l.data[l.pos] == '"' {
+		start := l.pos
+		l.pos++
+		l.modes = l.modes[:len(l.modes)-1]
+		return l.tok(tokCQuote, start)
+	}
+	if t, ok := l.templateStart(); ok {
+		return t
+	}
+	start := l.pos
+	var text []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '"' || c == '\n' || (c == '$' || c == '%') && l.peek(1) == '{' {
+			break
+		}
+		if c == '\\' && l.pos+1 < len(l.data) {
+			l.pos++
+			switch e := l.data[l.pos]; e {
+			case 'n':
+				text = append(text, '\n')
+			case 't':
+				text = append(text, '\t')
+			case 'r':
+				text = append(text, '\r')
+			default:
+				text = append(text, e)
+			}
+			l.pos++
+			continue
+		}
+		if (c == '$' || c == '%') && l.peek(1) == c && l.peek(2) == '{' {
+			text = append(text, c, '{')
+			l.pos += 3
+			continue
+		}
+		text = append(text, c)
+		l.pos++
+	}
+	return token{kind: tokStringLit, Token: Token{Text: string(text), Start: start, End: l.pos}}
+}
+
+func (l *lexer) nextHeredoc() token {
+	if l.pos >= len(l.data) {
+		l.errorf("unterminated heredoc")
+		l.modes = l.modes[:len(l.modes)-1]
+		return l.next()
+	}
+	term := l.modes[len(l.modes)-1].term
+	if l.pos == 0 || l.data[l.pos-1] == '\n' {
+		end := l.pos
+		for end < len(l.data) && l.data[end] != '\n' {
+			end++
+		}
+		if strings.TrimSpace(string(l.data[l.pos:end])) == term {
+			start := l.pos
+			l.pos = end
+			l.modes = l.modes[:len(l.modes)-1]
+			return l.tok(tokCQuote, start)
+		}
+	}
+	if t, ok := l.templateStart(); ok {
+		return t
+	}
+	start := l.pos
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if (c == '$' || c == '%') && l.peek(1) == c && l.peek(2) == '{' {
+			l.pos += 3 // escaped "$${" or "%%{"
+			continue
+		}
+		l.pos++
+		if c == '\n' || (l.peek(0) == '$' || l.peek(0) == '%') && l.peek(1) == '{' {
+			break
+		}
+	}
+	return l.tok(tokStringLit, start)
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+// Parse parses the HCL configuration file in data.
+func Parse(data []byte) (*Body, error) {
+	l := &lexer{data: data}
+	p := &parser{}
+	for {
+		t := l.next()
+		p.toks = append(p.toks, t)
+		if t.kind == tokEOF {
+			break
+		}
+	}
+	if l.err != nil {
+		return nil, l.err
+	}
+	body, err := p.parseBody(false)
+	if err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) advance() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("offset %d: %s", t.Start, fmt.Sprintf(format, args...))
+}
+
+func isPunct(t token, s string) bool { return t.kind == tokPunct && t.Text == s }
+
+// parseBody parses the attributes and blocks of a body, up to the
+// closing "}" of its block (if inBlock) or EOF.
+func (p *parser) parseBody(inBlock bool) (*Body, error) {
+	body := &Body{}
+	for {
+		t := p.advance()
+		switch {
+		case t.kind == tokNewline:
+			continue
+		case t.kind == tokEOF:
+			if inBlock {
+				return nil, p.errorf(t, "unexpected EOF in block")
+			}
+			return body, nil
+		case inBlock && isPunct(t, "}"):
+			return body, nil
+		case t.kind != tokIdent:
+			return nil, p.errorf(t, "unexpected %q (want attribute or block)", t.Text)
+		}
+		name := t.Token
+		if isPunct(p.peek(), "=") {
+			p.advance()
+			body.Attributes = append(body.Attributes, p.parseAttribute(&name))
+			continue
+		}
+		block := &Block{Type: &name}
+		for {
+			t := p.advance()
+			if isPunct(t, "{") {
+				break
+			}
+			switch t.kind {
+			case tokIdent:
+				label := t.Token
+				block.Labels = append(block.Labels, &label)
+			case tokOQuote:
+				label, err := p.parseLabel()
+				if err != nil {
+					return nil, err
+				}
+				block.Labels = append(block.Labels, label)
+			default:
+				return nil, p.errorf(t, "unexpected %q in block header", t.Text)
+			}
+		}
+		var err error
+		if block.Body, err = p.parseBody(true); err != nil {
+			return nil, err
+		}
+		body.Blocks = append(body.Blocks, block)
+	}
+}
+
+// parseLabel parses a quoted block label (after the opening quote).
+func (p *parser) parseLabel() (*Token, error) {
+	label := &Token{Start: p.peek().Start, End: p.peek().Start}
+	for {
+		t := p.advance()
+		switch t.kind {
+		case tokCQuote:
+			return label, nil
+		case tokStringLit:
+			label.Text += t.Text
+			label.End = t.End
+		default:
+			return nil, p.errorf(t, "block labels can't contain interpolations")
+		}
+	}
+}
+
+// keywords are the identifiers in expressions that aren't references.
+var keywords = map[string]bool{
+	"true": true, "false": true, "null": true,
+	"for": true, "in": true, "if": true, "else": true, "endif": true, "endfor": true,
+}
+
+// parseAttribute parses an attribute's value, which ends at a newline
+// (outside of brackets), or at the "}" that ends a single-line block.
+func (p *parser) parseAttribute(name *Token) *Attribute {
+	a := &Attribute{Name: name}
+	start := p.pos
+	var depth []string // open brackets
+	atKey := false     // whether an object key may come next
+	for {
+		t := p.peek()
+		if t.kind == tokEOF || len(depth) == 0 && (t.kind == tokNewline || isPunct(t, "}")) {
+			break
+		}
+		p.advance()
+		switch {
+		case t.kind == tokPunct && (t.Text == "{" || t.Text == "[" || t.Text == "("):
+			depth = append(depth, t.Text)
+			atKey = t.Text == "{"
+			continue
+		case t.kind == tokPunct && (t.Text == "}" || t.Text == "]" || t.Text == ")"):
+			if len(depth) > 0 {
+				depth = depth[:len(depth)-1]
+			}
+		case t.kind == tokTemplateStart, t.kind == tokOQuote:
+			depth = append(depth, t.Text)
+		case t.kind == tokTemplateEnd, t.kind == tokCQuote:
+			if len(depth) > 0 {
+				depth = depth[:len(depth)-1]
+			}
+		case t.kind == tokIdent:
+			inObject := len(depth) > 0 && depth[len(depth)-1] == "{"
+			next := p.peek()
+			switch {
+			case atKey && inObject && (isPunct(next, "=") || isPunct(next, ":")):
+				// object key
+			case isPunct(next, "(") || keywords[t.Text]:
+				// function call or keyword
+			default:
+				if !isPunct(p.toks[p.pos-2], ".") {
+					a.Traversals = append(a.Traversals, p.parseTraversal(t))
+				}
+			}
+		}
+		inObject := len(depth) > 0 && depth[len(depth)-1] == "{"
+		atKey = inObject && (t.kind == tokNewline || isPunct(t, ","))
+	}
+
+	// Record the value of string literals (such as module sources).
+	if toks := p.toks[start:p.pos]; len(toks) == 2 && toks[0].kind == tokOQuote && toks[1].kind == tokCQuote {
+		a.Literal = &Token{Start: toks[1].Start, End: toks[1].Start}
+	} else if len(toks) == 3 && toks[0].kind == tokOQuote && toks[1].kind == tokStringLit && toks[2].kind == tokCQuote {
+		a.Literal = &toks[1].Token
+	}
+	return a
+}
+
+// parseTraversal parses the attribute accesses after the root
+// identifier of a traversal.
+func (p *parser) parseTraversal(root token) Traversal {
+	tr := Traversal{&root.Token}
+	for {
+		t := p.peek()
+		switch {
+		case isPunct(t, ".") && p.toks[p.pos+1].kind == tokIdent:
+			p.advance()
+			name := p.advance().Token
+			tr = append(tr, &name)
+		case isPunct(t, ".") && (p.toks[p.pos+1].kind == tokNumber || isPunct(p.toks[p.pos+1], "*")):
+			p.advance()
+			p.advance()
+		case isPunct(t, "[") && p.isSimpleIndex():
+			// Skip a literal index or a splat ("[0]", "[\"a\"]", or
+			// "[*]"). Other index expressions end the traversal (and
+			// the traversals in them are recorded separately).
+			for !isPunct(p.advance(), "]") {
+			}
+		default:
+			return tr
+		}
+	}
+}
+
+// isSimpleIndex returns whether the tokens at the current position are
+// a literal index or a splat (such as "[0]", "["a"]", or "[*]").
+func (p *parser) isSimpleIndex() bool {
+	toks := p.toks[p.pos+1:]
+	switch {
+	case len(toks) >= 2 && (toks[0].kind == tokNumber || isPunct(toks[0], "*")):
+		return isPunct(toks[1], "]")
+	case len(toks) >= 4 && toks[0].kind == tokOQuote && toks[1].kind == tokStringLit && toks[2].kind == tokCQuote:
+		return isPunct(toks[3], "]")
+	}
+	return false
+}
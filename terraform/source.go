@@ -0,0 +1,135 @@
+package terraform
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// A Source is a parsed module source (the "source" argument of a
+// module block).
+type Source struct {
+	// Local is whether the module is in the same repository (and its
+	// source is a relative path, such as "./modules/vpc").
+	Local bool
+
+	// RepoURI is the URI of the repository that contains the module
+	// (such as "github.com/org/repo"), and CloneURL is its clone URL.
+	// Both are empty for local modules.
+	RepoURI, CloneURL string
+
+	// Dir is the path of the module's directory in the repository
+	// (relative to the referring module's directory, for local
+	// modules).
+	Dir string
+
+	// Ref is the Git ref of the repository to use (the "ref" query
+	// parameter), if any.
+	Ref string
+}
+
+// defaultRegistry is the host of the public Terraform Registry.
+const defaultRegistry = "registry.terraform.io"
+
+// ParseSource parses a module source. Local paths, GitHub and
+// Bitbucket shorthands, generic Git sources ("git::URL"), and the
+// public Terraform Registry's module addresses
+// ("namespace/name/provider") are supported.
+//
+// Modules in the public registry are resolved to the GitHub
+// repositories that the registry requires them to be published from
+// (named "terraform-PROVIDER-NAME"). Modules in private registries,
+// ones fetched over HTTP, from archives, or from cloud storage can't
+// be resolved.
+func ParseSource(source string) (*Source, error) {
+	if strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+		return &Source{Local: true, Dir: path.Clean(source)}, nil
+	}
+
+	// Split off the subdirectory ("//dir") and query ("?ref=v1").
+	s := &Source{Dir: "."}
+	rest := source
+	if i := strings.Index(rest, "?"); i != -1 {
+		q, err := url.ParseQuery(rest[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid module source %q: %s", source, err)
+		}
+		s.Ref = q.Get("ref")
+		rest = rest[:i]
+	}
+	schemeEnd := 0
+	if i := strings.Index(rest, "://"); i != -1 {
+		schemeEnd = i + len("://")
+	}
+	if i := strings.Index(rest[schemeEnd:], "//"); i != -1 {
+		s.Dir = path.Clean(rest[schemeEnd+i+2:])
+		rest = rest[:schemeEnd+i]
+	}
+
+	switch {
+	case strings.HasPrefix(rest, "git::"):
+		u := strings.TrimPrefix(rest, "git::")
+		uri, err := gitRepoURI(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid module source %q: %s", source, err)
+		}
+		s.RepoURI, s.CloneURL = uri, u
+		if strings.HasPrefix(u, "ssh://") {
+			s.CloneURL = "https://" + uri
+		}
+	case strings.HasPrefix(rest, "git@"):
+		uri, err := gitRepoURI(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid module source %q: %s", source, err)
+		}
+		s.RepoURI, s.CloneURL = uri, "https://"+uri
+	case strings.HasPrefix(rest, "github.com/") || strings.HasPrefix(rest, "bitbucket.org/"):
+		parts := strings.Split(strings.TrimSuffix(rest, ".git"), "/")
+		if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid module source %q (want %s/OWNER/REPO)", source, parts[0])
+		}
+		s.RepoURI = strings.Join(parts, "/")
+		s.CloneURL = "https://" + s.RepoURI
+	case strings.Contains(rest, "::") || strings.Contains(rest, "://"):
+		return nil, fmt.Errorf("unsupported module source %q", source)
+	default:
+		parts := strings.Split(rest, "/")
+		if len(parts) == 4 {
+			if parts[0] != defaultRegistry {
+				return nil, fmt.Errorf("module source %q is in a private registry", source)
+			}
+			parts = parts[1:]
+		}
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid module source %q (want NAMESPACE/NAME/PROVIDER)", source)
+		}
+		s.RepoURI = "github.com/" + parts[0] + "/terraform-" + parts[2] + "-" + parts[1]
+		s.CloneURL = "https://" + s.RepoURI
+	}
+	return s, nil
+}
+
+// gitRepoURI returns the repository URI (host and path, without a
+// ".git" suffix) of a Git URL or SCP-like address ("git@host:path").
+func gitRepoURI(s string) (string, error) {
+	if !strings.Contains(s, "://") {
+		i := strings.Index(s, ":")
+		if i == -1 {
+			return "", fmt.Errorf("invalid Git address %q", s)
+		}
+		host := s[:i]
+		if j := strings.Index(host, "@"); j != -1 {
+			host = host[j+1:]
+		}
+		s = "ssh://" + host + "/" + s[i+1:]
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return "", fmt.Errorf("invalid Git URL %q", s)
+	}
+	return u.Hostname() + "/" + strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"), nil
+}
@@ -0,0 +1,206 @@
+package terraform
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data := []byte(`# comment
+resource "aws_instance" "web" {
+  ami   = var.ami /* inline */ // trailing
+  tags  = { Name = "web-${var.env}", env = local.env }
+  count = length(var.zones) == 2 ? 1 : 0
+  user_data = <<-EOT
+    region=${data.aws_region.current.name}
+    literal=$${var.not_a_ref}
+  EOT
+  lifecycle { ignore_changes = [tags["x"], ami] }
+  subnet = aws_subnet.main[0].id
+  zone   = var.zones[var.index]
+}
+`)
+	body, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Blocks) != 1 {
+		t.Fatalf("got %d blocks, want 1", len(body.Blocks))
+	}
+	b := body.Blocks[0]
+	var labels []string
+	for _, l := range b.Labels {
+		labels = append(labels, l.Text+"@"+string(data[l.Start:l.End]))
+	}
+	if want := []string{"aws_instance@aws_instance", "web@web"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("got labels %q, want %q", labels, want)
+	}
+
+	var traversals []string
+	var collect func(*Body)
+	collect = func(body *Body) {
+		for _, a := range body.Attributes {
+			for _, tr := range a.Traversals {
+				s := ""
+				for i, tok := range tr {
+					if i > 0 {
+						s += "."
+					}
+					s += string(data[tok.Start:tok.End])
+				}
+				traversals = append(traversals, a.Name.Text+": "+s)
+			}
+		}
+		for _, b := range body.Blocks {
+			collect(b.Body)
+		}
+	}
+	collect(body)
+	want := []string{
+		"ami: var.ami",
+		"tags: var.env",
+		"tags: local.env",
+		"count: var.zones",
+		"user_data: data.aws_region.current.name",
+		"subnet: aws_subnet.main.id",
+		"zone: var.zones",
+		"zone: var.index",
+		"ignore_changes: tags",
+		"ignore_changes: ami",
+	}
+	if !reflect.DeepEqual(traversals, want) {
+		t.Errorf("got traversals %q, want %q", traversals, want)
+	}
+
+	for _, bad := range []string{`resource "a" {`, `x = "unterminated`, `"a" = 1`} {
+		if _, err := Parse([]byte(bad)); err == nil {
+			t.Errorf("%q: got no error", bad)
+		}
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	tests := map[string]Source{
+		"./modules/vpc": {Local: true, Dir: "modules/vpc"},
+		"../shared":     {Local: true, Dir: "../shared"},
+		"github.com/org/infra//modules/db?ref=v1.2":                          {RepoURI: "github.com/org/infra", CloneURL: "https://github.com/org/infra", Dir: "modules/db", Ref: "v1.2"},
+		"git::https://example.com/infra.git//vpc":                            {RepoURI: "example.com/infra", CloneURL: "https://example.com/infra.git", Dir: "vpc"},
+		"git::ssh://git@example.com/infra.git":                               {RepoURI: "example.com/infra", CloneURL: "https://example.com/infra", Dir: "."},
+		"git@github.com:org/mod.git?ref=main":                                {RepoURI: "github.com/org/mod", CloneURL: "https://github.com/org/mod", Dir: ".", Ref: "main"},
+		"terraform-aws-modules/vpc/aws":                                      {RepoURI: "github.com/terraform-aws-modules/terraform-aws-vpc", CloneURL: "https://github.com/terraform-aws-modules/terraform-aws-vpc", Dir: "."},
+		"registry.terraform.io/hashicorp/consul/aws//modules/consul-cluster": {RepoURI: "github.com/hashicorp/terraform-aws-consul", CloneURL: "https://github.com/hashicorp/terraform-aws-consul", Dir: "modules/consul-cluster"},
+	}
+	for source, want := range tests {
+		s, err := ParseSource(source)
+		if err != nil {
+			t.Errorf("%s: %s", source, err)
+			continue
+		}
+		if *s != want {
+			t.Errorf("%s: got %+v, want %+v", source, *s, want)
+		}
+	}
+	for _, source := range []string{"app.terraform.io/org/vpc/aws", "https://example.com/vpc.zip", "s3::https://s3.amazonaws.com/b/vpc.zip", "vpc", "github.com/org"} {
+		if _, err := ParseSource(source); err == nil {
+			t.Errorf("%q: got no error", source)
+		}
+	}
+}
+
+func TestGraph(t *testing.T) {
+	files := map[string][]byte{
+		"infra/main.tf": []byte(`provider "aws" {
+  region = var.region
+}
+provider "aws" {
+  alias  = "west"
+  region = "us-west-2"
+}
+module "vpc" {
+  source = "./modules/vpc"
+  cidr   = local.cidr
+}
+module "db" {
+  source    = "terraform-aws-modules/rds/aws"
+  version   = "~> 6.0"
+  subnets   = module.vpc.private_subnets
+  providers = { aws = aws.west }
+}
+resource "aws_instance" "web" {
+  provider   = aws.west
+  subnet_id  = module.vpc.private_subnets[0]
+  depends_on = [module.db]
+}
+data "aws_ami" "ubuntu" {}
+`),
+		"infra/variables.tf": []byte(`variable "region" {}
+locals {
+  cidr = "10.0.0.0/16"
+}
+output "web_ip" {
+  value = aws_instance.web.private_ip
+}
+output "ami" { value = data.aws_ami.ubuntu.id }
+`),
+	}
+	o, err := Graph("infra", files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var defs []string
+	for _, d := range o.Defs {
+		defs = append(defs, d.Kind+" "+d.Path)
+	}
+	sort.Strings(defs)
+	wantDefs := []string{
+		"data data/aws_ami.ubuntu",
+		"local local/cidr",
+		"module .", "module module/db", "module module/vpc",
+		"output output/ami", "output output/web_ip",
+		"provider provider/aws", "provider provider/aws.west",
+		"resource resource/aws_instance.web",
+		"var var/region",
+	}
+	if !reflect.DeepEqual(defs, wantDefs) {
+		t.Errorf("got defs %q, want %q", defs, wantDefs)
+	}
+
+	refs := map[string][]string{}
+	for _, r := range o.Refs {
+		if r.Def {
+			continue
+		}
+		key := r.DefPath
+		if r.DefUnitType != "" {
+			key = r.DefRepo + " " + r.DefUnit + " " + r.DefPath
+		}
+		refs[key] = append(refs[key], string(files[r.File][r.Start:r.End]))
+	}
+	want := map[string][]string{
+		"var/region":                  {"var.region"},
+		"local/cidr":                  {"local.cidr"},
+		"module/vpc":                  {"module.vpc", "module.vpc"},
+		"module/db":                   {"module.db"},
+		"provider/aws.west":           {"aws.west", "aws.west"},
+		"resource/aws_instance.web":   {"aws_instance.web"},
+		"data/aws_ami.ubuntu":         {"data.aws_ami.ubuntu"},
+		" infra/modules/vpc .":        {"./modules/vpc"},
+		" infra/modules/vpc var/cidr": {"cidr"},
+		" infra/modules/vpc output/private_subnets":                        {"private_subnets", "private_subnets"},
+		"github.com/terraform-aws-modules/terraform-aws-rds . .":           {"terraform-aws-modules/rds/aws"},
+		"github.com/terraform-aws-modules/terraform-aws-rds . var/subnets": {"subnets"},
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("got refs %v, want %v", refs, want)
+	}
+
+	sources, err := ModuleSources(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"terraform-aws-modules/rds/aws"}; !reflect.DeepEqual(sources, want) {
+		t.Errorf("got sources %q, want %q", sources, want)
+	}
+}
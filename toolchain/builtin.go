@@ -0,0 +1,112 @@
+package toolchain
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+)
+
+// A BuiltinTool implements a tool in a built-in toolchain. Like the
+// tools in toolchain programs, it is run (by RunBuiltinTool, in a
+// separate src process) with the tool's args, reads its input from
+// stdin, and writes its JSON output to stdout.
+type BuiltinTool func(args []string, stdin io.Reader, stdout io.Writer) error
+
+// A Builtin is a toolchain that is built into the src program, so it
+// needn't be installed in the SRCLIBPATH. Toolchains installed in the
+// SRCLIBPATH shadow built-in toolchains with the same path.
+type Builtin struct {
+	// Config is the toolchain's config (which would otherwise be read
+	// from its Srclibtoolchain file).
+	Config *Config
+
+	// Tools maps the subcommand names of the toolchain's tools to
+	// their implementations.
+	Tools map[string]BuiltinTool
+}
+
+// builtins holds the registered built-in toolchains, keyed by path.
+var builtins = map[string]*Builtin{}
+
+// RegisterBuiltin makes a built-in toolchain available at the given
+// toolchain path. If RegisterBuiltin is called twice with the same
+// path, if path is empty, or if b is nil, it panics.
+func RegisterBuiltin(path string, b *Builtin) {
+	if path == "" {
+		panic("toolchain: RegisterBuiltin path is empty")
+	}
+	if _, dup := builtins[path]; dup {
+		panic("toolchain: RegisterBuiltin called twice for path " + path)
+	}
+	if b == nil {
+		panic("toolchain: RegisterBuiltin toolchain is nil")
+	}
+	builtins[path] = b
+}
+
+// BuiltinArgs are the args to the src program that run a tool in a
+// built-in toolchain, which are followed by the toolchain path, the
+// tool's subcommand name, and the tool's args. The src program must
+// call RunBuiltinTool when it is run with them. (The "--" ensures
+// that the tool's args aren't parsed as src's own flags.)
+var BuiltinArgs = []string{"internal", "builtin-tool", "--"}
+
+// RunBuiltinTool runs the tool named subcmd in the built-in toolchain
+// at path.
+func RunBuiltinTool(path, subcmd string, args []string, stdin io.Reader, stdout io.Writer) error {
+	b, present := builtins[path]
+	if !present {
+		return fmt.Errorf("no built-in toolchain with path %q", path)
+	}
+	tool, present := b.Tools[subcmd]
+	if !present {
+		return fmt.Errorf("built-in toolchain %s has no tool %q", path, subcmd)
+	}
+	return tool(args, stdin, stdout)
+}
+
+// builtinInfos returns the Infos of the built-in toolchains (sorted by
+// path), except for those whose paths are in shadowed.
+func builtinInfos(shadowed map[string]string) []*Info {
+	var paths []string
+	for path := range builtins {
+		if _, present := shadowed[path]; !present {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	infos := make([]*Info, len(paths))
+	for i, path := range paths {
+		infos[i] = builtinInfo(path)
+	}
+	return infos
+}
+
+func builtinInfo(path string) *Info {
+	return &Info{Path: path, Program: "(built-in)", builtin: builtins[path]}
+}
+
+// A builtinToolchain is a built-in toolchain, which is run by running
+// the src program itself (see BuiltinArgs).
+type builtinToolchain struct {
+	path string
+}
+
+// IsBuilt always returns true for built-in toolchains.
+func (t *builtinToolchain) IsBuilt() (bool, error) { return true, nil }
+
+// Build is a no-op for built-in toolchains.
+func (t *builtinToolchain) Build() error { return nil }
+
+// Command returns an *exec.Cmd that runs the src program with
+// BuiltinArgs for this toolchain.
+func (t *builtinToolchain) Command() (*exec.Cmd, error) {
+	src, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	args := append(append([]string{}, BuiltinArgs...), t.path)
+	return exec.Command(src, args...), nil
+}
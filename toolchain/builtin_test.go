@@ -0,0 +1,103 @@
+package toolchain
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sourcegraph.com/sourcegraph/srclib"
+)
+
+func TestBuiltin(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "srclib-toolchain-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	defer func(orig string) {
+		srclib.Path = orig
+	}(srclib.Path)
+	srclib.Path = tmpdir
+
+	config := &Config{Tools: []*ToolInfo{{Subcmd: "graph", Op: "graph", SourceUnitTypes: []string{"T"}}}}
+	RegisterBuiltin("b/b", &Builtin{
+		Config: config,
+		Tools: map[string]BuiltinTool{
+			"graph": func(args []string, stdin io.Reader, stdout io.Writer) error {
+				_, err := io.Copy(stdout, stdin)
+				return err
+			},
+		},
+	})
+	RegisterBuiltin("s/s", &Builtin{Config: &Config{}})
+	defer func() {
+		delete(builtins, "b/b")
+		delete(builtins, "s/s")
+	}()
+
+	// Shadow s/s with an installed toolchain.
+	for _, f := range []string{"s/s/Srclibtoolchain", "s/s/.bin/s"} {
+		f = filepath.Join(tmpdir, f)
+		if err := os.MkdirAll(filepath.Dir(f), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(f, []byte("{}"), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tcs) != 2 || tcs[0].Path != "s/s" || tcs[0].builtin != nil || tcs[1].Path != "b/b" || tcs[1].builtin == nil {
+		t.Errorf("got toolchains %+v, want installed s/s and built-in b/b", tcs)
+	}
+
+	tc, err := Lookup("b/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := tc.ReadConfig(); err != nil || c != config {
+		t.Errorf("got config %+v (err %v), want the built-in config", c, err)
+	}
+
+	tool, err := chooseTool("graph", "T", tcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tool.Toolchain != "b/b" || tool.Subcmd != "graph" {
+		t.Errorf("got tool %v, want b/b graph", tool)
+	}
+
+	// Installed toolchains' tools take precedence.
+	installed := &Info{Path: "i/i", ConfigFile: filepath.Join(tmpdir, "i/i/Srclibtoolchain")}
+	if err := os.MkdirAll(filepath.Dir(installed.ConfigFile), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(installed.ConfigFile, []byte(`{"Tools":[{"Subcmd":"g","Op":"graph","SourceUnitTypes":["T"]}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tool, err = chooseTool("graph", "T", append(tcs, installed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tool.Toolchain != "i/i" {
+		t.Errorf("got tool %v, want installed i/i tool", tool)
+	}
+
+	var out bytes.Buffer
+	if err := RunBuiltinTool("b/b", "graph", nil, bytes.NewReader([]byte("x")), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "x" {
+		t.Errorf("got output %q, want %q", out.String(), "x")
+	}
+	if err := RunBuiltinTool("b/b", "scan", nil, nil, &out); err == nil {
+		t.Error("got no error for nonexistent tool")
+	}
+}
@@ -0,0 +1,44 @@
+package toolchain
+
+import (
+	"context"
+	"os/exec"
+)
+
+// KillOnCancel kills cmd's process if ctx is done before stop is
+// called. It must be called after cmd is started, and stop must be
+// called after cmd exits (e.g., after cmd.Wait returns). It prevents
+// tool processes from being orphaned when an operation is cancelled.
+func KillOnCancel(ctx context.Context, cmd *exec.Cmd) (stop func()) {
+	done, exited := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			cmd.Process.Kill()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// RunCmd starts cmd and waits for it to complete, killing it if ctx
+// is done first. If ctx is done, ctx.Err() is returned.
+func RunCmd(ctx context.Context, cmd *exec.Cmd) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	stop := KillOnCancel(ctx, cmd)
+	err := cmd.Wait()
+	stop()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
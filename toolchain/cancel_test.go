@@ -0,0 +1,80 @@
+package toolchain
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestRunCmd(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep command")
+	}
+
+	if err := RunCmd(context.Background(), exec.Command("true")); err != nil {
+		t.Errorf("true: %s", err)
+	}
+	if err := RunCmd(context.Background(), exec.Command("false")); err == nil {
+		t.Error("false: got no error")
+	}
+
+	// A cancelled context's command isn't started.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cmd := exec.Command("true")
+	if err := RunCmd(ctx, cmd); err != context.Canceled {
+		t.Errorf("cancelled: got error %v, want %v", err, context.Canceled)
+	}
+	if cmd.Process != nil {
+		t.Error("cancelled: command was started")
+	}
+
+	// A command that outlives its context is killed.
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	cmd = exec.Command("sleep", "10")
+	if err := RunCmd(ctx, cmd); err != context.DeadlineExceeded {
+		t.Errorf("timed out: got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("timed out: command ran for %s, want it killed", d)
+	}
+	if cmd.ProcessState == nil || cmd.ProcessState.Success() {
+		t.Errorf("timed out: got process state %v, want killed", cmd.ProcessState)
+	}
+}
+
+func TestKillOnCancel(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("no sleep command")
+	}
+
+	// stop prevents the process from being killed.
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.Command("sleep", "0.1")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	stop := KillOnCancel(ctx, cmd)
+	stop()
+	cancel()
+	if err := cmd.Wait(); err != nil {
+		t.Errorf("stopped: got error %v, want the command to exit normally", err)
+	}
+
+	// Cancelling the context kills the process.
+	ctx, cancel = context.WithCancel(context.Background())
+	cmd = exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	stop = KillOnCancel(ctx, cmd)
+	cancel()
+	err := cmd.Wait()
+	stop()
+	if err == nil {
+		t.Error("cancelled: got no error, want the command to be killed")
+	}
+}
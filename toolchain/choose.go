@@ -25,8 +25,10 @@ var (
 //
 // The selection algorithm is currently very simplistic: if exactly one tool is
 // found that can perform op on the source unit type, it is returned. If zero or
-// more than 1 are found, then an error is returned. TODO(sqs): extend this to
-// choose the "best" tool when multiple tools would suffice.
+// more than 1 are found, then an error is returned. Tools in built-in
+// toolchains are only considered if no installed toolchain's tool fits.
+// TODO(sqs): extend this to choose the "best" tool when multiple tools would
+// suffice.
 func ChooseTool(op, unitType string) (*srclib.ToolRef, error) {
 	if noToolchains {
 		return noneToolchain, nil
@@ -41,7 +43,7 @@ func ChooseTool(op, unitType string) (*srclib.ToolRef, error) {
 // chooseTool is like ChooseTool but the list of tools is provided as an
 // argument instead of being obtained by calling List.
 func chooseTool(op, unitType string, tcs []*Info) (*srclib.ToolRef, error) {
-	var satisfying []*srclib.ToolRef
+	var satisfying, builtin []*srclib.ToolRef
 	for _, tc := range tcs {
 		cfg, err := tc.ReadConfig()
 		if err != nil {
@@ -51,14 +53,26 @@ func chooseTool(op, unitType string, tcs []*Info) (*srclib.ToolRef, error) {
 		for _, tool := range cfg.Tools {
 			if tool.Op == op {
 				for _, u := range tool.SourceUnitTypes {
-					if u == unitType {
-						satisfying = append(satisfying, &srclib.ToolRef{Toolchain: tc.Path, Subcmd: tool.Subcmd})
+					if u != unitType {
+						continue
+					}
+					ref := &srclib.ToolRef{Toolchain: tc.Path, Subcmd: tool.Subcmd}
+					if tc.builtin != nil {
+						builtin = append(builtin, ref)
+					} else {
+						satisfying = append(satisfying, ref)
 					}
 				}
 			}
 		}
 	}
 
+	// Installed toolchains take precedence over built-in toolchains
+	// for the same source unit type.
+	if len(satisfying) == 0 {
+		satisfying = builtin
+	}
+
 	if n := len(satisfying); n == 0 {
 		return nil, fmt.Errorf("no tool satisfies op %q for source unit type %q", op, unitType)
 	} else if n > 1 {
@@ -1,5 +1,12 @@
 package toolchain
 
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
 // ConfigFilename is the filename of the toolchain configuration file. The
 // presence of this file in a directory signifies that a srclib toolchain is
 // defined in that directory.
@@ -9,4 +16,79 @@ const ConfigFilename = "Srclibtoolchain"
 type Config struct {
 	// Tools is the list of this toolchain's tools and their definitions.
 	Tools []*ToolInfo
+
+	// UnitConfigSchema describes the source unit Config properties that
+	// this toolchain's tools accept (such as "PythonVersion" or "GOOS").
+	// Source unit Config properties that are listed here are validated
+	// (by `src config`) before the source unit is passed to the tools.
+	// Properties that are not listed here are not validated, since
+	// they may be intended for other toolchains.
+	UnitConfigSchema map[string]*ConfigProperty `json:",omitempty"`
+}
+
+// A ConfigProperty describes a source unit Config property.
+type ConfigProperty struct {
+	// Type is the JSON type of the property's value: "string",
+	// "number", "boolean", "array", or "object".
+	Type string
+
+	// Enum, if non-empty, lists the allowed values of the property.
+	Enum []interface{} `json:",omitempty"`
+
+	// Description describes the property.
+	Description string `json:",omitempty"`
+}
+
+// ValidateUnitConfig checks the properties in a source unit's Config
+// against c.UnitConfigSchema.
+func (c *Config) ValidateUnitConfig(config map[string]interface{}) error {
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		p, present := c.UnitConfigSchema[k]
+		if !present {
+			continue
+		}
+		v := config[k]
+		if typ := jsonType(v); p.Type != "" && typ != p.Type {
+			return fmt.Errorf("property %q has type %s, want %s", k, typ, p.Type)
+		}
+		if len(p.Enum) > 0 {
+			ok := false
+			for _, e := range p.Enum {
+				if reflect.DeepEqual(e, v) {
+					ok = true
+					break
+				}
+			}
+			if !ok {
+				return fmt.Errorf("property %q has value %v, want one of %v", k, v, p.Enum)
+			}
+		}
+	}
+	return nil
+}
+
+// jsonType returns the JSON type of v, which must be a value decoded
+// by encoding/json.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64, int, int64, json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
 }
@@ -0,0 +1,39 @@
+package toolchain
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConfig_ValidateUnitConfig(t *testing.T) {
+	var c *Config
+	if err := json.Unmarshal([]byte(`{
+  "UnitConfigSchema": {
+    "PythonVersion": {"Type": "string", "Enum": ["2", "3"]},
+    "Tags": {"Type": "array"}
+  }
+}`), &c); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		config  string
+		wantErr bool
+	}{
+		{`{}`, false},
+		{`{"PythonVersion": "3", "Tags": ["a"], "Other": 1}`, false},
+		{`{"PythonVersion": "4"}`, true},
+		{`{"PythonVersion": 3}`, true},
+		{`{"Tags": "a"}`, true},
+	}
+	for _, test := range tests {
+		var config map[string]interface{}
+		if err := json.Unmarshal([]byte(test.config), &config); err != nil {
+			t.Fatal(err)
+		}
+		err := c.ValidateUnitConfig(config)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%s: got error %v, want error: %v", test.config, err, test.wantErr)
+		}
+	}
+}
@@ -18,3 +18,13 @@ func newDockerClient() (*docker.Client, error) {
 	}
 	return docker.NewClient(dockerEndpoint)
 }
+
+// PingDocker returns an error if Docker (at DOCKER_HOST or the default
+// socket) is not reachable.
+func PingDocker() error {
+	dc, err := newDockerClient()
+	if err != nil {
+		return err
+	}
+	return dc.Ping()
+}
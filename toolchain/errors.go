@@ -0,0 +1,58 @@
+package toolchain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A RunError reports that a tool could not be started or that it
+// exited unsuccessfully (e.g., the toolchain crashed).
+type RunError struct {
+	// Tool is the toolchain path and subcommand of the tool.
+	Tool string
+
+	// Unit is the type and name of the source unit that the tool ran
+	// on, if any.
+	Unit string
+
+	// Args is the tool's command-line arguments.
+	Args []string
+
+	// Err is the underlying error (often an *exec.ExitError).
+	Err error
+}
+
+func (e *RunError) Error() string {
+	return fmt.Sprintf("tool %s failed%s (args: %s): %s", e.Tool, onUnit(e.Unit), strings.Join(e.Args, " "), e.Err)
+}
+
+func (e *RunError) Unwrap() error { return e.Err }
+
+// An OutputError reports that a tool exited successfully but its
+// output could not be parsed.
+type OutputError struct {
+	// Tool is the toolchain path and subcommand of the tool.
+	Tool string
+
+	// Unit is the type and name of the source unit that the tool ran
+	// on, if any.
+	Unit string
+
+	// Err is the underlying decoding error.
+	Err error
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("tool %s produced invalid output%s: %s", e.Tool, onUnit(e.Unit), e.Err)
+}
+
+func (e *OutputError) Unwrap() error { return e.Err }
+
+// onUnit returns " on unit UNIT" for use in error messages, or "" if
+// unit is empty.
+func onUnit(unit string) string {
+	if unit == "" {
+		return ""
+	}
+	return " on unit " + unit
+}
@@ -13,6 +13,8 @@ import (
 
 // Lookup finds a toolchain by path in the SRCLIBPATH. For each DIR in
 // SRCLIBPATH, it checks for the existence of DIR/PATH/Srclibtoolchain.
+// If there is none, it returns the built-in toolchain with the path,
+// if any.
 func Lookup(path string) (*Info, error) {
 	if noToolchains {
 		return nil, nil
@@ -26,6 +28,9 @@ func Lookup(path string) (*Info, error) {
 	}
 
 	if len(matches) == 0 {
+		if _, present := builtins[path]; present {
+			return builtinInfo(path), nil
+		}
 		return nil, os.ErrNotExist
 	}
 	if len(matches) > 1 {
@@ -34,7 +39,8 @@ func Lookup(path string) (*Info, error) {
 	return newInfo(path, filepath.Dir(matches[0]), ConfigFilename)
 }
 
-// List finds all toolchains in the SRCLIBPATH.
+// List finds all toolchains in the SRCLIBPATH, followed by the
+// built-in toolchains that they don't shadow.
 //
 // List does not find nested toolchains; i.e., if DIR is a toolchain
 // dir (with a DIR/Srclibtoolchain file), then none of DIR's
@@ -121,7 +127,7 @@ func List() ([]*Info, error) {
 			}
 		}
 	}
-	return found, nil
+	return append(found, builtinInfos(seen)...), nil
 }
 
 func newInfo(toolchainPath, dir, configFile string) (*Info, error) {
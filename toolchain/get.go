@@ -24,6 +24,9 @@ func Get(path string, update bool) (*Info, error) {
 	dir := strings.SplitN(srclib.Path, ":", 2)[0]
 	toolchainDir := filepath.Join(dir, path)
 
+	if err := srclib.CheckOnline("downloading toolchain " + path); err != nil {
+		return nil, err
+	}
 	if fi, err := os.Stat(toolchainDir); os.IsNotExist(err) {
 		// older gits don't heed git https redirects, so manually substitute in
 		// the github.com clone url for sourcegraph.com clone urls
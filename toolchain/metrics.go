@@ -0,0 +1,41 @@
+package toolchain
+
+import (
+	"context"
+
+	"sourcegraph.com/sourcegraph/srclib/metrics"
+)
+
+// toolRunsMetric is the name of the metric that counts tool runs,
+// labeled by tool and result.
+const toolRunsMetric = "srclib_tool_runs_total"
+
+func init() {
+	metrics.Describe(toolRunsMetric, "Number of tool runs, by tool and result (ok, run_error, output_error, timeout, or cancelled).")
+}
+
+// RecordRun records the result of running tool in the Default metrics
+// registry.
+func RecordRun(tool string, err error) {
+	metrics.Inc(toolRunsMetric, "tool", tool, "result", runResult(err))
+}
+
+func runResult(err error) string {
+	switch err.(type) {
+	case nil:
+		return "ok"
+	case *RunError:
+		return "run_error"
+	case *OutputError:
+		return "output_error"
+	case *TimeoutError:
+		return "timeout"
+	}
+	if err == context.DeadlineExceeded {
+		return "timeout"
+	}
+	if err == context.Canceled {
+		return "cancelled"
+	}
+	return "run_error"
+}
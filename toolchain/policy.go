@@ -0,0 +1,136 @@
+package toolchain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// A RunPolicy limits how long a tool operation may run and how many
+// times it is retried if it fails.
+type RunPolicy struct {
+	// Timeout is the maximum duration of each attempt (0 means no
+	// timeout).
+	Timeout time.Duration
+
+	// Retries is the number of times a failed attempt is retried.
+	// Only failures that may be transient are retried: attempts that
+	// time out, tools that exit with TransientExitCode, and tools
+	// that are killed by a signal (e.g., by the kernel when it runs
+	// out of memory). Other failures (such as other exit statuses,
+	// failures to start the tool, invalid output, and cancellation)
+	// are not retried.
+	Retries int
+
+	// Backoff is the delay before the first retry. It doubles after
+	// each retry.
+	Backoff time.Duration
+}
+
+// DefaultRetryBackoff is the initial retry backoff delay used when
+// RunPolicy.Backoff is 0.
+const DefaultRetryBackoff = 2 * time.Second
+
+// Do calls f until it succeeds or the policy's retries are exhausted,
+// logging each failed attempt to l. Each call's context is derived from
+// ctx and is done when the attempt times out.
+func (p RunPolicy) Do(ctx context.Context, l *log.Logger, f func(ctx context.Context) error) error {
+	backoff := p.Backoff
+	if backoff == 0 {
+		backoff = DefaultRetryBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		err := p.attempt(ctx, f)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || !isTransient(err) || attempt >= p.Retries {
+			return err
+		}
+
+		l.Printf("Attempt %d of %d failed (%s); retrying in %s.", attempt+1, p.Retries+1, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (p RunPolicy) attempt(ctx context.Context, f func(ctx context.Context) error) error {
+	if p.Timeout == 0 {
+		return f(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	err := f(ctx)
+	if err == context.DeadlineExceeded {
+		return &TimeoutError{Timeout: p.Timeout}
+	}
+	return err
+}
+
+// TransientExitCode is the exit status with which a tool reports a
+// failure that may succeed if the tool is run again (EX_TEMPFAIL in
+// sysexits.h). See RunPolicy.Retries.
+const TransientExitCode = 75
+
+// isTransient returns whether err may be caused by a transient
+// failure (so the operation may succeed if it is retried).
+func isTransient(err error) bool {
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return true
+	}
+	var runErr *RunError
+	if !errors.As(err, &runErr) {
+		return false
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(runErr.Err, &exitErr) {
+		return false
+	}
+	// ExitCode is -1 if the tool was killed by a signal.
+	code := exitErr.ExitCode()
+	return code == TransientExitCode || code == -1
+}
+
+// A TimeoutError reports that a tool operation did not complete
+// within its RunPolicy's timeout.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timed out after %s", e.Timeout)
+}
+
+// ParseOpTimeouts parses a list of per-operation timeouts of the form
+// "OP=DURATION" (e.g., "depresolve=10m"). An entry with no "OP="
+// prefix applies to all operations that are not listed explicitly;
+// it is stored under the key "".
+func ParseOpTimeouts(specs []string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration, len(specs))
+	for _, spec := range specs {
+		var op, durStr string
+		if i := strings.Index(spec, "="); i != -1 {
+			op, durStr = spec[:i], spec[i+1:]
+		} else {
+			durStr = spec
+		}
+		d, err := time.ParseDuration(durStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout %q: %s", spec, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q: must be positive", spec)
+		}
+		timeouts[op] = d
+	}
+	return timeouts, nil
+}
@@ -0,0 +1,135 @@
+package toolchain
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// exitError returns the error of running the shell script, which must
+// fail.
+func exitError(t *testing.T, script string) error {
+	err := exec.Command("sh", "-c", script).Run()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatalf("got error %v running %q, want *exec.ExitError", err, script)
+	}
+	return err
+}
+
+func TestRunPolicy_Do(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh command")
+	}
+	l := log.New(ioutil.Discard, "", 0)
+	transient := &RunError{Err: exitError(t, "exit 75")}
+	tests := map[string]struct {
+		policy    RunPolicy
+		errs      []error // error returned by each attempt
+		wantCalls int
+		wantErr   bool
+	}{
+		"success": {
+			policy:    RunPolicy{Retries: 2},
+			errs:      []error{nil},
+			wantCalls: 1,
+		},
+		"retry then success": {
+			policy:    RunPolicy{Retries: 2, Backoff: time.Millisecond},
+			errs:      []error{transient, nil},
+			wantCalls: 2,
+		},
+		"retries exhausted": {
+			policy:    RunPolicy{Retries: 2, Backoff: time.Millisecond},
+			errs:      []error{transient, transient, transient},
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		"killed by signal": {
+			policy:    RunPolicy{Retries: 2, Backoff: time.Millisecond},
+			errs:      []error{&RunError{Err: exitError(t, "kill -9 $$")}, nil},
+			wantCalls: 2,
+		},
+		"timeout": {
+			policy:    RunPolicy{Retries: 2, Backoff: time.Millisecond},
+			errs:      []error{&TimeoutError{}, nil},
+			wantCalls: 2,
+		},
+		"exit status": {
+			policy:    RunPolicy{Retries: 2, Backoff: time.Millisecond},
+			errs:      []error{&RunError{Err: exitError(t, "exit 1")}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		"failed to start": {
+			policy:    RunPolicy{Retries: 2, Backoff: time.Millisecond},
+			errs:      []error{&RunError{Err: exec.ErrNotFound}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		"not transient": {
+			policy:    RunPolicy{Retries: 2, Backoff: time.Millisecond},
+			errs:      []error{&OutputError{}},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		"other error": {
+			policy:    RunPolicy{Retries: 2, Backoff: time.Millisecond},
+			errs:      []error{errors.New("x")},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+	for label, test := range tests {
+		calls := 0
+		err := test.policy.Do(context.Background(), l, func(ctx context.Context) error {
+			err := test.errs[calls]
+			calls++
+			return err
+		})
+		if calls != test.wantCalls {
+			t.Errorf("%s: got %d calls, want %d", label, calls, test.wantCalls)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error %v", label, err, test.wantErr)
+		}
+	}
+}
+
+func TestRunPolicy_Do_timeout(t *testing.T) {
+	l := log.New(ioutil.Discard, "", 0)
+	p := RunPolicy{Timeout: time.Millisecond, Retries: 1, Backoff: time.Millisecond}
+	calls := 0
+	err := p.Do(context.Background(), l, func(ctx context.Context) error {
+		calls++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if _, ok := err.(*TimeoutError); !ok {
+		t.Errorf("got error %v, want *TimeoutError", err)
+	}
+	if calls != 2 {
+		t.Errorf("got %d calls, want 2", calls)
+	}
+}
+
+func TestParseOpTimeouts(t *testing.T) {
+	got, err := ParseOpTimeouts([]string{"30m", "depresolve=10m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]time.Duration{"": 30 * time.Minute, "depresolve": 10 * time.Minute}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, spec := range []string{"graph=x", "graph=0", "-1m", "0s"} {
+		if _, err := ParseOpTimeouts([]string{spec}); err == nil {
+			t.Errorf("%q: got nil error for invalid timeout", spec)
+		}
+	}
+}
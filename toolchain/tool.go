@@ -1,14 +1,18 @@
 package toolchain
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 
 	"sourcegraph.com/sourcegraph/srclib"
+	"sourcegraph.com/sourcegraph/srclib/tracing"
+	"sourcegraph.com/sourcegraph/srclib/unit"
 )
 
 // ToolInfo describes a tool in a toolchain.
@@ -68,7 +72,7 @@ func OpenTool(toolchain, subcmd string, mode Mode) (Tool, error) {
 		return nil, fmt.Errorf("failed to open tool (%s %s): %s", toolchain, subcmd, err)
 	}
 
-	return &tool{tc, subcmd, log.New(os.Stderr, "", 0)}, nil
+	return &tool{toolchain, tc, subcmd, log.New(os.Stderr, "", 0)}, nil
 }
 
 // A Tool is a subcommand of a Toolchain that performs an single operation, such
@@ -79,13 +83,16 @@ type Tool interface {
 
 	// Run executes this tool with args (sending the JSON-serialization of input
 	// on stdin, if input is non-nil) and parses the JSON response into resp.
-	Run(arg []string, input, resp interface{}) error
+	// If ctx is done before the tool exits, the tool's process is killed and
+	// ctx.Err() is returned.
+	Run(ctx context.Context, arg []string, input, resp interface{}) error
 
 	// SetLogger sets the logger for Tool to l.
 	SetLogger(l *log.Logger)
 }
 
 type tool struct {
+	path   string // toolchain path
 	tc     Toolchain
 	subcmd string
 	log    *log.Logger
@@ -109,7 +116,17 @@ func (t *tool) Command() (*exec.Cmd, error) {
 }
 
 // TODO(sqs): is it possible for an early return to leave the subprocess running?
-func (t *tool) Run(arg []string, input, resp interface{}) error {
+func (t *tool) Run(ctx context.Context, arg []string, input, resp interface{}) (err error) {
+	ctx, span := tracing.Start(ctx, "tool "+t.String())
+	defer func() {
+		RecordRun(t.String(), err)
+		EndToolSpan(span, err)
+	}()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	cmd, err := t.Command()
 	if err != nil {
 		return err
@@ -118,6 +135,7 @@ func (t *tool) Run(arg []string, input, resp interface{}) error {
 	cmd.Stderr = os.Stderr
 
 	t.log.Printf("Running: %v", cmd.Args)
+	span.SetAttributes("args", cmd.Args)
 
 	var stdin io.WriteCloser
 	if input != nil {
@@ -133,29 +151,57 @@ func (t *tool) Run(arg []string, input, resp interface{}) error {
 		}
 	}
 
+	var unitName string
+	if u, ok := input.(*unit.SourceUnit); ok {
+		unitName = u.Type + " " + u.Name
+	}
+
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return err
 	}
 	if err := cmd.Start(); err != nil {
-		return err
+		return &RunError{Tool: t.String(), Unit: unitName, Args: cmd.Args, Err: err}
 	}
+	stop := KillOnCancel(ctx, cmd)
+	defer stop()
 
 	if input != nil {
 		if err := json.NewEncoder(stdin).Encode(input); err != nil {
-			return err
+			// The tool may be blocked writing output that nothing
+			// reads, so kill it instead of waiting for it to exit.
+			cmd.Process.Kill()
+			cmd.Wait()
+			return &RunError{Tool: t.String(), Unit: unitName, Args: cmd.Args, Err: err}
 		}
 		if err := stdin.Close(); err != nil {
 			return err
 		}
 	}
 
-	if err := json.NewDecoder(stdout).Decode(resp); err != nil {
-		return err
+	// If the tool crashed, its (likely truncated) output will fail to
+	// decode, so report the exit status instead of the decoding error.
+	// Read the rest of the output (after the response, or after the
+	// point where it failed to decode) so that the tool isn't blocked
+	// writing it and can exit.
+	out := &countingReader{r: stdout}
+	decErr := json.NewDecoder(out).Decode(resp)
+	io.Copy(ioutil.Discard, out)
+	err = cmd.Wait()
+	SetToolSpanResult(span, cmd, out.n)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
 	}
-	if err := cmd.Wait(); err != nil {
-		return err
+	if err != nil {
+		return &RunError{Tool: t.String(), Unit: unitName, Args: cmd.Args, Err: err}
+	}
+	if decErr != nil {
+		return &OutputError{Tool: t.String(), Unit: unitName, Err: decErr}
 	}
 
 	return nil
 }
+
+func (t *tool) String() string {
+	return fmt.Sprintf("%s %s", t.path, t.subcmd)
+}
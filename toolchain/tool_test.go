@@ -0,0 +1,98 @@
+package toolchain
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"sourcegraph.com/sourcegraph/srclib/unit"
+)
+
+// shToolchain is a toolchain whose tools run a shell script.
+type shToolchain string
+
+func (tc shToolchain) Command() (*exec.Cmd, error) { return exec.Command("sh", "-c", string(tc)), nil }
+func (tc shToolchain) Build() error                { return nil }
+func (tc shToolchain) IsBuilt() (bool, error)      { return true, nil }
+
+func TestTool_Run(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh command")
+	}
+
+	u := &unit.SourceUnit{Type: "t", Name: "u"}
+	tests := map[string]struct {
+		script     string
+		want       string // the decoded response, if no error
+		wantErr    interface{}
+		wantExit   bool // whether the error wraps an *exec.ExitError
+		wantErrStr string
+	}{
+		"ok": {
+			script: `echo '"a"'`,
+			want:   "a",
+		},
+		"trailing output": {
+			script: `echo '"a"'; head -c 1000000 /dev/zero`,
+			want:   "a",
+		},
+		"invalid output": {
+			script:     `echo '{'`,
+			wantErr:    &OutputError{},
+			wantErrStr: "produced invalid output on unit t u",
+		},
+		"invalid output and more": {
+			// The tool blocks writing its output until it is read.
+			script:  `echo x; head -c 1000000 /dev/zero`,
+			wantErr: &OutputError{},
+		},
+		"crash": {
+			script:     `echo '{'; exit 3`,
+			wantErr:    &RunError{},
+			wantExit:   true,
+			wantErrStr: "failed on unit t u",
+		},
+	}
+	for label, test := range tests {
+		tl := &tool{path: "tc", tc: shToolchain(test.script), subcmd: "graph", log: log.New(ioutil.Discard, "", 0)}
+		var resp string
+		done := make(chan error, 1)
+		go func() { done <- tl.Run(context.Background(), nil, u, &resp) }()
+		var err error
+		select {
+		case err = <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s: Run did not return", label)
+		}
+
+		switch want := test.wantErr.(type) {
+		case nil:
+			if err != nil {
+				t.Errorf("%s: %s", label, err)
+			} else if resp != test.want {
+				t.Errorf("%s: got response %q, want %q", label, resp, test.want)
+			}
+			continue
+		case *OutputError:
+			if !errors.As(err, &want) {
+				t.Errorf("%s: got error %v, want *OutputError", label, err)
+			}
+		case *RunError:
+			if !errors.As(err, &want) {
+				t.Errorf("%s: got error %v, want *RunError", label, err)
+			}
+		}
+		var exitErr *exec.ExitError
+		if got := errors.As(err, &exitErr); got != test.wantExit {
+			t.Errorf("%s: got error %v wrapping *exec.ExitError == %v, want %v", label, err, got, test.wantExit)
+		}
+		if err != nil && !strings.Contains(err.Error(), test.wantErrStr) {
+			t.Errorf("%s: got error %q, want it to contain %q", label, err, test.wantErrStr)
+		}
+	}
+}
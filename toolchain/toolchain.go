@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/fsouza/go-dockerclient"
+	"sourcegraph.com/sourcegraph/srclib"
 )
 
 // Info describes a toolchain.
@@ -35,11 +36,18 @@ type Info struct {
 	// the image to build and run to invoke this toolchain, for the Docker
 	// container execution method.
 	Dockerfile string `json:",omitempty"`
+
+	// builtin is the built-in toolchain, if this is one (see
+	// RegisterBuiltin). Built-in toolchains have no Dir.
+	builtin *Builtin
 }
 
 // ReadConfig reads and parses the Srclibtoolchain config file for the
 // toolchain.
 func (t *Info) ReadConfig() (*Config, error) {
+	if t.builtin != nil {
+		return t.builtin.Config, nil
+	}
 	f, err := os.Open(filepath.Join(t.Dir, t.ConfigFile))
 	if err != nil {
 		return nil, err
@@ -82,6 +90,9 @@ func Open(path string, mode Mode) (Toolchain, error) {
 		return nil, err
 	}
 
+	if tc.builtin != nil {
+		return &builtinToolchain{tc.Path}, nil
+	}
 	if mode&AsProgram > 0 && tc.Program != "" {
 		return &programToolchain{filepath.Join(tc.Dir, tc.Program)}, nil
 	}
@@ -198,6 +209,9 @@ func (t *dockerToolchain) Build() error {
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Run(); err != nil {
+		if srclib.Offline {
+			return fmt.Errorf("%s (working dir was: %s, command was: `%v`; in offline mode, the Dockerfile's base images must already be pulled)", err, cmd.Dir, cmd.Args)
+		}
 		return fmt.Errorf("%s (working dir was: %s, command was: `%v`)", err, cmd.Dir, cmd.Args)
 	}
 	return nil
@@ -217,6 +231,12 @@ func (t *dockerToolchain) Command() (*exec.Cmd, error) {
 	// TODO(sqs): once all the toolchains have a "USER srclib" directive, add:
 	//   "--user", "srclib"
 	// to the run options below.
-	cmd := exec.Command("docker", "run", "--memory=4g", "-i", "--volume="+t.hostVolumeDir+":/src:ro", t.imageName)
+	args := []string{"run", "--memory=4g", "-i", "--volume=" + t.hostVolumeDir + ":/src:ro"}
+	if srclib.Offline {
+		// Containers don't inherit the environment, so pass offline
+		// mode to the toolchain explicitly (and enforce it).
+		args = append(args, "--network=none", "--env="+srclib.OfflineEnv+"=1")
+	}
+	cmd := exec.Command("docker", append(args, t.imageName)...)
 	return cmd, nil
 }
@@ -0,0 +1,36 @@
+package toolchain
+
+import (
+	"io"
+	"os/exec"
+
+	"sourcegraph.com/sourcegraph/srclib/tracing"
+)
+
+// SetToolSpanResult records the exit code of cmd (which must have
+// exited) and the number of bytes it wrote to stdout on span.
+func SetToolSpanResult(span tracing.Span, cmd *exec.Cmd, outputBytes int64) {
+	if cmd.ProcessState != nil {
+		span.SetAttributes("exit_code", cmd.ProcessState.ExitCode())
+	}
+	span.SetAttributes("output_bytes", outputBytes)
+}
+
+// EndToolSpan records err (if non-nil) and the kind of failure (see
+// RecordRun) on span and ends it.
+func EndToolSpan(span tracing.Span, err error) {
+	span.SetAttributes("result", runResult(err))
+	span.End(err)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,64 @@
+package toolchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Version returns an opaque version string for the toolchain that
+// changes whenever its Srclibtoolchain config file, program, or
+// Dockerfile changes. Toolchains have no declared versions, so the
+// version is a hash of the contents of those files. The version of a
+// built-in toolchain is a hash of the src program.
+func (t *Info) Version() (string, error) {
+	h := sha256.New()
+	if t.builtin != nil {
+		src, err := os.Executable()
+		if err != nil {
+			return "", err
+		}
+		f, err := os.Open(src)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	for _, name := range []string{t.ConfigFile, t.Program, t.Dockerfile} {
+		if name == "" {
+			continue
+		}
+		f, err := os.Open(filepath.Join(t.Dir, name))
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\n", name)
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// LookupVersion returns the version (see (*Info).Version) of the
+// toolchain at toolchainPath.
+func LookupVersion(toolchainPath string) (string, error) {
+	tc, err := Lookup(toolchainPath)
+	if err != nil {
+		return "", err
+	}
+	if tc == nil {
+		// No toolchains are used (see SRCLIB_NO_TOOLCHAINS).
+		return "", nil
+	}
+	return tc.Version()
+}
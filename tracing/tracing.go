@@ -0,0 +1,102 @@
+// Package tracing records spans for the phases of srclib's pipeline
+// (scanning, planning, making, normalizing, importing, and running
+// tools), so that slow builds can be diagnosed.
+//
+// Spans are recorded by the Tracer set with SetTracer. By default there
+// is none, and spans are discarded. This package has no dependencies;
+// the src program sets a Tracer that exports spans with OpenTelemetry
+// only when it is built with the "otel" build tag.
+package tracing
+
+import (
+	"context"
+	"sync"
+)
+
+// A Tracer starts spans. It must be safe for concurrent use.
+type Tracer interface {
+	// Start starts a span named name (as a child of ctx's span, if
+	// any) and returns a copy of ctx that carries it. Attrs are
+	// alternating attribute names and values (of type string, int,
+	// int64, or []string).
+	Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, Span)
+
+	// TraceParent returns the W3C traceparent header value that
+	// identifies ctx's span, or "" if ctx has no span.
+	TraceParent(ctx context.Context) string
+
+	// WithTraceParent returns a copy of ctx whose span is the
+	// (remote) span identified by traceparent, a W3C traceparent
+	// header value.
+	WithTraceParent(ctx context.Context, traceparent string) context.Context
+}
+
+// A Span is a traced operation.
+type Span interface {
+	// SetAttributes sets attributes of the span (alternating names
+	// and values, as in Tracer.Start).
+	SetAttributes(attrs ...interface{})
+
+	// End ends the span, recording err as its error if it is
+	// non-nil.
+	End(err error)
+}
+
+var (
+	mu     sync.RWMutex
+	tracer Tracer = nopTracer{}
+)
+
+// SetTracer sets the Tracer that records spans. If t is nil, spans
+// are discarded.
+func SetTracer(t Tracer) {
+	if t == nil {
+		t = nopTracer{}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	tracer = t
+}
+
+func current() Tracer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return tracer
+}
+
+// Start starts a span with the current Tracer (see Tracer.Start).
+func Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, Span) {
+	return current().Start(ctx, name, attrs...)
+}
+
+// TraceParent returns the W3C traceparent header value that identifies
+// ctx's span (see Tracer.TraceParent).
+func TraceParent(ctx context.Context) string {
+	return current().TraceParent(ctx)
+}
+
+// WithTraceParent returns a copy of ctx whose span is the remote span
+// identified by traceparent (see Tracer.WithTraceParent). If
+// traceparent is empty, ctx is returned.
+func WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	return current().WithTraceParent(ctx, traceparent)
+}
+
+// nopTracer discards spans.
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+func (nopTracer) TraceParent(ctx context.Context) string { return "" }
+func (nopTracer) WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	return ctx
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(attrs ...interface{}) {}
+func (nopSpan) End(err error)                      {}
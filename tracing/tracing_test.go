@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testTracer struct{ spans []*testSpan }
+
+type traceParentKey struct{}
+
+type testSpan struct {
+	name  string
+	attrs []interface{}
+	err   error
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs ...interface{}) (context.Context, Span) {
+	s := &testSpan{name: name, attrs: attrs}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+func (t *testTracer) TraceParent(ctx context.Context) string { return "tp" }
+func (t *testTracer) WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, traceparent)
+}
+
+func (s *testSpan) SetAttributes(attrs ...interface{}) { s.attrs = append(s.attrs, attrs...) }
+func (s *testSpan) End(err error)                      { s.err = err }
+
+func TestSetTracer(t *testing.T) {
+	ctx := context.Background()
+
+	// Spans are discarded by default.
+	_, span := Start(ctx, "a", "k", "v")
+	span.SetAttributes("n", 1)
+	span.End(nil)
+	if tp := TraceParent(ctx); tp != "" {
+		t.Errorf("got traceparent %q with no tracer, want none", tp)
+	}
+
+	tr := &testTracer{}
+	SetTracer(tr)
+	defer SetTracer(nil)
+	_, span = Start(ctx, "b", "k", "v")
+	span.SetAttributes("n", 1)
+	errX := errors.New("x")
+	span.End(errX)
+	want := []*testSpan{{name: "b", attrs: []interface{}{"k", "v", "n", 1}, err: errX}}
+	if !reflect.DeepEqual(tr.spans, want) {
+		t.Errorf("got spans %+v, want %+v", tr.spans, want)
+	}
+	if tp := TraceParent(ctx); tp != "tp" {
+		t.Errorf("got traceparent %q, want tp", tp)
+	}
+	if got := WithTraceParent(ctx, ""); got != ctx {
+		t.Error("WithTraceParent with empty traceparent changed ctx")
+	}
+	if got := WithTraceParent(ctx, "p").Value(traceParentKey{}); got != "p" {
+		t.Errorf("got traceparent %v in context, want p", got)
+	}
+}
@@ -0,0 +1,74 @@
+package unit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ComputeFingerprint computes a deterministic fingerprint of u (see the
+// Fingerprint field) from the contents of its files (which are read
+// relative to dir) and toolVersions, a map of op name (e.g., "graph")
+// to the version of the tool that performs that op on u.
+//
+// The fingerprint does not depend on u's Repo, CommitID, existing
+// Fingerprint, License (which doesn't affect build data), or the
+// order of its Files, so build data can be reused across commits when
+// a source unit has not changed.
+func (u *SourceUnit) ComputeFingerprint(dir string, toolVersions map[string]string) (string, error) {
+	h := sha256.New()
+
+	files := make([]string, len(u.Files))
+	copy(files, u.Files)
+	sort.Strings(files)
+
+	def := *u
+	def.Repo, def.CommitID, def.Fingerprint, def.License = "", "", "", ""
+	def.Files = files
+	if err := json.NewEncoder(h).Encode(def); err != nil {
+		return "", err
+	}
+
+	for _, file := range files {
+		fmt.Fprintf(h, "file %q\n", file)
+		if err := hashFile(h, filepath.Join(dir, file)); err != nil {
+			return "", err
+		}
+	}
+
+	ops := make([]string, 0, len(toolVersions))
+	for op := range toolVersions {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		fmt.Fprintf(h, "tool %q %q\n", op, toolVersions[op])
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFile writes the contents of the named file (or a marker, if the
+// file does not exist) to h.
+func hashFile(h io.Writer, name string) error {
+	f, err := os.Open(name)
+	if os.IsNotExist(err) {
+		_, err := io.WriteString(h, "missing\n")
+		return err
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(h, "%d\n", fi.Size())
+	_, err = io.Copy(h, f)
+	return err
+}
@@ -0,0 +1,55 @@
+package unit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestComputeFingerprint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "srclib-fingerprint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFile := func(name, data string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("a", "a")
+	writeFile("b", "b")
+
+	u := &SourceUnit{Name: "n", Type: "t", Files: []string{"a", "b"}}
+	fingerprint := func(u *SourceUnit, toolVersions map[string]string) string {
+		fp, err := u.ComputeFingerprint(dir, toolVersions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fp
+	}
+	orig := fingerprint(u, map[string]string{"graph": "1"})
+
+	// Commit, file order, and existing fingerprint don't matter.
+	same := &SourceUnit{Name: "n", Type: "t", Files: []string{"b", "a"}, CommitID: "c", Fingerprint: "x"}
+	if fp := fingerprint(same, map[string]string{"graph": "1"}); fp != orig {
+		t.Errorf("got fingerprint %q for equivalent source unit, want %q", fp, orig)
+	}
+
+	changes := map[string]func() string{
+		"tool version": func() string { return fingerprint(u, map[string]string{"graph": "2"}) },
+		"config": func() string {
+			return fingerprint(&SourceUnit{Name: "n", Type: "t", Files: []string{"a", "b"}, Config: map[string]interface{}{"k": "v"}}, map[string]string{"graph": "1"})
+		},
+		"file contents": func() string {
+			writeFile("a", "aa")
+			return fingerprint(u, map[string]string{"graph": "1"})
+		},
+	}
+	for label, f := range changes {
+		if fp := f(); fp == orig {
+			t.Errorf("%s: got unchanged fingerprint, want a different one", label)
+		}
+	}
+}
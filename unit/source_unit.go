@@ -81,6 +81,15 @@ type SourceUnit struct {
 	// display the source unit
 	Info *Info `json:",omitempty"`
 
+	// License is the license of the source unit's code, as an SPDX license
+	// expression (e.g., "MIT" or "Apache-2.0 OR MIT"). Scanners should set it
+	// from the license declared in the source unit's manifest (e.g.,
+	// package.json's "license" field), if any. Otherwise the `src` tool sets
+	// it from the nearest license file in the source unit's dir or its
+	// parent dirs (up to the repository root), so units without their own
+	// license file get the repository's license.
+	License string `json:",omitempty"`
+
 	// Data is additional data dumped by the scanner about this source unit. It
 	// typically holds information that the scanner wants to make available to
 	// other components in the toolchain (grapher, dep resolver, etc.).
@@ -97,6 +106,19 @@ type SourceUnit struct {
 	// automatically according to the user's configuration.
 	Ops map[string]*srclib.ToolRef `json:",omitempty"`
 
+	// Variants lists additional build configurations under which the
+	// source unit is graphed (see Variant). The build data for each
+	// variant is stored as a separate source unit (see VariantName).
+	Variants []*Variant `json:",omitempty"`
+
+	// Fingerprint is a hash of the contents of the source unit's files,
+	// its definition (including Config and Ops), and the versions of the
+	// tools that analyze it. It is computed by the `src` tool at scan
+	// time (see ComputeFingerprint) and is used as the cache key for
+	// build data produced from the source unit. It is empty if it has
+	// not been computed.
+	Fingerprint string `json:",omitempty"`
+
 	// TODO(sqs): add a way to specify the toolchains and tools to use for
 	// various tasks on this source unit
 }
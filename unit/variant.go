@@ -0,0 +1,61 @@
+package unit
+
+import "strings"
+
+// A Variant is an additional build configuration (such as GOOS=windows,
+// or a set of preprocessor defines) under which a source unit is
+// graphed. Code that is conditionally compiled is only visible to
+// graphers in some configurations, so graphing a source unit under
+// multiple configurations makes all of its code visible.
+type Variant struct {
+	// Name identifies the variant among the source unit's variants
+	// (e.g., "windows").
+	Name string
+
+	// Config is the Config properties that the variant sets (e.g.,
+	// {"GOOS": "windows"}), which take precedence over those of the
+	// source unit.
+	Config map[string]interface{} `json:",omitempty"`
+}
+
+// VariantSep separates the source unit name from the variant name in
+// the name of a variant source unit (see (*SourceUnit).Variant).
+const VariantSep = "~"
+
+// VariantName returns the name of the variant source unit for the
+// named variant of the named source unit.
+func VariantName(unitName, variantName string) string {
+	return unitName + VariantSep + variantName
+}
+
+// SplitVariantName splits the name of a variant source unit into the
+// name of the source unit and the variant name. If name is not the name
+// of a variant source unit, it is returned unchanged and variantName is
+// empty.
+func SplitVariantName(name string) (unitName, variantName string) {
+	if i := strings.LastIndex(name, VariantSep); i != -1 {
+		return name[:i], name[i+len(VariantSep):]
+	}
+	return name, ""
+}
+
+// Variant returns a copy of u that is configured for v. If rename is
+// true, its name is the variant source unit name (see VariantName),
+// which distinguishes its build data from u's; otherwise, its name is
+// unchanged (which is what tools expect). Its Config is u's Config
+// overlaid with v's Config, and it has no Variants.
+func (u *SourceUnit) Variant(v *Variant, rename bool) *SourceUnit {
+	vu := *u
+	if rename {
+		vu.Name = VariantName(u.Name, v.Name)
+	}
+	vu.Config = make(map[string]interface{}, len(u.Config)+len(v.Config))
+	for k, val := range u.Config {
+		vu.Config[k] = val
+	}
+	for k, val := range v.Config {
+		vu.Config[k] = val
+	}
+	vu.Variants = nil
+	return &vu
+}
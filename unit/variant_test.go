@@ -0,0 +1,36 @@
+package unit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSourceUnit_Variant(t *testing.T) {
+	u := &SourceUnit{
+		Name:     "p",
+		Type:     "GoPackage",
+		Config:   map[string]interface{}{"GOOS": "linux", "a": "b"},
+		Variants: []*Variant{{Name: "windows", Config: map[string]interface{}{"GOOS": "windows"}}},
+	}
+
+	vu := u.Variant(u.Variants[0], true)
+	if want := "p~windows"; vu.Name != want {
+		t.Errorf("got name %q, want %q", vu.Name, want)
+	}
+	if want := map[string]interface{}{"GOOS": "windows", "a": "b"}; !reflect.DeepEqual(vu.Config, want) {
+		t.Errorf("got Config %v, want %v", vu.Config, want)
+	}
+	if vu.Variants != nil {
+		t.Errorf("got Variants %v, want none", vu.Variants)
+	}
+	if u.Config["GOOS"] != "linux" {
+		t.Error("original source unit's Config was modified")
+	}
+
+	if name, variant := SplitVariantName(vu.Name); name != "p" || variant != "windows" {
+		t.Errorf("got SplitVariantName %q, %q, want %q, %q", name, variant, "p", "windows")
+	}
+	if name, variant := SplitVariantName("p"); name != "p" || variant != "" {
+		t.Errorf("got SplitVariantName %q, %q, want %q, %q", name, variant, "p", "")
+	}
+}
@@ -0,0 +1,659 @@
+// Package yaml parses the subset of YAML used in configuration files
+// (such as docker-compose files and CI configs) into a tree of nodes
+// that records the byte offsets of each node, so that graphers can
+// emit defs and refs for the values.
+//
+// Block and flow mappings and sequences, plain and quoted scalars,
+// literal and folded block scalars, anchors, aliases, and merge keys
+// ("<<") are supported. Tags are ignored, and only the first document
+// in a stream is parsed.
+package yaml
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Kind is the kind of a Node.
+type Kind int
+
+const (
+	Scalar Kind = iota
+	Mapping
+	Sequence
+)
+
+// A Node is a YAML value.
+type Node struct {
+	Kind Kind
+
+	// Value is the value of a scalar (with quotes and escapes
+	// processed, and the lines of block scalars joined).
+	Value string
+
+	// Keys and Values are the keys and values of a mapping's entries,
+	// in order. Values holds the items of a sequence.
+	Keys   []*Node
+	Values []*Node
+
+	// Start and End are the byte offsets of the node's text. For
+	// quoted scalars, they exclude the quotes. For block scalars, they
+	// span the block's lines (excluding the indicator). Nodes that were
+	// omitted (e.g., the null value of "key:") are empty at the offset
+	// where they would be.
+	Start, End int
+}
+
+// Get returns the value of the entry with the given key in the
+// mapping n, or nil if n isn't a mapping or has no such entry.
+func (n *Node) Get(key string) *Node {
+	if n == nil || n.Kind != Mapping {
+		return nil
+	}
+	for i, k := range n.Keys {
+		if k.Value == key {
+			return n.Values[i]
+		}
+	}
+	return nil
+}
+
+// Key returns the key node of the entry with the given key in the
+// mapping n, or nil if n isn't a mapping or has no such entry.
+func (n *Node) Key(key string) *Node {
+	if n == nil || n.Kind != Mapping {
+		return nil
+	}
+	for _, k := range n.Keys {
+		if k.Value == key {
+			return k
+		}
+	}
+	return nil
+}
+
+// Items returns the scalars in n: n itself if it is a scalar, or the
+// scalar items of n if it is a sequence, or the keys of n if it is a
+// mapping. The lists in configuration files can often be written in
+// any of these forms.
+func (n *Node) Items() []*Node {
+	if n == nil {
+		return nil
+	}
+	switch n.Kind {
+	case Scalar:
+		if n.Start == n.End && n.Value == "" {
+			return nil
+		}
+		return []*Node{n}
+	case Mapping:
+		return n.Keys
+	}
+	var items []*Node
+	for _, v := range n.Values {
+		if v.Kind == Scalar {
+			items = append(items, v)
+		}
+	}
+	return items
+}
+
+// Parse parses the YAML document in data.
+func Parse(data []byte) (*Node, error) {
+	p := &parser{data: data, anchors: map[string]*Node{}}
+	p.splitLines()
+	if len(p.lines) == 0 {
+		return &Node{Kind: Mapping}, nil
+	}
+	n, err := p.parseBlock(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.lines) {
+		return nil, p.errorf(p.lines[p.i].start, "unexpected content")
+	}
+	return n, nil
+}
+
+// A line is a line of YAML that has content (other than comments).
+type line struct {
+	indent int // number of leading spaces
+
+	// start and end are the offsets of the line's content (after the
+	// indentation and before any comment).
+	start, end int
+
+	// next is the offset of the next line.
+	next int
+}
+
+type parser struct {
+	data    []byte
+	lines   []line
+	i       int // index of the current line
+	anchors map[string]*Node
+}
+
+func (p *parser) errorf(off int, format string, args ...interface{}) error {
+	lineno := bytes.Count(p.data[:off], []byte("\n")) + 1
+	return fmt.Errorf("yaml: line %d: %s", lineno, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) splitLines() {
+	for start := 0; start < len(p.data); {
+		end := bytes.IndexByte(p.data[start:], '\n')
+		next := len(p.data)
+		if end == -1 {
+			end = len(p.data)
+		} else {
+			end += start
+			next = end + 1
+		}
+		l := line{start: start, end: end, next: next}
+		for l.start < l.end && p.data[l.start] == ' ' {
+			l.start++
+		}
+		l.indent = l.start - start
+		l.end = l.start + commentStart(p.data[l.start:l.end])
+		for l.end > l.start && isSpace(p.data[l.end-1]) {
+			l.end--
+		}
+		start = next
+
+		if l.indent == 0 {
+			text := string(p.data[l.start:l.end])
+			if text == "---" || text == "..." {
+				if len(p.lines) > 0 {
+					break // only parse the first document
+				}
+				continue
+			}
+			if strings.HasPrefix(text, "%") && len(p.lines) == 0 {
+				continue // a directive
+			}
+		}
+		if l.start < l.end {
+			p.lines = append(p.lines, l)
+		}
+	}
+}
+
+func isSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\r' }
+
+// commentStart returns the offset of the comment in text (or
+// len(text) if there is none), skipping quoted strings.
+func commentStart(text []byte) int {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '#' && (i == 0 || isSpace(text[i-1])):
+			return i
+		case (c == '"' || c == '\'') && (i == 0 || isSpace(text[i-1]) || strings.IndexByte("[{,:-", text[i-1]) != -1):
+			quote = c
+		}
+	}
+	return len(text)
+}
+
+// parseBlock parses the block node whose first line is the current
+// line, which has the given indentation.
+func (p *parser) parseBlock(indent int) (*Node, error) {
+	l := p.lines[p.i]
+	text := p.data[l.start:l.end]
+	switch {
+	case text[0] == '-' && (len(text) == 1 || text[1] == ' '):
+		return p.parseSequence(indent)
+	case mappingKeyEnd(text) != -1:
+		return p.parseMapping(indent)
+	}
+	p.i++
+	return p.parseInline(l.start, l.end, l.indent)
+}
+
+// mappingKeyEnd returns the offset of the ':' that ends the mapping
+// key at the beginning of text, or -1 if text isn't a mapping entry.
+func mappingKeyEnd(text []byte) int {
+	if len(text) == 0 || text[0] == '[' || text[0] == '{' {
+		return -1
+	}
+	i := 0
+	if text[0] == '"' || text[0] == '\'' {
+		end := quotedEnd(text)
+		if end == -1 {
+			return -1
+		}
+		i = end
+	}
+	for ; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || isSpace(text[i+1])) {
+			return i
+		}
+	}
+	return -1
+}
+
+// quotedEnd returns the offset just after the closing quote of the
+// quoted string at the beginning of text, or -1 if it isn't closed.
+func quotedEnd(text []byte) int {
+	q := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case q == '"' && text[i] == '\\':
+			i++
+		case text[i] == q && q == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			i++
+		case text[i] == q:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func (p *parser) parseSequence(indent int) (*Node, error) {
+	seq := &Node{Kind: Sequence, Start: p.lines[p.i].start}
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		text := p.data[l.start:l.end]
+		if l.indent != indent || text[0] != '-' || (len(text) > 1 && text[1] != ' ') {
+			break
+		}
+		var item *Node
+		if len(text) == 1 {
+			p.i++
+			if p.i < len(p.lines) && p.lines[p.i].indent > indent {
+				var err error
+				if item, err = p.parseBlock(p.lines[p.i].indent); err != nil {
+					return nil, err
+				}
+			} else {
+				item = &Node{Kind: Scalar, Start: l.end, End: l.end}
+			}
+		} else {
+			// Parse the rest of the line as if it were on its own line,
+			// indented to where it starts.
+			start := l.start + 1
+			for isSpace(p.data[start]) {
+				start++
+			}
+			if c := p.data[start]; c == '|' || c == '>' {
+				p.i++
+				item = p.parseBlockScalar(c, indent, l.next)
+			} else {
+				p.lines[p.i].indent += start - l.start
+				p.lines[p.i].start = start
+				var err error
+				if item, err = p.parseBlock(p.lines[p.i].indent); err != nil {
+					return nil, err
+				}
+			}
+		}
+		seq.Values = append(seq.Values, item)
+		seq.End = item.End
+	}
+	return seq, nil
+}
+
+func (p *parser) parseMapping(indent int) (*Node, error) {
+	m := &Node{Kind: Mapping, Start: p.lines[p.i].start}
+	var merges []*Node
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		text := p.data[l.start:l.end]
+		if l.indent != indent {
+			if l.indent > indent {
+				return nil, p.errorf(l.start, "bad indentation")
+			}
+			break
+		}
+		colon := mappingKeyEnd(text)
+		if colon == -1 {
+			break
+		}
+		key, err := p.parseScalar(l.start, l.start+colon)
+		if err != nil {
+			return nil, err
+		}
+
+		valueStart := l.start + colon + 1
+		for valueStart < l.end && isSpace(p.data[valueStart]) {
+			valueStart++
+		}
+		var value *Node
+		p.i++
+		if valueStart < l.end {
+			rest := p.data[valueStart:l.end]
+			if rest[0] == '&' && bytes.IndexByte(rest, ' ') == -1 && p.i < len(p.lines) && p.lines[p.i].indent > indent {
+				// An anchored block node.
+				if value, err = p.parseBlock(p.lines[p.i].indent); err != nil {
+					return nil, err
+				}
+				p.anchors[string(rest[1:])] = value
+			} else if rest[0] == '|' || rest[0] == '>' {
+				value = p.parseBlockScalar(rest[0], indent, l.next)
+			} else if value, err = p.parseInline(valueStart, l.end, indent); err != nil {
+				return nil, err
+			}
+		} else if p.i < len(p.lines) && (p.lines[p.i].indent > indent || (p.lines[p.i].indent == indent && p.data[p.lines[p.i].start] == '-')) {
+			// A nested block node, or a sequence at the same indentation
+			// as its key.
+			if value, err = p.parseBlock(p.lines[p.i].indent); err != nil {
+				return nil, err
+			}
+		} else {
+			value = &Node{Kind: Scalar, Start: l.end, End: l.end}
+		}
+
+		if key.Value == "<<" {
+			merges = append(merges, value)
+			continue
+		}
+		m.Keys = append(m.Keys, key)
+		m.Values = append(m.Values, value)
+		m.End = value.End
+	}
+
+	for _, merge := range merges {
+		mms := []*Node{merge}
+		if merge.Kind == Sequence {
+			mms = merge.Values
+		}
+		for _, mm := range mms {
+			if mm.Kind != Mapping {
+				continue
+			}
+			for i, k := range mm.Keys {
+				if m.Key(k.Value) == nil {
+					m.Keys = append(m.Keys, k)
+					m.Values = append(m.Values, mm.Values[i])
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+// parseBlockScalar parses the literal ('|') or folded ('>') block
+// scalar that starts at offset start, whose lines must be indented
+// more than indent.
+func (p *parser) parseBlockScalar(style byte, indent, start int) *Node {
+	n := &Node{Kind: Scalar, Start: start, End: start}
+	var lines []string
+	blockIndent := -1
+	for off := start; off < len(p.data); {
+		end := bytes.IndexByte(p.data[off:], '\n')
+		next := len(p.data)
+		if end == -1 {
+			end = len(p.data)
+		} else {
+			end += off
+			next = end + 1
+		}
+		text := bytes.TrimRight(p.data[off:end], "\r")
+		ind := len(text) - len(bytes.TrimLeft(text, " "))
+		if len(bytes.TrimSpace(text)) == 0 {
+			lines = append(lines, "")
+		} else {
+			if ind <= indent {
+				break
+			}
+			if blockIndent == -1 {
+				blockIndent = ind
+			}
+			if ind < blockIndent {
+				break
+			}
+			lines = append(lines, string(text[blockIndent:]))
+			n.End = off + len(text)
+		}
+		off = next
+	}
+
+	// Skip the lines that were consumed.
+	for p.i < len(p.lines) && p.lines[p.i].start < n.End {
+		p.i++
+	}
+
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if style == '|' {
+		n.Value = strings.Join(lines, "\n")
+	} else {
+		n.Value = strings.Join(lines, " ")
+	}
+	if len(lines) > 0 {
+		n.Value += "\n"
+	}
+	return n
+}
+
+// parseInline parses the flow node or scalar in data[start:end].
+func (p *parser) parseInline(start, end, indent int) (*Node, error) {
+	// Skip tags and record anchors.
+	var anchor string
+	for start < end && (p.data[start] == '!' || p.data[start] == '&') {
+		i := start
+		for i < end && !isSpace(p.data[i]) {
+			i++
+		}
+		if p.data[start] == '&' {
+			anchor = string(p.data[start+1 : i])
+		}
+		for i < end && isSpace(p.data[i]) {
+			i++
+		}
+		start = i
+	}
+
+	var n *Node
+	switch {
+	case start == end:
+		n = &Node{Kind: Scalar, Start: start, End: start}
+	case p.data[start] == '*':
+		a, present := p.anchors[string(p.data[start+1:end])]
+		if !present {
+			return nil, p.errorf(start, "unknown alias %q", p.data[start:end])
+		}
+		n = a
+	case p.data[start] == '[' || p.data[start] == '{':
+		// Flow nodes may span multiple lines.
+		for flowEnd(p.data[start:end]) == -1 && p.i < len(p.lines) && p.lines[p.i].indent > indent {
+			end = p.lines[p.i].end
+			p.i++
+		}
+		f := &flowParser{p: p, off: start, end: end}
+		var err error
+		if n, err = f.parseValue(); err != nil {
+			return nil, err
+		}
+		f.skipSpace()
+		if f.off != end {
+			return nil, p.errorf(f.off, "unexpected content after flow node")
+		}
+	default:
+		var err error
+		if n, err = p.parseScalar(start, end); err != nil {
+			return nil, err
+		}
+		// Continuation lines of multi-line plain scalars.
+		if n.Kind == Scalar && p.data[start] != '"' && p.data[start] != '\'' {
+			for p.i < len(p.lines) && p.lines[p.i].indent > indent && mappingKeyEnd(p.data[p.lines[p.i].start:p.lines[p.i].end]) == -1 {
+				l := p.lines[p.i]
+				n.Value += " " + string(p.data[l.start:l.end])
+				n.End = l.end
+				p.i++
+			}
+		}
+	}
+	if anchor != "" {
+		p.anchors[anchor] = n
+	}
+	return n, nil
+}
+
+// flowEnd returns the offset just after the end of the flow node at
+// the beginning of text, or -1 if it isn't closed.
+func flowEnd(text []byte) int {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			end := quotedEnd(text[i:])
+			if end == -1 {
+				return -1
+			}
+			i += end - 1
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// parseScalar parses the (possibly quoted) scalar in data[start:end].
+func (p *parser) parseScalar(start, end int) (*Node, error) {
+	text := p.data[start:end]
+	switch text[0] {
+	case '"':
+		qend := quotedEnd(text)
+		if qend != len(text) {
+			return nil, p.errorf(start, "bad double-quoted string")
+		}
+		s, err := strconv.Unquote(string(text))
+		if err != nil {
+			s = string(text[1 : len(text)-1])
+		}
+		return &Node{Kind: Scalar, Value: s, Start: start + 1, End: end - 1}, nil
+	case '\'':
+		qend := quotedEnd(text)
+		if qend != len(text) {
+			return nil, p.errorf(start, "bad single-quoted string")
+		}
+		s := strings.Replace(string(text[1:len(text)-1]), "''", "'", -1)
+		return &Node{Kind: Scalar, Value: s, Start: start + 1, End: end - 1}, nil
+	}
+	return &Node{Kind: Scalar, Value: string(text), Start: start, End: end}, nil
+}
+
+// A flowParser parses a flow node.
+type flowParser struct {
+	p        *parser
+	off, end int
+}
+
+func (f *flowParser) skipSpace() {
+	for f.off < f.end && (isSpace(f.p.data[f.off]) || f.p.data[f.off] == '\n') {
+		f.off++
+	}
+}
+
+func (f *flowParser) parseValue() (*Node, error) {
+	f.skipSpace()
+	if f.off == f.end {
+		return nil, f.p.errorf(f.off, "unexpected end of flow node")
+	}
+	data := f.p.data
+	switch data[f.off] {
+	case '[':
+		n := &Node{Kind: Sequence, Start: f.off}
+		f.off++
+		for {
+			f.skipSpace()
+			if f.off < f.end && data[f.off] == ']' {
+				f.off++
+				n.End = f.off
+				return n, nil
+			}
+			v, err := f.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			n.Values = append(n.Values, v)
+			if err := f.separator(']'); err != nil {
+				return nil, err
+			}
+		}
+	case '{':
+		n := &Node{Kind: Mapping, Start: f.off}
+		f.off++
+		for {
+			f.skipSpace()
+			if f.off < f.end && data[f.off] == '}' {
+				f.off++
+				n.End = f.off
+				return n, nil
+			}
+			k, err := f.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			f.skipSpace()
+			var v *Node
+			if f.off < f.end && data[f.off] == ':' {
+				f.off++
+				if v, err = f.parseValue(); err != nil {
+					return nil, err
+				}
+			} else {
+				v = &Node{Kind: Scalar, Start: f.off, End: f.off}
+			}
+			n.Keys = append(n.Keys, k)
+			n.Values = append(n.Values, v)
+			if err := f.separator('}'); err != nil {
+				return nil, err
+			}
+		}
+	case '"', '\'':
+		qend := quotedEnd(data[f.off:f.end])
+		if qend == -1 {
+			return nil, f.p.errorf(f.off, "unterminated string")
+		}
+		start := f.off
+		f.off += qend
+		return f.p.parseScalar(start, f.off)
+	case '*':
+		start := f.off
+		for f.off < f.end && strings.IndexByte(",]} \t", data[f.off]) == -1 {
+			f.off++
+		}
+		return f.p.parseInline(start, f.off, 0)
+	}
+	start := f.off
+	for f.off < f.end && strings.IndexByte(",[]{}", data[f.off]) == -1 && !(data[f.off] == ':' && (f.off+1 == f.end || isSpace(data[f.off+1]) || strings.IndexByte(",]}", data[f.off+1]) != -1)) {
+		f.off++
+	}
+	end := f.off
+	for end > start && isSpace(data[end-1]) {
+		end--
+	}
+	return &Node{Kind: Scalar, Value: string(data[start:end]), Start: start, End: end}, nil
+}
+
+// separator consumes the ',' between flow collection entries, or
+// checks that the collection is closed with the given delimiter.
+func (f *flowParser) separator(close byte) error {
+	f.skipSpace()
+	if f.off < f.end {
+		switch f.p.data[f.off] {
+		case ',':
+			f.off++
+			return nil
+		case close:
+			return nil
+		}
+	}
+	return f.p.errorf(f.off, "expected ',' or %q in flow node", close)
+}
@@ -0,0 +1,99 @@
+package yaml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data := []byte(`# comment
+version: "3"
+defaults: &defaults
+  restart: always
+services:
+  web:
+    <<: *defaults
+    image: 'nginx:1.25'   # trailing comment
+    depends_on: [db, "cache"]
+    ports:
+    - "80:80"
+    - 443
+    command: |
+      echo hi
+        indented
+
+      done
+    env:
+      - KEY: value
+        OTHER: x
+  db: {image: postgres, volumes: [data]}
+`)
+	root, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := func(n *Node) string { return string(data[n.Start:n.End]) }
+
+	if v := root.Get("version"); v == nil || v.Value != "3" || text(v) != "3" {
+		t.Errorf("got version %+v", v)
+	}
+	web := root.Get("services").Get("web")
+	if web == nil {
+		t.Fatal("no web service")
+	}
+	var keys []string
+	for _, k := range web.Keys {
+		keys = append(keys, k.Value)
+	}
+	if want := []string{"image", "depends_on", "ports", "command", "env", "restart"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("got keys %q, want %q", keys, want)
+	}
+	if v := web.Get("image"); v.Value != "nginx:1.25" || text(v) != "nginx:1.25" {
+		t.Errorf("got image %+v", v)
+	}
+	var deps []string
+	for _, d := range web.Get("depends_on").Items() {
+		if text(d) != d.Value {
+			t.Errorf("dep %q has text %q", d.Value, text(d))
+		}
+		deps = append(deps, d.Value)
+	}
+	if want := []string{"db", "cache"}; !reflect.DeepEqual(deps, want) {
+		t.Errorf("got deps %q, want %q", deps, want)
+	}
+	if ports := web.Get("ports"); ports.Kind != Sequence || len(ports.Values) != 2 || ports.Values[1].Value != "443" {
+		t.Errorf("got ports %+v", ports)
+	}
+	if cmd := web.Get("command"); cmd.Value != "echo hi\n  indented\n\ndone\n" {
+		t.Errorf("got command %q", cmd.Value)
+	}
+	if env := web.Get("env"); env.Kind != Sequence || env.Values[0].Get("OTHER").Value != "x" {
+		t.Errorf("got env %+v", env)
+	}
+	if r := web.Get("restart"); r == nil || r.Value != "always" {
+		t.Errorf("got merged restart %+v", r)
+	}
+
+	db := root.Get("services").Get("db")
+	if db.Get("image").Value != "postgres" || db.Get("volumes").Values[0].Value != "data" || text(db.Get("volumes").Values[0]) != "data" {
+		t.Errorf("got db %+v", db)
+	}
+}
+
+func TestParse_sequenceAtKeyIndentation(t *testing.T) {
+	root, err := Parse([]byte("needs:\n- build\n- test\nnext: 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := root.Get("needs"); n == nil || len(n.Items()) != 2 || root.Get("next").Value != "1" {
+		t.Errorf("got %+v", root)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	for _, s := range []string{"a: *nope\n", "a: [b\n", "a: \"b\n"} {
+		if _, err := Parse([]byte(s)); err == nil {
+			t.Errorf("%q: got no error", s)
+		}
+	}
+}